@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/spf13/cobra"
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Save a graph file as the graph of an app",
+	Long: `Validate a graph file, show how it changes the stored graph of an app and
+save it once confirmed, creating the app if needed. Graph files use the
+JSON export format, as JSON or YAML.
+
+Nodes that are already stored keep their state and timing; apply changes
+the structure of a graph, not the progress of its runs.`,
+	Example: `  ctl apply -f graph.json --app myapp
+  ctl apply -f graph.yaml --app myapp --dry-run
+  cat graph.json | ctl apply -f - --app myapp --yes`,
+	RunE: runApply,
+}
+
+var (
+	applyFile   string
+	applyYes    bool
+	applyDryRun bool
+)
+
+func init() {
+	applyCmd.Flags().StringVarP(&applyFile, "file", "f", "", "graph file to apply, - for stdin (required)")
+	applyCmd.Flags().StringVar(&appName, "app", "", "application name (required)")
+	applyCmd.Flags().BoolVarP(&applyYes, "yes", "y", false, "save without asking for confirmation")
+	applyCmd.Flags().BoolVar(&applyDryRun, "dry-run", false, "only show the changes")
+	applyCmd.MarkFlagRequired("file")
+	applyCmd.MarkFlagRequired("app")
+}
+
+func runApply(cmd *cobra.Command, args []string) error {
+	g, err := readGraphFile(applyFile, appName)
+	if err == nil {
+		err = g.Validate()
+	}
+	if err != nil {
+		printDiagnostics(applyFile, g, err)
+		return fmt.Errorf("graph file %s is invalid", applyFile)
+	}
+
+	b, err := openBackend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	current, err := b.LoadGraph(cmd.Context(), appName)
+	creating := errors.Is(err, storage.ErrAppNotFound)
+	if err != nil && !creating {
+		return fmt.Errorf("failed to load graph for app %s: %w", appName, err)
+	}
+
+	diff := graph.Diff(current, g)
+	switch {
+	case creating:
+		fmt.Printf("App %s does not exist and will be created:\n", appName)
+	case diff.Empty():
+		fmt.Printf("App %s is unchanged\n", appName)
+		return nil
+	default:
+		fmt.Printf("Changes to app %s (version %d):\n", appName, current.Version)
+	}
+	printDiff(diff, useColor(os.Stdout))
+	if applyDryRun {
+		return nil
+	}
+
+	if !applyYes {
+		if applyFile == "-" {
+			return fmt.Errorf("cannot ask for confirmation while reading the graph from stdin, use --yes")
+		}
+		if !confirm(fmt.Sprintf("Apply to app %s?", appName)) {
+			fmt.Println("Nothing applied")
+			return nil
+		}
+	}
+
+	if current != nil {
+		keepRuntimeFields(g, current)
+	}
+	if err := b.SaveGraph(cmd.Context(), appName, g); err != nil {
+		return fmt.Errorf("failed to save graph for app %s: %w", appName, err)
+	}
+	fmt.Printf("App %s applied: %d nodes, %d edges\n", appName, len(g.Nodes), len(g.Edges))
+	return nil
+}
+
+// keepRuntimeFields copies the state and timing of the nodes of current to
+// the same nodes of g
+func keepRuntimeFields(g, current *graph.Graph) {
+	for id, node := range g.Nodes {
+		stored, exists := current.Nodes[id]
+		if !exists {
+			continue
+		}
+		node.State = stored.State
+		node.StartedAt = stored.StartedAt
+		node.CompletedAt = stored.CompletedAt
+		node.Duration = stored.Duration
+	}
+}
+
+// confirm asks a yes/no question on the terminal, defaulting to no
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/events"
+	"github.com/philipsahli/innominatus-graph/pkg/execution"
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/google/uuid"
+)
+
+// backend is where the commands read and change graphs and runs: the
+// database or the HTTP API of a server
+type backend interface {
+	// ListApps returns the apps whose name contains nameContains, ordered by
+	// name; through the API at most the first 1000
+	ListApps(ctx context.Context, nameContains string) ([]storage.AppSummary, error)
+	// LoadGraph fails with storage.ErrAppNotFound for apps that do not exist
+	LoadGraph(ctx context.Context, appName string) (*graph.Graph, error)
+	// SaveGraph replaces the graph of appName, creating the app if needed
+	SaveGraph(ctx context.Context, appName string, g *graph.Graph) error
+	ListRuns(ctx context.Context, appName string, filter storage.RunFilter) ([]storage.GraphRunModel, error)
+	// Execute starts a run of the graph of appName. With simulate the run is
+	// executed in this process with the mock workflow runner.
+	Execute(ctx context.Context, appName string, simulate bool) (*executeResult, error)
+	// RunGraph starts a run like Execute and sends the state changes of its
+	// nodes to changes until it finishes, returning the finished run
+	RunGraph(ctx context.Context, appName string, simulate bool, changes chan<- events.NodeStateChanged) (*storage.GraphRunModel, error)
+	// WatchStates sends the state changes of the nodes of appName to changes
+	// until ctx is done
+	WatchStates(ctx context.Context, appName string, changes chan<- events.NodeStateChanged) error
+	// GetRun returns a run and the executions of its nodes so far
+	GetRun(ctx context.Context, runID uuid.UUID) (*storage.GraphRunModel, []storage.NodeExecutionRecord, error)
+	// RunExecutions returns the status, error and logs of the nodes of a
+	// run, which are recorded once it has finished; nil before
+	RunExecutions(ctx context.Context, runID uuid.UUID) (map[string]*execution.NodeExecution, error)
+	// NodeHistory returns the recorded state transitions of a node, oldest
+	// first
+	NodeHistory(ctx context.Context, appName, nodeID string) ([]storage.NodeStateChangeModel, error)
+	// CancelRun marks an unfinished run as failed, giving reason, or returns
+	// storage.ErrRunNotCancellable if it has finished
+	CancelRun(ctx context.Context, runID uuid.UUID, reason string) error
+	// PruneRuns deletes the finished runs of appName like
+	// storage.Repository.PruneGraphRuns, returning how many were deleted
+	PruneRuns(ctx context.Context, appName string, olderThan time.Duration, keepLast int) (int64, error)
+	// SetNodeState sets the state of a node like the node state endpoint of
+	// the API, returning every change including the propagated ones
+	SetNodeState(ctx context.Context, appName, nodeID string, state graph.NodeState) ([]events.NodeStateChanged, error)
+	Close() error
+}
+
+type executeResult struct {
+	RunID  uuid.UUID `json:"run_id"`
+	Status string    `json:"status"`
+}
+
+// openBackend connects to the server or database of the settings
+func openBackend() (backend, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config.API.URL != "" {
+		return newAPIBackend(config), nil
+	}
+	return openDatabase(config)
+}
+
+// databaseBackend works on the database directly
+type databaseBackend struct {
+	repository storage.RepositoryInterface
+	close      func() error
+}
+
+func openDatabase(config *ctlConfig) (*databaseBackend, error) {
+	db, err := storage.NewConnection(config.storageConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+
+	ctx := context.Background()
+	if config.Tenant != "" {
+		ctx = storage.WithTenant(ctx, uuid.MustParse(config.Tenant))
+	}
+	return &databaseBackend{
+		repository: storage.NewRepository(db).ForTenant(ctx),
+		close:      sqlDB.Close,
+	}, nil
+}
+
+func (b *databaseBackend) ListApps(ctx context.Context, nameContains string) ([]storage.AppSummary, error) {
+	return b.repository.ListApps(storage.AppFilter{NameContains: nameContains}, 0, 0)
+}
+
+func (b *databaseBackend) LoadGraph(ctx context.Context, appName string) (*graph.Graph, error) {
+	return b.repository.LoadGraph(appName)
+}
+
+func (b *databaseBackend) SaveGraph(ctx context.Context, appName string, g *graph.Graph) error {
+	return b.repository.SaveGraph(appName, g)
+}
+
+func (b *databaseBackend) ListRuns(ctx context.Context, appName string, filter storage.RunFilter) ([]storage.GraphRunModel, error) {
+	runs, _, err := b.repository.ListGraphRuns(appName, filter)
+	return runs, err
+}
+
+// Execute queues the run for the servers sharing the database with the run
+// queue enabled, unless it is simulated
+func (b *databaseBackend) Execute(ctx context.Context, appName string, simulate bool) (*executeResult, error) {
+	if simulate {
+		engine := execution.NewEngine(b.repository, execution.NewMockWorkflowRunner())
+		plan, err := engine.ExecuteGraph(appName)
+		if err != nil {
+			return nil, err
+		}
+		return &executeResult{RunID: plan.RunID, Status: string(plan.Status)}, nil
+	}
+
+	g, err := b.repository.LoadGraph(appName)
+	if err != nil {
+		return nil, err
+	}
+	run, err := b.repository.QueueGraphRun(appName, g.Version)
+	if err != nil {
+		return nil, err
+	}
+	return &executeResult{RunID: run.ID, Status: run.Status}, nil
+}
+
+func (b *databaseBackend) RunGraph(ctx context.Context, appName string, simulate bool, changes chan<- events.NodeStateChanged) (*storage.GraphRunModel, error) {
+	if simulate {
+		engine := execution.NewEngine(b.repository, execution.NewMockWorkflowRunner())
+		engine.RegisterObserver(events.ExecutionObserver(changePublisher(changes)))
+		plan, err := engine.ExecuteGraph(appName)
+		if err != nil {
+			return nil, err
+		}
+		return b.repository.GetGraphRun(plan.RunID)
+	}
+
+	result, err := b.Execute(ctx, appName, false)
+	if err != nil {
+		return nil, err
+	}
+	return pollRun(ctx, b, appName, result.RunID, changes)
+}
+
+// stateTimeline is implemented by storage.Repository
+type stateTimeline interface {
+	GetAppStateTimeline(appName string, from, to time.Time) ([]storage.NodeStateChangeModel, error)
+}
+
+// WatchStates polls the state history of the app, which records the
+// changes of every run and state update
+func (b *databaseBackend) WatchStates(ctx context.Context, appName string, changes chan<- events.NodeStateChanged) error {
+	timeline, ok := b.repository.(stateTimeline)
+	if !ok {
+		return fmt.Errorf("the repository has no state history to watch")
+	}
+
+	since := time.Now()
+	seen := make(map[uuid.UUID]bool)
+	ticker := time.NewTicker(runPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		recorded, err := timeline.GetAppStateTimeline(appName, since, time.Time{})
+		if err != nil {
+			return err
+		}
+		for _, change := range recorded {
+			// The next poll starts at the last change again, as more changes
+			// may be recorded at the same time
+			if seen[change.ID] {
+				continue
+			}
+			if change.ChangedAt.After(since) {
+				since = change.ChangedAt
+				seen = make(map[uuid.UUID]bool)
+			}
+			seen[change.ID] = true
+			changes <- events.NodeStateChanged{
+				Meta:     events.Meta{AppName: appName, At: change.ChangedAt},
+				Node:     &graph.Node{ID: change.NodeID, State: graph.NodeState(change.NewState)},
+				OldState: graph.NodeState(change.OldState),
+				NewState: graph.NodeState(change.NewState),
+			}
+		}
+	}
+}
+
+func (b *databaseBackend) GetRun(ctx context.Context, runID uuid.UUID) (*storage.GraphRunModel, []storage.NodeExecutionRecord, error) {
+	run, err := b.repository.GetGraphRun(runID)
+	if err != nil {
+		return nil, nil, err
+	}
+	nodes, err := b.repository.GetRunNodeExecutions(runID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return run, nodes, nil
+}
+
+func (b *databaseBackend) RunExecutions(ctx context.Context, runID uuid.UUID) (map[string]*execution.NodeExecution, error) {
+	run, err := b.repository.GetGraphRun(runID)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := execution.LoadExecutionPlan(run)
+	if err != nil || plan == nil {
+		return nil, err
+	}
+	return plan.Executions, nil
+}
+
+func (b *databaseBackend) NodeHistory(ctx context.Context, appName, nodeID string) ([]storage.NodeStateChangeModel, error) {
+	return b.repository.GetNodeStateHistory(appName, nodeID)
+}
+
+func (b *databaseBackend) CancelRun(ctx context.Context, runID uuid.UUID, reason string) error {
+	return b.repository.CancelGraphRun(runID, reason)
+}
+
+func (b *databaseBackend) PruneRuns(ctx context.Context, appName string, olderThan time.Duration, keepLast int) (int64, error) {
+	return b.repository.PruneGraphRuns(appName, olderThan, keepLast)
+}
+
+// SetNodeState saves the changes in one transaction like the API does. Only
+// servers polling the state history deliver them to their event streams.
+func (b *databaseBackend) SetNodeState(ctx context.Context, appName, nodeID string, state graph.NodeState) ([]events.NodeStateChanged, error) {
+	g, err := b.repository.LoadGraph(appName)
+	if err != nil {
+		return nil, err
+	}
+	oldStates := make(map[string]graph.NodeState, len(g.Nodes))
+	for id, node := range g.Nodes {
+		oldStates[id] = node.State
+	}
+	if err := g.UpdateNodeState(nodeID, state); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(g.Nodes))
+	for id := range g.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	states := make(map[string]graph.NodeState)
+	changes := []events.NodeStateChanged{}
+	meta := events.Meta{AppName: appName, At: time.Now()}
+	for _, id := range ids {
+		newState := g.Nodes[id].State
+		if newState == oldStates[id] {
+			continue
+		}
+		states[id] = newState
+		changes = append(changes, events.NodeStateChanged{Meta: meta, Node: g.Nodes[id], OldState: oldStates[id], NewState: newState})
+	}
+	if _, err := b.repository.UpdateNodeStates(appName, states); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (b *databaseBackend) Close() error {
+	return b.close()
+}
+
+// changePublisher sends the node state changes published to it to a
+// channel, e.g. those of an engine with events.ExecutionObserver
+type changePublisher chan<- events.NodeStateChanged
+
+func (p changePublisher) Publish(event events.Event) {
+	if change, ok := event.(events.NodeStateChanged); ok {
+		p <- change
+	}
+}
+
+// runPollInterval is how often pollRun checks a run
+const runPollInterval = 500 * time.Millisecond
+
+// pollRun checks a run until it finishes, sending the node states recorded
+// for it to changes as they change
+func pollRun(ctx context.Context, b backend, appName string, runID uuid.UUID, changes chan<- events.NodeStateChanged) (*storage.GraphRunModel, error) {
+	states := make(map[string]graph.NodeState)
+	ticker := time.NewTicker(runPollInterval)
+	defer ticker.Stop()
+	for {
+		run, nodes, err := b.GetRun(ctx, runID)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			state := graph.NodeState(node.State)
+			if states[node.NodeID] != state {
+				changes <- events.NodeStateChanged{
+					Meta:     events.Meta{AppName: appName, At: time.Now()},
+					Node:     &graph.Node{ID: node.NodeID, State: state},
+					OldState: states[node.NodeID],
+					NewState: state,
+					RunID:    runID,
+				}
+				states[node.NodeID] = state
+			}
+		}
+		if runFinished(run.Status) {
+			return run, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return run, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func runFinished(status string) bool {
+	return status == string(execution.StatusCompleted) || status == string(execution.StatusFailed)
+}
@@ -0,0 +1,544 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/events"
+	"github.com/philipsahli/innominatus-graph/pkg/execution"
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var browseCmd = &cobra.Command{
+	Use:   "browse",
+	Short: "Browse the graph of an app in a terminal UI",
+	Long: `Browse the graph of an app in a terminal UI: a list of its nodes and a
+pane with the selected node's details, properties, state history and the
+logs of the last run, or with the nodes it depends on and the nodes
+depending on it.
+
+States are updated live as they change. Keys:
+
+  ↑/k ↓/j      select the previous or next node
+  pgup pgdown  move a page
+  home/g end/G select the first or last node
+  tab          switch between details and dependencies
+  r            reload the graph and the last run
+  q            quit`,
+	Example: `  ctl browse --app myapp
+  ctl browse --app myapp --server http://localhost:8080`,
+	RunE: runBrowse,
+}
+
+func init() {
+	browseCmd.Flags().StringVar(&appName, "app", "", "application name (required)")
+	browseCmd.MarkFlagRequired("app")
+}
+
+func runBrowse(cmd *cobra.Command, args []string) error {
+	if !isTerminal(os.Stdout) {
+		return fmt.Errorf("browse needs a terminal; use export or runs instead")
+	}
+	b, err := openBackend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+	// Fail early instead of showing an empty browser
+	if _, err := b.LoadGraph(ctx, appName); err != nil {
+		return fmt.Errorf("failed to load graph for app %s: %w", appName, err)
+	}
+
+	if !useColor(os.Stdout) {
+		lipgloss.SetColorProfile(termenv.Ascii)
+	}
+	// Database warnings would draw over the UI
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	program := tea.NewProgram(newBrowser(ctx, b, appName), tea.WithAltScreen())
+	changes := make(chan events.NodeStateChanged, 64)
+	go func() {
+		for change := range changes {
+			program.Send(stateChangedMsg(change))
+		}
+	}()
+	go func() {
+		defer close(changes)
+		// Without live updates the browser still works, so errors are
+		// shown instead of ending it
+		if err := b.WatchStates(ctx, appName, changes); err != nil {
+			program.Send(watchFailedMsg{err})
+		}
+	}()
+
+	_, err = program.Run()
+	return err
+}
+
+// reloadDelay is how long the browser waits for more state changes before
+// reloading the graph
+const reloadDelay = time.Second
+
+type browseView int
+
+const (
+	detailsView browseView = iota
+	dependenciesView
+)
+
+// browser is the model of the terminal UI
+type browser struct {
+	ctx     context.Context
+	backend backend
+	appName string
+
+	graph      *graph.Graph
+	run        *storage.GraphRunModel // Last run, if any
+	executions map[string]*execution.NodeExecution
+	histories  map[string]*nodeHistory
+	ids        []string
+	err        error // Of the last load
+	watchErr   error
+	reloading  bool // Whether a reload for state changes is scheduled
+
+	cursor int
+	top    int // First node shown in the list
+	view   browseView
+	width  int
+	height int
+}
+
+// nodeHistory is the state history of a node, loaded when the node is first
+// selected
+type nodeHistory struct {
+	loading bool
+	changes []storage.NodeStateChangeModel
+	err     error
+}
+
+type graphLoadedMsg struct {
+	graph      *graph.Graph
+	run        *storage.GraphRunModel
+	executions map[string]*execution.NodeExecution
+	err        error
+}
+
+type historyLoadedMsg struct {
+	nodeID  string
+	changes []storage.NodeStateChangeModel
+	err     error
+}
+
+type stateChangedMsg events.NodeStateChanged
+
+type watchFailedMsg struct {
+	err error
+}
+
+func newBrowser(ctx context.Context, b backend, appName string) *browser {
+	return &browser{ctx: ctx, backend: b, appName: appName, histories: make(map[string]*nodeHistory)}
+}
+
+func (m *browser) Init() tea.Cmd {
+	return m.load
+}
+
+// load reads the graph and the executions of its last run
+func (m *browser) load() tea.Msg {
+	g, err := m.backend.LoadGraph(m.ctx, m.appName)
+	if err != nil {
+		return graphLoadedMsg{err: err}
+	}
+	msg := graphLoadedMsg{graph: g}
+	runs, err := m.backend.ListRuns(m.ctx, m.appName, storage.RunFilter{Limit: 1})
+	if err != nil || len(runs) == 0 {
+		msg.err = err
+		return msg
+	}
+	msg.run = &runs[0]
+	msg.executions, msg.err = m.backend.RunExecutions(m.ctx, runs[0].ID)
+	return msg
+}
+
+// loadHistory requests the state history of the selected node unless it is
+// loaded already
+func (m *browser) loadHistory() tea.Cmd {
+	nodeID := m.selected()
+	if nodeID == "" || m.histories[nodeID] != nil {
+		return nil
+	}
+	m.histories[nodeID] = &nodeHistory{loading: true}
+	return func() tea.Msg {
+		changes, err := m.backend.NodeHistory(m.ctx, m.appName, nodeID)
+		return historyLoadedMsg{nodeID: nodeID, changes: changes, err: err}
+	}
+}
+
+func (m *browser) selected() string {
+	if m.cursor < len(m.ids) {
+		return m.ids[m.cursor]
+	}
+	return ""
+}
+
+func (m *browser) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.scroll()
+	case tea.KeyMsg:
+		return m, m.handleKey(msg)
+	case graphLoadedMsg:
+		m.reloading = false
+		m.err = msg.err
+		if msg.graph == nil {
+			return m, nil
+		}
+		selected := m.selected()
+		m.graph, m.run, m.executions = msg.graph, msg.run, msg.executions
+		m.histories = make(map[string]*nodeHistory)
+		m.ids = m.ids[:0]
+		for id := range m.graph.Nodes {
+			m.ids = append(m.ids, id)
+		}
+		sort.Strings(m.ids)
+		// Keep the selection across reloads
+		m.cursor = max(0, min(sort.SearchStrings(m.ids, selected), len(m.ids)-1))
+		m.scroll()
+		return m, m.loadHistory()
+	case historyLoadedMsg:
+		m.histories[msg.nodeID] = &nodeHistory{changes: msg.changes, err: msg.err}
+	case stateChangedMsg:
+		if m.graph == nil {
+			return m, nil
+		}
+		if node, exists := m.graph.GetNode(msg.Node.ID); exists {
+			node.State = msg.NewState
+		}
+		// Reload once the changes of a run have come in, for the histories,
+		// the logs and nodes added since the graph was loaded
+		if m.reloading {
+			return m, nil
+		}
+		m.reloading = true
+		return m, tea.Tick(reloadDelay, func(time.Time) tea.Msg { return m.load() })
+	case watchFailedMsg:
+		m.watchErr = msg.err
+	}
+	return m, nil
+}
+
+func (m *browser) handleKey(msg tea.KeyMsg) tea.Cmd {
+	page := max(1, m.listHeight()-1)
+	switch msg.String() {
+	case "q", "esc", "ctrl+c":
+		return tea.Quit
+	case "up", "k":
+		m.cursor--
+	case "down", "j":
+		m.cursor++
+	case "pgup":
+		m.cursor -= page
+	case "pgdown":
+		m.cursor += page
+	case "home", "g":
+		m.cursor = 0
+	case "end", "G":
+		m.cursor = len(m.ids) - 1
+	case "tab":
+		m.view = (m.view + 1) % 2
+		return nil
+	case "r":
+		return m.load
+	default:
+		return nil
+	}
+	m.cursor = max(0, min(m.cursor, len(m.ids)-1))
+	m.scroll()
+	return m.loadHistory()
+}
+
+// scroll moves the list so that the selected node is visible
+func (m *browser) scroll() {
+	height := m.listHeight()
+	if m.cursor < m.top {
+		m.top = m.cursor
+	}
+	if m.cursor >= m.top+height {
+		m.top = m.cursor - height + 1
+	}
+	m.top = max(0, min(m.top, len(m.ids)-height))
+}
+
+// listHeight is the number of nodes the list shows: all rows but the
+// header, the footer and the borders
+func (m *browser) listHeight() int {
+	return max(1, m.height-4)
+}
+
+var (
+	browseBorder   = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("8"))
+	browseSelected = lipgloss.NewStyle().Reverse(true)
+	browseHeading  = lipgloss.NewStyle().Bold(true)
+	browseMuted    = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	browseError    = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+)
+
+// stateStyle colors a node state
+func stateStyle(state graph.NodeState) lipgloss.Style {
+	switch state {
+	case graph.NodeStateRunning:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("3"))
+	case graph.NodeStateSucceeded:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	case graph.NodeStateFailed:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	case graph.NodeStatePending:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("6"))
+	}
+	return browseMuted
+}
+
+func (m *browser) View() string {
+	if m.width == 0 {
+		return ""
+	}
+	if m.graph == nil {
+		if m.err != nil {
+			return browseError.Render("Failed to load graph: "+m.err.Error()) + "\n"
+		}
+		return "Loading graph of app " + m.appName + "...\n"
+	}
+
+	listWidth := 12
+	for _, id := range m.ids {
+		listWidth = max(listWidth, lipgloss.Width(id)+4)
+	}
+	listWidth = min(listWidth, m.width/3)
+	paneWidth := max(10, m.width-listWidth-4)
+	height := m.listHeight()
+
+	list := browseBorder.Width(listWidth).Height(height).Render(m.nodeList(listWidth, height))
+	var pane string
+	if m.view == dependenciesView {
+		pane = m.dependencies()
+	} else {
+		pane = m.details()
+	}
+	pane = browseBorder.Width(paneWidth).Height(height).MaxHeight(height + 2).Render(
+		lipgloss.NewStyle().Width(paneWidth).MaxHeight(height).Render(pane))
+
+	return lipgloss.JoinVertical(lipgloss.Left,
+		m.header(),
+		lipgloss.JoinHorizontal(lipgloss.Top, list, pane),
+		m.footer(),
+	)
+}
+
+func (m *browser) header() string {
+	header := fmt.Sprintf("%s  version %d  %d nodes  %d edges",
+		browseHeading.Render(m.appName), m.graph.Version, len(m.graph.Nodes), len(m.graph.Edges))
+	if m.run != nil {
+		header += fmt.Sprintf("  last run %s %s", m.run.ID.String()[:8], m.run.Status)
+	}
+	return lipgloss.NewStyle().MaxWidth(m.width).Render(header)
+}
+
+func (m *browser) footer() string {
+	footer := browseMuted.Render("↑/↓ select  tab details/dependencies  r reload  q quit")
+	switch {
+	case m.err != nil:
+		footer = browseError.Render("Error: " + m.err.Error())
+	case m.watchErr != nil:
+		footer += browseError.Render("  no live updates: " + m.watchErr.Error())
+	}
+	return lipgloss.NewStyle().MaxWidth(m.width).Render(footer)
+}
+
+func (m *browser) nodeList(width, height int) string {
+	var lines []string
+	for i := m.top; i < len(m.ids) && i < m.top+height; i++ {
+		node := m.graph.Nodes[m.ids[i]]
+		line := lipgloss.NewStyle().MaxWidth(width - 2).Render(node.ID)
+		line = fmt.Sprintf("%-*s", width-2, line)
+		if i == m.cursor {
+			line = browseSelected.Render(line)
+		}
+		lines = append(lines, stateStyle(node.State).Render(stateSymbol(node.State))+" "+line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func stateSymbol(state graph.NodeState) string {
+	switch state {
+	case graph.NodeStatePending:
+		return "○"
+	case graph.NodeStateRunning:
+		return "●"
+	case graph.NodeStateSucceeded:
+		return "✓"
+	case graph.NodeStateFailed:
+		return "✗"
+	}
+	return "·"
+}
+
+// details shows the fields, properties, state history and logs of the
+// selected node
+func (m *browser) details() string {
+	node, exists := m.graph.GetNode(m.selected())
+	if !exists {
+		return browseMuted.Render("The graph has no nodes")
+	}
+
+	var b strings.Builder
+	b.WriteString(browseHeading.Render(node.ID) + "\n")
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%-12s %s\n", name, value)
+		}
+	}
+	field("type", string(node.Type))
+	field("name", node.Name)
+	field("description", node.Description)
+	field("state", stateStyle(node.State).Render(string(node.State)))
+	field("created", formatTime(node.CreatedAt))
+	field("updated", formatTime(node.UpdatedAt))
+	if node.StartedAt != nil {
+		field("started", formatTime(*node.StartedAt))
+	}
+	if node.CompletedAt != nil {
+		field("completed", formatTime(*node.CompletedAt))
+		field("duration", node.Duration.String())
+	}
+
+	b.WriteString("\n" + browseHeading.Render("Properties") + "\n")
+	if len(node.Properties) == 0 {
+		b.WriteString(browseMuted.Render("  none") + "\n")
+	} else {
+		data, err := yaml.Marshal(node.Properties)
+		if err != nil {
+			data = []byte(err.Error())
+		}
+		for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+
+	b.WriteString("\n" + browseHeading.Render("State history") + "\n")
+	history := m.histories[node.ID]
+	switch {
+	case history == nil || history.loading:
+		b.WriteString(browseMuted.Render("  loading...") + "\n")
+	case history.err != nil:
+		b.WriteString(browseError.Render("  "+history.err.Error()) + "\n")
+	case len(history.changes) == 0:
+		b.WriteString(browseMuted.Render("  no changes recorded") + "\n")
+	}
+	if history != nil {
+		for _, change := range history.changes {
+			fmt.Fprintf(&b, "  %s  %s -> %s", formatTime(change.ChangedAt),
+				change.OldState, stateStyle(graph.NodeState(change.NewState)).Render(change.NewState))
+			if change.RunID != nil {
+				b.WriteString(browseMuted.Render("  run " + change.RunID.String()[:8]))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	b.WriteString("\n" + browseHeading.Render("Logs") + "\n")
+	nodeExecution := m.executions[node.ID]
+	switch {
+	case m.run == nil:
+		b.WriteString(browseMuted.Render("  the app has no runs") + "\n")
+	case m.executions == nil:
+		b.WriteString(browseMuted.Render("  recorded once run "+m.run.ID.String()[:8]+" has finished") + "\n")
+	case nodeExecution == nil:
+		b.WriteString(browseMuted.Render("  not part of run "+m.run.ID.String()[:8]) + "\n")
+	default:
+		fmt.Fprintf(&b, "  run %s: %s\n", m.run.ID.String()[:8], nodeExecution.Status)
+		if nodeExecution.Error != "" {
+			b.WriteString(browseError.Render("  "+nodeExecution.Error) + "\n")
+		}
+		for _, line := range nodeExecution.Logs {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+	return b.String()
+}
+
+// dependencies draws the depends-on edges of the selected node as trees,
+// followed by its other edges
+func (m *browser) dependencies() string {
+	node, exists := m.graph.GetNode(m.selected())
+	if !exists {
+		return browseMuted.Render("The graph has no nodes")
+	}
+
+	var b strings.Builder
+	b.WriteString(browseHeading.Render("Depends on") + "\n")
+	b.WriteString(m.nodeLabel(node) + "\n")
+	b.WriteString(dependencyTree(node.ID, m.graph.GetDependencies, m.treeLabel))
+
+	b.WriteString("\n" + browseHeading.Render("Required by") + "\n")
+	b.WriteString(m.nodeLabel(node) + "\n")
+	b.WriteString(dependencyTree(node.ID, m.graph.GetDependents, m.treeLabel))
+
+	var edges []string
+	for _, edge := range m.graph.OutgoingEdges(node.ID) {
+		if edge.Type != graph.EdgeTypeDependsOn {
+			edges = append(edges, fmt.Sprintf("  %s %s", edge.Type, edge.ToNodeID))
+		}
+	}
+	for _, edge := range m.graph.IncomingEdges(node.ID) {
+		if edge.Type != graph.EdgeTypeDependsOn {
+			edges = append(edges, fmt.Sprintf("  %s %s %s", edge.FromNodeID, edge.Type, browseMuted.Render("this node")))
+		}
+	}
+	if len(edges) > 0 {
+		sort.Strings(edges)
+		b.WriteString("\n" + browseHeading.Render("Other edges") + "\n")
+		b.WriteString(strings.Join(edges, "\n") + "\n")
+	}
+	return b.String()
+}
+
+func (m *browser) treeLabel(node *graph.Node, note string) string {
+	switch note {
+	case "":
+		return m.nodeLabel(node)
+	case treeCycle:
+		return m.nodeLabel(node) + browseError.Render(" ("+note+")")
+	}
+	return m.nodeLabel(node) + browseMuted.Render(" ("+note+")")
+}
+
+func (m *browser) nodeLabel(node *graph.Node) string {
+	return fmt.Sprintf("%s %s %s", stateStyle(node.State).Render(stateSymbol(node.State)), node.ID,
+		browseMuted.Render("("+string(node.Type)+", "+string(node.State)+")"))
+}
+
+// formatTime formats t in local time, leaving unset times empty
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format(time.DateTime)
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/api"
+	"github.com/philipsahli/innominatus-graph/pkg/events"
+	"github.com/philipsahli/innominatus-graph/pkg/execution"
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/google/uuid"
+)
+
+// apiError is an error response of the API
+type apiError struct {
+	status  int
+	message string
+	// err is matched by errors.Is, e.g. storage.ErrAppNotFound
+	err error
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s (%d %s)", e.message, e.status, http.StatusText(e.status))
+}
+
+func (e *apiError) Unwrap() error {
+	return e.err
+}
+
+var errSimulateOverAPI = errors.New("--simulate only works on the database; start the server with --simulate-executions instead")
+
+// apiBackend works on the REST API of a server
+type apiBackend struct {
+	baseURL string
+	key     string
+	token   string
+	tenant  string
+	client  *http.Client
+}
+
+func newAPIBackend(config *ctlConfig) *apiBackend {
+	return &apiBackend{
+		baseURL: strings.TrimSuffix(config.API.URL, "/") + "/api/v1",
+		key:     config.API.Key,
+		token:   config.API.Token,
+		tenant:  config.Tenant,
+		client:  &http.Client{Timeout: time.Minute},
+	}
+}
+
+// do sends a request to path and decodes the JSON response into result,
+// turning error responses into errors with the server's message
+func (b *apiBackend) do(ctx context.Context, method, path string, body, result interface{}) error {
+	resp, err := b.send(ctx, b.client, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response of %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// send sends a request to path with client, returning successful responses
+// for the caller to close
+func (b *apiBackend) send(ctx context.Context, client *http.Client, method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, b.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if b.key != "" {
+		req.Header.Set(api.APIKeyHeader, b.key)
+	}
+	if b.token != "" {
+		req.Header.Set("Authorization", "Bearer "+b.token)
+	}
+	if b.tenant != "" {
+		req.Header.Set(api.TenantHeader, b.tenant)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		var response struct {
+			Error   string   `json:"error"`
+			Details []string `json:"details"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil || response.Error == "" {
+			return nil, &apiError{status: resp.StatusCode, message: method + " " + path}
+		}
+		message := response.Error
+		if len(response.Details) > 0 {
+			message += ": " + strings.Join(response.Details, "; ")
+		}
+		return nil, &apiError{status: resp.StatusCode, message: message}
+	}
+	return resp, nil
+}
+
+func (b *apiBackend) ListApps(ctx context.Context, nameContains string) ([]storage.AppSummary, error) {
+	var response struct {
+		Apps []storage.AppSummary `json:"apps"`
+	}
+	path := "/apps?limit=1000"
+	if nameContains != "" {
+		path += "&name=" + url.QueryEscape(nameContains)
+	}
+	if err := b.do(ctx, http.MethodGet, path, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Apps, nil
+}
+
+func (b *apiBackend) LoadGraph(ctx context.Context, appName string) (*graph.Graph, error) {
+	var response struct {
+		Graph *graph.Graph `json:"graph"`
+	}
+	if err := b.do(ctx, http.MethodGet, "/graph?app="+url.QueryEscape(appName), nil, &response); err != nil {
+		var notFound *apiError
+		if errors.As(err, &notFound) && notFound.status == http.StatusNotFound {
+			notFound.err = storage.ErrAppNotFound
+		}
+		return nil, err
+	}
+	return response.Graph, nil
+}
+
+// SaveGraph imports g in the JSON export format
+func (b *apiBackend) SaveGraph(ctx context.Context, appName string, g *graph.Graph) error {
+	return b.do(ctx, http.MethodPost, "/apps/"+url.PathEscape(appName)+"/graph", graphDocument{Nodes: g.Nodes, Edges: g.Edges}, nil)
+}
+
+func (b *apiBackend) ListRuns(ctx context.Context, appName string, filter storage.RunFilter) ([]storage.GraphRunModel, error) {
+	query := url.Values{}
+	if len(filter.Statuses) > 0 {
+		query.Set("status", strings.Join(filter.Statuses, ","))
+	}
+	if !filter.StartedFrom.IsZero() {
+		query.Set("from", filter.StartedFrom.Format(time.RFC3339))
+	}
+	if !filter.StartedTo.IsZero() {
+		query.Set("to", filter.StartedTo.Format(time.RFC3339))
+	}
+	if filter.SortBy != "" {
+		query.Set("sort", string(filter.SortBy))
+	}
+	if filter.Ascending {
+		query.Set("order", "asc")
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+	if filter.Offset > 0 {
+		query.Set("offset", strconv.Itoa(filter.Offset))
+	}
+
+	var response struct {
+		Runs []storage.GraphRunModel `json:"runs"`
+	}
+	if err := b.do(ctx, http.MethodGet, "/apps/"+url.PathEscape(appName)+"/runs?"+query.Encode(), nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Runs, nil
+}
+
+func (b *apiBackend) Execute(ctx context.Context, appName string, simulate bool) (*executeResult, error) {
+	if simulate {
+		return nil, errSimulateOverAPI
+	}
+	result := &executeResult{}
+	if err := b.do(ctx, http.MethodPost, "/apps/"+url.PathEscape(appName)+"/execute", nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RunGraph follows the run through the event stream of the app, which it
+// subscribes to before starting the run, and polls the run for its status
+func (b *apiBackend) RunGraph(ctx context.Context, appName string, simulate bool, changes chan<- events.NodeStateChanged) (*storage.GraphRunModel, error) {
+	if simulate {
+		return nil, errSimulateOverAPI
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := b.subscribe(ctx, appName)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.close()
+
+	var streaming sync.WaitGroup
+	streaming.Add(1)
+	go func() {
+		defer streaming.Done()
+		forwardEvents(ctx, stream, changes)
+	}()
+	// Stop reading events before the caller closes changes
+	defer streaming.Wait()
+	defer cancel()
+
+	result, err := b.Execute(ctx, appName, false)
+	if err != nil {
+		return nil, err
+	}
+	return pollRun(ctx, b, appName, result.RunID, changes)
+}
+
+// WatchStates forwards the event stream of the app
+func (b *apiBackend) WatchStates(ctx context.Context, appName string, changes chan<- events.NodeStateChanged) error {
+	stream, err := b.subscribe(ctx, appName)
+	if err != nil {
+		return err
+	}
+	defer stream.close()
+
+	forwardEvents(ctx, stream, changes)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return fmt.Errorf("the event stream of app %s ended", appName)
+}
+
+// subscribe opens the event stream of an app, returning once the server
+// has subscribed it
+func (b *apiBackend) subscribe(ctx context.Context, appName string) (*eventReader, error) {
+	// Without the timeout of b.client, which would end the stream
+	resp, err := b.send(ctx, &http.Client{}, http.MethodGet, "/apps/"+url.PathEscape(appName)+"/events", nil)
+	if err != nil {
+		return nil, err
+	}
+	stream := newEventReader(resp.Body)
+	if name, _, err := stream.next(); err != nil {
+		stream.close()
+		return nil, fmt.Errorf("failed to subscribe to the events of app %s: %w", appName, err)
+	} else if name != "ready" {
+		stream.close()
+		return nil, fmt.Errorf("failed to subscribe to the events of app %s: unexpected event %q", appName, name)
+	}
+	return stream, nil
+}
+
+// forwardEvents sends the state changes of stream to changes until the
+// stream ends or ctx is done
+func forwardEvents(ctx context.Context, stream *eventReader, changes chan<- events.NodeStateChanged) {
+	for {
+		name, data, err := stream.next()
+		if err != nil {
+			return
+		}
+		var change events.NodeStateChanged
+		if name != "state-change" || json.Unmarshal(data, &change) != nil {
+			continue
+		}
+		select {
+		case changes <- change:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (b *apiBackend) GetRun(ctx context.Context, runID uuid.UUID) (*storage.GraphRunModel, []storage.NodeExecutionRecord, error) {
+	var response api.GraphRunResponse
+	if err := b.do(ctx, http.MethodGet, "/runs/"+runID.String(), nil, &response); err != nil {
+		return nil, nil, err
+	}
+	return response.Run, response.Nodes, nil
+}
+
+func (b *apiBackend) RunExecutions(ctx context.Context, runID uuid.UUID) (map[string]*execution.NodeExecution, error) {
+	var response api.GraphRunResponse
+	if err := b.do(ctx, http.MethodGet, "/runs/"+runID.String(), nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Executions, nil
+}
+
+func (b *apiBackend) NodeHistory(ctx context.Context, appName, nodeID string) ([]storage.NodeStateChangeModel, error) {
+	var response struct {
+		Changes []storage.NodeStateChangeModel `json:"changes"`
+	}
+	path := "/apps/" + url.PathEscape(appName) + "/nodes/" + url.PathEscape(nodeID) + "/history"
+	if err := b.do(ctx, http.MethodGet, path, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Changes, nil
+}
+
+func (b *apiBackend) CancelRun(ctx context.Context, runID uuid.UUID, reason string) error {
+	request := api.CancelGraphRunRequest{Reason: reason}
+	err := b.do(ctx, http.MethodPost, "/runs/"+runID.String()+"/cancel", request, nil)
+	var conflict *apiError
+	if errors.As(err, &conflict) && conflict.status == http.StatusConflict {
+		conflict.err = storage.ErrRunNotCancellable
+	}
+	return err
+}
+
+func (b *apiBackend) PruneRuns(ctx context.Context, appName string, olderThan time.Duration, keepLast int) (int64, error) {
+	query := url.Values{}
+	query.Set("older_than", olderThan.String())
+	query.Set("keep_last", strconv.Itoa(keepLast))
+	var response struct {
+		Pruned int64 `json:"pruned"`
+	}
+	if err := b.do(ctx, http.MethodDelete, "/apps/"+url.PathEscape(appName)+"/runs?"+query.Encode(), nil, &response); err != nil {
+		return 0, err
+	}
+	return response.Pruned, nil
+}
+
+func (b *apiBackend) SetNodeState(ctx context.Context, appName, nodeID string, state graph.NodeState) ([]events.NodeStateChanged, error) {
+	var response api.NodeStateResponse
+	path := "/apps/" + url.PathEscape(appName) + "/nodes/" + url.PathEscape(nodeID) + "/state"
+	if err := b.do(ctx, http.MethodPatch, path, api.NodeStateRequest{State: state}, &response); err != nil {
+		return nil, err
+	}
+	return response.Changes, nil
+}
+
+func (b *apiBackend) Close() error {
+	return nil
+}
+
+// eventReader reads the Server-Sent Events of an event stream
+type eventReader struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+}
+
+func newEventReader(body io.ReadCloser) *eventReader {
+	return &eventReader{body: body, scanner: bufio.NewScanner(body)}
+}
+
+func (r *eventReader) close() {
+	r.body.Close()
+}
+
+// next returns the name and data of the next event, skipping comments
+func (r *eventReader) next() (string, []byte, error) {
+	var name string
+	var data []byte
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		switch {
+		case line == "":
+			if name != "" || data != nil {
+				return name, data, nil
+			}
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimSpace(strings.TrimPrefix(line, "data:"))...)
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return "", nil, err
+	}
+	return "", nil, io.EOF
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/execution"
+	"github.com/philipsahli/innominatus-graph/pkg/export"
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/spf13/cobra"
+)
+
+// completionTimeout limits the lookups of completions in the database or
+// API, so that a slow server does not hang the shell
+const completionTimeout = 5 * time.Second
+
+var (
+	nodeTypeNames  = []string{string(graph.NodeTypeSpec), string(graph.NodeTypeWorkflow), string(graph.NodeTypeStep), string(graph.NodeTypeResource)}
+	nodeStateNames = []string{string(graph.NodeStateWaiting), string(graph.NodeStatePending), string(graph.NodeStateRunning), string(graph.NodeStateFailed), string(graph.NodeStateSucceeded)}
+)
+
+// flagCompletions complete the values of the flags with these names, on
+// every command that has one
+var flagCompletions = map[string]cobra.CompletionFunc{
+	"app":     completeApps,
+	"types":   completeList(nodeTypeNames),
+	"states":  completeList(nodeStateNames),
+	"status":  completeList([]string{storage.RunStatusQueued, string(execution.StatusRunning), string(execution.StatusCompleted), string(execution.StatusFailed)}),
+	"format":  cobra.FixedCompletions(formatNames(), cobra.ShellCompDirectiveNoFileComp),
+	"theme":   cobra.FixedCompletions(export.ThemeNames(), cobra.ShellCompDirectiveNoFileComp),
+	"shape":   cobra.FixedCompletions([]string{string(shapeChain), string(shapeFanout), string(shapeDiamond)}, cobra.ShellCompDirectiveNoFileComp),
+	"db-type": cobra.FixedCompletions([]string{"postgres", "mysql", "sqlite"}, cobra.ShellCompDirectiveNoFileComp),
+}
+
+// registerCompletions registers flagCompletions for cmd and its
+// subcommands. It runs once all commands have their flags.
+func registerCompletions(cmd *cobra.Command) {
+	for name, complete := range flagCompletions {
+		if cmd.LocalFlags().Lookup(name) != nil {
+			cmd.RegisterFlagCompletionFunc(name, complete)
+		}
+	}
+	for _, child := range cmd.Commands() {
+		registerCompletions(child)
+	}
+}
+
+func formatNames() []string {
+	names := make([]string, len(export.Formats))
+	for i, format := range export.Formats {
+		names[i] = string(format)
+	}
+	return names
+}
+
+// completeList completes comma separated lists of values, as taken by
+// string slice flags
+func completeList(values []string) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		done, last := "", toComplete
+		if i := strings.LastIndex(toComplete, ","); i >= 0 {
+			done, last = toComplete[:i+1], toComplete[i+1:]
+		}
+		var completions []string
+		for _, value := range values {
+			if strings.HasPrefix(value, last) && !strings.Contains(","+done, ","+value+",") {
+				completions = append(completions, done+value)
+			}
+		}
+		return completions, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+	}
+}
+
+// completeApps completes the names of the apps in the database or API of
+// the settings
+func completeApps(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	b, err := openBackend()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+	apps, err := b.ListApps(ctx, toComplete)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	var completions []string
+	for _, app := range apps {
+		if strings.HasPrefix(app.Name, toComplete) {
+			completions = append(completions, cobra.CompletionWithDesc(app.Name, app.Description))
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeNodeIDs completes the IDs of the nodes of the app given with
+// --app
+func completeNodeIDs(toComplete string) ([]string, cobra.ShellCompDirective) {
+	if appName == "" {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	b, err := openBackend()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+	g, err := b.LoadGraph(ctx, appName)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	var completions []string
+	for id, node := range g.Nodes {
+		if strings.HasPrefix(id, toComplete) {
+			completions = append(completions, cobra.CompletionWithDesc(id, string(node.Type)))
+		}
+	}
+	sort.Strings(completions)
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
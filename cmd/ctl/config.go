@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// envPrefix prefixes the environment variables overriding config keys, as
+// for the server
+const envPrefix = "IDP"
+
+var configFile string
+
+// ctlConfig is read from the config file, the environment and the flags,
+// each overriding the one before
+type ctlConfig struct {
+	API struct {
+		URL   string `mapstructure:"url"` // Use the HTTP API of this server instead of the database
+		Key   string `mapstructure:"key"`
+		Token string `mapstructure:"token"`
+	} `mapstructure:"api"`
+	Tenant   string `mapstructure:"tenant"`
+	Database struct {
+		Type     string `mapstructure:"type"`
+		Host     string `mapstructure:"host"`
+		Port     int    `mapstructure:"port"`
+		User     string `mapstructure:"user"`
+		Password string `mapstructure:"password"`
+		Name     string `mapstructure:"name"`
+		SSLMode  string `mapstructure:"ssl_mode"`
+	} `mapstructure:"database"`
+}
+
+// flagKeys maps the global flags to the config keys they override
+var flagKeys = map[string]string{
+	"server":      "api.url",
+	"api-key":     "api.key",
+	"token":       "api.token",
+	"tenant":      "tenant",
+	"db-type":     "database.type",
+	"db-host":     "database.host",
+	"db-port":     "database.port",
+	"db-user":     "database.user",
+	"db-password": "database.password",
+	"db-name":     "database.name",
+	"db-ssl-mode": "database.ssl_mode",
+}
+
+// bindFlags lets the global flags of cmd override the config keys
+func bindFlags(cmd *cobra.Command) {
+	for flag, key := range flagKeys {
+		if err := viper.BindPFlag(key, cmd.PersistentFlags().Lookup(flag)); err != nil {
+			panic(err)
+		}
+	}
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+}
+
+// loadConfig reads the settings of the commands
+func loadConfig() (*ctlConfig, error) {
+	if configFile != "" {
+		viper.SetConfigFile(configFile)
+		if err := viper.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+	}
+	config := &ctlConfig{}
+	if err := viper.Unmarshal(config); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if config.Tenant != "" {
+		if _, err := uuid.Parse(config.Tenant); err != nil {
+			return nil, fmt.Errorf("invalid tenant ID %q: %w", config.Tenant, err)
+		}
+	}
+	return config, nil
+}
+
+// storageConfig returns the database settings of config for
+// storage.NewConnection
+func (config *ctlConfig) storageConfig() storage.Config {
+	database := config.Database
+	return storage.Config{
+		Type:     storage.DatabaseType(database.Type),
+		Host:     database.Host,
+		Port:     database.Port,
+		User:     database.User,
+		Password: database.Password,
+		DBName:   database.Name,
+		SSLMode:  database.SSLMode,
+	}
+}
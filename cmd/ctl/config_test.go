@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testTenant = "3f1c9a52-7d4e-4b8a-9c61-2e5f8d0a7b14"
+
+func TestLoadConfig(t *testing.T) {
+	fileConfig := `
+tenant: ` + testTenant + `
+database:
+  type: mysql
+  host: db.internal
+  port: 3307
+  user: graph
+  name: from_file
+`
+	tests := []struct {
+		name    string
+		file    string // Config file contents, none if empty
+		env     map[string]string
+		args    []string
+		check   func(t *testing.T, config *ctlConfig)
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, config *ctlConfig) {
+				assert.Equal(t, "postgres", config.Database.Type)
+				assert.Equal(t, "localhost", config.Database.Host)
+				assert.Equal(t, "idp_orchestrator", config.Database.Name)
+				assert.Empty(t, config.Tenant)
+				assert.Empty(t, config.API.URL)
+				assert.Equal(t, 5432, config.storageConfig().ServerPort())
+			},
+		},
+		{
+			name: "config file",
+			file: fileConfig,
+			check: func(t *testing.T, config *ctlConfig) {
+				assert.Equal(t, "mysql", config.Database.Type)
+				assert.Equal(t, "db.internal", config.Database.Host)
+				assert.Equal(t, 3307, config.Database.Port)
+				assert.Equal(t, "from_file", config.Database.Name)
+				assert.Equal(t, testTenant, config.Tenant)
+			},
+		},
+		{
+			name: "environment overrides the config file",
+			file: fileConfig,
+			env:  map[string]string{"IDP_DATABASE_NAME": "from_env", "IDP_DATABASE_PORT": "3308"},
+			check: func(t *testing.T, config *ctlConfig) {
+				assert.Equal(t, "from_env", config.Database.Name)
+				assert.Equal(t, 3308, config.Database.Port)
+				assert.Equal(t, "db.internal", config.Database.Host)
+			},
+		},
+		{
+			name: "flags override the environment",
+			file: fileConfig,
+			env:  map[string]string{"IDP_DATABASE_NAME": "from_env"},
+			args: []string{"--db-name", "from_flag", "--db-port", "3309"},
+			check: func(t *testing.T, config *ctlConfig) {
+				assert.Equal(t, "from_flag", config.Database.Name)
+				assert.Equal(t, 3309, config.Database.Port)
+			},
+		},
+		{
+			name: "unset flags keep the environment",
+			env:  map[string]string{"IDP_DATABASE_HOST": "env.internal", "IDP_API_URL": "http://env:8080"},
+			args: []string{"--db-name", "from_flag"},
+			check: func(t *testing.T, config *ctlConfig) {
+				assert.Equal(t, "env.internal", config.Database.Host)
+				assert.Equal(t, "http://env:8080", config.API.URL)
+			},
+		},
+		{
+			name: "mysql without a port uses the mysql port",
+			args: []string{"--db-type", "mysql"},
+			check: func(t *testing.T, config *ctlConfig) {
+				assert.Equal(t, 0, config.Database.Port)
+				assert.Equal(t, 3306, config.storageConfig().ServerPort())
+				assert.Equal(t, "mysql database idp_orchestrator on postgres@localhost:3306", describeDatabase(config))
+			},
+		},
+		{
+			name: "explicit port 0 keeps the default",
+			args: []string{"--db-type", "postgres", "--db-port", "0"},
+			check: func(t *testing.T, config *ctlConfig) {
+				assert.Equal(t, 5432, config.storageConfig().ServerPort())
+			},
+		},
+		{
+			name: "empty flag overrides the config file",
+			file: fileConfig,
+			args: []string{"--tenant", ""},
+			check: func(t *testing.T, config *ctlConfig) {
+				assert.Empty(t, config.Tenant)
+			},
+		},
+		{
+			name:    "invalid tenant",
+			env:     map[string]string{"IDP_TENANT": "acme"},
+			wantErr: `invalid tenant ID "acme"`,
+		},
+		{
+			name:    "missing config file",
+			file:    "-",
+			wantErr: "failed to read config file",
+		},
+		{
+			name:    "invalid config file",
+			file:    "database: [",
+			wantErr: "failed to read config file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags(rootCmd)
+			viper.Reset()
+			bindFlags(rootCmd)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			configFile = ""
+			defer func() { configFile = "" }()
+			if tt.file != "" {
+				configFile = filepath.Join(t.TempDir(), "ctl.yaml")
+				if tt.file != "-" {
+					require.NoError(t, os.WriteFile(configFile, []byte(tt.file), 0o600))
+				}
+			}
+			require.NoError(t, rootCmd.PersistentFlags().Parse(tt.args))
+
+			config, err := loadConfig()
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			tt.check(t, config)
+		})
+	}
+}
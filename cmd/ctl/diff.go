@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/philipsahli/innominatus-graph/pkg/export"
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show the differences between two graphs",
+	Long: `Show the nodes and edges added, removed and changed from one graph to
+another: from the stored graph of --app to a graph file, or from the first
+graph file to the second.
+
+Graph files use the JSON export format, as JSON or YAML, or are app
+snapshots as written by DumpApp or "graph dump", so that earlier versions of an
+app can be compared with snapshots taken before they changed.
+
+With --image the diff is also drawn to a DOT, SVG, PNG or PDF file, chosen
+by its extension: added nodes and edges in green, removed ones dashed in
+red and changed ones in orange.`,
+	Example: `  ctl diff --app myapp -f new-graph.yaml
+  ctl diff -f old.json -f new.json
+  ctl diff -f myapp-monday.json -f myapp-friday.json --image changes.svg
+  ctl diff --app myapp -f new-graph.yaml --exit-code`,
+	RunE: runDiff,
+}
+
+var (
+	diffImage    string
+	diffExitCode bool
+)
+
+func init() {
+	diffCmd.Flags().StringVar(&appName, "app", "", "application whose stored graph to compare with the graph file")
+	diffCmd.Flags().StringArrayVarP(&graphFiles, "file", "f", nil, "graph file or app snapshot, - for stdin (once with --app, else twice)")
+	diffCmd.Flags().StringVar(&diffImage, "image", "", "also draw the diff to this file: .dot, .svg, .png or .pdf")
+	diffCmd.Flags().BoolVar(&diffExitCode, "exit-code", false, "exit with 1 if the graphs differ")
+	addOutputFlag(diffCmd)
+	diffCmd.MarkFlagRequired("file")
+}
+
+// diffSource is a graph compared by diff
+type diffSource struct {
+	name  string
+	graph *graph.Graph
+}
+
+// diffOutput is the JSON and YAML output of diff
+type diffOutput struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	*graph.GraphDiff
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+	switch {
+	case appName != "" && len(graphFiles) != 1:
+		return fmt.Errorf("give one graph file to compare with app %s", appName)
+	case appName == "" && len(graphFiles) != 2:
+		return fmt.Errorf("give two graph files, or --app and one graph file")
+	}
+	var imageFormat export.Format
+	if diffImage != "" {
+		imageFormat, err = diffImageFormat(diffImage)
+		if err != nil {
+			return err
+		}
+	}
+
+	var sources []diffSource
+	if appName != "" {
+		b, err := openBackend()
+		if err != nil {
+			return err
+		}
+		defer b.Close()
+		g, err := b.LoadGraph(cmd.Context(), appName)
+		if err != nil {
+			return fmt.Errorf("failed to load graph for app %s: %w", appName, err)
+		}
+		sources = append(sources, diffSource{name: fmt.Sprintf("app %s (version %d)", appName, g.Version), graph: g})
+	}
+	for _, path := range graphFiles {
+		if path == "-" && len(graphFiles) == 2 && graphFiles[0] == graphFiles[1] {
+			return fmt.Errorf("stdin can only be read once")
+		}
+		g, err := readGraphFile(path, appName)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		name := path
+		if path == "-" {
+			name = "stdin"
+		}
+		sources = append(sources, diffSource{name: name, graph: g})
+	}
+
+	from, to := sources[0], sources[1]
+	diff := graph.Diff(from.graph, to.graph)
+	if structured {
+		if err := printStructured(diffOutput{From: from.name, To: to.name, GraphDiff: diff}); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("--- %s\n+++ %s\n", from.name, to.name)
+		printDiff(diff, useColor(os.Stdout))
+		fmt.Println(diffSummary(diff))
+	}
+
+	if diffImage != "" {
+		if err := writeDiffImage(diffImage, imageFormat, from.graph, to.graph, diff); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Diff drawn to %s\n", diffImage)
+	}
+	if diffExitCode && !diff.Empty() {
+		return &exitError{code: 1}
+	}
+	return nil
+}
+
+// diffImageFormat picks the format of the diff image by the extension of
+// path
+func diffImageFormat(path string) (export.Format, error) {
+	format, err := export.ParseFormat(strings.TrimPrefix(filepath.Ext(path), "."))
+	if err == nil {
+		switch format {
+		case export.FormatDOT, export.FormatSVG, export.FormatPNG, export.FormatPDF:
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("cannot draw diffs to %s: use a .dot, .svg, .png or .pdf file", path)
+}
+
+func writeDiffImage(path string, format export.Format, from, to *graph.Graph, diff *graph.GraphDiff) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create image file: %w", err)
+	}
+	defer file.Close()
+
+	exporter := export.NewExporter()
+	defer exporter.Close()
+	if err := exporter.ExportDiffTo(file, from, to, diff, format); err != nil {
+		return fmt.Errorf("failed to draw diff: %w", err)
+	}
+	return file.Close()
+}
+
+// diffSummary counts the changes of diff, e.g. "2 nodes added, 1 edge
+// removed"
+func diffSummary(diff *graph.GraphDiff) string {
+	if diff.Empty() {
+		return "No changes"
+	}
+	var parts []string
+	count := func(n int, item, change string) {
+		if n == 1 {
+			parts = append(parts, fmt.Sprintf("1 %s %s", item, change))
+		} else if n > 1 {
+			parts = append(parts, fmt.Sprintf("%d %ss %s", n, item, change))
+		}
+	}
+	count(len(diff.AddedNodes), "node", "added")
+	count(len(diff.RemovedNodes), "node", "removed")
+	count(len(diff.ChangedNodes), "node", "changed")
+	count(len(diff.AddedEdges), "edge", "added")
+	count(len(diff.RemovedEdges), "edge", "removed")
+	count(len(diff.ChangedEdges), "edge", "changed")
+	return strings.Join(parts, ", ")
+}
+
+// ANSI colors of the lines of printDiff
+const (
+	colorAdded   = "\033[32m"
+	colorRemoved = "\033[31m"
+	colorChanged = "\033[33m"
+	colorReset   = "\033[0m"
+)
+
+// printDiff lists the changes of diff, one line per node or edge and field,
+// colored for terminals if color is set
+func printDiff(diff *graph.GraphDiff, color bool) {
+	line := func(code, format string, args ...interface{}) {
+		text := fmt.Sprintf(format, args...)
+		if color {
+			text = code + text + colorReset
+		}
+		fmt.Println(text)
+	}
+	for _, node := range diff.AddedNodes {
+		line(colorAdded, "+ node %s (%s)", node.ID, node.Type)
+	}
+	for _, node := range diff.RemovedNodes {
+		line(colorRemoved, "- node %s (%s)", node.ID, node.Type)
+	}
+	for _, change := range diff.ChangedNodes {
+		for _, field := range change.Changes {
+			line(colorChanged, "~ node %s", fieldChange(change.ID, field))
+		}
+	}
+	for _, edge := range diff.AddedEdges {
+		line(colorAdded, "+ edge %s (%s %s %s)", edge.ID, edge.FromNodeID, edge.Type, edge.ToNodeID)
+	}
+	for _, edge := range diff.RemovedEdges {
+		line(colorRemoved, "- edge %s (%s %s %s)", edge.ID, edge.FromNodeID, edge.Type, edge.ToNodeID)
+	}
+	for _, change := range diff.ChangedEdges {
+		for _, field := range change.Changes {
+			line(colorChanged, "~ edge %s", fieldChange(change.ID, field))
+		}
+	}
+}
+
+func fieldChange(id string, change graph.FieldChange) string {
+	return fmt.Sprintf("%s %s: %s -> %s", id, change.Field, formatValue(change.Old), formatValue(change.New))
+}
+
+// formatValue formats a field value of a diff, showing missing properties
+// as <none>
+func formatValue(value interface{}) string {
+	if value == nil {
+		return "<none>"
+	}
+	return fmt.Sprintf("%q", fmt.Sprint(value))
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/export"
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the settings, database, server and Graphviz",
+	Long: `Check that the settings can be read, that the database or server they
+point to is reachable, that the database schema is up to date, that the
+database user or API credentials have the permissions the commands need,
+and that Graphviz can render graphs. Every failed check comes with a hint
+on how to fix it.
+
+Exits with 1 if a check failed; warnings do not change the exit code.`,
+	Example: `  ctl doctor --db-type sqlite --db-name graph.db
+  ctl doctor --server https://graph.example.com --api-key $KEY`,
+	RunE: runDoctor,
+}
+
+// doctorProbe makes doctor render a graph with Graphviz instead of checking.
+// Doctor runs itself with it so that Graphviz crashing does not end the
+// checks.
+var doctorProbe bool
+
+// doctorTimeout limits each check that connects somewhere
+const doctorTimeout = 10 * time.Second
+
+func init() {
+	doctorCmd.Flags().BoolVar(&doctorProbe, "probe-graphviz", false, "render a graph with Graphviz and exit")
+	doctorCmd.Flags().MarkHidden("probe-graphviz")
+	addOutputFlag(doctorCmd)
+}
+
+// checkStatus is the outcome of a check of doctor
+type checkStatus string
+
+const (
+	checkOK   checkStatus = "ok"
+	checkWarn checkStatus = "warn"
+	checkFail checkStatus = "fail"
+)
+
+// checkResult is what a check of doctor found, with a hint on how to fix
+// it unless it passed
+type checkResult struct {
+	Name   string      `json:"name"`
+	Status checkStatus `json:"status"`
+	Detail string      `json:"detail"`
+	Hint   string      `json:"hint,omitempty"`
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	if doctorProbe {
+		return probeGraphviz()
+	}
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+
+	var results []checkResult
+	config, err := loadConfig()
+	if err != nil {
+		results = append(results, checkResult{
+			Name:   "config",
+			Status: checkFail,
+			Detail: err.Error(),
+			Hint:   "fix the file given with --config, the IDP_* environment variables or the flags",
+		})
+	} else if config.API.URL != "" {
+		results = append(results, checkResult{Name: "config", Status: checkOK, Detail: "using the API of " + config.API.URL})
+		server := checkServer(cmd.Context(), config)
+		results = append(results, server)
+		if server.Status != checkFail {
+			results = append(results, checkAPIAccess(cmd.Context(), config))
+		}
+	} else {
+		results = append(results, checkResult{Name: "config", Status: checkOK, Detail: "using the " + describeDatabase(config)})
+		results = append(results, checkDatabase(cmd.Context(), config)...)
+	}
+	results = append(results, checkGraphviz(cmd.Context()))
+
+	if structured {
+		if err := printStructured(results); err != nil {
+			return err
+		}
+	} else {
+		printChecks(results, useColor(os.Stdout))
+	}
+	for _, result := range results {
+		if result.Status == checkFail {
+			return &exitError{code: 1}
+		}
+	}
+	return nil
+}
+
+func printChecks(results []checkResult, color bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, result := range results {
+		status := string(result.Status)
+		if color {
+			status = checkColor(result.Status) + status + colorReset
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", status, result.Name, result.Detail)
+		if result.Hint != "" && result.Status != checkOK {
+			fmt.Fprintf(w, "\t\thint: %s\n", result.Hint)
+		}
+	}
+	w.Flush()
+}
+
+func checkColor(status checkStatus) string {
+	switch status {
+	case checkOK:
+		return colorAdded
+	case checkWarn:
+		return colorChanged
+	}
+	return colorRemoved
+}
+
+// describeDatabase names the database of config, without its password
+func describeDatabase(config *ctlConfig) string {
+	database := config.Database
+	if storage.DatabaseType(database.Type) == storage.DatabaseTypeSQLite {
+		return "sqlite database " + database.Name
+	}
+	return fmt.Sprintf("%s database %s on %s@%s:%d", database.Type, database.Name, database.User, database.Host, config.storageConfig().ServerPort())
+}
+
+// checkDatabase connects to the database of config and checks its schema,
+// the permissions of its user and the tenant of config
+func checkDatabase(ctx context.Context, config *ctlConfig) []checkResult {
+	database := config.Database
+	result := checkResult{Name: "database", Status: checkFail}
+	dbType := storage.DatabaseType(database.Type)
+	switch dbType {
+	case storage.DatabaseTypePostgres, storage.DatabaseTypeMySQL:
+		result.Hint = fmt.Sprintf("check that the %s server runs on --db-host and --db-port and accepts --db-user and --db-password", dbType)
+	case storage.DatabaseTypeSQLite:
+		result.Hint = "pass the path of the database file with --db-name; ctl initdb creates new databases"
+		if _, err := os.Stat(database.Name); err != nil {
+			result.Detail = err.Error()
+			if errors.Is(err, fs.ErrNotExist) {
+				result.Detail = database.Name + " does not exist"
+			}
+			return []checkResult{result}
+		}
+	default:
+		result.Detail = fmt.Sprintf("unknown database type %q", database.Type)
+		result.Hint = "set --db-type to postgres, mysql or sqlite"
+		return []checkResult{result}
+	}
+
+	db, err := storage.NewConnection(config.storageConfig())
+	if err != nil {
+		result.Detail = err.Error()
+		return []checkResult{result}
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+	health := storage.HealthCheck(ctx, db)
+	if !health.Healthy {
+		result.Detail = health.Error
+		return []checkResult{result}
+	}
+	result.Status = checkOK
+	result.Detail = fmt.Sprintf("connected in %s", health.Latency.Round(time.Microsecond))
+	results := []checkResult{result}
+
+	schema := checkSchema(db)
+	results = append(results, schema)
+	if schema.Status != checkOK {
+		return results
+	}
+	results = append(results, checkDatabasePermissions(db, config))
+	if config.Tenant != "" {
+		results = append(results, checkTenant(db, config.Tenant))
+	}
+	return results
+}
+
+func checkSchema(db *gorm.DB) checkResult {
+	result := checkResult{Name: "schema", Status: checkFail}
+	problems, err := storage.SchemaProblems(db)
+	switch {
+	case err != nil:
+		result.Detail = err.Error()
+	case len(problems) > 3:
+		result.Detail = fmt.Sprintf("%s and %d more problems", strings.Join(problems[:3], ", "), len(problems)-3)
+	case len(problems) > 0:
+		result.Detail = strings.Join(problems, ", ")
+	default:
+		return checkSchemaVersion(db)
+	}
+	result.Hint = "run ctl initdb, or start the server once, with these database settings to migrate the database"
+	return result
+}
+
+// checkSchemaVersion compares the migrations recorded in the database with
+// those of ctl
+func checkSchemaVersion(db *gorm.DB) checkResult {
+	result := checkResult{Name: "schema", Status: checkFail}
+	version, err := storage.SchemaVersion(db)
+	latest := storage.LatestSchemaVersion()
+	switch {
+	case err != nil:
+		result.Detail = err.Error()
+	case version < latest:
+		result.Detail = fmt.Sprintf("at version %d, ctl migrates to %d", version, latest)
+		result.Hint = "run ctl initdb, or start the server once, with these database settings to apply the missing migrations"
+	case version > latest:
+		result.Status = checkWarn
+		result.Detail = fmt.Sprintf("at version %d, newer than the %d of ctl", version, latest)
+		result.Hint = "update ctl to the version of the server"
+	default:
+		result.Status = checkOK
+		result.Detail = fmt.Sprintf("up to date at version %d", version)
+	}
+	return result
+}
+
+// checkDatabasePermissions checks that the database user may change the
+// tables, with an update of no rows that is rolled back. SQLite files are
+// checked to be writable, as are their directories for the journal.
+func checkDatabasePermissions(db *gorm.DB, config *ctlConfig) checkResult {
+	result := checkResult{Name: "permissions", Status: checkFail}
+	if storage.DatabaseType(config.Database.Type) == storage.DatabaseTypeSQLite {
+		result.Hint = fmt.Sprintf("make %s and its directory writable for this user", config.Database.Name)
+		file, err := os.OpenFile(config.Database.Name, os.O_WRONLY, 0)
+		if err != nil {
+			result.Detail = err.Error()
+			return result
+		}
+		file.Close()
+		journal, err := os.CreateTemp(filepath.Dir(config.Database.Name), ".doctor-*")
+		if err != nil {
+			result.Detail = err.Error()
+			return result
+		}
+		journal.Close()
+		os.Remove(journal.Name())
+	} else {
+		result.Hint = fmt.Sprintf("grant %s SELECT, INSERT, UPDATE and DELETE on the tables of database %s", config.Database.User, config.Database.Name)
+	}
+
+	tx := db.Begin()
+	err := tx.Exec(fmt.Sprintf("UPDATE %s SET updated_at = updated_at WHERE 1 = 0", storage.App{}.TableName())).Error
+	tx.Rollback()
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	result.Status = checkOK
+	result.Detail = "tables can be changed"
+	return result
+}
+
+func checkTenant(db *gorm.DB, tenantID string) checkResult {
+	var tenant storage.TenantModel
+	err := db.Where("id = ?", tenantID).Take(&tenant).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return checkResult{Name: "tenant", Status: checkFail, Detail: "tenant " + tenantID + " does not exist", Hint: "check --tenant or IDP_TENANT"}
+	case err != nil:
+		return checkResult{Name: "tenant", Status: checkFail, Detail: err.Error()}
+	}
+	return checkResult{Name: "tenant", Status: checkOK, Detail: fmt.Sprintf("%s (%s)", tenant.Name, tenantID)}
+}
+
+// checkServer checks the health endpoint of the server of config, which
+// also reports on the server's database
+func checkServer(ctx context.Context, config *ctlConfig) checkResult {
+	result := checkResult{Name: "server", Status: checkFail}
+	baseURL := strings.TrimSuffix(config.API.URL, "/")
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/health", nil)
+	if err != nil {
+		result.Detail = err.Error()
+		result.Hint = "set --server to the URL of the server, e.g. http://localhost:8080"
+		return result
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		result.Detail = err.Error()
+		result.Hint = "check --server and that the server is running and reachable from here"
+		return result
+	}
+	defer resp.Body.Close()
+
+	var health struct {
+		Status   string               `json:"status"`
+		Version  string               `json:"version"`
+		Database storage.HealthStatus `json:"database"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&health); err != nil || health.Status == "" {
+		result.Detail = fmt.Sprintf("%s/health answered %s without a health report", baseURL, resp.Status)
+		result.Hint = "set --server to the base URL of the server, without /api/v1"
+		return result
+	}
+	if health.Status != "healthy" {
+		result.Detail = fmt.Sprintf("%s is %s: database: %s", baseURL, health.Status, health.Database.Error)
+		result.Hint = "run ctl doctor with the database settings of the server to check its database"
+		return result
+	}
+	result.Status = checkOK
+	result.Detail = fmt.Sprintf("%s is healthy, version %s, database answered in %s", baseURL, health.Version, health.Database.Latency.Round(time.Microsecond))
+	return result
+}
+
+// checkAPIAccess lists the apps through the API with the credentials and
+// tenant of config
+func checkAPIAccess(ctx context.Context, config *ctlConfig) checkResult {
+	result := checkResult{Name: "access", Status: checkFail}
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+	apps, err := newAPIBackend(config).ListApps(ctx, "")
+	var apiErr *apiError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.status == http.StatusUnauthorized:
+		result.Detail = err.Error()
+		result.Hint = "pass an API key with --api-key (api.key) or an ID token with --token (api.token)"
+	case errors.As(err, &apiErr) && apiErr.status == http.StatusForbidden:
+		result.Detail = err.Error()
+		result.Hint = "ask an administrator of the server for a role binding on the tenant or its apps"
+	case errors.As(err, &apiErr) && apiErr.status == http.StatusBadRequest && config.Tenant != "":
+		result.Detail = err.Error()
+		result.Hint = "check --tenant or IDP_TENANT"
+	case err != nil:
+		result.Detail = err.Error()
+	case len(apps) == 0:
+		result.Status = checkWarn
+		result.Detail = "no apps visible"
+		result.Hint = "apps you have no role on are not listed; ask an administrator of the server for a role binding if you expected some"
+	default:
+		result.Status = checkOK
+		result.Detail = fmt.Sprintf("%d apps visible", len(apps))
+	}
+	return result
+}
+
+// checkGraphviz runs doctor with --probe-graphviz, as Graphviz may crash
+// rather than fail where the WebAssembly it runs as cannot be compiled
+func checkGraphviz(ctx context.Context) checkResult {
+	result := checkResult{
+		Name:   "graphviz",
+		Status: checkFail,
+		Hint:   "export with --format svg-native, mermaid or dot, which do not need Graphviz",
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	probe := exec.CommandContext(ctx, executable, "doctor", "--probe-graphviz")
+	var stderr bytes.Buffer
+	probe.Stderr = &stderr
+	err = probe.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		result.Status = checkOK
+		result.Detail = "renders SVG"
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		result.Detail = strings.TrimPrefix(firstLine(stderr.String()), "Error: ")
+	default:
+		result.Detail = "crashed rendering a test graph"
+		if line := firstLine(stderr.String()); line != "" {
+			result.Detail += ": " + line
+		}
+	}
+	return result
+}
+
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	return line
+}
+
+// probeGraphviz renders a small graph to SVG with Graphviz
+func probeGraphviz() error {
+	g := graph.NewGraph("doctor")
+	g.AddNode(&graph.Node{ID: "workflow", Type: graph.NodeTypeWorkflow, Name: "workflow"})
+	g.AddNode(&graph.Node{ID: "resource", Type: graph.NodeTypeResource, Name: "resource"})
+	g.AddEdge(&graph.Edge{ID: "provisions", FromNodeID: "workflow", ToNodeID: "resource", Type: graph.EdgeTypeProvisions})
+
+	exporter := export.NewExporter()
+	defer exporter.Close()
+	return exporter.ExportGraphTo(io.Discard, g, export.FormatSVG, export.Options{})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestCheckDatabase(t *testing.T) {
+	latest := storage.LatestSchemaVersion()
+	migrated := func(t *testing.T, path string) *gorm.DB {
+		db, err := storage.NewSQLiteConnection(path)
+		require.NoError(t, err)
+		require.NoError(t, storage.AutoMigrate(db))
+		return db
+	}
+
+	tests := []struct {
+		name   string
+		setup  func(t *testing.T, path string) // Prepares the database file
+		dbType string
+		tenant string
+		want   []checkResult // Name, Status and Detail of the results
+	}{
+		{
+			name: "missing file",
+			want: []checkResult{{Name: "database", Status: checkFail, Detail: "does not exist"}},
+		},
+		{
+			name:   "unknown type",
+			dbType: "oracle",
+			want:   []checkResult{{Name: "database", Status: checkFail, Detail: `unknown database type "oracle"`}},
+		},
+		{
+			name: "not migrated",
+			setup: func(t *testing.T, path string) {
+				require.NoError(t, os.WriteFile(path, nil, 0o600))
+			},
+			want: []checkResult{
+				{Name: "database", Status: checkOK, Detail: "connected in"},
+				{Name: "schema", Status: checkFail, Detail: "table graph_apps is missing"},
+			},
+		},
+		{
+			name: "behind ctl",
+			setup: func(t *testing.T, path string) {
+				db := migrated(t, path)
+				require.NoError(t, db.Where("version = ?", latest).Delete(&storage.SchemaMigrationModel{}).Error)
+			},
+			want: []checkResult{
+				{Name: "database", Status: checkOK},
+				{Name: "schema", Status: checkFail, Detail: "ctl migrates to"},
+			},
+		},
+		{
+			name: "newer than ctl",
+			setup: func(t *testing.T, path string) {
+				db := migrated(t, path)
+				require.NoError(t, db.Create(&storage.SchemaMigrationModel{Version: latest + 1, Name: "future"}).Error)
+			},
+			want: []checkResult{
+				{Name: "database", Status: checkOK},
+				{Name: "schema", Status: checkWarn, Detail: "newer than the"},
+			},
+		},
+		{
+			name:  "up to date",
+			setup: func(t *testing.T, path string) { migrated(t, path) },
+			want: []checkResult{
+				{Name: "database", Status: checkOK},
+				{Name: "schema", Status: checkOK, Detail: "up to date at version"},
+				{Name: "permissions", Status: checkOK, Detail: "tables can be changed"},
+			},
+		},
+		{
+			name:   "default tenant",
+			setup:  func(t *testing.T, path string) { migrated(t, path) },
+			tenant: storage.DefaultTenantID.String(),
+			want: []checkResult{
+				{Name: "database", Status: checkOK},
+				{Name: "schema", Status: checkOK},
+				{Name: "permissions", Status: checkOK},
+				{Name: "tenant", Status: checkOK, Detail: storage.DefaultTenantID.String()},
+			},
+		},
+		{
+			name:   "missing tenant",
+			setup:  func(t *testing.T, path string) { migrated(t, path) },
+			tenant: testTenant,
+			want: []checkResult{
+				{Name: "database", Status: checkOK},
+				{Name: "schema", Status: checkOK},
+				{Name: "permissions", Status: checkOK},
+				{Name: "tenant", Status: checkFail, Detail: "tenant " + testTenant + " does not exist"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "graph.db")
+			if tt.setup != nil {
+				tt.setup(t, path)
+			}
+			config := &ctlConfig{Tenant: tt.tenant}
+			config.Database.Type = "sqlite"
+			if tt.dbType != "" {
+				config.Database.Type = tt.dbType
+			}
+			config.Database.Name = path
+
+			results := checkDatabase(context.Background(), config)
+			require.Len(t, results, len(tt.want), "%+v", results)
+			for i, want := range tt.want {
+				assert.Equal(t, want.Name, results[i].Name)
+				assert.Equal(t, want.Status, results[i].Status, "%s: %s", results[i].Name, results[i].Detail)
+				assert.Contains(t, results[i].Detail, want.Detail)
+				if results[i].Status != checkOK {
+					assert.NotEmpty(t, results[i].Hint, results[i].Name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+
+	"github.com/philipsahli/innominatus-graph/pkg/export"
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/spf13/cobra"
+)
+
+var generateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate a synthetic graph for testing at scale",
+	Long: `Generate a graph of the given number of nodes to benchmark layouts,
+exports and executions at the scale you expect, and write it as JSON or
+save it as the graph of an app.
+
+The graph is made of services: a workflow containing a chain of steps and
+provisioning a resource that the last step configures. The workflows of
+the services depend on a spec node and on each other in one of these
+shapes:
+
+  chain    every service depends on the one before it
+  fanout   every service depends on the first one
+  diamond  services alternate between one and --width services, each
+           depending on all services of the layer before it
+
+Teams and resource types are picked at random from --seed, so the same
+flags generate the same nodes and edges.`,
+	Example: `  ctl generate --nodes 5000 --shape diamond --output big.json
+  ctl generate --nodes 1000 --shape chain --app bench-chain
+  ctl generate --nodes 200 --shape fanout | ctl export -f - --format svg --output fanout.svg`,
+	RunE: runGenerate,
+}
+
+// generateShape is how the services of a generated graph depend on each
+// other
+type generateShape string
+
+const (
+	shapeChain   generateShape = "chain"
+	shapeFanout  generateShape = "fanout"
+	shapeDiamond generateShape = "diamond"
+)
+
+var (
+	generateNodes     int
+	generateShapeName string
+	generateSteps     int
+	generateWidth     int
+	generateSeed      int64
+	generateYes       bool
+)
+
+func init() {
+	generateCmd.Flags().IntVar(&generateNodes, "nodes", 100, "number of nodes to generate")
+	generateCmd.Flags().StringVar(&generateShapeName, "shape", string(shapeDiamond), "how services depend on each other: chain, fanout or diamond")
+	generateCmd.Flags().IntVar(&generateSteps, "steps", 3, "steps per workflow")
+	generateCmd.Flags().IntVar(&generateWidth, "width", 4, "services per diamond layer")
+	generateCmd.Flags().Int64Var(&generateSeed, "seed", 1, "seed of the random teams and resource types")
+	generateCmd.Flags().StringVar(&appName, "app", "", "save the graph as the graph of this application instead of writing it")
+	generateCmd.Flags().StringVar(&outputFile, "output", "", "JSON file to write the graph to (default: stdout)")
+	generateCmd.Flags().BoolVarP(&generateYes, "yes", "y", false, "replace the graph of an existing app without asking for confirmation")
+	generateCmd.MarkFlagsMutuallyExclusive("app", "output")
+}
+
+// graphGenerator builds a synthetic graph of services
+type graphGenerator struct {
+	shape generateShape
+	steps int
+	width int
+	limit int
+	rand  *rand.Rand
+
+	g     *graph.Graph
+	edges int
+}
+
+// Properties of generated nodes, picked at random
+var (
+	generatedTeams     = []string{"payments", "checkout", "search", "identity", "platform", "data"}
+	generatedResources = []string{"postgres", "redis", "s3-bucket", "kafka-topic", "dns-record", "load-balancer"}
+	generatedSteps     = []string{"build", "test", "migrate", "release", "verify"}
+)
+
+func runGenerate(cmd *cobra.Command, args []string) error {
+	shape := generateShape(generateShapeName)
+	switch shape {
+	case shapeChain, shapeFanout, shapeDiamond:
+	default:
+		return fmt.Errorf("unknown shape %q: use chain, fanout or diamond", generateShapeName)
+	}
+	switch {
+	case generateNodes < 1:
+		return fmt.Errorf("--nodes must be at least 1")
+	case generateSteps < 0:
+		return fmt.Errorf("--steps cannot be negative")
+	case generateWidth < 1:
+		return fmt.Errorf("--width must be at least 1")
+	}
+
+	name := appName
+	if name == "" {
+		name = "generated"
+	}
+	generator := &graphGenerator{
+		shape: shape,
+		steps: generateSteps,
+		width: generateWidth,
+		limit: generateNodes,
+		rand:  rand.New(rand.NewSource(generateSeed)),
+	}
+	g, err := generator.generate(name)
+	if err != nil {
+		return fmt.Errorf("failed to generate graph: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Generated %s graph: %d nodes, %d edges\n", shape, len(g.Nodes), len(g.Edges))
+
+	if appName != "" {
+		return saveGenerated(cmd, g)
+	}
+
+	var writer io.Writer = os.Stdout
+	if outputFile != "" {
+		file, err := os.Create(outputFile)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer file.Close()
+		writer = file
+	}
+	exporter := export.NewExporter()
+	defer exporter.Close()
+	if err := exporter.ExportGraphTo(writer, g, export.FormatJSON, export.Options{}); err != nil {
+		return fmt.Errorf("failed to write graph: %w", err)
+	}
+	if outputFile != "" {
+		fmt.Fprintf(os.Stderr, "Graph written to %s\n", outputFile)
+	}
+	return nil
+}
+
+// saveGenerated saves g as the graph of appName, asking before replacing
+// the graph of an existing app
+func saveGenerated(cmd *cobra.Command, g *graph.Graph) error {
+	b, err := openBackend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	current, err := b.LoadGraph(cmd.Context(), appName)
+	switch {
+	case errors.Is(err, storage.ErrAppNotFound):
+	case err != nil:
+		return fmt.Errorf("failed to load graph for app %s: %w", appName, err)
+	case !generateYes:
+		question := fmt.Sprintf("Replace the graph of app %s (%d nodes)?", appName, len(current.Nodes))
+		if !confirm(question) {
+			fmt.Println("Nothing saved")
+			return nil
+		}
+	}
+
+	if err := b.SaveGraph(cmd.Context(), appName, g); err != nil {
+		return fmt.Errorf("failed to save graph for app %s: %w", appName, err)
+	}
+	fmt.Printf("App %s saved: %d nodes, %d edges\n", appName, len(g.Nodes), len(g.Edges))
+	return nil
+}
+
+// generate builds the graph: the spec node, then service after service
+// until the graph has limit nodes. Edges are only added between nodes that
+// made it into the graph.
+func (gen *graphGenerator) generate(appName string) (*graph.Graph, error) {
+	gen.g = graph.NewGraph(appName)
+	if err := gen.addNode("spec", graph.NodeTypeSpec, appName, nil); err != nil {
+		return nil, err
+	}
+	digits := len(fmt.Sprint(gen.limit))
+	for service := 0; !gen.full(); service++ {
+		if err := gen.addService(service, digits); err != nil {
+			return nil, err
+		}
+	}
+	return gen.g, nil
+}
+
+func (gen *graphGenerator) full() bool {
+	return len(gen.g.Nodes) >= gen.limit
+}
+
+// addService adds the workflow, steps and resource of a service, as far as
+// they fit
+func (gen *graphGenerator) addService(service, digits int) error {
+	prefix := fmt.Sprintf("svc-%0*d", digits, service)
+	team := generatedTeams[gen.rand.Intn(len(generatedTeams))]
+	resourceType := generatedResources[gen.rand.Intn(len(generatedResources))]
+
+	workflowID := prefix + "-deploy"
+	if err := gen.addNode(workflowID, graph.NodeTypeWorkflow, "deploy "+prefix, map[string]interface{}{"team": team}); err != nil {
+		return err
+	}
+	for _, dependency := range gen.dependencies(service) {
+		dependencyID := "spec"
+		if dependency >= 0 {
+			dependencyID = fmt.Sprintf("svc-%0*d-deploy", digits, dependency)
+		}
+		if err := gen.addEdge(workflowID, dependencyID, graph.EdgeTypeDependsOn); err != nil {
+			return err
+		}
+	}
+
+	previous := ""
+	for step := 0; step < gen.steps && !gen.full(); step++ {
+		stepName := fmt.Sprintf("step-%d", step+1)
+		if step < len(generatedSteps) {
+			stepName = generatedSteps[step]
+		}
+		stepID := prefix + "-" + stepName
+		if err := gen.addNode(stepID, graph.NodeTypeStep, stepName+" "+prefix, map[string]interface{}{"team": team}); err != nil {
+			return err
+		}
+		if err := gen.addEdge(workflowID, stepID, graph.EdgeTypeContains); err != nil {
+			return err
+		}
+		if previous != "" {
+			if err := gen.addEdge(stepID, previous, graph.EdgeTypeDependsOn); err != nil {
+				return err
+			}
+		}
+		previous = stepID
+	}
+
+	if gen.full() {
+		return nil
+	}
+	resourceID := prefix + "-" + resourceType
+	properties := map[string]interface{}{"team": team, "type": resourceType}
+	if err := gen.addNode(resourceID, graph.NodeTypeResource, resourceType+" "+prefix, properties); err != nil {
+		return err
+	}
+	if err := gen.addEdge(workflowID, resourceID, graph.EdgeTypeProvisions); err != nil {
+		return err
+	}
+	if previous != "" {
+		return gen.addEdge(previous, resourceID, graph.EdgeTypeConfigures)
+	}
+	return nil
+}
+
+// dependencies returns the services the workflow of service depends on, -1
+// standing for the spec node
+func (gen *graphGenerator) dependencies(service int) []int {
+	if service == 0 {
+		return []int{-1}
+	}
+	switch gen.shape {
+	case shapeChain:
+		return []int{service - 1}
+	case shapeFanout:
+		return []int{0}
+	}
+
+	// Diamonds repeat a join service followed by a layer of width
+	// branches: branches depend on the join before them, joins on all
+	// branches before them.
+	position := service % (gen.width + 1)
+	if position > 0 {
+		return []int{service - position}
+	}
+	branches := make([]int, 0, gen.width)
+	for branch := service - gen.width; branch < service; branch++ {
+		branches = append(branches, branch)
+	}
+	return branches
+}
+
+func (gen *graphGenerator) addNode(id string, nodeType graph.NodeType, name string, properties map[string]interface{}) error {
+	return gen.g.AddNode(&graph.Node{
+		ID:         id,
+		Type:       nodeType,
+		Name:       name,
+		Properties: properties,
+	})
+}
+
+func (gen *graphGenerator) addEdge(from, to string, edgeType graph.EdgeType) error {
+	gen.edges++
+	return gen.g.AddEdge(&graph.Edge{
+		ID:         fmt.Sprintf("e%d", gen.edges),
+		FromNodeID: from,
+		ToNodeID:   to,
+		Type:       edgeType,
+	})
+}
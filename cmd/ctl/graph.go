@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/philipsahli/innominatus-graph/pkg/export"
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the graph of an app or a graph file",
+	Long: `Export the graph of an app, or a graph file, to one of the formats of
+pkg/export, e.g. DOT, SVG, PNG, PDF, Mermaid, JSON, GraphML or HTML.
+
+Graph files use the JSON export format, as JSON or YAML, and are validated
+first. Large graphs can be reduced to the neighbourhood of one node with
+--focus, limited to --depth edges in either direction.`,
+	Example: `  ctl export --app myapp --format svg --output myapp.svg
+  ctl export -f graph.yaml --format mermaid
+  cat graph.json | ctl export -f - --format html --output graph.html
+  ctl export --app myapp --format png --focus deploy --depth 2 --output deploy.png`,
+	RunE: runExport,
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate graph files or the graph of an app",
+	Long: `Check graph files, or the stored graph of an app, against the node, edge
+and cycle rules and list every problem. Graph files use the JSON export
+format, as JSON or YAML. The command fails if any graph is invalid, e.g. to
+stop a CI pipeline before the graph is saved.`,
+	Example: `  ctl validate -f graph.yaml
+  ctl validate -f app1.json -f app2.yaml
+  ctl validate --app demo`,
+	RunE: runValidate,
+}
+
+var (
+	appName      string
+	graphFiles   []string
+	format       string
+	outputFile   string
+	nodeIDs      []string
+	withChildren bool
+	exportFilter export.Filter
+	filterTypes  []string
+	filterStates []string
+	themeName    string
+	exportFile   string
+	exportReduce export.Reduce
+)
+
+func init() {
+	exportCmd.Flags().StringVar(&appName, "app", "", "application whose graph to export")
+	exportCmd.Flags().StringVarP(&exportFile, "file", "f", "", "graph file to export instead, - for stdin")
+	exportCmd.Flags().StringVar(&format, "format", "dot", "output format, e.g. dot, svg, png, pdf, mermaid, json, graphml, html")
+	exportCmd.Flags().StringVar(&outputFile, "output", "", "output file path (default: stdout)")
+	exportCmd.Flags().StringSliceVar(&nodeIDs, "nodes", nil, "specific node IDs to include in export")
+	exportCmd.Flags().BoolVar(&withChildren, "with-children", false, "also export the steps of workflows given in --nodes")
+	exportCmd.Flags().BoolVar(&exportFilter.WithDependencies, "with-dependencies", false, "also export everything the --nodes or filtered nodes depend on, contain or provision")
+	exportCmd.Flags().StringSliceVar(&filterTypes, "types", nil, "only export nodes of these types, e.g. resource,workflow")
+	exportCmd.Flags().StringSliceVar(&filterStates, "states", nil, "only export nodes in these states, e.g. failed")
+	exportCmd.Flags().StringVar(&exportFilter.Selector, "selector", "", "only export nodes whose properties match, e.g. team=payments,tier!=test")
+	exportCmd.Flags().StringVar(&themeName, "theme", "", "color theme: light, dark, colorblind (dot, svg, png, pdf, mermaid)")
+	exportCmd.Flags().StringVar(&exportReduce.Focus, "focus", "", "only export the nodes connected to this node")
+	exportCmd.Flags().IntVar(&exportReduce.Depth, "depth", 0, "with --focus, only export nodes within this many edges of it (0: no limit)")
+	exportCmd.MarkFlagsMutuallyExclusive("app", "file")
+	exportCmd.MarkFlagsOneRequired("app", "file")
+
+	validateCmd.Flags().StringVar(&appName, "app", "", "application whose stored graph to validate")
+	validateCmd.Flags().StringArrayVarP(&graphFiles, "file", "f", nil, "graph file to validate, - for stdin (repeatable)")
+	addOutputFlag(validateCmd)
+	validateCmd.MarkFlagsMutuallyExclusive("app", "file")
+	validateCmd.MarkFlagsOneRequired("app", "file")
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	exportFormat, err := export.ParseFormat(format)
+	if err != nil {
+		return err
+	}
+	if exportReduce.Depth != 0 && exportReduce.Focus == "" {
+		return fmt.Errorf("--depth requires --focus")
+	}
+	opts := export.Options{Reduce: exportReduce}
+	if err := opts.Reduce.Validate(); err != nil {
+		return err
+	}
+	if themeName != "" {
+		opts.Theme = &export.Theme{Name: themeName}
+		if _, err := export.ResolveTheme(opts.Theme); err != nil {
+			return err
+		}
+	}
+
+	var g *graph.Graph
+	if exportFile != "" {
+		g, err = readExportFile(exportFile)
+	} else {
+		g, err = loadExportGraph(cmd.Context(), appName)
+	}
+	if err != nil {
+		return err
+	}
+
+	exporter := export.NewExporter()
+	defer exporter.Close()
+
+	if len(nodeIDs) > 0 {
+		g, err = exporter.CreateSubgraphWithOptions(g, nodeIDs, export.SubgraphOptions{
+			WithDependencies: exportFilter.WithDependencies,
+			WithChildren:     withChildren,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create subgraph: %w", err)
+		}
+	}
+	filter := exportFilter
+	for _, t := range filterTypes {
+		filter.Types = append(filter.Types, graph.NodeType(t))
+	}
+	for _, s := range filterStates {
+		filter.States = append(filter.States, graph.NodeState(s))
+	}
+	g, err = filter.Apply(g)
+	if err != nil {
+		return fmt.Errorf("invalid filter: %w", err)
+	}
+
+	var writer io.Writer = os.Stdout
+	if outputFile != "" {
+		file, err := os.Create(outputFile)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer file.Close()
+		writer = file
+	}
+	if err := exporter.ExportGraphTo(writer, g, exportFormat, opts); err != nil {
+		return fmt.Errorf("failed to export graph: %w", err)
+	}
+	if outputFile != "" {
+		fmt.Fprintf(os.Stderr, "Graph exported to %s\n", outputFile)
+	}
+	return nil
+}
+
+// loadExportGraph loads the stored graph of appName
+func loadExportGraph(ctx context.Context, appName string) (*graph.Graph, error) {
+	b, err := openBackend()
+	if err != nil {
+		return nil, err
+	}
+	defer b.Close()
+
+	g, err := b.LoadGraph(ctx, appName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load graph for app %s: %w", appName, err)
+	}
+	return g, nil
+}
+
+// readExportFile reads and validates a graph file, naming the graph after
+// the file
+func readExportFile(path string) (*graph.Graph, error) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if path == "-" {
+		name = "stdin"
+	}
+	g, err := readGraphFile(path, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.Validate(); err != nil {
+		problems := joinedErrors(err)
+		messages := make([]string, len(problems))
+		for i, problem := range problems {
+			messages[i] = problem.Error()
+		}
+		return nil, fmt.Errorf("graph file %s is invalid: %s", path, strings.Join(messages, "; "))
+	}
+	return g, nil
+}
+
+func runValidate(cmd *cobra.Command, args []string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+	if len(graphFiles) > 0 {
+		return validateFiles(graphFiles, structured)
+	}
+
+	b, err := openBackend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	g, err := b.LoadGraph(cmd.Context(), appName)
+	if err != nil {
+		return fmt.Errorf("failed to load graph for app %s: %w", appName, err)
+	}
+	result := diagnose("app "+appName, g, g.Validate())
+	if err := printValidations([]validation{result}, structured); err != nil {
+		return err
+	}
+	if !result.Valid {
+		return fmt.Errorf("graph of app %s is invalid", appName)
+	}
+	return nil
+}
+
+// validateFiles validates every file, failing if any is invalid
+func validateFiles(paths []string, structured bool) error {
+	results := make([]validation, 0, len(paths))
+	invalid := 0
+	for _, path := range paths {
+		g, err := readGraphFile(path, "")
+		if err == nil {
+			err = g.Validate()
+		}
+		source := path
+		if path == "-" {
+			source = "stdin"
+		}
+		result := diagnose(source, g, err)
+		if !result.Valid {
+			invalid++
+		}
+		results = append(results, result)
+	}
+	if err := printValidations(results, structured); err != nil {
+		return err
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d graphs are invalid", invalid, len(paths))
+	}
+	return nil
+}
+
+// validation is what validate found for the graph of a file or app
+type validation struct {
+	Source   string   `json:"source"`
+	Valid    bool     `json:"valid"`
+	Nodes    int      `json:"nodes"`
+	Edges    int      `json:"edges"`
+	Problems []string `json:"problems"`
+}
+
+// diagnose turns the error validating or reading the graph of source into
+// a validation
+func diagnose(source string, g *graph.Graph, err error) validation {
+	result := validation{Source: source, Problems: []string{}}
+	for _, problem := range joinedErrors(err) {
+		result.Problems = append(result.Problems, problem.Error())
+	}
+	result.Valid = len(result.Problems) == 0
+	if g != nil {
+		result.Nodes, result.Edges = len(g.Nodes), len(g.Edges)
+	}
+	return result
+}
+
+func printValidations(results []validation, structured bool) error {
+	if structured {
+		return printStructured(results)
+	}
+	for _, result := range results {
+		printValidation(result)
+	}
+	return nil
+}
+
+// printDiagnostics prints whether the graph of source is valid or lists
+// its problems
+func printDiagnostics(source string, g *graph.Graph, err error) {
+	printValidation(diagnose(source, g, err))
+}
+
+func printValidation(result validation) {
+	switch len(result.Problems) {
+	case 0:
+		fmt.Printf("%s: valid, %d nodes, %d edges\n", result.Source, result.Nodes, result.Edges)
+		return
+	case 1:
+		fmt.Printf("%s: 1 problem\n", result.Source)
+	default:
+		fmt.Printf("%s: %d problems\n", result.Source, len(result.Problems))
+	}
+	for _, problem := range result.Problems {
+		fmt.Printf("  - %s\n", problem)
+	}
+}
+
+// joinedErrors splits an errors.Join error into its errors
+func joinedErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	var joined interface{ Unwrap() []error }
+	if errors.As(err, &joined) {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+// seedApp is the name of the demo app loaded by initdb --seed
+const seedApp = "helloworld"
+
+//go:embed seed/helloworld.yaml
+var seedGraph []byte
+
+var seedMetadata = graph.AppMetadata{
+	Description: "Simple HelloWorld application demonstrating container, database, and cache orchestration",
+	Owner:       "platform-team",
+	Team:        "platform",
+}
+
+var initdbCmd = &cobra.Command{
+	Use:   "initdb",
+	Short: "Create and migrate the database",
+	Long: `Create the database of the --db-* flags if it does not exist and create
+or update its tables, as the server does on startup. PostgreSQL and MySQL
+databases are created through the server's default database, SQLite files
+with their directory.
+
+The migrations are built into ctl, as they are into the server, so initdb
+can run from any directory. They are applied in order and recorded in the
+schema_migrations table, so running initdb again only applies the
+migrations of newer versions of ctl; ctl doctor compares the recorded
+version with the one of ctl.
+
+--rm drops the database, or removes the SQLite file, first. --seed loads
+the helloworld demo app, unless an app of that name exists.`,
+	Example: `  ctl initdb --db-type sqlite --db-name graph.db --seed
+  ctl initdb --db-host db.internal --db-user admin --db-name idp_orchestrator
+  ctl initdb --db-type sqlite --db-name graph.db --rm --yes`,
+	RunE: runInitDB,
+}
+
+var (
+	initdbRemove bool
+	initdbSeed   bool
+	initdbYes    bool
+)
+
+func init() {
+	initdbCmd.Flags().BoolVar(&initdbRemove, "rm", false, "drop the database, or remove the SQLite file, before creating it")
+	initdbCmd.Flags().BoolVar(&initdbSeed, "seed", false, "load the "+seedApp+" demo app")
+	initdbCmd.Flags().BoolVarP(&initdbYes, "yes", "y", false, "drop the database without asking")
+}
+
+func runInitDB(cmd *cobra.Command, args []string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if config.API.URL != "" {
+		return fmt.Errorf("initdb works on the database: unset --server")
+	}
+	if initdbRemove && !initdbYes {
+		if !confirm(fmt.Sprintf("Drop the %s and all its data?", describeDatabase(config))) {
+			fmt.Println("Nothing changed")
+			return nil
+		}
+	}
+
+	switch storage.DatabaseType(config.Database.Type) {
+	case storage.DatabaseTypePostgres, storage.DatabaseTypeMySQL:
+		err = createServerDatabase(config)
+	case storage.DatabaseTypeSQLite:
+		err = createSQLiteFile(config.Database.Name)
+	default:
+		err = fmt.Errorf("unsupported database type: %s", config.Database.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	db, err := storage.NewConnection(config.storageConfig())
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	fmt.Println("Migrating the schema...")
+	applied, err := storage.Migrate(db)
+	if err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	for _, migration := range applied {
+		fmt.Printf("Applied migration %d: %s\n", migration.Version, migration.Name)
+	}
+	if len(applied) == 0 {
+		fmt.Printf("Schema is up to date at version %d\n", storage.LatestSchemaVersion())
+	}
+
+	if initdbSeed {
+		ctx := context.Background()
+		if config.Tenant != "" {
+			ctx = storage.WithTenant(ctx, uuid.MustParse(config.Tenant))
+		}
+		if err := seedDatabase(storage.NewRepository(db).ForTenant(ctx)); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Initialized the %s\n", describeDatabase(config))
+	return nil
+}
+
+// createServerDatabase creates the PostgreSQL or MySQL database of config
+// through a connection to the server's default database, dropping it
+// first with --rm
+func createServerDatabase(config *ctlConfig) error {
+	name := config.Database.Name
+	if name == "" {
+		return fmt.Errorf("no database name given with --db-name")
+	}
+	adminConfig := config.storageConfig()
+	adminConfig.DBName = ""
+	if adminConfig.Type == storage.DatabaseTypePostgres {
+		adminConfig.DBName = "postgres"
+	}
+	admin, err := storage.NewConnection(adminConfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the %s server: %w", adminConfig.Type, err)
+	}
+	if sqlDB, err := admin.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	exists, err := databaseExists(admin, adminConfig.Type, name)
+	if err != nil {
+		return fmt.Errorf("failed to check if database %s exists: %w", name, err)
+	}
+	if exists && initdbRemove {
+		fmt.Printf("Dropping database %s...\n", name)
+		if adminConfig.Type == storage.DatabaseTypePostgres {
+			// Connections to the database keep it from being dropped
+			err := admin.Exec("SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = ? AND pid <> pg_backend_pid()", name).Error
+			if err != nil {
+				fmt.Printf("Warning: could not terminate the connections to %s: %v\n", name, err)
+			}
+		}
+		if err := admin.Exec("DROP DATABASE " + quoteIdentifier(adminConfig.Type, name)).Error; err != nil {
+			return fmt.Errorf("failed to drop database %s: %w", name, err)
+		}
+		exists = false
+	}
+	if exists {
+		fmt.Printf("Database %s already exists\n", name)
+		return nil
+	}
+	fmt.Printf("Creating database %s...\n", name)
+	if err := admin.Exec("CREATE DATABASE " + quoteIdentifier(adminConfig.Type, name)).Error; err != nil {
+		return fmt.Errorf("failed to create database %s: %w", name, err)
+	}
+	return nil
+}
+
+func databaseExists(db *gorm.DB, dbType storage.DatabaseType, name string) (bool, error) {
+	query := "SELECT COUNT(*) FROM pg_database WHERE datname = ?"
+	if dbType == storage.DatabaseTypeMySQL {
+		query = "SELECT COUNT(*) FROM information_schema.schemata WHERE schema_name = ?"
+	}
+	var count int64
+	if err := db.Raw(query, name).Scan(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// quoteIdentifier quotes a database name for statements that do not take
+// it as a parameter
+func quoteIdentifier(dbType storage.DatabaseType, name string) string {
+	if dbType == storage.DatabaseTypeMySQL {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// createSQLiteFile prepares the directory of a SQLite file, which is
+// created on connecting, removing the file and its journals first with
+// --rm
+func createSQLiteFile(path string) error {
+	if path == "" {
+		return fmt.Errorf("no SQLite file given with --db-name")
+	}
+	if initdbRemove {
+		for _, file := range []string{path, path + "-journal", path + "-wal", path + "-shm"} {
+			if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to remove %s: %w", file, err)
+			}
+		}
+	}
+	if _, err := os.Stat(path); err == nil {
+		fmt.Printf("Database file %s already exists\n", path)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+	fmt.Printf("Creating database file %s...\n", path)
+	return nil
+}
+
+// seedDatabase saves the embedded demo app, leaving an existing app of its
+// name alone
+func seedDatabase(repository storage.RepositoryInterface) error {
+	_, err := repository.LoadGraph(seedApp)
+	switch {
+	case err == nil:
+		fmt.Printf("App %s already exists, not seeded\n", seedApp)
+		return nil
+	case !errors.Is(err, storage.ErrAppNotFound):
+		return fmt.Errorf("failed to load graph for app %s: %w", seedApp, err)
+	}
+
+	g, err := parseGraphFile(seedGraph, seedApp)
+	if err != nil {
+		return fmt.Errorf("failed to read demo app: %w", err)
+	}
+	if err := g.Validate(); err != nil {
+		return fmt.Errorf("invalid demo app: %w", err)
+	}
+	if err := repository.SaveGraph(seedApp, g); err != nil {
+		return fmt.Errorf("failed to save demo app: %w", err)
+	}
+	if err := repository.SetAppMetadata(seedApp, seedMetadata); err != nil {
+		return fmt.Errorf("failed to save metadata of demo app: %w", err)
+	}
+	fmt.Printf("Seeded app %s: %d nodes, %d edges\n", seedApp, len(g.Nodes), len(g.Edges))
+	return nil
+}
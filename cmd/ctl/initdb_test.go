@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateSQLiteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data", "graph.db")
+
+	tests := []struct {
+		name     string
+		existing []string // Files present before
+		remove   bool
+		removed  []string // Files gone after
+		kept     []string // Files still present after
+	}{
+		{name: "new file in a new directory"},
+		{name: "existing file is kept", existing: []string{path}, kept: []string{path}},
+		{
+			name:     "--rm removes the file and its journals",
+			existing: []string{path, path + "-journal", path + "-wal", path + "-shm"},
+			remove:   true,
+			removed:  []string{path, path + "-journal", path + "-wal", path + "-shm"},
+		},
+		{name: "--rm without a file", remove: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, os.RemoveAll(filepath.Dir(path)))
+			for _, file := range tt.existing {
+				require.NoError(t, os.MkdirAll(filepath.Dir(file), 0o755))
+				require.NoError(t, os.WriteFile(file, []byte("data"), 0o600))
+			}
+			initdbRemove = tt.remove
+			defer func() { initdbRemove = false }()
+
+			require.NoError(t, createSQLiteFile(path))
+			assert.DirExists(t, filepath.Dir(path))
+			for _, file := range tt.removed {
+				assert.NoFileExists(t, file)
+			}
+			for _, file := range tt.kept {
+				assert.FileExists(t, file)
+			}
+		})
+	}
+
+	assert.Error(t, createSQLiteFile(""))
+}
+
+func TestInitDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "graph.db")
+	args := append([]string{"initdb", "--seed"}, sqliteArgs(path)...)
+
+	out, err := runCtl(t, "", args...)
+	require.NoError(t, err)
+	assert.Contains(t, out, "Applied migration 7: key nodes by app")
+	assert.Contains(t, out, "Seeded app helloworld: 11 nodes, 13 edges")
+
+	// Running again changes nothing and leaves the seeded app alone
+	db, err := storage.NewSQLiteConnection(path)
+	require.NoError(t, err)
+	repo := storage.NewRepository(db)
+	g, err := repo.LoadGraph(seedApp)
+	require.NoError(t, err)
+	for id := range g.Nodes {
+		require.NoError(t, g.RemoveNode(id))
+		break
+	}
+	require.NoError(t, repo.SaveGraph(seedApp, g))
+
+	out, err = runCtl(t, "", args...)
+	require.NoError(t, err)
+	assert.Contains(t, out, "Schema is up to date at version")
+	assert.Contains(t, out, "App helloworld already exists, not seeded")
+	g, err = repo.LoadGraph(seedApp)
+	require.NoError(t, err)
+	assert.Len(t, g.Nodes, 10)
+
+	// --rm asks first; declining changes nothing
+	out, err = runCtl(t, "n\n", append(args, "--rm")...)
+	require.NoError(t, err)
+	assert.Contains(t, out, "Drop the sqlite database "+path+" and all its data? [y/N]")
+	assert.Contains(t, out, "Nothing changed")
+	g, err = repo.LoadGraph(seedApp)
+	require.NoError(t, err)
+	assert.Len(t, g.Nodes, 10)
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	// Confirmed, the database is recreated and seeded again
+	out, err = runCtl(t, "y\n", append(args, "--rm")...)
+	require.NoError(t, err)
+	assert.Contains(t, out, "Creating database file")
+	assert.Contains(t, out, "Seeded app helloworld")
+
+	out, err = runCtl(t, "", append(args, "--rm", "--yes")...)
+	require.NoError(t, err)
+	assert.NotContains(t, out, "[y/N]")
+	assert.Contains(t, out, "Seeded app helloworld")
+
+	_, err = runCtl(t, "", "initdb", "--server", "http://localhost:8080")
+	assert.ErrorContains(t, err, "unset --server")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	version = "dev"
+	commit  = "none"
+	date    = "unknown"
+)
+
+func main() {
+	registerCompletions(rootCmd)
+	if err := rootCmd.Execute(); err != nil {
+		var exit *exitError
+		if errors.As(err, &exit) {
+			os.Exit(exit.code)
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// exitError ends the CLI with its code, after the command has reported
+// why
+type exitError struct {
+	code int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit code %d", e.code)
+}
+
+var rootCmd = &cobra.Command{
+	Use:   "ctl",
+	Short: "innominatus-graph CLI",
+	Long: `Command line tool for the graphs and runs of innominatus-graph.
+
+Commands work on the database given with the --db-* flags, or on the HTTP
+API of the server given with --server. Settings are read from the YAML file
+given with --config, then from environment variables named after the keys
+(IDP_API_URL for api.url, IDP_DATABASE_HOST for database.host), then from
+flags.`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version information",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Printf("ctl version %s\n", version)
+		fmt.Printf("Built on %s from commit %s\n", date, commit)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(applyCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(generateCmd)
+	rootCmd.AddCommand(runsCmd)
+	rootCmd.AddCommand(executeCmd)
+	rootCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(watchCmd)
+	rootCmd.AddCommand(nodeCmd)
+	rootCmd.AddCommand(browseCmd)
+	rootCmd.AddCommand(doctorCmd)
+	rootCmd.AddCommand(initdbCmd)
+	rootCmd.AddCommand(serveCmd)
+
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&configFile, "config", "", "YAML config file")
+	flags.BoolVar(&noColor, "no-color", false, "print without colors, as when NO_COLOR is set")
+	flags.String("server", "", "URL of the server whose API to use instead of the database, e.g. http://localhost:8080")
+	flags.String("api-key", "", "API key sent to the server")
+	flags.String("token", "", "ID token sent to the server as bearer token")
+	flags.String("tenant", "", "tenant ID (default: the default tenant)")
+	flags.String("db-type", "postgres", "database type: postgres, mysql or sqlite")
+	flags.String("db-host", "localhost", "database host")
+	flags.Int("db-port", 0, "database port (default: 5432 for postgres, 3306 for mysql)")
+	flags.String("db-user", "postgres", "database user")
+	flags.String("db-password", "", "database password")
+	flags.String("db-name", "idp_orchestrator", "database name or SQLite file")
+	flags.String("db-ssl-mode", "disable", "database SSL mode")
+	bindFlags(rootCmd)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+// runCtl runs ctl with args, answering prompts with input, and returns
+// what it printed. Flags and settings of earlier runs are reset first.
+func runCtl(t *testing.T, input string, args ...string) (string, error) {
+	t.Helper()
+	resetFlags(rootCmd)
+	viper.Reset()
+	bindFlags(rootCmd)
+
+	dir := t.TempDir()
+	stdinPath := filepath.Join(dir, "stdin")
+	require.NoError(t, os.WriteFile(stdinPath, []byte(input), 0o600))
+	stdin, err := os.Open(stdinPath)
+	require.NoError(t, err)
+	defer stdin.Close()
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	require.NoError(t, err)
+	defer stdout.Close()
+
+	savedStdin, savedStdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = stdin, stdout
+	defer func() { os.Stdin, os.Stdout = savedStdin, savedStdout }()
+
+	rootCmd.SetArgs(args)
+	runErr := rootCmd.Execute()
+
+	_, err = stdout.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	printed, err := io.ReadAll(stdout)
+	require.NoError(t, err)
+	return string(printed), runErr
+}
+
+// resetFlags sets the flags of cmd and its subcommands back to their
+// defaults
+func resetFlags(cmd *cobra.Command) {
+	reset := func(flag *pflag.Flag) {
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			slice.Replace(nil)
+		} else {
+			flag.Value.Set(flag.DefValue)
+		}
+		flag.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, sub := range cmd.Commands() {
+		resetFlags(sub)
+	}
+}
+
+// sqliteArgs are the flags selecting the SQLite database at path
+func sqliteArgs(path string) []string {
+	return []string{"--db-type", "sqlite", "--db-name", path}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/philipsahli/innominatus-graph/pkg/events"
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var nodeCmd = &cobra.Command{
+	Use:   "node",
+	Short: "Node operations",
+	Long:  `Commands for working with the nodes of a graph`,
+}
+
+var nodeGetCmd = &cobra.Command{
+	Use:   "get <node-id>",
+	Short: "Show a node with its dependencies and state history",
+	Long: `Show the fields and properties of a node, the nodes it depends on and
+the nodes depending on it as trees, its other edges and its recorded state
+history.`,
+	Example: `  ctl node get deploy --app myapp
+  ctl node get deploy --app myapp -o json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runNodeGet,
+}
+
+var nodeSetStateCmd = &cobra.Command{
+	Use:   "set-state <node-id> <state>",
+	Short: "Set the state of a node",
+	Long: `Set the state of a node, e.g. to record the progress of an external
+executor or for manual remediation. The change is propagated like
+Graph.UpdateNodeState: a failed step fails its workflow and a finished
+workflow finishes its running steps.
+
+On the database the changes are saved, but servers do not publish them to
+their event streams; use --server for that.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runNodeSetState,
+}
+
+func init() {
+	nodeCmd.AddCommand(nodeGetCmd)
+	nodeCmd.AddCommand(nodeSetStateCmd)
+
+	nodeGetCmd.ValidArgsFunction = func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return completeNodeIDs(toComplete)
+	}
+	nodeSetStateCmd.ValidArgsFunction = func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		switch len(args) {
+		case 0:
+			return completeNodeIDs(toComplete)
+		case 1:
+			return nodeStateNames, cobra.ShellCompDirectiveNoFileComp
+		}
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	nodeGetCmd.Flags().StringVar(&appName, "app", "", "application name (required)")
+	addOutputFlag(nodeGetCmd)
+	nodeGetCmd.MarkFlagRequired("app")
+
+	nodeSetStateCmd.Flags().StringVar(&appName, "app", "", "application name (required)")
+	addOutputFlag(nodeSetStateCmd)
+	nodeSetStateCmd.MarkFlagRequired("app")
+}
+
+// nodeDetail is the JSON and YAML output of node get
+type nodeDetail struct {
+	Node         *graph.Node                    `json:"node"`
+	Dependencies []string                       `json:"dependencies"`
+	Dependents   []string                       `json:"dependents"`
+	Outgoing     []*graph.Edge                  `json:"outgoing_edges"`
+	Incoming     []*graph.Edge                  `json:"incoming_edges"`
+	History      []storage.NodeStateChangeModel `json:"history"`
+}
+
+func runNodeGet(cmd *cobra.Command, args []string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+	nodeID := args[0]
+	b, err := openBackend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	g, err := b.LoadGraph(cmd.Context(), appName)
+	if err != nil {
+		return fmt.Errorf("failed to load graph for app %s: %w", appName, err)
+	}
+	node, exists := g.GetNode(nodeID)
+	if !exists {
+		return fmt.Errorf("node %s not found in app %s", nodeID, appName)
+	}
+	history, err := b.NodeHistory(cmd.Context(), appName, nodeID)
+	if err != nil {
+		return fmt.Errorf("failed to get state history of node %s: %w", nodeID, err)
+	}
+
+	if structured {
+		detail := nodeDetail{
+			Node:     node,
+			Outgoing: g.OutgoingEdges(nodeID),
+			Incoming: g.IncomingEdges(nodeID),
+			History:  history,
+		}
+		dependencies, _ := g.GetDependencies(nodeID)
+		dependents, _ := g.GetDependents(nodeID)
+		detail.Dependencies, detail.Dependents = nodeIDList(dependencies), nodeIDList(dependents)
+		sort.Slice(detail.Outgoing, func(i, j int) bool { return detail.Outgoing[i].ID < detail.Outgoing[j].ID })
+		sort.Slice(detail.Incoming, func(i, j int) bool { return detail.Incoming[i].ID < detail.Incoming[j].ID })
+		if detail.History == nil {
+			detail.History = []storage.NodeStateChangeModel{}
+		}
+		return printStructured(detail)
+	}
+	return printNode(g, node, history)
+}
+
+// nodeIDList returns the sorted IDs of nodes
+func nodeIDList(nodes []*graph.Node) []string {
+	ids := make([]string, len(nodes))
+	for i, node := range nodes {
+		ids[i] = node.ID
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func printNode(g *graph.Graph, node *graph.Node, history []storage.NodeStateChangeModel) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(w, "%s:\t%s\n", name, value)
+		}
+	}
+	field("Node", node.ID)
+	field("Type", string(node.Type))
+	field("Name", node.Name)
+	field("Description", node.Description)
+	field("State", string(node.State))
+	field("Created", formatTime(node.CreatedAt))
+	field("Updated", formatTime(node.UpdatedAt))
+	if node.StartedAt != nil {
+		field("Started", formatTime(*node.StartedAt))
+	}
+	if node.CompletedAt != nil {
+		field("Completed", formatTime(*node.CompletedAt))
+		field("Duration", node.Duration.String())
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(node.Properties) > 0 {
+		data, err := yaml.Marshal(node.Properties)
+		if err != nil {
+			return fmt.Errorf("failed to encode properties: %w", err)
+		}
+		fmt.Println("\nProperties:")
+		for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+			fmt.Println("  " + line)
+		}
+	}
+
+	label := func(node *graph.Node, note string) string {
+		text := fmt.Sprintf("%s (%s, %s)", node.ID, node.Type, node.State)
+		if wideOutput() && node.Name != "" && node.Name != node.ID {
+			text = fmt.Sprintf("%s %q (%s, %s)", node.ID, node.Name, node.Type, node.State)
+		}
+		if note != "" {
+			text += " (" + note + ")"
+		}
+		return text
+	}
+	if dependencies, _ := g.GetDependencies(node.ID); len(dependencies) > 0 {
+		fmt.Printf("\nDepends on:\n%s\n%s", node.ID, dependencyTree(node.ID, g.GetDependencies, label))
+	}
+	if dependents, _ := g.GetDependents(node.ID); len(dependents) > 0 {
+		fmt.Printf("\nRequired by:\n%s\n%s", node.ID, dependencyTree(node.ID, g.GetDependents, label))
+	}
+
+	var edges []*graph.Edge
+	for _, edge := range append(g.OutgoingEdges(node.ID), g.IncomingEdges(node.ID)...) {
+		if edge.Type != graph.EdgeTypeDependsOn {
+			edges = append(edges, edge)
+		}
+	}
+	if len(edges) > 0 {
+		sort.Slice(edges, func(i, j int) bool { return edges[i].ID < edges[j].ID })
+		fmt.Println("\nOther edges:")
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, edge := range edges {
+			fmt.Fprintf(w, "  %s\t%s %s %s\n", edge.ID, edge.FromNodeID, edge.Type, edge.ToNodeID)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("\nState history:")
+	if len(history) == 0 {
+		fmt.Println("  no changes recorded")
+		return nil
+	}
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, change := range history {
+		run := ""
+		if change.RunID != nil {
+			run = "run " + change.RunID.String()
+		}
+		fmt.Fprintf(w, "  %s\t%s -> %s\t%s\n", formatTime(change.ChangedAt), change.OldState, change.NewState, run)
+	}
+	return w.Flush()
+}
+
+func runNodeSetState(cmd *cobra.Command, args []string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+	nodeID, state := args[0], graph.NodeState(args[1])
+	switch state {
+	case graph.NodeStateWaiting, graph.NodeStatePending, graph.NodeStateRunning, graph.NodeStateFailed, graph.NodeStateSucceeded:
+	default:
+		return fmt.Errorf("invalid node state %q: use waiting, pending, running, failed or succeeded", state)
+	}
+
+	b, err := openBackend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	changes, err := b.SetNodeState(cmd.Context(), appName, nodeID, state)
+	if err != nil {
+		return fmt.Errorf("failed to set state of node %s: %w", nodeID, err)
+	}
+	if structured {
+		if changes == nil {
+			changes = []events.NodeStateChanged{}
+		}
+		return printStructured(changes)
+	}
+	if len(changes) == 0 {
+		fmt.Printf("Node %s is already %s\n", nodeID, state)
+		return nil
+	}
+	for _, change := range changes {
+		fmt.Printf("%s: %s -> %s\n", change.Node.ID, change.OldState, change.NewState)
+	}
+	return nil
+}
+
+// Notes of dependencyTree on nodes it does not follow
+const (
+	treeCycle = "cycle"
+	treeDrawn = "see above"
+)
+
+// dependencyTree draws the nodes reached from root through next as a tree
+// below it, one line per node given by label. Nodes on the path from root
+// are not followed again, nor are nodes drawn already, which shared
+// dependencies would repeat; label gets treeCycle or treeDrawn as note for
+// them.
+func dependencyTree(root string, next func(string) ([]*graph.Node, error), label func(node *graph.Node, note string) string) string {
+	var b strings.Builder
+	path := map[string]bool{root: true}
+	drawn := make(map[string]bool)
+	var draw func(id, prefix string)
+	draw = func(id, prefix string) {
+		nodes, err := next(id)
+		if err != nil {
+			return
+		}
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+		for i, node := range nodes {
+			branch, indent := "├── ", "│   "
+			if i == len(nodes)-1 {
+				branch, indent = "└── ", "    "
+			}
+			switch {
+			case path[node.ID]:
+				b.WriteString(prefix + branch + label(node, treeCycle) + "\n")
+				continue
+			case drawn[node.ID]:
+				b.WriteString(prefix + branch + label(node, treeDrawn) + "\n")
+				continue
+			}
+			b.WriteString(prefix + branch + label(node, "") + "\n")
+			drawn[node.ID] = true
+			path[node.ID] = true
+			draw(node.ID, prefix+indent)
+			delete(path, node.ID)
+		}
+	}
+	draw(root, "")
+	return b.String()
+}
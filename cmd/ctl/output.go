@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of --output. Tables are for people, wide tables add the columns
+// that do not fit next to each other on most terminals, and JSON and YAML
+// are for scripts.
+const (
+	outputTable = "table"
+	outputWide  = "wide"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+var outputFormats = []string{outputTable, outputWide, outputJSON, outputYAML}
+
+var (
+	outputFormat string
+	noColor      bool
+)
+
+// addOutputFlag adds -o/--output to cmd, completing the formats
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", outputTable, "output format: "+strings.Join(outputFormats, ", "))
+	cmd.RegisterFlagCompletionFunc("output", cobra.FixedCompletions(outputFormats, cobra.ShellCompDirectiveNoFileComp))
+}
+
+// structuredOutput reports whether --output asks for JSON or YAML rather
+// than a table
+func structuredOutput() (bool, error) {
+	switch outputFormat {
+	case outputTable, outputWide:
+		return false, nil
+	case outputJSON, outputYAML:
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid output format %q: use %s", outputFormat, strings.Join(outputFormats, ", "))
+}
+
+// wideOutput reports whether --output asks for wide tables
+func wideOutput() bool {
+	return outputFormat == outputWide
+}
+
+// printStructured prints v as JSON or YAML, as --output asks. YAML has the
+// keys of the JSON encoding, in the same order.
+func printStructured(v interface{}) error {
+	if outputFormat != outputYAML {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+	data, err := yamlOf(v)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+// printStreamed prints one of a stream of values as JSON or YAML, as
+// --output asks: JSON on a line of its own, YAML as a document of its own
+func printStreamed(v interface{}) error {
+	if outputFormat != outputYAML {
+		return json.NewEncoder(os.Stdout).Encode(v)
+	}
+	data, err := yamlOf(v)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(append([]byte("---\n"), data...))
+	return err
+}
+
+// yamlOf encodes v as YAML through its JSON encoding
+func yamlOf(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	blockStyle(&document)
+	return yaml.Marshal(&document)
+}
+
+// blockStyle turns the flow style of JSON parsed as YAML into block style
+func blockStyle(node *yaml.Node) {
+	node.Style &^= yaml.FlowStyle | yaml.DoubleQuotedStyle
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// useColor reports whether to color output to f: on terminals, unless
+// --no-color is given or NO_COLOR is set
+func useColor(f *os.File) bool {
+	return !noColor && os.Getenv("NO_COLOR") == "" && isTerminal(f)
+}
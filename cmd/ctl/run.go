@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/events"
+	"github.com/philipsahli/innominatus-graph/pkg/execution"
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of the run command besides 0 for completed runs and 1 for
+// errors
+const (
+	exitRunFailed  = 2
+	exitRunTimeout = 3
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Execute the graph of an app and follow its progress",
+	Long: `Start a run of the graph of an app like execute and show the state of its
+nodes until it finishes. On a terminal the nodes are shown as a table that
+is updated in place, otherwise every state change is printed on a line.
+
+The command exits with 0 if the run completed, 2 if it failed and 3 if it
+did not finish within --timeout, e.g. to gate deployment pipelines.`,
+	Example: `  ctl run --app myapp
+  ctl run --app myapp --timeout 10m
+  ctl run --app myapp --simulate --db-type sqlite --db-name graph.db`,
+	RunE: runRun,
+}
+
+var runTimeout time.Duration
+
+func init() {
+	runCmd.Flags().StringVar(&appName, "app", "", "application name (required)")
+	runCmd.Flags().BoolVar(&simulate, "simulate", false, "execute the run in this process with the mock workflow runner (database only)")
+	runCmd.Flags().DurationVar(&runTimeout, "timeout", 0, "stop following the run after this long (0: no limit)")
+	runCmd.MarkFlagRequired("app")
+}
+
+func runRun(cmd *cobra.Command, args []string) error {
+	b, err := openBackend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	ctx := cmd.Context()
+	if runTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, runTimeout)
+		defer cancel()
+	}
+
+	g, err := b.LoadGraph(ctx, appName)
+	if err != nil {
+		return fmt.Errorf("failed to load graph for app %s: %w", appName, err)
+	}
+	progress := newRunProgress(os.Stdout, g, isTerminal(os.Stdout))
+	if progress.live && simulate {
+		// The mock runner logs every step, which would break up the table
+		log.SetOutput(io.Discard)
+		defer log.SetOutput(os.Stderr)
+	}
+
+	changes := make(chan events.NodeStateChanged, 64)
+	shown := make(chan struct{})
+	go func() {
+		defer close(shown)
+		progress.follow(changes)
+	}()
+	run, err := b.RunGraph(ctx, appName, simulate, changes)
+	close(changes)
+	<-shown
+	progress.stop()
+
+	if errors.Is(err, context.DeadlineExceeded) && run != nil {
+		fmt.Printf("Run %s did not finish within %s, it is still %s\n", run.ID, runTimeout, run.Status)
+		return &exitError{code: exitRunTimeout}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run graph of app %s: %w", appName, err)
+	}
+
+	elapsed := "-"
+	if run.CompletedAt != nil {
+		elapsed = run.CompletedAt.Sub(run.StartedAt).Round(time.Millisecond).String()
+	}
+	if run.Status != string(execution.StatusCompleted) {
+		fmt.Printf("Run %s %s after %s: %s\n", run.ID, run.Status, elapsed, run.ErrorMessage)
+		return &exitError{code: exitRunFailed}
+	}
+	fmt.Printf("Run %s completed in %s\n", run.ID, elapsed)
+	return nil
+}
+
+// runProgress shows the node states of a run
+type runProgress struct {
+	out  io.Writer
+	live bool // Redraw a table in place instead of printing changes
+
+	mu      sync.Mutex
+	order   []string
+	names   map[string]string
+	states  map[string]graph.NodeState
+	started map[string]time.Time
+	elapsed map[string]time.Duration
+	frame   int
+	drawn   int // Lines of the last table drawn
+	done    chan struct{}
+}
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+func newRunProgress(out io.Writer, g *graph.Graph, live bool) *runProgress {
+	p := &runProgress{
+		out:     out,
+		live:    live,
+		names:   make(map[string]string, len(g.Nodes)),
+		states:  make(map[string]graph.NodeState, len(g.Nodes)),
+		started: make(map[string]time.Time),
+		elapsed: make(map[string]time.Duration),
+		done:    make(chan struct{}),
+	}
+	// Show the nodes in execution order
+	if sorted, err := g.TopologicalSort(); err == nil {
+		for _, node := range sorted {
+			p.order = append(p.order, node.ID)
+		}
+	} else {
+		for id := range g.Nodes {
+			p.order = append(p.order, id)
+		}
+		sort.Strings(p.order)
+	}
+	for id, node := range g.Nodes {
+		p.names[id] = node.Name
+		p.states[id] = graph.NodeStateWaiting
+	}
+
+	if live {
+		go func() {
+			ticker := time.NewTicker(100 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-p.done:
+					return
+				case <-ticker.C:
+					p.mu.Lock()
+					p.frame++
+					p.draw()
+					p.mu.Unlock()
+				}
+			}
+		}()
+	}
+	return p
+}
+
+// follow shows the changes until the channel is closed
+func (p *runProgress) follow(changes <-chan events.NodeStateChanged) {
+	for change := range changes {
+		p.mu.Lock()
+		p.update(change)
+		p.mu.Unlock()
+	}
+}
+
+func (p *runProgress) update(change events.NodeStateChanged) {
+	id := change.Node.ID
+	if p.states[id] == change.NewState {
+		return
+	}
+	if _, known := p.states[id]; !known {
+		p.order = append(p.order, id)
+	}
+	p.states[id] = change.NewState
+	switch change.NewState {
+	case graph.NodeStateRunning:
+		p.started[id] = change.At
+	case graph.NodeStateSucceeded, graph.NodeStateFailed:
+		if started, ok := p.started[id]; ok {
+			p.elapsed[id] = change.At.Sub(started)
+		}
+	}
+
+	if p.live {
+		p.draw()
+		return
+	}
+	fmt.Fprintf(p.out, "%s %s %s\n", change.At.Local().Format("15:04:05"), id, change.NewState)
+}
+
+// stop draws the final table
+func (p *runProgress) stop() {
+	close(p.done)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.live {
+		p.draw()
+	}
+}
+
+// draw redraws the table over the last one
+func (p *runProgress) draw() {
+	var b strings.Builder
+	if p.drawn > 0 {
+		fmt.Fprintf(&b, "\033[%dA", p.drawn)
+	}
+	width := 0
+	for _, id := range p.order {
+		width = max(width, len(id))
+	}
+	for _, id := range p.order {
+		state := p.states[id]
+		duration := ""
+		if elapsed, ok := p.elapsed[id]; ok {
+			duration = elapsed.Round(time.Millisecond).String()
+		} else if started, ok := p.started[id]; ok && state == graph.NodeStateRunning {
+			duration = time.Since(started).Round(100 * time.Millisecond).String()
+		}
+		fmt.Fprintf(&b, "\033[2K  %s %-*s  %-9s  %s\n", p.symbol(state), width, id, state, duration)
+	}
+	p.drawn = len(p.order)
+	io.WriteString(p.out, b.String())
+}
+
+func (p *runProgress) symbol(state graph.NodeState) string {
+	switch state {
+	case graph.NodeStatePending:
+		return "○"
+	case graph.NodeStateRunning:
+		return spinnerFrames[p.frame%len(spinnerFrames)]
+	case graph.NodeStateSucceeded:
+		return "✓"
+	case graph.NodeStateFailed:
+		return "✗"
+	}
+	return "·"
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
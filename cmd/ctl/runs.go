@@ -0,0 +1,439 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/api"
+	"github.com/philipsahli/innominatus-graph/pkg/execution"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+var runsCmd = &cobra.Command{
+	Use:   "runs",
+	Short: "Run operations",
+	Long:  `Commands for inspecting and managing the runs of an app`,
+}
+
+var runsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the runs of an app",
+	Long:  `List the runs of an app, most recently started first`,
+	RunE:  runRunsList,
+}
+
+var runsGetCmd = &cobra.Command{
+	Use:               "get <run-id>",
+	Short:             "Show a run and the executions of its nodes",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: cobra.NoFileCompletions,
+	RunE:              runRunsGet,
+}
+
+var runsLogsCmd = &cobra.Command{
+	Use:   "logs <run-id>",
+	Short: "Print the logs of the nodes of a run",
+	Long: `Print the logs of the nodes of a run, in the order they started. Logs
+are recorded once the run has finished.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: cobra.NoFileCompletions,
+	RunE:              runRunsLogs,
+}
+
+var runsCancelCmd = &cobra.Command{
+	Use:   "cancel <run-id>",
+	Short: "Cancel a queued or running run",
+	Long: `Cancel a queued or running run by marking it as failed, after asking
+for confirmation unless --yes is given.
+
+Queued runs are never started. The server executing a running run finishes
+the node it is executing and skips the others. Runs that finish before they
+are cancelled are not cancellable.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: cobra.NoFileCompletions,
+	RunE:              runRunsCancel,
+}
+
+var runsPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete old finished runs of an app",
+	Long: `Delete the finished runs of an app that started longer ago than
+--older-than, together with their state history, keeping the --keep-last
+most recent finished runs. Queued and running runs are never pruned.`,
+	Example: `  ctl runs prune --app myapp --older-than 720h --keep-last 20
+  ctl runs prune --app myapp --older-than 0s --yes`,
+	RunE: runRunsPrune,
+}
+
+var executeCmd = &cobra.Command{
+	Use:   "execute",
+	Short: "Execute the graph of an app",
+	Long: `Start a run of the graph of an app.
+
+Through the API the server executes the run. On the database the run is
+queued for the servers sharing it with the run queue enabled, or executed
+in this process with the mock workflow runner when --simulate is given.`,
+	RunE: runExecute,
+}
+
+var (
+	runStatuses   []string
+	runLimit      int
+	logNodes      []string
+	cancelReason  string
+	cancelYes     bool
+	pruneAge      time.Duration
+	pruneKeepLast int
+	pruneYes      bool
+	simulate      bool
+)
+
+func init() {
+	runsCmd.AddCommand(runsListCmd)
+	runsCmd.AddCommand(runsGetCmd)
+	runsCmd.AddCommand(runsLogsCmd)
+	runsCmd.AddCommand(runsCancelCmd)
+	runsCmd.AddCommand(runsPruneCmd)
+	for _, cmd := range []*cobra.Command{runsListCmd, runsGetCmd, runsLogsCmd, runsCancelCmd, runsPruneCmd, executeCmd} {
+		addOutputFlag(cmd)
+	}
+
+	runsListCmd.Flags().StringVar(&appName, "app", "", "application name (required)")
+	runsListCmd.Flags().StringSliceVar(&runStatuses, "status", nil, "only list runs with these statuses, e.g. failed,running")
+	runsListCmd.Flags().IntVar(&runLimit, "limit", 20, "maximum number of runs listed (0: all)")
+	runsListCmd.MarkFlagRequired("app")
+
+	runsLogsCmd.Flags().StringSliceVar(&logNodes, "node", nil, "only print the logs of these nodes")
+
+	runsCancelCmd.Flags().StringVar(&cancelReason, "reason", "", "why the run is cancelled, recorded in its error message")
+	runsCancelCmd.Flags().BoolVarP(&cancelYes, "yes", "y", false, "cancel without asking for confirmation")
+
+	runsPruneCmd.Flags().StringVar(&appName, "app", "", "application name (required)")
+	runsPruneCmd.Flags().DurationVar(&pruneAge, "older-than", 30*24*time.Hour, "prune runs that started longer ago")
+	runsPruneCmd.Flags().IntVar(&pruneKeepLast, "keep-last", 10, "number of most recent finished runs kept regardless of their age")
+	runsPruneCmd.Flags().BoolVarP(&pruneYes, "yes", "y", false, "prune without asking for confirmation")
+	runsPruneCmd.MarkFlagRequired("app")
+
+	executeCmd.Flags().StringVar(&appName, "app", "", "application name (required)")
+	executeCmd.Flags().BoolVar(&simulate, "simulate", false, "execute the run in this process with the mock workflow runner (database only)")
+	executeCmd.MarkFlagRequired("app")
+}
+
+func runRunsList(cmd *cobra.Command, args []string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+	b, err := openBackend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	runs, err := b.ListRuns(cmd.Context(), appName, storage.RunFilter{Statuses: runStatuses, Limit: runLimit})
+	if err != nil {
+		return fmt.Errorf("failed to list runs of app %s: %w", appName, err)
+	}
+	if structured {
+		if runs == nil {
+			runs = []storage.GraphRunModel{}
+		}
+		return printStructured(runs)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if wideOutput() {
+		fmt.Fprintln(w, "RUN ID\tVERSION\tSTATUS\tSTARTED\tCOMPLETED\tDURATION\tCLAIMED BY\tERROR")
+	} else {
+		fmt.Fprintln(w, "RUN ID\tVERSION\tSTATUS\tSTARTED\tDURATION")
+	}
+	for _, run := range runs {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t", run.ID, run.Version, run.Status, run.StartedAt.Local().Format(time.RFC3339))
+		if wideOutput() {
+			completed := "-"
+			if run.CompletedAt != nil {
+				completed = run.CompletedAt.Local().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", completed, runDuration(&run), orDash(run.ClaimedBy), run.ErrorMessage)
+			continue
+		}
+		fmt.Fprintf(w, "%s\n", runDuration(&run))
+	}
+	return w.Flush()
+}
+
+// orDash returns value, or - if it is empty
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// runDuration is how long a finished run took, or - for unfinished runs
+func runDuration(run *storage.GraphRunModel) string {
+	if run.CompletedAt == nil {
+		return "-"
+	}
+	return run.CompletedAt.Sub(run.StartedAt).Round(time.Millisecond).String()
+}
+
+func runRunsGet(cmd *cobra.Command, args []string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+	runID, err := uuid.Parse(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid run ID %s", args[0])
+	}
+	b, err := openBackend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	run, nodes, err := b.GetRun(cmd.Context(), runID)
+	if err != nil {
+		return fmt.Errorf("failed to get run %s: %w", runID, err)
+	}
+	executions, err := b.RunExecutions(cmd.Context(), runID)
+	if err != nil {
+		return fmt.Errorf("failed to get run %s: %w", runID, err)
+	}
+	if structured {
+		if nodes == nil {
+			nodes = []storage.NodeExecutionRecord{}
+		}
+		return printStructured(api.GraphRunResponse{Run: run, Nodes: nodes, Executions: executions})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Run:\t%s\n", run.ID)
+	fmt.Fprintf(w, "Version:\t%d\n", run.Version)
+	fmt.Fprintf(w, "Status:\t%s\n", run.Status)
+	fmt.Fprintf(w, "Started:\t%s\n", run.StartedAt.Local().Format(time.RFC3339))
+	if run.CompletedAt != nil {
+		fmt.Fprintf(w, "Completed:\t%s\n", run.CompletedAt.Local().Format(time.RFC3339))
+	}
+	fmt.Fprintf(w, "Duration:\t%s\n", runDuration(run))
+	if run.ClaimedBy != "" {
+		fmt.Fprintf(w, "Claimed by:\t%s\n", run.ClaimedBy)
+	}
+	if run.ErrorMessage != "" {
+		fmt.Fprintf(w, "Error:\t%s\n", run.ErrorMessage)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if wideOutput() {
+		fmt.Fprintln(w, "NODE\tSTATE\tSTARTED\tCOMPLETED\tDURATION\tLOG LINES\tERROR")
+	} else {
+		fmt.Fprintln(w, "NODE\tSTATE\tSTARTED\tDURATION\tERROR")
+	}
+	for _, node := range nodes {
+		started, completed, duration := "-", "-", "-"
+		if node.StartedAt != nil {
+			started = node.StartedAt.Local().Format(time.RFC3339)
+		}
+		if node.CompletedAt != nil {
+			completed = node.CompletedAt.Local().Format(time.RFC3339)
+			duration = (time.Duration(node.DurationMs) * time.Millisecond).String()
+		}
+		message, logLines := "", "-"
+		if nodeExecution := executions[node.NodeID]; nodeExecution != nil {
+			message, logLines = nodeExecution.Error, fmt.Sprint(len(nodeExecution.Logs))
+		}
+		if wideOutput() {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", node.NodeID, node.State, started, completed, duration, logLines, message)
+		} else {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", node.NodeID, node.State, started, duration, message)
+		}
+	}
+	return w.Flush()
+}
+
+func runRunsLogs(cmd *cobra.Command, args []string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+	runID, err := uuid.Parse(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid run ID %s", args[0])
+	}
+	b, err := openBackend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	executions, err := b.RunExecutions(cmd.Context(), runID)
+	if err != nil {
+		return fmt.Errorf("failed to get logs of run %s: %w", runID, err)
+	}
+	if executions == nil {
+		return fmt.Errorf("run %s has no logs yet: they are recorded once it has finished", runID)
+	}
+	for _, id := range logNodes {
+		if executions[id] == nil {
+			return fmt.Errorf("node %s is not part of run %s", id, runID)
+		}
+	}
+	if len(logNodes) > 0 {
+		selected := make(map[string]*execution.NodeExecution, len(logNodes))
+		for _, id := range logNodes {
+			selected[id] = executions[id]
+		}
+		executions = selected
+	}
+	if structured {
+		return printStructured(executions)
+	}
+
+	for i, nodeExecution := range startOrder(executions) {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("==> %s (%s)\n", nodeExecution.NodeID, nodeExecution.Status)
+		if nodeExecution.Error != "" {
+			fmt.Printf("error: %s\n", nodeExecution.Error)
+		}
+		for _, line := range nodeExecution.Logs {
+			fmt.Println(line)
+		}
+	}
+	return nil
+}
+
+// startOrder sorts node executions by start time, nodes that never started
+// last, and by node ID
+func startOrder(executions map[string]*execution.NodeExecution) []*execution.NodeExecution {
+	sorted := make([]*execution.NodeExecution, 0, len(executions))
+	for _, nodeExecution := range executions {
+		sorted = append(sorted, nodeExecution)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i].StartTime, sorted[j].StartTime
+		switch {
+		case a != nil && b != nil && !a.Equal(*b):
+			return a.Before(*b)
+		case (a == nil) != (b == nil):
+			return a != nil
+		}
+		return sorted[i].NodeID < sorted[j].NodeID
+	})
+	return sorted
+}
+
+func runRunsCancel(cmd *cobra.Command, args []string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+	runID, err := uuid.Parse(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid run ID %s", args[0])
+	}
+	b, err := openBackend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	run, _, err := b.GetRun(cmd.Context(), runID)
+	if err != nil {
+		return fmt.Errorf("failed to get run %s: %w", runID, err)
+	}
+	if runFinished(run.Status) {
+		return fmt.Errorf("run %s is not cancellable: it has already %s", runID, run.Status)
+	}
+
+	question := fmt.Sprintf("Cancel the %s run %s?", run.Status, runID)
+	if !cancelYes && !confirm(question) {
+		fmt.Println("Nothing cancelled")
+		return nil
+	}
+	err = b.CancelRun(cmd.Context(), runID, cancelReason)
+	if errors.Is(err, storage.ErrRunNotCancellable) {
+		// It finished since it was loaded
+		return fmt.Errorf("run %s is not cancellable: it has finished", runID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to cancel run %s: %w", runID, err)
+	}
+	if structured {
+		run, _, err := b.GetRun(cmd.Context(), runID)
+		if err != nil {
+			return fmt.Errorf("failed to get run %s: %w", runID, err)
+		}
+		return printStructured(map[string]interface{}{"run_id": runID, "status": run.Status, "error_message": run.ErrorMessage})
+	}
+	fmt.Printf("Run %s cancelled\n", runID)
+	return nil
+}
+
+func runRunsPrune(cmd *cobra.Command, args []string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+	if pruneAge < 0 || pruneKeepLast < 0 {
+		return fmt.Errorf("--older-than and --keep-last cannot be negative")
+	}
+	b, err := openBackend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	question := fmt.Sprintf("Delete the finished runs of app %s that started more than %s ago, keeping the last %d?", appName, pruneAge, pruneKeepLast)
+	if !pruneYes && !confirm(question) {
+		fmt.Println("Nothing pruned")
+		return nil
+	}
+	pruned, err := b.PruneRuns(cmd.Context(), appName, pruneAge, pruneKeepLast)
+	if err != nil {
+		return fmt.Errorf("failed to prune runs of app %s: %w", appName, err)
+	}
+	if structured {
+		return printStructured(map[string]interface{}{"app_name": appName, "pruned": pruned})
+	}
+	fmt.Printf("Pruned %d runs of app %s\n", pruned, appName)
+	return nil
+}
+
+func runExecute(cmd *cobra.Command, args []string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+	b, err := openBackend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	result, err := b.Execute(cmd.Context(), appName, simulate)
+	if err != nil {
+		return fmt.Errorf("failed to execute graph of app %s: %w", appName, err)
+	}
+	if structured {
+		return printStructured(result)
+	}
+	fmt.Printf("Run %s of app %s %s\n", result.RunID, appName, result.Status)
+	return nil
+}
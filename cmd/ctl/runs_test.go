@@ -0,0 +1,69 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunsCancel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "graph.db")
+	db, err := storage.NewSQLiteConnection(path)
+	require.NoError(t, err)
+	require.NoError(t, storage.AutoMigrate(db))
+	repo := storage.NewRepository(db)
+	g, err := parseGraphFile(seedGraph, seedApp)
+	require.NoError(t, err)
+	require.NoError(t, repo.SaveGraph(seedApp, g))
+
+	queued, err := repo.QueueGraphRun(seedApp, g.Version)
+	require.NoError(t, err)
+	completed, err := repo.CreateGraphRun(seedApp, g.Version)
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateGraphRun(completed.ID, "completed", nil))
+	cancel := func(input string, args ...string) (string, error) {
+		return runCtl(t, input, append(append([]string{"runs", "cancel"}, args...), sqliteArgs(path)...)...)
+	}
+	status := func() string {
+		status, err := repo.GetGraphRunStatus(queued.ID)
+		require.NoError(t, err)
+		return status
+	}
+
+	// Declining changes nothing
+	out, err := cancel("n\n", queued.ID.String())
+	require.NoError(t, err)
+	assert.Contains(t, out, "Cancel the queued run "+queued.ID.String()+"? [y/N]")
+	assert.Contains(t, out, "Nothing cancelled")
+	assert.Equal(t, "queued", status())
+
+	out, err = cancel("y\n", queued.ID.String(), "--reason", "deployed by mistake")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Run "+queued.ID.String()+" cancelled")
+	run, err := repo.GetGraphRun(queued.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "failed", run.Status)
+	assert.Equal(t, "cancelled: deployed by mistake", run.ErrorMessage)
+
+	// Finished runs are not cancellable, with or without --yes
+	_, err = cancel("", queued.ID.String(), "--yes")
+	assert.ErrorContains(t, err, "is not cancellable: it has already failed")
+	_, err = cancel("y\n", completed.ID.String())
+	assert.ErrorContains(t, err, "is not cancellable: it has already completed")
+
+	running, err := repo.CreateGraphRun(seedApp, g.Version)
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateGraphRun(running.ID, "running", nil))
+	out, err = cancel("", running.ID.String(), "--yes", "-o", "json")
+	require.NoError(t, err)
+	assert.NotContains(t, out, "[y/N]")
+	assert.Contains(t, out, `"error_message": "cancelled"`)
+	assert.Contains(t, out, `"status": "failed"`)
+
+	_, err = cancel("", "not-a-run")
+	assert.ErrorContains(t, err, "invalid run ID")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/philipsahli/innominatus-graph/pkg/server"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run the API server",
+	Long: `Run the HTTP server of the REST and GraphQL APIs, the same server as the
+server command, so that one binary works with graphs and hosts the API.
+
+The server takes the settings of the server command: --config names its
+config file, environment variables (IDP_SERVER_PORT for server.port)
+override it, and its flags override both. The database flags are those
+of the other commands; --api-key accepts API keys as name=key here rather
+than sending one. The database is migrated on startup. The server runs
+until interrupted.`,
+	Example: `  ctl serve --db-type sqlite --db-name graph.db --simulate-executions
+  ctl serve --config server.yaml --port 9090
+  ctl serve --config server.yaml --validate-config`,
+	Args: cobra.NoArgs,
+	RunE: runServe,
+}
+
+var (
+	serveValidateConfig bool
+	serveViper          = viper.New()
+)
+
+func init() {
+	serveCmd.Flags().BoolVar(&serveValidateConfig, "validate-config", false, "validate the configuration and exit")
+	// Local flags of the same names hide --api-key and the database flags
+	// of the root command, with the defaults of the server
+	server.AddFlags(serveCmd.Flags())
+	if err := server.BindFlags(serveViper, serveCmd.Flags()); err != nil {
+		panic(err)
+	}
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	config, err := server.LoadConfig(serveViper, configFile)
+	if err != nil {
+		return err
+	}
+	srv, err := server.New(config)
+	if err != nil {
+		return err
+	}
+	if serveValidateConfig {
+		fmt.Println("Configuration is valid")
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+	defer stop()
+	return srv.Run(ctx)
+}
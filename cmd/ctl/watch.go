@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/events"
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/spf13/cobra"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Print the state changes of the nodes of an app",
+	Long: `Print the state changes of the nodes of an app as they happen, until
+interrupted. Through the API the changes come from the app's event stream;
+on the database the recorded state history is polled.`,
+	Example: `  ctl watch --app myapp
+  ctl watch --app myapp --types workflow,step --states failed`,
+	RunE: runWatch,
+}
+
+func init() {
+	watchCmd.Flags().StringVar(&appName, "app", "", "application name (required)")
+	watchCmd.Flags().StringSliceVar(&filterTypes, "types", nil, "only print changes of nodes of these types, e.g. workflow,step")
+	watchCmd.Flags().StringSliceVar(&filterStates, "states", nil, "only print changes to these states, e.g. failed")
+	addOutputFlag(watchCmd)
+	watchCmd.MarkFlagRequired("app")
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+	b, err := openBackend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+	defer stop()
+
+	g, err := b.LoadGraph(ctx, appName)
+	if err != nil {
+		return fmt.Errorf("failed to load graph for app %s: %w", appName, err)
+	}
+
+	printer := &changePrinter{backend: b, graph: g, structured: structured}
+	changes := make(chan events.NodeStateChanged, 64)
+	printed := make(chan struct{})
+	go func() {
+		defer close(printed)
+		for change := range changes {
+			printer.print(ctx, change)
+		}
+	}()
+	fmt.Fprintf(os.Stderr, "Watching app %s, press Ctrl+C to stop\n", appName)
+	err = b.WatchStates(ctx, appName, changes)
+	close(changes)
+	<-printed
+	if err != nil {
+		return fmt.Errorf("failed to watch app %s: %w", appName, err)
+	}
+	return nil
+}
+
+// changePrinter prints the state changes matching the filters
+type changePrinter struct {
+	backend    backend
+	graph      *graph.Graph // For the node types
+	structured bool
+}
+
+// watchedChange is the JSON and YAML output of watch for a state change
+type watchedChange struct {
+	AppName  string          `json:"app_name"`
+	NodeID   string          `json:"node_id"`
+	NodeType graph.NodeType  `json:"node_type"`
+	OldState graph.NodeState `json:"old_state"`
+	NewState graph.NodeState `json:"new_state"`
+	Time     time.Time       `json:"time"`
+}
+
+// print prints a change if it matches the filters. Nodes added since the
+// graph was loaded are looked up in the graph loaded again.
+func (p *changePrinter) print(ctx context.Context, change events.NodeStateChanged) {
+	node, exists := p.graph.GetNode(change.Node.ID)
+	if !exists {
+		if g, err := p.backend.LoadGraph(ctx, appName); err == nil {
+			p.graph = g
+			node, exists = g.GetNode(change.Node.ID)
+		}
+	}
+	nodeType := graph.NodeType("unknown")
+	if exists {
+		nodeType = node.Type
+	}
+
+	if len(filterTypes) > 0 && !slices.Contains(filterTypes, string(nodeType)) {
+		return
+	}
+	if len(filterStates) > 0 && !slices.Contains(filterStates, string(change.NewState)) {
+		return
+	}
+	switch {
+	case p.structured:
+		if err := printStreamed(watchedChange{
+			AppName:  change.AppName,
+			NodeID:   change.Node.ID,
+			NodeType: nodeType,
+			OldState: change.OldState,
+			NewState: change.NewState,
+			Time:     change.At,
+		}); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to print change of node %s: %v\n", change.Node.ID, err)
+		}
+	case wideOutput():
+		fmt.Printf("%s %s (%s) %s -> %s\n", change.At.Local().Format(time.RFC3339Nano), change.Node.ID, nodeType, change.OldState, change.NewState)
+	default:
+		fmt.Printf("%s %s (%s) %s -> %s\n", change.At.Local().Format("15:04:05"), change.Node.ID, nodeType, change.OldState, change.NewState)
+	}
+}
@@ -1,15 +1,17 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 
-	"idp-orchestrator/internal/config"
+	"github.com/philipsahli/innominatus-graph/internal/config"
 
 	"github.com/philipsahli/innominatus-graph/pkg/storage"
 
 	"github.com/philipsahli/innominatus-graph/pkg/export"
+	graphpkg "github.com/philipsahli/innominatus-graph/pkg/graph"
 
 	"github.com/spf13/cobra"
 )
@@ -23,30 +25,196 @@ var graphCmd = &cobra.Command{
 var exportCmd = &cobra.Command{
 	Use:   "export",
 	Short: "Export graph to various formats",
-	Long:  `Export a graph to DOT, SVG, or PNG format`,
+	Long:  `Export a graph to DOT, SVG, PNG, PDF, Mermaid flowchart and Gantt, PlantUML, D2, JSON, GraphML, Cytoscape.js, D3, Grafana Node Graph, draw.io, CSV, TSV, HTML or Backstage catalog format`,
 	RunE:  runExport,
 }
 
+var deleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete an application graph",
+	Long:  `Delete an application together with its nodes, edges and runs, or only its graph`,
+	RunE:  runDelete,
+}
+
+var dumpCmd = &cobra.Command{
+	Use:   "dump",
+	Short: "Dump an application to a snapshot file",
+	Long:  `Write an application with its graph, runs and node state history to a portable JSON snapshot`,
+	RunE:  runDump,
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore an application from a snapshot file",
+	Long:  `Recreate an application from a JSON snapshot written by the dump command`,
+	RunE:  runRestore,
+}
+
 var (
 	appName    string
 	format     string
 	outputFile string
+	inputFile  string
 	nodeIDs    []string
+	graphOnly  bool
+	softDelete bool
+	dotOptions export.DOTExportOptions
+	csvOptions export.CSVOptions
+	pdfOptions export.PDFOptions
+
+	withChildren bool
+	exportFilter export.Filter
+	exportReduce export.Reduce
+	filterTypes  []string
+	filterStates []string
+	themeName    string
+	themeFile    string
+	stamp        bool
+	stampRunID   string
 )
 
 func init() {
 	graphCmd.AddCommand(exportCmd)
+	graphCmd.AddCommand(deleteCmd)
+	graphCmd.AddCommand(dumpCmd)
+	graphCmd.AddCommand(restoreCmd)
+
+	dumpCmd.Flags().StringVar(&appName, "app", "", "application name (required)")
+	dumpCmd.Flags().StringVar(&outputFile, "output", "", "snapshot file path (default: stdout)")
+	dumpCmd.MarkFlagRequired("app")
+
+	restoreCmd.Flags().StringVar(&inputFile, "input", "", "snapshot file path (required)")
+	restoreCmd.MarkFlagRequired("input")
+
+	deleteCmd.Flags().StringVar(&appName, "app", "", "application name (required)")
+	deleteCmd.Flags().BoolVar(&graphOnly, "graph-only", false, "delete nodes and edges but keep the app and its runs")
+	deleteCmd.Flags().BoolVar(&softDelete, "soft", false, "mark the app as deleted instead of removing it")
+	deleteCmd.MarkFlagRequired("app")
 
 	exportCmd.Flags().StringVar(&appName, "app", "", "application name (required)")
-	exportCmd.Flags().StringVar(&format, "format", "dot", "output format: dot, svg, png")
-	exportCmd.Flags().StringVar(&outputFile, "output", "", "output file path (default: stdout for DOT)")
+	exportCmd.Flags().StringVar(&format, "format", "dot", "output format: dot, svg, svg-native, png, pdf, mermaid, mermaid-gantt, plantuml, d2, json, graphml, cytoscape, d3, grafana, drawio, csv, tsv, html, backstage")
+	exportCmd.Flags().StringVar(&outputFile, "output", "", "output file path, or a directory for csv and tsv tables (default: stdout)")
 	exportCmd.Flags().StringSliceVar(&nodeIDs, "nodes", nil, "specific node IDs to include in export")
+	exportCmd.Flags().BoolVar(&withChildren, "with-children", false, "also export the steps of workflows given in --nodes")
+	exportCmd.Flags().BoolVar(&dotOptions.StateFill, "state-fill", false, "fill nodes by execution state (dot, svg, png, pdf)")
+	exportCmd.Flags().BoolVar(&dotOptions.Badges, "badges", false, "show state badges in node labels (dot, svg, png, pdf)")
+	exportCmd.Flags().BoolVar(&dotOptions.Durations, "durations", false, "show node durations (dot, svg, png, pdf)")
+	exportCmd.Flags().BoolVar(&dotOptions.Legend, "legend", false, "add a color legend (dot, svg, png, pdf)")
+	exportCmd.Flags().BoolVar(&dotOptions.Clusters, "clusters", false, "draw contained steps inside their workflow (dot, svg, png, pdf)")
+	exportCmd.Flags().StringVar(&pdfOptions.PageSize, "page-size", "A4", "page size: A4, A3, Letter (pdf)")
+	exportCmd.Flags().BoolVar(&pdfOptions.Landscape, "landscape", false, "use landscape pages (pdf)")
+	exportCmd.Flags().StringSliceVar(&csvOptions.NodeColumns, "node-columns", nil, "node columns, e.g. id,name,property.region (csv, tsv)")
+	exportCmd.Flags().StringSliceVar(&csvOptions.EdgeColumns, "edge-columns", nil, "edge columns (csv, tsv)")
+	exportCmd.Flags().StringSliceVar(&filterTypes, "types", nil, "only export nodes of these types, e.g. resource,workflow")
+	exportCmd.Flags().StringSliceVar(&filterStates, "states", nil, "only export nodes in these states, e.g. failed")
+	exportCmd.Flags().StringVar(&exportFilter.Selector, "selector", "", "only export nodes whose properties match, e.g. team=payments,tier!=test")
+	exportCmd.Flags().StringVar(&themeName, "theme", "", "color theme: light, dark, colorblind (dot, svg, png, pdf, mermaid)")
+	exportCmd.Flags().StringVar(&themeFile, "theme-file", "", "JSON file with theme overrides (dot, svg, png, pdf, mermaid)")
+	exportCmd.Flags().BoolVar(&stamp, "stamp", false, "add a footer with graph version and export time (dot, svg, svg-native, png, pdf, mermaid, plantuml, d2, html)")
+	exportCmd.Flags().StringVar(&stampRunID, "run-id", "", "run ID shown in the --stamp footer")
+	exportCmd.Flags().StringVar(&exportReduce.Focus, "focus", "", "only export nodes connected to this node")
+	exportCmd.Flags().IntVar(&exportReduce.Depth, "depth", 0, "with --focus, only export nodes at most this many edges away (0: no limit)")
+	exportCmd.Flags().BoolVar(&exportReduce.CollapseWorkflows, "collapse-workflows", false, "draw each workflow and its steps as one node")
+	exportCmd.Flags().BoolVar(&exportReduce.AggregateEdges, "aggregate-edges", false, "merge edges of the same type between the same nodes")
+	exportCmd.Flags().IntVar(&exportReduce.MaxEdges, "max-edges", 0, "export at most this many edges, sampled evenly (0: no limit)")
+	exportCmd.Flags().BoolVar(&exportFilter.WithDependencies, "with-dependencies", false, "also export everything the --nodes or filtered nodes depend on, contain or provision")
 
 	exportCmd.MarkFlagRequired("app")
 }
 
-func runExport(cmd *cobra.Command, args []string) error {
-	cfg := storage.Config{
+func runDelete(cmd *cobra.Command, args []string) error {
+	db, err := storage.NewConnection(databaseConfig())
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+	defer sqlDB.Close()
+
+	repository := storage.NewRepository(db)
+
+	if graphOnly {
+		if err := repository.DeleteGraph(appName); err != nil {
+			return fmt.Errorf("failed to delete graph for app %s: %w", appName, err)
+		}
+		fmt.Printf("Graph of app %s deleted\n", appName)
+		return nil
+	}
+
+	if err := repository.DeleteApp(appName, storage.DeleteOptions{Soft: softDelete}); err != nil {
+		return fmt.Errorf("failed to delete app %s: %w", appName, err)
+	}
+	fmt.Printf("App %s deleted\n", appName)
+	return nil
+}
+
+func runDump(cmd *cobra.Command, args []string) error {
+	db, err := storage.NewConnection(databaseConfig())
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+	defer sqlDB.Close()
+
+	repository := storage.NewRepository(db)
+
+	var writer io.Writer = os.Stdout
+	if outputFile != "" {
+		file, err := os.Create(outputFile)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer file.Close()
+		writer = file
+	}
+
+	if err := repository.DumpApp(appName, writer); err != nil {
+		return fmt.Errorf("failed to dump app %s: %w", appName, err)
+	}
+	if outputFile != "" {
+		fmt.Printf("App %s dumped to %s\n", appName, outputFile)
+	}
+	return nil
+}
+
+func runRestore(cmd *cobra.Command, args []string) error {
+	db, err := storage.NewConnection(databaseConfig())
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+	defer sqlDB.Close()
+
+	repository := storage.NewRepository(db)
+
+	file, err := os.Open(inputFile)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer file.Close()
+
+	restored, err := repository.RestoreAppSnapshot(file)
+	if err != nil {
+		return fmt.Errorf("failed to restore snapshot %s: %w", inputFile, err)
+	}
+	fmt.Printf("App %s restored from %s\n", restored, inputFile)
+	return nil
+}
+
+func databaseConfig() storage.Config {
+	return storage.Config{
+		Type:     storage.DatabaseTypePostgres,
 		Host:     config.DatabaseHost,
 		Port:     config.DatabasePort,
 		User:     config.DatabaseUser,
@@ -54,6 +222,10 @@ func runExport(cmd *cobra.Command, args []string) error {
 		DBName:   config.DatabaseName,
 		SSLMode:  "disable",
 	}
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	cfg := databaseConfig()
 
 	db, err := storage.NewConnection(cfg)
 	if err != nil {
@@ -77,25 +249,65 @@ func runExport(cmd *cobra.Command, args []string) error {
 
 	exportGraph := graph
 	if len(nodeIDs) > 0 {
-		exportGraph, err = exporter.CreateSubgraph(graph, nodeIDs)
+		exportGraph, err = exporter.CreateSubgraphWithOptions(graph, nodeIDs, export.SubgraphOptions{
+			WithDependencies: exportFilter.WithDependencies,
+			WithChildren:     withChildren,
+		})
 		if err != nil {
 			return fmt.Errorf("failed to create subgraph: %w", err)
 		}
 	}
 
-	var exportFormat export.Format
-	switch format {
-	case "dot":
-		exportFormat = export.FormatDOT
-	case "svg":
-		exportFormat = export.FormatSVG
-	case "png":
-		exportFormat = export.FormatPNG
-	default:
-		return fmt.Errorf("unsupported format: %s (supported: dot, svg, png)", format)
+	exportFormat, err := export.ParseFormat(format)
+	if err != nil {
+		return err
+	}
+
+	filter := exportFilter
+	for _, t := range filterTypes {
+		filter.Types = append(filter.Types, graphpkg.NodeType(t))
+	}
+	for _, s := range filterStates {
+		filter.States = append(filter.States, graphpkg.NodeState(s))
+	}
+	exportGraph, err = filter.Apply(exportGraph)
+	if err != nil {
+		return fmt.Errorf("invalid filter: %w", err)
+	}
+	exportGraph, err = exportReduce.Apply(exportGraph)
+	if err != nil {
+		return fmt.Errorf("failed to reduce graph: %w", err)
+	}
+
+	// CSV and TSV exports to a directory write the node and edge tables as
+	// separate files instead of a zip archive
+	if exportFormat == export.FormatCSV || exportFormat == export.FormatTSV {
+		if info, err := os.Stat(outputFile); err == nil && info.IsDir() {
+			opts := csvOptions
+			opts.TSV = exportFormat == export.FormatTSV
+			files, err := export.ExportGraphCSV(exportGraph, opts)
+			if err != nil {
+				return fmt.Errorf("failed to export graph: %w", err)
+			}
+			if err := files.WriteDir(outputFile); err != nil {
+				return err
+			}
+			fmt.Printf("Graph exported to %s and %s in %s\n", files.NodesFileName(), files.EdgesFileName(), outputFile)
+			return nil
+		}
+	}
+
+	theme, err := exportTheme()
+	if err != nil {
+		return err
+	}
+
+	opts := export.Options{Theme: theme, DOT: dotOptions, CSV: csvOptions, PDF: pdfOptions}
+	if stamp || stampRunID != "" {
+		opts.Stamp = &export.Stamp{RunID: stampRunID}
 	}
 
-	data, err := exporter.ExportGraph(exportGraph, exportFormat)
+	data, err := exporter.ExportGraphWithOptions(exportGraph, exportFormat, opts)
 	if err != nil {
 		return fmt.Errorf("failed to export graph: %w", err)
 	}
@@ -120,3 +332,29 @@ func runExport(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// exportTheme reads the theme set by --theme-file and --theme; the name
+// given by --theme replaces one set in the file
+func exportTheme() (*export.Theme, error) {
+	if themeName == "" && themeFile == "" {
+		return nil, nil
+	}
+
+	theme := &export.Theme{}
+	if themeFile != "" {
+		data, err := os.ReadFile(themeFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read theme file: %w", err)
+		}
+		if err := json.Unmarshal(data, theme); err != nil {
+			return nil, fmt.Errorf("failed to parse theme file %s: %w", themeFile, err)
+		}
+	}
+	if themeName != "" {
+		theme.Name = themeName
+	}
+	if _, err := export.ResolveTheme(theme); err != nil {
+		return nil, err
+	}
+	return theme, nil
+}
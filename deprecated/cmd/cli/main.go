@@ -6,7 +6,7 @@ import (
 	"os"
 	"path/filepath"
 
-	"idp-orchestrator/internal/config"
+	"github.com/philipsahli/innominatus-graph/internal/config"
 
 	"github.com/spf13/cobra"
 	_ "github.com/jackc/pgx/v5/stdlib"
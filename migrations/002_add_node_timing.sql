@@ -0,0 +1,8 @@
+BEGIN;
+
+-- Node execution timing (kept in sync by storage.AutoMigrate for GORM-managed databases)
+ALTER TABLE graph_nodes ADD COLUMN IF NOT EXISTS started_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE graph_nodes ADD COLUMN IF NOT EXISTS completed_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE graph_nodes ADD COLUMN IF NOT EXISTS duration_ms BIGINT NOT NULL DEFAULT 0;
+
+COMMIT;
@@ -0,0 +1,29 @@
+BEGIN;
+
+-- Tenants (kept in sync by storage.AutoMigrate for GORM-managed databases)
+CREATE TABLE IF NOT EXISTS graph_tenants (
+    id CHAR(36) PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_graph_tenants_name ON graph_tenants(name);
+
+-- Existing apps belong to the default tenant
+INSERT INTO graph_tenants (id, name)
+VALUES ('00000000-0000-0000-0000-000000000000', 'default')
+ON CONFLICT (id) DO NOTHING;
+
+ALTER TABLE graph_apps ADD COLUMN IF NOT EXISTS tenant_id CHAR(36) NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000';
+ALTER TABLE graph_nodes ADD COLUMN IF NOT EXISTS tenant_id CHAR(36) NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000';
+ALTER TABLE graph_edges ADD COLUMN IF NOT EXISTS tenant_id CHAR(36) NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000';
+ALTER TABLE graph_runs ADD COLUMN IF NOT EXISTS tenant_id CHAR(36) NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000';
+
+CREATE INDEX IF NOT EXISTS idx_graph_nodes_tenant_id ON graph_nodes(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_graph_edges_tenant_id ON graph_edges(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_graph_runs_tenant_id ON graph_runs(tenant_id);
+
+-- App names are unique per tenant instead of globally
+ALTER TABLE graph_apps DROP CONSTRAINT IF EXISTS uni_graph_apps_name;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_graph_apps_tenant_name ON graph_apps(tenant_id, name);
+
+COMMIT;
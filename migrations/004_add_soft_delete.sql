@@ -0,0 +1,10 @@
+BEGIN;
+
+-- Nodes and edges removed from a graph are soft-deleted
+ALTER TABLE graph_nodes ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE graph_edges ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_graph_nodes_deleted_at ON graph_nodes(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_graph_edges_deleted_at ON graph_edges(deleted_at);
+
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN;
+
+-- Ownership and context shown next to the dependency graph
+ALTER TABLE graph_apps ADD COLUMN IF NOT EXISTS owner VARCHAR(255);
+ALTER TABLE graph_apps ADD COLUMN IF NOT EXISTS team VARCHAR(255);
+ALTER TABLE graph_apps ADD COLUMN IF NOT EXISTS links TEXT;
+ALTER TABLE graph_apps ADD COLUMN IF NOT EXISTS annotations TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_graph_apps_owner ON graph_apps(owner);
+CREATE INDEX IF NOT EXISTS idx_graph_apps_team ON graph_apps(team);
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+-- Replicas claim queued runs and record which of them executes each run
+ALTER TABLE graph_runs ADD COLUMN IF NOT EXISTS claimed_by VARCHAR(255);
+ALTER TABLE graph_runs ADD COLUMN IF NOT EXISTS claimed_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_graph_runs_queue ON graph_runs(status, started_at);
+
+COMMIT;
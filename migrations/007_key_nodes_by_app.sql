@@ -0,0 +1,17 @@
+BEGIN;
+
+-- Node and edge IDs are unique per app instead of globally, so that apps of
+-- any tenant can use the same IDs (kept in sync by storage.AutoMigrate for
+-- GORM-managed databases)
+ALTER TABLE graph_edges DROP CONSTRAINT IF EXISTS fk_graph_edges_from_node;
+ALTER TABLE graph_edges DROP CONSTRAINT IF EXISTS fk_graph_edges_to_node;
+
+ALTER TABLE graph_nodes DROP CONSTRAINT graph_nodes_pkey, ADD PRIMARY KEY (app_id, id);
+ALTER TABLE graph_edges DROP CONSTRAINT graph_edges_pkey, ADD PRIMARY KEY (app_id, id);
+
+ALTER TABLE graph_edges ADD CONSTRAINT fk_graph_edges_from_node
+    FOREIGN KEY (app_id, from_node_id) REFERENCES graph_nodes(app_id, id) ON DELETE CASCADE;
+ALTER TABLE graph_edges ADD CONSTRAINT fk_graph_edges_to_node
+    FOREIGN KEY (app_id, to_node_id) REFERENCES graph_nodes(app_id, id) ON DELETE CASCADE;
+
+COMMIT;
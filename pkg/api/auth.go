@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader carries the API key of automation clients
+const APIKeyHeader = "X-API-Key"
+
+// Authentication methods of an Identity
+const (
+	AuthMethodAPIKey = "api-key"
+	AuthMethodOIDC   = "oidc"
+)
+
+// Identity is the authenticated caller of a request
+type Identity struct {
+	Name   string   `json:"name"`             // Recorded as the actor in the audit log
+	Method string   `json:"method"`           // AuthMethodAPIKey or AuthMethodOIDC
+	Groups []string `json:"groups,omitempty"` // Groups of the token, matched by role bindings
+}
+
+// Authenticator checks the credentials of a request. It returns nil and no
+// error for requests without credentials it handles, so that authenticators
+// can be chained, and an error for credentials it rejects.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// ChainAuthenticators returns an Authenticator that asks each of
+// authenticators in turn and uses the first identity found
+func ChainAuthenticators(authenticators ...Authenticator) Authenticator {
+	return authenticatorChain(authenticators)
+}
+
+type authenticatorChain []Authenticator
+
+func (chain authenticatorChain) Authenticate(r *http.Request) (*Identity, error) {
+	for _, authenticator := range chain {
+		identity, err := authenticator.Authenticate(r)
+		if err != nil || identity != nil {
+			return identity, err
+		}
+	}
+	return nil, nil
+}
+
+// APIKeyAuthenticator authenticates automation with static API keys sent
+// in APIKeyHeader
+type APIKeyAuthenticator struct {
+	keys map[[sha256.Size]byte]string // SHA-256 of the key to its name
+}
+
+// NewAPIKeyAuthenticator accepts the keys of names, given as name to key
+func NewAPIKeyAuthenticator(keys map[string]string) *APIKeyAuthenticator {
+	authenticator := &APIKeyAuthenticator{keys: make(map[[sha256.Size]byte]string, len(keys))}
+	for name, key := range keys {
+		authenticator.keys[sha256.Sum256([]byte(key))] = name
+	}
+	return authenticator
+}
+
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, nil
+	}
+
+	// Compare hashes in constant time so that response times do not
+	// reveal how much of a key matched
+	hash := sha256.Sum256([]byte(key))
+	name, found := "", false
+	for known, knownName := range a.keys {
+		if subtle.ConstantTimeCompare(hash[:], known[:]) == 1 {
+			name, found = knownName, true
+		}
+	}
+	if !found {
+		return nil, errors.New("invalid API key")
+	}
+	return &Identity{Name: name, Method: AuthMethodAPIKey}, nil
+}
+
+// OIDCAuthenticator authenticates users with ID tokens of an OpenID
+// Connect provider, sent as "Authorization: Bearer <token>"
+type OIDCAuthenticator struct {
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDCAuthenticator accepts tokens issued by issuerURL for clientID. It
+// fetches the provider's discovery document and verifies token signatures
+// with the provider's published keys.
+func NewOIDCAuthenticator(ctx context.Context, issuerURL, clientID string) (*OIDCAuthenticator, error) {
+	provider, err := oidc.NewProvider(ctx, issuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider: %w", err)
+	}
+	return &OIDCAuthenticator{verifier: provider.Verifier(&oidc.Config{ClientID: clientID})}, nil
+}
+
+func (a *OIDCAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, nil
+	}
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return nil, errors.New("unsupported authorization scheme")
+	}
+
+	idToken, err := a.verifier.Verify(r.Context(), strings.TrimSpace(token))
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	var claims struct {
+		Email             string   `json:"email"`
+		PreferredUsername string   `json:"preferred_username"`
+		Groups            []string `json:"groups"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+
+	name := idToken.Subject
+	switch {
+	case claims.Email != "":
+		name = claims.Email
+	case claims.PreferredUsername != "":
+		name = claims.PreferredUsername
+	}
+	return &Identity{Name: name, Method: AuthMethodOIDC, Groups: claims.Groups}, nil
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying identity
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the identity stored in ctx, or nil for
+// anonymous requests
+func IdentityFromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityKey{}).(*Identity)
+	return identity
+}
+
+// AuthMiddleware authenticates requests carrying credentials, storing the
+// identity in the request context and as the actor of the audit log in
+// place of ActorHeader. Requests with rejected credentials are answered
+// with 401; requests without credentials continue anonymously, use
+// RequireIdentity on the routes that need an identity.
+func AuthMiddleware(authenticator Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity, err := authenticator.Authenticate(c.Request)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed: " + err.Error()})
+			return
+		}
+		if identity != nil {
+			ctx := WithIdentity(c.Request.Context(), identity)
+			c.Request = c.Request.WithContext(storage.WithActor(ctx, identity.Name))
+		}
+		c.Next()
+	}
+}
+
+// RequireIdentity answers requests that AuthMiddleware did not
+// authenticate with 401
+func RequireIdentity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if IdentityFromContext(c.Request.Context()) == nil {
+			c.Header("WWW-Authenticate", `Bearer realm="innominatus-graph"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testProvider is an OpenID Connect provider signing ID tokens with a
+// generated key
+type testProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	provider := &testProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                provider.URL,
+			"authorization_endpoint":                provider.URL + "/authorize",
+			"token_endpoint":                        provider.URL + "/token",
+			"jwks_uri":                              provider.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	provider.Server = httptest.NewServer(mux)
+	t.Cleanup(provider.Close)
+	return provider
+}
+
+// token returns an ID token for clientID with claims, valid for an hour
+// unless claims set exp, signed with key or, if nil, the provider's key
+func (p *testProvider) token(t *testing.T, clientID string, claims map[string]interface{}, key *rsa.PrivateKey) string {
+	t.Helper()
+	if key == nil {
+		key = p.key
+	}
+	payload := map[string]interface{}{
+		"iss": p.URL,
+		"aud": clientID,
+		"sub": "user-1",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for claim, value := range claims {
+		payload[claim] = value
+	}
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"}) + "." + encode(payload)
+	hash := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	authenticator := NewAPIKeyAuthenticator(map[string]string{"ci": "ci-key", "deployer": "deploy-key"})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	identity, err := authenticator.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Nil(t, identity, "no key, left to the next authenticator")
+
+	req.Header.Set(APIKeyHeader, "deploy-key")
+	identity, err = authenticator.Authenticate(req)
+	require.NoError(t, err)
+	assert.Equal(t, &Identity{Name: "deployer", Method: AuthMethodAPIKey}, identity)
+
+	req.Header.Set(APIKeyHeader, "deploy-ke")
+	_, err = authenticator.Authenticate(req)
+	assert.EqualError(t, err, "invalid API key")
+}
+
+func TestOIDCAuthenticator(t *testing.T) {
+	provider := newTestProvider(t)
+	authenticator, err := NewOIDCAuthenticator(context.Background(), provider.URL, "graph")
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		header  string
+		want    *Identity
+		wantErr string
+	}{
+		{name: "no header"},
+		{
+			name:   "email",
+			header: "Bearer " + provider.token(t, "graph", map[string]interface{}{"email": "alice@example.com", "groups": []string{"platform"}}, nil),
+			want:   &Identity{Name: "alice@example.com", Method: AuthMethodOIDC, Groups: []string{"platform"}},
+		},
+		{
+			name:   "preferred username",
+			header: "bearer " + provider.token(t, "graph", map[string]interface{}{"preferred_username": "alice"}, nil),
+			want:   &Identity{Name: "alice", Method: AuthMethodOIDC},
+		},
+		{
+			name:   "subject",
+			header: "Bearer " + provider.token(t, "graph", nil, nil),
+			want:   &Identity{Name: "user-1", Method: AuthMethodOIDC},
+		},
+		{name: "basic auth", header: "Basic YWxpY2U6c2VjcmV0", wantErr: "unsupported authorization scheme"},
+		{name: "not a token", header: "Bearer abc", wantErr: "invalid token"},
+		{name: "other client", header: "Bearer " + provider.token(t, "portal", nil, nil), wantErr: "invalid token"},
+		{
+			name:    "expired",
+			header:  "Bearer " + provider.token(t, "graph", map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()}, nil),
+			wantErr: "invalid token",
+		},
+		{name: "signed with other key", header: "Bearer " + provider.token(t, "graph", nil, otherKey), wantErr: "invalid token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			identity, err := authenticator.Authenticate(req)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, identity)
+		})
+	}
+
+	_, err = NewOIDCAuthenticator(context.Background(), provider.URL+"/unknown", "graph")
+	assert.ErrorContains(t, err, "failed to discover OIDC provider")
+}
+
+func TestAuthMiddleware_Chain(t *testing.T) {
+	provider := newTestProvider(t)
+	oidcAuthenticator, err := NewOIDCAuthenticator(context.Background(), provider.URL, "graph")
+	require.NoError(t, err)
+	token := provider.token(t, "graph", map[string]interface{}{"email": "alice@example.com"}, nil)
+
+	repo := newTestRepository(t)
+	h := NewRESTHandler(repo)
+	defer h.Close()
+	h.SetAuthenticator(ChainAuthenticators(NewAPIKeyAuthenticator(map[string]string{"ci": "ci-key"}), oidcAuthenticator), false)
+	server := startTestServer(t, h)
+	metadata := map[string]string{"owner": "team-a"}
+	path := "/api/v1/apps/" + testApp + "/metadata"
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+		actor   string // Recorded in the audit log
+		error   string
+	}{
+		{name: "no credentials", status: http.StatusUnauthorized, error: "Authentication required"},
+		{name: "actor header is not an identity", headers: map[string]string{ActorHeader: "mallory"}, status: http.StatusUnauthorized},
+		{name: "API key", headers: map[string]string{APIKeyHeader: "ci-key"}, status: http.StatusOK, actor: "ci"},
+		{name: "ID token", headers: map[string]string{"Authorization": "Bearer " + token}, status: http.StatusOK, actor: "alice@example.com"},
+		{
+			name:    "identity replaces the actor header",
+			headers: map[string]string{"Authorization": "Bearer " + token, ActorHeader: "mallory"},
+			status:  http.StatusOK,
+			actor:   "alice@example.com",
+		},
+		{
+			name:    "API key first",
+			headers: map[string]string{APIKeyHeader: "ci-key", "Authorization": "Bearer " + token},
+			status:  http.StatusOK,
+			actor:   "ci",
+		},
+		{
+			name:    "invalid API key is not ignored",
+			headers: map[string]string{APIKeyHeader: "wrong", "Authorization": "Bearer " + token},
+			status:  http.StatusUnauthorized,
+			error:   "Authentication failed: invalid API key",
+		},
+		{name: "invalid token", headers: map[string]string{"Authorization": "Bearer abc"}, status: http.StatusUnauthorized, error: "Authentication failed: invalid token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, server, http.MethodPut, path, metadata, tt.headers)
+			assert.Equal(t, tt.status, resp.StatusCode, string(resp.Body))
+			if tt.error != "" {
+				assert.Contains(t, string(resp.Body), tt.error)
+			}
+			if tt.actor == "" {
+				return
+			}
+			entries, err := repo.GetAuditLog(storage.AuditFilter{AppName: testApp, Actor: tt.actor, Action: storage.AuditActionSetAppMetadata})
+			require.NoError(t, err)
+			assert.NotEmpty(t, entries)
+		})
+	}
+	entries, err := repo.GetAuditLog(storage.AuditFilter{Actor: "mallory"})
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
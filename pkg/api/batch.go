@@ -0,0 +1,91 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBatchApps is the largest number of apps of a batch request
+const maxBatchApps = 100
+
+// BatchGetGraphsRequest names the apps whose graphs to return
+type BatchGetGraphsRequest struct {
+	Apps []string `json:"apps" binding:"required"`
+	// SummaryOnly returns node and edge counts and node states instead of
+	// the full graphs
+	SummaryOnly bool `json:"summary_only"`
+}
+
+// BatchGraphResult is the graph or summary of one app of a batch request,
+// or why it could not be returned
+type BatchGraphResult struct {
+	AppName string                `json:"app_name"`
+	Status  int                   `json:"status"` // HTTP status of the app's GET /graph
+	Version int                   `json:"version,omitempty"`
+	Graph   *graph.Graph          `json:"graph,omitempty"`
+	Summary *storage.GraphSummary `json:"summary,omitempty"`
+	Error   string                `json:"error,omitempty"`
+}
+
+// BatchGetGraphsResponse holds a result per requested app, in request order
+type BatchGetGraphsResponse struct {
+	Graphs []BatchGraphResult `json:"graphs"`
+}
+
+// GraphsMethod dispatches the custom methods of the graphs collection,
+// POST /graphs:<method>
+func (h *RESTHandler) GraphsMethod(c *gin.Context) {
+	switch c.Param("method") {
+	case ":batchGet":
+		h.BatchGetGraphs(c)
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown method"})
+	}
+}
+
+// BatchGetGraphs returns the graphs of several apps in one response, e.g.
+// for portal pages showing many apps. Apps that do not exist or that the
+// caller may not view fail on their own with their status and error; the
+// request only fails as a whole if it is invalid.
+func (h *RESTHandler) BatchGetGraphs(c *gin.Context) {
+	var req BatchGetGraphsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	if len(req.Apps) == 0 || len(req.Apps) > maxBatchApps {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: between 1 and %d apps are required", maxBatchApps)})
+		return
+	}
+
+	ctx := c.Request.Context()
+	repository := h.repo(c)
+	results := make([]BatchGraphResult, 0, len(req.Apps))
+	for _, appName := range req.Apps {
+		result := BatchGraphResult{AppName: appName, Status: http.StatusOK}
+		if err := authorize(ctx, h.authorizer, appName, RoleViewer); err != nil {
+			result.Status, result.Error = http.StatusForbidden, err.Error()
+		} else if req.SummaryOnly {
+			summary, err := repository.LoadGraphSummary(appName)
+			if err != nil {
+				result.Status, result.Error = http.StatusNotFound, "Graph not found: "+err.Error()
+			}
+			result.Summary = summary
+		} else {
+			g, err := repository.LoadGraph(appName)
+			if err != nil {
+				result.Status, result.Error = http.StatusNotFound, "Graph not found: "+err.Error()
+			} else {
+				result.Graph, result.Version = g, g.Version
+			}
+		}
+		results = append(results, result)
+	}
+
+	c.JSON(http.StatusOK, BatchGetGraphsResponse{Graphs: results})
+}
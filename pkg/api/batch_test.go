@@ -0,0 +1,135 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchGetGraphs_Authorization(t *testing.T) {
+	repo := newTestRepository(t)
+	for _, app := range []string{"billing", "payroll"} {
+		require.NoError(t, repo.SaveGraph(app, newTestGraph(app)))
+	}
+	authorizer, err := NewAuthorizer([]RoleBinding{
+		{Subject: "vera", Role: RoleViewer, App: testApp},
+		{Subject: "eddie", Role: RoleEditor, App: "billing"},
+		{Subject: "olga", Role: RoleOperator},
+	})
+	require.NoError(t, err)
+	h := NewRESTHandler(repo)
+	defer h.Close()
+	h.SetAuthenticator(NewAPIKeyAuthenticator(testKeys), true)
+	h.SetAuthorizer(authorizer)
+	server := startTestServer(t, h)
+	apps := []string{testApp, "billing", "payroll", "missing"}
+
+	denied := func(app string) string {
+		return "access denied: viewer role on app " + app + " required"
+	}
+	tests := []struct {
+		caller   string // Anonymous if empty
+		statuses []int  // By app
+		errors   []string
+	}{
+		{
+			caller:   "vera",
+			statuses: []int{http.StatusOK, http.StatusForbidden, http.StatusForbidden, http.StatusForbidden},
+			errors:   []string{"", denied("billing"), denied("payroll"), denied("missing")},
+		},
+		{
+			// Higher roles include viewer
+			caller:   "eddie",
+			statuses: []int{http.StatusForbidden, http.StatusOK, http.StatusForbidden, http.StatusForbidden},
+			errors:   []string{denied(testApp), "", denied("payroll"), denied("missing")},
+		},
+		{
+			// Only callers who may view an app learn whether it exists
+			caller:   "olga",
+			statuses: []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusNotFound},
+		},
+		{
+			caller:   "stranger",
+			statuses: []int{http.StatusForbidden, http.StatusForbidden, http.StatusForbidden, http.StatusForbidden},
+			errors:   []string{denied(testApp), denied("billing"), denied("payroll"), denied("missing")},
+		},
+		{
+			statuses: []int{http.StatusForbidden, http.StatusForbidden, http.StatusForbidden, http.StatusForbidden},
+			errors:   []string{denied(testApp), denied("billing"), denied("payroll"), denied("missing")},
+		},
+	}
+	for _, tt := range tests {
+		name := tt.caller
+		if name == "" {
+			name = "anonymous"
+		}
+		t.Run(name, func(t *testing.T) {
+			headers := map[string]string{}
+			if tt.caller != "" {
+				headers[APIKeyHeader] = testKeys[tt.caller]
+			}
+			for _, summaryOnly := range []bool{false, true} {
+				resp := doRequest(t, server, http.MethodPost, "/api/v1/graphs:batchGet", BatchGetGraphsRequest{Apps: apps, SummaryOnly: summaryOnly}, headers)
+				require.Equal(t, http.StatusOK, resp.StatusCode, "the batch succeeds as a whole: %s", resp.Body)
+				var body BatchGetGraphsResponse
+				resp.decode(t, &body)
+				require.Len(t, body.Graphs, len(apps))
+
+				for i, result := range body.Graphs {
+					assert.Equal(t, apps[i], result.AppName, "in request order")
+					assert.Equal(t, tt.statuses[i], result.Status, "status of %s", result.AppName)
+					switch result.Status {
+					case http.StatusOK:
+						assert.Empty(t, result.Error)
+						if summaryOnly {
+							assert.Nil(t, result.Graph)
+							require.NotNil(t, result.Summary, result.AppName)
+						} else {
+							require.NotNil(t, result.Graph, result.AppName)
+							assert.Len(t, result.Graph.Nodes, 2)
+							assert.Nil(t, result.Summary)
+						}
+					case http.StatusForbidden:
+						assert.Equal(t, tt.errors[i], result.Error)
+						assert.Nil(t, result.Graph, "no graph of %s", result.AppName)
+						assert.Nil(t, result.Summary, "no summary of %s", result.AppName)
+					case http.StatusNotFound:
+						assert.Contains(t, result.Error, "Graph not found")
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBatchGetGraphs_InvalidRequests(t *testing.T) {
+	h := NewRESTHandler(newTestRepository(t))
+	defer h.Close()
+	server := startTestServer(t, h)
+
+	tooMany := make([]string, maxBatchApps+1)
+	for i := range tooMany {
+		tooMany[i] = testApp
+	}
+	tests := []struct {
+		name   string
+		path   string
+		body   interface{}
+		status int
+		error  string
+	}{
+		{name: "no apps", path: "/api/v1/graphs:batchGet", body: map[string]interface{}{}, status: http.StatusBadRequest, error: "Invalid request"},
+		{name: "empty apps", path: "/api/v1/graphs:batchGet", body: BatchGetGraphsRequest{Apps: []string{}}, status: http.StatusBadRequest, error: "between 1 and 100 apps are required"},
+		{name: "too many apps", path: "/api/v1/graphs:batchGet", body: BatchGetGraphsRequest{Apps: tooMany}, status: http.StatusBadRequest, error: "between 1 and 100 apps are required"},
+		{name: "unknown method", path: "/api/v1/graphs:batchDelete", body: BatchGetGraphsRequest{Apps: []string{testApp}}, status: http.StatusNotFound, error: "Unknown method"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, server, http.MethodPost, tt.path, tt.body, nil)
+			assert.Equal(t, tt.status, resp.StatusCode)
+			assert.Contains(t, string(resp.Body), tt.error)
+		})
+	}
+}
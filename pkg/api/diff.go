@@ -0,0 +1,71 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/philipsahli/innominatus-graph/pkg/export"
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DiffResponse is the difference between the stored graph of an app and a
+// candidate graph
+type DiffResponse struct {
+	AppName string `json:"app_name"`
+	// Version of the stored graph the candidate was compared with
+	Version int              `json:"version"`
+	Changed bool             `json:"changed"`
+	Diff    *graph.GraphDiff `json:"diff"`
+}
+
+// DiffGraph compares an uploaded graph, in any format ImportGraph accepts,
+// with the stored graph of the app without saving it, e.g. for showing a
+// plan before an import. With the format query parameter dot, svg, png or
+// pdf the diff is drawn instead.
+func (h *RESTHandler) DiffGraph(c *gin.Context) {
+	appName := c.Param("app")
+	var format export.Format
+	if name := c.Query("format"); name != "" {
+		var err error
+		if format, err = export.ParseFormat(name); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		switch format {
+		case export.FormatDOT, export.FormatSVG, export.FormatPNG, export.FormatPDF:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported diff format: " + name + " (supported: dot, svg, png, pdf)"})
+			return
+		}
+	}
+
+	candidate, ok := readGraphUpload(c, appName)
+	if !ok {
+		return
+	}
+	stored, err := h.repo(c).LoadGraph(appName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Graph not found: " + err.Error()})
+		return
+	}
+	diff := graph.Diff(stored, candidate)
+
+	if format == "" {
+		c.JSON(http.StatusOK, DiffResponse{
+			AppName: appName,
+			Version: stored.Version,
+			Changed: !diff.Empty(),
+			Diff:    diff,
+		})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := h.exporter.ExportDiffTo(&buf, stored, candidate, diff, format); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to draw diff: " + err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, format.ContentType(), buf.Bytes())
+}
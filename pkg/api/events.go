@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/events"
+	"github.com/philipsahli/innominatus-graph/pkg/execution"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+	"github.com/philipsahli/innominatus-graph/pkg/tracing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// eventBufferSize is the number of events queued per subscriber. Events
+// for subscribers that fall further behind are dropped.
+const eventBufferSize = 64
+
+// eventKeepAlive is how often idle event streams get a comment, so that
+// proxies do not close them
+const eventKeepAlive = 15 * time.Second
+
+// subscribeStateChanges returns a channel receiving the node state changes
+// that dispatcher publishes for the app of a tenant, and a function ending
+// the subscription
+func subscribeStateChanges(dispatcher *events.Dispatcher, tenantID uuid.UUID, appName string) (<-chan events.NodeStateChanged, func()) {
+	changes := make(chan events.NodeStateChanged)
+	done := make(chan struct{})
+	unsubscribe := dispatcher.SubscribeWith(events.SubscriberFunc(func(event events.Event) {
+		change, ok := event.(events.NodeStateChanged)
+		if !ok || change.TenantID != tenantID || change.AppName != appName {
+			return
+		}
+		select {
+		case changes <- change:
+		case <-done:
+		}
+	}), events.QueueOptions{Size: eventBufferSize, Overflow: events.DropNewest})
+
+	return changes, func() {
+		close(done)
+		unsubscribe()
+	}
+}
+
+// runPublisher returns where executions publish their events: dispatcher,
+// less the state changes if a StatePoller publishes those to it
+func runPublisher(dispatcher *events.Dispatcher, statesPolled bool) events.Publisher {
+	if statesPolled {
+		return events.PublishOfType(dispatcher, events.TypeRunStarted, events.TypeRunCompleted)
+	}
+	return dispatcher
+}
+
+// runQueue makes executions queue their runs for the workers of all
+// replicas; see RESTHandler.SetRunQueue
+type runQueue struct {
+	worker *execution.Worker // nil on replicas that only queue runs
+}
+
+// startExecution starts a run of the app's graph in the background and
+// publishes its events to publisher under the tenant in ctx. With a
+// trace exporter the finished run is sent to the collector, and the trace
+// span in ctx, if any, is linked to it. With a queue the run is only queued
+// and executed by whichever replica claims it.
+func startExecution(ctx context.Context, repository storage.RepositoryInterface, runner execution.WorkflowRunner, publisher events.Publisher, traces *execution.TraceExporter, queue *runQueue, appName string) (uuid.UUID, error) {
+	var runID uuid.UUID
+	if queue != nil {
+		g, err := repository.LoadGraph(appName)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		run, err := repository.QueueGraphRun(appName, g.Version)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		runID = run.ID
+		if queue.worker != nil {
+			queue.worker.Notify()
+		}
+	} else {
+		engine := execution.NewEngine(repository, runner)
+		engine.RegisterObserver(events.TenantExecutionObserver(publisher, storage.TenantFromContext(ctx)))
+		var done <-chan *execution.ExecutionPlan
+		var err error
+		runID, done, err = engine.StartGraph(appName)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		if traces != nil {
+			go func() {
+				plan := <-done
+				if err := traces.ExportPlan(context.Background(), plan); err != nil {
+					log.Printf("Failed to export trace: %v", err)
+				}
+			}()
+		}
+	}
+
+	if span := tracing.SpanFromContext(ctx); span != nil {
+		span.SetAttribute("innominatus.run_id", runID.String())
+		span.AddLink(execution.RunSpanContext(runID))
+	}
+	return runID, nil
+}
+
+// StreamEvents streams the node state changes of executions of an app as
+// Server-Sent Events named "state-change" until the client disconnects
+func (h *RESTHandler) StreamEvents(c *gin.Context) {
+	if _, err := h.repo(c).LoadGraphSummary(c.Param("app")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Graph not found: " + err.Error()})
+		return
+	}
+
+	changes, unsubscribe := subscribeStateChanges(h.events, storage.TenantFromContext(c.Request.Context()), c.Param("app"))
+	defer unsubscribe()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	c.SSEvent("ready", gin.H{"app_name": c.Param("app")})
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case change := <-changes:
+			c.SSEvent("state-change", change)
+			return true
+		case <-keepAlive.C:
+			_, err := w.Write([]byte(": keep-alive\n\n"))
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
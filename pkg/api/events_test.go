@@ -0,0 +1,207 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/events"
+	"github.com/philipsahli/innominatus-graph/pkg/execution"
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testEventStream is the event stream of an app opened with
+// openEventStream
+type testEventStream struct {
+	reader *bufio.Reader
+}
+
+// openEventStream subscribes to the events of app, returning once the
+// ready event is read. The stream is closed when the test ends.
+func openEventStream(t *testing.T, server *httptest.Server, app string) *testEventStream {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/v1/apps/"+app+"/events", nil)
+	require.NoError(t, err)
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	stream := &testEventStream{reader: bufio.NewReader(resp.Body)}
+	name, _ := stream.next(t)
+	require.Equal(t, "ready", name)
+	return stream
+}
+
+// next reads the name and data of the next event
+func (s *testEventStream) next(t *testing.T) (name, data string) {
+	t.Helper()
+	for {
+		line, err := s.reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && name != "":
+			return name, data
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+}
+
+// nextChange reads the next event, which must be a state change
+func (s *testEventStream) nextChange(t *testing.T) events.NodeStateChanged {
+	t.Helper()
+	name, data := s.next(t)
+	require.Equal(t, "state-change", name)
+	var change events.NodeStateChanged
+	require.NoError(t, json.Unmarshal([]byte(data), &change), data)
+	return change
+}
+
+func TestStreamEvents_NodeStateUpdates(t *testing.T) {
+	dispatcher := events.NewDispatcher(events.DispatcherOptions{})
+	defer dispatcher.Close()
+	h := NewRESTHandler(newTestRepository(t))
+	defer h.Close()
+	h.SetEventDispatcher(dispatcher)
+	server := startTestServer(t, h)
+	stream := openEventStream(t, server, testApp)
+
+	// Other subscribers of the dispatcher see the updates too
+	received := make(chan events.NodeStateChanged, 8)
+	unsubscribe := dispatcher.Subscribe(events.SubscriberFunc(func(event events.Event) {
+		if change, ok := event.(events.NodeStateChanged); ok {
+			received <- change
+		}
+	}))
+	defer unsubscribe()
+
+	resp := doRequest(t, server, http.MethodPatch, "/api/v1/apps/"+testApp+"/nodes/db/state", NodeStateRequest{State: graph.NodeStateRunning}, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(resp.Body))
+	var body NodeStateResponse
+	resp.decode(t, &body)
+	require.Len(t, body.Changes, 1)
+
+	change := stream.nextChange(t)
+	assert.Equal(t, testApp, change.AppName)
+	assert.Equal(t, uuid.Nil, change.TenantID)
+	assert.Equal(t, "db", change.Node.ID)
+	assert.Equal(t, graph.NodeStateWaiting, change.OldState)
+	assert.Equal(t, graph.NodeStateRunning, change.NewState)
+	assert.Equal(t, uuid.Nil, change.RunID, "not changed by a run")
+	assert.Equal(t, body.Changes[0].Node.ID, change.Node.ID)
+
+	select {
+	case change := <-received:
+		assert.Equal(t, "db", change.Node.ID)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the dispatcher's subscriber did not receive the change")
+	}
+}
+
+func TestStreamEvents_Executions(t *testing.T) {
+	h := NewRESTHandler(newTestRepository(t))
+	defer h.Close()
+	h.SetWorkflowRunner(execution.NewMockWorkflowRunner())
+	server := startTestServer(t, h)
+	stream := openEventStream(t, server, testApp)
+
+	resp := doRequest(t, server, http.MethodPost, "/api/v1/apps/"+testApp+"/execute", nil, nil)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode, string(resp.Body))
+	var body struct {
+		RunID uuid.UUID `json:"run_id"`
+	}
+	resp.decode(t, &body)
+
+	// The workflow runs before the database it provisions
+	for _, want := range []struct {
+		node  string
+		state graph.NodeState
+	}{
+		{"deploy", graph.NodeStateRunning},
+		{"deploy", graph.NodeStateSucceeded},
+		{"db", graph.NodeStateRunning},
+		{"db", graph.NodeStateSucceeded},
+	} {
+		change := stream.nextChange(t)
+		assert.Equal(t, want.node, change.Node.ID)
+		assert.Equal(t, want.state, change.NewState)
+		assert.Equal(t, body.RunID, change.RunID)
+		assert.Equal(t, testApp, change.AppName)
+	}
+}
+
+func TestStreamEvents_PolledStateChanges(t *testing.T) {
+	repo := newTestRepository(t)
+	dispatcher := events.NewDispatcher(events.DispatcherOptions{})
+	defer dispatcher.Close()
+	h := NewRESTHandler(repo)
+	defer h.Close()
+	h.SetEventDispatcher(dispatcher)
+	h.SetStateChangesPolled()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go events.NewStatePoller(repo, dispatcher, events.StatePollerOptions{Interval: 10 * time.Millisecond}).Run(ctx)
+	server := startTestServer(t, h)
+	stream := openEventStream(t, server, testApp)
+
+	// A change recorded by another replica
+	require.NoError(t, repo.RecordNodeStateChange(testApp, "deploy", graph.NodeStateWaiting, graph.NodeStateRunning, nil))
+	change := stream.nextChange(t)
+	assert.Equal(t, "deploy", change.Node.ID)
+	assert.Equal(t, graph.NodeStateRunning, change.NewState)
+
+	// The changes of this one are delivered once, from the state history
+	resp := doRequest(t, server, http.MethodPatch, "/api/v1/apps/"+testApp+"/nodes/db/state", NodeStateRequest{State: graph.NodeStateRunning}, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(resp.Body))
+	require.NoError(t, repo.RecordNodeStateChange(testApp, "deploy", graph.NodeStateRunning, graph.NodeStateSucceeded, nil))
+	for _, want := range []string{"db", "deploy"} {
+		change := stream.nextChange(t)
+		assert.Equal(t, want, change.Node.ID)
+	}
+}
+
+func TestSubscribeStateChanges_Filters(t *testing.T) {
+	dispatcher := events.NewDispatcher(events.DispatcherOptions{})
+	defer dispatcher.Close()
+	tenantID := uuid.New()
+	changes, unsubscribe := subscribeStateChanges(dispatcher, tenantID, testApp)
+	defer unsubscribe()
+
+	change := func(tenantID uuid.UUID, app, nodeID string) events.NodeStateChanged {
+		return events.NodeStateChanged{
+			Meta:     events.Meta{AppName: app, TenantID: tenantID},
+			Node:     &graph.Node{ID: nodeID},
+			NewState: graph.NodeStateRunning,
+		}
+	}
+	dispatcher.Publish(change(uuid.Nil, testApp, "other tenant"))
+	dispatcher.Publish(change(tenantID, "billing", "other app"))
+	dispatcher.Publish(events.NodeAdded{Meta: events.Meta{AppName: testApp, TenantID: tenantID}, Node: &graph.Node{ID: "added"}})
+	dispatcher.Publish(change(tenantID, testApp, "db"))
+
+	select {
+	case received := <-changes:
+		assert.Equal(t, "db", received.Node.ID)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the change was not received")
+	}
+
+	// Nobody receives this change, which must not keep the dispatcher from
+	// closing once unsubscribed
+	dispatcher.Publish(change(tenantID, testApp, "deploy"))
+}
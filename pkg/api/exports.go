@@ -0,0 +1,315 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/export"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Statuses of an ExportJob
+const (
+	ExportJobPending   = "pending"   // Waiting for a worker
+	ExportJobRunning   = "running"   // Being exported
+	ExportJobSucceeded = "succeeded" // Ready for download
+	ExportJobFailed    = "failed"    // See Error
+)
+
+// ExportJobLimits bounds the exports run in the background. Zero values are
+// replaced by the values of DefaultExportJobLimits.
+type ExportJobLimits struct {
+	// Timeout fails jobs that run longer
+	Timeout time.Duration
+	// MaxBytes fails jobs whose output grows larger
+	MaxBytes int64
+	// Workers is the number of jobs exported at the same time
+	Workers int
+	// MaxJobs is the number of jobs kept, queued or finished; further jobs
+	// are refused until some have expired
+	MaxJobs int
+	// TTL is how long finished jobs are kept for download
+	TTL time.Duration
+}
+
+// DefaultExportJobLimits returns the limits used for unset ExportJobLimits
+// fields
+func DefaultExportJobLimits() ExportJobLimits {
+	return ExportJobLimits{
+		Timeout:  2 * time.Minute,
+		MaxBytes: 64 << 20,
+		Workers:  2,
+		MaxJobs:  32,
+		TTL:      15 * time.Minute,
+	}
+}
+
+func (l ExportJobLimits) withDefaults() ExportJobLimits {
+	defaults := DefaultExportJobLimits()
+	if l.Timeout <= 0 {
+		l.Timeout = defaults.Timeout
+	}
+	if l.MaxBytes <= 0 {
+		l.MaxBytes = defaults.MaxBytes
+	}
+	if l.Workers <= 0 {
+		l.Workers = defaults.Workers
+	}
+	if l.MaxJobs <= 0 {
+		l.MaxJobs = defaults.MaxJobs
+	}
+	if l.TTL <= 0 {
+		l.TTL = defaults.TTL
+	}
+	return l
+}
+
+// ExportJob is an export run in the background. Its output is kept in
+// memory until ExpiresAt.
+type ExportJob struct {
+	ID          uuid.UUID     `json:"id"`
+	App         string        `json:"app"`
+	Format      export.Format `json:"format"`
+	Status      string        `json:"status"`
+	Error       string        `json:"error,omitempty"`
+	Size        int64         `json:"size,omitempty"` // Bytes of output once succeeded
+	CreatedAt   time.Time     `json:"created_at"`
+	StartedAt   *time.Time    `json:"started_at,omitempty"`
+	CompletedAt *time.Time    `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time    `json:"expires_at,omitempty"` // Set once finished
+
+	tenantID uuid.UUID
+	filename string
+	data     []byte
+}
+
+var errTooManyExportJobs = errors.New("too many export jobs, retry later")
+
+// exportJobs queues export jobs and runs at most Workers of them at a time
+type exportJobs struct {
+	limits ExportJobLimits
+	slots  chan struct{}
+	// export writes the output of a task and now is the clock of the
+	// jobs, both replaced in tests
+	export func(w io.Writer, task *exportTask) error
+	now    func() time.Time
+
+	mu   sync.Mutex
+	jobs map[uuid.UUID]*ExportJob
+}
+
+func newExportJobs(exporter *export.Exporter, limits ExportJobLimits) *exportJobs {
+	limits = limits.withDefaults()
+	return &exportJobs{
+		limits: limits,
+		slots:  make(chan struct{}, limits.Workers),
+		export: func(w io.Writer, task *exportTask) error {
+			return exporter.ExportGraphTo(w, task.graph, task.format, task.options)
+		},
+		now:  time.Now,
+		jobs: make(map[uuid.UUID]*ExportJob),
+	}
+}
+
+// submit queues task for tenantID and returns a copy of the new job
+func (q *exportJobs) submit(tenantID uuid.UUID, task *exportTask) (ExportJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.expire(q.now())
+	if len(q.jobs) >= q.limits.MaxJobs {
+		return ExportJob{}, errTooManyExportJobs
+	}
+	job := &ExportJob{
+		ID:        uuid.New(),
+		App:       task.appName,
+		Format:    task.format,
+		Status:    ExportJobPending,
+		CreatedAt: q.now(),
+		tenantID:  tenantID,
+		filename:  task.filename(),
+	}
+	q.jobs[job.ID] = job
+
+	go q.run(job, task)
+	return *job, nil
+}
+
+// get returns a copy of the job of tenantID with the given ID
+func (q *exportJobs) get(tenantID, id uuid.UUID) (ExportJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.expire(q.now())
+	job, ok := q.jobs[id]
+	if !ok || job.tenantID != tenantID {
+		return ExportJob{}, false
+	}
+	return *job, true
+}
+
+// expire drops finished jobs whose output is no longer kept
+func (q *exportJobs) expire(now time.Time) {
+	for id, job := range q.jobs {
+		if job.ExpiresAt != nil && now.After(*job.ExpiresAt) {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+// run waits for a worker and exports task. A job that times out is failed
+// right away, but keeps its worker until the exporter returns, as exports
+// cannot be interrupted; its further output is discarded.
+func (q *exportJobs) run(job *ExportJob, task *exportTask) {
+	q.slots <- struct{}{}
+	q.update(func() {
+		now := q.now()
+		job.Status = ExportJobRunning
+		job.StartedAt = &now
+	})
+
+	output := &limitedBuffer{limit: q.limits.MaxBytes}
+	done := make(chan error, 1)
+	go func() {
+		defer func() { <-q.slots }()
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("export panicked: %v", r)
+			}
+		}()
+		done <- q.export(output, task)
+	}()
+
+	timer := time.NewTimer(q.limits.Timeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case err = <-done:
+	case <-timer.C:
+		output.abort()
+		err = fmt.Errorf("export timed out after %s", q.limits.Timeout)
+	}
+
+	q.update(func() {
+		now := q.now()
+		expires := now.Add(q.limits.TTL)
+		job.CompletedAt = &now
+		job.ExpiresAt = &expires
+		if err != nil {
+			job.Status = ExportJobFailed
+			job.Error = err.Error()
+			return
+		}
+		job.Status = ExportJobSucceeded
+		job.data = output.bytes()
+		job.Size = int64(len(job.data))
+	})
+}
+
+// update changes jobs under the lock
+func (q *exportJobs) update(change func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	change()
+}
+
+// limitedBuffer collects export output up to limit bytes. Writes fail once
+// the limit is exceeded or the buffer was aborted.
+type limitedBuffer struct {
+	limit   int64
+	aborted atomic.Bool
+
+	mu   sync.Mutex
+	data []byte
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.aborted.Load() {
+		return 0, errors.New("export aborted")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if int64(len(b.data)+len(p)) > b.limit {
+		return 0, fmt.Errorf("export exceeds the size limit of %d bytes", b.limit)
+	}
+	b.data = append(b.data, p...)
+	return len(p), nil
+}
+
+func (b *limitedBuffer) abort() {
+	b.aborted.Store(true)
+}
+
+func (b *limitedBuffer) bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.data
+}
+
+// SetExportJobLimits replaces the limits of export jobs; call it before
+// SetupRoutes
+func (h *RESTHandler) SetExportJobLimits(limits ExportJobLimits) {
+	h.exports = newExportJobs(h.exporter, limits)
+}
+
+// CreateExportJob validates an export request like ExportGraph and runs the
+// export in the background, so that rendering large graphs does not hold
+// the request. The graph is loaded when the job is created.
+func (h *RESTHandler) CreateExportJob(c *gin.Context) {
+	task, ok := h.prepareExport(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.exports.submit(storage.TenantFromContext(c.Request.Context()), task)
+	if err != nil {
+		c.Header("Retry-After", "10")
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Location", "/api/v1/exports/"+job.ID.String())
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetExportJob downloads the output of a succeeded export job. Pending and
+// running jobs are answered with 202 and failed jobs with 500, both with
+// the job as JSON.
+func (h *RESTHandler) GetExportJob(c *gin.Context) {
+	id, err := parseUUID(c.Param("exportId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export ID"})
+		return
+	}
+	ctx := c.Request.Context()
+	job, ok := h.exports.get(storage.TenantFromContext(ctx), id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export job not found or expired"})
+		return
+	}
+	if err := authorize(ctx, h.authorizer, job.App, RoleViewer); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch job.Status {
+	case ExportJobSucceeded:
+		c.Header("Content-Disposition", "attachment; filename="+job.filename)
+		c.Header("Content-Length", strconv.FormatInt(job.Size, 10))
+		c.Data(http.StatusOK, job.Format.ContentType(), job.data)
+	case ExportJobFailed:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export graph: " + job.Error, "job": job})
+	default:
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusAccepted, job)
+	}
+}
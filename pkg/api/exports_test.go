@@ -0,0 +1,143 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startExportServer serves the routes of a handler running export jobs
+// with limits
+func startExportServer(t *testing.T, limits ExportJobLimits) (*RESTHandler, *httptest.Server) {
+	t.Helper()
+	h := NewRESTHandler(newTestRepository(t))
+	t.Cleanup(func() { h.Close() })
+	h.SetExportJobLimits(limits)
+	return h, startTestServer(t, h)
+}
+
+// createExportJob creates a JSON export job of testApp
+func createExportJob(t *testing.T, server *httptest.Server) ExportJob {
+	t.Helper()
+	resp := doRequest(t, server, http.MethodPost, "/api/v1/exports?app="+testApp, map[string]string{"format": "json"}, nil)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode, string(resp.Body))
+	var job ExportJob
+	resp.decode(t, &job)
+	assert.Equal(t, "/api/v1/exports/"+job.ID.String(), resp.Header.Get("Location"))
+	return job
+}
+
+// awaitExportJob polls the job until it has finished
+func awaitExportJob(t *testing.T, server *httptest.Server, job ExportJob) *testResponse {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		resp := doRequest(t, server, http.MethodGet, "/api/v1/exports/"+job.ID.String(), nil, nil)
+		if resp.StatusCode != http.StatusAccepted {
+			return resp
+		}
+	}
+	t.Fatalf("export job %s did not finish", job.ID)
+	return nil
+}
+
+// failedExportJob decodes the job of a response to a failed job
+func failedExportJob(t *testing.T, resp *testResponse) ExportJob {
+	t.Helper()
+	require.Equal(t, http.StatusInternalServerError, resp.StatusCode, string(resp.Body))
+	var body struct {
+		Error string    `json:"error"`
+		Job   ExportJob `json:"job"`
+	}
+	resp.decode(t, &body)
+	assert.Equal(t, "Failed to export graph: "+body.Job.Error, body.Error)
+	assert.Equal(t, ExportJobFailed, body.Job.Status)
+	return body.Job
+}
+
+func TestExportJob_Succeeds(t *testing.T) {
+	_, server := startExportServer(t, ExportJobLimits{})
+	job := createExportJob(t, server)
+	assert.Equal(t, ExportJobPending, job.Status)
+	assert.Equal(t, testApp, job.App)
+
+	resp := awaitExportJob(t, server, job)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(resp.Body))
+	assert.Contains(t, resp.Header.Get("Content-Disposition"), "attachment; filename=")
+	assert.Contains(t, string(resp.Body), `"deploy"`)
+
+	resp = doRequest(t, server, http.MethodPost, "/api/v1/exports?app="+testApp, map[string]string{"format": "bmp"}, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "requests are validated before queueing")
+	resp = doRequest(t, server, http.MethodGet, "/api/v1/exports/not-an-id", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestExportJob_SizeLimit(t *testing.T) {
+	_, server := startExportServer(t, ExportJobLimits{MaxBytes: 16})
+	job := failedExportJob(t, awaitExportJob(t, server, createExportJob(t, server)))
+	assert.Contains(t, job.Error, "export exceeds the size limit of 16 bytes")
+	assert.Zero(t, job.Size)
+}
+
+func TestExportJob_Timeout(t *testing.T) {
+	h, server := startExportServer(t, ExportJobLimits{Timeout: 20 * time.Millisecond, Workers: 1})
+	release := make(chan struct{})
+	h.exports.export = func(w io.Writer, task *exportTask) error {
+		<-release
+		_, err := w.Write([]byte(`{"late": true}`))
+		return err
+	}
+
+	slow := createExportJob(t, server)
+	job := failedExportJob(t, awaitExportJob(t, server, slow))
+	assert.Equal(t, "export timed out after 20ms", job.Error)
+
+	// The timed out export keeps its worker until it returns
+	queued := createExportJob(t, server)
+	time.Sleep(50 * time.Millisecond)
+	resp := doRequest(t, server, http.MethodGet, "/api/v1/exports/"+queued.ID.String(), nil, nil)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+	resp.decode(t, &job)
+	assert.Equal(t, ExportJobPending, job.Status)
+
+	close(release)
+	resp = awaitExportJob(t, server, queued)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(resp.Body))
+	assert.Equal(t, `{"late": true}`, string(resp.Body))
+
+	// The output of the timed out export is discarded
+	job = failedExportJob(t, awaitExportJob(t, server, slow))
+	assert.Equal(t, "export timed out after 20ms", job.Error)
+}
+
+func TestExportJob_Expires(t *testing.T) {
+	h, server := startExportServer(t, ExportJobLimits{TTL: time.Minute, MaxJobs: 1})
+	clock := newTestClock()
+	h.exports.now = clock.Now
+
+	job := createExportJob(t, server)
+	resp := awaitExportJob(t, server, job)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Finished jobs count until they expire
+	resp = doRequest(t, server, http.MethodPost, "/api/v1/exports?app="+testApp, map[string]string{"format": "json"}, nil)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "10", resp.Header.Get("Retry-After"))
+	assert.Contains(t, string(resp.Body), "too many export jobs, retry later")
+
+	clock.advance(time.Minute)
+	resp = doRequest(t, server, http.MethodGet, "/api/v1/exports/"+job.ID.String(), nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "kept for the TTL")
+
+	clock.advance(time.Millisecond)
+	resp = doRequest(t, server, http.MethodGet, "/api/v1/exports/"+job.ID.String(), nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Contains(t, string(resp.Body), "Export job not found or expired")
+
+	createExportJob(t, server)
+}
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// maxImportSize limits the size of uploaded graphs
+const maxImportSize = 32 << 20
+
+// graphDocument is the structure of the JSON export, which ImportGraph also
+// accepts as YAML
+type graphDocument struct {
+	Nodes map[string]*graph.Node `json:"nodes"`
+	Edges map[string]*graph.Edge `json:"edges"`
+}
+
+// scoreSpec is the part of a Score workload spec (https://score.dev) that
+// becomes part of the graph
+type scoreSpec struct {
+	APIVersion string `yaml:"apiVersion"`
+	Metadata   struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Containers map[string]interface{} `yaml:"containers"`
+	Resources  map[string]struct {
+		Type   string                 `yaml:"type"`
+		Class  string                 `yaml:"class"`
+		Params map[string]interface{} `yaml:"params"`
+	} `yaml:"resources"`
+}
+
+// ImportErrorResponse lists why an uploaded graph was rejected
+type ImportErrorResponse struct {
+	Error   string   `json:"error"`
+	Details []string `json:"details"`
+}
+
+// importError carries the validation failures of an upload
+type importError struct {
+	details []string
+}
+
+func (e *importError) Error() string {
+	return strings.Join(e.details, "; ")
+}
+
+// ImportGraph replaces the graph of an app with the uploaded one, creating
+// the app if needed. The body is the JSON export format, the same structure
+// as YAML, or a Score workload spec. Uploads that cannot be parsed are
+// rejected with 400, graphs breaking the graph rules with 422 listing every
+// problem.
+func (h *RESTHandler) ImportGraph(c *gin.Context) {
+	appName := c.Param("app")
+	g, ok := readGraphUpload(c, appName)
+	if !ok {
+		return
+	}
+
+	h.edits.Lock()
+	defer h.edits.Unlock()
+	if err := h.repo(c).SaveGraph(appName, g); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save graph: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"app_name": appName, "nodes": len(g.Nodes), "edges": len(g.Edges)})
+}
+
+// readGraphUpload decodes the graph uploaded for appName, answering the
+// request if it is invalid
+func readGraphUpload(c *gin.Context, appName string) (*graph.Graph, bool) {
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request: " + err.Error()})
+		return nil, false
+	}
+
+	g, err := decodeGraph(appName, data)
+	if err != nil {
+		var invalid *importError
+		if errors.As(err, &invalid) {
+			c.JSON(http.StatusUnprocessableEntity, ImportErrorResponse{Error: "Invalid graph", Details: invalid.details})
+			return nil, false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return nil, false
+	}
+	return g, true
+}
+
+// decodeGraph builds the graph of appName from an upload. Syntax errors are
+// returned as is, violations of the graph rules as *importError.
+func decodeGraph(appName string, data []byte) (*graph.Graph, error) {
+	// YAML is a superset of JSON, so one decoder reads both
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse graph: %w", err)
+	}
+	if raw == nil {
+		return nil, &importError{details: []string{"document is empty"}}
+	}
+
+	if version, _ := raw["apiVersion"].(string); strings.HasPrefix(version, "score.dev/") {
+		var spec scoreSpec
+		if err := yaml.Unmarshal(data, &spec); err != nil {
+			return nil, &importError{details: []string{err.Error()}}
+		}
+		return scoreGraph(appName, spec)
+	}
+
+	// Decode the export structure through its JSON tags
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse graph: %w", err)
+	}
+	var doc graphDocument
+	if err := json.Unmarshal(encoded, &doc); err != nil {
+		return nil, &importError{details: []string{err.Error()}}
+	}
+	return documentGraph(appName, doc)
+}
+
+// documentGraph validates and assembles the nodes and edges of doc
+func documentGraph(appName string, doc graphDocument) (*graph.Graph, error) {
+	var details []string
+	nodes := make([]*graph.Node, 0, len(doc.Nodes))
+	for _, key := range sortedKeys(doc.Nodes) {
+		node := doc.Nodes[key]
+		if node == nil {
+			details = append(details, fmt.Sprintf("node %s: node cannot be null", key))
+			continue
+		}
+		if node.ID == "" {
+			node.ID = key
+		}
+		if node.ID != key {
+			details = append(details, fmt.Sprintf("node %s: ID %s does not match its key", key, node.ID))
+		}
+		if !validNodeType(node.Type) {
+			details = append(details, fmt.Sprintf("node %s: invalid node type: %s", key, node.Type))
+		}
+		nodes = append(nodes, node)
+	}
+
+	edges := make([]*graph.Edge, 0, len(doc.Edges))
+	for _, key := range sortedKeys(doc.Edges) {
+		edge := doc.Edges[key]
+		if edge == nil {
+			details = append(details, fmt.Sprintf("edge %s: edge cannot be null", key))
+			continue
+		}
+		if edge.ID == "" {
+			edge.ID = key
+		}
+		if edge.ID != key {
+			details = append(details, fmt.Sprintf("edge %s: ID %s does not match its key", key, edge.ID))
+		}
+		edges = append(edges, edge)
+	}
+	if len(details) > 0 {
+		return nil, &importError{details: details}
+	}
+	return buildGraph(appName, nodes, edges)
+}
+
+// scoreGraph turns a Score workload into a spec node bound to a resource
+// node per declared resource
+func scoreGraph(appName string, spec scoreSpec) (*graph.Graph, error) {
+	if spec.Metadata.Name == "" {
+		return nil, &importError{details: []string{"score spec: metadata.name is required"}}
+	}
+
+	containers := make([]string, 0, len(spec.Containers))
+	for name := range spec.Containers {
+		containers = append(containers, name)
+	}
+	sort.Strings(containers)
+
+	workload := spec.Metadata.Name
+	nodes := []*graph.Node{{
+		ID:   workload,
+		Type: graph.NodeTypeSpec,
+		Name: workload,
+		Properties: map[string]interface{}{
+			"api_version": spec.APIVersion,
+			"containers":  containers,
+		},
+	}}
+	var edges []*graph.Edge
+	for _, name := range sortedKeys(spec.Resources) {
+		resource := spec.Resources[name]
+		properties := map[string]interface{}{"type": resource.Type}
+		if resource.Class != "" {
+			properties["class"] = resource.Class
+		}
+		if len(resource.Params) > 0 {
+			properties["params"] = resource.Params
+		}
+
+		id := workload + "-" + name
+		nodes = append(nodes, &graph.Node{ID: id, Type: graph.NodeTypeResource, Name: name, Properties: properties})
+		edges = append(edges, &graph.Edge{
+			ID:         workload + "-binds-to-" + name,
+			FromNodeID: workload,
+			ToNodeID:   id,
+			Type:       graph.EdgeTypeBindsTo,
+		})
+	}
+	return buildGraph(appName, nodes, edges)
+}
+
+// buildGraph adds nodes and edges with the batch validation of the graph
+// package, reporting every failure
+func buildGraph(appName string, nodes []*graph.Node, edges []*graph.Edge) (*graph.Graph, error) {
+	g := graph.NewGraph(appName)
+	if err := g.AddNodes(nodes); err != nil {
+		return nil, &importError{details: joinedErrors(err)}
+	}
+	if err := g.AddEdges(edges); err != nil {
+		return nil, &importError{details: joinedErrors(err)}
+	}
+	return g, nil
+}
+
+// joinedErrors splits an errors.Join error into its messages
+func joinedErrors(err error) []string {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []string{err.Error()}
+	}
+	var messages []string
+	for _, err := range joined.Unwrap() {
+		messages = append(messages, err.Error())
+	}
+	return messages
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
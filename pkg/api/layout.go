@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/philipsahli/innominatus-graph/pkg/layout"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetLayout lays out the graph of an app on the server and returns the node
+// positions as layout.GraphLayout, so that web clients only have to draw
+// them. Layouts are cached by graph structure and options, and the response
+// carries an ETag of both, so that clients revalidating with If-None-Match
+// get 304 until the structure changes. State changes only change timeline
+// layouts.
+func (h *RESTHandler) GetLayout(c *gin.Context) {
+	opts, err := layoutOptionsFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	g, err := h.repo(c).LoadGraph(c.Param("app"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Graph not found: " + err.Error()})
+		return
+	}
+	if opts.FocusNodeID != "" {
+		if _, exists := g.GetNode(opts.FocusNodeID); !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Focus node not found: " + opts.FocusNodeID})
+			return
+		}
+	}
+
+	hash, err := layout.ContentHash(g, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute layout: " + err.Error()})
+		return
+	}
+	etag := `"` + hash + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	gl, err := h.layouts.ComputeLayout(g, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute layout: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gl)
+}
+
+// layoutOptionsFromQuery reads the layout options of a layout request; unset
+// options take the defaults of layout.DefaultOptions
+func layoutOptionsFromQuery(c *gin.Context) (layout.LayoutOptions, error) {
+	var opts layout.LayoutOptions
+	if name := c.Query("type"); name != "" {
+		layoutType, err := layout.ParseLayoutType(name)
+		if err != nil {
+			return opts, err
+		}
+		opts.Type = layoutType
+	}
+	if value := c.Query("clusters"); value != "" {
+		clusters, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, err
+		}
+		opts.Clusters = clusters
+	}
+	if value := c.Query("seed"); value != "" {
+		seed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return opts, err
+		}
+		opts.Seed = seed
+	}
+	opts.LaneProperty = c.Query("lane_property")
+	opts.FocusNodeID = c.Query("focus_node_id")
+	return opts, nil
+}
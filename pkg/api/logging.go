@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+	"github.com/philipsahli/innominatus-graph/pkg/tracing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the ID of a request. A valid ID sent by the
+// client, e.g. by a proxy, is kept; otherwise one is generated. The ID is
+// returned in the response.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx holding the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx, or ""
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestIDMiddleware stores the request ID from RequestIDHeader, or a new
+// one, in the request context and the response headers
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// validRequestID accepts up to 128 printable ASCII characters, so that
+// client IDs cannot forge log lines
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// LoggingMiddleware logs every request once it is answered, replacing
+// gin.Logger. Server errors are logged at error, client errors at warn and
+// the rest at info. Use it after RequestIDMiddleware and TracingMiddleware
+// so that the lines carry their IDs.
+func LoggingMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		ctx := c.Request.Context()
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.Duration("elapsed", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if tenantID := storage.TenantFromContext(ctx); tenantID != storage.DefaultTenantID {
+			attrs = append(attrs, slog.String("tenant", tenantID.String()))
+		}
+		if actor := storage.ActorFromContext(ctx); actor != storage.SystemActor {
+			attrs = append(attrs, slog.String("actor", actor))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+		logger.LogAttrs(ctx, level, "request", attrs...)
+	}
+}
+
+// LogHandler adds the request ID and the trace and span ID of the context
+// to every record logged with one, e.g. the queries of a request
+type LogHandler struct {
+	slog.Handler
+}
+
+// NewLogHandler wraps handler
+func NewLogHandler(handler slog.Handler) *LogHandler {
+	return &LogHandler{Handler: handler}
+}
+
+func (h *LogHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestIDFromContext(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	if sc, ok := tracing.SpanContextFromContext(ctx); ok {
+		record.AddAttrs(slog.String("trace_id", sc.TraceIDString()), slog.String("span_id", sc.SpanIDString()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *LogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &LogHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *LogHandler) WithGroup(name string) slog.Handler {
+	return &LogHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// TracingMiddleware records a server span for every request, joining the
+// trace of a traceparent header sent by the client. Database queries of
+// the request become its children when the connection is instrumented with
+// storage.TraceQueries, and runs it starts are linked to it. The span's
+// traceparent is returned in the response.
+func TracingMiddleware(tracer *tracing.Tracer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		if parent, err := tracing.ParseTraceparent(c.GetHeader(tracing.TraceparentHeader)); err == nil {
+			ctx = tracing.ContextWithRemoteParent(ctx, parent)
+		}
+		ctx, span := tracer.Start(ctx, c.Request.Method, tracing.SpanKindServer)
+		c.Header(tracing.TraceparentHeader, span.Traceparent())
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if route := c.FullPath(); route != "" {
+			span.Name += " " + route
+			span.SetAttribute("http.route", route)
+		}
+		span.SetAttribute("http.request.method", c.Request.Method)
+		span.SetAttribute("url.path", c.Request.URL.Path)
+		span.SetIntAttribute("http.response.status_code", int64(c.Writer.Status()))
+		if id := RequestIDFromContext(ctx); id != "" {
+			span.SetAttribute("http.request.id", id)
+		}
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			span.Error = http.StatusText(c.Writer.Status())
+			if len(c.Errors) > 0 {
+				span.Error = c.Errors.String()
+			}
+		}
+		span.Finish()
+	}
+}
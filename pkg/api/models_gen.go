@@ -0,0 +1,71 @@
+// Code generated by github.com/99designs/gqlgen, DO NOT EDIT.
+
+package api
+
+import (
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+type App struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Description *string `json:"description,omitempty"`
+	CreatedAt   string  `json:"createdAt"`
+	UpdatedAt   string  `json:"updatedAt"`
+}
+
+type EdgeInput struct {
+	ID          string         `json:"id"`
+	FromNodeID  string         `json:"fromNodeId"`
+	ToNodeID    string         `json:"toNodeId"`
+	Type        graph.EdgeType `json:"type"`
+	Description *string        `json:"description,omitempty"`
+	Properties  *string        `json:"properties,omitempty"`
+}
+
+type GraphInput struct {
+	Nodes []*NodeInput `json:"nodes"`
+	Edges []*EdgeInput `json:"edges"`
+}
+
+type Mutation struct {
+}
+
+type NodeExecution struct {
+	NodeID      string          `json:"nodeId"`
+	State       graph.NodeState `json:"state"`
+	StartedAt   *string         `json:"startedAt,omitempty"`
+	CompletedAt *string         `json:"completedAt,omitempty"`
+	DurationMs  int             `json:"durationMs"`
+	Transitions int             `json:"transitions"`
+}
+
+type NodeFilter struct {
+	Types        []graph.NodeType  `json:"types,omitempty"`
+	States       []graph.NodeState `json:"states,omitempty"`
+	NameContains *string           `json:"nameContains,omitempty"`
+}
+
+type NodeInput struct {
+	ID          string         `json:"id"`
+	Type        graph.NodeType `json:"type"`
+	Name        string         `json:"name"`
+	Description *string        `json:"description,omitempty"`
+	Properties  *string        `json:"properties,omitempty"`
+}
+
+type Query struct {
+}
+
+type Run struct {
+	ID           string           `json:"id"`
+	Version      int              `json:"version"`
+	Status       string           `json:"status"`
+	StartedAt    string           `json:"startedAt"`
+	CompletedAt  *string          `json:"completedAt,omitempty"`
+	ErrorMessage *string          `json:"errorMessage,omitempty"`
+	Nodes        []*NodeExecution `json:"nodes"`
+}
+
+type Subscription struct {
+}
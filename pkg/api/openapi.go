@@ -0,0 +1,20 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAPISpec is the OpenAPI 3 document of the /api/v1 routes. It is
+// maintained by hand; update it together with SetupRoutes and the request
+// and response types.
+//
+//go:embed openapi.json
+var OpenAPISpec []byte
+
+// GetOpenAPISpec serves OpenAPISpec so that clients can generate SDKs
+func (h *RESTHandler) GetOpenAPISpec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", OpenAPISpec)
+}
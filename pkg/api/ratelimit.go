@@ -0,0 +1,181 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit is a token bucket: a client may send Burst requests at once and
+// Rate requests per second on average. A Rate of 0 does not limit.
+type RateLimit struct {
+	Rate float64
+	// Burst defaults to Rate, rounded up, and at least 1
+	Burst int
+}
+
+func (l RateLimit) unlimited() bool {
+	return l.Rate <= 0
+}
+
+func (l RateLimit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return int(math.Max(1, math.Ceil(l.Rate)))
+}
+
+// ClientRateLimits are the limits of a single client; unset limits, with a
+// Rate of 0, are those of all clients
+type ClientRateLimits struct {
+	Requests  RateLimit
+	Expensive RateLimit
+}
+
+// RateLimits limits the requests of each client, identified by the name of
+// its identity or, for anonymous requests, by its IP address
+type RateLimits struct {
+	// Requests limits all /api/v1 requests
+	Requests RateLimit
+	// Expensive additionally limits exports and executions
+	Expensive RateLimit
+	// Clients replaces the limits of single clients, by identity name or IP
+	// address, e.g. to grant CI a larger quota
+	Clients map[string]ClientRateLimits
+}
+
+// rateLimiter keeps a token bucket per client
+type rateLimiter struct {
+	limit func(client string) RateLimit
+	// now is the clock of the buckets, replaced in tests
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(limit func(client string) RateLimit) *rateLimiter {
+	return &rateLimiter{
+		limit:     limit,
+		now:       time.Now,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow takes a token from the client's bucket. It returns the tokens left
+// and, if the bucket is empty, how long until the next one.
+func (l *rateLimiter) allow(client string, limit RateLimit, now time.Time) (bool, int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	burst := float64(limit.burst())
+	bucket, ok := l.buckets[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: burst, last: now}
+		l.buckets[client] = bucket
+	}
+	bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.last).Seconds()*limit.Rate)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / limit.Rate * float64(time.Second))
+		return false, 0, wait
+	}
+	bucket.tokens--
+	return true, int(bucket.tokens), 0
+}
+
+// sweep drops the buckets of idle clients once a minute. A dropped bucket
+// is recreated full, so only buckets that have refilled are dropped.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for client, bucket := range l.buckets {
+		limit := l.limit(client)
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*limit.Rate >= float64(limit.burst()) {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// middleware answers requests of clients without tokens left with 429
+func (l *rateLimiter) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client := rateLimitClient(c)
+		limit := l.limit(client)
+		if limit.unlimited() {
+			return
+		}
+
+		ok, remaining, wait := l.allow(client, limit, l.now())
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limit.burst()))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		if !ok {
+			seconds := int(math.Ceil(wait.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error": fmt.Sprintf("Rate limit exceeded, retry in %ds", seconds),
+			})
+		}
+	}
+}
+
+// rateLimitClient identifies the client of a request for rate limiting
+func rateLimitClient(c *gin.Context) string {
+	if identity := IdentityFromContext(c.Request.Context()); identity != nil {
+		return identity.Name
+	}
+	return c.ClientIP()
+}
+
+// SetRateLimits limits the requests of each client; call it before
+// SetupRoutes. Clients over their limit are answered with 429 and a
+// Retry-After header. Requests are limited after authentication, so that
+// authenticated clients are limited by identity rather than address.
+func (h *RESTHandler) SetRateLimits(limits RateLimits) {
+	h.requestLimiter = newRateLimiter(func(client string) RateLimit {
+		if override := limits.Clients[client].Requests; !override.unlimited() {
+			return override
+		}
+		return limits.Requests
+	})
+	h.expensiveLimiter = newRateLimiter(func(client string) RateLimit {
+		if override := limits.Clients[client].Expensive; !override.unlimited() {
+			return override
+		}
+		return limits.Expensive
+	})
+}
+
+// RateLimitMiddleware applies the request limits of SetRateLimits to other
+// routes, such as /graphql, sharing the clients' quotas with /api/v1. Use it
+// after AuthMiddleware.
+func (h *RESTHandler) RateLimitMiddleware() gin.HandlerFunc {
+	if h.requestLimiter == nil {
+		return func(c *gin.Context) {}
+	}
+	return h.requestLimiter.middleware()
+}
+
+// expensiveRateLimit applies the limits of expensive requests
+func (h *RESTHandler) expensiveRateLimit() gin.HandlerFunc {
+	if h.expensiveLimiter == nil {
+		return func(c *gin.Context) {}
+	}
+	return h.expensiveLimiter.middleware()
+}
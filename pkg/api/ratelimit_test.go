@@ -0,0 +1,193 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testClock is a clock that only moves when advanced
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Now()}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// testAPIKeys are the API keys of the clients of startRateLimitedServer
+var testAPIKeys = map[string]string{"ci": "ci-key", "deployer": "deploy-key"}
+
+// startRateLimitedServer serves the routes of a handler limiting requests
+// on clock. The clients of testAPIKeys are authenticated, anonymous clients
+// may read.
+func startRateLimitedServer(t *testing.T, limits RateLimits, clock *testClock) *httptest.Server {
+	t.Helper()
+	h := NewRESTHandler(newTestRepository(t))
+	t.Cleanup(func() { h.Close() })
+	h.SetAuthenticator(NewAPIKeyAuthenticator(testAPIKeys), true)
+	h.SetRateLimits(limits)
+	h.requestLimiter.now = clock.Now
+	h.expensiveLimiter.now = clock.Now
+	return startTestServer(t, h)
+}
+
+// requestAs sends a request with the API key of client, or anonymously
+// with the X-Forwarded-For address if client is an IP address
+func requestAs(t *testing.T, server *httptest.Server, client, method, path string, body interface{}) *testResponse {
+	t.Helper()
+	headers := map[string]string{"X-Forwarded-For": client}
+	if key, ok := testAPIKeys[client]; ok {
+		headers = map[string]string{APIKeyHeader: key}
+	}
+	return doRequest(t, server, method, path, body, headers)
+}
+
+func TestRateLimit_BucketRefills(t *testing.T) {
+	clock := newTestClock()
+	server := startRateLimitedServer(t, RateLimits{Requests: RateLimit{Rate: 1, Burst: 2}}, clock)
+	get := func() *testResponse {
+		return requestAs(t, server, "ci", http.MethodGet, "/api/v1/apps", nil)
+	}
+
+	for _, remaining := range []string{"1", "0"} {
+		resp := get()
+		require.Equal(t, http.StatusOK, resp.StatusCode, string(resp.Body))
+		assert.Equal(t, "2", resp.Header.Get("X-RateLimit-Limit"))
+		assert.Equal(t, remaining, resp.Header.Get("X-RateLimit-Remaining"))
+	}
+
+	resp := get()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+	assert.Equal(t, "0", resp.Header.Get("X-RateLimit-Remaining"))
+	assert.Contains(t, string(resp.Body), "Rate limit exceeded, retry in 1s")
+
+	// Half a token is not enough, and refused requests take none
+	clock.advance(500 * time.Millisecond)
+	resp = get()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+
+	clock.advance(500 * time.Millisecond)
+	resp = get()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "0", resp.Header.Get("X-RateLimit-Remaining"))
+
+	// An idle bucket refills up to the burst only
+	clock.advance(time.Hour)
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, get().StatusCode)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, get().StatusCode)
+}
+
+func TestRateLimit_RetryAfter(t *testing.T) {
+	clock := newTestClock()
+	// A token every 4 seconds
+	server := startRateLimitedServer(t, RateLimits{Requests: RateLimit{Rate: 0.25}}, clock)
+	resp := requestAs(t, server, "ci", http.MethodGet, "/api/v1/apps", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("X-RateLimit-Limit"), "the burst defaults to the rate, at least 1")
+
+	tests := []struct {
+		advance    time.Duration
+		retryAfter string // Rounded up to whole seconds
+	}{
+		{0, "4"},
+		{time.Second, "3"},
+		{2500 * time.Millisecond, "1"},
+	}
+	for _, tt := range tests {
+		clock.advance(tt.advance)
+		resp := requestAs(t, server, "ci", http.MethodGet, "/api/v1/apps", nil)
+		require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.Equal(t, tt.retryAfter, resp.Header.Get("Retry-After"))
+	}
+	clock.advance(500 * time.Millisecond)
+	assert.Equal(t, http.StatusOK, requestAs(t, server, "ci", http.MethodGet, "/api/v1/apps", nil).StatusCode)
+}
+
+func TestRateLimit_BucketPerClient(t *testing.T) {
+	clock := newTestClock()
+	server := startRateLimitedServer(t, RateLimits{
+		Requests: RateLimit{Rate: 1},
+		Clients:  map[string]ClientRateLimits{"deployer": {Requests: RateLimit{Rate: 1, Burst: 3}}},
+	}, clock)
+	get := func(client string) int {
+		return requestAs(t, server, client, http.MethodGet, "/api/v1/apps", nil).StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, get("ci"))
+	assert.Equal(t, http.StatusTooManyRequests, get("ci"))
+
+	// Anonymous clients are limited by address
+	assert.Equal(t, http.StatusOK, get("192.0.2.1"))
+	assert.Equal(t, http.StatusTooManyRequests, get("192.0.2.1"))
+	assert.Equal(t, http.StatusOK, get("192.0.2.2"))
+
+	// deployer has a larger quota of its own
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, get("deployer"), "request %d", i+1)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, get("deployer"))
+	assert.Equal(t, http.StatusTooManyRequests, get("ci"))
+}
+
+func TestRateLimit_Expensive(t *testing.T) {
+	clock := newTestClock()
+	server := startRateLimitedServer(t, RateLimits{
+		Requests:  RateLimit{Rate: 10},
+		Expensive: RateLimit{Rate: 1},
+	}, clock)
+	exportPath := "/api/v1/graph/export?app=" + testApp
+	body := map[string]string{"format": "json"}
+
+	resp := requestAs(t, server, "ci", http.MethodPost, exportPath, body)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(resp.Body))
+	resp = requestAs(t, server, "ci", http.MethodPost, exportPath, body)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+
+	// Cheap requests and other clients keep their quota
+	assert.Equal(t, http.StatusOK, requestAs(t, server, "ci", http.MethodGet, "/api/v1/apps", nil).StatusCode)
+	assert.Equal(t, http.StatusOK, requestAs(t, server, "deployer", http.MethodPost, exportPath, body).StatusCode)
+
+	clock.advance(time.Second)
+	assert.Equal(t, http.StatusOK, requestAs(t, server, "ci", http.MethodPost, exportPath, body).StatusCode)
+}
+
+func TestRateLimiter_SweepsIdleBuckets(t *testing.T) {
+	limit := RateLimit{Rate: 1, Burst: 2}
+	limiter := newRateLimiter(func(string) RateLimit { return limit })
+	start := limiter.lastSweep
+
+	limiter.allow("idle", limit, start)
+	limiter.allow("busy", limit, start.Add(59*time.Second))
+	limiter.allow("busy", limit, start.Add(59*time.Second))
+
+	// A minute later the refilled bucket of idle is dropped, the empty one
+	// of busy is kept
+	limiter.allow("new", limit, start.Add(time.Minute))
+	assert.Len(t, limiter.buckets, 2)
+	assert.Contains(t, limiter.buckets, "busy")
+	assert.NotContains(t, limiter.buckets, "idle")
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Role grants access to the apps of a RoleBinding. Each role includes the
+// permissions of the roles before it.
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"   // Reads graphs, runs and events
+	RoleEditor   Role = "editor"   // Also changes graphs and app metadata
+	RoleOperator Role = "operator" // Also executes graphs, manages runs, sets node states, deletes apps and reads the audit log
+)
+
+// nodeStateRole may set the states of nodes, over REST and GraphQL alike.
+// Node states are set by runs, so changing them by hand is an operator's
+// task like managing runs.
+const nodeStateRole = RoleOperator
+
+// rank orders the roles; 0 is not a role
+func (r Role) rank() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleEditor:
+		return 2
+	case RoleOperator:
+		return 3
+	}
+	return 0
+}
+
+// Subjects of role bindings that are not identity names
+const (
+	SubjectEveryone    = "*"      // Every caller, including anonymous ones
+	SubjectGroupPrefix = "group:" // Followed by a group of the caller's token
+)
+
+// RoleBinding grants Role to Subject on one app or on every app of a tenant
+type RoleBinding struct {
+	// Subject is an Identity name, "group:" and a group name, or "*"
+	Subject string `json:"subject" yaml:"subject"`
+	Role    Role   `json:"role" yaml:"role"`
+	// TenantID is the tenant the binding applies to; the zero value is
+	// storage.DefaultTenantID
+	TenantID uuid.UUID `json:"tenant_id,omitempty" yaml:"tenant_id,omitempty"`
+	// App limits the binding to one app; empty for every app of the tenant
+	App string `json:"app,omitempty" yaml:"app,omitempty"`
+}
+
+// Authorizer decides which role callers have on an app from a fixed set of
+// role bindings
+type Authorizer struct {
+	bindings []RoleBinding
+}
+
+// NewAuthorizer checks bindings and returns an Authorizer enforcing them
+func NewAuthorizer(bindings []RoleBinding) (*Authorizer, error) {
+	for i, binding := range bindings {
+		if binding.Subject == "" {
+			return nil, fmt.Errorf("role binding %d: subject is required", i)
+		}
+		if binding.Role.rank() == 0 {
+			return nil, fmt.Errorf("role binding %d: invalid role: %s", i, binding.Role)
+		}
+	}
+	return &Authorizer{bindings: append([]RoleBinding(nil), bindings...)}, nil
+}
+
+// Role returns the highest role identity has on app of tenantID, or "" if
+// it has none. An empty app asks for the role on every app of the tenant.
+// Anonymous callers (a nil identity) only get roles bound to "*".
+func (a *Authorizer) Role(identity *Identity, tenantID uuid.UUID, app string) Role {
+	var role Role
+	for _, binding := range a.bindings {
+		if binding.TenantID != tenantID || (binding.App != "" && binding.App != app) {
+			continue
+		}
+		if !binding.matches(identity) {
+			continue
+		}
+		if binding.Role.rank() > role.rank() {
+			role = binding.Role
+		}
+	}
+	return role
+}
+
+// Allowed reports whether identity has at least role required on app of
+// tenantID
+func (a *Authorizer) Allowed(identity *Identity, tenantID uuid.UUID, app string, required Role) bool {
+	return a.Role(identity, tenantID, app).rank() >= required.rank()
+}
+
+func (b RoleBinding) matches(identity *Identity) bool {
+	if b.Subject == SubjectEveryone {
+		return true
+	}
+	if identity == nil {
+		return false
+	}
+	if group, ok := strings.CutPrefix(b.Subject, SubjectGroupPrefix); ok {
+		for _, member := range identity.Groups {
+			if member == group {
+				return true
+			}
+		}
+		return false
+	}
+	return b.Subject == identity.Name
+}
+
+// authorize returns an error unless the caller in ctx has at least role
+// required on app of the tenant in ctx. Without an authorizer every caller
+// is allowed.
+func authorize(ctx context.Context, authorizer *Authorizer, app string, required Role) error {
+	if authorizer == nil {
+		return nil
+	}
+	if !authorizer.Allowed(IdentityFromContext(ctx), storage.TenantFromContext(ctx), app, required) {
+		if app == "" {
+			return fmt.Errorf("access denied: %s role on the tenant required", required)
+		}
+		return fmt.Errorf("access denied: %s role on app %s required", required, app)
+	}
+	return nil
+}
+
+// visibleApps keeps the apps the caller in ctx may view
+func visibleApps(ctx context.Context, authorizer *Authorizer, apps []storage.AppSummary) []storage.AppSummary {
+	if authorizer == nil {
+		return apps
+	}
+	visible := apps[:0]
+	for _, app := range apps {
+		if authorize(ctx, authorizer, app.Name, RoleViewer) == nil {
+			visible = append(visible, app)
+		}
+	}
+	return visible
+}
+
+// guard enforces authentication and the role required by a route. The app
+// is taken from the path or the app query parameter, or for run routes from
+// the run. Viewer routes without an app only list apps, which ListApps
+// filters to the apps the caller may view, so they are not checked here.
+func (h *RESTHandler) guard(required Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		if h.authenticator != nil && IdentityFromContext(ctx) == nil && (required != RoleViewer || !h.anonymousReads) {
+			c.Header("WWW-Authenticate", `Bearer realm="innominatus-graph"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+		if h.authorizer == nil {
+			return
+		}
+
+		app := c.Param("app")
+		if app == "" {
+			app = c.Query("app")
+		}
+		if app == "" && c.Param("runId") != "" {
+			runID, err := parseUUID(c.Param("runId"))
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid run ID"})
+				return
+			}
+			run, err := h.repo(c).GetGraphRun(runID)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Failed to get graph run: " + err.Error()})
+				return
+			}
+			app = run.App.Name
+		}
+		if app == "" && required == RoleViewer {
+			return
+		}
+
+		if err := authorize(ctx, h.authorizer, app, required); err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		}
+	}
+}
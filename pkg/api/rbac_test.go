@@ -0,0 +1,277 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAuthorizer(t *testing.T) {
+	_, err := NewAuthorizer([]RoleBinding{{Role: RoleViewer}})
+	assert.ErrorContains(t, err, "subject is required")
+	_, err = NewAuthorizer([]RoleBinding{{Subject: "alice", Role: "admin"}})
+	assert.ErrorContains(t, err, "invalid role: admin")
+	_, err = NewAuthorizer(nil)
+	assert.NoError(t, err)
+}
+
+func TestAuthorizer_Role(t *testing.T) {
+	otherTenant := uuid.New()
+	authorizer, err := NewAuthorizer([]RoleBinding{
+		{Subject: "alice", Role: RoleEditor, App: "shop"},
+		{Subject: "group:platform", Role: RoleOperator},
+		{Subject: SubjectEveryone, Role: RoleViewer, TenantID: otherTenant},
+		{Subject: "bob", Role: RoleViewer},
+		{Subject: "bob", Role: RoleOperator, App: "shop"},
+	})
+	require.NoError(t, err)
+
+	alice := &Identity{Name: "alice"}
+	platform := &Identity{Name: "carol", Groups: []string{"dev", "platform"}}
+	bob := &Identity{Name: "bob"}
+	tests := []struct {
+		name     string
+		identity *Identity
+		tenantID uuid.UUID
+		app      string
+		want     Role
+	}{
+		{"bound app", alice, storage.DefaultTenantID, "shop", RoleEditor},
+		{"other app", alice, storage.DefaultTenantID, "billing", ""},
+		{"app binding does not cover the tenant", alice, storage.DefaultTenantID, "", ""},
+		{"group on every app", platform, storage.DefaultTenantID, "billing", RoleOperator},
+		{"group on the tenant", platform, storage.DefaultTenantID, "", RoleOperator},
+		{"group of other tenant", platform, otherTenant, "shop", RoleViewer},
+		{"highest role of the bindings", bob, storage.DefaultTenantID, "shop", RoleOperator},
+		{"tenant binding", bob, storage.DefaultTenantID, "billing", RoleViewer},
+		{"anonymous", nil, storage.DefaultTenantID, "shop", ""},
+		{"anonymous with everyone binding", nil, otherTenant, "shop", RoleViewer},
+		{"name is not a group", &Identity{Name: "platform"}, storage.DefaultTenantID, "shop", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, authorizer.Role(tt.identity, tt.tenantID, tt.app))
+		})
+	}
+	assert.True(t, authorizer.Allowed(bob, storage.DefaultTenantID, "shop", RoleEditor))
+	assert.False(t, authorizer.Allowed(alice, storage.DefaultTenantID, "shop", RoleOperator))
+}
+
+// guardedRoute is a route of SetupRoutes with the role it requires
+type guardedRoute struct {
+	path string // With the parameters filled in
+	role Role
+	// appless routes are not checked by guard, as the handler filters or
+	// checks the apps itself
+	appless bool
+}
+
+// guardedRoutes returns the routes of /api/v1 by method and pattern,
+// with runID filled in
+func guardedRoutes(runID uuid.UUID) map[string]guardedRoute {
+	run := "/api/v1/runs/" + runID.String()
+	app := "/api/v1/apps/" + testApp
+	return map[string]guardedRoute{
+		"GET /api/v1/graph":                           {path: "/api/v1/graph?app=" + testApp, role: RoleViewer},
+		"POST /api/v1/graphs:method":                  {path: "/api/v1/graphs:batchGet", role: RoleViewer, appless: true},
+		"POST /api/v1/graph/export":                   {path: "/api/v1/graph/export?app=" + testApp, role: RoleViewer},
+		"POST /api/v1/exports":                        {path: "/api/v1/exports?app=" + testApp, role: RoleViewer},
+		"GET /api/v1/exports/:exportId":               {path: "/api/v1/exports/" + uuid.NewString(), role: RoleViewer, appless: true},
+		"GET /api/v1/apps":                            {path: "/api/v1/apps", role: RoleViewer, appless: true},
+		"DELETE /api/v1/apps/:app":                    {path: app, role: RoleOperator},
+		"POST /api/v1/apps/:app/restore":              {path: app + "/restore", role: RoleOperator},
+		"GET /api/v1/apps/:app/metadata":              {path: app + "/metadata", role: RoleViewer},
+		"PUT /api/v1/apps/:app/metadata":              {path: app + "/metadata", role: RoleEditor},
+		"POST /api/v1/apps/:app/graph":                {path: app + "/graph", role: RoleEditor},
+		"POST /api/v1/apps/:app/diff":                 {path: app + "/diff", role: RoleViewer},
+		"GET /api/v1/apps/:app/layout":                {path: app + "/layout", role: RoleViewer},
+		"DELETE /api/v1/apps/:app/graph":              {path: app + "/graph", role: RoleEditor},
+		"POST /api/v1/apps/:app/nodes":                {path: app + "/nodes", role: RoleEditor},
+		"PUT /api/v1/apps/:app/nodes/:nodeId":         {path: app + "/nodes/db", role: RoleEditor},
+		"DELETE /api/v1/apps/:app/nodes/:nodeId":      {path: app + "/nodes/db", role: RoleEditor},
+		"PATCH /api/v1/apps/:app/nodes/:nodeId/state": {path: app + "/nodes/db/state", role: RoleOperator},
+		"GET /api/v1/apps/:app/nodes/:nodeId/history": {path: app + "/nodes/db/history", role: RoleViewer},
+		"POST /api/v1/apps/:app/edges":                {path: app + "/edges", role: RoleEditor},
+		"PUT /api/v1/apps/:app/edges/:edgeId":         {path: app + "/edges/e1", role: RoleEditor},
+		"DELETE /api/v1/apps/:app/edges/:edgeId":      {path: app + "/edges/e1", role: RoleEditor},
+		"GET /api/v1/apps/:app/runs":                  {path: app + "/runs", role: RoleViewer},
+		"POST /api/v1/apps/:app/runs":                 {path: app + "/runs", role: RoleOperator},
+		"DELETE /api/v1/apps/:app/runs":               {path: app + "/runs", role: RoleOperator},
+		"GET /api/v1/apps/:app/runs/recent":           {path: app + "/runs/recent", role: RoleViewer},
+		"POST /api/v1/apps/:app/execute":              {path: app + "/execute", role: RoleOperator},
+		"GET /api/v1/apps/:app/events":                {path: app + "/events", role: RoleViewer},
+		"GET /api/v1/runs/:runId":                     {path: run, role: RoleViewer},
+		"GET /api/v1/runs/:runId/nodes":               {path: run + "/nodes", role: RoleViewer},
+		"PUT /api/v1/runs/:runId":                     {path: run, role: RoleOperator},
+		"POST /api/v1/runs/:runId/cancel":             {path: run + "/cancel", role: RoleOperator},
+		"GET /api/v1/audit":                           {path: "/api/v1/audit", role: RoleOperator},
+	}
+}
+
+// testKeys are the API keys of the callers of the guard tests, by name
+var testKeys = map[string]string{
+	"stranger": "stranger-key", // No role
+	"vera":     "viewer-key",
+	"eddie":    "editor-key",
+	"olga":     "operator-key",
+}
+
+func TestGuard_RolesOfRoutes(t *testing.T) {
+	callers := []struct {
+		name string
+		role Role
+	}{{"stranger", ""}, {"vera", RoleViewer}, {"eddie", RoleEditor}, {"olga", RoleOperator}}
+	authorizer, err := NewAuthorizer([]RoleBinding{
+		{Subject: "vera", Role: RoleViewer, App: testApp},
+		{Subject: "eddie", Role: RoleEditor, App: testApp},
+		{Subject: "olga", Role: RoleOperator},
+	})
+	require.NoError(t, err)
+
+	// Every route of SetupRoutes is listed
+	routes := guardedRoutes(uuid.Nil)
+	listed := 0
+	for _, route := range listRoutes(t) {
+		if strings.Contains(route, " /api/v1/") {
+			assert.Contains(t, routes, route, "role of %s not tested", route)
+			listed++
+		}
+	}
+	assert.Equal(t, len(routes), listed)
+
+	for route := range routes {
+		t.Run(route, func(t *testing.T) {
+			// Each route gets its own database, as the callers may change it
+			repo := newTestRepository(t)
+			runID := queueTestRun(t, repo)
+			h := NewRESTHandler(repo)
+			defer h.Close()
+			h.SetAuthenticator(NewAPIKeyAuthenticator(testKeys), false)
+			h.SetAuthorizer(authorizer)
+			server := startTestServer(t, h)
+			method, _, _ := strings.Cut(route, " ")
+			expected := guardedRoutes(runID)[route]
+
+			for _, caller := range callers {
+				resp := doRequest(t, server, method, expected.path, nil, map[string]string{APIKeyHeader: testKeys[caller.name]})
+				allowed := caller.role.rank() >= expected.role.rank() || (expected.appless && expected.role == RoleViewer)
+				if allowed {
+					assert.NotContains(t, []int{http.StatusUnauthorized, http.StatusForbidden}, resp.StatusCode,
+						"%s (%s) is allowed: %s", caller.name, caller.role, resp.Body)
+				} else {
+					assert.Equal(t, http.StatusForbidden, resp.StatusCode, "%s (%s) is denied: %s", caller.name, caller.role, resp.Body)
+					assert.Contains(t, string(resp.Body), "access denied: "+string(expected.role)+" role")
+				}
+			}
+
+			resp := doRequest(t, server, method, expected.path, nil, nil)
+			assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "anonymous")
+		})
+	}
+}
+
+// listRoutes returns the routes of SetupRoutes as method and pattern
+func listRoutes(t *testing.T) []string {
+	t.Helper()
+	router := newTestRouter(NewRESTHandler(newTestRepository(t)))
+	var routes []string
+	for _, route := range router.Routes() {
+		routes = append(routes, route.Method+" "+route.Path)
+	}
+	return routes
+}
+
+func TestGuard_AnonymousReads(t *testing.T) {
+	repo := newTestRepository(t)
+	runID := queueTestRun(t, repo)
+	routes := guardedRoutes(runID)
+
+	// Without an authorizer, anonymous callers may read but not change
+	h := NewRESTHandler(repo)
+	defer h.Close()
+	h.SetAuthenticator(NewAPIKeyAuthenticator(testKeys), true)
+	server := startTestServer(t, h)
+	for route, expected := range routes {
+		if expected.role != RoleViewer {
+			continue
+		}
+		method, _, _ := strings.Cut(route, " ")
+		resp := doRequest(t, server, method, expected.path, nil, nil)
+		assert.NotEqual(t, http.StatusUnauthorized, resp.StatusCode, "%s is open: %s", route, resp.Body)
+	}
+	for route, expected := range routes {
+		if expected.role == RoleViewer {
+			continue
+		}
+		method, _, _ := strings.Cut(route, " ")
+		resp := doRequest(t, server, method, expected.path, nil, nil)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "%s needs credentials", route)
+		assert.Equal(t, `Bearer realm="innominatus-graph"`, resp.Header.Get("WWW-Authenticate"))
+	}
+
+	// With one, anonymous callers read the apps bound to everyone
+	authorizer, err := NewAuthorizer([]RoleBinding{{Subject: SubjectEveryone, Role: RoleViewer, App: "public"}})
+	require.NoError(t, err)
+	require.NoError(t, repo.SaveGraph("public", newTestGraph("public")))
+	h = NewRESTHandler(repo)
+	defer h.Close()
+	h.SetAuthenticator(NewAPIKeyAuthenticator(testKeys), true)
+	h.SetAuthorizer(authorizer)
+	server = startTestServer(t, h)
+
+	resp := doRequest(t, server, http.MethodGet, "/api/v1/graph?app=public", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, string(resp.Body))
+	resp = doRequest(t, server, http.MethodGet, "/api/v1/graph?app="+testApp, nil, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = doRequest(t, server, http.MethodGet, "/api/v1/apps", nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var apps struct {
+		Apps []storage.AppSummary `json:"apps"`
+	}
+	resp.decode(t, &apps)
+	require.Len(t, apps.Apps, 1, "only the apps anonymous callers may view are listed")
+	assert.Equal(t, "public", apps.Apps[0].Name)
+	resp = doRequest(t, server, http.MethodGet, "/api/v1/runs/"+runID.String(), nil, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "runs are checked on their app")
+	resp = doRequest(t, server, http.MethodPut, "/api/v1/apps/public/metadata", graph.AppMetadata{Owner: "me"}, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestUpdateNodeState_RoleOfRESTAndGraphQL(t *testing.T) {
+	authorizer, err := NewAuthorizer([]RoleBinding{
+		{Subject: "eddie", Role: RoleEditor},
+		{Subject: "olga", Role: RoleOperator},
+	})
+	require.NoError(t, err)
+	repo := newTestRepository(t)
+	resolver := NewResolver(repo)
+	resolver.SetAuthorizer(authorizer)
+	h := NewRESTHandler(repo)
+	defer h.Close()
+	h.SetAuthenticator(NewAPIKeyAuthenticator(testKeys), false)
+	h.SetAuthorizer(authorizer)
+	server := startTestServer(t, h)
+
+	for _, caller := range []string{"eddie", "olga"} {
+		allowed := caller == "olga"
+		ctx := WithIdentity(context.Background(), &Identity{Name: caller})
+		_, err := resolver.Mutation().UpdateNodeState(ctx, testApp, "db", graph.NodeStateRunning)
+		resp := doRequest(t, server, http.MethodPatch, "/api/v1/apps/"+testApp+"/nodes/db/state",
+			NodeStateRequest{State: graph.NodeStateRunning}, map[string]string{APIKeyHeader: testKeys[caller]})
+		if allowed {
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode, string(resp.Body))
+		} else {
+			assert.ErrorContains(t, err, "access denied: "+string(nodeStateRole)+" role")
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		}
+	}
+}
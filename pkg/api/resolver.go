@@ -0,0 +1,193 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/events"
+	"github.com/philipsahli/innominatus-graph/pkg/execution"
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+)
+
+// This file will not be regenerated automatically.
+//
+// It serves as dependency injection for your app, add any dependencies you require here.
+
+type Resolver struct {
+	repository storage.RepositoryInterface
+	runner     execution.WorkflowRunner
+	traces     *execution.TraceExporter
+	queue      *runQueue
+	events     *events.Dispatcher
+	authorizer *Authorizer
+
+	// statesPolled leaves publishing state changes to an events.StatePoller
+	statesPolled bool
+}
+
+func NewResolver(repository storage.RepositoryInterface) *Resolver {
+	return &Resolver{
+		repository: repository,
+		events:     events.NewDispatcher(events.DispatcherOptions{}),
+	}
+}
+
+// SetWorkflowRunner enables the executeGraph mutation, running workflows
+// with runner. Without a runner the mutation fails.
+func (r *Resolver) SetWorkflowRunner(runner execution.WorkflowRunner) {
+	r.runner = runner
+}
+
+// SetTraceExporter sends the runs started by executeGraph to an
+// OpenTelemetry collector once they finish
+func (r *Resolver) SetTraceExporter(traces *execution.TraceExporter) {
+	r.traces = traces
+}
+
+// SetRunQueue makes executeGraph queue its runs like
+// RESTHandler.SetRunQueue
+func (r *Resolver) SetRunQueue(worker *execution.Worker) {
+	r.queue = &runQueue{worker: worker}
+}
+
+// SetEventDispatcher replaces the dispatcher feeding the nodeStateChanged
+// subscription; share one dispatcher with the RESTHandler so that
+// subscribers of either API see the executions started through both
+func (r *Resolver) SetEventDispatcher(dispatcher *events.Dispatcher) {
+	r.events = dispatcher
+}
+
+// SetStateChangesPolled stops the mutations from publishing their state
+// changes like RESTHandler.SetStateChangesPolled
+func (r *Resolver) SetStateChangesPolled() {
+	r.statesPolled = true
+}
+
+// SetAuthorizer enforces the roles of authorizer like
+// RESTHandler.SetAuthorizer: viewer for queries and subscriptions, editor
+// for saveGraph, operator for updateNodeState and executeGraph
+func (r *Resolver) SetAuthorizer(authorizer *Authorizer) {
+	r.authorizer = authorizer
+}
+
+// repo returns the repository scoped to the tenant in ctx
+func (r *Resolver) repo(ctx context.Context) storage.RepositoryInterface {
+	return r.repository.ForTenant(ctx)
+}
+
+// formatTime formats timestamps for the String fields of the schema
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
+
+// formatOptionalTime formats t, leaving unset timestamps null
+func formatOptionalTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := formatTime(*t)
+	return &formatted
+}
+
+// formatProperties encodes properties as the JSON string of the schema
+func formatProperties(properties map[string]interface{}) (*string, error) {
+	if properties == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(properties)
+	if err != nil {
+		return nil, err
+	}
+	result := string(data)
+	return &result, nil
+}
+
+// parseProperties decodes the JSON object of a properties input
+func parseProperties(properties *string) (map[string]interface{}, error) {
+	if properties == nil || *properties == "" {
+		return nil, nil
+	}
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(*properties), &parsed); err != nil {
+		return nil, fmt.Errorf("properties must be a JSON object: %w", err)
+	}
+	return parsed, nil
+}
+
+// inputGraph validates and assembles the graph of appName from input like
+// ImportGraph does
+func inputGraph(appName string, input GraphInput) (*graph.Graph, error) {
+	var details []string
+	nodes := make([]*graph.Node, 0, len(input.Nodes))
+	for _, node := range input.Nodes {
+		properties, err := parseProperties(node.Properties)
+		if err != nil {
+			details = append(details, fmt.Sprintf("node %s: %v", node.ID, err))
+		}
+		nodes = append(nodes, &graph.Node{
+			ID:          node.ID,
+			Type:        node.Type,
+			Name:        node.Name,
+			Description: valueOf(node.Description),
+			Properties:  properties,
+		})
+	}
+
+	edges := make([]*graph.Edge, 0, len(input.Edges))
+	for _, edge := range input.Edges {
+		properties, err := parseProperties(edge.Properties)
+		if err != nil {
+			details = append(details, fmt.Sprintf("edge %s: %v", edge.ID, err))
+		}
+		edges = append(edges, &graph.Edge{
+			ID:          edge.ID,
+			FromNodeID:  edge.FromNodeID,
+			ToNodeID:    edge.ToNodeID,
+			Type:        edge.Type,
+			Description: valueOf(edge.Description),
+			Properties:  properties,
+		})
+	}
+	if len(details) > 0 {
+		return nil, &importError{details: details}
+	}
+	return buildGraph(appName, nodes, edges)
+}
+
+// runResult converts a stored run and its node executions to the schema's
+// Run
+func runResult(run *storage.GraphRunModel, executions []storage.NodeExecutionRecord) *Run {
+	result := &Run{
+		ID:          run.ID.String(),
+		Version:     run.Version,
+		Status:      run.Status,
+		StartedAt:   formatTime(run.StartedAt),
+		CompletedAt: formatOptionalTime(run.CompletedAt),
+		Nodes:       make([]*NodeExecution, 0, len(executions)),
+	}
+	if run.ErrorMessage != "" {
+		errorMessage := run.ErrorMessage
+		result.ErrorMessage = &errorMessage
+	}
+	for _, record := range executions {
+		result.Nodes = append(result.Nodes, &NodeExecution{
+			NodeID:      record.NodeID,
+			State:       graph.NodeState(record.State),
+			StartedAt:   formatOptionalTime(record.StartedAt),
+			CompletedAt: formatOptionalTime(record.CompletedAt),
+			DurationMs:  int(record.DurationMs),
+			Transitions: record.Transitions,
+		})
+	}
+	return result
+}
+
+func valueOf(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,1122 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/philipsahli/innominatus-graph/pkg/events"
+	"github.com/philipsahli/innominatus-graph/pkg/execution"
+	"github.com/philipsahli/innominatus-graph/pkg/export"
+	"github.com/philipsahli/innominatus-graph/pkg/layout"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type RESTHandler struct {
+	repository storage.RepositoryInterface
+	exporter   *export.Exporter
+	layouts    *layout.LayoutCache // Shared by exports and the layout endpoint
+	runner     execution.WorkflowRunner
+	traces     *execution.TraceExporter
+	queue      *runQueue
+	events     *events.Dispatcher
+	exports    *exportJobs
+
+	// statesPolled leaves publishing state changes to an events.StatePoller
+	statesPolled bool
+
+	authenticator  Authenticator
+	anonymousReads bool
+	authorizer     *Authorizer
+
+	requestLimiter   *rateLimiter
+	expensiveLimiter *rateLimiter
+
+	// edits serializes the load, change and save of node and edge edits, so
+	// that concurrent edits do not drop each other's changes
+	edits sync.Mutex
+}
+
+// NewRESTHandler creates a handler serving graphs from repository. Layouts
+// of exports that place nodes and of the layout endpoint are cached, as
+// laying out a graph on every request dominates the export latency.
+func NewRESTHandler(repository storage.RepositoryInterface) *RESTHandler {
+	exporter := export.NewExporter()
+	layouts := layout.NewLayoutCache(0)
+	exporter.SetLayoutCache(layouts)
+	return &RESTHandler{
+		repository: repository,
+		exporter:   exporter,
+		layouts:    layouts,
+		events:     events.NewDispatcher(events.DispatcherOptions{}),
+		exports:    newExportJobs(exporter, ExportJobLimits{}),
+	}
+}
+
+// SetWorkflowRunner enables executions over the API, running workflows
+// with runner. Without a runner execute requests are answered with 501.
+func (h *RESTHandler) SetWorkflowRunner(runner execution.WorkflowRunner) {
+	h.runner = runner
+}
+
+// SetRunQueue makes execute requests queue their runs in the database
+// instead of executing them in this process, for several replicas sharing
+// one database: the execution.Worker of every replica with a runner claims
+// queued runs, and each run is executed by exactly one of them. worker is
+// this replica's worker, woken when a run is queued here, or nil for
+// replicas that only queue runs.
+func (h *RESTHandler) SetRunQueue(worker *execution.Worker) {
+	h.queue = &runQueue{worker: worker}
+}
+
+// SetTraceExporter sends the runs of executions started over the API to an
+// OpenTelemetry collector once they finish
+func (h *RESTHandler) SetTraceExporter(traces *execution.TraceExporter) {
+	h.traces = traces
+}
+
+// SetEventDispatcher replaces the dispatcher that executions and state
+// updates publish their events to and that the event streams subscribe to,
+// to share it with the GraphQL Resolver and other subscribers
+func (h *RESTHandler) SetEventDispatcher(dispatcher *events.Dispatcher) {
+	h.events = dispatcher
+}
+
+// SetStateChangesPolled stops executions and state updates from publishing
+// their state changes to the event dispatcher, for servers whose
+// events.StatePoller publishes the changes recorded by every replica,
+// including this one, which would otherwise be delivered twice
+func (h *RESTHandler) SetStateChangesPolled() {
+	h.statesPolled = true
+}
+
+// SetAuthenticator requires the routes to be called with credentials that
+// authenticator accepts; call it before SetupRoutes. With anonymousReads,
+// requests reading graphs, runs and events may omit credentials. Without an
+// authenticator every request is served and the actor is taken from
+// ActorHeader.
+func (h *RESTHandler) SetAuthenticator(authenticator Authenticator, anonymousReads bool) {
+	h.authenticator = authenticator
+	h.anonymousReads = anonymousReads
+}
+
+// SetAuthorizer enforces the roles of authorizer on every route: viewer to
+// read, editor to change graphs and operator to run them. Without an
+// authorizer every authenticated caller may do everything.
+func (h *RESTHandler) SetAuthorizer(authorizer *Authorizer) {
+	h.authorizer = authorizer
+}
+
+func (h *RESTHandler) Close() error {
+	return h.exporter.Close()
+}
+
+// TenantHeader selects the tenant a request operates on. Requests without
+// the header use storage.DefaultTenantID.
+const TenantHeader = "X-Tenant-ID"
+
+// TenantMiddleware stores the tenant from TenantHeader in the request context
+func TenantMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader(TenantHeader)
+		if header == "" {
+			c.Next()
+			return
+		}
+
+		tenantID, err := uuid.Parse(header)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid " + TenantHeader + " header"})
+			return
+		}
+
+		c.Request = c.Request.WithContext(storage.WithTenant(c.Request.Context(), tenantID))
+		c.Next()
+	}
+}
+
+// ActorHeader names the user or service a request acts for. It is recorded
+// in the audit log; requests without the header are audited as
+// storage.SystemActor.
+const ActorHeader = "X-Actor"
+
+// ActorMiddleware stores the actor from ActorHeader in the request context
+func ActorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if actor := c.GetHeader(ActorHeader); actor != "" {
+			c.Request = c.Request.WithContext(storage.WithActor(c.Request.Context(), actor))
+		}
+		c.Next()
+	}
+}
+
+// repo returns the repository scoped to the request's tenant and actor
+func (h *RESTHandler) repo(c *gin.Context) storage.RepositoryInterface {
+	return h.repository.ForTenant(c.Request.Context())
+}
+
+// SetupRoutes registers the /api/v1 routes, their OpenAPI document at
+// /openapi.json and the graph viewer at /ui. The document and the viewer's
+// assets are served without authentication.
+func (h *RESTHandler) SetupRoutes(r *gin.Engine) {
+	r.GET("/openapi.json", h.GetOpenAPISpec)
+	setupUI(r)
+
+	api := r.Group("/api/v1", TenantMiddleware(), ActorMiddleware())
+	if h.authenticator != nil {
+		api.Use(AuthMiddleware(h.authenticator))
+	}
+	api.Use(h.RateLimitMiddleware())
+	viewer, editor, operator := h.guard(RoleViewer), h.guard(RoleEditor), h.guard(RoleOperator)
+	expensive := h.expensiveRateLimit()
+	{
+		api.GET("/graph", viewer, h.GetGraph)
+		// Custom methods such as /graphs:batchGet; gin only honours escaped
+		// colons in routes when serving through Engine.Run
+		api.POST("/graphs:method", viewer, h.GraphsMethod)
+		api.POST("/graph/export", viewer, expensive, h.ExportGraph)
+		api.POST("/exports", viewer, expensive, h.CreateExportJob)
+		api.GET("/exports/:exportId", viewer, h.GetExportJob)
+		api.GET("/apps", viewer, h.ListApps)
+		api.DELETE("/apps/:app", operator, h.DeleteApp)
+		api.POST("/apps/:app/restore", operator, h.RestoreApp)
+		api.GET("/apps/:app/metadata", viewer, h.GetAppMetadata)
+		api.PUT("/apps/:app/metadata", editor, h.SetAppMetadata)
+		api.POST("/apps/:app/graph", editor, h.ImportGraph)
+		api.POST("/apps/:app/diff", viewer, h.DiffGraph)
+		api.GET("/apps/:app/layout", viewer, h.GetLayout)
+		api.DELETE("/apps/:app/graph", editor, h.DeleteGraph)
+		api.POST("/apps/:app/nodes", editor, h.CreateNode)
+		api.PUT("/apps/:app/nodes/:nodeId", editor, h.UpdateNode)
+		api.DELETE("/apps/:app/nodes/:nodeId", editor, h.DeleteNode)
+		api.PATCH("/apps/:app/nodes/:nodeId/state", h.guard(nodeStateRole), h.UpdateNodeState)
+		api.GET("/apps/:app/nodes/:nodeId/history", viewer, h.GetNodeStateHistory)
+		api.POST("/apps/:app/edges", editor, h.CreateEdge)
+		api.PUT("/apps/:app/edges/:edgeId", editor, h.UpdateEdge)
+		api.DELETE("/apps/:app/edges/:edgeId", editor, h.DeleteEdge)
+		api.GET("/apps/:app/runs", viewer, h.GetGraphRuns)
+		api.POST("/apps/:app/runs", operator, h.CreateGraphRun)
+		api.DELETE("/apps/:app/runs", operator, h.PruneGraphRuns)
+		api.GET("/apps/:app/runs/recent", viewer, h.GetRecentRuns)
+		api.POST("/apps/:app/execute", operator, expensive, h.ExecuteGraph)
+		api.GET("/apps/:app/events", viewer, h.StreamEvents)
+		api.GET("/runs/:runId", viewer, h.GetGraphRun)
+		api.GET("/runs/:runId/nodes", viewer, h.GetRunNodeExecutions)
+		api.PUT("/runs/:runId", operator, h.UpdateGraphRun)
+		api.POST("/runs/:runId/cancel", operator, h.CancelGraphRun)
+		api.GET("/audit", operator, h.GetAuditLog)
+	}
+}
+
+type GetGraphResponse struct {
+	Graph   interface{} `json:"graph"`
+	AppName string      `json:"app_name"`
+	Version int         `json:"version,omitempty"`
+}
+
+func (h *RESTHandler) GetGraph(c *gin.Context) {
+	appName := c.Query("app")
+	if appName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "app parameter is required"})
+		return
+	}
+
+	graph, err := h.repo(c).LoadGraph(appName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Graph not found: " + err.Error()})
+		return
+	}
+
+	response := GetGraphResponse{
+		Graph:   graph,
+		AppName: appName,
+		Version: graph.Version,
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+type ExportRequest struct {
+	Format  string   `json:"format" form:"format"`
+	NodeIDs []string `json:"node_ids,omitempty" form:"node_ids"`
+	// Subgraph adds the dependencies or contained steps of NodeIDs
+	Subgraph export.SubgraphOptions `json:"subgraph"`
+	Options  export.Options         `json:"options"`
+}
+
+func (h *RESTHandler) ExportGraph(c *gin.Context) {
+	task, ok := h.prepareExport(c)
+	if !ok {
+		return
+	}
+
+	// Stream the export; without a Content-Length large exports are sent
+	// chunked instead of being buffered
+	w := &exportResponseWriter{
+		c:           c,
+		contentType: task.format.ContentType(),
+		filename:    task.filename(),
+	}
+	if err := h.exporter.ExportGraphTo(w, task.graph, task.format, task.options); err != nil {
+		if !w.started {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export graph: " + err.Error()})
+			return
+		}
+		// The status was sent with the first chunk; the truncated body is
+		// all the client gets
+		_ = c.Error(err)
+	}
+}
+
+// exportTask is a validated export request with the graph to export
+type exportTask struct {
+	appName string
+	graph   *graph.Graph
+	format  export.Format
+	options export.Options
+}
+
+// prepareExport binds and validates an export request and loads the graph
+// to export. Invalid requests are answered here and return false.
+func (h *RESTHandler) prepareExport(c *gin.Context) (*exportTask, bool) {
+	appName := c.Query("app")
+	if appName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "app parameter is required"})
+		return nil, false
+	}
+
+	var req ExportRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return nil, false
+	}
+
+	if req.Format == "" {
+		req.Format = "dot"
+	}
+
+	graph, err := h.repo(c).LoadGraph(appName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Graph not found: " + err.Error()})
+		return nil, false
+	}
+
+	exportGraph := graph
+	if len(req.NodeIDs) > 0 {
+		exportGraph, err = h.exporter.CreateSubgraphWithOptions(graph, req.NodeIDs, req.Subgraph)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create subgraph: " + err.Error()})
+			return nil, false
+		}
+	}
+
+	format, err := export.ParseFormat(req.Format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if err := req.Options.Filter.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter: " + err.Error()})
+		return nil, false
+	}
+	if err := req.Options.Reduce.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reduce options: " + err.Error()})
+		return nil, false
+	}
+	if focus := req.Options.Reduce.Focus; focus != "" {
+		if _, exists := exportGraph.GetNode(focus); !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Focus node not found: " + focus})
+			return nil, false
+		}
+	}
+
+	return &exportTask{appName: appName, graph: exportGraph, format: format, options: req.Options}, true
+}
+
+// filename is the name the export is downloaded as
+func (t *exportTask) filename() string {
+	return t.appName + "-graph." + t.format.FileExtension()
+}
+
+// exportResponseWriter sends the export headers with the first write, so
+// that errors before any output are still reported as JSON
+type exportResponseWriter struct {
+	c           *gin.Context
+	contentType string
+	filename    string
+	started     bool
+}
+
+func (w *exportResponseWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.c.Header("Content-Type", w.contentType)
+		w.c.Header("Content-Disposition", "attachment; filename="+w.filename)
+		w.c.Status(http.StatusOK)
+	}
+	return w.c.Writer.Write(p)
+}
+
+type ListAppsRequest struct {
+	Name   string `form:"name"`
+	Owner  string `form:"owner"`
+	Team   string `form:"team"`
+	Limit  int    `form:"limit"`
+	Offset int    `form:"offset"`
+}
+
+func (h *RESTHandler) ListApps(c *gin.Context) {
+	var req ListAppsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	if req.Limit <= 0 {
+		req.Limit = 50
+	}
+
+	apps, err := h.repo(c).ListApps(storage.AppFilter{
+		NameContains: req.Name,
+		Owner:        req.Owner,
+		Team:         req.Team,
+	}, req.Limit, req.Offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list apps: " + err.Error()})
+		return
+	}
+	apps = visibleApps(c.Request.Context(), h.authorizer, apps)
+
+	c.JSON(http.StatusOK, gin.H{"apps": apps, "limit": req.Limit, "offset": req.Offset})
+}
+
+func (h *RESTHandler) DeleteGraph(c *gin.Context) {
+	appName := c.Param("app")
+
+	if err := h.repo(c).DeleteGraph(appName); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed to delete graph: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Graph deleted successfully"})
+}
+
+// NodeRequest is the body of node create and update requests. The state of
+// a node is owned by its executions and cannot be set here.
+type NodeRequest struct {
+	ID          string                 `json:"id"` // Ignored on update, the node ID is taken from the path
+	Type        graph.NodeType         `json:"type" binding:"required"`
+	Name        string                 `json:"name" binding:"required"`
+	Description string                 `json:"description,omitempty"`
+	Properties  map[string]interface{} `json:"properties,omitempty"`
+}
+
+// NodeStateRequest is the body of node state updates by external executors
+type NodeStateRequest struct {
+	State graph.NodeState `json:"state" binding:"required"`
+}
+
+// NodeStateResponse is the updated node and every state change the update
+// caused, including those propagated to its workflow or steps
+type NodeStateResponse struct {
+	Node    *graph.Node               `json:"node"`
+	Changes []events.NodeStateChanged `json:"changes"`
+}
+
+// EdgeRequest is the body of edge create and update requests
+type EdgeRequest struct {
+	ID          string                 `json:"id"` // Generated if empty on create, taken from the path on update
+	FromNodeID  string                 `json:"from_node_id" binding:"required"`
+	ToNodeID    string                 `json:"to_node_id" binding:"required"`
+	Type        graph.EdgeType         `json:"type" binding:"required"`
+	Description string                 `json:"description,omitempty"`
+	Properties  map[string]interface{} `json:"properties,omitempty"`
+}
+
+// errNotFound marks edits of nodes or edges that do not exist
+type errNotFound struct{ err error }
+
+func (e errNotFound) Error() string { return e.err.Error() }
+
+// editGraph loads the graph of the app in the path, applies edit and saves
+// the result, which only writes the changed rows. Errors of edit other than
+// errNotFound are violations of the graph rules and answered with 422, as
+// are edits creating a cycle. It responds with an error and returns false if
+// any step fails; nothing is saved then.
+func (h *RESTHandler) editGraph(c *gin.Context, edit func(g *graph.Graph) error) bool {
+	appName := c.Param("app")
+
+	h.edits.Lock()
+	defer h.edits.Unlock()
+
+	g, err := h.repo(c).LoadGraph(appName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Graph not found: " + err.Error()})
+		return false
+	}
+
+	hadCycle := g.HasCycle()
+	if err := edit(g); err != nil {
+		if _, notFound := err.(errNotFound); notFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return false
+		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return false
+	}
+	if !hadCycle && g.HasCycle() {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "change would create a cycle"})
+		return false
+	}
+
+	if err := h.repo(c).SaveGraph(appName, g); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save graph: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+func validNodeState(state graph.NodeState) bool {
+	switch state {
+	case graph.NodeStateWaiting, graph.NodeStatePending, graph.NodeStateRunning, graph.NodeStateFailed, graph.NodeStateSucceeded:
+		return true
+	}
+	return false
+}
+
+func validNodeType(nodeType graph.NodeType) bool {
+	switch nodeType {
+	case graph.NodeTypeSpec, graph.NodeTypeWorkflow, graph.NodeTypeStep, graph.NodeTypeResource:
+		return true
+	}
+	return false
+}
+
+func (h *RESTHandler) CreateNode(c *gin.Context) {
+	var req NodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	if req.ID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: node ID is required"})
+		return
+	}
+
+	node := &graph.Node{ID: req.ID, Type: req.Type, Name: req.Name, Description: req.Description, Properties: req.Properties}
+	ok := h.editGraph(c, func(g *graph.Graph) error {
+		if !validNodeType(node.Type) {
+			return fmt.Errorf("invalid node type: %s", node.Type)
+		}
+		return g.AddNode(node)
+	})
+	if ok {
+		c.JSON(http.StatusCreated, node)
+	}
+}
+
+// UpdateNode replaces the type, name, description and properties of a node.
+// Its edges have to remain valid for the new node type.
+func (h *RESTHandler) UpdateNode(c *gin.Context) {
+	var req NodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	var node *graph.Node
+	ok := h.editGraph(c, func(g *graph.Graph) error {
+		existing, exists := g.GetNode(c.Param("nodeId"))
+		if !exists {
+			return errNotFound{fmt.Errorf("node %s does not exist", c.Param("nodeId"))}
+		}
+		if !validNodeType(req.Type) {
+			return fmt.Errorf("invalid node type: %s", req.Type)
+		}
+
+		// Re-add the node with its edges, so that the edges are validated
+		// against the changed node
+		edges := append(g.OutgoingEdges(existing.ID), g.IncomingEdges(existing.ID)...)
+		updated := *existing
+		updated.Type, updated.Name, updated.Description, updated.Properties = req.Type, req.Name, req.Description, req.Properties
+		if err := g.RemoveNode(existing.ID); err != nil {
+			return err
+		}
+		if err := g.AddNode(&updated); err != nil {
+			return err
+		}
+		updated.CreatedAt = existing.CreatedAt
+		for _, edge := range edges {
+			if _, added := g.GetEdge(edge.ID); added {
+				continue // Self loops are both outgoing and incoming
+			}
+			if err := g.AddEdge(edge); err != nil {
+				return fmt.Errorf("edge %s: %w", edge.ID, err)
+			}
+		}
+		node = &updated
+		return nil
+	})
+	if ok {
+		c.JSON(http.StatusOK, node)
+	}
+}
+
+// DeleteNode removes a node together with its edges
+func (h *RESTHandler) DeleteNode(c *gin.Context) {
+	ok := h.editGraph(c, func(g *graph.Graph) error {
+		if err := g.RemoveNode(c.Param("nodeId")); err != nil {
+			return errNotFound{err}
+		}
+		return nil
+	})
+	if ok {
+		c.JSON(http.StatusOK, gin.H{"message": "Node deleted successfully"})
+	}
+}
+
+// UpdateNodeState sets the state of a node, for runners outside of this
+// server, such as Argo or Jenkins, reporting their progress. The change is
+// propagated like graph.Graph.UpdateNodeState: a failed step fails its
+// workflow and a finished workflow finishes its running steps. All changes
+// are saved in one transaction, recorded in the state history and published
+// to the app's event stream.
+func (h *RESTHandler) UpdateNodeState(c *gin.Context) {
+	var req NodeStateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	if !validNodeState(req.State) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: invalid node state: " + string(req.State)})
+		return
+	}
+
+	appName, nodeID := c.Param("app"), c.Param("nodeId")
+	repository := h.repo(c)
+
+	h.edits.Lock()
+	defer h.edits.Unlock()
+
+	g, err := repository.LoadGraph(appName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Graph not found: " + err.Error()})
+		return
+	}
+	oldStates := make(map[string]graph.NodeState, len(g.Nodes))
+	for id, node := range g.Nodes {
+		oldStates[id] = node.State
+	}
+	if err := g.UpdateNodeState(nodeID, req.State); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	states := make(map[string]graph.NodeState)
+	changes := []events.NodeStateChanged{}
+	meta := events.Meta{AppName: appName, TenantID: storage.TenantFromContext(c.Request.Context()), At: time.Now()}
+	for _, id := range sortedNodeIDs(g) {
+		newState := g.Nodes[id].State
+		if newState == oldStates[id] {
+			continue
+		}
+		states[id] = newState
+		changes = append(changes, events.NodeStateChanged{Meta: meta, Node: g.Nodes[id], OldState: oldStates[id], NewState: newState})
+	}
+	if _, err := repository.UpdateNodeStates(appName, states); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update node state: " + err.Error()})
+		return
+	}
+
+	if !h.statesPolled {
+		for _, change := range changes {
+			h.events.Publish(change)
+		}
+	}
+	node, _ := g.GetNode(nodeID)
+	c.JSON(http.StatusOK, NodeStateResponse{Node: node, Changes: changes})
+}
+
+// sortedNodeIDs returns the node IDs of g, sorted
+func sortedNodeIDs(g *graph.Graph) []string {
+	ids := make([]string, 0, len(g.Nodes))
+	for id := range g.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// GetNodeStateHistory lists the recorded state transitions of a node, oldest
+// first. The history outlives the node, so deleted nodes keep theirs.
+func (h *RESTHandler) GetNodeStateHistory(c *gin.Context) {
+	appName, nodeID := c.Param("app"), c.Param("nodeId")
+	changes, err := h.repo(c).GetNodeStateHistory(appName, nodeID)
+	if errors.Is(err, storage.ErrAppNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Graph not found: " + err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get state history: " + err.Error()})
+		return
+	}
+	if changes == nil {
+		changes = []storage.NodeStateChangeModel{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"app_name": appName, "node_id": nodeID, "changes": changes})
+}
+
+func (h *RESTHandler) CreateEdge(c *gin.Context) {
+	var req EdgeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	if req.ID == "" {
+		req.ID = uuid.NewString()
+	}
+
+	edge := &graph.Edge{
+		ID: req.ID, FromNodeID: req.FromNodeID, ToNodeID: req.ToNodeID,
+		Type: req.Type, Description: req.Description, Properties: req.Properties,
+	}
+	ok := h.editGraph(c, func(g *graph.Graph) error {
+		return g.AddEdge(edge)
+	})
+	if ok {
+		c.JSON(http.StatusCreated, edge)
+	}
+}
+
+// UpdateEdge replaces the ends, type, description and properties of an edge
+func (h *RESTHandler) UpdateEdge(c *gin.Context) {
+	var req EdgeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	edge := &graph.Edge{
+		ID: c.Param("edgeId"), FromNodeID: req.FromNodeID, ToNodeID: req.ToNodeID,
+		Type: req.Type, Description: req.Description, Properties: req.Properties,
+	}
+	ok := h.editGraph(c, func(g *graph.Graph) error {
+		existing, exists := g.GetEdge(edge.ID)
+		if !exists {
+			return errNotFound{fmt.Errorf("edge %s does not exist", edge.ID)}
+		}
+		if err := g.RemoveEdge(edge.ID); err != nil {
+			return err
+		}
+		if err := g.AddEdge(edge); err != nil {
+			return err
+		}
+		edge.CreatedAt = existing.CreatedAt
+		return nil
+	})
+	if ok {
+		c.JSON(http.StatusOK, edge)
+	}
+}
+
+func (h *RESTHandler) DeleteEdge(c *gin.Context) {
+	ok := h.editGraph(c, func(g *graph.Graph) error {
+		if err := g.RemoveEdge(c.Param("edgeId")); err != nil {
+			return errNotFound{err}
+		}
+		return nil
+	})
+	if ok {
+		c.JSON(http.StatusOK, gin.H{"message": "Edge deleted successfully"})
+	}
+}
+
+func (h *RESTHandler) DeleteApp(c *gin.Context) {
+	appName := c.Param("app")
+	soft := c.Query("soft") == "true"
+
+	if err := h.repo(c).DeleteApp(appName, storage.DeleteOptions{Soft: soft}); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed to delete app: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "App deleted successfully"})
+}
+
+func (h *RESTHandler) RestoreApp(c *gin.Context) {
+	appName := c.Param("app")
+
+	if err := h.repo(c).RestoreApp(appName); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed to restore app: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "App restored successfully"})
+}
+
+// ListGraphRunsRequest pages, filters and sorts the runs of an app. Status
+// may be repeated or comma separated; from and to are RFC 3339 timestamps
+// bounding started_at; order is asc or desc.
+type ListGraphRunsRequest struct {
+	Status []string  `form:"status"`
+	From   time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To     time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Sort   string    `form:"sort"`
+	Order  string    `form:"order" binding:"omitempty,oneof=asc desc"`
+	Limit  int       `form:"limit"`
+	Offset int       `form:"offset"`
+}
+
+func (h *RESTHandler) GetGraphRuns(c *gin.Context) {
+	appName := c.Param("app")
+
+	var req ListGraphRunsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	if req.Limit <= 0 {
+		req.Limit = 50
+	}
+	var statuses []string
+	for _, status := range req.Status {
+		for _, s := range strings.Split(status, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				statuses = append(statuses, s)
+			}
+		}
+	}
+	sortBy := storage.RunSort(req.Sort)
+	switch sortBy {
+	case "", storage.RunSortStartedAt, storage.RunSortCompletedAt, storage.RunSortStatus, storage.RunSortVersion:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort: " + req.Sort})
+		return
+	}
+
+	runs, total, err := h.repo(c).ListGraphRuns(appName, storage.RunFilter{
+		Statuses:    statuses,
+		StartedFrom: req.From,
+		StartedTo:   req.To,
+		SortBy:      sortBy,
+		Ascending:   req.Order == "asc",
+		Limit:       req.Limit,
+		Offset:      req.Offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get graph runs: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"runs": runs, "total": total, "limit": req.Limit, "offset": req.Offset})
+}
+
+// PruneGraphRunsRequest selects the runs PruneGraphRuns deletes
+type PruneGraphRunsRequest struct {
+	OlderThan string `form:"older_than" binding:"required"` // Go duration, e.g. 720h
+	KeepLast  int    `form:"keep_last" binding:"min=0"`
+}
+
+// PruneGraphRuns deletes the finished runs of an app that started longer
+// than older_than ago, keeping the keep_last most recent ones, like the
+// retention janitor does
+func (h *RESTHandler) PruneGraphRuns(c *gin.Context) {
+	appName := c.Param("app")
+
+	var req PruneGraphRunsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	olderThan, err := time.ParseDuration(req.OlderThan)
+	if err != nil || olderThan < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: invalid older_than: " + req.OlderThan})
+		return
+	}
+
+	pruned, err := h.repo(c).PruneGraphRuns(appName, olderThan, req.KeepLast)
+	if errors.Is(err, storage.ErrAppNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Graph not found: " + err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prune graph runs: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"app_name": appName, "pruned": pruned})
+}
+
+type CreateGraphRunRequest struct {
+	Version int `json:"version" binding:"required"`
+}
+
+func (h *RESTHandler) CreateGraphRun(c *gin.Context) {
+	appName := c.Param("app")
+
+	var req CreateGraphRunRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	run, err := h.repo(c).CreateGraphRun(appName, req.Version)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create graph run: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, run)
+}
+
+type UpdateGraphRunRequest struct {
+	Status       string  `json:"status" binding:"required"`
+	ErrorMessage *string `json:"error_message,omitempty"`
+}
+
+func (h *RESTHandler) UpdateGraphRun(c *gin.Context) {
+	runIDStr := c.Param("runId")
+
+	var req UpdateGraphRunRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	runID, err := parseUUID(runIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid run ID"})
+		return
+	}
+
+	err = h.repo(c).UpdateGraphRun(runID, req.Status, req.ErrorMessage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update graph run: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Graph run updated successfully"})
+}
+
+// CancelGraphRunRequest gives the reason a run is cancelled
+type CancelGraphRunRequest struct {
+	Reason string `json:"reason"`
+}
+
+// CancelGraphRun marks a queued or running run as failed. The replica
+// executing it skips the nodes it has not started.
+func (h *RESTHandler) CancelGraphRun(c *gin.Context) {
+	runID, err := parseUUID(c.Param("runId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid run ID"})
+		return
+	}
+	var req CancelGraphRunRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+	}
+
+	repository := h.repo(c)
+	if _, err := repository.GetGraphRunStatus(runID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed to cancel graph run: " + err.Error()})
+		return
+	}
+	err = repository.CancelGraphRun(runID, req.Reason)
+	if errors.Is(err, storage.ErrRunNotCancellable) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel graph run: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Graph run cancelled"})
+}
+
+func (h *RESTHandler) GetAppMetadata(c *gin.Context) {
+	appName := c.Param("app")
+
+	metadata, err := h.repo(c).GetAppMetadata(appName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed to get app metadata: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"app": appName, "metadata": metadata})
+}
+
+func (h *RESTHandler) SetAppMetadata(c *gin.Context) {
+	appName := c.Param("app")
+
+	var metadata graph.AppMetadata
+	if err := c.ShouldBindJSON(&metadata); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	if err := h.repo(c).SetAppMetadata(appName, metadata); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed to set app metadata: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "App metadata updated successfully"})
+}
+
+type RecentRunsRequest struct {
+	Limit int `form:"limit"`
+}
+
+func (h *RESTHandler) GetRecentRuns(c *gin.Context) {
+	appName := c.Param("app")
+
+	var req RecentRunsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	if req.Limit <= 0 {
+		req.Limit = 10
+	}
+
+	runs, err := h.repo(c).GetRecentRunsWithNodes(appName, req.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get graph runs: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"runs": runs})
+}
+
+func (h *RESTHandler) GetRunNodeExecutions(c *gin.Context) {
+	runID, err := parseUUID(c.Param("runId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid run ID"})
+		return
+	}
+
+	nodes, err := h.repo(c).GetRunNodeExecutions(runID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed to get node executions: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"run_id": runID, "nodes": nodes})
+}
+
+// ExecuteGraph starts a run of the app's graph in the background and
+// answers with its ID right away; follow the run with GetGraphRun or the
+// app's event stream
+func (h *RESTHandler) ExecuteGraph(c *gin.Context) {
+	appName := c.Param("app")
+	if h.runner == nil && h.queue == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Execution is not configured"})
+		return
+	}
+
+	repository := h.repo(c)
+	if _, err := repository.LoadGraphSummary(appName); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Graph not found: " + err.Error()})
+		return
+	}
+
+	runID, err := startExecution(c.Request.Context(), repository, h.runner, runPublisher(h.events, h.statesPolled), h.traces, h.queue, appName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start execution: " + err.Error()})
+		return
+	}
+
+	status := string(execution.StatusRunning)
+	if h.queue != nil {
+		status = storage.RunStatusQueued
+	}
+	c.JSON(http.StatusAccepted, gin.H{"run_id": runID, "status": status})
+}
+
+// GraphRunResponse is a run with the status of its nodes
+type GraphRunResponse struct {
+	Run   *storage.GraphRunModel        `json:"run"`
+	Nodes []storage.NodeExecutionRecord `json:"nodes"` // Nodes that changed state so far
+
+	// Executions holds the status, error and logs of every node of the
+	// plan; it is recorded once the run has finished
+	Executions map[string]*execution.NodeExecution `json:"executions,omitempty"`
+}
+
+func (h *RESTHandler) GetGraphRun(c *gin.Context) {
+	runID, err := parseUUID(c.Param("runId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid run ID"})
+		return
+	}
+
+	run, err := h.repo(c).GetGraphRun(runID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed to get graph run: " + err.Error()})
+		return
+	}
+	nodes, err := h.repo(c).GetRunNodeExecutions(runID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get node executions: " + err.Error()})
+		return
+	}
+	plan, err := execution.LoadExecutionPlan(run)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := GraphRunResponse{Run: run, Nodes: nodes}
+	if plan != nil {
+		response.Executions = plan.Executions
+	}
+	run.ExecutionPlan = ""
+	c.JSON(http.StatusOK, response)
+}
+
+type AuditLogRequest struct {
+	App    string `form:"app"`
+	Actor  string `form:"actor"`
+	Action string `form:"action"`
+	Limit  int    `form:"limit"`
+}
+
+func (h *RESTHandler) GetAuditLog(c *gin.Context) {
+	var req AuditLogRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	if req.Limit <= 0 {
+		req.Limit = 100
+	}
+
+	entries, err := h.repo(c).GetAuditLog(storage.AuditFilter{
+		AppName: req.App,
+		Actor:   req.Actor,
+		Action:  storage.AuditAction(req.Action),
+		Limit:   req.Limit,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load audit log: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
+
+func parseUUID(s string) (uuid.UUID, error) {
+	return uuid.Parse(s)
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// testApp is the app newTestRepository saves
+const testApp = "shop"
+
+// newTestRepository returns a repository on a migrated SQLite database
+// holding the graph of testApp
+func newTestRepository(t *testing.T) *storage.Repository {
+	t.Helper()
+	db, err := storage.NewSQLiteConnection(filepath.Join(t.TempDir(), "graph.db"))
+	require.NoError(t, err)
+	require.NoError(t, storage.AutoMigrate(db))
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	repo := storage.NewRepository(db)
+	require.NoError(t, repo.SaveGraph(testApp, newTestGraph(testApp)))
+	return repo
+}
+
+// newTestGraph returns a workflow provisioning a database
+func newTestGraph(appName string) *graph.Graph {
+	g := graph.NewGraph(appName)
+	g.AddNode(&graph.Node{ID: "deploy", Type: graph.NodeTypeWorkflow, Name: "Deploy"})
+	g.AddNode(&graph.Node{ID: "db", Type: graph.NodeTypeResource, Name: "Database"})
+	g.AddEdge(&graph.Edge{ID: "e1", FromNodeID: "deploy", ToNodeID: "db", Type: graph.EdgeTypeProvisions})
+	return g
+}
+
+// newTestRouter returns a router serving the routes of h
+func newTestRouter(h *RESTHandler) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	h.SetupRoutes(router)
+	return router
+}
+
+// startTestServer serves the routes of h until the test ends
+func startTestServer(t *testing.T, h *RESTHandler) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(newTestRouter(h))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testResponse is a response of doRequest with its body read
+type testResponse struct {
+	*http.Response
+	Body []byte
+}
+
+// decode decodes the JSON body into v
+func (r *testResponse) decode(t *testing.T, v interface{}) {
+	t.Helper()
+	require.NoError(t, json.Unmarshal(r.Body, v), string(r.Body))
+}
+
+// doRequest sends a request with body encoded as JSON, unless it is nil,
+// and the given headers. Streaming responses are read until timeout.
+func doRequest(t *testing.T, server *httptest.Server, method, path string, body interface{}, headers map[string]string) *testResponse {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(data)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, server.URL+path, reader)
+	require.NoError(t, err)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return &testResponse{Response: resp}
+	}
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return &testResponse{Response: resp, Body: data}
+}
+
+// queueTestRun queues a run of testApp, which no worker executes
+func queueTestRun(t *testing.T, repo storage.RepositoryInterface) uuid.UUID {
+	t.Helper()
+	run, err := repo.QueueGraphRun(testApp, 1)
+	require.NoError(t, err)
+	return run.ID
+}
@@ -0,0 +1,353 @@
+package api
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.81
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/events"
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+)
+
+// Properties is the resolver for the properties field.
+func (r *edgeResolver) Properties(ctx context.Context, obj *graph.Edge) (*string, error) {
+	return formatProperties(obj.Properties)
+}
+
+// CreatedAt is the resolver for the createdAt field.
+func (r *edgeResolver) CreatedAt(ctx context.Context, obj *graph.Edge) (string, error) {
+	return formatTime(obj.CreatedAt), nil
+}
+
+// Nodes is the resolver for the nodes field.
+func (r *graphResolver) Nodes(ctx context.Context, obj *graph.Graph) ([]*graph.Node, error) {
+	nodes := make([]*graph.Node, 0, len(obj.Nodes))
+	for _, id := range sortedKeys(obj.Nodes) {
+		nodes = append(nodes, obj.Nodes[id])
+	}
+	return nodes, nil
+}
+
+// Edges is the resolver for the edges field.
+func (r *graphResolver) Edges(ctx context.Context, obj *graph.Graph) ([]*graph.Edge, error) {
+	edges := make([]*graph.Edge, 0, len(obj.Edges))
+	for _, id := range sortedKeys(obj.Edges) {
+		edges = append(edges, obj.Edges[id])
+	}
+	return edges, nil
+}
+
+// CreatedAt is the resolver for the createdAt field.
+func (r *graphResolver) CreatedAt(ctx context.Context, obj *graph.Graph) (string, error) {
+	return formatTime(obj.CreatedAt), nil
+}
+
+// UpdatedAt is the resolver for the updatedAt field.
+func (r *graphResolver) UpdatedAt(ctx context.Context, obj *graph.Graph) (string, error) {
+	return formatTime(obj.UpdatedAt), nil
+}
+
+// SaveGraph is the resolver for the saveGraph field.
+func (r *mutationResolver) SaveGraph(ctx context.Context, app string, input GraphInput) (*graph.Graph, error) {
+	if err := authorize(ctx, r.authorizer, app, RoleEditor); err != nil {
+		return nil, err
+	}
+	g, err := inputGraph(app, input)
+	if err != nil {
+		return nil, fmt.Errorf("invalid graph: %w", err)
+	}
+	repository := r.repo(ctx)
+	if err := repository.SaveGraph(app, g); err != nil {
+		return nil, fmt.Errorf("failed to save graph: %w", err)
+	}
+	return repository.LoadGraph(app)
+}
+
+// UpdateNodeState is the resolver for the updateNodeState field.
+func (r *mutationResolver) UpdateNodeState(ctx context.Context, app string, nodeID string, state graph.NodeState) (*graph.Node, error) {
+	if err := authorize(ctx, r.authorizer, app, nodeStateRole); err != nil {
+		return nil, err
+	}
+	repository := r.repo(ctx)
+	g, err := repository.LoadGraph(app)
+	if err != nil {
+		return nil, err
+	}
+	node, exists := g.GetNode(nodeID)
+	if !exists {
+		return nil, fmt.Errorf("node %s not found in app %s", nodeID, app)
+	}
+
+	oldState := node.State
+	if err := repository.UpdateNodeState(app, nodeID, state); err != nil {
+		return nil, err
+	}
+	if oldState != state {
+		if err := repository.RecordNodeStateChange(app, nodeID, oldState, state, nil); err != nil {
+			return nil, err
+		}
+		if !r.statesPolled {
+			node.State = state
+			r.events.Publish(events.NodeStateChanged{
+				Meta:     events.Meta{AppName: app, TenantID: storage.TenantFromContext(ctx), At: time.Now()},
+				Node:     node,
+				OldState: oldState,
+				NewState: state,
+			})
+		}
+	}
+
+	g, err = repository.LoadGraph(app)
+	if err != nil {
+		return nil, err
+	}
+	node, _ = g.GetNode(nodeID)
+	return node, nil
+}
+
+// ExecuteGraph is the resolver for the executeGraph field.
+func (r *mutationResolver) ExecuteGraph(ctx context.Context, app string) (*Run, error) {
+	if err := authorize(ctx, r.authorizer, app, RoleOperator); err != nil {
+		return nil, err
+	}
+	if r.runner == nil && r.queue == nil {
+		return nil, fmt.Errorf("execution is not configured")
+	}
+	repository := r.repo(ctx)
+	if _, err := repository.LoadGraphSummary(app); err != nil {
+		return nil, err
+	}
+
+	runID, err := startExecution(ctx, repository, r.runner, runPublisher(r.events, r.statesPolled), r.traces, r.queue, app)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start execution: %w", err)
+	}
+	run, err := repository.GetGraphRun(runID)
+	if err != nil {
+		return nil, err
+	}
+	return runResult(run, nil), nil
+}
+
+// Properties is the resolver for the properties field.
+func (r *nodeResolver) Properties(ctx context.Context, obj *graph.Node) (*string, error) {
+	return formatProperties(obj.Properties)
+}
+
+// CreatedAt is the resolver for the createdAt field.
+func (r *nodeResolver) CreatedAt(ctx context.Context, obj *graph.Node) (string, error) {
+	return formatTime(obj.CreatedAt), nil
+}
+
+// UpdatedAt is the resolver for the updatedAt field.
+func (r *nodeResolver) UpdatedAt(ctx context.Context, obj *graph.Node) (string, error) {
+	return formatTime(obj.UpdatedAt), nil
+}
+
+// StartedAt is the resolver for the startedAt field.
+func (r *nodeResolver) StartedAt(ctx context.Context, obj *graph.Node) (*string, error) {
+	return formatOptionalTime(obj.StartedAt), nil
+}
+
+// CompletedAt is the resolver for the completedAt field.
+func (r *nodeResolver) CompletedAt(ctx context.Context, obj *graph.Node) (*string, error) {
+	return formatOptionalTime(obj.CompletedAt), nil
+}
+
+// Graph is the resolver for the graph field.
+func (r *queryResolver) Graph(ctx context.Context, app string) (*graph.Graph, error) {
+	if err := authorize(ctx, r.authorizer, app, RoleViewer); err != nil {
+		return nil, err
+	}
+	return r.repo(ctx).LoadGraph(app)
+}
+
+// Node is the resolver for the node field.
+func (r *queryResolver) Node(ctx context.Context, app string, id string) (*graph.Node, error) {
+	if err := authorize(ctx, r.authorizer, app, RoleViewer); err != nil {
+		return nil, err
+	}
+	g, err := r.repo(ctx).LoadGraph(app)
+	if err != nil {
+		return nil, err
+	}
+	node, exists := g.GetNode(id)
+	if !exists {
+		return nil, nil
+	}
+	return node, nil
+}
+
+// Nodes is the resolver for the nodes field.
+func (r *queryResolver) Nodes(ctx context.Context, app string, filter *NodeFilter) ([]*graph.Node, error) {
+	if err := authorize(ctx, r.authorizer, app, RoleViewer); err != nil {
+		return nil, err
+	}
+	g, err := r.repo(ctx).LoadGraph(app)
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		filter = &NodeFilter{}
+	}
+
+	nodes := make([]*graph.Node, 0, len(g.Nodes))
+	for _, node := range g.Nodes {
+		if len(filter.Types) > 0 && !slices.Contains(filter.Types, node.Type) {
+			continue
+		}
+		if len(filter.States) > 0 && !slices.Contains(filter.States, node.State) {
+			continue
+		}
+		if filter.NameContains != nil && !strings.Contains(node.Name, *filter.NameContains) {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes, nil
+}
+
+// Apps is the resolver for the apps field.
+func (r *queryResolver) Apps(ctx context.Context) ([]*App, error) {
+	summaries, err := r.repo(ctx).ListApps(storage.AppFilter{}, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	summaries = visibleApps(ctx, r.authorizer, summaries)
+
+	apps := make([]*App, 0, len(summaries))
+	for _, summary := range summaries {
+		app := &App{
+			ID:        summary.ID.String(),
+			Name:      summary.Name,
+			CreatedAt: formatTime(summary.CreatedAt),
+			UpdatedAt: formatTime(summary.UpdatedAt),
+		}
+		if summary.Description != "" {
+			description := summary.Description
+			app.Description = &description
+		}
+		apps = append(apps, app)
+	}
+	return apps, nil
+}
+
+// Runs is the resolver for the runs field.
+func (r *queryResolver) Runs(ctx context.Context, app string, limit *int) ([]*Run, error) {
+	if err := authorize(ctx, r.authorizer, app, RoleViewer); err != nil {
+		return nil, err
+	}
+	count := 10
+	if limit != nil && *limit > 0 {
+		count = *limit
+	}
+	recent, err := r.repo(ctx).GetRecentRunsWithNodes(app, count)
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make([]*Run, 0, len(recent))
+	for i := range recent {
+		runs = append(runs, runResult(&recent[i].GraphRunModel, recent[i].Nodes))
+	}
+	return runs, nil
+}
+
+// Run is the resolver for the run field.
+func (r *queryResolver) Run(ctx context.Context, id string) (*Run, error) {
+	runID, err := parseUUID(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid run ID: %s", id)
+	}
+	repository := r.repo(ctx)
+	run, err := repository.GetGraphRun(runID)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(ctx, r.authorizer, run.App.Name, RoleViewer); err != nil {
+		return nil, err
+	}
+	executions, err := repository.GetRunNodeExecutions(runID)
+	if err != nil {
+		return nil, err
+	}
+	return runResult(run, executions), nil
+}
+
+// NodeID is the resolver for the nodeId field.
+func (r *stateChangeEventResolver) NodeID(ctx context.Context, obj *events.NodeStateChanged) (string, error) {
+	return obj.Node.ID, nil
+}
+
+// Time is the resolver for the time field.
+func (r *stateChangeEventResolver) Time(ctx context.Context, obj *events.NodeStateChanged) (string, error) {
+	return obj.At.Format(time.RFC3339Nano), nil
+}
+
+// NodeStateChanged is the resolver for the nodeStateChanged field.
+func (r *subscriptionResolver) NodeStateChanged(ctx context.Context, app string) (<-chan *events.NodeStateChanged, error) {
+	if err := authorize(ctx, r.authorizer, app, RoleViewer); err != nil {
+		return nil, err
+	}
+	if _, err := r.repo(ctx).LoadGraphSummary(app); err != nil {
+		return nil, err
+	}
+
+	subscribed, unsubscribe := subscribeStateChanges(r.events, storage.TenantFromContext(ctx), app)
+	changes := make(chan *events.NodeStateChanged)
+	go func() {
+		defer close(changes)
+		defer unsubscribe()
+		for {
+			select {
+			case change := <-subscribed:
+				select {
+				case changes <- &change:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return changes, nil
+}
+
+// Edge returns EdgeResolver implementation.
+func (r *Resolver) Edge() EdgeResolver { return &edgeResolver{r} }
+
+// Graph returns GraphResolver implementation.
+func (r *Resolver) Graph() GraphResolver { return &graphResolver{r} }
+
+// Mutation returns MutationResolver implementation.
+func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
+
+// Node returns NodeResolver implementation.
+func (r *Resolver) Node() NodeResolver { return &nodeResolver{r} }
+
+// Query returns QueryResolver implementation.
+func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
+
+// StateChangeEvent returns StateChangeEventResolver implementation.
+func (r *Resolver) StateChangeEvent() StateChangeEventResolver { return &stateChangeEventResolver{r} }
+
+// Subscription returns SubscriptionResolver implementation.
+func (r *Resolver) Subscription() SubscriptionResolver { return &subscriptionResolver{r} }
+
+type edgeResolver struct{ *Resolver }
+type graphResolver struct{ *Resolver }
+type mutationResolver struct{ *Resolver }
+type nodeResolver struct{ *Resolver }
+type queryResolver struct{ *Resolver }
+type stateChangeEventResolver struct{ *Resolver }
+type subscriptionResolver struct{ *Resolver }
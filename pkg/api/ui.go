@@ -0,0 +1,25 @@
+package api
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uiAssets is the graph viewer served at /ui. It reads graphs, layouts and
+// state changes from the /api/v1 routes with the caller's credentials.
+//
+//go:embed ui
+var uiAssets embed.FS
+
+// setupUI serves the viewer. The assets are public; the data they load is
+// protected like any other API request.
+func setupUI(r *gin.Engine) {
+	assets, err := fs.Sub(uiAssets, "ui")
+	if err != nil {
+		panic(err)
+	}
+	r.StaticFS("/ui", http.FS(assets))
+}
@@ -0,0 +1,333 @@
+// Viewer of the graphs served by the REST API. It draws the D3 export, which
+// carries the node positions of pkg/layout and the colors of the default
+// theme, and updates node states from the event stream of the app.
+(function () {
+  "use strict";
+  var api = "../api/v1";
+  var svgNS = "http://www.w3.org/2000/svg";
+
+  // Node borders by state, as in the default theme of pkg/export
+  var stateBorders = { failed: "red", running: "#1976D2", succeeded: "#388E3C" };
+  var defaultBorder = "black";
+  var states = ["waiting", "pending", "running", "failed", "succeeded"];
+
+  var params = new URLSearchParams(window.location.search);
+  var appSelect = document.getElementById("app");
+  var layoutSelect = document.getElementById("layout");
+  var apiKeyInput = document.getElementById("api-key");
+  var canvas = document.getElementById("canvas");
+  var viewport = document.getElementById("viewport");
+  var tooltip = document.getElementById("tooltip");
+  var statusLabel = document.getElementById("status");
+  var message = document.getElementById("message");
+
+  var graph = null;
+  var byId = {};
+  var bounds = { x: 0, y: 0, width: 1, height: 1 };
+  var view = { x: 0, y: 0, scale: 1 };
+  var stream = null;
+
+  apiKeyInput.value = window.localStorage.getItem("innominatus-graph-api-key") || "";
+  layoutSelect.value = params.get("layout") || "hierarchical";
+
+  function headers() {
+    var result = {};
+    if (apiKeyInput.value) { result["X-API-Key"] = apiKeyInput.value; }
+    if (params.get("tenant")) { result["X-Tenant-ID"] = params.get("tenant"); }
+    return result;
+  }
+
+  function request(path, options) {
+    options = options || {};
+    options.headers = Object.assign(headers(), options.headers || {});
+    return fetch(api + path, options).then(function (response) {
+      if (!response.ok) {
+        return response.json().catch(function () { return {}; }).then(function (body) {
+          throw new Error(body.error || response.status + " " + response.statusText);
+        });
+      }
+      return response.json();
+    });
+  }
+
+  function show(text) {
+    message.textContent = text || "";
+  }
+
+  function el(name, attrs, parent) {
+    var node = document.createElementNS(svgNS, name);
+    Object.keys(attrs).forEach(function (key) { node.setAttribute(key, attrs[key]); });
+    if (parent) { parent.appendChild(node); }
+    return node;
+  }
+
+  function apply() {
+    viewport.setAttribute("transform", "translate(" + view.x + "," + view.y + ") scale(" + view.scale + ")");
+  }
+
+  function fit() {
+    var rect = canvas.getBoundingClientRect();
+    var margin = 20;
+    var scale = Math.min((rect.width - 2 * margin) / bounds.width, (rect.height - 2 * margin) / bounds.height, 2);
+    view.scale = scale;
+    view.x = (rect.width - bounds.width * scale) / 2 - bounds.x * scale;
+    view.y = (rect.height - bounds.height * scale) / 2 - bounds.y * scale;
+    apply();
+  }
+
+  // Point where the line from the node center towards (x, y) leaves its box
+  function border(node, x, y) {
+    var dx = x - node.x, dy = y - node.y;
+    if (dx === 0 && dy === 0) { return { x: node.x, y: node.y }; }
+    var t = Math.min(Math.abs(node.width / 2 / (dx || 1e-9)), Math.abs(node.height / 2 / (dy || 1e-9)));
+    return { x: node.x + dx * t, y: node.y + dy * t };
+  }
+
+  var markers = document.getElementById("markers");
+  var markerIds = {};
+  function marker(color) {
+    if (!markerIds[color]) {
+      var id = "arrow" + Object.keys(markerIds).length;
+      var m = el("marker", { id: id, viewBox: "0 0 10 10", refX: 10, refY: 5, markerWidth: 8, markerHeight: 8, orient: "auto-start-reverse" }, markers);
+      el("path", { d: "M 0 0 L 10 5 L 0 10 z", fill: color }, m);
+      markerIds[color] = id;
+    }
+    return "url(#" + markerIds[color] + ")";
+  }
+
+  function showTooltip(event, node) {
+    tooltip.textContent = "";
+    var title = document.createElement("h2");
+    title.textContent = node.label;
+    tooltip.appendChild(title);
+    [["ID", node.id], ["Type", node.type], ["State", node.state], ["Description", node.description]].forEach(function (row) {
+      if (!row[1]) { return; }
+      var line = document.createElement("div");
+      line.textContent = row[0] + ": " + row[1];
+      tooltip.appendChild(line);
+    });
+    if (node.properties) {
+      var props = document.createElement("pre");
+      props.textContent = JSON.stringify(node.properties, null, 2);
+      tooltip.appendChild(props);
+    }
+    tooltip.style.display = "block";
+    moveTooltip(event);
+  }
+
+  function moveTooltip(event) {
+    tooltip.style.left = (event.clientX + 12) + "px";
+    tooltip.style.top = (event.clientY + 12) + "px";
+  }
+
+  // styleNode draws the state of node: border color and width, dashes for
+  // pending nodes and the state next to the type
+  function styleNode(node) {
+    node.rect.setAttribute("stroke", stateBorders[node.state] || defaultBorder);
+    node.rect.setAttribute("stroke-width", { failed: 2.5, running: 2.5 }[node.state] || 1);
+    node.rect.setAttribute("stroke-dasharray", node.state === "pending" ? "4 3" : "none");
+    node.typeLabel.textContent = node.type + (node.state && node.state !== "waiting" ? " · " + node.state : "");
+  }
+
+  function render(data) {
+    graph = data;
+    byId = {};
+    document.getElementById("nodes").textContent = "";
+    document.getElementById("edges").textContent = "";
+    show(graph.nodes.length ? "" : "The graph has no nodes");
+
+    var minX = Infinity, minY = Infinity, maxX = -Infinity, maxY = -Infinity;
+    graph.nodes.forEach(function (node) {
+      byId[node.id] = node;
+      minX = Math.min(minX, node.x - node.width / 2);
+      minY = Math.min(minY, node.y - node.height / 2);
+      maxX = Math.max(maxX, node.x + node.width / 2);
+      maxY = Math.max(maxY, node.y + node.height / 2);
+
+      var g = el("g", { "class": "node" }, document.getElementById("nodes"));
+      node.rect = el("rect", {
+        x: node.x - node.width / 2, y: node.y - node.height / 2, width: node.width, height: node.height,
+        rx: node.type === "spec" ? node.height / 2 : 6, fill: node.color
+      }, g);
+      el("text", { x: node.x, y: node.y - 7 }, g).textContent = node.label;
+      node.typeLabel = el("text", { x: node.x, y: node.y + 9, "class": "type" }, g);
+      g.addEventListener("mouseenter", function (event) { showTooltip(event, node); });
+      g.addEventListener("mousemove", moveTooltip);
+      g.addEventListener("mouseleave", function () { tooltip.style.display = "none"; });
+      node.element = g;
+      styleNode(node);
+    });
+    if (graph.nodes.length) {
+      bounds = { x: minX, y: minY, width: Math.max(maxX - minX, 1), height: Math.max(maxY - minY, 1) };
+    }
+
+    graph.links.forEach(function (link) {
+      var from = byId[link.source], to = byId[link.target];
+      var start = border(from, to.x, to.y), end = border(to, from.x, from.y);
+      var g = el("g", { "class": "edge" }, document.getElementById("edges"));
+      el("line", {
+        x1: start.x, y1: start.y, x2: end.x, y2: end.y, stroke: link.color,
+        "stroke-width": link.style === "bold" ? 2.5 : 1.2,
+        "stroke-dasharray": { dashed: "6 4", dotted: "2 3" }[link.style] || "none",
+        "marker-end": marker(link.color)
+      }, g);
+      el("text", { x: (start.x + end.x) / 2, y: (start.y + end.y) / 2 - 4 }, g).textContent = link.label;
+    });
+    fit();
+  }
+
+  function loadGraph() {
+    var app = appSelect.value;
+    if (!app) { return Promise.resolve(); }
+    var body = { format: "d3", options: { d3: { layout: { type: layoutSelect.value } } } };
+    return request("/graph/export?app=" + encodeURIComponent(app), {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(body)
+    }).then(render).catch(function (err) { show(err.message); });
+  }
+
+  function onStateChange(event) {
+    var node = byId[event.node.id];
+    if (!node) {
+      // A node added after the graph was loaded
+      loadGraph();
+      return;
+    }
+    node.state = event.new_state;
+    styleNode(node);
+    node.element.classList.remove("changed");
+    void node.element.getBBox();
+    node.element.classList.add("changed");
+  }
+
+  // follow reads the event stream of app. It uses fetch instead of
+  // EventSource so that the API key can be sent, and reconnects after
+  // errors.
+  function follow(app) {
+    if (stream) { stream.abort(); }
+    var controller = new AbortController();
+    stream = controller;
+    statusLabel.textContent = "connecting";
+    statusLabel.className = "";
+
+    fetch(api + "/apps/" + encodeURIComponent(app) + "/events", { headers: headers(), signal: controller.signal })
+      .then(function (response) {
+        if (!response.ok) { throw new Error(response.status + " " + response.statusText); }
+        var reader = response.body.getReader();
+        var decoder = new TextDecoder();
+        var buffer = "";
+        function read() {
+          return reader.read().then(function (chunk) {
+            if (chunk.done) { throw new Error("stream closed"); }
+            buffer += decoder.decode(chunk.value, { stream: true });
+            var messages = buffer.split("\n\n");
+            buffer = messages.pop();
+            messages.forEach(dispatch);
+            return read();
+          });
+        }
+        return read();
+      })
+      .catch(function (err) {
+        if (controller.signal.aborted) { return; }
+        statusLabel.textContent = "disconnected: " + err.message;
+        statusLabel.className = "";
+        setTimeout(function () {
+          if (stream === controller) { follow(app); }
+        }, 3000);
+      });
+  }
+
+  function dispatch(text) {
+    var name = "message", data = "";
+    text.split("\n").forEach(function (line) {
+      var field = line.split(":", 1)[0], value = line.slice(field.length + 1).replace(/^ /, "");
+      if (field === "event") { name = value; }
+      if (field === "data") { data += value; }
+    });
+    if (name === "ready") {
+      statusLabel.textContent = "live";
+      statusLabel.className = "live";
+    } else if (name === "state-change") {
+      onStateChange(JSON.parse(data));
+    }
+  }
+
+  function selectApp() {
+    var app = appSelect.value;
+    params.set("app", app);
+    params.set("layout", layoutSelect.value);
+    window.history.replaceState(null, "", "?" + params.toString());
+    loadGraph();
+    follow(app);
+  }
+
+  function loadApps() {
+    return request("/apps?limit=1000").then(function (body) {
+      appSelect.textContent = "";
+      body.apps.forEach(function (app) {
+        var option = document.createElement("option");
+        option.value = app.name;
+        option.textContent = app.name;
+        appSelect.appendChild(option);
+      });
+      if (!body.apps.length) {
+        show("No apps yet");
+        return;
+      }
+      if (params.get("app")) { appSelect.value = params.get("app"); }
+      if (!appSelect.value) { appSelect.selectedIndex = 0; }
+      selectApp();
+    }).catch(function (err) { show(err.message); });
+  }
+
+  var legend = document.getElementById("legend");
+  states.forEach(function (state) {
+    var item = document.createElement("span");
+    var swatch = document.createElement("i");
+    swatch.style.borderColor = stateBorders[state] || defaultBorder;
+    swatch.style.borderStyle = state === "pending" ? "dashed" : "solid";
+    item.appendChild(swatch);
+    item.appendChild(document.createTextNode(state));
+    legend.appendChild(item);
+  });
+
+  var drag = null;
+  canvas.addEventListener("mousedown", function (event) {
+    drag = { x: event.clientX - view.x, y: event.clientY - view.y };
+    canvas.classList.add("dragging");
+  });
+  window.addEventListener("mousemove", function (event) {
+    if (!drag) { return; }
+    view.x = event.clientX - drag.x;
+    view.y = event.clientY - drag.y;
+    apply();
+  });
+  window.addEventListener("mouseup", function () {
+    drag = null;
+    canvas.classList.remove("dragging");
+  });
+  canvas.addEventListener("wheel", function (event) {
+    event.preventDefault();
+    var rect = canvas.getBoundingClientRect();
+    var px = event.clientX - rect.left, py = event.clientY - rect.top;
+    var factor = Math.exp(-event.deltaY * 0.001);
+    var scale = Math.min(Math.max(view.scale * factor, 0.05), 8);
+    view.x = px - (px - view.x) * scale / view.scale;
+    view.y = py - (py - view.y) * scale / view.scale;
+    view.scale = scale;
+    apply();
+  }, { passive: false });
+
+  appSelect.addEventListener("change", selectApp);
+  layoutSelect.addEventListener("change", selectApp);
+  apiKeyInput.addEventListener("change", function () {
+    window.localStorage.setItem("innominatus-graph-api-key", apiKeyInput.value);
+    loadApps();
+  });
+  document.getElementById("reload").addEventListener("click", loadGraph);
+  document.getElementById("fit").addEventListener("click", fit);
+  window.addEventListener("resize", fit);
+  loadApps();
+})();
@@ -0,0 +1,126 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/execution"
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/google/uuid"
+)
+
+// copyNode copies a node for an event, so that subscribers see it as it was
+// when the event was published, also when they receive it later from a
+// Dispatcher. Properties are shared.
+func copyNode(node *graph.Node) *graph.Node {
+	copied := *node
+	return &copied
+}
+
+// copyEdge copies an edge for an event like copyNode
+func copyEdge(edge *graph.Edge) *graph.Edge {
+	copied := *edge
+	return &copied
+}
+
+// GraphObserver returns an observer publishing the changes of the graphs
+// it observes to publisher, e.g. for g.Observe(events.GraphObserver(bus))
+func GraphObserver(publisher Publisher) graph.GraphObserver {
+	return graphObserver{publisher: publisher}
+}
+
+type graphObserver struct {
+	publisher Publisher
+}
+
+func (o graphObserver) meta(g *graph.Graph) Meta {
+	return Meta{AppName: g.AppName, At: time.Now()}
+}
+
+func (o graphObserver) OnNodeAdded(g *graph.Graph, node *graph.Node) {
+	o.publisher.Publish(NodeAdded{Meta: o.meta(g), Node: copyNode(node)})
+}
+
+func (o graphObserver) OnNodeRemoved(g *graph.Graph, node *graph.Node) {
+	o.publisher.Publish(NodeRemoved{Meta: o.meta(g), Node: copyNode(node)})
+}
+
+func (o graphObserver) OnEdgeAdded(g *graph.Graph, edge *graph.Edge) {
+	o.publisher.Publish(EdgeAdded{Meta: o.meta(g), Edge: copyEdge(edge)})
+}
+
+func (o graphObserver) OnEdgeRemoved(g *graph.Graph, edge *graph.Edge) {
+	o.publisher.Publish(EdgeRemoved{Meta: o.meta(g), Edge: copyEdge(edge)})
+}
+
+func (o graphObserver) OnNodeStateChange(g *graph.Graph, node *graph.Node, oldState, newState graph.NodeState) {
+	o.publisher.Publish(NodeStateChanged{Meta: o.meta(g), Node: copyNode(node), OldState: oldState, NewState: newState})
+}
+
+// ExecutionObserver returns an engine observer publishing the runs of the
+// engine and the state changes of their nodes to publisher. Like engines,
+// which are created per run, it attributes the state changes to the run
+// started last.
+func ExecutionObserver(publisher Publisher) execution.RunObserver {
+	return TenantExecutionObserver(publisher, uuid.Nil)
+}
+
+// TenantExecutionObserver is ExecutionObserver for the runs of the apps of
+// a tenant, e.g. for the runs an execution.Worker claims
+func TenantExecutionObserver(publisher Publisher, tenantID uuid.UUID) execution.RunObserver {
+	return &executionObserver{publisher: publisher, tenantID: tenantID}
+}
+
+type executionObserver struct {
+	publisher Publisher
+	tenantID  uuid.UUID
+
+	mu      sync.Mutex
+	appName string
+	runID   uuid.UUID
+}
+
+func (o *executionObserver) OnRunStarted(plan *execution.ExecutionPlan) {
+	o.mu.Lock()
+	o.appName, o.runID = plan.AppName, plan.RunID
+	o.mu.Unlock()
+
+	o.publisher.Publish(RunStarted{
+		Meta:    Meta{AppName: plan.AppName, TenantID: o.tenantID, At: plan.StartTime},
+		RunID:   plan.RunID,
+		Version: plan.Version,
+	})
+}
+
+func (o *executionObserver) OnNodeStateChange(node *graph.Node, oldState, newState graph.NodeState) {
+	o.mu.Lock()
+	appName, runID := o.appName, o.runID
+	o.mu.Unlock()
+
+	o.publisher.Publish(NodeStateChanged{
+		Meta:     Meta{AppName: appName, TenantID: o.tenantID, At: time.Now()},
+		Node:     copyNode(node),
+		OldState: oldState,
+		NewState: newState,
+		RunID:    runID,
+	})
+}
+
+func (o *executionObserver) OnRunFinished(plan *execution.ExecutionPlan) {
+	event := RunCompleted{
+		Meta:   Meta{AppName: plan.AppName, TenantID: o.tenantID, At: time.Now()},
+		RunID:  plan.RunID,
+		Status: plan.Status,
+	}
+	if plan.EndTime != nil {
+		event.At = *plan.EndTime
+		event.Duration = plan.EndTime.Sub(plan.StartTime)
+	}
+	for _, node := range plan.Order {
+		if plan.Executions[node.ID].Status == execution.StatusFailed {
+			event.FailedNodes = append(event.FailedNodes, node.ID)
+		}
+	}
+	o.publisher.Publish(event)
+}
@@ -0,0 +1,90 @@
+package events
+
+import "sync"
+
+// Subscriber receives events
+type Subscriber interface {
+	OnEvent(event Event)
+}
+
+// SubscriberFunc lets a function subscribe
+type SubscriberFunc func(event Event)
+
+func (f SubscriberFunc) OnEvent(event Event) { f(event) }
+
+// Publisher is where the adapters of this package send events, e.g. a Bus
+type Publisher interface {
+	Publish(event Event)
+}
+
+// PublisherFunc lets a function publish
+type PublisherFunc func(event Event)
+
+func (f PublisherFunc) Publish(event Event) { f(event) }
+
+// OfType passes only the events of the given types on to subscriber
+func OfType(subscriber Subscriber, types ...Type) Subscriber {
+	wanted := make(map[Type]bool, len(types))
+	for _, t := range types {
+		wanted[t] = true
+	}
+	return SubscriberFunc(func(event Event) {
+		if wanted[event.Type()] {
+			subscriber.OnEvent(event)
+		}
+	})
+}
+
+// PublishOfType passes only the events of the given types on to
+// publisher, e.g. to keep the state changes of runs from a publisher that a
+// StatePoller publishes them to
+func PublishOfType(publisher Publisher, types ...Type) Publisher {
+	return PublisherFunc(OfType(SubscriberFunc(publisher.Publish), types...).OnEvent)
+}
+
+// Bus delivers the events published to it to its subscribers, in the
+// order they subscribed, on the goroutine publishing. It is safe for
+// concurrent use.
+type Bus struct {
+	mu            sync.RWMutex
+	subscriptions []*subscription
+}
+
+type subscription struct {
+	subscriber Subscriber
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe adds a subscriber for the events published from now on. The
+// returned function unsubscribes it.
+func (b *Bus) Subscribe(subscriber Subscriber) (unsubscribe func()) {
+	sub := &subscription{subscriber: subscriber}
+	b.mu.Lock()
+	b.subscriptions = append(b.subscriptions, sub)
+	b.mu.Unlock()
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, s := range b.subscriptions {
+			if s == sub {
+				b.subscriptions = append(b.subscriptions[:i:i], b.subscriptions[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Publish delivers event to the current subscribers
+func (b *Bus) Publish(event Event) {
+	b.mu.RLock()
+	subscriptions := b.subscriptions
+	b.mu.RUnlock()
+
+	for _, sub := range subscriptions {
+		sub.subscriber.OnEvent(event)
+	}
+}
@@ -0,0 +1,229 @@
+package events
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultQueueSize is the number of events queued per subscriber of a
+// Dispatcher unless configured otherwise
+const DefaultQueueSize = 256
+
+// OverflowPolicy is what a Dispatcher does with an event for a subscriber
+// whose queue is full
+type OverflowPolicy int
+
+const (
+	// Block makes Publish wait for room in the queue, so that a slow
+	// subscriber slows down the publisher instead of missing events
+	Block OverflowPolicy = iota
+	// DropNewest drops the event being published
+	DropNewest
+	// DropOldest drops the oldest queued event to make room, for
+	// subscribers that care most about the current state
+	DropOldest
+)
+
+// QueueOptions configure the queue of a subscriber
+type QueueOptions struct {
+	Size     int // Events queued at most; DefaultQueueSize if 0
+	Overflow OverflowPolicy
+}
+
+type DispatcherOptions struct {
+	// Queue configures the queues of subscribers added with Subscribe
+	Queue QueueOptions
+	// OnDrop is called with every event dropped for a subscriber, on the
+	// goroutine publishing it
+	OnDrop func(subscriber Subscriber, event Event)
+	// OnPanic is called when a subscriber panics on an event, on the
+	// goroutine of the subscriber. The subscriber keeps receiving events.
+	// Panics are logged if nil.
+	OnPanic func(subscriber Subscriber, event Event, recovered interface{})
+}
+
+// Dispatcher delivers the events published to it asynchronously: each
+// subscriber has a queue and a goroutine of its own, so that publishers do
+// not wait for subscribers, and subscribers neither for each other nor for
+// one that panics. Each subscriber receives events in the order they were
+// published. It is safe for concurrent use.
+type Dispatcher struct {
+	options DispatcherOptions
+	dropped atomic.Int64
+
+	mu     sync.RWMutex
+	queues []*queue
+	closed bool
+}
+
+func NewDispatcher(options DispatcherOptions) *Dispatcher {
+	return &Dispatcher{options: options}
+}
+
+// Subscribe adds a subscriber with the queue options of the dispatcher.
+// The returned function unsubscribes it; events queued by then are still
+// delivered.
+func (d *Dispatcher) Subscribe(subscriber Subscriber) (unsubscribe func()) {
+	return d.SubscribeWith(subscriber, d.options.Queue)
+}
+
+// SubscribeWith adds a subscriber with its own queue options, e.g. to drop
+// events for a slow subscriber while the others get every event
+func (d *Dispatcher) SubscribeWith(subscriber Subscriber, options QueueOptions) (unsubscribe func()) {
+	if options.Size <= 0 {
+		options.Size = DefaultQueueSize
+	}
+	q := newQueue(subscriber, options)
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return func() {}
+	}
+	d.queues = append(d.queues, q)
+	d.mu.Unlock()
+	go q.run(d.deliver)
+
+	return func() {
+		d.mu.Lock()
+		for i, other := range d.queues {
+			if other == q {
+				d.queues = append(d.queues[:i:i], d.queues[i+1:]...)
+				break
+			}
+		}
+		d.mu.Unlock()
+		q.close()
+	}
+}
+
+// Publish queues event for every subscriber, waiting only for the queues
+// of Block subscribers that are full. Events published after Close are
+// dropped.
+func (d *Dispatcher) Publish(event Event) {
+	d.mu.RLock()
+	queues, closed := d.queues, d.closed
+	d.mu.RUnlock()
+	if closed {
+		return
+	}
+
+	for _, q := range queues {
+		if dropped, ok := q.push(event); ok {
+			d.dropped.Add(1)
+			if d.options.OnDrop != nil {
+				d.options.OnDrop(q.subscriber, dropped)
+			}
+		}
+	}
+}
+
+// Dropped returns the number of events dropped for full queues so far
+func (d *Dispatcher) Dropped() int64 {
+	return d.dropped.Load()
+}
+
+// Close stops accepting events and returns once the subscribers have
+// received the events queued for them
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	queues := d.queues
+	d.queues, d.closed = nil, true
+	d.mu.Unlock()
+
+	for _, q := range queues {
+		q.close()
+	}
+	for _, q := range queues {
+		<-q.done
+	}
+}
+
+// deliver passes event to a subscriber, recovering from its panics
+func (d *Dispatcher) deliver(subscriber Subscriber, event Event) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			if d.options.OnPanic != nil {
+				d.options.OnPanic(subscriber, event, recovered)
+			} else {
+				log.Printf("Event subscriber panicked on %s event: %v", event.Type(), recovered)
+			}
+		}
+	}()
+	subscriber.OnEvent(event)
+}
+
+// queue holds the events for one subscriber until its goroutine delivers
+// them
+type queue struct {
+	subscriber Subscriber
+	options    QueueOptions
+
+	mu      sync.Mutex
+	changed *sync.Cond // signaled when events are pushed or taken and on close
+	events  []Event
+	closed  bool
+	done    chan struct{} // closed once the queued events are delivered after close
+}
+
+func newQueue(subscriber Subscriber, options QueueOptions) *queue {
+	q := &queue{subscriber: subscriber, options: options, done: make(chan struct{})}
+	q.changed = sync.NewCond(&q.mu)
+	return q
+}
+
+// push queues event, applying the overflow policy when the queue is full.
+// It returns the event dropped, if one was.
+func (q *queue) push(event Event) (dropped Event, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.events) >= q.options.Size && !q.closed {
+		switch q.options.Overflow {
+		case DropNewest:
+			return event, true
+		case DropOldest:
+			dropped, ok = q.events[0], true
+			q.events = q.events[1:]
+		default:
+			q.changed.Wait()
+		}
+	}
+	if q.closed {
+		return event, true
+	}
+	q.events = append(q.events, event)
+	q.changed.Broadcast()
+	return dropped, ok
+}
+
+// run delivers the queued events until the queue is closed and empty
+func (q *queue) run(deliver func(Subscriber, Event)) {
+	defer close(q.done)
+	for {
+		q.mu.Lock()
+		for len(q.events) == 0 && !q.closed {
+			q.changed.Wait()
+		}
+		if len(q.events) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		event := q.events[0]
+		q.events[0] = nil
+		q.events = q.events[1:]
+		q.changed.Broadcast()
+		q.mu.Unlock()
+
+		deliver(q.subscriber, event)
+	}
+}
+
+// close lets the queue deliver the queued events and stop; pushes waiting
+// for room drop their events
+func (q *queue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.changed.Broadcast()
+	q.mu.Unlock()
+}
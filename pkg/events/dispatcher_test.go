@@ -0,0 +1,219 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stateChange is a NodeStateChanged event of the node with id
+func stateChange(id string) Event {
+	return NodeStateChanged{Meta: Meta{AppName: "app"}, Node: &graph.Node{ID: id}}
+}
+
+// nodeIDs returns the IDs of the nodes of the NodeStateChanged events r
+// received
+func (r *recorder) nodeIDs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ids []string
+	for _, event := range r.events {
+		ids = append(ids, event.(NodeStateChanged).Node.ID)
+	}
+	return ids
+}
+
+// length returns the number of events queued
+func (q *queue) length() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.events)
+}
+
+// gate is a subscriber that blocks on each event until released
+type gate struct {
+	recorder
+	release chan struct{}
+}
+
+func newGate() *gate {
+	return &gate{release: make(chan struct{})}
+}
+
+func (g *gate) OnEvent(event Event) {
+	<-g.release
+	g.recorder.OnEvent(event)
+}
+
+func TestDispatcher_DeliversInOrderAndDrainsOnClose(t *testing.T) {
+	dispatcher := NewDispatcher(DispatcherOptions{})
+	first, second := &recorder{}, &recorder{}
+	dispatcher.Subscribe(first)
+	dispatcher.Subscribe(second)
+
+	for _, id := range []string{"a", "b", "c"} {
+		dispatcher.Publish(stateChange(id))
+	}
+	dispatcher.Close()
+	dispatcher.Publish(stateChange("d"))
+
+	assert.Equal(t, []string{"a", "b", "c"}, first.nodeIDs())
+	assert.Equal(t, []string{"a", "b", "c"}, second.nodeIDs())
+	assert.Zero(t, dispatcher.Dropped())
+}
+
+func TestDispatcher_SlowSubscriberDoesNotBlockPublisherOrOthers(t *testing.T) {
+	var dropped []string
+	dispatcher := NewDispatcher(DispatcherOptions{
+		OnDrop: func(subscriber Subscriber, event Event) {
+			dropped = append(dropped, event.(NodeStateChanged).Node.ID)
+		},
+	})
+	slow, fast := newGate(), &recorder{}
+	dispatcher.SubscribeWith(slow, QueueOptions{Size: 2, Overflow: DropNewest})
+	dispatcher.Subscribe(fast)
+
+	// The slow subscriber takes "a", queues "b" and "c" and drops the rest
+	dispatcher.Publish(stateChange("a"))
+	require.Eventually(t, func() bool {
+		return dispatcher.queues[0].length() == 0
+	}, time.Second, time.Millisecond)
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for _, id := range []string{"b", "c", "d", "e"} {
+			dispatcher.Publish(stateChange(id))
+		}
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publishing blocked on the slow subscriber")
+	}
+	require.Eventually(t, func() bool { return len(fast.nodeIDs()) == 5 }, time.Second, time.Millisecond)
+
+	close(slow.release)
+	dispatcher.Close()
+	assert.Equal(t, []string{"a", "b", "c"}, slow.nodeIDs())
+	assert.Equal(t, []string{"d", "e"}, dropped)
+	assert.Equal(t, int64(2), dispatcher.Dropped())
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, fast.nodeIDs())
+}
+
+func TestDispatcher_DropOldestKeepsLatestEvents(t *testing.T) {
+	dispatcher := NewDispatcher(DispatcherOptions{Queue: QueueOptions{Size: 2, Overflow: DropOldest}})
+	slow := newGate()
+	dispatcher.Subscribe(slow)
+
+	// Wait for the subscriber to take "a", so that the queue holds the rest
+	dispatcher.Publish(stateChange("a"))
+	require.Eventually(t, func() bool {
+		return dispatcher.queues[0].length() == 0
+	}, time.Second, time.Millisecond)
+	for _, id := range []string{"b", "c", "d", "e"} {
+		dispatcher.Publish(stateChange(id))
+	}
+
+	close(slow.release)
+	dispatcher.Close()
+	assert.Equal(t, []string{"a", "d", "e"}, slow.nodeIDs())
+	assert.Equal(t, int64(2), dispatcher.Dropped())
+}
+
+func TestDispatcher_BlockAppliesBackpressure(t *testing.T) {
+	dispatcher := NewDispatcher(DispatcherOptions{Queue: QueueOptions{Size: 1, Overflow: Block}})
+	slow := newGate()
+	dispatcher.Subscribe(slow)
+
+	var published atomic.Int32
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, id := range []string{"a", "b", "c"} {
+			dispatcher.Publish(stateChange(id))
+			published.Add(1)
+		}
+	}()
+
+	// One event is delivered, one queued and the third publish waits
+	require.Eventually(t, func() bool { return published.Load() == 2 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(2), published.Load())
+
+	close(slow.release)
+	<-done
+	dispatcher.Close()
+	assert.Equal(t, []string{"a", "b", "c"}, slow.nodeIDs())
+	assert.Zero(t, dispatcher.Dropped())
+}
+
+func TestDispatcher_IsolatesPanics(t *testing.T) {
+	var mu sync.Mutex
+	var panics []interface{}
+	dispatcher := NewDispatcher(DispatcherOptions{
+		OnPanic: func(subscriber Subscriber, event Event, recovered interface{}) {
+			mu.Lock()
+			defer mu.Unlock()
+			panics = append(panics, recovered)
+		},
+	})
+	received := &recorder{}
+	dispatcher.Subscribe(SubscriberFunc(func(event Event) {
+		if event.(NodeStateChanged).Node.ID == "a" {
+			panic("boom")
+		}
+		received.OnEvent(event)
+	}))
+	others := &recorder{}
+	dispatcher.Subscribe(others)
+
+	dispatcher.Publish(stateChange("a"))
+	dispatcher.Publish(stateChange("b"))
+	dispatcher.Close()
+
+	assert.Equal(t, []interface{}{"boom"}, panics)
+	assert.Equal(t, []string{"b"}, received.nodeIDs())
+	assert.Equal(t, []string{"a", "b"}, others.nodeIDs())
+}
+
+func TestDispatcher_UnsubscribeDeliversQueuedEvents(t *testing.T) {
+	dispatcher := NewDispatcher(DispatcherOptions{})
+	slow := newGate()
+	unsubscribe := dispatcher.Subscribe(slow)
+
+	dispatcher.Publish(stateChange("a"))
+	unsubscribe()
+	dispatcher.Publish(stateChange("b"))
+
+	close(slow.release)
+	dispatcher.Close()
+	require.Eventually(t, func() bool { return len(slow.nodeIDs()) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"a"}, slow.nodeIDs())
+}
+
+func TestGraphObserver_EventsKeepNodesAsPublished(t *testing.T) {
+	dispatcher := NewDispatcher(DispatcherOptions{})
+	slow := newGate()
+	dispatcher.Subscribe(slow)
+
+	g := graph.NewGraph("app")
+	g.Observe(GraphObserver(dispatcher))
+	require.NoError(t, g.AddNode(&graph.Node{ID: "a", Type: graph.NodeTypeWorkflow, Name: "A"}))
+	require.NoError(t, g.UpdateNodeState("a", graph.NodeStateRunning))
+	require.NoError(t, g.UpdateNodeState("a", graph.NodeStateSucceeded))
+
+	close(slow.release)
+	dispatcher.Close()
+	slow.mu.Lock()
+	defer slow.mu.Unlock()
+	require.Len(t, slow.events, 3)
+	assert.Equal(t, graph.NodeStateWaiting, slow.events[0].(NodeAdded).Node.State)
+	assert.Equal(t, graph.NodeStateRunning, slow.events[1].(NodeStateChanged).Node.State)
+	assert.Equal(t, graph.NodeStateSucceeded, slow.events[2].(NodeStateChanged).Node.State)
+}
@@ -0,0 +1,132 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Encoding is how events are serialized for message brokers
+type Encoding string
+
+const (
+	// EncodingJSON serializes an event as its JSON object with a "type"
+	// field added
+	EncodingJSON Encoding = "json"
+	// EncodingCloudEvents serializes an event as a CloudEvents 1.0 JSON
+	// envelope (structured content mode) holding the event as its data
+	EncodingCloudEvents Encoding = "cloudevents"
+)
+
+const (
+	// DefaultSource is the CloudEvents source of events unless configured
+	// otherwise
+	DefaultSource = "innominatus-graph"
+	// CloudEventsTypePrefix is prepended to the types of events to make
+	// their CloudEvents types, e.g. io.innominatus.graph.run.completed
+	CloudEventsTypePrefix = "io.innominatus.graph."
+)
+
+// Content types of the encodings
+const (
+	ContentTypeJSON        = "application/json"
+	ContentTypeCloudEvents = "application/cloudevents+json"
+)
+
+// ParseEncoding returns the encoding named s, e.g. of a flag
+func ParseEncoding(s string) (Encoding, error) {
+	switch encoding := Encoding(s); encoding {
+	case EncodingJSON, EncodingCloudEvents:
+		return encoding, nil
+	case "":
+		return EncodingJSON, nil
+	default:
+		return "", fmt.Errorf("unknown event encoding %q (expected json or cloudevents)", s)
+	}
+}
+
+// Message is an event encoded for a message broker
+type Message struct {
+	// Key is the app of the event, so that brokers partitioning by key,
+	// like Kafka, keep the events of an app in order
+	Key         string
+	Value       []byte
+	ContentType string
+	Type        Type
+}
+
+// Encoder encodes events for message brokers
+type Encoder struct {
+	Encoding Encoding // EncodingJSON if empty
+	Source   string   // CloudEvents source; DefaultSource if empty
+}
+
+// cloudEvent is the CloudEvents 1.0 JSON envelope of an event
+type cloudEvent struct {
+	SpecVersion     string     `json:"specversion"`
+	ID              string     `json:"id"`
+	Source          string     `json:"source"`
+	Type            string     `json:"type"`
+	Subject         string     `json:"subject,omitempty"`
+	Time            *time.Time `json:"time,omitempty"`
+	DataContentType string     `json:"datacontenttype"`
+	Data            Event      `json:"data"`
+}
+
+// Encode serializes event with the encoding of the encoder
+func (e Encoder) Encode(event Event) (Message, error) {
+	message := Message{Key: event.App(), Type: event.Type()}
+
+	var err error
+	switch e.Encoding {
+	case EncodingJSON, "":
+		message.ContentType = ContentTypeJSON
+		message.Value, err = encodeJSON(event)
+	case EncodingCloudEvents:
+		message.ContentType = ContentTypeCloudEvents
+		message.Value, err = e.encodeCloudEvent(event)
+	default:
+		return Message{}, fmt.Errorf("unknown event encoding %q", e.Encoding)
+	}
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to encode %s event: %w", event.Type(), err)
+	}
+	return message, nil
+}
+
+// encodeJSON adds the type to the JSON object of event, so that consumers
+// know what to decode it to
+func encodeJSON(event Event) ([]byte, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	fields["type"], _ = json.Marshal(event.Type())
+	return json.Marshal(fields)
+}
+
+func (e Encoder) encodeCloudEvent(event Event) ([]byte, error) {
+	source := e.Source
+	if source == "" {
+		source = DefaultSource
+	}
+	envelope := cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              uuid.NewString(),
+		Source:          source,
+		Type:            CloudEventsTypePrefix + string(event.Type()),
+		Subject:         event.App(),
+		DataContentType: ContentTypeJSON,
+		Data:            event,
+	}
+	if at := event.Time(); !at.IsZero() {
+		envelope.Time = &at
+	}
+	return json.Marshal(envelope)
+}
@@ -0,0 +1,89 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncoder_JSONAddsType(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	event := NodeStateChanged{
+		Meta:     Meta{AppName: "shop", At: at},
+		Node:     &graph.Node{ID: "db", Type: graph.NodeTypeResource, Name: "DB", State: graph.NodeStateFailed},
+		OldState: graph.NodeStateRunning,
+		NewState: graph.NodeStateFailed,
+	}
+
+	message, err := Encoder{}.Encode(event)
+	require.NoError(t, err)
+	assert.Equal(t, "shop", message.Key)
+	assert.Equal(t, TypeNodeStateChanged, message.Type)
+	assert.Equal(t, ContentTypeJSON, message.ContentType)
+
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(message.Value, &decoded))
+	assert.Equal(t, "node.state_changed", decoded["type"])
+	assert.Equal(t, "shop", decoded["app_name"])
+	assert.Equal(t, "2024-05-01T12:00:00Z", decoded["time"])
+	assert.Equal(t, "failed", decoded["new_state"])
+	assert.Equal(t, "db", decoded["node"].(map[string]interface{})["id"])
+}
+
+func TestEncoder_CloudEvents(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	event := RunCompleted{Meta: Meta{AppName: "shop", At: at}, Status: "failed", FailedNodes: []string{"db"}}
+
+	message, err := Encoder{Encoding: EncodingCloudEvents, Source: "/clusters/eu-1"}.Encode(event)
+	require.NoError(t, err)
+	assert.Equal(t, ContentTypeCloudEvents, message.ContentType)
+
+	var envelope struct {
+		SpecVersion     string          `json:"specversion"`
+		ID              string          `json:"id"`
+		Source          string          `json:"source"`
+		Type            string          `json:"type"`
+		Subject         string          `json:"subject"`
+		Time            time.Time       `json:"time"`
+		DataContentType string          `json:"datacontenttype"`
+		Data            json.RawMessage `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(message.Value, &envelope))
+	assert.Equal(t, "1.0", envelope.SpecVersion)
+	assert.NotEmpty(t, envelope.ID)
+	assert.Equal(t, "/clusters/eu-1", envelope.Source)
+	assert.Equal(t, "io.innominatus.graph.run.completed", envelope.Type)
+	assert.Equal(t, "shop", envelope.Subject)
+	assert.True(t, at.Equal(envelope.Time))
+	assert.Equal(t, ContentTypeJSON, envelope.DataContentType)
+
+	var data RunCompleted
+	require.NoError(t, json.Unmarshal(envelope.Data, &data))
+	assert.Equal(t, []string{"db"}, data.FailedNodes)
+
+	// Every event gets an ID of its own
+	again, err := Encoder{Encoding: EncodingCloudEvents}.Encode(event)
+	require.NoError(t, err)
+	assert.NotContains(t, string(again.Value), envelope.ID)
+	assert.Contains(t, string(again.Value), `"source":"innominatus-graph"`)
+}
+
+func TestParseEncoding(t *testing.T) {
+	encoding, err := ParseEncoding("cloudevents")
+	require.NoError(t, err)
+	assert.Equal(t, EncodingCloudEvents, encoding)
+
+	encoding, err = ParseEncoding("")
+	require.NoError(t, err)
+	assert.Equal(t, EncodingJSON, encoding)
+
+	_, err = ParseEncoding("avro")
+	assert.Error(t, err)
+	_, err = Encoder{Encoding: "avro"}.Encode(RunStarted{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,105 @@
+// Package events delivers the changes of graphs and of the runs executing
+// them as typed events, so that one subscriber sees what graph.GraphObserver
+// and execution.ExecutionObserver are each notified of.
+package events
+
+import (
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/execution"
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/google/uuid"
+)
+
+// Type names the kind of an event, e.g. for filtering with OfType
+type Type string
+
+const (
+	TypeNodeAdded        Type = "node.added"
+	TypeNodeRemoved      Type = "node.removed"
+	TypeNodeStateChanged Type = "node.state_changed"
+	TypeEdgeAdded        Type = "edge.added"
+	TypeEdgeRemoved      Type = "edge.removed"
+	TypeRunStarted       Type = "run.started"
+	TypeRunCompleted     Type = "run.completed"
+)
+
+// Event is one of the events of this package. Subscribers switch on the
+// concrete type for the details.
+type Event interface {
+	Type() Type
+	// App is the name of the app whose graph or run changed
+	App() string
+	// Tenant is the tenant owning the app, uuid.Nil for the default tenant
+	Tenant() uuid.UUID
+	// Time is when the change happened
+	Time() time.Time
+}
+
+// Meta holds what every event has
+type Meta struct {
+	AppName  string    `json:"app_name"`
+	TenantID uuid.UUID `json:"tenant_id"`
+	At       time.Time `json:"time"`
+}
+
+func (m Meta) App() string       { return m.AppName }
+func (m Meta) Tenant() uuid.UUID { return m.TenantID }
+func (m Meta) Time() time.Time   { return m.At }
+
+type NodeAdded struct {
+	Meta
+	Node *graph.Node `json:"node"`
+}
+
+type NodeRemoved struct {
+	Meta
+	Node *graph.Node `json:"node"`
+}
+
+// NodeStateChanged is a transition of a node, including those propagated
+// to workflows and steps. RunID is uuid.Nil for changes made outside of
+// runs.
+type NodeStateChanged struct {
+	Meta
+	Node     *graph.Node     `json:"node"`
+	OldState graph.NodeState `json:"old_state"`
+	NewState graph.NodeState `json:"new_state"`
+	RunID    uuid.UUID       `json:"run_id"`
+}
+
+type EdgeAdded struct {
+	Meta
+	Edge *graph.Edge `json:"edge"`
+}
+
+type EdgeRemoved struct {
+	Meta
+	Edge *graph.Edge `json:"edge"`
+}
+
+// RunStarted is sent when a run starts executing its nodes
+type RunStarted struct {
+	Meta
+	RunID   uuid.UUID `json:"run_id"`
+	Version int       `json:"version"`
+}
+
+// RunCompleted is sent when a run has finished, with Status completed or
+// failed
+type RunCompleted struct {
+	Meta
+	RunID       uuid.UUID                 `json:"run_id"`
+	Status      execution.ExecutionStatus `json:"status"`
+	Duration    time.Duration             `json:"duration"`
+	FailedNodes []string                  `json:"failed_nodes,omitempty"`
+}
+
+func (NodeAdded) Type() Type        { return TypeNodeAdded }
+func (NodeRemoved) Type() Type      { return TypeNodeRemoved }
+func (NodeStateChanged) Type() Type { return TypeNodeStateChanged }
+func (EdgeAdded) Type() Type        { return TypeEdgeAdded }
+func (EdgeRemoved) Type() Type      { return TypeEdgeRemoved }
+func (RunStarted) Type() Type       { return TypeRunStarted }
+func (RunCompleted) Type() Type     { return TypeRunCompleted }
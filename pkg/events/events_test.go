@@ -0,0 +1,133 @@
+package events
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/philipsahli/innominatus-graph/pkg/execution"
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder collects the events it receives
+type recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *recorder) OnEvent(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) types() []Type {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	types := make([]Type, len(r.events))
+	for i, event := range r.events {
+		types[i] = event.Type()
+	}
+	return types
+}
+
+func TestBus_DeliversToSubscribersUntilUnsubscribed(t *testing.T) {
+	bus := NewBus()
+	first, second := &recorder{}, &recorder{}
+	unsubscribe := bus.Subscribe(first)
+	bus.Subscribe(second)
+
+	bus.Publish(NodeAdded{Meta: Meta{AppName: "app"}})
+	unsubscribe()
+	bus.Publish(NodeRemoved{Meta: Meta{AppName: "app"}})
+
+	assert.Equal(t, []Type{TypeNodeAdded}, first.types())
+	assert.Equal(t, []Type{TypeNodeAdded, TypeNodeRemoved}, second.types())
+}
+
+func TestOfType_PassesOnlyGivenTypes(t *testing.T) {
+	bus := NewBus()
+	runs := &recorder{}
+	bus.Subscribe(OfType(runs, TypeRunStarted, TypeRunCompleted))
+
+	bus.Publish(RunStarted{})
+	bus.Publish(NodeStateChanged{})
+	bus.Publish(RunCompleted{})
+
+	assert.Equal(t, []Type{TypeRunStarted, TypeRunCompleted}, runs.types())
+}
+
+func TestGraphObserver_PublishesChanges(t *testing.T) {
+	bus := NewBus()
+	received := &recorder{}
+	bus.Subscribe(received)
+
+	g := graph.NewGraph("app")
+	g.Observe(GraphObserver(bus))
+	require.NoError(t, g.AddNode(&graph.Node{ID: "wf", Type: graph.NodeTypeWorkflow, Name: "Workflow"}))
+	require.NoError(t, g.AddNode(&graph.Node{ID: "step", Type: graph.NodeTypeStep, Name: "Step"}))
+	require.NoError(t, g.AddEdge(&graph.Edge{ID: "e1", FromNodeID: "wf", ToNodeID: "step", Type: graph.EdgeTypeContains}))
+	require.NoError(t, g.UpdateNodeState("step", graph.NodeStateFailed))
+	require.NoError(t, g.RemoveNode("step"))
+
+	assert.Equal(t, []Type{
+		TypeNodeAdded, TypeNodeAdded, TypeEdgeAdded,
+		TypeNodeStateChanged, TypeNodeStateChanged, // the step and its workflow
+		TypeEdgeRemoved, TypeNodeRemoved,
+	}, received.types())
+
+	propagated := received.events[4].(NodeStateChanged)
+	assert.Equal(t, "app", propagated.App())
+	assert.Equal(t, "wf", propagated.Node.ID)
+	assert.Equal(t, graph.NodeStateWaiting, propagated.OldState)
+	assert.Equal(t, graph.NodeStateFailed, propagated.NewState)
+	assert.Equal(t, "e1", received.events[5].(EdgeRemoved).Edge.ID)
+}
+
+func TestExecutionObserver_PublishesRun(t *testing.T) {
+	db, err := storage.NewSQLiteConnection(filepath.Join(t.TempDir(), "graph.db"))
+	require.NoError(t, err)
+	require.NoError(t, storage.AutoMigrate(db))
+	repo := storage.NewRepository(db)
+
+	g := graph.NewGraph("app")
+	require.NoError(t, g.AddNode(&graph.Node{ID: "spec", Type: graph.NodeTypeSpec, Name: "Spec"}))
+	require.NoError(t, g.AddNode(&graph.Node{ID: "wf", Type: graph.NodeTypeWorkflow, Name: "Workflow"}))
+	require.NoError(t, g.AddEdge(&graph.Edge{ID: "e1", FromNodeID: "wf", ToNodeID: "spec", Type: graph.EdgeTypeDependsOn}))
+	require.NoError(t, repo.SaveGraph("app", g))
+
+	bus := NewBus()
+	received := &recorder{}
+	bus.Subscribe(received)
+	engine := execution.NewEngine(repo, execution.NewMockWorkflowRunner())
+	engine.RegisterObserver(ExecutionObserver(bus))
+	plan, err := engine.ExecuteGraph("app")
+	require.NoError(t, err)
+
+	assert.Equal(t, []Type{
+		TypeRunStarted,
+		TypeNodeStateChanged, TypeNodeStateChanged, // spec running, succeeded
+		TypeNodeStateChanged, TypeNodeStateChanged, // wf running, succeeded
+		TypeRunCompleted,
+	}, received.types())
+
+	started := received.events[0].(RunStarted)
+	assert.Equal(t, plan.RunID, started.RunID)
+	assert.Equal(t, "app", started.App())
+
+	changed := received.events[1].(NodeStateChanged)
+	assert.Equal(t, plan.RunID, changed.RunID)
+	assert.Equal(t, "app", changed.App())
+	assert.Equal(t, "spec", changed.Node.ID)
+	assert.Equal(t, graph.NodeStateRunning, changed.NewState)
+
+	completed := received.events[5].(RunCompleted)
+	assert.Equal(t, plan.RunID, completed.RunID)
+	assert.Equal(t, execution.StatusCompleted, completed.Status)
+	assert.Empty(t, completed.FailedNodes)
+	assert.Equal(t, completed.Time().Sub(started.Time()), completed.Duration)
+}
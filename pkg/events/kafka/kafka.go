@@ -0,0 +1,130 @@
+// Package kafka publishes graph and run events to a Kafka topic, for
+// analytics and for services reacting to them. Messages are keyed by app,
+// so that the events of an app stay in order within their partition.
+package kafka
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/events"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// DefaultTimeout bounds each write unless configured otherwise
+const DefaultTimeout = 10 * time.Second
+
+// Header names of the messages, next to the content-type header
+const (
+	HeaderEventType = "event-type"
+	HeaderApp       = "app"
+)
+
+// Writer writes messages to Kafka, like *kafka.Writer of segmentio/kafka-go
+type Writer interface {
+	WriteMessages(ctx context.Context, messages ...kafkago.Message) error
+	Close() error
+}
+
+// Options configure a Publisher
+type Options struct {
+	Brokers  []string        // host:port of the brokers; unused by NewPublisherWithWriter
+	Topic    string          // Required by NewPublisher
+	Encoding events.Encoding // EncodingJSON if empty
+	Source   string          // CloudEvents source; events.DefaultSource if empty
+	Timeout  time.Duration   // Per write; DefaultTimeout if 0
+	// OnError is called when an event cannot be encoded or written. Errors
+	// are logged if nil.
+	OnError func(event events.Event, err error)
+}
+
+// Publisher writes the events published to it to a Kafka topic, waiting
+// until they are written. To keep graph changes and runs from waiting for
+// Kafka, subscribe it to an events.Dispatcher:
+//
+//	dispatcher.Subscribe(publisher)
+//	g.Observe(events.GraphObserver(dispatcher))
+type Publisher struct {
+	writer  Writer
+	encoder events.Encoder
+	options Options
+}
+
+// NewPublisher returns a publisher writing to options.Topic of the brokers
+func NewPublisher(options Options) (*Publisher, error) {
+	if len(options.Brokers) == 0 {
+		return nil, errors.New("kafka brokers are required")
+	}
+	if options.Topic == "" {
+		return nil, errors.New("kafka topic is required")
+	}
+	writer := &kafkago.Writer{
+		Addr:         kafkago.TCP(options.Brokers...),
+		Balancer:     &kafkago.Hash{},
+		RequiredAcks: kafkago.RequireAll,
+		BatchTimeout: 10 * time.Millisecond, // Writes wait for their batch
+	}
+	return NewPublisherWithWriter(writer, options)
+}
+
+// NewPublisherWithWriter returns a publisher using writer, e.g. a
+// kafka.Writer configured for TLS or SASL. Messages are sent to
+// options.Topic, which is left empty for writers with a topic of their own.
+func NewPublisherWithWriter(writer Writer, options Options) (*Publisher, error) {
+	if _, err := events.ParseEncoding(string(options.Encoding)); err != nil {
+		return nil, err
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultTimeout
+	}
+	return &Publisher{
+		writer:  writer,
+		encoder: events.Encoder{Encoding: options.Encoding, Source: options.Source},
+		options: options,
+	}, nil
+}
+
+// Publish writes event to the topic, reporting failures to OnError
+func (p *Publisher) Publish(event events.Event) {
+	if err := p.write(event); err != nil {
+		if p.options.OnError != nil {
+			p.options.OnError(event, err)
+		} else {
+			log.Printf("Failed to publish %s event of app %s to Kafka: %v", event.Type(), event.App(), err)
+		}
+	}
+}
+
+// OnEvent lets the publisher subscribe to a Bus or Dispatcher
+func (p *Publisher) OnEvent(event events.Event) {
+	p.Publish(event)
+}
+
+func (p *Publisher) write(event events.Event) error {
+	encoded, err := p.encoder.Encode(event)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.options.Timeout)
+	defer cancel()
+	return p.writer.WriteMessages(ctx, kafkago.Message{
+		Topic: p.options.Topic,
+		Key:   []byte(encoded.Key),
+		Value: encoded.Value,
+		Headers: []kafkago.Header{
+			{Key: "content-type", Value: []byte(encoded.ContentType)},
+			{Key: HeaderEventType, Value: []byte(encoded.Type)},
+			{Key: HeaderApp, Value: []byte(encoded.Key)},
+		},
+		Time: event.Time(),
+	})
+}
+
+// Close flushes pending messages and closes the writer
+func (p *Publisher) Close() error {
+	return p.writer.Close()
+}
@@ -0,0 +1,95 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/philipsahli/innominatus-graph/pkg/events"
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeWriter records the messages written to it
+type fakeWriter struct {
+	messages []kafkago.Message
+	err      error
+	closed   bool
+}
+
+func (w *fakeWriter) WriteMessages(ctx context.Context, messages ...kafkago.Message) error {
+	if _, ok := ctx.Deadline(); !ok {
+		return errors.New("write without timeout")
+	}
+	if w.err != nil {
+		return w.err
+	}
+	w.messages = append(w.messages, messages...)
+	return nil
+}
+
+func (w *fakeWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func header(message kafkago.Message, key string) string {
+	for _, h := range message.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func TestPublisher_WritesGraphEventsKeyedByApp(t *testing.T) {
+	writer := &fakeWriter{}
+	publisher, err := NewPublisherWithWriter(writer, Options{Topic: "graph-events", Encoding: events.EncodingCloudEvents})
+	require.NoError(t, err)
+
+	g := graph.NewGraph("shop")
+	g.Observe(events.GraphObserver(publisher))
+	require.NoError(t, g.AddNode(&graph.Node{ID: "db", Type: graph.NodeTypeResource, Name: "DB"}))
+	require.NoError(t, g.UpdateNodeState("db", graph.NodeStateRunning))
+	require.NoError(t, publisher.Close())
+
+	require.Len(t, writer.messages, 2)
+	message := writer.messages[1]
+	assert.Equal(t, "graph-events", message.Topic)
+	assert.Equal(t, "shop", string(message.Key))
+	assert.Equal(t, events.ContentTypeCloudEvents, header(message, "content-type"))
+	assert.Equal(t, "node.state_changed", header(message, HeaderEventType))
+	assert.Equal(t, "shop", header(message, HeaderApp))
+	assert.Contains(t, string(message.Value), `"type":"io.innominatus.graph.node.state_changed"`)
+	assert.True(t, writer.closed)
+}
+
+func TestPublisher_ReportsErrors(t *testing.T) {
+	writer := &fakeWriter{err: errors.New("leader not available")}
+	var failed []events.Type
+	publisher, err := NewPublisherWithWriter(writer, Options{
+		Topic:   "graph-events",
+		OnError: func(event events.Event, err error) { failed = append(failed, event.Type()) },
+	})
+	require.NoError(t, err)
+
+	publisher.OnEvent(events.RunStarted{Meta: events.Meta{AppName: "shop"}})
+	assert.Equal(t, []events.Type{events.TypeRunStarted}, failed)
+}
+
+func TestNewPublisher_ValidatesOptions(t *testing.T) {
+	_, err := NewPublisher(Options{Topic: "graph-events"})
+	assert.Error(t, err)
+	_, err = NewPublisher(Options{Brokers: []string{"localhost:9092"}})
+	assert.Error(t, err)
+	_, err = NewPublisherWithWriter(&fakeWriter{}, Options{Encoding: "avro"})
+	assert.Error(t, err)
+
+	// Connecting is deferred to the first write
+	publisher, err := NewPublisher(Options{Brokers: []string{"localhost:9092"}, Topic: "graph-events"})
+	require.NoError(t, err)
+	assert.NoError(t, publisher.Close())
+}
@@ -0,0 +1,132 @@
+// Package nats publishes graph and run events to NATS, for analytics and
+// for services reacting to them. Each event goes to the subject of its
+// type below a configured prefix, e.g. innominatus.events.run.completed,
+// so that subscribers pick events with wildcards like innominatus.events.run.>
+package nats
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/events"
+
+	natsio "github.com/nats-io/nats.go"
+)
+
+// DefaultFlushTimeout bounds how long Close waits for pending messages
+const DefaultFlushTimeout = 10 * time.Second
+
+// Header names of the messages, next to the Content-Type header
+const (
+	HeaderEventType = "Event-Type"
+	HeaderApp       = "App"
+)
+
+// Conn publishes messages, like *nats.Conn of nats-io/nats.go
+type Conn interface {
+	PublishMsg(msg *natsio.Msg) error
+}
+
+// Options configure a Publisher
+type Options struct {
+	URL      string          // nats.DefaultURL if empty; unused by NewPublisherWithConn
+	Subject  string          // Prefix of the subjects of the events
+	Encoding events.Encoding // EncodingJSON if empty
+	Source   string          // CloudEvents source; events.DefaultSource if empty
+	// OnError is called when an event cannot be encoded or published.
+	// Errors are logged if nil.
+	OnError func(event events.Event, err error)
+}
+
+// Publisher publishes the events published to it to NATS. Publishing only
+// buffers messages for the connection, but a Publisher can also subscribe
+// to an events.Dispatcher like the other subscribers.
+type Publisher struct {
+	conn    Conn
+	owned   *natsio.Conn // Connection created by NewPublisher, closed by Close
+	encoder events.Encoder
+	options Options
+}
+
+// NewPublisher connects to options.URL and returns a publisher using the
+// connection
+func NewPublisher(options Options) (*Publisher, error) {
+	url := options.URL
+	if url == "" {
+		url = natsio.DefaultURL
+	}
+	conn, err := natsio.Connect(url, natsio.Name(events.DefaultSource))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	publisher, err := NewPublisherWithConn(conn, options)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	publisher.owned = conn
+	return publisher, nil
+}
+
+// NewPublisherWithConn returns a publisher using conn, e.g. a connection
+// with credentials or TLS. Close leaves conn open.
+func NewPublisherWithConn(conn Conn, options Options) (*Publisher, error) {
+	if options.Subject == "" {
+		return nil, errors.New("nats subject is required")
+	}
+	if _, err := events.ParseEncoding(string(options.Encoding)); err != nil {
+		return nil, err
+	}
+	return &Publisher{
+		conn:    conn,
+		encoder: events.Encoder{Encoding: options.Encoding, Source: options.Source},
+		options: options,
+	}, nil
+}
+
+// Subject returns the subject the events of type t are published to
+func (p *Publisher) Subject(t events.Type) string {
+	return p.options.Subject + "." + string(t)
+}
+
+// Publish publishes event, reporting failures to OnError
+func (p *Publisher) Publish(event events.Event) {
+	if err := p.publish(event); err != nil {
+		if p.options.OnError != nil {
+			p.options.OnError(event, err)
+		} else {
+			log.Printf("Failed to publish %s event of app %s to NATS: %v", event.Type(), event.App(), err)
+		}
+	}
+}
+
+// OnEvent lets the publisher subscribe to a Bus or Dispatcher
+func (p *Publisher) OnEvent(event events.Event) {
+	p.Publish(event)
+}
+
+func (p *Publisher) publish(event events.Event) error {
+	encoded, err := p.encoder.Encode(event)
+	if err != nil {
+		return err
+	}
+
+	msg := natsio.NewMsg(p.Subject(encoded.Type))
+	msg.Data = encoded.Value
+	msg.Header.Set("Content-Type", encoded.ContentType)
+	msg.Header.Set(HeaderEventType, string(encoded.Type))
+	msg.Header.Set(HeaderApp, encoded.Key)
+	return p.conn.PublishMsg(msg)
+}
+
+// Close sends the pending messages and closes the connection if the
+// publisher created it
+func (p *Publisher) Close() error {
+	if p.owned == nil {
+		return nil
+	}
+	defer p.owned.Close()
+	return p.owned.FlushTimeout(DefaultFlushTimeout)
+}
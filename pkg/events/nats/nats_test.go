@@ -0,0 +1,74 @@
+package nats
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/philipsahli/innominatus-graph/pkg/events"
+
+	natsio "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConn records the messages published to it
+type fakeConn struct {
+	messages []*natsio.Msg
+	err      error
+}
+
+func (c *fakeConn) PublishMsg(msg *natsio.Msg) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.messages = append(c.messages, msg)
+	return nil
+}
+
+func TestPublisher_PublishesToSubjectOfType(t *testing.T) {
+	conn := &fakeConn{}
+	publisher, err := NewPublisherWithConn(conn, Options{Subject: "innominatus.events"})
+	require.NoError(t, err)
+
+	bus := events.NewBus()
+	bus.Subscribe(publisher)
+	bus.Publish(events.RunStarted{Meta: events.Meta{AppName: "shop"}, Version: 3})
+	bus.Publish(events.RunCompleted{Meta: events.Meta{AppName: "shop"}, Status: "completed"})
+	require.NoError(t, publisher.Close())
+
+	require.Len(t, conn.messages, 2)
+	msg := conn.messages[0]
+	assert.Equal(t, "innominatus.events.run.started", msg.Subject)
+	assert.Equal(t, "innominatus.events.run.completed", conn.messages[1].Subject)
+	assert.Equal(t, events.ContentTypeJSON, msg.Header.Get("Content-Type"))
+	assert.Equal(t, "run.started", msg.Header.Get(HeaderEventType))
+	assert.Equal(t, "shop", msg.Header.Get(HeaderApp))
+
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(msg.Data, &decoded))
+	assert.Equal(t, "run.started", decoded["type"])
+	assert.Equal(t, float64(3), decoded["version"])
+}
+
+func TestPublisher_ReportsErrors(t *testing.T) {
+	conn := &fakeConn{err: natsio.ErrConnectionClosed}
+	var reported error
+	publisher, err := NewPublisherWithConn(conn, Options{
+		Subject: "innominatus.events",
+		OnError: func(event events.Event, err error) { reported = err },
+	})
+	require.NoError(t, err)
+
+	publisher.Publish(events.RunStarted{})
+	assert.True(t, errors.Is(reported, natsio.ErrConnectionClosed))
+}
+
+func TestNewPublisher_ValidatesOptions(t *testing.T) {
+	_, err := NewPublisherWithConn(&fakeConn{}, Options{})
+	assert.Error(t, err)
+	_, err = NewPublisherWithConn(&fakeConn{}, Options{Subject: "innominatus.events", Encoding: "avro"})
+	assert.Error(t, err)
+	_, err = NewPublisher(Options{URL: "nats://127.0.0.1:1", Subject: "innominatus.events"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,145 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/google/uuid"
+)
+
+// DefaultStatePollInterval is how often a StatePoller reads the state
+// history unless configured otherwise
+const DefaultStatePollInterval = time.Second
+
+// StateChangeLog is the state history of the apps of every tenant,
+// implemented by storage.Repository
+type StateChangeLog interface {
+	GetStateChangesAfter(changedAt time.Time, id uuid.UUID, limit int) ([]storage.NodeStateChangeModel, error)
+}
+
+type StatePollerOptions struct {
+	Interval time.Duration // DefaultStatePollInterval if 0
+	// Lookback is how far before the last change read the next poll starts,
+	// for changes committed after later ones or recorded by replicas whose
+	// clocks lag behind; 5 seconds if 0
+	Lookback time.Duration
+	// BatchSize is the number of changes read at once; 500 if 0
+	BatchSize int
+	Logger    *slog.Logger // slog.Default() if nil
+}
+
+// StatePoller publishes the node state changes recorded in the state
+// history as NodeStateChanged events, so that the subscribers of one
+// process see the changes of the runs and state updates of every replica
+// sharing the database. The events are published once each, in the order
+// recorded, from when the poller is created; their nodes hold only the ID
+// and the new state.
+type StatePoller struct {
+	history   StateChangeLog
+	publisher Publisher
+	options   StatePollerOptions
+	started   time.Time
+
+	mu     sync.Mutex
+	cursor time.Time               // Time of the last change read
+	seen   map[uuid.UUID]time.Time // Changes published within the lookback
+}
+
+func NewStatePoller(history StateChangeLog, publisher Publisher, options StatePollerOptions) *StatePoller {
+	if options.Interval <= 0 {
+		options.Interval = DefaultStatePollInterval
+	}
+	if options.Lookback <= 0 {
+		options.Lookback = 5 * time.Second
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = 500
+	}
+	if options.Logger == nil {
+		options.Logger = slog.Default()
+	}
+	now := time.Now()
+	return &StatePoller{
+		history:   history,
+		publisher: publisher,
+		options:   options,
+		started:   now,
+		cursor:    now,
+		seen:      make(map[uuid.UUID]time.Time),
+	}
+}
+
+// Run polls the state history until ctx is done. Failed polls are logged
+// and retried at the next interval.
+func (p *StatePoller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := p.Poll(); err != nil {
+			p.options.Logger.Error("failed to poll state changes", "error", err)
+		}
+	}
+}
+
+// Poll publishes the changes recorded since the last poll
+func (p *StatePoller) Poll() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	from, id := p.cursor.Add(-p.options.Lookback), uuid.Nil
+	for {
+		changes, err := p.history.GetStateChangesAfter(from, id, p.options.BatchSize)
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			p.publish(change)
+		}
+		if len(changes) < p.options.BatchSize {
+			break
+		}
+		last := changes[len(changes)-1]
+		from, id = last.ChangedAt, last.ID
+	}
+
+	horizon := p.cursor.Add(-p.options.Lookback)
+	for id, changedAt := range p.seen {
+		if changedAt.Before(horizon) {
+			delete(p.seen, id)
+		}
+	}
+	return nil
+}
+
+// publish publishes a change unless it was published before or recorded
+// before the poller was created
+func (p *StatePoller) publish(change storage.NodeStateChangeModel) {
+	if _, seen := p.seen[change.ID]; seen || change.ChangedAt.Before(p.started) {
+		return
+	}
+	p.seen[change.ID] = change.ChangedAt
+	if change.ChangedAt.After(p.cursor) {
+		p.cursor = change.ChangedAt
+	}
+
+	event := NodeStateChanged{
+		Meta:     Meta{AppName: change.App.Name, TenantID: change.App.TenantID, At: change.ChangedAt},
+		Node:     &graph.Node{ID: change.NodeID, State: graph.NodeState(change.NewState)},
+		OldState: graph.NodeState(change.OldState),
+		NewState: graph.NodeState(change.NewState),
+	}
+	if change.RunID != nil {
+		event.RunID = *change.RunID
+	}
+	p.publisher.Publish(event)
+}
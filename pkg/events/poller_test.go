@@ -0,0 +1,147 @@
+package events
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// stateHistory is a database with the app "app" of the default tenant and
+// of another one
+type stateHistory struct {
+	db       *gorm.DB
+	repo     *storage.Repository
+	tenantID uuid.UUID
+}
+
+func newStateHistory(t *testing.T) *stateHistory {
+	t.Helper()
+	db, err := storage.NewSQLiteConnection(filepath.Join(t.TempDir(), "graph.db"))
+	require.NoError(t, err)
+	require.NoError(t, storage.AutoMigrate(db))
+	repo := storage.NewRepository(db)
+	tenant, err := repo.CreateTenant("other")
+	require.NoError(t, err)
+
+	for _, scoped := range []storage.RepositoryInterface{repo, repo.ForTenant(storage.WithTenant(context.Background(), tenant.ID))} {
+		g := graph.NewGraph("app")
+		require.NoError(t, g.AddNode(&graph.Node{ID: "db", Type: graph.NodeTypeResource, Name: "DB"}))
+		require.NoError(t, scoped.SaveGraph("app", g))
+	}
+	return &stateHistory{db: db, repo: repo, tenantID: tenant.ID}
+}
+
+// insert writes a state change of the node db straight to the database,
+// as another replica does
+func (h *stateHistory) insert(t *testing.T, tenantID uuid.UUID, newState graph.NodeState, changedAt time.Time) {
+	t.Helper()
+	var app storage.App
+	require.NoError(t, h.db.Where("name = ? AND tenant_id = ?", "app", tenantID).First(&app).Error)
+	require.NoError(t, h.db.Omit("App").Create(&storage.NodeStateChangeModel{
+		ID:        uuid.New(),
+		AppID:     app.ID,
+		NodeID:    "db",
+		OldState:  string(graph.NodeStateWaiting),
+		NewState:  string(newState),
+		ChangedAt: changedAt,
+	}).Error)
+}
+
+// stateRecorder records the state changes published to it
+type stateRecorder struct {
+	mu      sync.Mutex
+	changes []NodeStateChanged
+}
+
+func (r *stateRecorder) Publish(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.changes = append(r.changes, event.(NodeStateChanged))
+}
+
+// take returns the changes published since it was last called
+func (r *stateRecorder) take() []NodeStateChanged {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changes := r.changes
+	r.changes = nil
+	return changes
+}
+
+func TestStatePoller_DeliversChangesWrittenToTheDatabase(t *testing.T) {
+	history := newStateHistory(t)
+	dispatcher := NewDispatcher(DispatcherOptions{})
+	defer dispatcher.Close()
+	received := make(chan NodeStateChanged, 8)
+	dispatcher.Subscribe(SubscriberFunc(func(event Event) {
+		received <- event.(NodeStateChanged)
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	poller := NewStatePoller(history.repo, dispatcher, StatePollerOptions{Interval: 10 * time.Millisecond})
+	go poller.Run(ctx)
+
+	history.insert(t, history.tenantID, graph.NodeStateRunning, time.Now())
+	select {
+	case change := <-received:
+		assert.Equal(t, "app", change.AppName)
+		assert.Equal(t, history.tenantID, change.TenantID)
+		assert.Equal(t, "db", change.Node.ID)
+		assert.Equal(t, graph.NodeStateWaiting, change.OldState)
+		assert.Equal(t, graph.NodeStateRunning, change.NewState)
+		assert.Equal(t, uuid.Nil, change.RunID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the change was not delivered")
+	}
+
+	runID := uuid.New()
+	require.NoError(t, history.repo.RecordNodeStateChange("app", "db", graph.NodeStateRunning, graph.NodeStateSucceeded, &runID))
+	select {
+	case change := <-received:
+		assert.Equal(t, storage.DefaultTenantID, change.TenantID)
+		assert.Equal(t, graph.NodeStateSucceeded, change.NewState)
+		assert.Equal(t, runID, change.RunID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the change was not delivered")
+	}
+}
+
+func TestStatePoller_PublishesEachChangeOnce(t *testing.T) {
+	history := newStateHistory(t)
+	published := &stateRecorder{}
+	poller := NewStatePoller(history.repo, published, StatePollerOptions{Lookback: time.Minute, BatchSize: 2})
+	now := time.Now()
+
+	history.insert(t, storage.DefaultTenantID, graph.NodeStateFailed, now.Add(-time.Second))
+	require.NoError(t, poller.Poll())
+	assert.Empty(t, published.take(), "changes recorded before the poller was created")
+
+	// Pages of changes recorded at the same time
+	for i := 0; i < 3; i++ {
+		history.insert(t, storage.DefaultTenantID, graph.NodeStateRunning, now.Add(time.Second))
+	}
+	require.NoError(t, poller.Poll())
+	assert.Len(t, published.take(), 3)
+	require.NoError(t, poller.Poll())
+	assert.Empty(t, published.take(), "published already")
+
+	// A change committed late, or by a replica whose clock lags, is read
+	// within the lookback
+	history.insert(t, history.tenantID, graph.NodeStateSucceeded, now.Add(500*time.Millisecond))
+	require.NoError(t, poller.Poll())
+	changes := published.take()
+	require.Len(t, changes, 1)
+	assert.Equal(t, history.tenantID, changes[0].TenantID)
+	assert.Equal(t, graph.NodeStateSucceeded, changes[0].NewState)
+}
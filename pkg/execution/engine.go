@@ -1,6 +1,7 @@
 package execution
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"time"
@@ -17,6 +18,17 @@ type ExecutionObserver interface {
 	OnNodeStateChange(node *graph.Node, oldState, newState graph.NodeState)
 }
 
+// RunObserver is an ExecutionObserver that is also notified when the runs
+// of the engine start executing and when they finish. Observers registered
+// with the engine implement it optionally.
+type RunObserver interface {
+	ExecutionObserver
+	OnRunStarted(plan *ExecutionPlan)
+	// OnRunFinished is called with the completed or failed plan once its
+	// outcome is recorded
+	OnRunFinished(plan *ExecutionPlan)
+}
+
 type ExecutionStatus string
 
 const (
@@ -47,8 +59,17 @@ type ExecutionPlan struct {
 	Order      []*graph.Node             `json:"order"`
 }
 
+// Store is the storage the engine needs to load graphs and record runs and
+// node state changes. storage.Repository implements it, as can any other
+// backend implementing the three storage interfaces.
+type Store interface {
+	storage.GraphStore
+	storage.RunStore
+	storage.StateStore
+}
+
 type Engine struct {
-	repository storage.RepositoryInterface
+	repository Store
 	runner     WorkflowRunner
 	observers  []ExecutionObserver
 }
@@ -59,7 +80,7 @@ type WorkflowRunner interface {
 	CreateResource(workflow *graph.Node, target *graph.Node) error
 }
 
-func NewEngine(repository storage.RepositoryInterface, runner WorkflowRunner) *Engine {
+func NewEngine(repository Store, runner WorkflowRunner) *Engine {
 	return &Engine{
 		repository: repository,
 		runner:     runner,
@@ -79,24 +100,112 @@ func (e *Engine) notifyStateChange(node *graph.Node, oldState, newState graph.No
 	}
 }
 
+// notifyRun notifies the observers implementing RunObserver of a run
+// starting or finishing
+func (e *Engine) notifyRun(plan *ExecutionPlan, finished bool) {
+	for _, observer := range e.observers {
+		runObserver, ok := observer.(RunObserver)
+		switch {
+		case !ok:
+		case finished:
+			runObserver.OnRunFinished(plan)
+		default:
+			runObserver.OnRunStarted(plan)
+		}
+	}
+}
+
 func (e *Engine) ExecuteGraph(appName string) (*ExecutionPlan, error) {
-	g, err := e.repository.LoadGraph(appName)
+	plan, g, err := e.startRun(appName)
+	if err != nil {
+		return nil, err
+	}
+	e.runPlan(plan, g)
+	return plan, nil
+}
+
+// StartGraph creates a run of the graph of appName like ExecuteGraph, but
+// executes it in the background. It returns as soon as the run is recorded
+// as running, so that callers can follow it by its ID, e.g. through the
+// node state changes recorded for the run. The returned channel receives
+// the finished plan.
+func (e *Engine) StartGraph(appName string) (uuid.UUID, <-chan *ExecutionPlan, error) {
+	plan, g, err := e.startRun(appName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load graph: %w", err)
+		return uuid.Nil, nil, err
 	}
 
-	sortedNodes, err := g.TopologicalSort()
+	done := make(chan *ExecutionPlan, 1)
+	go func() {
+		e.runPlan(plan, g)
+		done <- plan
+	}()
+	return plan.RunID, done, nil
+}
+
+// startRun loads and sorts the graph of appName and records a running run
+// of it
+func (e *Engine) startRun(appName string) (*ExecutionPlan, *graph.Graph, error) {
+	g, sortedNodes, err := e.loadSorted(appName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to sort graph topologically: %w", err)
+		return nil, nil, err
 	}
 
 	graphRun, err := e.repository.CreateGraphRun(appName, g.Version)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create graph run: %w", err)
+		return nil, nil, fmt.Errorf("failed to create graph run: %w", err)
+	}
+
+	plan := newPlan(graphRun.ID, appName, g, sortedNodes)
+	err = e.repository.UpdateGraphRun(graphRun.ID, string(StatusRunning), nil)
+	if err != nil {
+		log.Printf("Failed to update graph run status: %v", err)
+	}
+	if err := e.repository.SetRunStartedAt(graphRun.ID, plan.StartTime); err != nil {
+		log.Printf("Failed to update graph run start time: %v", err)
+	}
+	return plan, g, nil
+}
+
+// ExecuteRun executes a run claimed from the run queue, which is already
+// marked as running, with the app's current graph. Runs whose graph cannot
+// be loaded or sorted are marked as failed.
+func (e *Engine) ExecuteRun(run *storage.GraphRunModel) (*ExecutionPlan, error) {
+	appName := run.App.Name
+	g, sortedNodes, err := e.loadSorted(appName)
+	if err != nil {
+		if failErr := e.repository.FailGraphRun(run.ID, err.Error(), nil); failErr != nil {
+			log.Printf("Failed to update graph run status: %v", failErr)
+		}
+		return nil, err
+	}
+
+	plan := newPlan(run.ID, appName, g, sortedNodes)
+	if err := e.repository.SetRunStartedAt(run.ID, plan.StartTime); err != nil {
+		log.Printf("Failed to update graph run start time: %v", err)
+	}
+	e.runPlan(plan, g)
+	return plan, nil
+}
+
+// loadSorted loads the graph of appName and sorts its nodes topologically
+func (e *Engine) loadSorted(appName string) (*graph.Graph, []*graph.Node, error) {
+	g, err := e.repository.LoadGraph(appName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load graph: %w", err)
 	}
 
+	sortedNodes, err := g.TopologicalSort()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to sort graph topologically: %w", err)
+	}
+	return g, sortedNodes, nil
+}
+
+// newPlan creates the running plan of a run with every node pending
+func newPlan(runID uuid.UUID, appName string, g *graph.Graph, sortedNodes []*graph.Node) *ExecutionPlan {
 	plan := &ExecutionPlan{
-		RunID:      graphRun.ID,
+		RunID:      runID,
 		AppName:    appName,
 		Version:    g.Version,
 		Status:     StatusRunning,
@@ -112,23 +221,35 @@ func (e *Engine) ExecuteGraph(appName string) (*ExecutionPlan, error) {
 			Logs:   make([]string, 0),
 		}
 	}
+	return plan
+}
 
-	err = e.repository.UpdateGraphRun(graphRun.ID, string(StatusRunning), nil)
-	if err != nil {
-		log.Printf("Failed to update graph run status: %v", err)
-	}
-
+// runPlan executes the nodes of a started run in order and records the
+// outcome and the final plan on the run. Once the run is cancelled, the
+// node executing finishes and the remaining nodes are skipped.
+func (e *Engine) runPlan(plan *ExecutionPlan, g *graph.Graph) {
+	e.notifyRun(plan, false)
 	executionSuccess := true
-	for _, node := range sortedNodes {
+	cancelled := false
+	for _, node := range plan.Order {
 		execution := plan.Executions[node.ID]
 
+		if !cancelled {
+			cancelled = e.runCancelled(plan.RunID)
+		}
+		if cancelled {
+			execution.Status = StatusSkipped
+			execution.Logs = append(execution.Logs, "Skipped, the run was cancelled")
+			continue
+		}
+
 		if !e.shouldExecuteNode(node, plan, g) {
 			execution.Status = StatusSkipped
 			execution.Logs = append(execution.Logs, "Skipped due to failed dependencies")
 			continue
 		}
 
-		if err := e.executeNode(node, execution, g); err != nil {
+		if err := e.executeNode(plan, node, execution, g); err != nil {
 			execution.Status = StatusFailed
 			execution.Error = err.Error()
 			execution.Logs = append(execution.Logs, fmt.Sprintf("Execution failed: %v", err))
@@ -148,20 +269,68 @@ func (e *Engine) ExecuteGraph(appName string) (*ExecutionPlan, error) {
 	endTime := time.Now()
 	plan.EndTime = &endTime
 
-	if executionSuccess {
+	if !cancelled {
+		cancelled = e.runCancelled(plan.RunID)
+	}
+
+	var err error
+	switch {
+	case cancelled:
+		// CancelGraphRun recorded the outcome
+		plan.Status = StatusFailed
+	case executionSuccess:
 		plan.Status = StatusCompleted
-		err = e.repository.UpdateGraphRun(graphRun.ID, string(StatusCompleted), nil)
-	} else {
+		err = e.repository.UpdateGraphRun(plan.RunID, string(StatusCompleted), nil)
+	default:
 		plan.Status = StatusFailed
-		errorMsg := "Some nodes failed to execute"
-		err = e.repository.UpdateGraphRun(graphRun.ID, string(StatusFailed), &errorMsg)
+		var failedNodeIDs []string
+		for _, node := range plan.Order {
+			if plan.Executions[node.ID].Status == StatusFailed {
+				failedNodeIDs = append(failedNodeIDs, node.ID)
+			}
+		}
+		err = e.repository.FailGraphRun(plan.RunID, "Some nodes failed to execute", failedNodeIDs)
 	}
 
 	if err != nil {
 		log.Printf("Failed to update final graph run status: %v", err)
 	}
 
-	return plan, nil
+	if planJSON, err := json.Marshal(plan); err != nil {
+		log.Printf("Failed to serialize execution plan: %v", err)
+	} else if err := e.repository.SetGraphRunExecutionPlan(plan.RunID, string(planJSON)); err != nil {
+		log.Printf("Failed to store execution plan: %v", err)
+	}
+	e.notifyRun(plan, true)
+}
+
+// runCancelled reports whether the run was cancelled, which only stores
+// implementing storage.RunCanceller allow
+func (e *Engine) runCancelled(runID uuid.UUID) bool {
+	canceller, ok := e.repository.(storage.RunCanceller)
+	if !ok {
+		return false
+	}
+	status, err := canceller.GetGraphRunStatus(runID)
+	if err != nil {
+		log.Printf("Failed to check if run %s was cancelled: %v", runID, err)
+		return false
+	}
+	return status == string(StatusFailed)
+}
+
+// LoadExecutionPlan decodes the execution plan stored on a graph run. It
+// returns nil without error for runs that have no plan recorded.
+func LoadExecutionPlan(run *storage.GraphRunModel) (*ExecutionPlan, error) {
+	if run.ExecutionPlan == "" {
+		return nil, nil
+	}
+
+	var plan ExecutionPlan
+	if err := json.Unmarshal([]byte(run.ExecutionPlan), &plan); err != nil {
+		return nil, fmt.Errorf("failed to decode execution plan of run %s: %w", run.ID, err)
+	}
+	return &plan, nil
 }
 
 func (e *Engine) shouldExecuteNode(node *graph.Node, plan *ExecutionPlan, g *graph.Graph) bool {
@@ -181,15 +350,12 @@ func (e *Engine) shouldExecuteNode(node *graph.Node, plan *ExecutionPlan, g *gra
 	return true
 }
 
-func (e *Engine) executeNode(node *graph.Node, execution *NodeExecution, g *graph.Graph) error {
+func (e *Engine) executeNode(plan *ExecutionPlan, node *graph.Node, execution *NodeExecution, g *graph.Graph) error {
 	startTime := time.Now()
 	execution.StartTime = &startTime
 	execution.Status = StatusRunning
 
-	// Notify observers of state change to running
-	oldState := node.State
-	node.State = graph.NodeStateRunning
-	e.notifyStateChange(node, oldState, graph.NodeStateRunning)
+	e.setNodeState(plan, node, graph.NodeStateRunning)
 
 	execution.Logs = append(execution.Logs, fmt.Sprintf("Starting execution of %s (%s)", node.Name, node.Type))
 
@@ -212,12 +378,24 @@ func (e *Engine) executeNode(node *graph.Node, execution *NodeExecution, g *grap
 	if err != nil {
 		newState = graph.NodeStateFailed
 	}
-	node.State = newState
-	e.notifyStateChange(node, graph.NodeStateRunning, newState)
+	e.setNodeState(plan, node, newState)
 
 	return err
 }
 
+// setNodeState transitions a node, notifies observers and records the
+// transition in the node's state history for the current run
+func (e *Engine) setNodeState(plan *ExecutionPlan, node *graph.Node, newState graph.NodeState) {
+	oldState := node.State
+	node.MarkState(newState)
+	e.notifyStateChange(node, oldState, newState)
+
+	runID := plan.RunID
+	if err := e.repository.RecordNodeStateChange(plan.AppName, node.ID, oldState, newState, &runID); err != nil {
+		log.Printf("Failed to record state change of node %s: %v", node.ID, err)
+	}
+}
+
 func (e *Engine) executeWorkflow(node *graph.Node, execution *NodeExecution, g *graph.Graph) error {
 	execution.Logs = append(execution.Logs, "Executing workflow...")
 
@@ -225,24 +403,22 @@ func (e *Engine) executeWorkflow(node *graph.Node, execution *NodeExecution, g *
 		return fmt.Errorf("workflow execution failed: %w", err)
 	}
 
-	for _, edge := range g.Edges {
-		if edge.FromNodeID == node.ID {
-			targetNode, exists := g.GetNode(edge.ToNodeID)
-			if !exists {
-				continue
-			}
+	for _, edge := range g.OutgoingEdges(node.ID) {
+		targetNode, exists := g.GetNode(edge.ToNodeID)
+		if !exists {
+			continue
+		}
 
-			switch edge.Type {
-			case graph.EdgeTypeProvisions:
-				execution.Logs = append(execution.Logs, fmt.Sprintf("Provisioning resource: %s", targetNode.Name))
-				if err := e.runner.ProvisionResource(node, targetNode); err != nil {
-					return fmt.Errorf("resource provisioning failed: %w", err)
-				}
-			case graph.EdgeTypeCreates:
-				execution.Logs = append(execution.Logs, fmt.Sprintf("Creating resource: %s", targetNode.Name))
-				if err := e.runner.CreateResource(node, targetNode); err != nil {
-					return fmt.Errorf("resource creation failed: %w", err)
-				}
+		switch edge.Type {
+		case graph.EdgeTypeProvisions:
+			execution.Logs = append(execution.Logs, fmt.Sprintf("Provisioning resource: %s", targetNode.Name))
+			if err := e.runner.ProvisionResource(node, targetNode); err != nil {
+				return fmt.Errorf("resource provisioning failed: %w", err)
+			}
+		case graph.EdgeTypeCreates:
+			execution.Logs = append(execution.Logs, fmt.Sprintf("Creating resource: %s", targetNode.Name))
+			if err := e.runner.CreateResource(node, targetNode); err != nil {
+				return fmt.Errorf("resource creation failed: %w", err)
 			}
 		}
 	}
@@ -264,8 +440,8 @@ func (e *Engine) executeStep(node *graph.Node, execution *NodeExecution, g *grap
 	}
 
 	// Process configures edges (step → resource)
-	for _, edge := range g.Edges {
-		if edge.Type == graph.EdgeTypeConfigures && edge.FromNodeID == node.ID {
+	for _, edge := range g.OutgoingEdges(node.ID) {
+		if edge.Type == graph.EdgeTypeConfigures {
 			targetNode, exists := g.GetNode(edge.ToNodeID)
 			if exists {
 				execution.Logs = append(execution.Logs, fmt.Sprintf("Configuring resource: %s", targetNode.Name))
@@ -287,8 +463,8 @@ func (e *Engine) executeResource(node *graph.Node, execution *NodeExecution, g *
 	execution.Logs = append(execution.Logs, "Validating resource state...")
 
 	provisioners := make([]*graph.Node, 0)
-	for _, edge := range g.Edges {
-		if edge.ToNodeID == node.ID && (edge.Type == graph.EdgeTypeProvisions || edge.Type == graph.EdgeTypeCreates) {
+	for _, edge := range g.IncomingEdges(node.ID) {
+		if edge.Type == graph.EdgeTypeProvisions || edge.Type == graph.EdgeTypeCreates {
 			if provisionerNode, exists := g.GetNode(edge.FromNodeID); exists {
 				provisioners = append(provisioners, provisionerNode)
 			}
@@ -1,7 +1,10 @@
 package execution
 
 import (
+	"context"
+	"io"
 	"testing"
+	"time"
 
 	"github.com/philipsahli/innominatus-graph/pkg/storage"
 
@@ -38,6 +41,141 @@ func (m *MockRepository) SaveGraph(appName string, g *graph.Graph) error {
 	return args.Error(0)
 }
 
+func (m *MockRepository) DeleteGraph(appName string) error {
+	args := m.Called(appName)
+	return args.Error(0)
+}
+
+func (m *MockRepository) DeleteApp(appName string, opts storage.DeleteOptions) error {
+	args := m.Called(appName, opts)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ListApps(filter storage.AppFilter, limit, offset int) ([]storage.AppSummary, error) {
+	args := m.Called(filter, limit, offset)
+	return args.Get(0).([]storage.AppSummary), args.Error(1)
+}
+
+func (m *MockRepository) FailGraphRun(runID uuid.UUID, errorMessage string, failedNodeIDs []string) error {
+	args := m.Called(runID, errorMessage, failedNodeIDs)
+	return args.Error(0)
+}
+
+func (m *MockRepository) SetRunStartedAt(runID uuid.UUID, startedAt time.Time) error {
+	args := m.Called(runID, startedAt)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetRunNodeExecutions(runID uuid.UUID) ([]storage.NodeExecutionRecord, error) {
+	args := m.Called(runID)
+	return args.Get(0).([]storage.NodeExecutionRecord), args.Error(1)
+}
+
+func (m *MockRepository) GetRecentRunsWithNodes(appName string, limit int) ([]storage.RunWithNodes, error) {
+	args := m.Called(appName, limit)
+	return args.Get(0).([]storage.RunWithNodes), args.Error(1)
+}
+
+func (m *MockRepository) GetGraphRun(runID uuid.UUID) (*storage.GraphRunModel, error) {
+	args := m.Called(runID)
+	return args.Get(0).(*storage.GraphRunModel), args.Error(1)
+}
+
+func (m *MockRepository) SetGraphRunExecutionPlan(runID uuid.UUID, planJSON string) error {
+	args := m.Called(runID, planJSON)
+	return args.Error(0)
+}
+
+func (m *MockRepository) PruneGraphRuns(appName string, olderThan time.Duration, keepLast int) (int64, error) {
+	args := m.Called(appName, olderThan, keepLast)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepository) ForTenant(ctx context.Context) storage.RepositoryInterface {
+	args := m.Called(ctx)
+	return args.Get(0).(storage.RepositoryInterface)
+}
+
+func (m *MockRepository) CreateTenant(name string) (*storage.TenantModel, error) {
+	args := m.Called(name)
+	return args.Get(0).(*storage.TenantModel), args.Error(1)
+}
+
+func (m *MockRepository) ListTenants() ([]storage.TenantModel, error) {
+	args := m.Called()
+	return args.Get(0).([]storage.TenantModel), args.Error(1)
+}
+
+func (m *MockRepository) ListGraphRuns(appName string, filter storage.RunFilter) ([]storage.GraphRunModel, int64, error) {
+	args := m.Called(appName, filter)
+	return args.Get(0).([]storage.GraphRunModel), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockRepository) GetAuditLog(filter storage.AuditFilter) ([]storage.AuditLogModel, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]storage.AuditLogModel), args.Error(1)
+}
+
+func (m *MockRepository) LoadSubgraph(appName string, nodeIDs []string, withClosure bool) (*graph.Graph, error) {
+	args := m.Called(appName, nodeIDs, withClosure)
+	return args.Get(0).(*graph.Graph), args.Error(1)
+}
+
+func (m *MockRepository) LoadGraphSummary(appName string) (*storage.GraphSummary, error) {
+	args := m.Called(appName)
+	return args.Get(0).(*storage.GraphSummary), args.Error(1)
+}
+
+func (m *MockRepository) RestoreApp(appName string) error {
+	args := m.Called(appName)
+	return args.Error(0)
+}
+
+func (m *MockRepository) RestoreNode(appName, nodeID string) error {
+	args := m.Called(appName, nodeID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) PurgeDeleted(olderThan time.Duration) (int64, error) {
+	args := m.Called(olderThan)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepository) DumpApp(appName string, w io.Writer) error {
+	args := m.Called(appName, w)
+	return args.Error(0)
+}
+
+func (m *MockRepository) RestoreAppSnapshot(r io.Reader) (string, error) {
+	args := m.Called(r)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockRepository) GetAppMetadata(appName string) (*graph.AppMetadata, error) {
+	args := m.Called(appName)
+	return args.Get(0).(*graph.AppMetadata), args.Error(1)
+}
+
+func (m *MockRepository) SetAppMetadata(appName string, metadata graph.AppMetadata) error {
+	args := m.Called(appName, metadata)
+	return args.Error(0)
+}
+
+func (m *MockRepository) SetAppAnnotation(appName, key, value string) error {
+	args := m.Called(appName, key, value)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetNodesByState(appName string, state graph.NodeState) ([]*graph.Node, error) {
+	args := m.Called(appName, state)
+	return args.Get(0).([]*graph.Node), args.Error(1)
+}
+
+func (m *MockRepository) GetNodesByType(appName string, nodeType graph.NodeType) ([]*graph.Node, error) {
+	args := m.Called(appName, nodeType)
+	return args.Get(0).([]*graph.Node), args.Error(1)
+}
+
 func (m *MockRepository) GetGraphRuns(appName string) ([]storage.GraphRunModel, error) {
 	args := m.Called(appName)
 	return args.Get(0).([]storage.GraphRunModel), args.Error(1)
@@ -48,6 +186,21 @@ func (m *MockRepository) UpdateNodeState(appName string, nodeID string, state gr
 	return args.Error(0)
 }
 
+func (m *MockRepository) UpdateNodeStates(appName string, states map[string]graph.NodeState) (map[string]error, error) {
+	args := m.Called(appName, states)
+	return args.Get(0).(map[string]error), args.Error(1)
+}
+
+func (m *MockRepository) RecordNodeStateChange(appName, nodeID string, oldState, newState graph.NodeState, runID *uuid.UUID) error {
+	args := m.Called(appName, nodeID, oldState, newState, runID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetNodeStateHistory(appName, nodeID string) ([]storage.NodeStateChangeModel, error) {
+	args := m.Called(appName, nodeID)
+	return args.Get(0).([]storage.NodeStateChangeModel), args.Error(1)
+}
+
 // Mock WorkflowRunner
 type MockWorkflowRunnerTest struct {
 	mock.Mock
@@ -107,7 +260,10 @@ func TestEngine_ExecuteGraph_Success(t *testing.T) {
 	runModel := &storage.GraphRunModel{ID: uuid.New()}
 	mockRepo.On("CreateGraphRun", "test-app", 1).Return(runModel, nil)
 	mockRepo.On("UpdateGraphRun", runModel.ID, "running", (*string)(nil)).Return(nil)
+	mockRepo.On("SetRunStartedAt", runModel.ID, mock.AnythingOfType("time.Time")).Return(nil)
 	mockRepo.On("UpdateGraphRun", runModel.ID, "completed", (*string)(nil)).Return(nil)
+	mockRepo.On("RecordNodeStateChange", "test-app", mock.Anything, mock.Anything, mock.Anything, &runModel.ID).Return(nil)
+	mockRepo.On("SetGraphRunExecutionPlan", runModel.ID, mock.AnythingOfType("string")).Return(nil)
 
 	// Expect workflow executions
 	mockRunner.On("RunWorkflow", mock.AnythingOfType("*graph.Node")).Return(nil)
@@ -130,6 +286,19 @@ func TestEngine_ExecuteGraph_Success(t *testing.T) {
 	workflow1Exec := plan.Executions["workflow1"]
 	assert.Equal(t, StatusCompleted, workflow1Exec.Status)
 
+	// The final plan is stored on the run and can be decoded again
+	var storedPlan string
+	for _, call := range mockRepo.Calls {
+		if call.Method == "SetGraphRunExecutionPlan" {
+			storedPlan = call.Arguments.String(1)
+		}
+	}
+	decoded, err := LoadExecutionPlan(&storage.GraphRunModel{ExecutionPlan: storedPlan})
+	require.NoError(t, err)
+	assert.Equal(t, StatusCompleted, decoded.Status)
+	assert.Equal(t, StatusCompleted, decoded.Executions["workflow1"].Status)
+	assert.NotEmpty(t, decoded.Executions["workflow1"].Logs)
+
 	mockRepo.AssertExpectations(t)
 	mockRunner.AssertExpectations(t)
 }
@@ -144,7 +313,10 @@ func TestEngine_ExecuteGraph_WorkflowFailure(t *testing.T) {
 	runModel := &storage.GraphRunModel{ID: uuid.New()}
 	mockRepo.On("CreateGraphRun", "test-app", 1).Return(runModel, nil)
 	mockRepo.On("UpdateGraphRun", runModel.ID, "running", (*string)(nil)).Return(nil)
-	mockRepo.On("UpdateGraphRun", runModel.ID, "failed", mock.AnythingOfType("*string")).Return(nil)
+	mockRepo.On("SetRunStartedAt", runModel.ID, mock.AnythingOfType("time.Time")).Return(nil)
+	mockRepo.On("FailGraphRun", runModel.ID, "Some nodes failed to execute", []string{"workflow1"}).Return(nil)
+	mockRepo.On("RecordNodeStateChange", "test-app", mock.Anything, mock.Anything, mock.Anything, &runModel.ID).Return(nil)
+	mockRepo.On("SetGraphRunExecutionPlan", runModel.ID, mock.AnythingOfType("string")).Return(nil)
 
 	// Make workflow1 fail
 	mockRunner.On("RunWorkflow", mock.MatchedBy(func(node *graph.Node) bool {
@@ -172,6 +344,51 @@ func TestEngine_ExecuteGraph_WorkflowFailure(t *testing.T) {
 	mockRunner.AssertExpectations(t)
 }
 
+func TestEngine_StartGraph(t *testing.T) {
+	mockRepo := &MockRepository{}
+	mockRunner := &MockWorkflowRunnerTest{}
+
+	g := createTestGraphForExecution()
+	mockRepo.On("LoadGraph", "test-app").Return(g, nil)
+
+	runModel := &storage.GraphRunModel{ID: uuid.New()}
+	mockRepo.On("CreateGraphRun", "test-app", 1).Return(runModel, nil)
+	mockRepo.On("UpdateGraphRun", runModel.ID, "running", (*string)(nil)).Return(nil)
+	mockRepo.On("SetRunStartedAt", runModel.ID, mock.AnythingOfType("time.Time")).Return(nil)
+	mockRepo.On("UpdateGraphRun", runModel.ID, "completed", (*string)(nil)).Return(nil)
+	mockRepo.On("RecordNodeStateChange", "test-app", mock.Anything, mock.Anything, mock.Anything, &runModel.ID).Return(nil)
+	mockRepo.On("SetGraphRunExecutionPlan", runModel.ID, mock.AnythingOfType("string")).Return(nil)
+
+	// Workflows block until released, so the run is still going when
+	// StartGraph returns
+	release := make(chan struct{})
+	mockRunner.On("RunWorkflow", mock.AnythingOfType("*graph.Node")).Run(func(mock.Arguments) { <-release }).Return(nil)
+	mockRunner.On("ProvisionResource", mock.AnythingOfType("*graph.Node"), mock.AnythingOfType("*graph.Node")).Return(nil)
+
+	engine := NewEngine(mockRepo, mockRunner)
+
+	runID, done, err := engine.StartGraph("test-app")
+	require.NoError(t, err)
+	assert.Equal(t, runModel.ID, runID)
+	close(release)
+
+	select {
+	case plan := <-done:
+		assert.Equal(t, runID, plan.RunID)
+		assert.Equal(t, StatusCompleted, plan.Status)
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not finish")
+	}
+	mockRepo.AssertExpectations(t)
+
+	// Graphs that cannot be loaded fail before a run is created
+	failingRepo := &MockRepository{}
+	failingRepo.On("LoadGraph", "missing").Return((*graph.Graph)(nil), assert.AnError)
+	_, done, err = NewEngine(failingRepo, mockRunner).StartGraph("missing")
+	assert.ErrorContains(t, err, "failed to load graph")
+	assert.Nil(t, done)
+}
+
 func TestEngine_shouldExecuteNode(t *testing.T) {
 	g := createTestGraphForExecution()
 	engine := NewEngine(nil, nil)
@@ -0,0 +1,158 @@
+package execution
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// EstimatedDurationProperty is the node property Annotate writes the expected
+// duration to, in milliseconds
+const EstimatedDurationProperty = "estimated_duration_ms"
+
+// DurationEstimator derives expected node and run durations from the
+// execution plans recorded on past graph runs
+type DurationEstimator struct {
+	repository storage.RunStore
+	maxRuns    int
+}
+
+// DurationEstimate holds median durations observed over historical runs
+type DurationEstimate struct {
+	AppName       string                   `json:"app_name"`
+	Samples       int                      `json:"samples"`
+	RunDuration   time.Duration            `json:"run_duration"`
+	NodeDurations map[string]time.Duration `json:"node_durations"`
+}
+
+// NewDurationEstimator creates an estimator that looks at the most recent
+// maxRuns finished runs (all runs if maxRuns <= 0)
+func NewDurationEstimator(repository storage.RunStore, maxRuns int) *DurationEstimator {
+	return &DurationEstimator{
+		repository: repository,
+		maxRuns:    maxRuns,
+	}
+}
+
+// Estimate computes median durations for the app's nodes and runs. Only
+// completed node executions and finished runs are taken into account.
+func (d *DurationEstimator) Estimate(appName string) (*DurationEstimate, error) {
+	runs, err := d.repository.GetGraphRuns(appName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load graph runs: %w", err)
+	}
+
+	runSamples := make([]time.Duration, 0)
+	nodeSamples := make(map[string][]time.Duration)
+
+	for _, run := range runs {
+		if d.maxRuns > 0 && len(runSamples) >= d.maxRuns {
+			break
+		}
+		if run.CompletedAt == nil {
+			continue
+		}
+		runSamples = append(runSamples, run.CompletedAt.Sub(run.StartedAt))
+
+		plan, err := LoadExecutionPlan(&run)
+		if err != nil {
+			return nil, err
+		}
+		if plan == nil {
+			continue
+		}
+		for nodeID, execution := range plan.Executions {
+			if execution.Status != StatusCompleted || execution.StartTime == nil || execution.EndTime == nil {
+				continue
+			}
+			nodeSamples[nodeID] = append(nodeSamples[nodeID], execution.EndTime.Sub(*execution.StartTime))
+		}
+	}
+
+	estimate := &DurationEstimate{
+		AppName:       appName,
+		Samples:       len(runSamples),
+		RunDuration:   median(runSamples),
+		NodeDurations: make(map[string]time.Duration, len(nodeSamples)),
+	}
+	for nodeID, samples := range nodeSamples {
+		estimate.NodeDurations[nodeID] = median(samples)
+	}
+
+	return estimate, nil
+}
+
+// Annotate writes the expected duration of every node with history into its
+// properties under EstimatedDurationProperty
+func (est *DurationEstimate) Annotate(g *graph.Graph) {
+	for nodeID, duration := range est.NodeDurations {
+		node, exists := g.GetNode(nodeID)
+		if !exists {
+			continue
+		}
+		if node.Properties == nil {
+			node.Properties = make(map[string]interface{})
+		}
+		node.Properties[EstimatedDurationProperty] = duration.Milliseconds()
+	}
+}
+
+// ETA returns the expected wall-clock time for executing g, computed as the
+// longest chain of estimated node durations in topological order. Nodes
+// without history contribute zero.
+func (est *DurationEstimate) ETA(g *graph.Graph) (time.Duration, error) {
+	sorted, err := g.TopologicalSort()
+	if err != nil {
+		return 0, err
+	}
+
+	finish := make(map[string]time.Duration, len(sorted))
+	var eta time.Duration
+	for _, node := range sorted {
+		var start time.Duration
+		for _, dep := range predecessors(g, node.ID) {
+			if finish[dep] > start {
+				start = finish[dep]
+			}
+		}
+		finish[node.ID] = start + est.NodeDurations[node.ID]
+		if finish[node.ID] > eta {
+			eta = finish[node.ID]
+		}
+	}
+
+	return eta, nil
+}
+
+// predecessors returns the IDs of nodes that must finish before nodeID runs
+func predecessors(g *graph.Graph, nodeID string) []string {
+	ids := make([]string, 0)
+	for _, edge := range g.OutgoingEdges(nodeID) {
+		if edge.Type == graph.EdgeTypeDependsOn {
+			ids = append(ids, edge.ToNodeID)
+		}
+	}
+	for _, edge := range g.IncomingEdges(nodeID) {
+		if edge.Type != graph.EdgeTypeDependsOn {
+			ids = append(ids, edge.FromNodeID)
+		}
+	}
+	return ids
+}
+
+func median(samples []time.Duration) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
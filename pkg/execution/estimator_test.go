@@ -0,0 +1,82 @@
+package execution
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runWithPlan(t *testing.T, start time.Time, total time.Duration, nodes map[string]time.Duration) storage.GraphRunModel {
+	plan := ExecutionPlan{Executions: make(map[string]*NodeExecution)}
+	for nodeID, d := range nodes {
+		s := start
+		e := start.Add(d)
+		plan.Executions[nodeID] = &NodeExecution{NodeID: nodeID, Status: StatusCompleted, StartTime: &s, EndTime: &e}
+	}
+	data, err := json.Marshal(plan)
+	require.NoError(t, err)
+
+	completed := start.Add(total)
+	return storage.GraphRunModel{StartedAt: start, CompletedAt: &completed, ExecutionPlan: string(data)}
+}
+
+func TestDurationEstimator_Estimate(t *testing.T) {
+	now := time.Now()
+	runs := []storage.GraphRunModel{
+		runWithPlan(t, now, 10*time.Second, map[string]time.Duration{"workflow1": 4 * time.Second, "spec1": time.Second}),
+		runWithPlan(t, now, 20*time.Second, map[string]time.Duration{"workflow1": 6 * time.Second, "spec1": time.Second}),
+		runWithPlan(t, now, 30*time.Second, map[string]time.Duration{"workflow1": 20 * time.Second}),
+		{StartedAt: now, Status: "running"},
+	}
+
+	mockRepo := &MockRepository{}
+	mockRepo.On("GetGraphRuns", "test-app").Return(runs, nil)
+
+	estimate, err := NewDurationEstimator(mockRepo, 0).Estimate("test-app")
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, estimate.Samples)
+	assert.Equal(t, 20*time.Second, estimate.RunDuration)
+	assert.Equal(t, 6*time.Second, estimate.NodeDurations["workflow1"])
+	assert.Equal(t, time.Second, estimate.NodeDurations["spec1"])
+}
+
+func TestDurationEstimator_MaxRuns(t *testing.T) {
+	now := time.Now()
+	runs := []storage.GraphRunModel{
+		runWithPlan(t, now, 10*time.Second, map[string]time.Duration{"workflow1": 2 * time.Second}),
+		runWithPlan(t, now, 90*time.Second, map[string]time.Duration{"workflow1": 80 * time.Second}),
+	}
+
+	mockRepo := &MockRepository{}
+	mockRepo.On("GetGraphRuns", "test-app").Return(runs, nil)
+
+	estimate, err := NewDurationEstimator(mockRepo, 1).Estimate("test-app")
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, estimate.Samples)
+	assert.Equal(t, 2*time.Second, estimate.NodeDurations["workflow1"])
+}
+
+func TestDurationEstimate_AnnotateAndETA(t *testing.T) {
+	g := createTestGraphForExecution()
+	estimate := &DurationEstimate{
+		NodeDurations: map[string]time.Duration{
+			"spec1":     time.Second,
+			"workflow1": 5 * time.Second,
+			"resource1": 2 * time.Second,
+		},
+	}
+
+	estimate.Annotate(g)
+	assert.Equal(t, int64(5000), g.Nodes["workflow1"].Properties[EstimatedDurationProperty])
+
+	eta, err := estimate.ETA(g)
+	require.NoError(t, err)
+	assert.Equal(t, 8*time.Second, eta)
+}
@@ -0,0 +1,335 @@
+package execution
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/tracing"
+
+	"github.com/google/uuid"
+)
+
+// DefaultTraceServiceName is the service.name of exported traces
+const DefaultTraceServiceName = "innominatus-graph"
+
+// OTLP span kinds and status codes
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusUnset      = 0
+	otlpStatusOK         = 1
+	otlpStatusError      = 2
+)
+
+// TraceExporter pushes finished runs to an OpenTelemetry collector over
+// OTLP/HTTP with JSON encoding, so that runs show up in Jaeger or Tempo next
+// to service traces. Each run becomes a trace with a root span for the run
+// and a child span per node.
+type TraceExporter struct {
+	// Endpoint is the collector's traces URL, e.g.
+	// http://localhost:4318/v1/traces; "/v1/traces" is appended to URLs
+	// without a path
+	Endpoint string
+	// Headers are added to each request, e.g. for authentication
+	Headers map[string]string
+	// ServiceName defaults to DefaultTraceServiceName
+	ServiceName string
+	// Client defaults to http.DefaultClient; NewTraceExporter sets one with
+	// a 10 second timeout
+	Client *http.Client
+}
+
+// NewTraceExporter creates an exporter pushing to the given collector URL
+func NewTraceExporter(endpoint string) *TraceExporter {
+	return &TraceExporter{
+		Endpoint: endpoint,
+		Client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// ExportPlan sends a finished run to the collector
+func (t *TraceExporter) ExportPlan(ctx context.Context, plan *ExecutionPlan) error {
+	body, err := TraceRequest(plan, t.ServiceName)
+	if err != nil {
+		return err
+	}
+	return t.send(ctx, body, "trace of run "+plan.RunID.String())
+}
+
+// ExportSpans sends spans recorded by a tracing.Tracer, e.g. of API
+// requests and database queries, to the collector
+func (t *TraceExporter) ExportSpans(ctx context.Context, spans []tracing.Span) error {
+	otlpSpans := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		otlpSpans = append(otlpSpans, spanToOTLP(span))
+	}
+	body, err := json.Marshal(newTraceRequest(t.ServiceName, "github.com/philipsahli/innominatus-graph/pkg/tracing", otlpSpans))
+	if err != nil {
+		return err
+	}
+	return t.send(ctx, body, fmt.Sprintf("%d spans", len(spans)))
+}
+
+// send posts an OTLP JSON body; what names the content in errors
+func (t *TraceExporter) send(ctx context.Context, body []byte, what string) error {
+	endpoint, err := url.Parse(t.Endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid collector endpoint: %w", err)
+	}
+	if endpoint.Path == "" || endpoint.Path == "/" {
+		endpoint.Path = "/v1/traces"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create trace request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.Headers {
+		req.Header.Set(key, value)
+	}
+
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send %s: %w", what, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("collector rejected %s: %s: %s", what, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// RunSpanContext returns the context of a run's root span in the trace sent
+// by ExportPlan, e.g. for linking the request that started the run
+func RunSpanContext(runID uuid.UUID) tracing.SpanContext {
+	sc := tracing.SpanContext{TraceID: runID}
+	id, _ := hex.DecodeString(traceSpanID(runID.String(), ""))
+	copy(sc.SpanID[:], id)
+	return sc
+}
+
+type otlpTraceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Events            []otlpEvent     `json:"events,omitempty"`
+	Links             []otlpLink      `json:"links,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpLink struct {
+	TraceID string `json:"traceId"`
+	SpanID  string `json:"spanId"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string `json:"timeUnixNano"`
+	Name         string `json:"name"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+func stringAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+func intAttribute(key string, value int64) otlpAttribute {
+	s := strconv.FormatInt(value, 10)
+	return otlpAttribute{Key: key, Value: otlpValue{IntValue: &s}}
+}
+
+// TraceRequest encodes a finished run as an OTLP JSON trace request. The
+// trace ID is the run ID and span IDs are derived from run and node IDs, so
+// sending a run twice does not create a second trace. Nodes that never
+// started, e.g. skipped ones, are zero-length spans at the start of the run.
+func TraceRequest(plan *ExecutionPlan, serviceName string) ([]byte, error) {
+	if plan.EndTime == nil {
+		return nil, fmt.Errorf("run %s has not finished", plan.RunID)
+	}
+	traceID := hex.EncodeToString(plan.RunID[:])
+	rootID := traceSpanID(plan.RunID.String(), "")
+	runAttributes := []otlpAttribute{
+		stringAttribute("innominatus.app", plan.AppName),
+		intAttribute("innominatus.version", int64(plan.Version)),
+		stringAttribute("innominatus.run_id", plan.RunID.String()),
+	}
+
+	root := otlpSpan{
+		TraceID:           traceID,
+		SpanID:            rootID,
+		Name:              "run " + plan.AppName,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: unixNano(plan.StartTime),
+		EndTimeUnixNano:   unixNano(*plan.EndTime),
+		Attributes:        append(runAttributes, stringAttribute("innominatus.status", string(plan.Status))),
+		Status:            traceStatus(plan.Status, ""),
+	}
+	spans := []otlpSpan{root}
+
+	for _, node := range plan.Order {
+		execution, exists := plan.Executions[node.ID]
+		if !exists {
+			continue
+		}
+		start, end := plan.StartTime, plan.StartTime
+		if execution.StartTime != nil {
+			start = *execution.StartTime
+			end = start
+		}
+		if execution.EndTime != nil && !execution.EndTime.Before(start) {
+			end = *execution.EndTime
+		}
+
+		name := node.Name
+		if name == "" {
+			name = node.ID
+		}
+		span := otlpSpan{
+			TraceID:           traceID,
+			SpanID:            traceSpanID(plan.RunID.String(), node.ID),
+			ParentSpanID:      rootID,
+			Name:              name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: unixNano(start),
+			EndTimeUnixNano:   unixNano(end),
+			Attributes: []otlpAttribute{
+				stringAttribute("innominatus.app", plan.AppName),
+				stringAttribute("innominatus.run_id", plan.RunID.String()),
+				stringAttribute("innominatus.node.id", node.ID),
+				stringAttribute("innominatus.node.type", string(node.Type)),
+				stringAttribute("innominatus.status", string(execution.Status)),
+			},
+			Status: traceStatus(execution.Status, execution.Error),
+		}
+		for _, line := range execution.Logs {
+			span.Events = append(span.Events, otlpEvent{TimeUnixNano: unixNano(end), Name: line})
+		}
+		spans = append(spans, span)
+	}
+
+	return json.Marshal(newTraceRequest(serviceName, "github.com/philipsahli/innominatus-graph/pkg/execution", spans))
+}
+
+// newTraceRequest wraps spans of one instrumentation scope in a request
+func newTraceRequest(serviceName, scope string, spans []otlpSpan) otlpTraceRequest {
+	if serviceName == "" {
+		serviceName = DefaultTraceServiceName
+	}
+	return otlpTraceRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			stringAttribute("service.name", serviceName),
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: scope},
+			Spans: spans,
+		}},
+	}}}
+}
+
+// spanToOTLP converts a span of the tracing package
+func spanToOTLP(span tracing.Span) otlpSpan {
+	converted := otlpSpan{
+		TraceID:           span.TraceIDString(),
+		SpanID:            span.SpanIDString(),
+		Name:              span.Name,
+		Kind:              int(span.Kind),
+		StartTimeUnixNano: unixNano(span.Start),
+		EndTimeUnixNano:   unixNano(span.End),
+		Status:            otlpStatus{Code: otlpStatusUnset},
+	}
+	if span.Parent != [8]byte{} {
+		converted.ParentSpanID = hex.EncodeToString(span.Parent[:])
+	}
+	for _, attribute := range span.Attributes {
+		switch value := attribute.Value.(type) {
+		case int64:
+			converted.Attributes = append(converted.Attributes, intAttribute(attribute.Key, value))
+		default:
+			converted.Attributes = append(converted.Attributes, stringAttribute(attribute.Key, fmt.Sprint(value)))
+		}
+	}
+	for _, link := range span.Links {
+		converted.Links = append(converted.Links, otlpLink{TraceID: link.TraceIDString(), SpanID: link.SpanIDString()})
+	}
+	if span.Error != "" {
+		converted.Status = otlpStatus{Code: otlpStatusError, Message: span.Error}
+	}
+	return converted
+}
+
+// traceSpanID derives a stable 8 byte span ID from a run and node ID; the
+// empty node ID identifies the run's root span
+func traceSpanID(runID, nodeID string) string {
+	sum := sha256.Sum256([]byte(runID + "/" + nodeID))
+	return hex.EncodeToString(sum[:8])
+}
+
+func traceStatus(status ExecutionStatus, message string) otlpStatus {
+	switch status {
+	case StatusCompleted:
+		return otlpStatus{Code: otlpStatusOK}
+	case StatusFailed:
+		return otlpStatus{Code: otlpStatusError, Message: message}
+	default:
+		return otlpStatus{Code: otlpStatusUnset}
+	}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
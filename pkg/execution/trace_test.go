@@ -0,0 +1,183 @@
+package execution
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/tracing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func finishedPlan() *ExecutionPlan {
+	start := time.Unix(1700000000, 0)
+	specEnd := start.Add(time.Second)
+	workflowStart := specEnd
+	workflowEnd := workflowStart.Add(4 * time.Second)
+	end := workflowEnd.Add(time.Second)
+
+	return &ExecutionPlan{
+		RunID:     uuid.MustParse("0f8fad5b-d9cb-469f-a165-70867728950e"),
+		AppName:   "test-app",
+		Version:   2,
+		Status:    StatusFailed,
+		StartTime: start,
+		EndTime:   &end,
+		Order: []*graph.Node{
+			{ID: "spec1", Type: graph.NodeTypeSpec, Name: "Database Spec"},
+			{ID: "workflow1", Type: graph.NodeTypeWorkflow, Name: "Deploy Database"},
+			{ID: "resource1", Type: graph.NodeTypeResource, Name: "Database"},
+		},
+		Executions: map[string]*NodeExecution{
+			"spec1":     {NodeID: "spec1", Status: StatusCompleted, StartTime: &start, EndTime: &specEnd},
+			"workflow1": {NodeID: "workflow1", Status: StatusFailed, StartTime: &workflowStart, EndTime: &workflowEnd, Error: "boom", Logs: []string{"Execution failed: boom"}},
+			"resource1": {NodeID: "resource1", Status: StatusSkipped, Logs: []string{"Skipped due to failed dependencies"}},
+		},
+	}
+}
+
+func TestTraceRequest(t *testing.T) {
+	data, err := TraceRequest(finishedPlan(), "")
+	require.NoError(t, err)
+
+	var request otlpTraceRequest
+	require.NoError(t, json.Unmarshal(data, &request))
+	require.Len(t, request.ResourceSpans, 1)
+	assert.Equal(t, DefaultTraceServiceName, *request.ResourceSpans[0].Resource.Attributes[0].Value.StringValue)
+
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 4)
+
+	root := spans[0]
+	assert.Equal(t, "0f8fad5bd9cb469fa16570867728950e", root.TraceID)
+	assert.Len(t, root.SpanID, 16)
+	assert.Empty(t, root.ParentSpanID)
+	assert.Equal(t, "run test-app", root.Name)
+	assert.Equal(t, "1700000000000000000", root.StartTimeUnixNano)
+	assert.Equal(t, "1700000006000000000", root.EndTimeUnixNano)
+	assert.Equal(t, otlpStatusError, root.Status.Code)
+
+	spec, workflow, resource := spans[1], spans[2], spans[3]
+	for _, span := range spans[1:] {
+		assert.Equal(t, root.TraceID, span.TraceID)
+		assert.Equal(t, root.SpanID, span.ParentSpanID)
+		assert.NotEqual(t, root.SpanID, span.SpanID)
+	}
+	assert.Equal(t, "Database Spec", spec.Name)
+	assert.Equal(t, otlpStatusOK, spec.Status.Code)
+
+	assert.Equal(t, "1700000001000000000", workflow.StartTimeUnixNano)
+	assert.Equal(t, "1700000005000000000", workflow.EndTimeUnixNano)
+	assert.Equal(t, otlpStatusError, workflow.Status.Code)
+	assert.Equal(t, "boom", workflow.Status.Message)
+	require.Len(t, workflow.Events, 1)
+	assert.Equal(t, "Execution failed: boom", workflow.Events[0].Name)
+
+	// Skipped nodes are zero-length spans at the start of the run
+	assert.Equal(t, root.StartTimeUnixNano, resource.StartTimeUnixNano)
+	assert.Equal(t, root.StartTimeUnixNano, resource.EndTimeUnixNano)
+	assert.Equal(t, otlpStatusUnset, resource.Status.Code)
+
+	// Span IDs are stable, so resending a run does not duplicate it
+	again, err := TraceRequest(finishedPlan(), "")
+	require.NoError(t, err)
+	assert.Equal(t, data, again)
+}
+
+func TestTraceRequest_Unfinished(t *testing.T) {
+	plan := finishedPlan()
+	plan.EndTime = nil
+
+	_, err := TraceRequest(plan, "")
+	assert.ErrorContains(t, err, "has not finished")
+}
+
+func TestTraceExporter_ExportPlan(t *testing.T) {
+	var path, contentType, token string
+	var body []byte
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		contentType = r.Header.Get("Content-Type")
+		token = r.Header.Get("Authorization")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer collector.Close()
+
+	exporter := NewTraceExporter(collector.URL)
+	exporter.Headers = map[string]string{"Authorization": "Bearer secret"}
+	exporter.ServiceName = "platform"
+	require.NoError(t, exporter.ExportPlan(context.Background(), finishedPlan()))
+
+	assert.Equal(t, "/v1/traces", path)
+	assert.Equal(t, "application/json", contentType)
+	assert.Equal(t, "Bearer secret", token)
+	assert.Contains(t, string(body), `"stringValue":"platform"`)
+}
+
+func TestTraceExporter_ExportPlan_Rejected(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad spans", http.StatusBadRequest)
+	}))
+	defer collector.Close()
+
+	err := NewTraceExporter(collector.URL+"/custom/traces").ExportPlan(context.Background(), finishedPlan())
+	assert.ErrorContains(t, err, "400 Bad Request: bad spans")
+}
+
+func TestTraceExporter_ExportSpans(t *testing.T) {
+	var body []byte
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer collector.Close()
+
+	plan := finishedPlan()
+	start := time.Unix(1700000000, 0)
+	request := tracing.Span{
+		SpanContext: tracing.SpanContext{TraceID: [16]byte{1}, SpanID: [8]byte{2}},
+		Parent:      [8]byte{3},
+		Name:        "POST /api/v1/apps/:app/execute",
+		Kind:        tracing.SpanKindServer,
+		Start:       start,
+		End:         start.Add(time.Second),
+		Attributes: []tracing.Attribute{
+			{Key: "http.route", Value: "/api/v1/apps/:app/execute"},
+			{Key: "http.response.status_code", Value: int64(500)},
+		},
+		Links: []tracing.SpanContext{RunSpanContext(plan.RunID)},
+		Error: "Internal Server Error",
+	}
+	require.NoError(t, NewTraceExporter(collector.URL).ExportSpans(context.Background(), []tracing.Span{request}))
+
+	var sent otlpTraceRequest
+	require.NoError(t, json.Unmarshal(body, &sent))
+	spans := sent.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "01000000000000000000000000000000", span.TraceID)
+	assert.Equal(t, "0200000000000000", span.SpanID)
+	assert.Equal(t, "0300000000000000", span.ParentSpanID)
+	assert.Equal(t, int(tracing.SpanKindServer), span.Kind)
+	assert.Equal(t, "1700000001000000000", span.EndTimeUnixNano)
+	assert.Equal(t, "/api/v1/apps/:app/execute", *span.Attributes[0].Value.StringValue)
+	assert.Equal(t, "500", *span.Attributes[1].Value.IntValue)
+	assert.Equal(t, otlpStatusError, span.Status.Code)
+
+	// The link points at the root span of the run's trace
+	data, err := TraceRequest(plan, "")
+	require.NoError(t, err)
+	var run otlpTraceRequest
+	require.NoError(t, json.Unmarshal(data, &run))
+	root := run.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	require.Len(t, span.Links, 1)
+	assert.Equal(t, root.TraceID, span.Links[0].TraceID)
+	assert.Equal(t, root.SpanID, span.Links[0].SpanID)
+}
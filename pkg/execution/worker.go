@@ -0,0 +1,152 @@
+package execution
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/google/uuid"
+)
+
+// WorkerOptions configures a Worker
+type WorkerOptions struct {
+	// ID names the worker in the claimed_by column of its runs. Default:
+	// the host name and a random suffix
+	ID string
+	// PollInterval is how often the queue is checked for runs queued by
+	// other replicas. Default: 1s
+	PollInterval time.Duration
+	// Concurrency is the number of runs executed at once. Default: 4
+	Concurrency int
+	// Observers returns the observers of a claimed run, e.g. to publish its
+	// state changes
+	Observers func(run *storage.GraphRunModel) []ExecutionObserver
+	// OnFinish is called with the plan of every finished run, e.g. to
+	// export it as a trace
+	OnFinish func(plan *ExecutionPlan)
+}
+
+// Worker executes the runs of a run queue shared by several server
+// replicas. Each replica with a runner runs a Worker; every queued run is
+// claimed by exactly one of them, whichever replica queued it.
+type Worker struct {
+	repository storage.RepositoryInterface
+	runner     WorkflowRunner
+	opts       WorkerOptions
+	wake       chan struct{}
+}
+
+// NewWorker creates a worker claiming runs from repository, which has to be
+// unscoped: claimed runs of any tenant are executed with a repository
+// scoped to the run's tenant
+func NewWorker(repository storage.RepositoryInterface, runner WorkflowRunner, opts WorkerOptions) *Worker {
+	if opts.ID == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			host = "worker"
+		}
+		opts.ID = fmt.Sprintf("%s-%s", host, uuid.NewString()[:8])
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+	return &Worker{
+		repository: repository,
+		runner:     runner,
+		opts:       opts,
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+// ID returns the name the worker claims runs with
+func (w *Worker) ID() string {
+	return w.opts.ID
+}
+
+// Notify makes the worker check the queue at once, e.g. after this replica
+// queued a run
+func (w *Worker) Notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run claims and executes queued runs until ctx is done, then waits for the
+// runs in progress to finish
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.opts.PollInterval)
+	defer ticker.Stop()
+
+	slots := make(chan struct{}, w.opts.Concurrency)
+	var running sync.WaitGroup
+	defer running.Wait()
+
+	for {
+		w.claimAll(ctx, slots, &running)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+	}
+}
+
+// claimAll claims runs while the queue has some and slots are free
+func (w *Worker) claimAll(ctx context.Context, slots chan struct{}, running *sync.WaitGroup) {
+	for ctx.Err() == nil {
+		select {
+		case slots <- struct{}{}:
+		default:
+			return // Busy; a finished run wakes the worker
+		}
+
+		run, err := w.repository.ClaimGraphRun(w.opts.ID)
+		if err != nil || run == nil {
+			<-slots
+			if err != nil {
+				log.Printf("Failed to claim graph run: %v", err)
+			}
+			return
+		}
+
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			defer func() {
+				<-slots
+				w.Notify()
+			}()
+			w.execute(run)
+		}()
+	}
+}
+
+// execute runs a claimed run with a repository scoped to its tenant
+func (w *Worker) execute(run *storage.GraphRunModel) {
+	ctx := storage.WithTenant(context.Background(), run.TenantID)
+	engine := NewEngine(w.repository.ForTenant(ctx), w.runner)
+	if w.opts.Observers != nil {
+		for _, observer := range w.opts.Observers(run) {
+			engine.RegisterObserver(observer)
+		}
+	}
+
+	plan, err := engine.ExecuteRun(run)
+	if err != nil {
+		log.Printf("Run %s of app %s failed: %v", run.ID, run.App.Name, err)
+		return
+	}
+	if w.opts.OnFinish != nil {
+		w.opts.OnFinish(plan)
+	}
+}
@@ -0,0 +1,138 @@
+package execution
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorker_ExecutesEachQueuedRunOnce(t *testing.T) {
+	db, err := storage.NewSQLiteConnection(filepath.Join(t.TempDir(), "graph.db"))
+	require.NoError(t, err)
+	require.NoError(t, storage.AutoMigrate(db))
+	repo := storage.NewRepository(db)
+	require.NoError(t, repo.SaveGraph("test-app", createTestGraphForExecution()))
+
+	queued := make(map[uuid.UUID]bool)
+	for i := 0; i < 5; i++ {
+		run, err := repo.QueueGraphRun("test-app", 1)
+		require.NoError(t, err)
+		queued[run.ID] = true
+	}
+
+	var mu sync.Mutex
+	finished := make(map[uuid.UUID]int)
+	onFinish := func(plan *ExecutionPlan) {
+		mu.Lock()
+		defer mu.Unlock()
+		finished[plan.RunID]++
+	}
+
+	// Two replicas compete for the same queue
+	ctx, cancel := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	for _, id := range []string{"replica-1", "replica-2"} {
+		worker := NewWorker(repo, NewMockWorkflowRunner(), WorkerOptions{
+			ID:           id,
+			PollInterval: 10 * time.Millisecond,
+			Concurrency:  2,
+			OnFinish:     onFinish,
+		})
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			worker.Run(ctx)
+		}()
+	}
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(finished) == len(queued)
+	}, 10*time.Second, 20*time.Millisecond)
+	cancel()
+	workers.Wait()
+
+	for runID := range queued {
+		assert.Equal(t, 1, finished[runID], "run %s executed once", runID)
+		run, err := repo.GetGraphRun(runID)
+		require.NoError(t, err)
+		assert.Equal(t, string(StatusCompleted), run.Status)
+		assert.Contains(t, []string{"replica-1", "replica-2"}, run.ClaimedBy)
+		assert.NotEmpty(t, run.ExecutionPlan)
+	}
+}
+
+// blockingRunner runs the first workflow only once release is closed
+type blockingRunner struct {
+	MockWorkflowRunner
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (r *blockingRunner) RunWorkflow(node *graph.Node) error {
+	r.once.Do(func() {
+		close(r.started)
+		<-r.release
+	})
+	return nil
+}
+
+func TestWorker_StopsCancelledRuns(t *testing.T) {
+	db, err := storage.NewSQLiteConnection(filepath.Join(t.TempDir(), "graph.db"))
+	require.NoError(t, err)
+	require.NoError(t, storage.AutoMigrate(db))
+	repo := storage.NewRepository(db)
+	require.NoError(t, repo.SaveGraph("test-app", createTestGraphForExecution()))
+	run, err := repo.QueueGraphRun("test-app", 1)
+	require.NoError(t, err)
+
+	runner := &blockingRunner{started: make(chan struct{}), release: make(chan struct{})}
+	finished := make(chan *ExecutionPlan, 1)
+	worker := NewWorker(repo, runner, WorkerOptions{
+		PollInterval: 10 * time.Millisecond,
+		OnFinish:     func(plan *ExecutionPlan) { finished <- plan },
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go worker.Run(ctx)
+
+	// Cancelled through the database while workflow1 runs, as by another
+	// replica or ctl
+	select {
+	case <-runner.started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("run not started")
+	}
+	require.NoError(t, repo.CancelGraphRun(run.ID, "stop"))
+	close(runner.release)
+
+	var plan *ExecutionPlan
+	select {
+	case plan = <-finished:
+	case <-time.After(10 * time.Second):
+		t.Fatal("run not finished")
+	}
+	assert.Equal(t, StatusFailed, plan.Status)
+	assert.Equal(t, StatusCompleted, plan.Executions["workflow1"].Status, "the node executing finishes")
+	for _, id := range []string{"resource1", "workflow2", "resource2"} {
+		assert.Equal(t, StatusSkipped, plan.Executions[id].Status, id)
+		assert.Contains(t, plan.Executions[id].Logs, "Skipped, the run was cancelled")
+	}
+
+	stored, err := repo.GetGraphRun(run.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "failed", stored.Status)
+	assert.Equal(t, "cancelled: stop", stored.ErrorMessage)
+	assert.NotEmpty(t, stored.ExecutionPlan)
+}
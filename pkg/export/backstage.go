@@ -0,0 +1,231 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// BackstageOptions configures the Backstage catalog export
+type BackstageOptions struct {
+	// Owner is the owning user or group of all entities. It defaults to the
+	// app's team, then its owner, then "unknown".
+	Owner string `json:"owner"`
+	// Lifecycle of the Component entities (default "production")
+	Lifecycle string `json:"lifecycle"`
+	// Namespace of the entities; empty uses Backstage's default namespace
+	Namespace string `json:"namespace"`
+	// System groups the entities; it defaults to the app name
+	System string `json:"system"`
+}
+
+// Backstage annotations linking entities back to the graph
+const (
+	BackstageAnnotationApp   = "innominatus.io/app"
+	BackstageAnnotationNode  = "innominatus.io/node-id"
+	BackstageAnnotationState = "innominatus.io/state"
+)
+
+var backstageUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+type backstageEntity struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   backstageMetadata `yaml:"metadata"`
+	Spec       backstageSpec     `yaml:"spec"`
+}
+
+type backstageMetadata struct {
+	Name        string            `yaml:"name"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Title       string            `yaml:"title,omitempty"`
+	Description string            `yaml:"description,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+	Tags        []string          `yaml:"tags,omitempty"`
+	Links       []backstageLink   `yaml:"links,omitempty"`
+}
+
+type backstageLink struct {
+	URL   string `yaml:"url"`
+	Title string `yaml:"title,omitempty"`
+}
+
+type backstageSpec struct {
+	Type           string   `yaml:"type,omitempty"`
+	Lifecycle      string   `yaml:"lifecycle,omitempty"`
+	Owner          string   `yaml:"owner"`
+	System         string   `yaml:"system,omitempty"`
+	SubcomponentOf string   `yaml:"subcomponentOf,omitempty"`
+	DependsOn      []string `yaml:"dependsOn,omitempty"`
+}
+
+// ExportGraphBackstage renders a graph as Backstage catalog-info YAML: one
+// System entity for the app, a Resource entity per resource node and a
+// Component entity per spec, workflow and step. Depends-on and binds-to
+// edges become dependsOn relations, steps are subcomponents of the workflow
+// containing them. Entity names are the app name and node ID joined by a
+// dash, reduced to the characters Backstage accepts.
+func ExportGraphBackstage(g *graph.Graph, opts BackstageOptions) ([]byte, error) {
+	owner := opts.Owner
+	if owner == "" && g.Metadata != nil {
+		owner = g.Metadata.Team
+		if owner == "" {
+			owner = g.Metadata.Owner
+		}
+	}
+	if owner == "" {
+		owner = "unknown"
+	}
+	lifecycle := opts.Lifecycle
+	if lifecycle == "" {
+		lifecycle = "production"
+	}
+	system := opts.System
+	if system == "" {
+		system = backstageName(g.AppName)
+	}
+
+	names := make(map[string]string, len(g.Nodes))
+	for id := range g.Nodes {
+		names[id] = backstageName(g.AppName + "-" + id)
+	}
+	ref := func(node *graph.Node) string {
+		kind := strings.ToLower(backstageKind(node.Type))
+		if opts.Namespace != "" {
+			return fmt.Sprintf("%s:%s/%s", kind, opts.Namespace, names[node.ID])
+		}
+		return fmt.Sprintf("%s:%s", kind, names[node.ID])
+	}
+
+	systemEntity := backstageEntity{
+		APIVersion: "backstage.io/v1alpha1",
+		Kind:       "System",
+		Metadata: backstageMetadata{
+			Name:        system,
+			Namespace:   opts.Namespace,
+			Annotations: map[string]string{BackstageAnnotationApp: g.AppName},
+		},
+		Spec: backstageSpec{Owner: owner},
+	}
+	if g.Metadata != nil {
+		systemEntity.Metadata.Description = g.Metadata.Description
+		linkNames := make([]string, 0, len(g.Metadata.Links))
+		for name := range g.Metadata.Links {
+			linkNames = append(linkNames, name)
+		}
+		sort.Strings(linkNames)
+		for _, name := range linkNames {
+			systemEntity.Metadata.Links = append(systemEntity.Metadata.Links, backstageLink{URL: g.Metadata.Links[name], Title: name})
+		}
+	}
+
+	entities := []backstageEntity{systemEntity}
+	for _, node := range sortedNodes(g) {
+		entity := backstageEntity{
+			APIVersion: "backstage.io/v1alpha1",
+			Kind:       backstageKind(node.Type),
+			Metadata: backstageMetadata{
+				Name:        names[node.ID],
+				Namespace:   opts.Namespace,
+				Title:       node.Name,
+				Description: node.Description,
+				Annotations: map[string]string{
+					BackstageAnnotationApp:   g.AppName,
+					BackstageAnnotationNode:  node.ID,
+					BackstageAnnotationState: stateName(node.State),
+				},
+				Tags: []string{string(node.Type)},
+			},
+			Spec: backstageSpec{
+				Type:   backstageType(node),
+				Owner:  owner,
+				System: system,
+			},
+		}
+		if entity.Kind == "Component" {
+			entity.Spec.Lifecycle = lifecycle
+		}
+
+		for _, edge := range g.OutgoingEdges(node.ID) {
+			target, exists := g.Nodes[edge.ToNodeID]
+			if !exists {
+				return nil, fmt.Errorf("edge %s references unknown node", edge.ID)
+			}
+			switch edge.Type {
+			case graph.EdgeTypeDependsOn, graph.EdgeTypeBindsTo:
+				entity.Spec.DependsOn = append(entity.Spec.DependsOn, ref(target))
+			}
+		}
+		sort.Strings(entity.Spec.DependsOn)
+		entity.Spec.DependsOn = slices.Compact(entity.Spec.DependsOn)
+
+		for _, edge := range g.IncomingEdges(node.ID) {
+			if edge.Type == graph.EdgeTypeContains && entity.Kind == "Component" {
+				if parent, exists := g.Nodes[edge.FromNodeID]; exists && (entity.Spec.SubcomponentOf == "" || ref(parent) < entity.Spec.SubcomponentOf) {
+					entity.Spec.SubcomponentOf = ref(parent)
+				}
+			}
+		}
+
+		entities = append(entities, entity)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	for _, entity := range entities {
+		if err := encoder.Encode(entity); err != nil {
+			return nil, fmt.Errorf("failed to encode entity %s: %w", entity.Metadata.Name, err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func backstageKind(nodeType graph.NodeType) string {
+	if nodeType == graph.NodeTypeResource {
+		return "Resource"
+	}
+	return "Component"
+}
+
+// backstageType returns the spec.type of a node's entity. Resources use
+// their "type" property if set, e.g. "database".
+func backstageType(node *graph.Node) string {
+	switch node.Type {
+	case graph.NodeTypeSpec:
+		return "service"
+	case graph.NodeTypeWorkflow:
+		return "workflow"
+	case graph.NodeTypeStep:
+		return "workflow-step"
+	default:
+		if t, ok := node.Properties["type"].(string); ok && t != "" {
+			return t
+		}
+		return "resource"
+	}
+}
+
+// backstageName reduces s to a valid entity name: at most 63 characters of
+// letters, digits and [-_.], starting and ending with a letter or digit
+func backstageName(s string) string {
+	name := backstageUnsafe.ReplaceAllString(s, "-")
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	name = strings.Trim(name, "-_.")
+	if name == "" {
+		return "unnamed"
+	}
+	return name
+}
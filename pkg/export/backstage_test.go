@@ -0,0 +1,111 @@
+package export
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeBackstageEntities(t *testing.T, data []byte) []backstageEntity {
+	var entities []backstageEntity
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var entity backstageEntity
+		err := decoder.Decode(&entity)
+		if errors.Is(err, io.EOF) {
+			return entities
+		}
+		require.NoError(t, err)
+		entities = append(entities, entity)
+	}
+}
+
+func TestExportGraphBackstage(t *testing.T) {
+	g := createTestGraph()
+	require.NoError(t, g.AddNode(&graph.Node{ID: "step1", Type: graph.NodeTypeStep, Name: "Create schema"}))
+	require.NoError(t, g.AddEdges([]*graph.Edge{
+		{ID: "e3", FromNodeID: "workflow1", ToNodeID: "step1", Type: graph.EdgeTypeContains},
+		{ID: "e4", FromNodeID: "step1", ToNodeID: "resource1", Type: graph.EdgeTypeBindsTo},
+	}))
+	g.Nodes["resource1"].Properties = map[string]interface{}{"type": "database"}
+	g.Metadata = &graph.AppMetadata{Team: "team-data", Description: "Test app", Links: map[string]string{"runbook": "https://example.com/runbook"}}
+
+	data, err := ExportGraphBackstage(g, BackstageOptions{})
+	require.NoError(t, err)
+
+	entities := decodeBackstageEntities(t, data)
+	require.Len(t, entities, 5)
+
+	system := entities[0]
+	assert.Equal(t, "System", system.Kind)
+	assert.Equal(t, "test-app", system.Metadata.Name)
+	assert.Equal(t, "team-data", system.Spec.Owner)
+	assert.Equal(t, []backstageLink{{URL: "https://example.com/runbook", Title: "runbook"}}, system.Metadata.Links)
+
+	byName := make(map[string]backstageEntity)
+	for _, entity := range entities[1:] {
+		assert.Equal(t, "backstage.io/v1alpha1", entity.APIVersion)
+		assert.Equal(t, "test-app", entity.Spec.System)
+		assert.Equal(t, "team-data", entity.Spec.Owner)
+		byName[entity.Metadata.Name] = entity
+	}
+
+	resource := byName["test-app-resource1"]
+	assert.Equal(t, "Resource", resource.Kind)
+	assert.Equal(t, "database", resource.Spec.Type)
+	assert.Empty(t, resource.Spec.Lifecycle)
+	assert.Equal(t, "resource1", resource.Metadata.Annotations[BackstageAnnotationNode])
+
+	workflow := byName["test-app-workflow1"]
+	assert.Equal(t, "Component", workflow.Kind)
+	assert.Equal(t, "workflow", workflow.Spec.Type)
+	assert.Equal(t, "production", workflow.Spec.Lifecycle)
+	assert.Equal(t, "Deploy Database", workflow.Metadata.Title)
+	assert.Equal(t, []string{"component:test-app-spec1"}, workflow.Spec.DependsOn)
+
+	step := byName["test-app-step1"]
+	assert.Equal(t, "workflow-step", step.Spec.Type)
+	assert.Equal(t, "component:test-app-workflow1", step.Spec.SubcomponentOf)
+	assert.Equal(t, []string{"resource:test-app-resource1"}, step.Spec.DependsOn)
+
+	assert.Equal(t, "service", byName["test-app-spec1"].Spec.Type)
+}
+
+func TestExportGraphBackstage_Options(t *testing.T) {
+	data, err := ExportGraphBackstage(createTestGraph(), BackstageOptions{
+		Owner:     "group:platform",
+		Lifecycle: "experimental",
+		Namespace: "orchestration",
+		System:    "deployments",
+	})
+	require.NoError(t, err)
+
+	entities := decodeBackstageEntities(t, data)
+	require.Len(t, entities, 4)
+	assert.Equal(t, "deployments", entities[0].Metadata.Name)
+	for _, entity := range entities {
+		assert.Equal(t, "orchestration", entity.Metadata.Namespace)
+		assert.Equal(t, "group:platform", entity.Spec.Owner)
+	}
+	assert.Equal(t, "experimental", entities[3].Spec.Lifecycle)
+	assert.Equal(t, []string{"component:orchestration/test-app-spec1"}, entities[3].Spec.DependsOn)
+
+	// Without options or app metadata the owner is unknown
+	data, err = ExportGraphBackstage(createTestGraph(), BackstageOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "unknown", decodeBackstageEntities(t, data)[0].Spec.Owner)
+}
+
+func TestBackstageName(t *testing.T) {
+	assert.Equal(t, "my-app-node-1", backstageName("my app/node:1"))
+	assert.Equal(t, "unnamed", backstageName("///"))
+	assert.Len(t, backstageName(string(bytes.Repeat([]byte("a"), 100))), 63)
+}
@@ -0,0 +1,262 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// CSVOptions configures CSV and TSV export
+type CSVOptions struct {
+	// TSV separates values with tabs instead of commas
+	TSV bool `json:"tsv"`
+	// NodeColumns selects the node columns (default DefaultNodeColumns).
+	// Besides the DefaultNodeColumns, "properties" holds all properties as
+	// JSON and "property.<key>" a single property.
+	NodeColumns []string `json:"node_columns"`
+	// EdgeColumns selects the edge columns (default DefaultEdgeColumns),
+	// with the same property columns as NodeColumns
+	EdgeColumns []string `json:"edge_columns"`
+}
+
+// DefaultNodeColumns are the node columns written when none are selected
+var DefaultNodeColumns = []string{
+	"id", "name", "type", "state", "description",
+	"created_at", "updated_at", "started_at", "completed_at", "duration_ms",
+}
+
+// DefaultEdgeColumns are the edge columns written when none are selected
+var DefaultEdgeColumns = []string{
+	"id", "from_node_id", "to_node_id", "type", "description", "created_at",
+}
+
+// CSVFiles holds the node and edge tables of a CSV or TSV export
+type CSVFiles struct {
+	Extension string // "csv" or "tsv"
+	Nodes     []byte
+	Edges     []byte
+}
+
+// NodesFileName returns the usual name of the node table, e.g. nodes.csv
+func (f *CSVFiles) NodesFileName() string {
+	return "nodes." + f.Extension
+}
+
+// EdgesFileName returns the usual name of the edge table, e.g. edges.csv
+func (f *CSVFiles) EdgesFileName() string {
+	return "edges." + f.Extension
+}
+
+// Zip packs both tables into a zip archive
+func (f *CSVFiles) Zip() ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{
+		{f.NodesFileName(), f.Nodes},
+		{f.EdgesFileName(), f.Edges},
+	} {
+		w, err := archive.Create(file.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s to archive: %w", file.name, err)
+		}
+		if _, err := w.Write(file.data); err != nil {
+			return nil, fmt.Errorf("failed to add %s to archive: %w", file.name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteDir writes both tables into dir, which must exist
+func (f *CSVFiles) WriteDir(dir string) error {
+	if err := os.WriteFile(filepath.Join(dir, f.NodesFileName()), f.Nodes, 0o644); err != nil {
+		return fmt.Errorf("failed to write nodes: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, f.EdgesFileName()), f.Edges, 0o644); err != nil {
+		return fmt.Errorf("failed to write edges: %w", err)
+	}
+	return nil
+}
+
+// ExportGraphCSV writes the nodes and edges of a graph as two tables with a
+// header row, sorted by ID. Times are RFC 3339; unset values are empty.
+func ExportGraphCSV(g *graph.Graph, opts CSVOptions) (*CSVFiles, error) {
+	files := &CSVFiles{Extension: "csv"}
+	delimiter := ','
+	if opts.TSV {
+		files.Extension = "tsv"
+		delimiter = '\t'
+	}
+
+	nodeColumns := opts.NodeColumns
+	if len(nodeColumns) == 0 {
+		nodeColumns = DefaultNodeColumns
+	}
+	edgeColumns := opts.EdgeColumns
+	if len(edgeColumns) == 0 {
+		edgeColumns = DefaultEdgeColumns
+	}
+
+	nodes := sortedNodes(g)
+	nodeRows := make([][]string, len(nodes))
+	for i, node := range nodes {
+		row, err := csvRow(nodeColumns, node.Properties, func(column string) (string, bool) {
+			return nodeCSVValue(node, column)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid node columns: %w", err)
+		}
+		nodeRows[i] = row
+	}
+
+	edges := sortedEdges(g)
+	edgeRows := make([][]string, len(edges))
+	for i, edge := range edges {
+		row, err := csvRow(edgeColumns, edge.Properties, func(column string) (string, bool) {
+			return edgeCSVValue(edge, column)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid edge columns: %w", err)
+		}
+		edgeRows[i] = row
+	}
+
+	var err error
+	if files.Nodes, err = encodeCSV(nodeColumns, nodeRows, delimiter); err != nil {
+		return nil, err
+	}
+	if files.Edges, err = encodeCSV(edgeColumns, edgeRows, delimiter); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// csvRow resolves columns with value, falling back to the property columns
+func csvRow(columns []string, properties map[string]interface{}, value func(string) (string, bool)) ([]string, error) {
+	row := make([]string, len(columns))
+	for i, column := range columns {
+		if v, ok := value(column); ok {
+			row[i] = v
+			continue
+		}
+		switch {
+		case column == "properties":
+			if len(properties) > 0 {
+				data, err := json.Marshal(properties)
+				if err != nil {
+					return nil, fmt.Errorf("failed to encode properties: %w", err)
+				}
+				row[i] = string(data)
+			}
+		case strings.HasPrefix(column, "property.") && len(column) > len("property."):
+			v, err := csvPropertyValue(properties[strings.TrimPrefix(column, "property.")])
+			if err != nil {
+				return nil, err
+			}
+			row[i] = v
+		default:
+			return nil, fmt.Errorf("unknown column %q", column)
+		}
+	}
+	return row, nil
+}
+
+func nodeCSVValue(node *graph.Node, column string) (string, bool) {
+	switch column {
+	case "id":
+		return node.ID, true
+	case "name":
+		return node.Name, true
+	case "type":
+		return string(node.Type), true
+	case "state":
+		return string(node.State), true
+	case "description":
+		return node.Description, true
+	case "created_at":
+		return csvTime(&node.CreatedAt), true
+	case "updated_at":
+		return csvTime(&node.UpdatedAt), true
+	case "started_at":
+		return csvTime(node.StartedAt), true
+	case "completed_at":
+		return csvTime(node.CompletedAt), true
+	case "duration_ms":
+		if duration, ok := nodeDuration(node, time.Now()); ok && node.State != graph.NodeStateRunning {
+			return strconv.FormatInt(duration.Milliseconds(), 10), true
+		}
+		return "", true
+	default:
+		return "", false
+	}
+}
+
+func edgeCSVValue(edge *graph.Edge, column string) (string, bool) {
+	switch column {
+	case "id":
+		return edge.ID, true
+	case "from_node_id":
+		return edge.FromNodeID, true
+	case "to_node_id":
+		return edge.ToNodeID, true
+	case "type":
+		return string(edge.Type), true
+	case "description":
+		return edge.Description, true
+	case "created_at":
+		return csvTime(&edge.CreatedAt), true
+	default:
+		return "", false
+	}
+}
+
+// csvPropertyValue writes strings and numbers as they are and nested values
+// as JSON
+func csvPropertyValue(value interface{}) (string, error) {
+	switch value.(type) {
+	case nil:
+		return "", nil
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode property: %w", err)
+		}
+		return string(data), nil
+	default:
+		return graphMLValue(value), nil
+	}
+}
+
+func csvTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func encodeCSV(header []string, rows [][]string, delimiter rune) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = delimiter
+	if err := w.Write(header); err != nil {
+		return nil, fmt.Errorf("failed to write CSV: %w", err)
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return nil, fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,118 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readCSV(t *testing.T, data []byte, delimiter rune) [][]string {
+	t.Helper()
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = delimiter
+	records, err := r.ReadAll()
+	require.NoError(t, err)
+	return records
+}
+
+func TestExportGraphCSV(t *testing.T) {
+	g := createTestGraph()
+	started := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	completed := started.Add(1500 * time.Millisecond)
+	g.Nodes["workflow1"].State = graph.NodeStateSucceeded
+	g.Nodes["workflow1"].StartedAt = &started
+	g.Nodes["workflow1"].CompletedAt = &completed
+	g.Nodes["workflow1"].Description = "Deploys the database, \"quickly\""
+
+	files, err := ExportGraphCSV(g, CSVOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "nodes.csv", files.NodesFileName())
+	assert.Equal(t, "edges.csv", files.EdgesFileName())
+
+	nodes := readCSV(t, files.Nodes, ',')
+	require.Len(t, nodes, 4)
+	assert.Equal(t, DefaultNodeColumns, nodes[0])
+	assert.Equal(t, "resource1", nodes[1][0])
+	workflow := nodes[3]
+	assert.Equal(t, []string{"workflow1", "Deploy Database", "workflow", "succeeded", "Deploys the database, \"quickly\""}, workflow[:5])
+	assert.Equal(t, []string{"2024-05-01T12:00:00Z", "2024-05-01T12:00:01Z", "1500"}, workflow[7:])
+
+	edges := readCSV(t, files.Edges, ',')
+	require.Len(t, edges, 3)
+	assert.Equal(t, DefaultEdgeColumns, edges[0])
+	assert.Equal(t, []string{"e1", "workflow1", "spec1", "depends-on", "needs spec"}, edges[1][:5])
+}
+
+func TestExportGraphCSV_Columns(t *testing.T) {
+	g := createTestGraph()
+	g.Nodes["resource1"].Properties = map[string]interface{}{
+		"engine": "postgres",
+		"size":   20.5,
+		"tags":   []interface{}{"prod"},
+	}
+
+	files, err := ExportGraphCSV(g, CSVOptions{
+		TSV:         true,
+		NodeColumns: []string{"id", "property.engine", "property.size", "property.tags", "properties"},
+		EdgeColumns: []string{"from_node_id", "to_node_id"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "nodes.tsv", files.NodesFileName())
+
+	nodes := readCSV(t, files.Nodes, '\t')
+	assert.Equal(t, []string{"resource1", "postgres", "20.5", `["prod"]`, `{"engine":"postgres","size":20.5,"tags":["prod"]}`}, nodes[1])
+	assert.Equal(t, []string{"spec1", "", "", "", ""}, nodes[2])
+
+	edges := readCSV(t, files.Edges, '\t')
+	assert.Equal(t, [][]string{{"from_node_id", "to_node_id"}, {"workflow1", "spec1"}, {"workflow1", "resource1"}}, edges)
+
+	_, err = ExportGraphCSV(g, CSVOptions{NodeColumns: []string{"id", "colour"}})
+	assert.ErrorContains(t, err, `unknown column "colour"`)
+}
+
+func TestCSVFiles_ZipAndWriteDir(t *testing.T) {
+	files, err := ExportGraphCSV(createTestGraph(), CSVOptions{})
+	require.NoError(t, err)
+
+	data, err := files.Zip()
+	require.NoError(t, err)
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	require.Len(t, archive.File, 2)
+	assert.Equal(t, "nodes.csv", archive.File[0].Name)
+	assert.Equal(t, "edges.csv", archive.File[1].Name)
+	r, err := archive.File[0].Open()
+	require.NoError(t, err)
+	content, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, files.Nodes, content)
+
+	dir := t.TempDir()
+	require.NoError(t, files.WriteDir(dir))
+	edges, err := os.ReadFile(filepath.Join(dir, "edges.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, files.Edges, edges)
+}
+
+func TestExporter_ExportGraph_TSV(t *testing.T) {
+	exporter := NewExporter()
+	defer exporter.Close()
+
+	data, err := exporter.ExportGraph(createTestGraph(), FormatTSV)
+	require.NoError(t, err)
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	assert.Equal(t, "nodes.tsv", archive.File[0].Name)
+	assert.Equal(t, "application/zip", FormatTSV.ContentType())
+	assert.Equal(t, "zip", FormatCSV.FileExtension())
+}
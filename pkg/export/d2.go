@@ -0,0 +1,111 @@
+package export
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// D2Options configures D2 export
+type D2Options struct {
+	// Direction is the layout direction: TD (default), BT, LR or RL
+	Direction string `json:"direction"`
+	// Stamp adds a footer with version, export time and run; nil uses
+	// Options.Stamp when exporting through an Exporter
+	Stamp *Stamp `json:"stamp,omitempty"`
+}
+
+// ExportGraphD2 renders a graph as a D2 diagram. Like the Mermaid export,
+// shapes reflect the node type, connection styles mirror the DOT edge styles
+// and colors match the DOT export. Node IDs are used as quoted keys, so they
+// need no sanitizing.
+func ExportGraphD2(g *graph.Graph, opts D2Options) ([]byte, error) {
+	var direction string
+	switch strings.ToUpper(opts.Direction) {
+	case "", "TD", "TB":
+		direction = "down"
+	case "BT":
+		direction = "up"
+	case "LR":
+		direction = "right"
+	case "RL":
+		direction = "left"
+	default:
+		return nil, fmt.Errorf("unsupported D2 direction: %s", opts.Direction)
+	}
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "direction: %s\n", direction)
+
+	for _, node := range sortedNodes(g) {
+		label := fmt.Sprintf("%s\n(%s)", node.Name, node.Type)
+		if node.State != "" && node.State != graph.NodeStateWaiting {
+			label += fmt.Sprintf("\n[%s]", node.State)
+		}
+
+		fmt.Fprintf(&buf, "\n%s: %s {\n", strconv.Quote(node.ID), strconv.Quote(label))
+		shape, doubleBorder := d2Shape(node.Type)
+		fmt.Fprintf(&buf, "  shape: %s\n", shape)
+		fmt.Fprintf(&buf, "  style.fill: %s\n", strconv.Quote(defaultTheme.NodeFill(node.Type)))
+		if doubleBorder {
+			buf.WriteString("  style.double-border: true\n")
+		}
+		switch node.State {
+		case graph.NodeStateRunning, graph.NodeStateFailed, graph.NodeStateSucceeded:
+			fmt.Fprintf(&buf, "  style.stroke: %s\n", strconv.Quote(defaultTheme.StateBorder(node.State)))
+			buf.WriteString("  style.stroke-width: 3\n")
+		}
+		if u := nodeURL(node); u != "" {
+			fmt.Fprintf(&buf, "  link: %s\n", strconv.Quote(u))
+		}
+		buf.WriteString("}\n")
+	}
+
+	for _, edge := range sortedEdges(g) {
+		if _, ok := g.Nodes[edge.FromNodeID]; !ok {
+			return nil, fmt.Errorf("edge %s references unknown node", edge.ID)
+		}
+		if _, ok := g.Nodes[edge.ToNodeID]; !ok {
+			return nil, fmt.Errorf("edge %s references unknown node", edge.ID)
+		}
+		label := string(edge.Type)
+		if edge.Description != "" {
+			label += "\n" + edge.Description
+		}
+
+		fmt.Fprintf(&buf, "\n%s -> %s: %s {\n", strconv.Quote(edge.FromNodeID), strconv.Quote(edge.ToNodeID), strconv.Quote(label))
+		fmt.Fprintf(&buf, "  style.stroke: %s\n", strconv.Quote(defaultTheme.EdgeColor(edge.Type)))
+		switch defaultTheme.EdgeStyle(edge.Type) {
+		case "bold":
+			buf.WriteString("  style.stroke-width: 3\n")
+		case "dashed":
+			buf.WriteString("  style.stroke-dash: 5\n")
+		case "dotted":
+			buf.WriteString("  style.stroke-dash: 2\n")
+		}
+		buf.WriteString("}\n")
+	}
+
+	if opts.Stamp != nil {
+		fmt.Fprintf(&buf, "\n__stamp: %s {\n  shape: text\n  near: bottom-right\n  style.font-size: 10\n}\n", strconv.Quote(opts.Stamp.text(g)))
+	}
+
+	return []byte(buf.String()), nil
+}
+
+// d2Shape mirrors the Mermaid shapes: spec stadium, workflow subroutine
+// (drawn as a double-bordered rectangle), step box and resource cylinder
+func d2Shape(nodeType graph.NodeType) (string, bool) {
+	switch nodeType {
+	case graph.NodeTypeSpec:
+		return "oval", false
+	case graph.NodeTypeWorkflow:
+		return "rectangle", true
+	case graph.NodeTypeResource:
+		return "cylinder", false
+	default:
+		return "rectangle", false
+	}
+}
@@ -0,0 +1,43 @@
+package export
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportGraphD2(t *testing.T) {
+	g := createTestGraph()
+	require.NoError(t, g.UpdateNodeState("workflow1", graph.NodeStateRunning))
+
+	data, err := ExportGraphD2(g, D2Options{})
+	require.NoError(t, err)
+	content := string(data)
+
+	assert.True(t, strings.HasPrefix(content, "direction: down\n"))
+	assert.Contains(t, content, "\"spec1\": \"Database Spec\\n(spec)\" {\n  shape: oval\n  style.fill: \"#E3F2FD\"\n}\n")
+	assert.Contains(t, content, "\"workflow1\": \"Deploy Database\\n(workflow)\\n[running]\" {\n"+
+		"  shape: rectangle\n  style.fill: \"#FFF9C4\"\n  style.double-border: true\n"+
+		"  style.stroke: \"#1976D2\"\n  style.stroke-width: 3\n}\n")
+	assert.Contains(t, content, "  shape: cylinder\n")
+	assert.Contains(t, content, "\"workflow1\" -> \"spec1\": \"depends-on\\nneeds spec\" {\n  style.stroke: \"#1976D2\"\n}\n")
+	assert.Contains(t, content, "\"workflow1\" -> \"resource1\": \"provisions\\ncreates database\" {\n"+
+		"  style.stroke: \"#388E3C\"\n  style.stroke-width: 3\n}\n")
+
+	again, err := ExportGraphD2(g, D2Options{})
+	require.NoError(t, err)
+	assert.Equal(t, content, string(again), "export should be deterministic")
+}
+
+func TestExportGraphD2_Options(t *testing.T) {
+	data, err := ExportGraphD2(createTestGraph(), D2Options{Direction: "RL"})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "direction: left\n"))
+
+	_, err = ExportGraphD2(createTestGraph(), D2Options{Direction: "diagonal"})
+	assert.Error(t, err)
+}
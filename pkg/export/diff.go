@@ -0,0 +1,156 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// Colors of a rendered diff, as fill and border
+var (
+	diffUnchanged = [2]string{"#f8f9fa", "#adb5bd"}
+	diffAdded     = [2]string{"#d4edda", "#28a745"}
+	diffRemoved   = [2]string{"#f8d7da", "#dc3545"}
+	diffChanged   = [2]string{"#fff3cd", "#fd7e14"}
+)
+
+// ExportDiffTo draws the nodes and edges of both graphs of a diff, as
+// returned by graph.Diff(from, to): added ones in green, removed ones dashed
+// in red, changed ones in orange with their changes as tooltip, and the
+// rest in gray. DOT, SVG, PNG and PDF are supported.
+func (e *Exporter) ExportDiffTo(w io.Writer, from, to *graph.Graph, diff *graph.GraphDiff, format Format) error {
+	dotContent := e.generateDiffDOT(from, to, diff)
+	switch format {
+	case FormatDOT:
+		if _, err := io.WriteString(w, dotContent); err != nil {
+			return fmt.Errorf("failed to write diff: %w", err)
+		}
+		return nil
+	case FormatSVG, FormatPNG, FormatPDF:
+		return e.renderDOT(w, dotContent, format, PDFOptions{})
+	default:
+		return fmt.Errorf("unsupported diff format: %s (supported: dot, svg, png, pdf)", format)
+	}
+}
+
+func (e *Exporter) generateDiffDOT(from, to *graph.Graph, diff *graph.GraphDiff) string {
+	nodes := make(map[string]*graph.Node)
+	edges := make(map[string]*graph.Edge)
+	if to != nil {
+		for id, node := range to.Nodes {
+			nodes[id] = node
+		}
+		for id, edge := range to.Edges {
+			edges[id] = edge
+		}
+	}
+	nodeColors := make(map[string][2]string)
+	edgeColors := make(map[string][2]string)
+	tooltips := make(map[string]string)
+	for _, node := range diff.AddedNodes {
+		nodeColors[node.ID] = diffAdded
+	}
+	for _, node := range diff.RemovedNodes {
+		nodes[node.ID] = node
+		nodeColors[node.ID] = diffRemoved
+	}
+	for _, change := range diff.ChangedNodes {
+		nodeColors[change.ID] = diffChanged
+		tooltips[change.ID] = diffTooltip(change.Changes)
+	}
+	for _, edge := range diff.AddedEdges {
+		edgeColors[edge.ID] = diffAdded
+	}
+	for _, edge := range diff.RemovedEdges {
+		edges[edge.ID] = edge
+		edgeColors[edge.ID] = diffRemoved
+	}
+	for _, change := range diff.ChangedEdges {
+		edgeColors[change.ID] = diffChanged
+	}
+
+	appName := ""
+	if to != nil {
+		appName = to.AppName
+	} else if from != nil {
+		appName = from.AppName
+	}
+
+	var buf strings.Builder
+	buf.WriteString(fmt.Sprintf("digraph \"%s\" {\n", e.escapeLabel(appName)))
+	buf.WriteString("  rankdir=TB;\n")
+	buf.WriteString("  node [shape=box];\n")
+	buf.WriteString("  edge [fontsize=10];\n\n")
+
+	for _, id := range sortedKeys(nodes) {
+		node := nodes[id]
+		colors, ok := nodeColors[id]
+		if !ok {
+			colors = diffUnchanged
+		}
+		style := "rounded,filled"
+		if colors == diffRemoved {
+			style += ",dashed"
+		}
+		var extra string
+		if tooltip := tooltips[id]; tooltip != "" {
+			extra = fmt.Sprintf(", tooltip=\"%s\"", e.escapeLabel(tooltip))
+		}
+		buf.WriteString(fmt.Sprintf("  \"%s\" [label=\"%s\", fillcolor=\"%s\", color=\"%s\", style=\"%s\", penwidth=%d%s];\n",
+			id, e.escapeLabel(fmt.Sprintf("%s\n(%s)", node.Name, node.Type)), colors[0], colors[1], style, diffPenWidth(colors), extra))
+	}
+
+	buf.WriteString("\n")
+
+	for _, id := range sortedKeys(edges) {
+		edge := edges[id]
+		colors, ok := edgeColors[id]
+		if !ok {
+			colors = diffUnchanged
+		}
+		style := "solid"
+		if colors == diffRemoved {
+			style = "dashed"
+		}
+		buf.WriteString(fmt.Sprintf("  \"%s\" -> \"%s\" [label=\"%s\", color=\"%s\", fontcolor=\"%s\", style=\"%s\", penwidth=%d];\n",
+			edge.FromNodeID, edge.ToNodeID, edge.Type, colors[1], colors[1], style, diffPenWidth(colors)))
+	}
+
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+func diffPenWidth(colors [2]string) int {
+	if colors == diffUnchanged {
+		return 1
+	}
+	return 2
+}
+
+// diffTooltip lists changed fields, one per line
+func diffTooltip(changes []graph.FieldChange) string {
+	lines := make([]string, 0, len(changes))
+	for _, change := range changes {
+		lines = append(lines, fmt.Sprintf("%s: %s → %s", change.Field, diffValue(change.Old), diffValue(change.New)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func diffValue(value interface{}) string {
+	if value == nil {
+		return "(none)"
+	}
+	return fmt.Sprint(value)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,40 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExporter_ExportDiffTo(t *testing.T) {
+	exporter := NewExporter()
+	defer exporter.Close()
+
+	from := createTestGraph()
+	to := createTestGraph()
+	to.Nodes["resource1"].Name = "Primary Database"
+	delete(to.Edges, "e1")
+	delete(to.Nodes, "spec1")
+	require.NoError(t, to.AddNode(&graph.Node{ID: "resource2", Type: graph.NodeTypeResource, Name: "Cache"}))
+	require.NoError(t, to.AddEdge(&graph.Edge{ID: "e3", FromNodeID: "workflow1", ToNodeID: "resource2", Type: graph.EdgeTypeProvisions}))
+
+	var buf bytes.Buffer
+	require.NoError(t, exporter.ExportDiffTo(&buf, from, to, graph.Diff(from, to), FormatDOT))
+	dot := buf.String()
+
+	assert.Contains(t, dot, `digraph "test-app"`)
+	assert.Contains(t, dot, `"resource2" [label="Cache\n(resource)", fillcolor="#d4edda", color="#28a745"`)
+	assert.Contains(t, dot, `"spec1" [label="Database Spec\n(spec)", fillcolor="#f8d7da", color="#dc3545", style="rounded,filled,dashed"`)
+	assert.Contains(t, dot, `"resource1" [label="Primary Database\n(resource)", fillcolor="#fff3cd"`)
+	assert.Contains(t, dot, `tooltip="name: Database → Primary Database"`)
+	assert.Contains(t, dot, `"workflow1" [label="Deploy Database\n(workflow)", fillcolor="#f8f9fa"`)
+	assert.Contains(t, dot, `"workflow1" -> "spec1" [label="depends-on", color="#dc3545", fontcolor="#dc3545", style="dashed"`)
+	assert.Contains(t, dot, `"workflow1" -> "resource2" [label="provisions", color="#28a745"`)
+
+	err := exporter.ExportDiffTo(&buf, from, to, graph.Diff(from, to), FormatMermaid)
+	assert.ErrorContains(t, err, "unsupported diff format")
+}
@@ -1,12 +1,16 @@
 package export
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"strings"
+	"time"
 
 	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/layout"
 
 	"github.com/goccy/go-graphviz"
 )
@@ -14,13 +18,30 @@ import (
 type Format string
 
 const (
-	FormatDOT Format = "dot"
-	FormatSVG Format = "svg"
-	FormatPNG Format = "png"
+	FormatDOT       Format = "dot"
+	FormatSVG       Format = "svg"
+	FormatSVGNative Format = "svg-native" // SVG drawn without Graphviz
+	FormatPNG       Format = "png"
+	FormatPDF       Format = "pdf" // Rendered as PNG and placed on PDF pages
+	FormatMermaid   Format = "mermaid"
+	FormatGantt     Format = "mermaid-gantt"
+	FormatJSON      Format = "json"
+	FormatGraphML   Format = "graphml"
+	FormatCytoscape Format = "cytoscape"
+	FormatD3        Format = "d3"
+	FormatGrafana   Format = "grafana" // Node Graph panel data frames
+	FormatPlantUML  Format = "plantuml"
+	FormatD2        Format = "d2"
+	FormatDrawIO    Format = "drawio"
+	FormatCSV       Format = "csv" // Zip archive with nodes.csv and edges.csv
+	FormatTSV       Format = "tsv" // Zip archive with nodes.tsv and edges.tsv
+	FormatHTML      Format = "html"
+	FormatBackstage Format = "backstage" // catalog-info YAML
 )
 
 type Exporter struct {
 	graphviz *graphviz.Graphviz
+	layouts  *layout.LayoutCache
 }
 
 func NewExporter() *Exporter {
@@ -30,101 +51,375 @@ func NewExporter() *Exporter {
 	}
 }
 
+// SetLayoutCache makes exports through ExportGraphTo that place nodes with
+// pkg/layout reuse layouts from cache, unless their options set their own
+func (e *Exporter) SetLayoutCache(cache *layout.LayoutCache) {
+	e.layouts = cache
+}
+
 func (e *Exporter) Close() error {
+	if e.graphviz == nil {
+		return nil
+	}
 	return e.graphviz.Close()
 }
 
+// ExportGraph exports a graph in the given format with default options
 func (e *Exporter) ExportGraph(g *graph.Graph, format Format) ([]byte, error) {
-	dotContent, err := e.generateDOT(g)
+	return e.ExportGraphWithOptions(g, format, Options{})
+}
+
+// ExportGraphWithOptions exports a graph in the given format
+func (e *Exporter) ExportGraphWithOptions(g *graph.Graph, format Format, opts Options) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := e.ExportGraphTo(&buf, g, format, opts); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ExportGraphTo writes a graph in the given format to w. DOT, SVG, PNG and
+// PDF output is written while it is generated instead of being collected in
+// memory first; other formats are encoded in memory and then written. When
+// an error is returned, part of the output may already have been written.
+func (e *Exporter) ExportGraphTo(w io.Writer, g *graph.Graph, format Format, opts Options) error {
+	g, err := opts.Filter.Apply(g)
+	if err != nil {
+		return err
+	}
+	if g, err = opts.Reduce.Apply(g); err != nil {
+		return err
+	}
+	if opts.DOT.Theme == nil {
+		opts.DOT.Theme = opts.Theme
+	}
+	if opts.Mermaid.Theme == nil {
+		opts.Mermaid.Theme = opts.Theme
+	}
+	if opts.SVG.Theme == nil {
+		opts.SVG.Theme = opts.Theme
+	}
+	for _, cache := range []**layout.LayoutCache{&opts.SVG.LayoutCache, &opts.DrawIO.LayoutCache, &opts.HTML.LayoutCache, &opts.Cytoscape.LayoutCache, &opts.D3.LayoutCache} {
+		if *cache == nil {
+			*cache = e.layouts
+		}
+	}
+	if opts.Stamp != nil {
+		for _, stamp := range []**Stamp{&opts.DOT.Stamp, &opts.SVG.Stamp, &opts.Mermaid.Stamp, &opts.PlantUML.Stamp, &opts.D2.Stamp, &opts.HTML.Stamp} {
+			if *stamp == nil {
+				*stamp = opts.Stamp
+			}
+		}
+	}
+	// Without Graphviz, SVG is drawn natively
+	if format == FormatSVG && e.graphviz == nil {
+		format = FormatSVGNative
+	}
+
+	var data []byte
+	switch format {
+	case FormatDOT:
+		dotOpts, err := opts.DOT.resolved()
+		if err != nil {
+			return err
+		}
+		bw := bufio.NewWriter(w)
+		e.writeDOT(bw, g, dotOpts)
+		if err := bw.Flush(); err != nil {
+			return fmt.Errorf("failed to write graph: %w", err)
+		}
+		return nil
+	case FormatSVG, FormatPNG, FormatPDF:
+		return e.render(w, g, format, opts)
+	case FormatSVGNative:
+		data, err = ExportGraphSVG(g, opts.SVG)
+	case FormatMermaid:
+		data, err = ExportGraphMermaid(g, opts.Mermaid)
+	case FormatGantt:
+		data, err = ExportGraphGantt(g, opts.Gantt)
+	case FormatPlantUML:
+		data, err = ExportGraphPlantUML(g, opts.PlantUML)
+	case FormatD2:
+		data, err = ExportGraphD2(g, opts.D2)
+	case FormatDrawIO:
+		data, err = ExportGraphDrawIO(g, opts.DrawIO)
+	case FormatHTML:
+		data, err = ExportGraphHTML(g, opts.HTML)
+	case FormatCSV, FormatTSV:
+		csvOpts := opts.CSV
+		csvOpts.TSV = format == FormatTSV
+		var files *CSVFiles
+		if files, err = ExportGraphCSV(g, csvOpts); err == nil {
+			data, err = files.Zip()
+		}
+	case FormatJSON:
+		data, err = ExportGraphJSON(g, opts.JSON)
+	case FormatGraphML:
+		data, err = ExportGraphGraphML(g, opts.GraphML)
+	case FormatCytoscape:
+		data, err = ExportGraphCytoscape(g, opts.Cytoscape)
+	case FormatD3:
+		data, err = ExportGraphD3(g, opts.D3)
+	case FormatGrafana:
+		data, err = ExportGraphGrafana(g, opts.Grafana)
+	case FormatBackstage:
+		data, err = ExportGraphBackstage(g, opts.Backstage)
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate DOT: %w", err)
+		return err
 	}
 
-	if format == FormatDOT {
-		return []byte(dotContent), nil
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write graph: %w", err)
 	}
+	return nil
+}
+
+// render lays out a graph with Graphviz and writes it as SVG, PNG or PDF
+func (e *Exporter) render(w io.Writer, g *graph.Graph, format Format, opts Options) error {
+	if e.graphviz == nil {
+		return fmt.Errorf("graphviz is not available to render %s", format)
+	}
+	dotContent, err := e.generateDOTWithOptions(g, opts.DOT)
+	if err != nil {
+		return fmt.Errorf("failed to generate DOT: %w", err)
+	}
+	return e.renderDOT(w, dotContent, format, opts.PDF)
+}
 
+// renderDOT lays out DOT content with Graphviz and writes it as SVG, PNG or
+// PDF
+func (e *Exporter) renderDOT(w io.Writer, dotContent string, format Format, pdfOpts PDFOptions) error {
+	if e.graphviz == nil {
+		return fmt.Errorf("graphviz is not available to render %s", format)
+	}
 	gvGraph, err := graphviz.ParseBytes([]byte(dotContent))
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse DOT content: %w", err)
+		return fmt.Errorf("failed to parse DOT content: %w", err)
 	}
 	defer gvGraph.Close()
 
-	var buf bytes.Buffer
 	ctx := context.Background()
 	switch format {
+	case FormatPDF:
+		img, err := e.graphviz.RenderImage(ctx, gvGraph)
+		if err != nil {
+			return fmt.Errorf("failed to render graph: %w", err)
+		}
+		return writePDF(w, img, pdfOpts)
 	case FormatSVG:
-		err = e.graphviz.Render(ctx, gvGraph, graphviz.SVG, &buf)
+		err = e.graphviz.Render(ctx, gvGraph, graphviz.SVG, w)
 	case FormatPNG:
-		err = e.graphviz.Render(ctx, gvGraph, graphviz.PNG, &buf)
+		err = e.graphviz.Render(ctx, gvGraph, graphviz.PNG, w)
 	default:
-		return nil, fmt.Errorf("unsupported format: %s", format)
+		return fmt.Errorf("unsupported format: %s", format)
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to render graph: %w", err)
+		return fmt.Errorf("failed to render graph: %w", err)
 	}
-
-	return buf.Bytes(), nil
+	return nil
 }
 
 func (e *Exporter) generateDOT(g *graph.Graph) (string, error) {
+	return e.generateDOTWithOptions(g, DOTExportOptions{})
+}
+
+func (e *Exporter) generateDOTWithOptions(g *graph.Graph, opts DOTExportOptions) (string, error) {
+	opts, err := opts.resolved()
+	if err != nil {
+		return "", err
+	}
 	var buf strings.Builder
+	e.writeDOT(&buf, g, opts)
+	return buf.String(), nil
+}
+
+// dotWriter is implemented by strings.Builder and bufio.Writer, which keep
+// write errors until the output is collected or flushed
+type dotWriter interface {
+	io.Writer
+	io.StringWriter
+}
+
+// writeDOT writes a graph in DOT format. The theme of opts must be resolved.
+func (e *Exporter) writeDOT(buf dotWriter, g *graph.Graph, opts DOTExportOptions) {
+	theme := opts.Theme
 
 	buf.WriteString(fmt.Sprintf("digraph \"%s\" {\n", g.AppName))
 	buf.WriteString("  rankdir=TB;\n")
-	buf.WriteString("  node [shape=box, style=rounded];\n")
-	buf.WriteString("  edge [fontsize=10];\n\n")
+	if opts.Stamp != nil {
+		buf.WriteString(fmt.Sprintf("  label=\"%s\";\n  labelloc=b;\n  labeljust=r;\n  fontsize=10;\n", e.escapeLabel(opts.Stamp.text(g))))
+	}
+	if theme.Background != "" {
+		buf.WriteString(fmt.Sprintf("  bgcolor=\"%s\";\n", theme.Background))
+	}
+	if theme.FontName != "" {
+		buf.WriteString(fmt.Sprintf("  fontname=\"%s\";\n", theme.FontName))
+	}
+	if theme.FontColor != "" {
+		buf.WriteString(fmt.Sprintf("  fontcolor=\"%s\";\n", theme.FontColor))
+	}
+	buf.WriteString("  node [shape=box, style=rounded" + dotFontAttributes(theme, true) + "];\n")
+	buf.WriteString("  edge [fontsize=10" + dotFontAttributes(theme, false) + "];\n\n")
 
-	for _, node := range g.Nodes {
-		nodeColor := e.getNodeColor(node.Type)
-		nodeStyle := e.getNodeStyle(node)
-		nodeBorderColor := e.getNodeBorderColor(node.State)
+	var clusters map[string][]*graph.Node
+	var parents map[string]string
+	if opts.Clusters {
+		clusters, parents = containmentClusters(g)
+	}
 
-		// Include state in label
-		stateLabel := ""
-		if node.State != "" && node.State != graph.NodeStateWaiting {
-			stateLabel = fmt.Sprintf("\\n[%s]", node.State)
+	for _, node := range sortedNodes(g) {
+		if opts.Clusters {
+			if _, contained := parents[node.ID]; contained {
+				continue
+			}
+			if _, isCluster := clusters[node.ID]; isCluster {
+				e.writeCluster(buf, node, clusters, opts, "  ")
+				continue
+			}
 		}
-		nodeLabel := e.escapeLabel(fmt.Sprintf("%s\\n(%s)%s", node.Name, node.Type, stateLabel))
-
-		buf.WriteString(fmt.Sprintf("  \"%s\" [label=\"%s\", fillcolor=\"%s\", color=\"%s\", style=\"%s\"];\n",
-			node.ID, nodeLabel, nodeColor, nodeBorderColor, nodeStyle))
+		e.writeNode(buf, node, opts, "  ")
 	}
 
 	buf.WriteString("\n")
 
-	for _, edge := range g.Edges {
+	for _, edge := range sortedEdges(g) {
+		if opts.Clusters && edge.Type == graph.EdgeTypeContains && parents[edge.ToNodeID] == edge.FromNodeID {
+			continue // Drawn as a cluster
+		}
+
 		edgeLabel := string(edge.Type)
 		if edge.Description != "" {
 			edgeLabel = fmt.Sprintf("%s\\n%s", edgeLabel, e.escapeLabel(edge.Description))
 		}
 
-		edgeColor := e.getEdgeColor(edge.Type)
-		edgeStyle := e.getEdgeStyle(edge.Type)
+		edgeColor := theme.EdgeColor(edge.Type)
+		edgeStyle := theme.EdgeStyle(edge.Type)
 
 		buf.WriteString(fmt.Sprintf("  \"%s\" -> \"%s\" [label=\"%s\", color=\"%s\", style=\"%s\"];\n",
 			edge.FromNodeID, edge.ToNodeID, edgeLabel, edgeColor, edgeStyle))
 	}
 
+	if opts.Legend {
+		e.writeLegend(buf, opts)
+	}
+
 	buf.WriteString("}\n")
+}
 
-	return buf.String(), nil
+func (e *Exporter) writeNode(buf dotWriter, node *graph.Node, opts DOTExportOptions, indent string) {
+	nodeColor := opts.Theme.NodeFill(node.Type)
+	if opts.StateFill {
+		nodeColor = opts.Theme.StateFill(node.State)
+	}
+	nodeStyle := e.getNodeStyle(node)
+	nodeBorderColor := opts.Theme.StateBorder(node.State)
+	nodeLabel := e.escapeLabel(e.nodeLabel(node, opts))
+
+	var extra string
+	if s := opts.Theme.NodeShape(node.Type); s != "" {
+		extra += fmt.Sprintf(", shape=\"%s\"", dotShape(s))
+	}
+	if u := nodeURL(node); u != "" {
+		extra += fmt.Sprintf(", URL=\"%s\", target=\"_blank\"", u)
+	}
+
+	buf.WriteString(fmt.Sprintf("%s\"%s\" [label=\"%s\", fillcolor=\"%s\", color=\"%s\", style=\"%s\"%s];\n",
+		indent, node.ID, nodeLabel, nodeColor, nodeBorderColor, nodeStyle, extra))
 }
 
-func (e *Exporter) getNodeColor(nodeType graph.NodeType) string {
-	switch nodeType {
-	case graph.NodeTypeSpec:
-		return "#E3F2FD" // Light blue
-	case graph.NodeTypeWorkflow:
-		return "#FFF9C4" // Light yellow
-	case graph.NodeTypeStep:
-		return "#FFE0B2" // Light orange
-	case graph.NodeTypeResource:
-		return "#C8E6C9" // Light green
-	default:
-		return "#F5F5F5" // Light gray
+// writeCluster draws a container node and the nodes it contains inside a
+// box labeled with the container's name. The container node stays in the
+// box so edges from and to it are kept.
+func (e *Exporter) writeCluster(buf dotWriter, node *graph.Node, clusters map[string][]*graph.Node, opts DOTExportOptions, indent string) {
+	buf.WriteString(fmt.Sprintf("%ssubgraph \"cluster_%s\" {\n", indent, node.ID))
+	buf.WriteString(fmt.Sprintf("%s  label=\"%s\";\n", indent, e.escapeLabel(node.Name)))
+	buf.WriteString(fmt.Sprintf("%s  style=\"rounded,dashed\";\n", indent))
+	buf.WriteString(fmt.Sprintf("%s  color=\"%s\";\n", indent, opts.Theme.EdgeColor(graph.EdgeTypeContains)))
+
+	e.writeNode(buf, node, opts, indent+"  ")
+	for _, child := range clusters[node.ID] {
+		if _, isCluster := clusters[child.ID]; isCluster {
+			e.writeCluster(buf, child, clusters, opts, indent+"  ")
+		} else {
+			e.writeNode(buf, child, opts, indent+"  ")
+		}
+	}
+
+	buf.WriteString(indent + "}\n")
+}
+
+// nodeLabel returns the unescaped label of a node: its name and type, its
+// state unless waiting, and optionally its duration
+func (e *Exporter) nodeLabel(node *graph.Node, opts DOTExportOptions) string {
+	label := fmt.Sprintf("%s\\n(%s)", node.Name, node.Type)
+	if node.State != "" && node.State != graph.NodeStateWaiting {
+		if opts.Badges {
+			label += fmt.Sprintf("\\n%s %s", stateBadge(node.State), node.State)
+		} else {
+			label += fmt.Sprintf("\\n[%s]", node.State)
+		}
+	}
+	if opts.Durations {
+		if duration, ok := nodeDuration(node, time.Now()); ok {
+			label += "\\n" + formatDuration(duration)
+		}
+	}
+	return label
+}
+
+// writeLegend adds a cluster explaining node colors and state borders
+func (e *Exporter) writeLegend(buf dotWriter, opts DOTExportOptions) {
+	buf.WriteString("\n  subgraph cluster_legend {\n")
+	buf.WriteString("    label=\"Legend\";\n")
+	buf.WriteString("    style=dashed;\n")
+	buf.WriteString("    fontsize=10;\n")
+	buf.WriteString("    node [fontsize=9];\n")
+
+	var previous string
+	link := func(id string) {
+		if previous != "" {
+			buf.WriteString(fmt.Sprintf("    \"%s\" -> \"%s\" [style=invis];\n", previous, id))
+		}
+		previous = id
+	}
+
+	if !opts.StateFill {
+		for _, nodeType := range legendNodeTypes {
+			id := "__legend_type_" + string(nodeType)
+			buf.WriteString(fmt.Sprintf("    \"%s\" [label=\"%s\", fillcolor=\"%s\", style=\"filled,rounded\"];\n",
+				id, nodeType, opts.Theme.NodeFill(nodeType)))
+			link(id)
+		}
+	}
+
+	for _, state := range legendNodeStates {
+		id := "__legend_state_" + string(state)
+		fillColor := "white"
+		if opts.Theme.Background != "" {
+			fillColor = opts.Theme.Background
+		}
+		if opts.StateFill {
+			fillColor = opts.Theme.StateFill(state)
+		}
+		label := string(state)
+		if opts.Badges {
+			label = fmt.Sprintf("%s %s", stateBadge(state), state)
+		}
+		node := &graph.Node{State: state}
+		buf.WriteString(fmt.Sprintf("    \"%s\" [label=\"%s\", fillcolor=\"%s\", color=\"%s\", style=\"%s\"];\n",
+			id, label, fillColor, opts.Theme.StateBorder(state), e.getNodeStyle(node)))
+		link(id)
 	}
+
+	buf.WriteString("  }\n")
+}
+
+func (e *Exporter) getNodeColor(nodeType graph.NodeType) string {
+	return defaultTheme.NodeFill(nodeType)
 }
 
 func (e *Exporter) getNodeStyle(node *graph.Node) string {
@@ -137,60 +432,23 @@ func (e *Exporter) getNodeStyle(node *graph.Node) string {
 		style += ",bold" // Bold red border
 	case graph.NodeStateRunning:
 		style += ",bold" // Bold border for running
+	case graph.NodeStatePending:
+		style += ",dashed" // Dashed border for nodes ready to run
 	}
 
 	return style
 }
 
 func (e *Exporter) getNodeBorderColor(state graph.NodeState) string {
-	switch state {
-	case graph.NodeStateFailed:
-		return "red"
-	case graph.NodeStateRunning:
-		return "#1976D2" // Blue for running
-	case graph.NodeStateSucceeded:
-		return "#388E3C" // Green for succeeded
-	default:
-		return "black"
-	}
+	return defaultTheme.StateBorder(state)
 }
 
 func (e *Exporter) getEdgeColor(edgeType graph.EdgeType) string {
-	switch edgeType {
-	case graph.EdgeTypeDependsOn:
-		return "#1976D2" // Blue
-	case graph.EdgeTypeProvisions:
-		return "#388E3C" // Green
-	case graph.EdgeTypeCreates:
-		return "#F57C00" // Orange
-	case graph.EdgeTypeBindsTo:
-		return "#7B1FA2" // Purple
-	case graph.EdgeTypeContains:
-		return "#FBC02D" // Yellow (workflow → step)
-	case graph.EdgeTypeConfigures:
-		return "#E64A19" // Deep Orange (step → resource)
-	default:
-		return "#757575" // Gray
-	}
+	return defaultTheme.EdgeColor(edgeType)
 }
 
 func (e *Exporter) getEdgeStyle(edgeType graph.EdgeType) string {
-	switch edgeType {
-	case graph.EdgeTypeDependsOn:
-		return "solid"
-	case graph.EdgeTypeProvisions:
-		return "bold"
-	case graph.EdgeTypeCreates:
-		return "dashed"
-	case graph.EdgeTypeBindsTo:
-		return "dotted"
-	case graph.EdgeTypeContains:
-		return "bold" // Workflow contains steps (bold line)
-	case graph.EdgeTypeConfigures:
-		return "dashed" // Step configures resource (dashed line)
-	default:
-		return "solid"
-	}
+	return defaultTheme.EdgeStyle(edgeType)
 }
 
 func (e *Exporter) escapeLabel(label string) string {
@@ -199,29 +457,46 @@ func (e *Exporter) escapeLabel(label string) string {
 	return label
 }
 
+// SubgraphOptions configures CreateSubgraphWithOptions
+type SubgraphOptions struct {
+	// WithDependencies adds everything the selected nodes reach over outgoing
+	// edges: dependencies, contained steps and provisioned resources
+	WithDependencies bool `json:"with_dependencies"`
+	// WithChildren adds the steps contained by selected workflows
+	WithChildren bool `json:"with_children"`
+}
+
+// CreateSubgraph creates a subgraph containing only specified nodes
 func (e *Exporter) CreateSubgraph(g *graph.Graph, nodeIDs []string) (*graph.Graph, error) {
-	subgraph := graph.NewGraph(g.AppName + "-subgraph")
+	return e.CreateSubgraphWithOptions(g, nodeIDs, SubgraphOptions{})
+}
 
-	nodeMap := make(map[string]bool)
-	for _, id := range nodeIDs {
-		nodeMap[id] = true
+// CreateSubgraphWithOptions creates a subgraph of the specified nodes and the
+// edges between them. Nodes and edges are copies, so the source graph and
+// its timestamps are left untouched. Unknown node IDs are ignored.
+func (e *Exporter) CreateSubgraphWithOptions(g *graph.Graph, nodeIDs []string, opts SubgraphOptions) (*graph.Graph, error) {
+	if opts.WithDependencies {
+		nodeIDs = g.Closure(nodeIDs)
 	}
-
-	for _, nodeID := range nodeIDs {
-		if node, exists := g.GetNode(nodeID); exists {
-			if err := subgraph.AddNode(node); err != nil {
-				return nil, fmt.Errorf("failed to add node %s to subgraph: %w", nodeID, err)
-			}
-		}
+	if opts.WithChildren {
+		nodeIDs = withContained(g, nodeIDs)
 	}
 
-	for _, edge := range g.Edges {
-		if nodeMap[edge.FromNodeID] && nodeMap[edge.ToNodeID] {
-			if err := subgraph.AddEdge(edge); err != nil {
-				return nil, fmt.Errorf("failed to add edge %s to subgraph: %w", edge.ID, err)
+	subgraph := g.Subgraph(nodeIDs)
+	subgraph.AppName = g.AppName + "-subgraph"
+	return subgraph, nil
+}
+
+// withContained returns the given node IDs followed by the nodes they
+// contain, e.g. the steps of a workflow
+func withContained(g *graph.Graph, nodeIDs []string) []string {
+	result := append([]string(nil), nodeIDs...)
+	for _, id := range nodeIDs {
+		for _, edge := range g.OutgoingEdges(id) {
+			if edge.Type == graph.EdgeTypeContains {
+				result = append(result, edge.ToNodeID)
 			}
 		}
 	}
-
-	return subgraph, nil
+	return result
 }
@@ -0,0 +1,182 @@
+package export
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// DOTExportOptions configures DOT, SVG, PNG and PDF export
+type DOTExportOptions struct {
+	// StateFill fills nodes by state instead of by type
+	StateFill bool `json:"state_fill"`
+	// Badges shows a state symbol next to the state in node labels
+	Badges bool `json:"badges"`
+	// Durations adds the duration of finished nodes and the elapsed time of
+	// running nodes to node labels
+	Durations bool `json:"durations"`
+	// Legend adds a box explaining colors and state borders
+	Legend bool `json:"legend"`
+	// Clusters draws the nodes a node contains (usually the steps of a
+	// workflow) inside a box instead of connecting them with contains edges
+	Clusters bool `json:"clusters"`
+	// Theme sets colors, shapes and fonts; nil uses Options.Theme when
+	// exporting through an Exporter, and LightTheme otherwise
+	Theme *Theme `json:"theme,omitempty"`
+	// Stamp adds a footer with version, export time and run; nil uses
+	// Options.Stamp when exporting through an Exporter
+	Stamp *Stamp `json:"stamp,omitempty"`
+}
+
+// resolved returns opts with its theme resolved against the built-in themes
+func (o DOTExportOptions) resolved() (DOTExportOptions, error) {
+	theme, err := ResolveTheme(o.Theme)
+	if err != nil {
+		return o, err
+	}
+	o.Theme = &theme
+	return o, nil
+}
+
+// dotFontAttributes returns the node or edge attributes setting the theme's
+// font. Edge labels keep their smaller default size.
+func dotFontAttributes(theme *Theme, withSize bool) string {
+	var attrs string
+	if theme.FontName != "" {
+		attrs += fmt.Sprintf(", fontname=\"%s\"", theme.FontName)
+	}
+	if withSize && theme.FontSize > 0 {
+		attrs += fmt.Sprintf(", fontsize=%g", theme.FontSize)
+	}
+	if theme.FontColor != "" {
+		attrs += fmt.Sprintf(", fontcolor=\"%s\"", theme.FontColor)
+	}
+	return attrs
+}
+
+// dotShape maps a node shape to the closest Graphviz shape
+func dotShape(shape NodeShape) string {
+	switch shape {
+	case ShapeStadium:
+		return "oval"
+	case ShapeSubroutine:
+		return "box3d"
+	case ShapeCylinder, ShapeEllipse, ShapeHexagon, ShapeDiamond:
+		return string(shape)
+	default:
+		return "box"
+	}
+}
+
+var legendNodeTypes = []graph.NodeType{
+	graph.NodeTypeSpec,
+	graph.NodeTypeWorkflow,
+	graph.NodeTypeStep,
+	graph.NodeTypeResource,
+}
+
+var legendNodeStates = []graph.NodeState{
+	graph.NodeStateWaiting,
+	graph.NodeStatePending,
+	graph.NodeStateRunning,
+	graph.NodeStateSucceeded,
+	graph.NodeStateFailed,
+}
+
+// containmentClusters maps container node IDs to the nodes they contain,
+// sorted by ID, and contained node IDs to their container. A node contained
+// by several nodes is drawn in the first container by ID; contains edges
+// that would close a cycle are ignored.
+func containmentClusters(g *graph.Graph) (map[string][]*graph.Node, map[string]string) {
+	clusters := make(map[string][]*graph.Node)
+	parents := make(map[string]string)
+
+	for _, edge := range sortedEdges(g) {
+		if edge.Type != graph.EdgeTypeContains || edge.FromNodeID == edge.ToNodeID {
+			continue
+		}
+		child, ok := g.Nodes[edge.ToNodeID]
+		if !ok || g.Nodes[edge.FromNodeID] == nil {
+			continue
+		}
+		if existing, contained := parents[child.ID]; contained && existing <= edge.FromNodeID {
+			continue
+		}
+		if containedBy(parents, edge.FromNodeID, child.ID) {
+			continue
+		}
+		if existing, contained := parents[child.ID]; contained {
+			clusters[existing] = removeNode(clusters[existing], child.ID)
+			if len(clusters[existing]) == 0 {
+				delete(clusters, existing)
+			}
+		}
+		parents[child.ID] = edge.FromNodeID
+		clusters[edge.FromNodeID] = append(clusters[edge.FromNodeID], child)
+	}
+
+	for _, children := range clusters {
+		sort.Slice(children, func(i, j int) bool { return children[i].ID < children[j].ID })
+	}
+
+	return clusters, parents
+}
+
+// containedBy reports whether nodeID is ancestor or is nested inside it
+func containedBy(parents map[string]string, nodeID, ancestor string) bool {
+	for id, ok := nodeID, true; ok; id, ok = parents[id] {
+		if id == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+func removeNode(nodes []*graph.Node, id string) []*graph.Node {
+	for i, node := range nodes {
+		if node.ID == id {
+			return append(nodes[:i], nodes[i+1:]...)
+		}
+	}
+	return nodes
+}
+
+func stateBadge(state graph.NodeState) string {
+	switch state {
+	case graph.NodeStatePending:
+		return "⏳"
+	case graph.NodeStateRunning:
+		return "▶"
+	case graph.NodeStateSucceeded:
+		return "✔"
+	case graph.NodeStateFailed:
+		return "✖"
+	default:
+		return "○"
+	}
+}
+
+// nodeDuration returns how long a finished node ran, or how long a running
+// node has been running at now
+func nodeDuration(node *graph.Node, now time.Time) (time.Duration, bool) {
+	switch {
+	case node.Duration > 0:
+		return node.Duration, true
+	case node.StartedAt != nil && node.CompletedAt != nil:
+		return node.CompletedAt.Sub(*node.StartedAt), true
+	case node.StartedAt != nil && node.State == graph.NodeStateRunning:
+		return now.Sub(*node.StartedAt), true
+	default:
+		return 0, false
+	}
+}
+
+// formatDuration rounds to milliseconds below a second and to seconds above
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
@@ -1,7 +1,9 @@
 package export
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/philipsahli/innominatus-graph/pkg/graph"
 
@@ -221,6 +223,74 @@ func TestExporter_CreateSubgraph(t *testing.T) {
 	assert.False(t, exists)
 }
 
+func TestExporter_CreateSubgraph_LeavesSourceUntouched(t *testing.T) {
+	exporter := NewExporter()
+	defer exporter.Close()
+
+	g := createTestGraph()
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	g.Nodes["spec1"].CreatedAt = createdAt
+	g.Nodes["spec1"].UpdatedAt = createdAt
+
+	subgraph, err := exporter.CreateSubgraph(g, []string{"spec1", "workflow1"})
+	require.NoError(t, err)
+
+	assert.Equal(t, createdAt, g.Nodes["spec1"].CreatedAt)
+	assert.Equal(t, createdAt, g.Nodes["spec1"].UpdatedAt)
+	assert.Equal(t, createdAt, subgraph.Nodes["spec1"].CreatedAt)
+	assert.NotSame(t, g.Nodes["spec1"], subgraph.Nodes["spec1"])
+	assert.NotSame(t, g.Edges["e1"], subgraph.Edges["e1"])
+	assert.Equal(t, "test-app-subgraph", subgraph.AppName)
+
+	subgraph.Nodes["spec1"].State = graph.NodeStateFailed
+	assert.NotEqual(t, graph.NodeStateFailed, g.Nodes["spec1"].State)
+}
+
+func TestExporter_CreateSubgraphWithOptions(t *testing.T) {
+	exporter := NewExporter()
+	defer exporter.Close()
+
+	g := createTestGraph()
+	require.NoError(t, g.AddNodes([]*graph.Node{
+		{ID: "step1", Type: graph.NodeTypeStep, Name: "Create"},
+		{ID: "step2", Type: graph.NodeTypeStep, Name: "Migrate"},
+	}))
+	require.NoError(t, g.AddEdges([]*graph.Edge{
+		{ID: "e3", FromNodeID: "workflow1", ToNodeID: "step1", Type: graph.EdgeTypeContains},
+		{ID: "e4", FromNodeID: "workflow1", ToNodeID: "step2", Type: graph.EdgeTypeContains},
+		{ID: "e5", FromNodeID: "step1", ToNodeID: "step2", Type: graph.EdgeTypeDependsOn},
+	}))
+
+	tests := []struct {
+		name  string
+		opts  SubgraphOptions
+		nodes []string
+		edges []string
+	}{
+		{"none", SubgraphOptions{}, []string{"workflow1"}, []string{}},
+		{"children", SubgraphOptions{WithChildren: true}, []string{"step1", "step2", "workflow1"}, []string{"e3", "e4", "e5"}},
+		{"dependencies", SubgraphOptions{WithDependencies: true}, []string{"resource1", "spec1", "step1", "step2", "workflow1"}, []string{"e1", "e2", "e3", "e4", "e5"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			subgraph, err := exporter.CreateSubgraphWithOptions(g, []string{"workflow1"}, test.opts)
+			require.NoError(t, err)
+
+			nodes := make([]string, 0, len(subgraph.Nodes))
+			for id := range subgraph.Nodes {
+				nodes = append(nodes, id)
+			}
+			edges := make([]string, 0, len(subgraph.Edges))
+			for id := range subgraph.Edges {
+				edges = append(edges, id)
+			}
+			assert.ElementsMatch(t, test.nodes, nodes)
+			assert.ElementsMatch(t, test.edges, edges)
+		})
+	}
+}
+
 func TestExporter_CreateSubgraph_EmptyNodeList(t *testing.T) {
 	exporter := NewExporter()
 	defer exporter.Close()
@@ -251,3 +321,119 @@ func TestExporter_CreateSubgraph_NonExistentNode(t *testing.T) {
 	_, exists = subgraph.GetNode("missing")
 	assert.False(t, exists)
 }
+
+func TestExporter_generateDOT_StateOptions(t *testing.T) {
+	exporter := NewExporter()
+	defer exporter.Close()
+
+	g := createTestGraph()
+	started := time.Now().Add(-90 * time.Second)
+	completed := started.Add(1500 * time.Millisecond)
+	g.Nodes["workflow1"].State = graph.NodeStateFailed
+	g.Nodes["workflow1"].StartedAt = &started
+	g.Nodes["workflow1"].CompletedAt = &completed
+	g.Nodes["resource1"].State = graph.NodeStatePending
+
+	dotContent, err := exporter.generateDOTWithOptions(g, DOTExportOptions{
+		StateFill: true,
+		Badges:    true,
+		Durations: true,
+		Legend:    true,
+	})
+	require.NoError(t, err)
+
+	assert.Contains(t, dotContent, `"workflow1" [label="Deploy Database\n(workflow)\n✖ failed\n2s", fillcolor="#FFCDD2", color="red", style="filled,rounded,bold"]`)
+	assert.Contains(t, dotContent, `"resource1" [label="Database\n(resource)\n⏳ pending", fillcolor="#FFF8E1", color="black", style="filled,rounded,dashed"]`)
+	assert.Contains(t, dotContent, `subgraph cluster_legend`)
+	assert.Contains(t, dotContent, `"__legend_state_succeeded"`)
+	assert.NotContains(t, dotContent, `"__legend_type_spec"`)
+
+	plain, err := exporter.generateDOT(g)
+	require.NoError(t, err)
+	assert.Contains(t, plain, `"workflow1" [label="Deploy Database\n(workflow)\n[failed]", fillcolor="#FFF9C4"`)
+	assert.NotContains(t, plain, "cluster_legend")
+}
+
+func TestNodeDuration(t *testing.T) {
+	now := time.Now()
+	started := now.Add(-time.Minute)
+
+	_, ok := nodeDuration(&graph.Node{State: graph.NodeStateWaiting}, now)
+	assert.False(t, ok)
+
+	d, ok := nodeDuration(&graph.Node{State: graph.NodeStateRunning, StartedAt: &started}, now)
+	require.True(t, ok)
+	assert.Equal(t, time.Minute, d)
+
+	d, ok = nodeDuration(&graph.Node{State: graph.NodeStateSucceeded, Duration: 250 * time.Millisecond}, now)
+	require.True(t, ok)
+	assert.Equal(t, "250ms", formatDuration(d))
+	assert.Equal(t, "1m2s", formatDuration(62400*time.Millisecond))
+}
+
+func TestExporter_generateDOT_Clusters(t *testing.T) {
+	exporter := NewExporter()
+	defer exporter.Close()
+
+	g := graph.NewGraph("clustered")
+	for _, node := range []*graph.Node{
+		{ID: "spec", Type: graph.NodeTypeSpec, Name: "Spec"},
+		{ID: "wf", Type: graph.NodeTypeWorkflow, Name: "Deploy"},
+		{ID: "step1", Type: graph.NodeTypeStep, Name: "Build"},
+		{ID: "step2", Type: graph.NodeTypeStep, Name: "Push"},
+		{ID: "db", Type: graph.NodeTypeResource, Name: "Database"},
+	} {
+		require.NoError(t, g.AddNode(node))
+	}
+	for _, edge := range []*graph.Edge{
+		{ID: "e1", FromNodeID: "spec", ToNodeID: "wf", Type: graph.EdgeTypeDependsOn},
+		{ID: "e2", FromNodeID: "wf", ToNodeID: "step1", Type: graph.EdgeTypeContains},
+		{ID: "e3", FromNodeID: "wf", ToNodeID: "step2", Type: graph.EdgeTypeContains},
+		{ID: "e4", FromNodeID: "step2", ToNodeID: "db", Type: graph.EdgeTypeConfigures},
+	} {
+		require.NoError(t, g.AddEdge(edge))
+	}
+
+	dotContent, err := exporter.generateDOTWithOptions(g, DOTExportOptions{Clusters: true})
+	require.NoError(t, err)
+
+	assert.Contains(t, dotContent, `subgraph "cluster_wf" {`)
+	assert.Contains(t, dotContent, `label="Deploy";`)
+	assert.Contains(t, dotContent, `    "step1" [label="Build\n(step)"`)
+	assert.Contains(t, dotContent, `    "step2" [label="Push\n(step)"`)
+	assert.Contains(t, dotContent, `  "db" [label="Database\n(resource)"`)
+	assert.NotContains(t, dotContent, `"wf" -> "step1"`)
+	assert.Contains(t, dotContent, `"spec" -> "wf"`)
+	assert.Contains(t, dotContent, `"step2" -> "db"`)
+	assert.Equal(t, 1, strings.Count(dotContent, `"step1" [`))
+
+	plain, err := exporter.generateDOT(g)
+	require.NoError(t, err)
+	assert.NotContains(t, plain, "cluster_wf")
+	assert.Contains(t, plain, `"wf" -> "step1"`)
+}
+
+func TestContainmentClusters(t *testing.T) {
+	g := graph.NewGraph("nested")
+	for _, id := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, g.AddNode(&graph.Node{ID: id, Type: graph.NodeTypeWorkflow, Name: id}))
+	}
+	for _, edge := range []*graph.Edge{
+		{ID: "e1", FromNodeID: "b", ToNodeID: "c", Type: graph.EdgeTypeContains},
+		{ID: "e2", FromNodeID: "a", ToNodeID: "b", Type: graph.EdgeTypeContains},
+		{ID: "e3", FromNodeID: "d", ToNodeID: "c", Type: graph.EdgeTypeContains},
+		{ID: "e4", FromNodeID: "c", ToNodeID: "a", Type: graph.EdgeTypeContains},
+	} {
+		g.Edges[edge.ID] = edge
+	}
+
+	clusters, parents := containmentClusters(g)
+
+	// c is drawn in b, the first container by ID; c -> a would close a cycle
+	assert.Equal(t, map[string]string{"b": "a", "c": "b"}, parents)
+	require.Len(t, clusters["a"], 1)
+	assert.Equal(t, "b", clusters["a"][0].ID)
+	require.Len(t, clusters["b"], 1)
+	assert.Equal(t, "c", clusters["b"][0].ID)
+	assert.NotContains(t, clusters, "d")
+}
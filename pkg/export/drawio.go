@@ -0,0 +1,203 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/layout"
+)
+
+// DrawIOOptions configures draw.io export
+type DrawIOOptions struct {
+	// Layout configures the node positions; the hierarchical layout is used
+	// by default
+	Layout layout.LayoutOptions `json:"layout"`
+	// LayoutCache reuses layouts of graphs with an unchanged structure; nil
+	// uses the Exporter's cache when exporting through an Exporter
+	LayoutCache *layout.LayoutCache `json:"-"`
+}
+
+// drawIOMargin is the space between the page border and the diagram
+const drawIOMargin = 20
+
+type drawIOFile struct {
+	XMLName xml.Name      `xml:"mxfile"`
+	Host    string        `xml:"host,attr"`
+	Diagram drawIODiagram `xml:"diagram"`
+}
+
+type drawIODiagram struct {
+	ID    string      `xml:"id,attr"`
+	Name  string      `xml:"name,attr"`
+	Model drawIOModel `xml:"mxGraphModel"`
+}
+
+type drawIOModel struct {
+	Grid       int          `xml:"grid,attr"`
+	PageWidth  int          `xml:"pageWidth,attr"`
+	PageHeight int          `xml:"pageHeight,attr"`
+	Cells      []drawIOCell `xml:"root>mxCell"`
+}
+
+type drawIOCell struct {
+	ID       string          `xml:"id,attr"`
+	Value    string          `xml:"value,attr,omitempty"`
+	Style    string          `xml:"style,attr,omitempty"`
+	Vertex   string          `xml:"vertex,attr,omitempty"`
+	Edge     string          `xml:"edge,attr,omitempty"`
+	Parent   string          `xml:"parent,attr,omitempty"`
+	Source   string          `xml:"source,attr,omitempty"`
+	Target   string          `xml:"target,attr,omitempty"`
+	Geometry *drawIOGeometry `xml:"mxGeometry,omitempty"`
+}
+
+type drawIOGeometry struct {
+	X        string `xml:"x,attr,omitempty"`
+	Y        string `xml:"y,attr,omitempty"`
+	Width    string `xml:"width,attr,omitempty"`
+	Height   string `xml:"height,attr,omitempty"`
+	Relative string `xml:"relative,attr,omitempty"`
+	As       string `xml:"as,attr"`
+}
+
+// ExportGraphDrawIO renders a graph as an uncompressed draw.io (mxGraph) file
+// with node positions from pkg/layout. Shapes, colors and edge styles follow
+// the Mermaid and DOT exports. Cell IDs are the node and edge IDs prefixed
+// with "node-" and "edge-".
+func ExportGraphDrawIO(g *graph.Graph, opts DrawIOOptions) ([]byte, error) {
+	gl, err := opts.LayoutCache.ComputeLayout(g, opts.Layout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute layout: %w", err)
+	}
+
+	cells := []drawIOCell{{ID: "0"}, {ID: "1", Parent: "0"}}
+
+	for _, node := range sortedNodes(g) {
+		position := gl.Nodes[node.ID]
+		label := fmt.Sprintf("%s\n(%s)", node.Name, node.Type)
+		if node.State != "" && node.State != graph.NodeStateWaiting {
+			label += fmt.Sprintf("\n[%s]", node.State)
+		}
+		cells = append(cells, drawIOCell{
+			ID:     "node-" + node.ID,
+			Value:  label,
+			Style:  drawIONodeStyle(node),
+			Vertex: "1",
+			Parent: "1",
+			Geometry: &drawIOGeometry{
+				X:      drawIONumber(position.X - position.Width/2 + drawIOMargin),
+				Y:      drawIONumber(position.Y - position.Height/2 + drawIOMargin),
+				Width:  drawIONumber(position.Width),
+				Height: drawIONumber(position.Height),
+				As:     "geometry",
+			},
+		})
+	}
+
+	for _, edge := range sortedEdges(g) {
+		if _, ok := g.Nodes[edge.FromNodeID]; !ok {
+			return nil, fmt.Errorf("edge %s references unknown node", edge.ID)
+		}
+		if _, ok := g.Nodes[edge.ToNodeID]; !ok {
+			return nil, fmt.Errorf("edge %s references unknown node", edge.ID)
+		}
+		label := string(edge.Type)
+		if edge.Description != "" {
+			label += "\n" + edge.Description
+		}
+		cells = append(cells, drawIOCell{
+			ID:       "edge-" + edge.ID,
+			Value:    label,
+			Style:    drawIOEdgeStyle(edge.Type),
+			Edge:     "1",
+			Parent:   "1",
+			Source:   "node-" + edge.FromNodeID,
+			Target:   "node-" + edge.ToNodeID,
+			Geometry: &drawIOGeometry{Relative: "1", As: "geometry"},
+		})
+	}
+
+	file := drawIOFile{
+		Host: "innominatus-graph",
+		Diagram: drawIODiagram{
+			ID:   g.ID,
+			Name: g.AppName,
+			Model: drawIOModel{
+				Grid:       1,
+				PageWidth:  int(gl.Width) + 2*drawIOMargin,
+				PageHeight: int(gl.Height) + 2*drawIOMargin,
+				Cells:      cells,
+			},
+		},
+	}
+
+	out, err := xml.MarshalIndent(&file, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode graph: %w", err)
+	}
+	return append(out, '\n'), nil
+}
+
+// drawIONodeStyle mirrors the Mermaid shapes (spec stadium, workflow
+// subroutine, step box, resource cylinder) with the DOT colors and borders
+func drawIONodeStyle(node *graph.Node) string {
+	var style []string
+	switch node.Type {
+	case graph.NodeTypeSpec:
+		style = append(style, "rounded=1", "arcSize=50")
+	case graph.NodeTypeWorkflow:
+		style = append(style, "shape=process")
+	case graph.NodeTypeResource:
+		style = append(style, "shape=cylinder3", "boundedLbl=1", "size=10")
+	default:
+		style = append(style, "rounded=1")
+	}
+	style = append(style,
+		"whiteSpace=wrap",
+		"fillColor="+defaultTheme.NodeFill(node.Type),
+		"strokeColor="+drawIOColor(defaultTheme.StateBorder(node.State)),
+	)
+	switch node.State {
+	case graph.NodeStateFailed, graph.NodeStateRunning:
+		style = append(style, "strokeWidth=2")
+	case graph.NodeStatePending:
+		style = append(style, "dashed=1")
+	}
+	return strings.Join(style, ";") + ";"
+}
+
+// drawIOEdgeStyle returns an orthogonal edge with the DOT edge color and
+// style
+func drawIOEdgeStyle(edgeType graph.EdgeType) string {
+	style := []string{"edgeStyle=orthogonalEdgeStyle", "rounded=1", "strokeColor=" + defaultTheme.EdgeColor(edgeType)}
+	switch defaultTheme.EdgeStyle(edgeType) {
+	case "bold":
+		style = append(style, "strokeWidth=2")
+	case "dashed":
+		style = append(style, "dashed=1")
+	case "dotted":
+		style = append(style, "dashed=1", "dashPattern=1 2")
+	}
+	return strings.Join(style, ";") + ";"
+}
+
+// drawIOColor converts the color names used by the DOT export to hex colors
+func drawIOColor(color string) string {
+	switch color {
+	case "red":
+		return "#FF0000"
+	case "black":
+		return "#000000"
+	default:
+		return color
+	}
+}
+
+// drawIONumber formats a coordinate rounded to two decimals
+func drawIONumber(value float64) string {
+	return strconv.FormatFloat(math.Round(value*100)/100, 'f', -1, 64)
+}
@@ -0,0 +1,65 @@
+package export
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/layout"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportGraphDrawIO(t *testing.T) {
+	g := createTestGraph()
+	require.NoError(t, g.UpdateNodeState("workflow1", graph.NodeStateFailed))
+
+	data, err := ExportGraphDrawIO(g, DrawIOOptions{})
+	require.NoError(t, err)
+
+	var file drawIOFile
+	require.NoError(t, xml.Unmarshal(data, &file))
+	assert.Equal(t, "test-app", file.Diagram.Name)
+
+	cells := make(map[string]drawIOCell)
+	for _, cell := range file.Diagram.Model.Cells {
+		cells[cell.ID] = cell
+	}
+	require.Len(t, cells, 2+3+2)
+	assert.Equal(t, "0", cells["1"].Parent)
+
+	gl, err := layout.ComputeLayout(g, layout.LayoutOptions{})
+	require.NoError(t, err)
+	spec := cells["node-spec1"]
+	assert.Equal(t, "1", spec.Vertex)
+	assert.Equal(t, "Database Spec\n(spec)", spec.Value)
+	assert.Equal(t, drawIONumber(gl.Nodes["spec1"].X-80+drawIOMargin), spec.Geometry.X)
+	assert.Equal(t, "160", spec.Geometry.Width)
+	assert.Contains(t, spec.Style, "rounded=1;arcSize=50;")
+	assert.Contains(t, spec.Style, "fillColor=#E3F2FD;")
+
+	workflow := cells["node-workflow1"]
+	assert.Equal(t, "Deploy Database\n(workflow)\n[failed]", workflow.Value)
+	assert.Equal(t, "shape=process;whiteSpace=wrap;fillColor=#FFF9C4;strokeColor=#FF0000;strokeWidth=2;", workflow.Style)
+	assert.Contains(t, cells["node-resource1"].Style, "shape=cylinder3;")
+
+	edge := cells["edge-e2"]
+	assert.Equal(t, "1", edge.Edge)
+	assert.Equal(t, "node-workflow1", edge.Source)
+	assert.Equal(t, "node-resource1", edge.Target)
+	assert.Equal(t, "provisions\ncreates database", edge.Value)
+	assert.Contains(t, edge.Style, "strokeColor=#388E3C;strokeWidth=2;")
+	assert.Equal(t, "1", edge.Geometry.Relative)
+}
+
+func TestExportGraphDrawIO_Layout(t *testing.T) {
+	_, err := ExportGraphDrawIO(createTestGraph(), DrawIOOptions{Layout: layout.LayoutOptions{Type: "spiral"}})
+	assert.Error(t, err)
+
+	data, err := ExportGraphDrawIO(createTestGraph(), DrawIOOptions{Layout: layout.LayoutOptions{Type: layout.LayoutRadial}})
+	require.NoError(t, err)
+	again, err := ExportGraphDrawIO(createTestGraph(), DrawIOOptions{Layout: layout.LayoutOptions{Type: layout.LayoutRadial}})
+	require.NoError(t, err)
+	assert.Equal(t, data, again, "export should be deterministic")
+}
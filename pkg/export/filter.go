@@ -0,0 +1,137 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// Filter restricts an export to the matching nodes and the edges between
+// them. All set criteria must match; the zero Filter exports everything.
+type Filter struct {
+	Types  []graph.NodeType  `json:"types,omitempty"`
+	States []graph.NodeState `json:"states,omitempty"`
+	// Selector matches node properties, e.g. "team=payments,tier!=test,critical".
+	// A bare key requires the property to exist, "!key" requires it to be absent.
+	Selector string `json:"selector,omitempty"`
+	// WithDependencies adds all nodes reachable from the matching nodes, e.g.
+	// the specs a failed workflow depends on and the resources it provisions
+	WithDependencies bool `json:"with_dependencies,omitempty"`
+}
+
+// selectorTerm is one comma-separated requirement of a Filter.Selector
+type selectorTerm struct {
+	key   string
+	value string
+	op    string // "=", "!=", "exists" or "!exists"
+}
+
+// IsZero reports whether the filter matches every node
+func (f Filter) IsZero() bool {
+	return len(f.Types) == 0 && len(f.States) == 0 && strings.TrimSpace(f.Selector) == ""
+}
+
+// Validate checks the filter's selector syntax
+func (f Filter) Validate() error {
+	_, err := parseSelector(f.Selector)
+	return err
+}
+
+// Apply returns the part of g matching the filter, or g itself if the
+// filter is zero
+func (f Filter) Apply(g *graph.Graph) (*graph.Graph, error) {
+	if f.IsZero() {
+		return g, nil
+	}
+
+	terms, err := parseSelector(f.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, node := range sortedNodes(g) {
+		if f.matches(node, terms) {
+			ids = append(ids, node.ID)
+		}
+	}
+
+	if f.WithDependencies {
+		ids = g.Closure(ids)
+	}
+	return g.Subgraph(ids), nil
+}
+
+func (f Filter) matches(node *graph.Node, terms []selectorTerm) bool {
+	if len(f.Types) > 0 && !containsValue(f.Types, node.Type) {
+		return false
+	}
+	if len(f.States) > 0 && !containsValue(f.States, node.State) {
+		return false
+	}
+
+	for _, term := range terms {
+		value, exists := node.Properties[term.key]
+		switch term.op {
+		case "exists":
+			if !exists {
+				return false
+			}
+		case "!exists":
+			if exists {
+				return false
+			}
+		case "=":
+			if !exists || fmt.Sprint(value) != term.value {
+				return false
+			}
+		case "!=":
+			if exists && fmt.Sprint(value) == term.value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func containsValue[T comparable](values []T, v T) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSelector parses a comma-separated list of "key=value", "key!=value",
+// "key" and "!key" terms
+func parseSelector(selector string) ([]selectorTerm, error) {
+	var terms []selectorTerm
+	for _, part := range strings.Split(selector, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var term selectorTerm
+		switch {
+		case strings.Contains(part, "!="):
+			key, value, _ := strings.Cut(part, "!=")
+			term = selectorTerm{key: strings.TrimSpace(key), value: strings.TrimSpace(value), op: "!="}
+		case strings.Contains(part, "="):
+			key, value, _ := strings.Cut(part, "=")
+			term = selectorTerm{key: strings.TrimSpace(key), value: strings.TrimSpace(value), op: "="}
+		case strings.HasPrefix(part, "!"):
+			term = selectorTerm{key: strings.TrimSpace(part[1:]), op: "!exists"}
+		default:
+			term = selectorTerm{key: part, op: "exists"}
+		}
+
+		if term.key == "" {
+			return nil, fmt.Errorf("invalid selector term %q: missing key", part)
+		}
+		terms = append(terms, term)
+	}
+	return terms, nil
+}
@@ -0,0 +1,73 @@
+package export
+
+import (
+	"testing"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter_Apply(t *testing.T) {
+	g := createTestGraph()
+	g.Nodes["resource1"].Properties = map[string]interface{}{"team": "payments", "replicas": 3}
+	g.Nodes["workflow1"].Properties = map[string]interface{}{"team": "platform"}
+	g.Nodes["workflow1"].State = graph.NodeStateFailed
+
+	tests := []struct {
+		name   string
+		filter Filter
+		nodes  []string
+		edges  []string
+	}{
+		{"zero", Filter{}, []string{"resource1", "spec1", "workflow1"}, []string{"e1", "e2"}},
+		{"types", Filter{Types: []graph.NodeType{graph.NodeTypeResource, graph.NodeTypeSpec}}, []string{"resource1", "spec1"}, nil},
+		{"states", Filter{States: []graph.NodeState{graph.NodeStateFailed}}, []string{"workflow1"}, nil},
+		{"failed with dependencies", Filter{States: []graph.NodeState{graph.NodeStateFailed}, WithDependencies: true}, []string{"resource1", "spec1", "workflow1"}, []string{"e1", "e2"}},
+		{"selector equals", Filter{Selector: "team=payments"}, []string{"resource1"}, nil},
+		{"selector number", Filter{Selector: "replicas=3"}, []string{"resource1"}, nil},
+		{"selector not equals", Filter{Selector: "team!=payments"}, []string{"spec1", "workflow1"}, []string{"e1"}},
+		{"selector exists", Filter{Selector: "team"}, []string{"resource1", "workflow1"}, []string{"e2"}},
+		{"selector absent", Filter{Selector: "!team"}, []string{"spec1"}, nil},
+		{"combined", Filter{Types: []graph.NodeType{graph.NodeTypeWorkflow}, Selector: "team=payments"}, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filtered, err := tt.filter.Apply(g)
+			require.NoError(t, err)
+
+			var nodes, edges []string
+			for _, node := range sortedNodes(filtered) {
+				nodes = append(nodes, node.ID)
+			}
+			for _, edge := range sortedEdges(filtered) {
+				edges = append(edges, edge.ID)
+			}
+			assert.Equal(t, tt.nodes, nodes)
+			assert.Equal(t, tt.edges, edges)
+		})
+	}
+}
+
+func TestFilter_InvalidSelector(t *testing.T) {
+	filter := Filter{Selector: "team=payments,=x"}
+	assert.Error(t, filter.Validate())
+
+	_, err := filter.Apply(createTestGraph())
+	assert.ErrorContains(t, err, "missing key")
+}
+
+func TestExporter_ExportGraphWithOptions_Filter(t *testing.T) {
+	exporter := NewExporter()
+	defer exporter.Close()
+
+	opts := Options{Filter: Filter{Types: []graph.NodeType{graph.NodeTypeResource}}}
+	data, err := exporter.ExportGraphWithOptions(createTestGraph(), FormatMermaid, opts)
+	require.NoError(t, err)
+
+	output := string(data)
+	assert.Contains(t, output, "Database")
+	assert.NotContains(t, output, "Deploy Database")
+	assert.NotContains(t, output, "Database Spec")
+}
@@ -0,0 +1,144 @@
+package export
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// Formats lists all formats supported by Exporter.ExportGraph
+var Formats = []Format{FormatDOT, FormatSVG, FormatSVGNative, FormatPNG, FormatPDF, FormatMermaid, FormatGantt, FormatPlantUML, FormatD2, FormatJSON, FormatGraphML, FormatCytoscape, FormatD3, FormatGrafana, FormatDrawIO, FormatCSV, FormatTSV, FormatHTML, FormatBackstage}
+
+// Options holds per-format export settings. Settings of formats other than
+// the exported one are ignored; Filter and Reduce apply to all formats.
+type Options struct {
+	Filter Filter `json:"filter"`
+	Reduce Reduce `json:"reduce"` // Applied after Filter
+	// Theme is used by DOT, SVG, PNG, PDF, native SVG and Mermaid exports
+	// whose own options set no theme
+	Theme *Theme `json:"theme,omitempty"`
+	// Stamp is used by DOT, SVG, PNG, PDF, native SVG, Mermaid, PlantUML,
+	// D2 and HTML exports whose own options set no stamp
+	Stamp *Stamp `json:"stamp,omitempty"`
+
+	DOT       DOTExportOptions `json:"dot"` // Also applies to SVG, PNG and PDF
+	SVG       SVGOptions       `json:"svg"` // Native SVG only
+	Mermaid   MermaidOptions   `json:"mermaid"`
+	Gantt     GanttOptions     `json:"gantt"`
+	PlantUML  PlantUMLOptions  `json:"plantuml"`
+	D2        D2Options        `json:"d2"`
+	JSON      JSONOptions      `json:"json"`
+	GraphML   GraphMLOptions   `json:"graphml"`
+	Cytoscape WebOptions       `json:"cytoscape"`
+	D3        WebOptions       `json:"d3"`
+	Grafana   GrafanaOptions   `json:"grafana"`
+	DrawIO    DrawIOOptions    `json:"drawio"`
+	CSV       CSVOptions       `json:"csv"` // Also applies to TSV
+	HTML      HTMLOptions      `json:"html"`
+	PDF       PDFOptions       `json:"pdf"`
+	Backstage BackstageOptions `json:"backstage"`
+}
+
+// ParseFormat returns the format with the given name
+func ParseFormat(name string) (Format, error) {
+	for _, format := range Formats {
+		if strings.EqualFold(name, string(format)) {
+			return format, nil
+		}
+	}
+
+	names := make([]string, len(Formats))
+	for i, format := range Formats {
+		names[i] = string(format)
+	}
+	return "", fmt.Errorf("unsupported format: %s (supported: %s)", name, strings.Join(names, ", "))
+}
+
+// ContentType returns the MIME type of exported data
+func (f Format) ContentType() string {
+	switch f {
+	case FormatSVG, FormatSVGNative:
+		return "image/svg+xml"
+	case FormatPNG:
+		return "image/png"
+	case FormatPDF:
+		return "application/pdf"
+	case FormatJSON, FormatCytoscape, FormatD3, FormatGrafana:
+		return "application/json"
+	case FormatGraphML:
+		return "application/graphml+xml"
+	case FormatDrawIO:
+		return "application/vnd.jgraph.mxfile"
+	case FormatCSV, FormatTSV:
+		return "application/zip"
+	case FormatHTML:
+		return "text/html; charset=utf-8"
+	case FormatBackstage:
+		return "application/yaml"
+	default:
+		return "text/plain"
+	}
+}
+
+// FileExtension returns the usual file extension of exported data
+func (f Format) FileExtension() string {
+	switch f {
+	case FormatMermaid, FormatGantt:
+		return "mmd"
+	case FormatCSV, FormatTSV:
+		return "zip"
+	case FormatPlantUML:
+		return "puml"
+	case FormatCytoscape, FormatD3, FormatGrafana:
+		return "json"
+	case FormatBackstage:
+		return "yaml"
+	case FormatSVGNative:
+		return "svg"
+	default:
+		return string(f)
+	}
+}
+
+// sortedNodes returns the nodes of g ordered by ID so that text exports are
+// stable
+func sortedNodes(g *graph.Graph) []*graph.Node {
+	nodes := make([]*graph.Node, 0, len(g.Nodes))
+	for _, node := range g.Nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// sortedEdges returns the edges of g ordered by ID
+func sortedEdges(g *graph.Graph) []*graph.Edge {
+	edges := make([]*graph.Edge, 0, len(g.Edges))
+	for _, edge := range g.Edges {
+		edges = append(edges, edge)
+	}
+	sort.Slice(edges, func(i, j int) bool { return edges[i].ID < edges[j].ID })
+	return edges
+}
+
+// PropertyURL is the node property holding a link, e.g. to the dashboard of
+// a resource. DOT, SVG, Mermaid and D2 exports make such nodes clickable.
+const PropertyURL = "url"
+
+// nodeURL returns the http or https URL set in a node's url property. Other
+// schemes and values that would need escaping are ignored, so the URL can be
+// written into any output format as is.
+func nodeURL(node *graph.Node) string {
+	raw, ok := node.Properties[PropertyURL].(string)
+	if !ok || raw == "" || strings.ContainsAny(raw, "\"'<>\\` \t\r\n") {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	return raw
+}
@@ -0,0 +1,178 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/layout"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFormat(t *testing.T) {
+	for _, format := range Formats {
+		parsed, err := ParseFormat(string(format))
+		require.NoError(t, err)
+		assert.Equal(t, format, parsed)
+	}
+
+	parsed, err := ParseFormat("Mermaid")
+	require.NoError(t, err)
+	assert.Equal(t, FormatMermaid, parsed)
+
+	_, err = ParseFormat("bmp")
+	assert.Error(t, err)
+}
+
+func TestFormat_ContentTypeAndExtension(t *testing.T) {
+	assert.Equal(t, "image/svg+xml", FormatSVG.ContentType())
+	assert.Equal(t, "application/json", FormatJSON.ContentType())
+	assert.Equal(t, "text/plain", FormatMermaid.ContentType())
+	assert.Equal(t, "mmd", FormatMermaid.FileExtension())
+	assert.Equal(t, "dot", FormatDOT.FileExtension())
+	assert.Equal(t, "application/graphml+xml", FormatGraphML.ContentType())
+	assert.Equal(t, "graphml", FormatGraphML.FileExtension())
+	assert.Equal(t, "puml", FormatPlantUML.FileExtension())
+	assert.Equal(t, "d2", FormatD2.FileExtension())
+	assert.Equal(t, "drawio", FormatDrawIO.FileExtension())
+	assert.Equal(t, "image/svg+xml", FormatSVGNative.ContentType())
+	assert.Equal(t, "svg", FormatSVGNative.FileExtension())
+}
+
+func TestExporter_ExportGraph_JSON(t *testing.T) {
+	exporter := NewExporter()
+	defer exporter.Close()
+
+	data, err := exporter.ExportGraphWithOptions(createTestGraph(), FormatJSON, Options{JSON: JSONOptions{Indent: true}})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "\n  \"app_name\": \"test-app\"")
+
+	var decoded graph.Graph
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Len(t, decoded.Nodes, 3)
+	assert.Len(t, decoded.Edges, 2)
+}
+
+func TestExporter_ExportGraph_Mermaid(t *testing.T) {
+	exporter := NewExporter()
+	defer exporter.Close()
+
+	data, err := exporter.ExportGraph(createTestGraph(), FormatMermaid)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "flowchart TD")
+}
+
+type failingWriter struct {
+	written int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.written += len(p)
+	return 0, errors.New("disk full")
+}
+
+func TestExporter_ExportGraphTo(t *testing.T) {
+	exporter := NewExporter()
+	defer exporter.Close()
+	g := createTestGraph()
+
+	for _, format := range []Format{FormatDOT, FormatMermaid, FormatJSON, FormatCSV} {
+		var buf bytes.Buffer
+		require.NoError(t, exporter.ExportGraphTo(&buf, g, format, Options{}), format)
+
+		data, err := exporter.ExportGraph(g, format)
+		require.NoError(t, err, format)
+		if format != FormatCSV { // Zip archives contain modification times
+			assert.Equal(t, data, buf.Bytes(), format)
+		}
+	}
+
+	w := &failingWriter{}
+	err := exporter.ExportGraphTo(w, g, FormatDOT, Options{})
+	assert.ErrorContains(t, err, "disk full")
+
+	err = exporter.ExportGraphTo(w, g, FormatMermaid, Options{})
+	assert.ErrorContains(t, err, "disk full")
+
+	w = &failingWriter{}
+	err = exporter.ExportGraphTo(w, g, "bmp", Options{})
+	assert.ErrorContains(t, err, "unsupported format")
+	assert.Zero(t, w.written, "nothing is written for unsupported formats")
+}
+
+func TestExporter_SetLayoutCache(t *testing.T) {
+	exporter := NewExporter()
+	defer exporter.Close()
+	cache := layout.NewLayoutCache(0)
+	exporter.SetLayoutCache(cache)
+	g := createTestGraph()
+
+	var first, second bytes.Buffer
+	require.NoError(t, exporter.ExportGraphTo(&first, g, FormatDrawIO, Options{}))
+	require.NoError(t, g.UpdateNodeState("workflow1", graph.NodeStateRunning))
+	require.NoError(t, exporter.ExportGraphTo(&second, g, FormatDrawIO, Options{}))
+	assert.Equal(t, layout.CacheStats{Hits: 1, Misses: 1, Entries: 1}, cache.Stats())
+
+	// Options with their own cache bypass the Exporter's
+	own := layout.NewLayoutCache(0)
+	require.NoError(t, exporter.ExportGraphTo(&second, g, FormatDrawIO, Options{DrawIO: DrawIOOptions{LayoutCache: own}}))
+	assert.Equal(t, int64(1), own.Stats().Misses)
+	assert.Equal(t, int64(1), cache.Stats().Hits)
+}
+
+func TestWritePDF_WriteError(t *testing.T) {
+	err := writePDF(&failingWriter{}, solidImage(10, 10, color.Black), PDFOptions{})
+	assert.ErrorContains(t, err, "disk full")
+}
+
+func TestNodeURL(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{"https://grafana.example.com/d/db?var-env=prod&from=now-1h", "https://grafana.example.com/d/db?var-env=prod&from=now-1h"},
+		{"http://example.com", "http://example.com"},
+		{"javascript:alert(1)", ""},
+		{"ftp://example.com/file", ""},
+		{"/relative/path", ""},
+		{"https://example.com/\"onmouseover=\"x", ""},
+		{"https://example.com/a b", ""},
+		{42, ""},
+		{nil, ""},
+	}
+
+	for _, test := range tests {
+		node := &graph.Node{ID: "n", Properties: map[string]interface{}{PropertyURL: test.value}}
+		assert.Equal(t, test.expected, nodeURL(node), "%v", test.value)
+	}
+	assert.Empty(t, nodeURL(&graph.Node{ID: "n"}))
+}
+
+func TestExporter_NodeURLs(t *testing.T) {
+	exporter := NewExporter()
+	defer exporter.Close()
+
+	g := createTestGraph()
+	g.Nodes["resource1"].Properties = map[string]interface{}{PropertyURL: "https://grafana.example.com/d/db?a=1&b=2"}
+	g.Nodes["spec1"].Properties = map[string]interface{}{PropertyURL: "javascript:alert(1)"}
+
+	data, err := exporter.ExportGraph(g, FormatDOT)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `style="filled,rounded", URL="https://grafana.example.com/d/db?a=1&b=2", target="_blank"];`)
+	assert.Equal(t, 1, strings.Count(string(data), "URL="))
+
+	data, err = exporter.ExportGraph(g, FormatMermaid)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "  click resource1 href \"https://grafana.example.com/d/db?a=1&b=2\" _blank\n")
+	assert.Equal(t, 1, strings.Count(string(data), "click "))
+
+	data, err = exporter.ExportGraph(g, FormatD2)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "  link: \"https://grafana.example.com/d/db?a=1&b=2\"\n")
+}
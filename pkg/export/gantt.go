@@ -0,0 +1,167 @@
+package export
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// GanttOptions configures the Mermaid Gantt export
+type GanttOptions struct {
+	// Title defaults to the app name
+	Title string `json:"title"`
+}
+
+// ExportGraphGantt renders a graph as a Mermaid Gantt chart. Every workflow
+// gets a section holding the workflow and its contained steps; nodes outside
+// any workflow are listed in a leading "Other" section. A node that depends
+// on other nodes starts "after" them, any other node starts when it actually
+// started, or at the start of the chart if it has not run yet. Task lengths
+// are the recorded durations (at least one second), specs are milestones.
+func ExportGraphGantt(g *graph.Graph, opts GanttOptions) ([]byte, error) {
+	title := opts.Title
+	if title == "" {
+		title = g.AppName
+	}
+
+	ids := mermaidIDs(g)
+	order := ganttOrder(g)
+	parents := ganttParents(g)
+
+	// The chart starts with the earliest started node, or at the Unix epoch
+	// if nothing has run yet
+	var start time.Time
+	for _, node := range g.Nodes {
+		if node.StartedAt != nil && (start.IsZero() || node.StartedAt.Before(start)) {
+			start = *node.StartedAt
+		}
+	}
+	if start.IsZero() {
+		start = time.Unix(0, 0)
+	}
+
+	// Group nodes into sections in execution order; a workflow's section is
+	// placed where the workflow itself runs
+	sections := make(map[string][]*graph.Node)
+	var sectionOrder []string
+	for _, node := range order {
+		section := ""
+		if node.Type == graph.NodeTypeWorkflow {
+			section = node.ID
+		} else if parent, ok := parents[node.ID]; ok {
+			section = parent
+		}
+		if _, exists := sections[section]; !exists && section != "" {
+			sectionOrder = append(sectionOrder, section)
+		}
+		sections[section] = append(sections[section], node)
+	}
+	if len(sections[""]) > 0 {
+		sectionOrder = append([]string{""}, sectionOrder...)
+	}
+
+	var buf strings.Builder
+	buf.WriteString("gantt\n")
+	fmt.Fprintf(&buf, "  title %s\n", escapeGantt(title))
+	buf.WriteString("  dateFormat X\n")
+	buf.WriteString("  axisFormat %H:%M:%S\n")
+
+	for _, section := range sectionOrder {
+		name := "Other"
+		if node, exists := g.Nodes[section]; exists {
+			name = node.Name
+		}
+		fmt.Fprintf(&buf, "\n  section %s\n", escapeGantt(name))
+
+		for _, node := range sections[section] {
+			fields := ganttTags(node)
+			fields = append(fields, ids[node.ID])
+
+			var after []string
+			for _, edge := range g.OutgoingEdges(node.ID) {
+				if edge.Type == graph.EdgeTypeDependsOn {
+					if id, ok := ids[edge.ToNodeID]; ok {
+						after = append(after, id)
+					}
+				}
+			}
+			sort.Strings(after)
+
+			switch {
+			case len(after) > 0:
+				fields = append(fields, "after "+strings.Join(after, " "))
+			case node.StartedAt != nil:
+				fields = append(fields, fmt.Sprint(node.StartedAt.Unix()))
+			default:
+				fields = append(fields, fmt.Sprint(start.Unix()))
+			}
+			fields = append(fields, ganttDuration(node))
+
+			fmt.Fprintf(&buf, "  %s :%s\n", escapeGantt(node.Name), strings.Join(fields, ", "))
+		}
+	}
+
+	return []byte(buf.String()), nil
+}
+
+// ganttOrder returns the nodes in execution order, or ordered by ID if the
+// graph has a cycle
+func ganttOrder(g *graph.Graph) []*graph.Node {
+	order, err := g.TopologicalSort()
+	if err != nil {
+		return sortedNodes(g)
+	}
+	return order
+}
+
+// ganttParents maps nodes contained by a workflow to that workflow
+func ganttParents(g *graph.Graph) map[string]string {
+	parents := make(map[string]string)
+	for _, edge := range sortedEdges(g) {
+		if edge.Type != graph.EdgeTypeContains {
+			continue
+		}
+		if parent, exists := g.Nodes[edge.FromNodeID]; exists && parent.Type == graph.NodeTypeWorkflow {
+			if _, assigned := parents[edge.ToNodeID]; !assigned {
+				parents[edge.ToNodeID] = edge.FromNodeID
+			}
+		}
+	}
+	return parents
+}
+
+// ganttTags maps node states to Mermaid task tags
+func ganttTags(node *graph.Node) []string {
+	var tags []string
+	switch node.State {
+	case graph.NodeStateSucceeded:
+		tags = append(tags, "done")
+	case graph.NodeStateRunning:
+		tags = append(tags, "active")
+	case graph.NodeStateFailed:
+		tags = append(tags, "crit")
+	}
+	if node.Type == graph.NodeTypeSpec {
+		tags = append(tags, "milestone")
+	}
+	return tags
+}
+
+func ganttDuration(node *graph.Node) string {
+	if node.Type == graph.NodeTypeSpec {
+		return "0s"
+	}
+	seconds := int64(node.Duration.Round(time.Second) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
+
+// escapeGantt removes characters that end a Gantt task name or title
+func escapeGantt(text string) string {
+	return strings.NewReplacer(":", "", "#", "", ";", "", "\n", " ").Replace(text)
+}
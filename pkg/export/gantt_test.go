@@ -0,0 +1,90 @@
+package export
+
+import (
+	"testing"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createGanttTestGraph(t *testing.T) *graph.Graph {
+	t0 := time.Unix(1700000000, 0)
+	at := func(seconds int) *time.Time {
+		ts := t0.Add(time.Duration(seconds) * time.Second)
+		return &ts
+	}
+
+	g := graph.NewGraph("test-gantt")
+	require.NoError(t, g.AddNodes([]*graph.Node{
+		{ID: "spec1", Type: graph.NodeTypeSpec, Name: "App Spec", State: graph.NodeStateSucceeded},
+		{ID: "wf1", Type: graph.NodeTypeWorkflow, Name: "Deploy: DB", State: graph.NodeStateSucceeded, StartedAt: at(10), Duration: 90 * time.Second},
+		{ID: "step1", Type: graph.NodeTypeStep, Name: "Create schema", State: graph.NodeStateSucceeded, StartedAt: at(12), Duration: 30 * time.Second},
+		{ID: "step2", Type: graph.NodeTypeStep, Name: "Migrate", State: graph.NodeStateRunning, StartedAt: at(42)},
+		{ID: "res1", Type: graph.NodeTypeResource, Name: "Database", State: graph.NodeStateFailed},
+		{ID: "wf2", Type: graph.NodeTypeWorkflow, Name: "Deploy API", State: graph.NodeStateWaiting},
+	}))
+	require.NoError(t, g.AddEdges([]*graph.Edge{
+		{ID: "e1", FromNodeID: "wf1", ToNodeID: "spec1", Type: graph.EdgeTypeDependsOn},
+		{ID: "e2", FromNodeID: "wf1", ToNodeID: "step1", Type: graph.EdgeTypeContains},
+		{ID: "e3", FromNodeID: "wf1", ToNodeID: "step2", Type: graph.EdgeTypeContains},
+		{ID: "e4", FromNodeID: "step2", ToNodeID: "step1", Type: graph.EdgeTypeDependsOn},
+		{ID: "e5", FromNodeID: "wf1", ToNodeID: "res1", Type: graph.EdgeTypeProvisions},
+		{ID: "e6", FromNodeID: "wf2", ToNodeID: "res1", Type: graph.EdgeTypeDependsOn},
+	}))
+	return g
+}
+
+func TestExportGraphGantt(t *testing.T) {
+	g := createGanttTestGraph(t)
+
+	data, err := ExportGraphGantt(g, GanttOptions{})
+	require.NoError(t, err)
+
+	expected := `gantt
+  title test-gantt
+  dateFormat X
+  axisFormat %H:%M:%S
+
+  section Other
+  App Spec :done, milestone, spec1, 1700000010, 0s
+  Database :crit, res1, 1700000010, 1s
+
+  section Deploy DB
+  Deploy DB :done, wf1, after spec1, 90s
+  Create schema :done, step1, 1700000012, 30s
+  Migrate :active, step2, after step1, 1s
+
+  section Deploy API
+  Deploy API :wf2, after res1, 1s
+`
+	assert.Equal(t, expected, string(data))
+
+	again, err := ExportGraphGantt(g, GanttOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, string(data), string(again), "export should be deterministic")
+}
+
+func TestExportGraphGantt_Title(t *testing.T) {
+	data, err := ExportGraphGantt(createTestGraph(), GanttOptions{Title: "Release #42"})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "  title Release 42\n")
+	assert.Contains(t, string(data), "  Database Spec :milestone, spec1, 0, 0s\n")
+	assert.Contains(t, string(data), "  section Deploy Database\n  Deploy Database :workflow1, after spec1, 1s\n")
+}
+
+func TestExporter_ExportGraph_Gantt(t *testing.T) {
+	exporter := NewExporter()
+	defer exporter.Close()
+
+	format, err := ParseFormat("Mermaid-Gantt")
+	require.NoError(t, err)
+	assert.Equal(t, FormatGantt, format)
+	assert.Equal(t, "mmd", format.FileExtension())
+
+	data, err := exporter.ExportGraph(createTestGraph(), format)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "gantt\n")
+}
@@ -0,0 +1,190 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// GrafanaOptions configures the Grafana Node Graph export
+type GrafanaOptions struct {
+	// Indent pretty-prints the output
+	Indent bool `json:"indent"`
+}
+
+// grafanaArcs are the arc sections drawn around each node, in drawing order
+var grafanaArcs = []struct {
+	field  string
+	states []graph.NodeState
+	color  string
+}{
+	{"arc__succeeded", []graph.NodeState{graph.NodeStateSucceeded}, defaultTheme.StateBorder(graph.NodeStateSucceeded)},
+	{"arc__failed", []graph.NodeState{graph.NodeStateFailed}, defaultTheme.StateBorder(graph.NodeStateFailed)},
+	{"arc__running", []graph.NodeState{graph.NodeStateRunning}, defaultTheme.StateBorder(graph.NodeStateRunning)},
+	{"arc__waiting", []graph.NodeState{graph.NodeStateWaiting, graph.NodeStatePending, ""}, "#9E9E9E"},
+}
+
+type grafanaResponse struct {
+	Frames []grafanaFrame `json:"frames"`
+}
+
+// grafanaFrame is a Grafana data frame in its JSON wire format: a schema
+// describing the fields and their values stored column by column
+type grafanaFrame struct {
+	Schema grafanaSchema    `json:"schema"`
+	Data   grafanaFrameData `json:"data"`
+}
+
+type grafanaSchema struct {
+	Name   string         `json:"name"`
+	Meta   grafanaMeta    `json:"meta"`
+	Fields []grafanaField `json:"fields"`
+}
+
+type grafanaMeta struct {
+	PreferredVisualisationType string `json:"preferredVisualisationType"`
+}
+
+type grafanaField struct {
+	Name   string                 `json:"name"`
+	Type   string                 `json:"type"`
+	Config map[string]interface{} `json:"config"`
+}
+
+type grafanaFrameData struct {
+	Values [][]interface{} `json:"values"`
+}
+
+// grafanaFrameBuilder collects the columns of a frame
+type grafanaFrameBuilder struct {
+	frame grafanaFrame
+}
+
+func newGrafanaFrame(name string) *grafanaFrameBuilder {
+	return &grafanaFrameBuilder{frame: grafanaFrame{Schema: grafanaSchema{
+		Name: name,
+		Meta: grafanaMeta{PreferredVisualisationType: "nodeGraph"},
+	}}}
+}
+
+func (b *grafanaFrameBuilder) add(name, fieldType string, config map[string]interface{}, values []interface{}) {
+	if config == nil {
+		config = map[string]interface{}{}
+	}
+	b.frame.Schema.Fields = append(b.frame.Schema.Fields, grafanaField{Name: name, Type: fieldType, Config: config})
+	b.frame.Data.Values = append(b.frame.Data.Values, values)
+}
+
+// ExportGraphGrafana renders a graph as the nodes and edges data frames
+// expected by Grafana's Node Graph panel, e.g. for a JSON or Infinity data
+// source pointed at the REST export endpoint. Nodes show their state as main
+// stat and their duration as secondary stat. Arc sections show the share of
+// contained steps per state for workflows with steps, and the node's own
+// state otherwise.
+func ExportGraphGrafana(g *graph.Graph, opts GrafanaOptions) ([]byte, error) {
+	nodes := sortedNodes(g)
+	edges := sortedEdges(g)
+
+	children := make(map[string][]*graph.Node)
+	for _, edge := range edges {
+		if edge.Type == graph.EdgeTypeContains {
+			if child, exists := g.Nodes[edge.ToNodeID]; exists {
+				children[edge.FromNodeID] = append(children[edge.FromNodeID], child)
+			}
+		}
+	}
+
+	ids := make([]interface{}, len(nodes))
+	titles := make([]interface{}, len(nodes))
+	subtitles := make([]interface{}, len(nodes))
+	mainStats := make([]interface{}, len(nodes))
+	secondaryStats := make([]interface{}, len(nodes))
+	descriptions := make([]interface{}, len(nodes))
+	arcs := make([][]interface{}, len(grafanaArcs))
+	for i := range arcs {
+		arcs[i] = make([]interface{}, len(nodes))
+	}
+
+	for i, node := range nodes {
+		ids[i] = node.ID
+		titles[i] = node.Name
+		subtitles[i] = string(node.Type)
+		mainStats[i] = stateName(node.State)
+		secondaryStats[i] = ""
+		if node.Duration > 0 {
+			secondaryStats[i] = node.Duration.Round(time.Second).String()
+		}
+		descriptions[i] = node.Description
+
+		members := children[node.ID]
+		if len(members) == 0 {
+			members = []*graph.Node{node}
+		}
+		for j, arc := range grafanaArcs {
+			count := 0
+			for _, member := range members {
+				if containsValue(arc.states, member.State) {
+					count++
+				}
+			}
+			arcs[j][i] = float64(count) / float64(len(members))
+		}
+	}
+
+	nodeFrame := newGrafanaFrame("nodes")
+	nodeFrame.add("id", "string", nil, ids)
+	nodeFrame.add("title", "string", nil, titles)
+	nodeFrame.add("subtitle", "string", nil, subtitles)
+	nodeFrame.add("mainstat", "string", map[string]interface{}{"displayName": "State"}, mainStats)
+	nodeFrame.add("secondarystat", "string", map[string]interface{}{"displayName": "Duration"}, secondaryStats)
+	for j, arc := range grafanaArcs {
+		config := map[string]interface{}{
+			"color":       map[string]interface{}{"mode": "fixed", "fixedColor": arc.color},
+			"displayName": arc.field[len("arc__"):],
+		}
+		nodeFrame.add(arc.field, "number", config, arcs[j])
+	}
+	nodeFrame.add("detail__description", "string", map[string]interface{}{"displayName": "Description"}, descriptions)
+
+	edgeIDs := make([]interface{}, len(edges))
+	sources := make([]interface{}, len(edges))
+	targets := make([]interface{}, len(edges))
+	edgeMainStats := make([]interface{}, len(edges))
+	edgeSecondaryStats := make([]interface{}, len(edges))
+	colors := make([]interface{}, len(edges))
+	for i, edge := range edges {
+		if g.Nodes[edge.FromNodeID] == nil || g.Nodes[edge.ToNodeID] == nil {
+			return nil, fmt.Errorf("edge %s references unknown node", edge.ID)
+		}
+		edgeIDs[i] = edge.ID
+		sources[i] = edge.FromNodeID
+		targets[i] = edge.ToNodeID
+		edgeMainStats[i] = string(edge.Type)
+		edgeSecondaryStats[i] = edge.Description
+		colors[i] = defaultTheme.EdgeColor(edge.Type)
+	}
+
+	edgeFrame := newGrafanaFrame("edges")
+	edgeFrame.add("id", "string", nil, edgeIDs)
+	edgeFrame.add("source", "string", nil, sources)
+	edgeFrame.add("target", "string", nil, targets)
+	edgeFrame.add("mainstat", "string", map[string]interface{}{"displayName": "Type"}, edgeMainStats)
+	edgeFrame.add("secondarystat", "string", map[string]interface{}{"displayName": "Description"}, edgeSecondaryStats)
+	edgeFrame.add("color", "string", nil, colors)
+
+	response := grafanaResponse{Frames: []grafanaFrame{nodeFrame.frame, edgeFrame.frame}}
+	if opts.Indent {
+		return json.MarshalIndent(response, "", "  ")
+	}
+	return json.Marshal(response)
+}
+
+// stateName returns the name of a state, treating unset states as waiting
+func stateName(state graph.NodeState) string {
+	if state == "" {
+		return string(graph.NodeStateWaiting)
+	}
+	return string(state)
+}
@@ -0,0 +1,82 @@
+package export
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// grafanaColumns returns the columns of a decoded frame by field name
+func grafanaColumns(t *testing.T, frame grafanaFrame) map[string][]interface{} {
+	require.Len(t, frame.Data.Values, len(frame.Schema.Fields))
+	columns := make(map[string][]interface{})
+	for i, field := range frame.Schema.Fields {
+		columns[field.Name] = frame.Data.Values[i]
+	}
+	return columns
+}
+
+func TestExportGraphGrafana(t *testing.T) {
+	g := createTestGraph()
+	require.NoError(t, g.AddNodes([]*graph.Node{
+		{ID: "step1", Type: graph.NodeTypeStep, Name: "Create", State: graph.NodeStateSucceeded},
+		{ID: "step2", Type: graph.NodeTypeStep, Name: "Migrate", State: graph.NodeStateFailed},
+	}))
+	require.NoError(t, g.AddEdges([]*graph.Edge{
+		{ID: "e3", FromNodeID: "workflow1", ToNodeID: "step1", Type: graph.EdgeTypeContains},
+		{ID: "e4", FromNodeID: "workflow1", ToNodeID: "step2", Type: graph.EdgeTypeContains},
+	}))
+	g.Nodes["resource1"].State = graph.NodeStateRunning
+	g.Nodes["workflow1"].Duration = 95 * time.Second
+
+	data, err := ExportGraphGrafana(g, GrafanaOptions{})
+	require.NoError(t, err)
+
+	var response grafanaResponse
+	require.NoError(t, json.Unmarshal(data, &response))
+	require.Len(t, response.Frames, 2)
+	assert.Equal(t, "nodes", response.Frames[0].Schema.Name)
+	assert.Equal(t, "edges", response.Frames[1].Schema.Name)
+	assert.Equal(t, "nodeGraph", response.Frames[0].Schema.Meta.PreferredVisualisationType)
+
+	nodes := grafanaColumns(t, response.Frames[0])
+	assert.Equal(t, []interface{}{"resource1", "spec1", "step1", "step2", "workflow1"}, nodes["id"])
+	assert.Equal(t, []interface{}{"Database", "Database Spec", "Create", "Migrate", "Deploy Database"}, nodes["title"])
+	assert.Equal(t, []interface{}{"running", "waiting", "succeeded", "failed", "waiting"}, nodes["mainstat"])
+	assert.Equal(t, "1m35s", nodes["secondarystat"][4])
+
+	// Workflows show the share of their steps, other nodes their own state
+	assert.Equal(t, []interface{}{0.0, 0.0, 1.0, 0.0, 0.5}, nodes["arc__succeeded"])
+	assert.Equal(t, []interface{}{0.0, 0.0, 0.0, 1.0, 0.5}, nodes["arc__failed"])
+	assert.Equal(t, []interface{}{1.0, 0.0, 0.0, 0.0, 0.0}, nodes["arc__running"])
+	assert.Equal(t, []interface{}{0.0, 1.0, 0.0, 0.0, 0.0}, nodes["arc__waiting"])
+
+	for _, field := range response.Frames[0].Schema.Fields {
+		if field.Name == "arc__failed" {
+			assert.Equal(t, map[string]interface{}{"mode": "fixed", "fixedColor": "red"}, field.Config["color"])
+		}
+	}
+
+	edges := grafanaColumns(t, response.Frames[1])
+	assert.Equal(t, []interface{}{"e1", "e2", "e3", "e4"}, edges["id"])
+	assert.Equal(t, []interface{}{"workflow1", "workflow1", "workflow1", "workflow1"}, edges["source"])
+	assert.Equal(t, []interface{}{"spec1", "resource1", "step1", "step2"}, edges["target"])
+	assert.Equal(t, "depends-on", edges["mainstat"][0])
+	assert.Equal(t, "creates database", edges["secondarystat"][1])
+}
+
+func TestExporter_ExportGraph_Grafana(t *testing.T) {
+	exporter := NewExporter()
+	defer exporter.Close()
+
+	data, err := exporter.ExportGraphWithOptions(createTestGraph(), FormatGrafana, Options{Grafana: GrafanaOptions{Indent: true}})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "\n  \"frames\": [")
+	assert.Equal(t, "application/json", FormatGrafana.ContentType())
+	assert.Equal(t, "json", FormatGrafana.FileExtension())
+}
@@ -0,0 +1,261 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// GraphMLOptions configures GraphML export
+type GraphMLOptions struct {
+	// Separator joins the keys of nested properties when they are flattened
+	// into attributes, e.g. "properties.config.replicas" (default ".")
+	Separator string `json:"separator"`
+}
+
+const graphMLNamespace = "http://graphml.graphdrawing.org/xmlns"
+
+type graphMLDocument struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Data        []graphMLData `xml:"data"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// graphMLKeys are the attributes written for every graph, node and edge.
+// Property attributes are added per export.
+var graphMLKeys = []graphMLKey{
+	{ID: "g_app", For: "graph", Name: "app", Type: "string"},
+	{ID: "g_version", For: "graph", Name: "version", Type: "int"},
+	{ID: "n_label", For: "node", Name: "label", Type: "string"},
+	{ID: "n_type", For: "node", Name: "type", Type: "string"},
+	{ID: "n_state", For: "node", Name: "state", Type: "string"},
+	{ID: "n_description", For: "node", Name: "description", Type: "string"},
+	{ID: "n_started_at", For: "node", Name: "started_at", Type: "string"},
+	{ID: "n_completed_at", For: "node", Name: "completed_at", Type: "string"},
+	{ID: "n_duration_ms", For: "node", Name: "duration_ms", Type: "long"},
+	{ID: "e_label", For: "edge", Name: "label", Type: "string"},
+	{ID: "e_type", For: "edge", Name: "type", Type: "string"},
+}
+
+// ExportGraphGraphML renders a graph as GraphML for tools such as Gephi and
+// yEd. Node and edge properties are flattened into one attribute per leaf
+// value; an attribute holding values of different kinds is typed string.
+func ExportGraphGraphML(g *graph.Graph, opts GraphMLOptions) ([]byte, error) {
+	separator := opts.Separator
+	if separator == "" {
+		separator = "."
+	}
+
+	nodes := sortedNodes(g)
+	edges := sortedEdges(g)
+
+	nodeProperties := make([]map[string]interface{}, len(nodes))
+	for i, node := range nodes {
+		nodeProperties[i] = flattenProperties(node.Properties, "properties", separator)
+	}
+	edgeProperties := make([]map[string]interface{}, len(edges))
+	for i, edge := range edges {
+		edgeProperties[i] = flattenProperties(edge.Properties, "properties", separator)
+	}
+
+	keys := append([]graphMLKey{}, graphMLKeys...)
+	nodeKeys, keys := graphMLPropertyKeys(keys, "node", "np", nodeProperties)
+	edgeKeys, keys := graphMLPropertyKeys(keys, "edge", "ep", edgeProperties)
+
+	doc := graphMLDocument{
+		XMLNS: graphMLNamespace,
+		Keys:  keys,
+		Graph: graphMLGraph{
+			ID:          g.AppName,
+			EdgeDefault: "directed",
+			Data: []graphMLData{
+				{Key: "g_app", Value: g.AppName},
+				{Key: "g_version", Value: strconv.Itoa(g.Version)},
+			},
+		},
+	}
+
+	for i, node := range nodes {
+		data := []graphMLData{
+			{Key: "n_label", Value: node.Name},
+			{Key: "n_type", Value: string(node.Type)},
+			{Key: "n_state", Value: string(node.State)},
+		}
+		if node.Description != "" {
+			data = append(data, graphMLData{Key: "n_description", Value: node.Description})
+		}
+		if node.StartedAt != nil {
+			data = append(data, graphMLData{Key: "n_started_at", Value: node.StartedAt.Format(time.RFC3339)})
+		}
+		if node.CompletedAt != nil {
+			data = append(data, graphMLData{Key: "n_completed_at", Value: node.CompletedAt.Format(time.RFC3339)})
+		}
+		if duration, ok := nodeDuration(node, time.Now()); ok && node.State != graph.NodeStateRunning {
+			data = append(data, graphMLData{Key: "n_duration_ms", Value: strconv.FormatInt(duration.Milliseconds(), 10)})
+		}
+		data = append(data, graphMLPropertyData(nodeKeys, nodeProperties[i])...)
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{ID: node.ID, Data: data})
+	}
+
+	for i, edge := range edges {
+		if _, ok := g.Nodes[edge.FromNodeID]; !ok {
+			return nil, fmt.Errorf("edge %s references unknown node", edge.ID)
+		}
+		if _, ok := g.Nodes[edge.ToNodeID]; !ok {
+			return nil, fmt.Errorf("edge %s references unknown node", edge.ID)
+		}
+		data := []graphMLData{{Key: "e_type", Value: string(edge.Type)}}
+		if edge.Description != "" {
+			data = append(data, graphMLData{Key: "e_label", Value: edge.Description})
+		}
+		data = append(data, graphMLPropertyData(edgeKeys, edgeProperties[i])...)
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			ID:     edge.ID,
+			Source: edge.FromNodeID,
+			Target: edge.ToNodeID,
+			Data:   data,
+		})
+	}
+
+	out, err := xml.MarshalIndent(&doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode graph: %w", err)
+	}
+	return append([]byte(xml.Header), append(out, '\n')...), nil
+}
+
+// graphMLPropertyKeys declares one key per flattened property name, sorted
+// by name, and returns the key IDs by property name
+func graphMLPropertyKeys(keys []graphMLKey, domain, prefix string, properties []map[string]interface{}) (map[string]string, []graphMLKey) {
+	types := make(map[string]string)
+	for _, props := range properties {
+		for name, value := range props {
+			valueType := graphMLType(value)
+			if existing, ok := types[name]; ok && existing != valueType {
+				if (existing == "long" || existing == "double") && (valueType == "long" || valueType == "double") {
+					valueType = "double"
+				} else {
+					valueType = "string"
+				}
+			}
+			types[name] = valueType
+		}
+	}
+
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ids := make(map[string]string, len(names))
+	for i, name := range names {
+		id := fmt.Sprintf("%s%d", prefix, i)
+		ids[name] = id
+		keys = append(keys, graphMLKey{ID: id, For: domain, Name: name, Type: types[name]})
+	}
+	return ids, keys
+}
+
+func graphMLPropertyData(ids map[string]string, properties map[string]interface{}) []graphMLData {
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	data := make([]graphMLData, 0, len(names))
+	for _, name := range names {
+		data = append(data, graphMLData{Key: ids[name], Value: graphMLValue(properties[name])})
+	}
+	return data
+}
+
+// flattenProperties turns nested maps and slices into a flat map whose keys
+// are the paths to the leaf values, joined with separator
+func flattenProperties(properties map[string]interface{}, prefix, separator string) map[string]interface{} {
+	flat := make(map[string]interface{})
+	var walk func(path string, value interface{})
+	walk = func(path string, value interface{}) {
+		switch v := value.(type) {
+		case nil:
+		case map[string]interface{}:
+			for key, child := range v {
+				walk(path+separator+key, child)
+			}
+		case []interface{}:
+			for i, child := range v {
+				walk(path+separator+strconv.Itoa(i), child)
+			}
+		default:
+			flat[path] = v
+		}
+	}
+	for key, value := range properties {
+		walk(prefix+separator+key, value)
+	}
+	return flat
+}
+
+func graphMLType(value interface{}) string {
+	switch value.(type) {
+	case bool:
+		return "boolean"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "long"
+	case float32, float64:
+		return "double"
+	default:
+		return "string"
+	}
+}
+
+func graphMLValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,88 @@
+package export
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportGraphGraphML(t *testing.T) {
+	g := createTestGraph()
+	require.NoError(t, g.UpdateNodeState("workflow1", graph.NodeStateFailed))
+	g.Nodes["resource1"].Properties = map[string]interface{}{
+		"engine":   "postgres",
+		"replicas": 3,
+		"config":   map[string]interface{}{"ha": true, "size": 2.5},
+		"ports":    []interface{}{5432, "metrics"},
+	}
+	g.Nodes["spec1"].Properties = map[string]interface{}{"replicas": "three"}
+	g.Edges["e1"].Properties = map[string]interface{}{"weight": 1.5}
+
+	data, err := ExportGraphGraphML(g, GraphMLOptions{})
+	require.NoError(t, err)
+
+	var doc graphMLDocument
+	require.NoError(t, xml.Unmarshal(data, &doc))
+	assert.Equal(t, graphMLNamespace, doc.XMLNS)
+	assert.Equal(t, "test-app", doc.Graph.ID)
+	assert.Equal(t, "directed", doc.Graph.EdgeDefault)
+
+	keys := make(map[string]graphMLKey)
+	for _, key := range doc.Keys {
+		keys[key.For+":"+key.Name] = key
+	}
+	assert.Equal(t, "string", keys["node:properties.engine"].Type)
+	assert.Equal(t, "string", keys["node:properties.replicas"].Type, "conflicting kinds fall back to string")
+	assert.Equal(t, "boolean", keys["node:properties.config.ha"].Type)
+	assert.Equal(t, "double", keys["node:properties.config.size"].Type)
+	assert.Equal(t, "long", keys["node:properties.ports.0"].Type)
+	assert.Equal(t, "string", keys["node:properties.ports.1"].Type)
+	assert.Equal(t, "double", keys["edge:properties.weight"].Type)
+
+	require.Len(t, doc.Graph.Nodes, 3)
+	nodes := make(map[string]map[string]string)
+	for _, node := range doc.Graph.Nodes {
+		values := make(map[string]string)
+		for _, data := range node.Data {
+			values[data.Key] = data.Value
+		}
+		nodes[node.ID] = values
+	}
+	assert.Equal(t, "Deploy Database", nodes["workflow1"]["n_label"])
+	assert.Equal(t, "failed", nodes["workflow1"]["n_state"])
+	assert.Equal(t, "resource", nodes["resource1"]["n_type"])
+	assert.Equal(t, "3", nodes["resource1"][keys["node:properties.replicas"].ID])
+	assert.Equal(t, "2.5", nodes["resource1"][keys["node:properties.config.size"].ID])
+	assert.Equal(t, "metrics", nodes["resource1"][keys["node:properties.ports.1"].ID])
+
+	require.Len(t, doc.Graph.Edges, 2)
+	assert.Equal(t, graphMLEdge{
+		ID:     "e1",
+		Source: "workflow1",
+		Target: "spec1",
+		Data: []graphMLData{
+			{Key: "e_type", Value: "depends-on"},
+			{Key: "e_label", Value: "needs spec"},
+			{Key: keys["edge:properties.weight"].ID, Value: "1.5"},
+		},
+	}, doc.Graph.Edges[0])
+
+	again, err := ExportGraphGraphML(g, GraphMLOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, data, again, "export should be stable")
+}
+
+func TestExportGraphGraphML_Separator(t *testing.T) {
+	g := createTestGraph()
+	g.Nodes["spec1"].Properties = map[string]interface{}{
+		"config": map[string]interface{}{"replicas": 2},
+	}
+
+	data, err := ExportGraphGraphML(g, GraphMLOptions{Separator: "/"})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `attr.name="properties/config/replicas"`)
+}
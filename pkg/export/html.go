@@ -0,0 +1,89 @@
+package export
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/layout"
+)
+
+// HTMLOptions configures HTML export
+type HTMLOptions struct {
+	// Layout configures the node positions; the hierarchical layout is used
+	// by default
+	Layout layout.LayoutOptions `json:"layout"`
+	// LayoutCache reuses layouts of graphs with an unchanged structure; nil
+	// uses the Exporter's cache when exporting through an Exporter
+	LayoutCache *layout.LayoutCache `json:"-"`
+	// Title is the page title (default: the app name)
+	Title string `json:"title"`
+	// Stamp adds a footer with version, export time and run; nil uses
+	// Options.Stamp when exporting through an Exporter
+	Stamp *Stamp `json:"stamp,omitempty"`
+}
+
+//go:embed templates/viewer.html
+var viewerTemplateSource string
+
+var viewerTemplate = template.Must(template.New("viewer").Parse(viewerTemplateSource))
+
+// htmlGraph is the graph data embedded in the viewer: the D3 export plus the
+// layout size and the title
+type htmlGraph struct {
+	Title  string    `json:"title"`
+	Width  float64   `json:"width"`
+	Height float64   `json:"height"`
+	Nodes  []d3Node  `json:"nodes"`
+	Links  []webLink `json:"links"`
+}
+
+// ExportGraphHTML renders a graph as a single self-contained HTML page with
+// an interactive viewer: pan by dragging, zoom with the mouse wheel, node
+// details on hover and filters by node type. Nodes are placed with
+// pkg/layout; the page loads no external resources.
+func ExportGraphHTML(g *graph.Graph, opts HTMLOptions) ([]byte, error) {
+	title := opts.Title
+	if title == "" {
+		title = g.AppName
+	}
+
+	nodes, links, gl, err := webElements(g, WebOptions{Layout: opts.Layout, LayoutCache: opts.LayoutCache})
+	if err != nil {
+		return nil, err
+	}
+
+	doc := htmlGraph{
+		Title:  title,
+		Width:  gl.Width,
+		Height: gl.Height,
+		Nodes:  d3Nodes(nodes, gl),
+		Links:  links,
+	}
+
+	// json.Marshal escapes <, > and &, so the data cannot close the script
+	// element it is embedded in
+	data, err := json.Marshal(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode graph: %w", err)
+	}
+
+	var stamp string
+	if opts.Stamp != nil {
+		stamp = opts.Stamp.text(g)
+	}
+
+	var buf bytes.Buffer
+	err = viewerTemplate.Execute(&buf, struct {
+		Title string
+		Stamp string
+		Data  template.JS
+	}{title, stamp, template.JS(data)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render HTML: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,58 @@
+package export
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var graphDataPattern = regexp.MustCompile(`(?s)<script id="graph-data" type="application/json">(.*?)</script>`)
+
+func TestExportGraphHTML(t *testing.T) {
+	g := createTestGraph()
+	require.NoError(t, g.UpdateNodeState("workflow1", graph.NodeStateFailed))
+	g.Nodes["spec1"].Properties = map[string]interface{}{"note": "</script><script>alert(1)</script>"}
+
+	data, err := ExportGraphHTML(g, HTMLOptions{Title: "Incident <42>"})
+	require.NoError(t, err)
+	content := string(data)
+
+	assert.True(t, strings.HasPrefix(content, "<!DOCTYPE html>"))
+	assert.Contains(t, content, "<title>Incident &lt;42&gt;</title>")
+	assert.NotContains(t, content, "alert(1)</script>", "embedded data must not close the script element")
+	assert.NotContains(t, content, "src=\"http", "the page must not load external resources")
+
+	match := graphDataPattern.FindStringSubmatch(content)
+	require.NotNil(t, match)
+	var doc struct {
+		Title string                   `json:"title"`
+		Width float64                  `json:"width"`
+		Nodes []map[string]interface{} `json:"nodes"`
+		Links []map[string]interface{} `json:"links"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(match[1]), &doc))
+	assert.Equal(t, "Incident <42>", doc.Title)
+	assert.Greater(t, doc.Width, 0.0)
+	require.Len(t, doc.Nodes, 3)
+	assert.Equal(t, "</script><script>alert(1)</script>", doc.Nodes[1]["properties"].(map[string]interface{})["note"])
+	assert.Equal(t, "failed", doc.Nodes[2]["state"])
+	assert.Contains(t, doc.Nodes[2], "x")
+	require.Len(t, doc.Links, 2)
+}
+
+func TestExportGraphHTML_DefaultTitle(t *testing.T) {
+	exporter := NewExporter()
+	defer exporter.Close()
+
+	data, err := exporter.ExportGraph(graph.NewGraph("empty-app"), FormatHTML)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "<title>empty-app</title>")
+	assert.Contains(t, string(data), `"nodes":[]`)
+	assert.Equal(t, "text/html; charset=utf-8", FormatHTML.ContentType())
+}
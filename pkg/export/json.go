@@ -0,0 +1,30 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// JSONOptions configures JSON export
+type JSONOptions struct {
+	// Indent pretty-prints the output
+	Indent bool `json:"indent"`
+}
+
+// ExportGraphJSON encodes a graph as JSON, using the same encoding as the
+// REST API
+func ExportGraphJSON(g *graph.Graph, opts JSONOptions) ([]byte, error) {
+	var data []byte
+	var err error
+	if opts.Indent {
+		data, err = json.MarshalIndent(g, "", "  ")
+	} else {
+		data, err = json.Marshal(g)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode graph: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,240 @@
+package export
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// MermaidOptions configures Mermaid export
+type MermaidOptions struct {
+	// Direction is the flowchart direction: TD (default), BT, LR or RL
+	Direction string `json:"direction"`
+	// Theme sets colors, shapes and fonts; nil uses Options.Theme when
+	// exporting through an Exporter, and LightTheme otherwise
+	Theme *Theme `json:"theme,omitempty"`
+	// Stamp adds a footer with version, export time and run; nil uses
+	// Options.Stamp when exporting through an Exporter
+	Stamp *Stamp `json:"stamp,omitempty"`
+}
+
+var mermaidUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// ExportGraphMermaid renders a graph as a Mermaid flowchart. Node shapes
+// reflect the node type, arrow styles mirror the DOT edge styles and the
+// fill and border colors match the DOT export.
+func ExportGraphMermaid(g *graph.Graph, opts MermaidOptions) ([]byte, error) {
+	direction := strings.ToUpper(opts.Direction)
+	switch direction {
+	case "":
+		direction = "TD"
+	case "TD", "TB", "BT", "LR", "RL":
+	default:
+		return nil, fmt.Errorf("unsupported Mermaid direction: %s", opts.Direction)
+	}
+	theme, err := ResolveTheme(opts.Theme)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf strings.Builder
+	if opts.Stamp != nil {
+		// Mermaid has no footer; the stamp is shown as the diagram title
+		fmt.Fprintf(&buf, "---\ntitle: %s\n---\n", strconv.Quote(opts.Stamp.text(g)))
+	}
+	buf.WriteString(mermaidInit(&theme))
+	fmt.Fprintf(&buf, "flowchart %s\n", direction)
+
+	ids := mermaidIDs(g)
+	nodes := sortedNodes(g)
+
+	for _, node := range nodes {
+		label := fmt.Sprintf("%s<br/>(%s)", node.Name, node.Type)
+		if node.State != "" && node.State != graph.NodeStateWaiting {
+			label += fmt.Sprintf("<br/>[%s]", node.State)
+		}
+		prefix, suffix := mermaidShape(theme.NodeShape(node.Type), node.Type)
+		fmt.Fprintf(&buf, "  %s%s\"%s\"%s\n", ids[node.ID], prefix, escapeMermaid(label), suffix)
+	}
+
+	if len(g.Edges) > 0 {
+		buf.WriteString("\n")
+	}
+	for _, edge := range sortedEdges(g) {
+		from, fromOK := ids[edge.FromNodeID]
+		to, toOK := ids[edge.ToNodeID]
+		if !fromOK || !toOK {
+			return nil, fmt.Errorf("edge %s references unknown node", edge.ID)
+		}
+		label := string(edge.Type)
+		if edge.Description != "" {
+			label += "<br/>" + edge.Description
+		}
+		fmt.Fprintf(&buf, "  %s %s|\"%s\"| %s\n", from, mermaidArrow(theme.EdgeStyle(edge.Type)), escapeMermaid(label), to)
+	}
+
+	// Styles come last: class definitions, then the assignments, which
+	// strict Mermaid versions reject for classes not yet defined
+	buf.WriteString("\n")
+	for _, nodeType := range mermaidNodeTypes {
+		fmt.Fprintf(&buf, "  classDef %s fill:%s", nodeType, theme.NodeFill(nodeType))
+		if theme.FontColor != "" {
+			fmt.Fprintf(&buf, ",color:%s", theme.FontColor)
+		}
+		buf.WriteString("\n")
+	}
+	for _, state := range mermaidStates {
+		fmt.Fprintf(&buf, "  classDef %s stroke:%s,stroke-width:2px\n", mermaidStateClass(state), theme.StateBorder(state))
+	}
+	for _, assignment := range mermaidClassAssignments(nodes, ids) {
+		fmt.Fprintf(&buf, "  class %s %s\n", strings.Join(assignment.ids, ","), assignment.class)
+	}
+
+	for _, node := range nodes {
+		if u := nodeURL(node); u != "" {
+			fmt.Fprintf(&buf, "  click %s href \"%s\" _blank\n", ids[node.ID], u)
+		}
+	}
+
+	return []byte(buf.String()), nil
+}
+
+// mermaidNodeTypes and mermaidStates are the node types and states that get
+// a Mermaid class, in definition order
+var (
+	mermaidNodeTypes = []graph.NodeType{graph.NodeTypeSpec, graph.NodeTypeWorkflow, graph.NodeTypeStep, graph.NodeTypeResource}
+	mermaidStates    = []graph.NodeState{graph.NodeStateRunning, graph.NodeStateFailed, graph.NodeStateSucceeded}
+)
+
+// mermaidClassAssignment assigns a class to a list of Mermaid node IDs
+type mermaidClassAssignment struct {
+	class string
+	ids   []string
+}
+
+// mermaidClassAssignments groups the nodes by type class and state class, in
+// the order the classes are defined. Nodes of other types get no class.
+func mermaidClassAssignments(nodes []*graph.Node, ids map[string]string) []mermaidClassAssignment {
+	var assignments []mermaidClassAssignment
+	add := func(class string, matches func(*graph.Node) bool) {
+		assignment := mermaidClassAssignment{class: class}
+		for _, node := range nodes {
+			if matches(node) {
+				assignment.ids = append(assignment.ids, ids[node.ID])
+			}
+		}
+		if len(assignment.ids) > 0 {
+			assignments = append(assignments, assignment)
+		}
+	}
+
+	for _, nodeType := range mermaidNodeTypes {
+		add(string(nodeType), func(node *graph.Node) bool { return node.Type == nodeType })
+	}
+	for _, state := range mermaidStates {
+		add(mermaidStateClass(state), func(node *graph.Node) bool { return node.State == state })
+	}
+	return assignments
+}
+
+// mermaidIDs maps node IDs to identifiers Mermaid accepts, keeping them
+// readable and unique
+func mermaidIDs(g *graph.Graph) map[string]string {
+	ids := make(map[string]string, len(g.Nodes))
+	used := make(map[string]bool, len(g.Nodes))
+	for _, node := range sortedNodes(g) {
+		id := mermaidUnsafe.ReplaceAllString(node.ID, "_")
+		if id == "" || (id[0] >= '0' && id[0] <= '9') || strings.EqualFold(id, "end") {
+			id = "n_" + id
+		}
+		candidate := id
+		for i := 2; used[candidate]; i++ {
+			candidate = fmt.Sprintf("%s_%d", id, i)
+		}
+		used[candidate] = true
+		ids[node.ID] = candidate
+	}
+	return ids
+}
+
+// mermaidShape returns the brackets of a node shape. Without a themed
+// shape, specs are stadiums, workflows subroutines and resources cylinders.
+func mermaidShape(shape NodeShape, nodeType graph.NodeType) (string, string) {
+	if shape == "" {
+		switch nodeType {
+		case graph.NodeTypeSpec:
+			shape = ShapeStadium
+		case graph.NodeTypeWorkflow:
+			shape = ShapeSubroutine
+		case graph.NodeTypeResource:
+			shape = ShapeCylinder
+		}
+	}
+
+	switch shape {
+	case ShapeRounded:
+		return "(", ")"
+	case ShapeStadium:
+		return "([", "])"
+	case ShapeSubroutine:
+		return "[[", "]]"
+	case ShapeCylinder:
+		return "[(", ")]"
+	case ShapeEllipse:
+		return "((", "))"
+	case ShapeHexagon:
+		return "{{", "}}"
+	case ShapeDiamond:
+		return "{", "}"
+	default:
+		return "[", "]"
+	}
+}
+
+// mermaidInit returns an init directive setting the theme's background and
+// font, or nothing if the theme leaves them to Mermaid
+func mermaidInit(theme *Theme) string {
+	var vars []string
+	if theme.Background != "" {
+		vars = append(vars, fmt.Sprintf("\"background\": \"%s\"", theme.Background))
+	}
+	if theme.FontName != "" {
+		vars = append(vars, fmt.Sprintf("\"fontFamily\": \"%s\"", theme.FontName))
+	}
+	if theme.FontSize > 0 {
+		vars = append(vars, fmt.Sprintf("\"fontSize\": \"%gpx\"", theme.FontSize))
+	}
+	if theme.FontColor != "" {
+		vars = append(vars, fmt.Sprintf("\"primaryTextColor\": \"%s\"", theme.FontColor))
+	}
+	if len(vars) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%%%%{init: {\"theme\": \"base\", \"themeVariables\": {%s}}}%%%%\n", strings.Join(vars, ", "))
+}
+
+// mermaidArrow maps the DOT edge styles to Mermaid links: solid -->, bold ==>,
+// dashed and dotted -.->
+func mermaidArrow(style string) string {
+	switch style {
+	case "bold":
+		return "==>"
+	case "dashed", "dotted":
+		return "-.->"
+	default:
+		return "-->"
+	}
+}
+
+func mermaidStateClass(state graph.NodeState) string {
+	return "state_" + string(state)
+}
+
+func escapeMermaid(label string) string {
+	label = strings.ReplaceAll(label, "\"", "#quot;")
+	label = strings.ReplaceAll(label, "\n", "<br/>")
+	return label
+}
@@ -0,0 +1,135 @@
+package export
+
+import (
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportGraphMermaid(t *testing.T) {
+	g := createTestGraph()
+	require.NoError(t, g.UpdateNodeState("workflow1", graph.NodeStateFailed))
+
+	data, err := ExportGraphMermaid(g, MermaidOptions{})
+	require.NoError(t, err)
+	content := string(data)
+
+	assert.True(t, strings.HasPrefix(content, "flowchart TD\n"))
+	assert.Contains(t, content, `spec1(["Database Spec<br/>(spec)"])`)
+	assert.Contains(t, content, `workflow1[["Deploy Database<br/>(workflow)<br/>[failed]"]]`)
+	assert.Contains(t, content, `resource1[("Database<br/>(resource)")]`)
+	assert.Contains(t, content, `workflow1 -->|"depends-on<br/>needs spec"| spec1`)
+	assert.Contains(t, content, `workflow1 ==>|"provisions<br/>creates database"| resource1`)
+	assert.Contains(t, content, "classDef workflow fill:#FFF9C4")
+	assert.Contains(t, content, "class workflow1 state_failed")
+
+	again, err := ExportGraphMermaid(g, MermaidOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, content, string(again), "export should be deterministic")
+}
+
+func TestExportGraphMermaid_Options(t *testing.T) {
+	data, err := ExportGraphMermaid(createTestGraph(), MermaidOptions{Direction: "lr"})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "flowchart LR\n"))
+
+	_, err = ExportGraphMermaid(createTestGraph(), MermaidOptions{Direction: "diagonal"})
+	assert.Error(t, err)
+}
+
+func TestMermaidIDs(t *testing.T) {
+	g := graph.NewGraph("ids")
+	for _, id := range []string{"my-app.db", "my_app_db", "1st", "end"} {
+		require.NoError(t, g.AddNode(&graph.Node{ID: id, Type: graph.NodeTypeResource, Name: id}))
+	}
+
+	ids := mermaidIDs(g)
+	assert.Equal(t, "n_1st", ids["1st"])
+	assert.Equal(t, "n_end", ids["end"])
+	assert.Equal(t, "my_app_db", ids["my-app.db"])
+	assert.Equal(t, "my_app_db_2", ids["my_app_db"])
+}
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// mermaidGoldenCases are exported to testdata/mermaid/<name>.mmd
+func mermaidGoldenCases(t *testing.T) map[string]func() ([]byte, error) {
+	t.Helper()
+
+	g := createTestGraph()
+	require.NoError(t, g.AddNodes([]*graph.Node{
+		{ID: "step-1", Type: graph.NodeTypeStep, Name: `Run "migrate"`, State: graph.NodeStateSucceeded},
+		{ID: "end", Type: graph.NodeTypeStep, Name: "Notify | done", State: graph.NodeStateRunning},
+	}))
+	require.NoError(t, g.AddEdges([]*graph.Edge{
+		{ID: "e3", FromNodeID: "workflow1", ToNodeID: "step-1", Type: graph.EdgeTypeContains},
+		{ID: "e4", FromNodeID: "workflow1", ToNodeID: "end", Type: graph.EdgeTypeContains},
+	}))
+	g.Nodes["workflow1"].State = graph.NodeStateFailed
+	g.Nodes["resource1"].Properties = map[string]interface{}{PropertyURL: "https://example.com/db"}
+
+	return map[string]func() ([]byte, error){
+		"default": func() ([]byte, error) {
+			return ExportGraphMermaid(g, MermaidOptions{})
+		},
+		"themed": func() ([]byte, error) {
+			return ExportGraphMermaid(g, MermaidOptions{
+				Direction: "LR",
+				Theme: &Theme{Name: "dark", NodeShapes: map[graph.NodeType]NodeShape{
+					graph.NodeTypeSpec:     ShapeDiamond,
+					graph.NodeTypeResource: ShapeHexagon,
+				}},
+				Stamp: &Stamp{GeneratedAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), RunID: "42"},
+			})
+		},
+	}
+}
+
+// TestExportGraphMermaid_Golden compares exports with testdata/mermaid; run
+// with -update to rewrite the files after intended changes
+func TestExportGraphMermaid_Golden(t *testing.T) {
+	for name, export := range mermaidGoldenCases(t) {
+		t.Run(name, func(t *testing.T) {
+			data, err := export()
+			require.NoError(t, err)
+
+			path := filepath.Join("testdata", "mermaid", name+".mmd")
+			if *updateGolden {
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+				require.NoError(t, os.WriteFile(path, data, 0o644))
+			}
+			expected, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), string(data))
+		})
+	}
+}
+
+// TestExportGraphMermaid_GoldenRenders renders the golden files with the
+// Mermaid CLI (mmdc) if it is installed
+func TestExportGraphMermaid_GoldenRenders(t *testing.T) {
+	mmdc, err := exec.LookPath("mmdc")
+	if err != nil {
+		t.Skip("mmdc not installed")
+	}
+
+	files, err := filepath.Glob(filepath.Join("testdata", "mermaid", "*.mmd"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "out.svg")
+			out, err := exec.Command(mmdc, "--quiet", "--input", file, "--output", output).CombinedOutput()
+			require.NoError(t, err, string(out))
+		})
+	}
+}
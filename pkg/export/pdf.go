@@ -0,0 +1,221 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"math"
+	"strings"
+)
+
+// PDFOptions configures PDF export. go-graphviz cannot render PDF, so the
+// graph is rendered as PNG and placed on PDF pages; graphs too large for one
+// page are split into tiles across several pages.
+type PDFOptions struct {
+	// PageSize is A4 (default), A3 or Letter
+	PageSize string `json:"page_size"`
+	// Landscape rotates the page
+	Landscape bool `json:"landscape"`
+	// MinScale is the smallest factor the graph may be shrunk by to fit on a
+	// single page (default 0.5). Below it, the graph keeps that scale and
+	// spans several pages.
+	MinScale float64 `json:"min_scale"`
+}
+
+// pdfPageSizes holds page widths and heights in points
+var pdfPageSizes = map[string][2]float64{
+	"A4":     {595, 842},
+	"A3":     {842, 1191},
+	"LETTER": {612, 792},
+}
+
+const (
+	pdfMargin = 36 // Half an inch
+	// pdfPointsPerPixel converts Graphviz pixels (96 dpi) to points (72 dpi)
+	pdfPointsPerPixel = 72.0 / 96.0
+)
+
+// pdfTile is the part of the image shown on one page
+type pdfTile struct {
+	bounds image.Rectangle
+	scale  float64 // Points per pixel
+}
+
+// encodePDF returns the PDF written by writePDF
+func encodePDF(img image.Image, opts PDFOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writePDF(&buf, img, opts); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pdfWriter counts the bytes written, for the cross-reference table, and
+// keeps the first write error
+type pdfWriter struct {
+	w   *bufio.Writer
+	n   int
+	err error
+}
+
+func (pw *pdfWriter) Write(p []byte) (int, error) {
+	if pw.err != nil {
+		return 0, pw.err
+	}
+	n, err := pw.w.Write(p)
+	pw.n += n
+	pw.err = err
+	return n, err
+}
+
+// writePDF places img on one or more pages and writes the document to w.
+// Every page's image is compressed and written before the next is encoded.
+func writePDF(w io.Writer, img image.Image, opts PDFOptions) error {
+	pageSize := opts.PageSize
+	if pageSize == "" {
+		pageSize = "A4"
+	}
+	size, ok := pdfPageSizes[strings.ToUpper(pageSize)]
+	if !ok {
+		return fmt.Errorf("unsupported PDF page size: %s", opts.PageSize)
+	}
+	pageWidth, pageHeight := size[0], size[1]
+	if opts.Landscape {
+		pageWidth, pageHeight = pageHeight, pageWidth
+	}
+	minScale := opts.MinScale
+	if minScale <= 0 || minScale > 1 {
+		minScale = 0.5
+	}
+
+	if img.Bounds().Empty() {
+		return fmt.Errorf("cannot write an empty image to PDF")
+	}
+	tiles := pdfTiles(img.Bounds(), pageWidth-2*pdfMargin, pageHeight-2*pdfMargin, minScale)
+
+	pw := &pdfWriter{w: bufio.NewWriter(w)}
+	var offsets []int
+	object := func(body string, stream []byte) {
+		offsets = append(offsets, pw.n)
+		fmt.Fprintf(pw, "%d 0 obj\n%s\n", len(offsets), body)
+		if stream != nil {
+			io.WriteString(pw, "stream\n")
+			pw.Write(stream)
+			io.WriteString(pw, "\nendstream\n")
+		}
+		io.WriteString(pw, "endobj\n")
+	}
+
+	fmt.Fprintf(pw, "%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1 and 2 are the catalog and the page tree; every page takes
+	// three objects: the page, its content stream and its image
+	kids := make([]string, len(tiles))
+	for i := range tiles {
+		kids[i] = fmt.Sprintf("%d 0 R", 3+3*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>", nil)
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(tiles)), nil)
+
+	for i, tile := range tiles {
+		contentObject, imageObject := 4+3*i, 5+3*i
+		width := float64(tile.bounds.Dx()) * tile.scale
+		height := float64(tile.bounds.Dy()) * tile.scale
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /XObject << /Im%d %d 0 R >> >> /Contents %d 0 R >>",
+			pdfNumber(pageWidth), pdfNumber(pageHeight), i, imageObject, contentObject), nil)
+
+		// Tiles start at the top left corner of the printable area
+		content := fmt.Sprintf("q %s 0 0 %s %s %s cm /Im%d Do Q",
+			pdfNumber(width), pdfNumber(height), pdfNumber(pdfMargin), pdfNumber(pageHeight-pdfMargin-height), i)
+		object(fmt.Sprintf("<< /Length %d >>", len(content)), []byte(content))
+
+		pixels, err := pdfImageData(img, tile.bounds)
+		if err != nil {
+			return err
+		}
+		object(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode /Length %d >>",
+			tile.bounds.Dx(), tile.bounds.Dy(), len(pixels)), pixels)
+	}
+
+	xref := pw.n
+	fmt.Fprintf(pw, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(pw, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(pw, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	if pw.err == nil {
+		pw.err = pw.w.Flush()
+	}
+	if pw.err != nil {
+		return fmt.Errorf("failed to write PDF: %w", pw.err)
+	}
+	return nil
+}
+
+// pdfTiles splits a non-empty image into page-sized tiles. The image is drawn at its
+// natural size, shrunk to fit one page if that needs a scale of at least
+// minScale, and otherwise drawn at minScale (or at the scale fitting its
+// height) across as many pages as needed, row by row.
+func pdfTiles(bounds image.Rectangle, width, height, minScale float64) []pdfTile {
+	natural := pdfPointsPerPixel
+	imageWidth := float64(bounds.Dx()) * natural
+	imageHeight := float64(bounds.Dy()) * natural
+
+	fit := math.Min(1, math.Min(width/imageWidth, height/imageHeight))
+	if fit >= minScale {
+		return []pdfTile{{bounds: bounds, scale: natural * fit}}
+	}
+
+	// Prefer splitting only horizontally when the height fits at minScale
+	scale := math.Max(minScale, math.Min(1, height/imageHeight))
+	pointsPerPixel := natural * scale
+	tileWidth := max(1, int(width/pointsPerPixel))
+	tileHeight := max(1, int(height/pointsPerPixel))
+
+	var tiles []pdfTile
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += tileHeight {
+		for x := bounds.Min.X; x < bounds.Max.X; x += tileWidth {
+			tiles = append(tiles, pdfTile{
+				bounds: image.Rect(x, y, min(x+tileWidth, bounds.Max.X), min(y+tileHeight, bounds.Max.Y)),
+				scale:  pointsPerPixel,
+			})
+		}
+	}
+	return tiles
+}
+
+// pdfImageData returns the zlib-compressed RGB pixels of a part of img,
+// composited over white
+func pdfImageData(img image.Image, bounds image.Rectangle) ([]byte, error) {
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Over)
+
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	row := make([]byte, 3*bounds.Dx())
+	for y := 0; y < bounds.Dy(); y++ {
+		pixels := rgba.Pix[y*rgba.Stride:]
+		for x := 0; x < bounds.Dx(); x++ {
+			copy(row[3*x:3*x+3], pixels[4*x:4*x+3])
+		}
+		if _, err := w.Write(row); err != nil {
+			return nil, fmt.Errorf("failed to compress image: %w", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func pdfNumber(value float64) string {
+	return fmt.Sprintf("%.2f", value)
+}
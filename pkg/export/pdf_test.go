@@ -0,0 +1,134 @@
+package export
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func solidImage(width, height int, c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+var pdfPageCount = regexp.MustCompile(`/Type /Pages /Kids \[[^\]]*\] /Count (\d+)`)
+
+func pdfPages(t *testing.T, data []byte) int {
+	t.Helper()
+	match := pdfPageCount.FindSubmatch(data)
+	require.NotNil(t, match)
+	count, err := strconv.Atoi(string(match[1]))
+	require.NoError(t, err)
+	return count
+}
+
+// assertValidXref checks that every xref entry points at its object
+func assertValidXref(t *testing.T, data []byte) {
+	t.Helper()
+	start := bytes.LastIndex(data, []byte("startxref\n"))
+	require.GreaterOrEqual(t, start, 0)
+	xref, err := strconv.Atoi(string(bytes.Fields(data[start+len("startxref\n"):])[0]))
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(data[xref:], []byte("xref\n")))
+
+	lines := bytes.Split(data[xref:], []byte("\n"))
+	for i, line := range lines[3:] {
+		if !bytes.HasSuffix(line, []byte(" n ")) {
+			break
+		}
+		offset, err := strconv.Atoi(string(line[:10]))
+		require.NoError(t, err)
+		assert.True(t, bytes.HasPrefix(data[offset:], []byte(fmt.Sprintf("%d 0 obj\n", i+1))), "object %d", i+1)
+	}
+}
+
+func TestEncodePDF_SinglePage(t *testing.T) {
+	data, err := encodePDF(solidImage(400, 300, color.RGBA{R: 255, A: 255}), PDFOptions{})
+	require.NoError(t, err)
+
+	assert.True(t, bytes.HasPrefix(data, []byte("%PDF-1.4\n")))
+	assert.True(t, bytes.HasSuffix(data, []byte("%%EOF\n")))
+	assert.Equal(t, 1, pdfPages(t, data))
+	assert.Contains(t, string(data), "/MediaBox [0 0 595.00 842.00]")
+	assert.Contains(t, string(data), "/Width 400 /Height 300")
+	// 400 x 300 pixels at 96 dpi are 300 x 225 points
+	assert.Contains(t, string(data), "q 300.00 0 0 225.00 36.00 581.00 cm /Im0 Do Q")
+	assertValidXref(t, data)
+}
+
+func TestEncodePDF_ImageData(t *testing.T) {
+	data, err := encodePDF(solidImage(2, 1, color.Transparent), PDFOptions{})
+	require.NoError(t, err)
+
+	start := bytes.Index(data, []byte("/FlateDecode"))
+	require.GreaterOrEqual(t, start, 0)
+	stream := data[bytes.Index(data[start:], []byte("stream\n"))+start+len("stream\n"):]
+	r, err := zlib.NewReader(bytes.NewReader(stream))
+	require.NoError(t, err)
+	pixels, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{255, 255, 255, 255, 255, 255}, pixels, "transparent pixels are drawn on white")
+}
+
+func TestEncodePDF_MultiPage(t *testing.T) {
+	// Fits on one A4 page only when shrunk to about a ninth, below MinScale
+	wide := solidImage(6000, 200, color.Black)
+
+	data, err := encodePDF(wide, PDFOptions{})
+	require.NoError(t, err)
+	// The height fits at natural size, so the graph is split horizontally
+	// into pages of (595 - 72) / 0.75 = 697 pixels
+	assert.Equal(t, 9, pdfPages(t, data))
+	assert.Contains(t, string(data), "/Width 697 /Height 200")
+	assertValidXref(t, data)
+
+	data, err = encodePDF(wide, PDFOptions{PageSize: "a3", Landscape: true})
+	require.NoError(t, err)
+	assert.Equal(t, 5, pdfPages(t, data))
+	assert.Contains(t, string(data), "/MediaBox [0 0 1191.00 842.00]")
+
+	data, err = encodePDF(wide, PDFOptions{MinScale: 0.1})
+	require.NoError(t, err)
+	assert.Equal(t, 1, pdfPages(t, data), "shrinking to fit is allowed down to MinScale")
+
+	large := solidImage(3000, 3000, color.Black)
+	data, err = encodePDF(large, PDFOptions{})
+	require.NoError(t, err)
+	// At scale 0.5 a page shows 1394 x 2047 pixels
+	assert.Equal(t, 3*2, pdfPages(t, data))
+	assertValidXref(t, data)
+}
+
+func TestEncodePDF_Errors(t *testing.T) {
+	_, err := encodePDF(solidImage(10, 10, color.Black), PDFOptions{PageSize: "B5"})
+	assert.Error(t, err)
+
+	_, err = encodePDF(image.NewRGBA(image.Rect(0, 0, 0, 0)), PDFOptions{})
+	assert.Error(t, err)
+}
+
+// Rendering needs a working Graphviz runtime, like the SVG and PNG tests
+func TestExporter_ExportGraph_PDFViaPNG(t *testing.T) {
+	exporter := NewExporter()
+	defer exporter.Close()
+
+	data, err := exporter.ExportGraph(createTestGraph(), FormatPDF)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(data, []byte("%PDF-")))
+	assert.Equal(t, 1, pdfPages(t, data))
+	assert.Equal(t, "application/pdf", FormatPDF.ContentType())
+}
@@ -0,0 +1,106 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// PlantUMLOptions configures PlantUML export
+type PlantUMLOptions struct {
+	// Direction is the diagram direction: TD (default) or LR
+	Direction string `json:"direction"`
+	// Stamp adds a footer with version, export time and run; nil uses
+	// Options.Stamp when exporting through an Exporter
+	Stamp *Stamp `json:"stamp,omitempty"`
+}
+
+// ExportGraphPlantUML renders a graph as a PlantUML deployment diagram. Like
+// the Mermaid export, element shapes reflect the node type, arrow styles
+// mirror the DOT edge styles and colors match the DOT export.
+func ExportGraphPlantUML(g *graph.Graph, opts PlantUMLOptions) ([]byte, error) {
+	var buf strings.Builder
+	buf.WriteString("@startuml\n")
+
+	switch strings.ToUpper(opts.Direction) {
+	case "", "TD", "TB":
+		buf.WriteString("top to bottom direction\n")
+	case "LR":
+		buf.WriteString("left to right direction\n")
+	default:
+		return nil, fmt.Errorf("unsupported PlantUML direction: %s", opts.Direction)
+	}
+	buf.WriteString("\n")
+
+	// Mermaid identifiers are valid PlantUML aliases
+	ids := mermaidIDs(g)
+
+	for _, node := range sortedNodes(g) {
+		label := fmt.Sprintf("%s\n(%s)", node.Name, node.Type)
+		if node.State != "" && node.State != graph.NodeStateWaiting {
+			label += fmt.Sprintf("\n[%s]", node.State)
+		}
+		color := defaultTheme.NodeFill(node.Type)
+		switch node.State {
+		case graph.NodeStateRunning, graph.NodeStateFailed, graph.NodeStateSucceeded:
+			color += fmt.Sprintf(";line:%s;line.bold", strings.TrimPrefix(defaultTheme.StateBorder(node.State), "#"))
+		}
+		fmt.Fprintf(&buf, "%s \"%s\" as %s %s\n", plantUMLElement(node.Type), escapePlantUML(label), ids[node.ID], color)
+	}
+
+	if len(g.Edges) > 0 {
+		buf.WriteString("\n")
+	}
+	for _, edge := range sortedEdges(g) {
+		from, fromOK := ids[edge.FromNodeID]
+		to, toOK := ids[edge.ToNodeID]
+		if !fromOK || !toOK {
+			return nil, fmt.Errorf("edge %s references unknown node", edge.ID)
+		}
+		label := string(edge.Type)
+		if edge.Description != "" {
+			label += "\n" + edge.Description
+		}
+		fmt.Fprintf(&buf, "%s %s %s : %s\n", from, plantUMLArrow(edge.Type), to, escapePlantUML(label))
+	}
+
+	if opts.Stamp != nil {
+		fmt.Fprintf(&buf, "\nfooter %s\n", escapePlantUML(opts.Stamp.text(g)))
+	}
+
+	buf.WriteString("@enduml\n")
+	return []byte(buf.String()), nil
+}
+
+// plantUMLElement mirrors the Mermaid shapes: spec stadium, workflow
+// subroutine, step box and resource cylinder
+func plantUMLElement(nodeType graph.NodeType) string {
+	switch nodeType {
+	case graph.NodeTypeSpec:
+		return "usecase"
+	case graph.NodeTypeWorkflow:
+		return "component"
+	case graph.NodeTypeResource:
+		return "database"
+	default:
+		return "rectangle"
+	}
+}
+
+// plantUMLArrow returns an arrow with the DOT edge color and style
+func plantUMLArrow(edgeType graph.EdgeType) string {
+	style := defaultTheme.EdgeStyle(edgeType)
+	if style == "solid" {
+		return fmt.Sprintf("-[%s]->", defaultTheme.EdgeColor(edgeType))
+	}
+	return fmt.Sprintf("-[%s,%s]->", defaultTheme.EdgeColor(edgeType), style)
+}
+
+// escapePlantUML makes a label safe for a quoted PlantUML string, which has
+// no escape for double quotes
+func escapePlantUML(label string) string {
+	label = strings.ReplaceAll(label, "\"", "'")
+	label = strings.ReplaceAll(label, "\n", "\\n")
+	return label
+}
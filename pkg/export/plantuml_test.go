@@ -0,0 +1,42 @@
+package export
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportGraphPlantUML(t *testing.T) {
+	g := createTestGraph()
+	require.NoError(t, g.UpdateNodeState("workflow1", graph.NodeStateFailed))
+	g.Nodes["spec1"].Name = `Database "primary" Spec`
+
+	data, err := ExportGraphPlantUML(g, PlantUMLOptions{})
+	require.NoError(t, err)
+	content := string(data)
+
+	assert.True(t, strings.HasPrefix(content, "@startuml\ntop to bottom direction\n"))
+	assert.True(t, strings.HasSuffix(content, "@enduml\n"))
+	assert.Contains(t, content, `usecase "Database 'primary' Spec\n(spec)" as spec1 #E3F2FD`+"\n")
+	assert.Contains(t, content, `component "Deploy Database\n(workflow)\n[failed]" as workflow1 #FFF9C4;line:red;line.bold`)
+	assert.Contains(t, content, `database "Database\n(resource)" as resource1 #C8E6C9`+"\n")
+	assert.Contains(t, content, `workflow1 -[#1976D2]-> spec1 : depends-on\nneeds spec`)
+	assert.Contains(t, content, `workflow1 -[#388E3C,bold]-> resource1 : provisions\ncreates database`)
+
+	again, err := ExportGraphPlantUML(g, PlantUMLOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, content, string(again), "export should be deterministic")
+}
+
+func TestExportGraphPlantUML_Options(t *testing.T) {
+	data, err := ExportGraphPlantUML(createTestGraph(), PlantUMLOptions{Direction: "lr"})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "left to right direction\n")
+
+	_, err = ExportGraphPlantUML(createTestGraph(), PlantUMLOptions{Direction: "RL"})
+	assert.Error(t, err)
+}
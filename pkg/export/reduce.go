@@ -0,0 +1,195 @@
+package export
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// Properties set on nodes and edges that stand for several of the graph
+const (
+	// PropertyCollapsedSteps holds the number of steps a collapsed workflow
+	// node stands for
+	PropertyCollapsedSteps = "collapsed_steps"
+	// PropertyEdgeCount holds the number of edges an aggregated edge stands for
+	PropertyEdgeCount = "edge_count"
+)
+
+// Reduce shrinks large graphs so that exports stay readable. The steps are
+// applied in field order: focus, collapse, aggregate, sample. The zero Reduce
+// exports everything.
+type Reduce struct {
+	// Focus keeps only the nodes within Depth edges of this node, following
+	// edges in both directions. Depth 0 keeps all nodes connected to it.
+	Focus string `json:"focus,omitempty"`
+	Depth int    `json:"depth,omitempty"`
+	// CollapseWorkflows draws each workflow and its steps as one node, e.g.
+	// "Deploy (12 steps)". Edges of the steps are moved to the workflow.
+	CollapseWorkflows bool `json:"collapse_workflows,omitempty"`
+	// AggregateEdges merges edges of the same type between the same nodes
+	// into one edge, e.g. "3 edges"
+	AggregateEdges bool `json:"aggregate_edges,omitempty"`
+	// MaxEdges keeps at most this many edges, picked evenly from the edges
+	// ordered by ID; 0 keeps all edges
+	MaxEdges int `json:"max_edges,omitempty"`
+}
+
+// IsZero reports whether the reduction keeps the graph as it is
+func (r Reduce) IsZero() bool {
+	return r.Focus == "" && !r.CollapseWorkflows && !r.AggregateEdges && r.MaxEdges == 0
+}
+
+// Validate checks that depth and edge limit are not negative
+func (r Reduce) Validate() error {
+	if r.Depth < 0 {
+		return fmt.Errorf("depth must not be negative: %d", r.Depth)
+	}
+	if r.MaxEdges < 0 {
+		return fmt.Errorf("max edges must not be negative: %d", r.MaxEdges)
+	}
+	return nil
+}
+
+// Apply returns the reduced graph, or g itself if the reduction is zero.
+// Nodes and edges of the result are copies; g is left untouched.
+func (r Reduce) Apply(g *graph.Graph) (*graph.Graph, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	if r.IsZero() {
+		return g, nil
+	}
+
+	ids := make([]string, 0, len(g.Nodes))
+	if r.Focus != "" {
+		if _, exists := g.Nodes[r.Focus]; !exists {
+			return nil, fmt.Errorf("focus node %s not found", r.Focus)
+		}
+		ids = neighbourhood(g, r.Focus, r.Depth)
+	} else {
+		for id := range g.Nodes {
+			ids = append(ids, id)
+		}
+	}
+	reduced := g.Subgraph(ids)
+
+	if r.CollapseWorkflows {
+		collapseWorkflows(reduced)
+	}
+	if r.AggregateEdges {
+		aggregateEdges(reduced)
+	}
+	if r.MaxEdges > 0 && len(reduced.Edges) > r.MaxEdges {
+		edges := sortedEdges(reduced)
+		reduced.Edges = make(map[string]*graph.Edge, r.MaxEdges)
+		for i := 0; i < r.MaxEdges; i++ {
+			edge := edges[i*len(edges)/r.MaxEdges]
+			reduced.Edges[edge.ID] = edge
+		}
+	}
+
+	reduced.RebuildIndex()
+	return reduced, nil
+}
+
+// neighbourhood returns the nodes within depth edges of the given node in
+// either direction; depth 0 means no limit
+func neighbourhood(g *graph.Graph, nodeID string, depth int) []string {
+	distance := map[string]int{nodeID: 0}
+	queue := []string{nodeID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if depth > 0 && distance[id] >= depth {
+			continue
+		}
+
+		var neighbours []string
+		for _, edge := range g.OutgoingEdges(id) {
+			neighbours = append(neighbours, edge.ToNodeID)
+		}
+		for _, edge := range g.IncomingEdges(id) {
+			neighbours = append(neighbours, edge.FromNodeID)
+		}
+		for _, neighbour := range neighbours {
+			if _, seen := distance[neighbour]; !seen {
+				distance[neighbour] = distance[id] + 1
+				queue = append(queue, neighbour)
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(distance))
+	for id := range distance {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// collapseWorkflows replaces the steps of each workflow in g by the workflow
+// itself. Contains edges and edges between steps of the same workflow are
+// dropped.
+func collapseWorkflows(g *graph.Graph) {
+	parents := ganttParents(g)
+	if len(parents) == 0 {
+		return
+	}
+
+	counts := make(map[string]int)
+	for step, workflow := range parents {
+		counts[workflow]++
+		delete(g.Nodes, step)
+	}
+	for id, count := range counts {
+		workflow := g.Nodes[id]
+		workflow.Name = fmt.Sprintf("%s (%d steps)", workflow.Name, count)
+		if workflow.Properties == nil {
+			workflow.Properties = make(map[string]interface{})
+		}
+		workflow.Properties[PropertyCollapsedSteps] = count
+	}
+
+	for id, edge := range g.Edges {
+		if parent, ok := parents[edge.FromNodeID]; ok {
+			edge.FromNodeID = parent
+		}
+		if parent, ok := parents[edge.ToNodeID]; ok {
+			edge.ToNodeID = parent
+		}
+		if edge.Type == graph.EdgeTypeContains || edge.FromNodeID == edge.ToNodeID {
+			delete(g.Edges, id)
+		}
+	}
+}
+
+// aggregateEdges merges edges with the same endpoints and type into the one
+// with the lowest ID
+func aggregateEdges(g *graph.Graph) {
+	type edgeKey struct {
+		from, to string
+		edgeType graph.EdgeType
+	}
+
+	groups := make(map[edgeKey][]*graph.Edge)
+	for _, edge := range sortedEdges(g) {
+		key := edgeKey{edge.FromNodeID, edge.ToNodeID, edge.Type}
+		groups[key] = append(groups[key], edge)
+	}
+
+	for _, edges := range groups {
+		if len(edges) == 1 {
+			continue
+		}
+		kept := edges[0]
+		kept.Description = fmt.Sprintf("%d edges", len(edges))
+		if kept.Properties == nil {
+			kept.Properties = make(map[string]interface{})
+		}
+		kept.Properties[PropertyEdgeCount] = len(edges)
+		for _, edge := range edges[1:] {
+			delete(g.Edges, edge.ID)
+		}
+	}
+}
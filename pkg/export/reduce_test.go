@@ -0,0 +1,107 @@
+package export
+
+import (
+	"testing"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createReduceTestGraph extends the test graph with two steps of workflow1
+// that both configure resource1, and an unconnected resource
+func createReduceTestGraph(t *testing.T) *graph.Graph {
+	g := createTestGraph()
+	require.NoError(t, g.AddNodes([]*graph.Node{
+		{ID: "step1", Type: graph.NodeTypeStep, Name: "Create"},
+		{ID: "step2", Type: graph.NodeTypeStep, Name: "Migrate"},
+		{ID: "other", Type: graph.NodeTypeResource, Name: "Cache"},
+	}))
+	require.NoError(t, g.AddEdges([]*graph.Edge{
+		{ID: "e3", FromNodeID: "workflow1", ToNodeID: "step1", Type: graph.EdgeTypeContains},
+		{ID: "e4", FromNodeID: "workflow1", ToNodeID: "step2", Type: graph.EdgeTypeContains},
+		{ID: "e5", FromNodeID: "step1", ToNodeID: "resource1", Type: graph.EdgeTypeConfigures},
+		{ID: "e6", FromNodeID: "step2", ToNodeID: "resource1", Type: graph.EdgeTypeConfigures},
+	}))
+	return g
+}
+
+func TestReduce_Apply(t *testing.T) {
+	g := createReduceTestGraph(t)
+
+	tests := []struct {
+		name   string
+		reduce Reduce
+		nodes  []string
+		edges  []string
+	}{
+		{"zero", Reduce{}, []string{"other", "resource1", "spec1", "step1", "step2", "workflow1"}, []string{"e1", "e2", "e3", "e4", "e5", "e6"}},
+		{"focus depth 1", Reduce{Focus: "spec1", Depth: 1}, []string{"spec1", "workflow1"}, []string{"e1"}},
+		{"focus depth 2", Reduce{Focus: "spec1", Depth: 2}, []string{"resource1", "spec1", "step1", "step2", "workflow1"}, []string{"e1", "e2", "e3", "e4", "e5", "e6"}},
+		{"focus unlimited", Reduce{Focus: "other"}, []string{"other"}, nil},
+		{"collapse", Reduce{CollapseWorkflows: true}, []string{"other", "resource1", "spec1", "workflow1"}, []string{"e1", "e2", "e5", "e6"}},
+		{"collapse and aggregate", Reduce{CollapseWorkflows: true, AggregateEdges: true}, []string{"other", "resource1", "spec1", "workflow1"}, []string{"e1", "e2", "e5"}},
+		{"max edges", Reduce{MaxEdges: 2}, []string{"other", "resource1", "spec1", "step1", "step2", "workflow1"}, []string{"e1", "e4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reduced, err := tt.reduce.Apply(g)
+			require.NoError(t, err)
+
+			var nodes, edges []string
+			for _, node := range sortedNodes(reduced) {
+				nodes = append(nodes, node.ID)
+			}
+			for _, edge := range sortedEdges(reduced) {
+				edges = append(edges, edge.ID)
+			}
+			assert.Equal(t, tt.nodes, nodes)
+			assert.Equal(t, tt.edges, edges)
+		})
+	}
+}
+
+func TestReduce_CollapseAndAggregate(t *testing.T) {
+	g := createReduceTestGraph(t)
+
+	reduced, err := Reduce{CollapseWorkflows: true, AggregateEdges: true}.Apply(g)
+	require.NoError(t, err)
+
+	workflow := reduced.Nodes["workflow1"]
+	assert.Equal(t, "Deploy Database (2 steps)", workflow.Name)
+	assert.Equal(t, 2, workflow.Properties[PropertyCollapsedSteps])
+
+	edge := reduced.Edges["e5"]
+	assert.Equal(t, "workflow1", edge.FromNodeID)
+	assert.Equal(t, "2 edges", edge.Description)
+	assert.Equal(t, 2, edge.Properties[PropertyEdgeCount])
+	assert.Len(t, reduced.OutgoingEdges("workflow1"), 3)
+
+	// The source graph is left untouched
+	assert.Equal(t, "Deploy Database", g.Nodes["workflow1"].Name)
+	assert.Nil(t, g.Nodes["workflow1"].Properties)
+	assert.Equal(t, "step1", g.Edges["e5"].FromNodeID)
+	assert.Len(t, g.Nodes, 6)
+}
+
+func TestReduce_Invalid(t *testing.T) {
+	g := createReduceTestGraph(t)
+
+	_, err := Reduce{Focus: "missing"}.Apply(g)
+	assert.ErrorContains(t, err, "focus node missing not found")
+	assert.Error(t, Reduce{Depth: -1}.Validate())
+	assert.Error(t, Reduce{MaxEdges: -1}.Validate())
+}
+
+func TestExporter_ExportGraph_Reduce(t *testing.T) {
+	exporter := NewExporter()
+	defer exporter.Close()
+
+	data, err := exporter.ExportGraphWithOptions(createReduceTestGraph(t), FormatMermaid, Options{
+		Reduce: Reduce{CollapseWorkflows: true},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "Deploy Database (2 steps)")
+	assert.NotContains(t, string(data), "Migrate")
+}
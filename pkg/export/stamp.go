@@ -0,0 +1,43 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// Stamp adds a footer identifying the state a diagram was exported from, so
+// that screenshots can be traced back to it. DOT, SVG, PNG, PDF, native SVG,
+// Mermaid, PlantUML, D2 and HTML exports support it.
+type Stamp struct {
+	// Version is the graph version; 0 uses the version of the exported graph
+	Version int `json:"version,omitempty"`
+	// GeneratedAt is the export time; the zero time uses the current time
+	GeneratedAt time.Time `json:"generated_at,omitempty"`
+	// RunID identifies the run whose state is shown, if any
+	RunID string `json:"run_id,omitempty"`
+}
+
+// text returns the footer line, e.g.
+// "test-app v3 · generated 2024-05-01T10:00:00Z · run 42"
+func (s *Stamp) text(g *graph.Graph) string {
+	version := s.Version
+	if version == 0 {
+		version = g.Version
+	}
+	generatedAt := s.GeneratedAt
+	if generatedAt.IsZero() {
+		generatedAt = time.Now()
+	}
+
+	parts := []string{
+		fmt.Sprintf("%s v%d", g.AppName, version),
+		"generated " + generatedAt.UTC().Format(time.RFC3339),
+	}
+	if s.RunID != "" {
+		parts = append(parts, "run "+s.RunID)
+	}
+	return strings.Join(parts, " · ")
+}
@@ -0,0 +1,58 @@
+package export
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStamp_Text(t *testing.T) {
+	g := createTestGraph()
+	g.Version = 3
+	generatedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	stamp := &Stamp{GeneratedAt: generatedAt, RunID: "42"}
+	assert.Equal(t, "test-app v3 · generated 2024-05-01T10:00:00Z · run 42", stamp.text(g))
+
+	stamp = &Stamp{Version: 7, GeneratedAt: generatedAt}
+	assert.Equal(t, "test-app v7 · generated 2024-05-01T10:00:00Z", stamp.text(g))
+
+	stamp = &Stamp{}
+	assert.Contains(t, stamp.text(g), "generated "+time.Now().UTC().Format("2006-01-02"))
+}
+
+func TestExporter_Stamp(t *testing.T) {
+	exporter := NewExporter()
+	defer exporter.Close()
+
+	g := createTestGraph()
+	opts := Options{Stamp: &Stamp{GeneratedAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), RunID: "42"}}
+	text := "test-app v1 · generated 2024-05-01T10:00:00Z · run 42"
+
+	tests := []struct {
+		format   Format
+		expected string
+	}{
+		{FormatDOT, "  label=\"" + text + "\";\n  labelloc=b;\n"},
+		{FormatSVGNative, `<text class="stamp"`},
+		{FormatMermaid, "---\ntitle: \"" + text + "\"\n---\n"},
+		{FormatPlantUML, "footer " + text + "\n@enduml"},
+		{FormatD2, "__stamp: \"" + text + "\" {\n  shape: text\n  near: bottom-right\n"},
+		{FormatHTML, `<div id="stamp">` + text + `</div>`},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			data, err := exporter.ExportGraphWithOptions(g, tt.format, opts)
+			require.NoError(t, err)
+			assert.Contains(t, string(data), tt.expected)
+			assert.Contains(t, string(data), text)
+
+			data, err = exporter.ExportGraph(g, tt.format)
+			require.NoError(t, err)
+			assert.False(t, strings.Contains(string(data), "generated "), "unstamped export contains a stamp")
+		})
+	}
+}
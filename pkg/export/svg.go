@@ -0,0 +1,341 @@
+package export
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/layout"
+)
+
+// SVGOptions configures the native SVG export
+type SVGOptions struct {
+	// Layout configures the node positions; the hierarchical layout is used
+	// by default
+	Layout layout.LayoutOptions `json:"layout"`
+	// LayoutCache reuses layouts of graphs with an unchanged structure; nil
+	// uses the Exporter's cache when exporting through an Exporter
+	LayoutCache *layout.LayoutCache `json:"-"`
+	// Theme sets colors, shapes and fonts; nil uses Options.Theme when
+	// exporting through an Exporter, and LightTheme otherwise
+	Theme *Theme `json:"theme,omitempty"`
+	// StateFill fills nodes by state instead of by type
+	StateFill bool `json:"state_fill"`
+	// Stamp adds a footer with version, export time and run; nil uses
+	// Options.Stamp when exporting through an Exporter
+	Stamp *Stamp `json:"stamp,omitempty"`
+}
+
+// svgMargin is the space around the drawing, svgStampHeight the space added
+// below it for the stamp
+const (
+	svgMargin      = 20
+	svgStampHeight = 16
+)
+
+// ExportGraphSVG draws a graph as SVG without Graphviz, placing nodes with
+// pkg/layout. Nodes are drawn like in the DOT export: rounded boxes (or the
+// theme's shapes) labeled with name, type and state, filled by type and
+// bordered by state. Edges are straight lines between the node borders,
+// labeled with their type. Nodes with a url property are links. Swimlane and
+// timeline layouts get shaded, labeled lanes, clustered layouts a dashed box
+// around each workflow and its steps.
+func ExportGraphSVG(g *graph.Graph, opts SVGOptions) ([]byte, error) {
+	theme, err := ResolveTheme(opts.Theme)
+	if err != nil {
+		return nil, err
+	}
+	gl, err := opts.LayoutCache.ComputeLayout(g, opts.Layout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute layout: %w", err)
+	}
+
+	fontFamily := theme.FontName
+	if fontFamily == "" {
+		fontFamily = "sans-serif"
+	}
+	fontSize := theme.FontSize
+	if fontSize <= 0 {
+		fontSize = 12
+	}
+	fontColor := theme.FontColor
+	if fontColor == "" {
+		fontColor = "black"
+	}
+
+	width := gl.Width + 2*svgMargin
+	height := gl.Height + 2*svgMargin
+	if opts.Stamp != nil {
+		height += svgStampHeight
+	}
+
+	var buf strings.Builder
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %s %s" font-family="%s" font-size="%s">`+"\n",
+		svgNumber(width), svgNumber(height), svgNumber(width), svgNumber(height), html.EscapeString(fontFamily), svgNumber(fontSize))
+	fmt.Fprintf(&buf, "  <title>%s</title>\n", html.EscapeString(g.AppName))
+
+	// One arrowhead per edge color, as markers cannot inherit the line color
+	edges := sortedEdges(g)
+	markers := make(map[string]string)
+	buf.WriteString("  <defs>\n")
+	for _, edge := range edges {
+		color := theme.EdgeColor(edge.Type)
+		if _, exists := markers[color]; exists {
+			continue
+		}
+		id := fmt.Sprintf("arrow-%d", len(markers))
+		markers[color] = id
+		fmt.Fprintf(&buf, `    <marker id="%s" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto-start-reverse"><path d="M 0 0 L 10 5 L 0 10 z" fill="%s"/></marker>`+"\n",
+			id, html.EscapeString(color))
+	}
+	buf.WriteString("  </defs>\n")
+
+	if theme.Background != "" {
+		fmt.Fprintf(&buf, `  <rect width="100%%" height="100%%" fill="%s"/>`+"\n", html.EscapeString(theme.Background))
+	}
+
+	// Swimlanes are shaded alternately and labeled in their top left corner
+	if len(gl.Lanes) > 0 {
+		buf.WriteString(`  <g class="lanes">` + "\n")
+		for i, lane := range gl.Lanes {
+			if i%2 == 0 {
+				fmt.Fprintf(&buf, `    <rect x="0" y="%s" width="%s" height="%s" fill="%s" fill-opacity="0.05"/>`+"\n",
+					svgNumber(lane.Y+svgMargin), svgNumber(width), svgNumber(lane.Height), html.EscapeString(fontColor))
+			}
+			fmt.Fprintf(&buf, `    <text x="4" y="%s" font-size="10" fill="%s" fill-opacity="0.6">%s</text>`+"\n",
+				svgNumber(lane.Y+svgMargin+12), html.EscapeString(fontColor), html.EscapeString(lane.Name))
+		}
+		buf.WriteString("  </g>\n")
+	}
+
+	// Clusters are drawn like in the clustered DOT export: dashed, rounded
+	// boxes labeled with the workflow's name
+	if len(gl.Groups) > 0 {
+		color := theme.EdgeColor(graph.EdgeTypeContains)
+		buf.WriteString(`  <g class="groups">` + "\n")
+		for _, group := range gl.Groups {
+			name := group.ID
+			if node, exists := g.Nodes[group.ID]; exists {
+				name = node.Name
+			}
+			fmt.Fprintf(&buf, `    <rect x="%s" y="%s" width="%s" height="%s" rx="8" fill="none" stroke="%s" stroke-dasharray="5,3"/>`+"\n",
+				svgNumber(group.X+svgMargin), svgNumber(group.Y+svgMargin), svgNumber(group.Width), svgNumber(group.Height), html.EscapeString(color))
+			fmt.Fprintf(&buf, `    <text x="%s" y="%s" font-size="10" fill="%s">%s</text>`+"\n",
+				svgNumber(group.X+svgMargin+6), svgNumber(group.Y+svgMargin+12), html.EscapeString(fontColor), html.EscapeString(name))
+		}
+		buf.WriteString("  </g>\n")
+	}
+
+	buf.WriteString(`  <g class="edges" font-size="10">` + "\n")
+	for _, edge := range edges {
+		from, fromOK := gl.Nodes[edge.FromNodeID]
+		to, toOK := gl.Nodes[edge.ToNodeID]
+		if !fromOK || !toOK {
+			return nil, fmt.Errorf("edge %s references unknown node", edge.ID)
+		}
+		writeSVGEdge(&buf, edge, from, to, theme, markers[theme.EdgeColor(edge.Type)], fontColor)
+	}
+	buf.WriteString("  </g>\n")
+
+	buf.WriteString(`  <g class="nodes">` + "\n")
+	for _, node := range sortedNodes(g) {
+		fill := theme.NodeFill(node.Type)
+		if opts.StateFill {
+			fill = theme.StateFill(node.State)
+		}
+		writeSVGNode(&buf, node, gl.Nodes[node.ID], theme, fill, fontColor, fontSize)
+	}
+	buf.WriteString("  </g>\n")
+
+	if opts.Stamp != nil {
+		fmt.Fprintf(&buf, `  <text class="stamp" x="%s" y="%s" text-anchor="end" font-size="10" fill="%s">%s</text>`+"\n",
+			svgNumber(width-svgMargin), svgNumber(height-svgMargin/2), html.EscapeString(fontColor), html.EscapeString(opts.Stamp.text(g)))
+	}
+
+	buf.WriteString("</svg>\n")
+	return []byte(buf.String()), nil
+}
+
+// writeSVGEdge draws an edge as a line between the borders of its nodes with
+// its type at the middle. Self-loops are drawn as an arc on the right side
+// of the node.
+func writeSVGEdge(buf *strings.Builder, edge *graph.Edge, from, to *layout.NodeLayout, theme Theme, marker, fontColor string) {
+	color := html.EscapeString(theme.EdgeColor(edge.Type))
+	strokeWidth := "1.5"
+	var dash string
+	switch theme.EdgeStyle(edge.Type) {
+	case "bold":
+		strokeWidth = "3"
+	case "dashed":
+		dash = ` stroke-dasharray="6,4"`
+	case "dotted":
+		dash = ` stroke-dasharray="2,3"`
+	}
+
+	var path string
+	var labelX, labelY float64
+	if edge.FromNodeID == edge.ToNodeID {
+		x := from.X + from.Width/2 + svgMargin
+		y := from.Y + svgMargin
+		offset := from.Height / 4
+		path = fmt.Sprintf("M %s %s C %s %s, %s %s, %s %s",
+			svgNumber(x), svgNumber(y-offset),
+			svgNumber(x+40), svgNumber(y-offset-20), svgNumber(x+40), svgNumber(y+offset+20),
+			svgNumber(x), svgNumber(y+offset))
+		labelX, labelY = x+44, y
+	} else {
+		x1, y1 := boxBorderPoint(from, to.X, to.Y)
+		x2, y2 := boxBorderPoint(to, from.X, from.Y)
+		x1, y1, x2, y2 = x1+svgMargin, y1+svgMargin, x2+svgMargin, y2+svgMargin
+		path = fmt.Sprintf("M %s %s L %s %s", svgNumber(x1), svgNumber(y1), svgNumber(x2), svgNumber(y2))
+		labelX, labelY = (x1+x2)/2, (y1+y2)/2
+	}
+
+	fmt.Fprintf(buf, `    <g class="edge %s" id="edge-%s">`+"\n", html.EscapeString(string(edge.Type)), html.EscapeString(edge.ID))
+	title := string(edge.Type)
+	if edge.Description != "" {
+		title += ": " + edge.Description
+	}
+	fmt.Fprintf(buf, "      <title>%s</title>\n", html.EscapeString(title))
+	fmt.Fprintf(buf, `      <path d="%s" fill="none" stroke="%s" stroke-width="%s"%s marker-end="url(#%s)"/>`+"\n",
+		path, color, strokeWidth, dash, marker)
+	fmt.Fprintf(buf, `      <text x="%s" y="%s" text-anchor="middle" fill="%s">%s</text>`+"\n",
+		svgNumber(labelX), svgNumber(labelY-4), html.EscapeString(fontColor), html.EscapeString(string(edge.Type)))
+	buf.WriteString("    </g>\n")
+}
+
+// boxBorderPoint returns where the line from the center of a node's box
+// towards (x, y) leaves the box
+func boxBorderPoint(box *layout.NodeLayout, x, y float64) (float64, float64) {
+	dx, dy := x-box.X, y-box.Y
+	if dx == 0 && dy == 0 {
+		return box.X, box.Y
+	}
+	scale := math.Inf(1)
+	if dx != 0 {
+		scale = math.Min(scale, box.Width/2/math.Abs(dx))
+	}
+	if dy != 0 {
+		scale = math.Min(scale, box.Height/2/math.Abs(dy))
+	}
+	return box.X + dx*scale, box.Y + dy*scale
+}
+
+// writeSVGNode draws a node's shape and its label, wrapped in a link if the
+// node has a url property
+func writeSVGNode(buf *strings.Builder, node *graph.Node, position *layout.NodeLayout, theme Theme, fill, fontColor string, fontSize float64) {
+	indent := "    "
+	if u := nodeURL(node); u != "" {
+		fmt.Fprintf(buf, `    <a href="%s" target="_blank">`+"\n", html.EscapeString(u))
+		indent += "  "
+	}
+
+	fmt.Fprintf(buf, `%s<g class="node %s state-%s" id="node-%s">`+"\n",
+		indent, html.EscapeString(string(node.Type)), html.EscapeString(stateName(node.State)), html.EscapeString(node.ID))
+	title := node.Name
+	if node.Description != "" {
+		title += "\n" + node.Description
+	}
+	fmt.Fprintf(buf, "%s  <title>%s</title>\n", indent, html.EscapeString(title))
+
+	stroke := fmt.Sprintf(`fill="%s" stroke="%s" stroke-width="%s"`,
+		html.EscapeString(fill), html.EscapeString(theme.StateBorder(node.State)), svgStrokeWidth(node.State))
+	if node.State == graph.NodeStatePending {
+		stroke += ` stroke-dasharray="5,3"`
+	}
+	for _, element := range svgShape(theme.NodeShape(node.Type), position, stroke) {
+		fmt.Fprintf(buf, "%s  %s\n", indent, element)
+	}
+
+	lines := []string{node.Name, fmt.Sprintf("(%s)", node.Type)}
+	if node.State != "" && node.State != graph.NodeStateWaiting {
+		lines = append(lines, fmt.Sprintf("[%s]", node.State))
+	}
+	lineHeight := fontSize * 1.2
+	y := position.Y + svgMargin - lineHeight*float64(len(lines)-1)/2
+	fmt.Fprintf(buf, `%s  <text x="%s" text-anchor="middle" dominant-baseline="central" fill="%s">`,
+		indent, svgNumber(position.X+svgMargin), html.EscapeString(fontColor))
+	for i, line := range lines {
+		fmt.Fprintf(buf, `<tspan x="%s" y="%s">%s</tspan>`,
+			svgNumber(position.X+svgMargin), svgNumber(y+float64(i)*lineHeight), html.EscapeString(line))
+	}
+	buf.WriteString("</text>\n")
+
+	fmt.Fprintf(buf, "%s</g>\n", indent)
+	if indent != "    " {
+		buf.WriteString("    </a>\n")
+	}
+}
+
+// svgShape returns the SVG elements drawing a node shape inside the node's
+// box; the default is a rounded box like in the DOT export
+func svgShape(shape NodeShape, p *layout.NodeLayout, attrs string) []string {
+	left, top := p.X-p.Width/2+svgMargin, p.Y-p.Height/2+svgMargin
+	right, bottom := left+p.Width, top+p.Height
+	cx, cy := p.X+svgMargin, p.Y+svgMargin
+	w, h := svgNumber(p.Width), svgNumber(p.Height)
+
+	rect := func(rx float64) string {
+		return fmt.Sprintf(`<rect x="%s" y="%s" width="%s" height="%s" rx="%s" %s/>`,
+			svgNumber(left), svgNumber(top), w, h, svgNumber(rx), attrs)
+	}
+	polygon := func(points ...float64) string {
+		coords := make([]string, 0, len(points)/2)
+		for i := 0; i+1 < len(points); i += 2 {
+			coords = append(coords, svgNumber(points[i])+","+svgNumber(points[i+1]))
+		}
+		return fmt.Sprintf(`<polygon points="%s" %s/>`, strings.Join(coords, " "), attrs)
+	}
+
+	switch shape {
+	case ShapeBox:
+		return []string{rect(0)}
+	case ShapeStadium:
+		return []string{rect(p.Height / 2)}
+	case ShapeEllipse:
+		return []string{fmt.Sprintf(`<ellipse cx="%s" cy="%s" rx="%s" ry="%s" %s/>`,
+			svgNumber(cx), svgNumber(cy), svgNumber(p.Width/2), svgNumber(p.Height/2), attrs)}
+	case ShapeDiamond:
+		return []string{polygon(cx, top, right, cy, cx, bottom, left, cy)}
+	case ShapeHexagon:
+		inset := math.Min(p.Height/2, p.Width/4)
+		return []string{polygon(left+inset, top, right-inset, top, right, cy, right-inset, bottom, left+inset, bottom, left, cy)}
+	case ShapeSubroutine:
+		return []string{
+			rect(0),
+			fmt.Sprintf(`<path d="M %s %s V %s M %s %s V %s" fill="none" %s/>`,
+				svgNumber(left+8), svgNumber(top), svgNumber(bottom), svgNumber(right-8), svgNumber(top), svgNumber(bottom), attrs),
+		}
+	case ShapeCylinder:
+		ry := math.Min(10, p.Height/4)
+		rx := svgNumber(p.Width / 2)
+		return []string{
+			fmt.Sprintf(`<path d="M %s %s A %s %s 0 0 1 %s %s V %s A %s %s 0 0 1 %s %s Z" %s/>`,
+				svgNumber(left), svgNumber(top+ry), rx, svgNumber(ry), svgNumber(right), svgNumber(top+ry),
+				svgNumber(bottom-ry), rx, svgNumber(ry), svgNumber(left), svgNumber(bottom-ry), attrs),
+			fmt.Sprintf(`<path d="M %s %s A %s %s 0 0 0 %s %s" fill="none" %s/>`,
+				svgNumber(left), svgNumber(top+ry), rx, svgNumber(ry), svgNumber(right), svgNumber(top+ry), attrs),
+		}
+	default:
+		return []string{rect(8)}
+	}
+}
+
+// svgStrokeWidth makes the borders of running and failed nodes bold, like
+// the DOT export
+func svgStrokeWidth(state graph.NodeState) string {
+	switch state {
+	case graph.NodeStateRunning, graph.NodeStateFailed:
+		return "3"
+	default:
+		return "1.5"
+	}
+}
+
+func svgNumber(value float64) string {
+	return strconv.FormatFloat(math.Round(value*100)/100, 'f', -1, 64)
+}
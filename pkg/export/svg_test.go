@@ -0,0 +1,127 @@
+package export
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/layout"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportGraphSVG(t *testing.T) {
+	g := createTestGraph()
+	g.Nodes["resource1"].State = graph.NodeStateFailed
+	g.Nodes["resource1"].Properties = map[string]interface{}{PropertyURL: "https://example.com/db"}
+
+	data, err := ExportGraphSVG(g, SVGOptions{})
+	require.NoError(t, err)
+
+	// The output is well-formed XML
+	decoder := xml.NewDecoder(strings.NewReader(string(data)))
+	for {
+		if _, err := decoder.Token(); err != nil {
+			assert.Equal(t, "EOF", err.Error())
+			break
+		}
+	}
+
+	svg := string(data)
+	assert.Contains(t, svg, `<svg xmlns="http://www.w3.org/2000/svg"`)
+	assert.Contains(t, svg, `<g class="node spec state-waiting" id="node-spec1">`)
+	assert.Contains(t, svg, `<tspan x="`)
+	assert.Contains(t, svg, `>Deploy Database</tspan>`)
+	assert.Contains(t, svg, `>[failed]</tspan>`)
+	assert.Contains(t, svg, `<a href="https://example.com/db" target="_blank">`)
+	assert.Contains(t, svg, `<g class="edge provisions" id="edge-e2">`)
+	assert.Contains(t, svg, `<title>depends-on: needs spec</title>`)
+
+	// Colors and borders follow the light theme
+	assert.Contains(t, svg, `fill="#C8E6C9" stroke="red" stroke-width="3"`)
+	assert.Contains(t, svg, `stroke="#388E3C" stroke-width="3"`)
+	assert.NotContains(t, svg, `<rect width="100%"`)
+
+	// Same input, same output
+	again, err := ExportGraphSVG(g, SVGOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, data, again)
+}
+
+func TestExportGraphSVG_Theme(t *testing.T) {
+	g := createTestGraph()
+
+	data, err := ExportGraphSVG(g, SVGOptions{
+		Theme:     &Theme{Name: "dark", NodeShapes: map[graph.NodeType]NodeShape{graph.NodeTypeResource: ShapeCylinder}},
+		StateFill: true,
+	})
+	require.NoError(t, err)
+
+	svg := string(data)
+	assert.Contains(t, svg, `<rect width="100%" height="100%" fill="#1E1E1E"/>`)
+	assert.Contains(t, svg, `font-family="Helvetica"`)
+	assert.Contains(t, svg, `fill="#2E2E2E"`)
+	assert.Contains(t, svg, `<path d="M `)
+
+	_, err = ExportGraphSVG(g, SVGOptions{Theme: &Theme{Name: "neon"}})
+	assert.Error(t, err)
+	_, err = ExportGraphSVG(g, SVGOptions{Layout: layout.LayoutOptions{Type: "spiral"}})
+	assert.Error(t, err)
+}
+
+func TestExportGraphSVG_Swimlanes(t *testing.T) {
+	g := createTestGraph()
+
+	data, err := ExportGraphSVG(g, SVGOptions{Layout: layout.LayoutOptions{Type: layout.LayoutSwimlane}})
+	require.NoError(t, err)
+	svg := string(data)
+	assert.Contains(t, svg, `<g class="lanes">`)
+	assert.Contains(t, svg, `>workflow</text>`)
+	assert.Contains(t, svg, `>resource</text>`)
+
+	data, err = ExportGraphSVG(g, SVGOptions{})
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), `class="lanes"`)
+}
+
+func TestExportGraphSVG_Clusters(t *testing.T) {
+	g := createTestGraph()
+	require.NoError(t, g.AddNode(&graph.Node{ID: "step1", Type: graph.NodeTypeStep, Name: "Build"}))
+	require.NoError(t, g.AddEdge(&graph.Edge{ID: "e3", FromNodeID: "workflow1", ToNodeID: "step1", Type: graph.EdgeTypeContains}))
+
+	data, err := ExportGraphSVG(g, SVGOptions{Layout: layout.LayoutOptions{Clusters: true}})
+	require.NoError(t, err)
+	svg := string(data)
+	assert.Contains(t, svg, `<g class="groups">`)
+	assert.Contains(t, svg, `stroke-dasharray="5,3"`)
+	assert.Contains(t, svg, `>Deploy Database</text>`)
+
+	data, err = ExportGraphSVG(g, SVGOptions{})
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), `class="groups"`)
+}
+
+func TestBoxBorderPoint(t *testing.T) {
+	box := &layout.NodeLayout{X: 100, Y: 50, Width: 40, Height: 20}
+
+	x, y := boxBorderPoint(box, 200, 50)
+	assert.Equal(t, []float64{120, 50}, []float64{x, y})
+	x, y = boxBorderPoint(box, 100, 0)
+	assert.Equal(t, []float64{100, 40}, []float64{x, y})
+	x, y = boxBorderPoint(box, 100, 50)
+	assert.Equal(t, []float64{100, 50}, []float64{x, y})
+}
+
+func TestExporter_SVGWithoutGraphviz(t *testing.T) {
+	exporter := &Exporter{}
+	defer exporter.Close()
+
+	data, err := exporter.ExportGraphWithOptions(createTestGraph(), FormatSVG, Options{Theme: &Theme{Name: "dark"}})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `fill="#1E1E1E"`)
+
+	_, err = exporter.ExportGraph(createTestGraph(), FormatPNG)
+	assert.Error(t, err)
+}
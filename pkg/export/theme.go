@@ -0,0 +1,299 @@
+package export
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// NodeShape is a format-neutral node shape. Each exporter maps it to the
+// closest shape it supports.
+type NodeShape string
+
+const (
+	ShapeBox        NodeShape = "box"
+	ShapeRounded    NodeShape = "rounded"
+	ShapeStadium    NodeShape = "stadium"
+	ShapeSubroutine NodeShape = "subroutine"
+	ShapeCylinder   NodeShape = "cylinder"
+	ShapeEllipse    NodeShape = "ellipse"
+	ShapeHexagon    NodeShape = "hexagon"
+	ShapeDiamond    NodeShape = "diamond"
+)
+
+// Theme holds the colors, node shapes, line styles and fonts of exports.
+// Colors are CSS color names or hex values, line styles are solid, bold,
+// dashed or dotted. Empty fields and missing map entries fall back to the
+// theme named by Name, so a Theme can list just the values to override.
+type Theme struct {
+	// Name of the built-in base theme: light (default), dark or colorblind
+	Name string `json:"name,omitempty"`
+
+	// Background, FontName, FontSize and FontColor are left to the renderer
+	// when empty
+	Background string  `json:"background,omitempty"`
+	FontName   string  `json:"font_name,omitempty"`
+	FontSize   float64 `json:"font_size,omitempty"`
+	FontColor  string  `json:"font_color,omitempty"`
+
+	// NodeFills colors nodes by type, StateFills by state (DOT StateFill)
+	NodeFills       map[graph.NodeType]string  `json:"node_fills,omitempty"`
+	StateFills      map[graph.NodeState]string `json:"state_fills,omitempty"`
+	DefaultNodeFill string                     `json:"default_node_fill,omitempty"`
+
+	// StateBorders colors node borders by state
+	StateBorders  map[graph.NodeState]string `json:"state_borders,omitempty"`
+	DefaultBorder string                     `json:"default_border,omitempty"`
+
+	EdgeColors       map[graph.EdgeType]string `json:"edge_colors,omitempty"`
+	EdgeStyles       map[graph.EdgeType]string `json:"edge_styles,omitempty"`
+	DefaultEdgeColor string                    `json:"default_edge_color,omitempty"`
+
+	// NodeShapes overrides the shapes exporters use per node type
+	NodeShapes map[graph.NodeType]NodeShape `json:"node_shapes,omitempty"`
+}
+
+var defaultEdgeStyles = map[graph.EdgeType]string{
+	graph.EdgeTypeDependsOn:  "solid",
+	graph.EdgeTypeProvisions: "bold",
+	graph.EdgeTypeCreates:    "dashed",
+	graph.EdgeTypeBindsTo:    "dotted",
+	graph.EdgeTypeContains:   "bold",   // Workflow contains steps (bold line)
+	graph.EdgeTypeConfigures: "dashed", // Step configures resource (dashed line)
+}
+
+// LightTheme returns the default theme
+func LightTheme() Theme {
+	return Theme{
+		Name: "light",
+		NodeFills: map[graph.NodeType]string{
+			graph.NodeTypeSpec:     "#E3F2FD", // Light blue
+			graph.NodeTypeWorkflow: "#FFF9C4", // Light yellow
+			graph.NodeTypeStep:     "#FFE0B2", // Light orange
+			graph.NodeTypeResource: "#C8E6C9", // Light green
+		},
+		StateFills: map[graph.NodeState]string{
+			graph.NodeStatePending:   "#FFF8E1", // Light amber
+			graph.NodeStateRunning:   "#BBDEFB", // Light blue
+			graph.NodeStateSucceeded: "#C8E6C9", // Light green
+			graph.NodeStateFailed:    "#FFCDD2", // Light red
+		},
+		DefaultNodeFill: "#F5F5F5", // Light gray
+		StateBorders: map[graph.NodeState]string{
+			graph.NodeStateFailed:    "red",
+			graph.NodeStateRunning:   "#1976D2", // Blue
+			graph.NodeStateSucceeded: "#388E3C", // Green
+		},
+		DefaultBorder: "black",
+		EdgeColors: map[graph.EdgeType]string{
+			graph.EdgeTypeDependsOn:  "#1976D2", // Blue
+			graph.EdgeTypeProvisions: "#388E3C", // Green
+			graph.EdgeTypeCreates:    "#F57C00", // Orange
+			graph.EdgeTypeBindsTo:    "#7B1FA2", // Purple
+			graph.EdgeTypeContains:   "#FBC02D", // Yellow
+			graph.EdgeTypeConfigures: "#E64A19", // Deep orange
+		},
+		EdgeStyles:       maps.Clone(defaultEdgeStyles),
+		DefaultEdgeColor: "#757575", // Gray
+	}
+}
+
+// DarkTheme returns a theme for dark backgrounds
+func DarkTheme() Theme {
+	return Theme{
+		Name:       "dark",
+		Background: "#1E1E1E",
+		FontName:   "Helvetica",
+		FontColor:  "#E0E0E0",
+		NodeFills: map[graph.NodeType]string{
+			graph.NodeTypeSpec:     "#1A3A5C",
+			graph.NodeTypeWorkflow: "#5C5223",
+			graph.NodeTypeStep:     "#5C3D1A",
+			graph.NodeTypeResource: "#1E4620",
+		},
+		StateFills: map[graph.NodeState]string{
+			graph.NodeStatePending:   "#4A3F1A",
+			graph.NodeStateRunning:   "#1A3A5C",
+			graph.NodeStateSucceeded: "#1E4620",
+			graph.NodeStateFailed:    "#5C1F1F",
+		},
+		DefaultNodeFill: "#2E2E2E",
+		StateBorders: map[graph.NodeState]string{
+			graph.NodeStateFailed:    "#EF5350",
+			graph.NodeStateRunning:   "#42A5F5",
+			graph.NodeStateSucceeded: "#66BB6A",
+		},
+		DefaultBorder: "#BDBDBD",
+		EdgeColors: map[graph.EdgeType]string{
+			graph.EdgeTypeDependsOn:  "#64B5F6",
+			graph.EdgeTypeProvisions: "#81C784",
+			graph.EdgeTypeCreates:    "#FFB74D",
+			graph.EdgeTypeBindsTo:    "#BA68C8",
+			graph.EdgeTypeContains:   "#FFF176",
+			graph.EdgeTypeConfigures: "#FF8A65",
+		},
+		EdgeStyles:       maps.Clone(defaultEdgeStyles),
+		DefaultEdgeColor: "#9E9E9E",
+	}
+}
+
+// ColorblindTheme returns a light theme built from the Okabe-Ito palette,
+// which stays distinguishable with the common forms of color blindness
+func ColorblindTheme() Theme {
+	return Theme{
+		Name: "colorblind",
+		NodeFills: map[graph.NodeType]string{
+			graph.NodeTypeSpec:     "#CCE5F6", // Sky blue tint
+			graph.NodeTypeWorkflow: "#FAF6C0", // Yellow tint
+			graph.NodeTypeStep:     "#F9E2B3", // Orange tint
+			graph.NodeTypeResource: "#B3E2D5", // Bluish green tint
+		},
+		StateFills: map[graph.NodeState]string{
+			graph.NodeStatePending:   "#FAF6C0",
+			graph.NodeStateRunning:   "#B3D4EC",
+			graph.NodeStateSucceeded: "#B3E2D5",
+			graph.NodeStateFailed:    "#F2CFB3",
+		},
+		DefaultNodeFill: "#F5F5F5",
+		StateBorders: map[graph.NodeState]string{
+			graph.NodeStateFailed:    "#D55E00", // Vermillion
+			graph.NodeStateRunning:   "#0072B2", // Blue
+			graph.NodeStateSucceeded: "#009E73", // Bluish green
+		},
+		DefaultBorder: "black",
+		EdgeColors: map[graph.EdgeType]string{
+			graph.EdgeTypeDependsOn:  "#0072B2", // Blue
+			graph.EdgeTypeProvisions: "#009E73", // Bluish green
+			graph.EdgeTypeCreates:    "#E69F00", // Orange
+			graph.EdgeTypeBindsTo:    "#CC79A7", // Reddish purple
+			graph.EdgeTypeContains:   "#56B4E9", // Sky blue
+			graph.EdgeTypeConfigures: "#D55E00", // Vermillion
+		},
+		EdgeStyles:       maps.Clone(defaultEdgeStyles),
+		DefaultEdgeColor: "#757575",
+	}
+}
+
+var builtinThemes = map[string]func() Theme{
+	"light":      LightTheme,
+	"dark":       DarkTheme,
+	"colorblind": ColorblindTheme,
+}
+
+// defaultTheme styles exporters that do not take a theme
+var defaultTheme = LightTheme()
+
+// ThemeNames lists the built-in themes
+func ThemeNames() []string {
+	names := make([]string, 0, len(builtinThemes))
+	for name := range builtinThemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ThemeByName returns a built-in theme; the empty name returns LightTheme
+func ThemeByName(name string) (Theme, error) {
+	if name == "" {
+		return LightTheme(), nil
+	}
+	theme, ok := builtinThemes[strings.ToLower(name)]
+	if !ok {
+		return Theme{}, fmt.Errorf("unknown theme: %s (available: %s)", name, strings.Join(ThemeNames(), ", "))
+	}
+	return theme(), nil
+}
+
+// ResolveTheme returns the built-in theme named by t with the values set in
+// t applied on top. A nil theme resolves to LightTheme.
+func ResolveTheme(t *Theme) (Theme, error) {
+	if t == nil {
+		return LightTheme(), nil
+	}
+	base, err := ThemeByName(t.Name)
+	if err != nil {
+		return Theme{}, err
+	}
+	return base.Merge(*t), nil
+}
+
+// Merge returns a copy of t with all values set in overrides replacing
+// those of t. The name of t is kept.
+func (t Theme) Merge(overrides Theme) Theme {
+	merged := t
+	mergeString(&merged.Background, overrides.Background)
+	mergeString(&merged.FontName, overrides.FontName)
+	mergeString(&merged.FontColor, overrides.FontColor)
+	if overrides.FontSize > 0 {
+		merged.FontSize = overrides.FontSize
+	}
+	mergeString(&merged.DefaultNodeFill, overrides.DefaultNodeFill)
+	mergeString(&merged.DefaultBorder, overrides.DefaultBorder)
+	mergeString(&merged.DefaultEdgeColor, overrides.DefaultEdgeColor)
+
+	merged.NodeFills = mergeMap(t.NodeFills, overrides.NodeFills)
+	merged.StateFills = mergeMap(t.StateFills, overrides.StateFills)
+	merged.StateBorders = mergeMap(t.StateBorders, overrides.StateBorders)
+	merged.EdgeColors = mergeMap(t.EdgeColors, overrides.EdgeColors)
+	merged.EdgeStyles = mergeMap(t.EdgeStyles, overrides.EdgeStyles)
+	merged.NodeShapes = mergeMap(t.NodeShapes, overrides.NodeShapes)
+	return merged
+}
+
+// NodeFill returns the fill color of a node type
+func (t Theme) NodeFill(nodeType graph.NodeType) string {
+	return lookup(t.NodeFills, nodeType, t.DefaultNodeFill)
+}
+
+// StateFill returns the fill color of a node state
+func (t Theme) StateFill(state graph.NodeState) string {
+	return lookup(t.StateFills, state, t.DefaultNodeFill)
+}
+
+// StateBorder returns the border color of a node state
+func (t Theme) StateBorder(state graph.NodeState) string {
+	return lookup(t.StateBorders, state, t.DefaultBorder)
+}
+
+// EdgeColor returns the line color of an edge type
+func (t Theme) EdgeColor(edgeType graph.EdgeType) string {
+	return lookup(t.EdgeColors, edgeType, t.DefaultEdgeColor)
+}
+
+// EdgeStyle returns the line style of an edge type
+func (t Theme) EdgeStyle(edgeType graph.EdgeType) string {
+	return lookup(t.EdgeStyles, edgeType, "solid")
+}
+
+// NodeShape returns the shape set for a node type, or "" to let the
+// exporter pick its default shape
+func (t Theme) NodeShape(nodeType graph.NodeType) NodeShape {
+	return t.NodeShapes[nodeType]
+}
+
+func lookup[K comparable, V comparable](m map[K]V, key K, fallback V) V {
+	var zero V
+	if value, ok := m[key]; ok && value != zero {
+		return value
+	}
+	return fallback
+}
+
+func mergeString(dst *string, value string) {
+	if value != "" {
+		*dst = value
+	}
+}
+
+func mergeMap[K comparable, V any](base, overrides map[K]V) map[K]V {
+	merged := maps.Clone(base)
+	if merged == nil && len(overrides) > 0 {
+		merged = make(map[K]V, len(overrides))
+	}
+	maps.Copy(merged, overrides)
+	return merged
+}
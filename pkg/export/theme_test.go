@@ -0,0 +1,134 @@
+package export
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThemeByName(t *testing.T) {
+	assert.Equal(t, []string{"colorblind", "dark", "light"}, ThemeNames())
+
+	for _, name := range ThemeNames() {
+		theme, err := ThemeByName(strings.ToUpper(name))
+		require.NoError(t, err)
+		assert.Equal(t, name, theme.Name)
+
+		// Built-in themes define every color
+		for _, nodeType := range legendNodeTypes {
+			assert.Contains(t, theme.NodeFills, nodeType, name)
+		}
+		for _, edgeType := range []graph.EdgeType{graph.EdgeTypeDependsOn, graph.EdgeTypeProvisions, graph.EdgeTypeCreates, graph.EdgeTypeBindsTo, graph.EdgeTypeContains, graph.EdgeTypeConfigures} {
+			assert.Contains(t, theme.EdgeColors, edgeType, name)
+			assert.Contains(t, theme.EdgeStyles, edgeType, name)
+		}
+	}
+
+	theme, err := ThemeByName("")
+	require.NoError(t, err)
+	assert.Equal(t, "light", theme.Name)
+
+	_, err = ThemeByName("neon")
+	assert.ErrorContains(t, err, "unknown theme: neon")
+}
+
+func TestResolveTheme(t *testing.T) {
+	theme, err := ResolveTheme(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "#E3F2FD", theme.NodeFill(graph.NodeTypeSpec))
+	assert.Equal(t, "black", theme.StateBorder(graph.NodeStateWaiting))
+	assert.Equal(t, "#757575", theme.EdgeColor("unknown"))
+	assert.Equal(t, "solid", theme.EdgeStyle("unknown"))
+
+	theme, err = ResolveTheme(&Theme{
+		Name:       "dark",
+		FontSize:   12,
+		NodeFills:  map[graph.NodeType]string{graph.NodeTypeSpec: "#000000"},
+		EdgeStyles: map[graph.EdgeType]string{graph.EdgeTypeDependsOn: "dashed"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "dark", theme.Name)
+	assert.Equal(t, "#000000", theme.NodeFill(graph.NodeTypeSpec))
+	assert.Equal(t, "#5C5223", theme.NodeFill(graph.NodeTypeWorkflow), "unset values come from the base theme")
+	assert.Equal(t, "dashed", theme.EdgeStyle(graph.EdgeTypeDependsOn))
+	assert.Equal(t, "Helvetica", theme.FontName)
+	assert.Equal(t, 12.0, theme.FontSize)
+
+	// Overrides leave the built-in themes untouched
+	assert.Equal(t, "#1A3A5C", DarkTheme().NodeFill(graph.NodeTypeSpec))
+	assert.Equal(t, "solid", DarkTheme().EdgeStyle(graph.EdgeTypeDependsOn))
+
+	_, err = ResolveTheme(&Theme{Name: "neon"})
+	assert.Error(t, err)
+}
+
+func TestExporter_Theme_DefaultOutputUnchanged(t *testing.T) {
+	exporter := NewExporter()
+	defer exporter.Close()
+	g := createTestGraph()
+
+	for _, format := range []Format{FormatDOT, FormatMermaid} {
+		plain, err := exporter.ExportGraph(g, format)
+		require.NoError(t, err)
+		themed, err := exporter.ExportGraphWithOptions(g, format, Options{Theme: &Theme{Name: "light"}})
+		require.NoError(t, err)
+		assert.Equal(t, string(plain), string(themed), format)
+	}
+}
+
+func TestExporter_Theme_DOT(t *testing.T) {
+	exporter := NewExporter()
+	defer exporter.Close()
+	g := createTestGraph()
+	g.Nodes["workflow1"].State = graph.NodeStateFailed
+
+	theme := &Theme{Name: "dark", NodeShapes: map[graph.NodeType]NodeShape{graph.NodeTypeResource: ShapeCylinder}}
+	data, err := exporter.ExportGraphWithOptions(g, FormatDOT, Options{Theme: theme})
+	require.NoError(t, err)
+	content := string(data)
+
+	assert.Contains(t, content, "  bgcolor=\"#1E1E1E\";\n")
+	assert.Contains(t, content, "  node [shape=box, style=rounded, fontname=\"Helvetica\", fontcolor=\"#E0E0E0\"];\n")
+	assert.Contains(t, content, "  edge [fontsize=10, fontname=\"Helvetica\", fontcolor=\"#E0E0E0\"];\n")
+	assert.Contains(t, content, "\"spec1\" [label=\"Database Spec\\n(spec)\", fillcolor=\"#1A3A5C\", color=\"#BDBDBD\"")
+	assert.Contains(t, content, "\"workflow1\" [label=\"Deploy Database\\n(workflow)\\n[failed]\", fillcolor=\"#5C5223\", color=\"#EF5350\"")
+	assert.Contains(t, content, "fillcolor=\"#1E4620\", color=\"#BDBDBD\", style=\"filled,rounded\", shape=\"cylinder\"];")
+	assert.Contains(t, content, "color=\"#64B5F6\", style=\"solid\"];")
+
+	// Options of the format take precedence over Options.Theme
+	data, err = exporter.ExportGraphWithOptions(g, FormatDOT, Options{
+		Theme: theme,
+		DOT:   DOTExportOptions{Theme: &Theme{Name: "colorblind"}},
+	})
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "bgcolor")
+	assert.Contains(t, string(data), "color=\"#D55E00\"")
+
+	_, err = exporter.ExportGraphWithOptions(g, FormatDOT, Options{Theme: &Theme{Name: "neon"}})
+	assert.Error(t, err)
+}
+
+func TestExportGraphMermaid_Theme(t *testing.T) {
+	theme := &Theme{
+		Name:       "dark",
+		FontSize:   14,
+		NodeShapes: map[graph.NodeType]NodeShape{graph.NodeTypeWorkflow: ShapeHexagon},
+		EdgeStyles: map[graph.EdgeType]string{graph.EdgeTypeProvisions: "solid"},
+	}
+	data, err := ExportGraphMermaid(createTestGraph(), MermaidOptions{Theme: theme})
+	require.NoError(t, err)
+	content := string(data)
+
+	assert.True(t, strings.HasPrefix(content, `%%{init: {"theme": "base", "themeVariables": {"background": "#1E1E1E", "fontFamily": "Helvetica", "fontSize": "14px", "primaryTextColor": "#E0E0E0"}}}%%`+"\nflowchart TD\n"))
+	assert.Contains(t, content, "  workflow1{{\"Deploy Database<br/>(workflow)\"}}\n")
+	assert.Contains(t, content, "  workflow1 -->|\"provisions<br/>creates database\"| resource1\n")
+	assert.Contains(t, content, "  classDef spec fill:#1A3A5C,color:#E0E0E0\n")
+	assert.Contains(t, content, "  classDef state_failed stroke:#EF5350,stroke-width:2px\n")
+
+	_, err = ExportGraphMermaid(createTestGraph(), MermaidOptions{Theme: &Theme{Name: "neon"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,217 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/layout"
+)
+
+// WebOptions configures the Cytoscape.js and D3 exports
+type WebOptions struct {
+	// Layout configures the node positions; the hierarchical layout is used
+	// by default
+	Layout layout.LayoutOptions `json:"layout"`
+	// LayoutCache reuses layouts of graphs with an unchanged structure; nil
+	// uses the Exporter's cache when exporting through an Exporter
+	LayoutCache *layout.LayoutCache `json:"-"`
+	// OmitPositions leaves positions out, e.g. when the frontend runs its
+	// own layout
+	OmitPositions bool `json:"omit_positions"`
+	// Indent pretty-prints the output
+	Indent bool `json:"indent"`
+}
+
+type cytoscapeGraph struct {
+	Elements cytoscapeElements `json:"elements"`
+}
+
+type cytoscapeElements struct {
+	Nodes []cytoscapeNode `json:"nodes"`
+	Edges []cytoscapeEdge `json:"edges"`
+}
+
+type cytoscapeNode struct {
+	Data     webNode      `json:"data"`
+	Position *webPosition `json:"position,omitempty"`
+	Classes  string       `json:"classes"`
+}
+
+type cytoscapeEdge struct {
+	Data    webLink `json:"data"`
+	Classes string  `json:"classes"`
+}
+
+type webPosition struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// webNode holds the node fields shared by both formats. Colors match the DOT
+// export so frontends can style nodes with data(color) and the like.
+type webNode struct {
+	ID          string                 `json:"id"`
+	Label       string                 `json:"label"`
+	Type        graph.NodeType         `json:"type"`
+	State       graph.NodeState        `json:"state"`
+	Description string                 `json:"description,omitempty"`
+	Color       string                 `json:"color"`
+	BorderColor string                 `json:"border_color"`
+	Width       float64                `json:"width,omitempty"`
+	Height      float64                `json:"height,omitempty"`
+	Properties  map[string]interface{} `json:"properties,omitempty"`
+}
+
+type webLink struct {
+	ID         string                 `json:"id"`
+	Source     string                 `json:"source"`
+	Target     string                 `json:"target"`
+	Label      string                 `json:"label"`
+	Type       graph.EdgeType         `json:"type"`
+	Color      string                 `json:"color"`
+	Style      string                 `json:"style"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+type d3Graph struct {
+	Nodes []d3Node  `json:"nodes"`
+	Links []webLink `json:"links"`
+}
+
+type d3Node struct {
+	webNode
+	X *float64 `json:"x,omitempty"`
+	Y *float64 `json:"y,omitempty"`
+}
+
+// ExportGraphCytoscape encodes a graph as Cytoscape.js elements JSON, ready
+// for cy.json() or the elements option. Nodes carry positions from
+// pkg/layout and the classes "<type>" and "state-<state>".
+func ExportGraphCytoscape(g *graph.Graph, opts WebOptions) ([]byte, error) {
+	nodes, links, gl, err := webElements(g, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := cytoscapeGraph{Elements: cytoscapeElements{
+		Nodes: make([]cytoscapeNode, len(nodes)),
+		Edges: make([]cytoscapeEdge, len(links)),
+	}}
+	for i, node := range nodes {
+		doc.Elements.Nodes[i] = cytoscapeNode{
+			Data:    node,
+			Classes: fmt.Sprintf("%s state-%s", node.Type, node.State),
+		}
+		if gl != nil {
+			position := gl.Nodes[node.ID]
+			doc.Elements.Nodes[i].Position = &webPosition{X: position.X, Y: position.Y}
+		}
+	}
+	for i, link := range links {
+		doc.Elements.Edges[i] = cytoscapeEdge{Data: link, Classes: string(link.Type)}
+	}
+
+	return encodeWebGraph(&doc, opts.Indent)
+}
+
+// ExportGraphD3 encodes a graph as the nodes/links JSON used by D3 force
+// simulations and force-graph. Links reference nodes by ID; nodes carry
+// initial x and y positions from pkg/layout.
+func ExportGraphD3(g *graph.Graph, opts WebOptions) ([]byte, error) {
+	nodes, links, gl, err := webElements(g, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := d3Graph{Nodes: d3Nodes(nodes, gl), Links: links}
+
+	return encodeWebGraph(&doc, opts.Indent)
+}
+
+// d3Nodes adds the positions from gl, which may be nil, to nodes
+func d3Nodes(nodes []webNode, gl *layout.GraphLayout) []d3Node {
+	result := make([]d3Node, len(nodes))
+	for i, node := range nodes {
+		result[i] = d3Node{webNode: node}
+		if gl != nil {
+			position := gl.Nodes[node.ID]
+			result[i].X = &position.X
+			result[i].Y = &position.Y
+		}
+	}
+	return result
+}
+
+// webElements converts the nodes and edges of g, sorted by ID, and computes
+// their layout unless positions are omitted
+func webElements(g *graph.Graph, opts WebOptions) ([]webNode, []webLink, *layout.GraphLayout, error) {
+	var gl *layout.GraphLayout
+	if !opts.OmitPositions {
+		var err error
+		gl, err = opts.LayoutCache.ComputeLayout(g, opts.Layout)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to compute layout: %w", err)
+		}
+	}
+
+	nodes := make([]webNode, 0, len(g.Nodes))
+	for _, node := range sortedNodes(g) {
+		data := webNode{
+			ID:          node.ID,
+			Label:       node.Name,
+			Type:        node.Type,
+			State:       node.State,
+			Description: node.Description,
+			Color:       defaultTheme.NodeFill(node.Type),
+			BorderColor: defaultTheme.StateBorder(node.State),
+			Properties:  node.Properties,
+		}
+		if gl != nil {
+			position := gl.Nodes[node.ID]
+			data.Width = position.Width
+			data.Height = position.Height
+		}
+		nodes = append(nodes, data)
+	}
+
+	links := make([]webLink, 0, len(g.Edges))
+	for _, edge := range sortedEdges(g) {
+		if _, ok := g.Nodes[edge.FromNodeID]; !ok {
+			return nil, nil, nil, fmt.Errorf("edge %s references unknown node", edge.ID)
+		}
+		if _, ok := g.Nodes[edge.ToNodeID]; !ok {
+			return nil, nil, nil, fmt.Errorf("edge %s references unknown node", edge.ID)
+		}
+		label := edge.Description
+		if label == "" {
+			label = string(edge.Type)
+		}
+		links = append(links, webLink{
+			ID:         edge.ID,
+			Source:     edge.FromNodeID,
+			Target:     edge.ToNodeID,
+			Label:      label,
+			Type:       edge.Type,
+			Color:      defaultTheme.EdgeColor(edge.Type),
+			Style:      defaultTheme.EdgeStyle(edge.Type),
+			Properties: edge.Properties,
+		})
+	}
+
+	return nodes, links, gl, nil
+}
+
+func encodeWebGraph(doc interface{}, indent bool) ([]byte, error) {
+	var data []byte
+	var err error
+	if indent {
+		data, err = json.MarshalIndent(doc, "", "  ")
+	} else {
+		data, err = json.Marshal(doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode graph: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,114 @@
+package export
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/philipsahli/innominatus-graph/pkg/layout"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportGraphCytoscape(t *testing.T) {
+	g := createTestGraph()
+	require.NoError(t, g.UpdateNodeState("workflow1", graph.NodeStateFailed))
+	g.Nodes["resource1"].Properties = map[string]interface{}{"engine": "postgres"}
+
+	data, err := ExportGraphCytoscape(g, WebOptions{})
+	require.NoError(t, err)
+
+	var doc struct {
+		Elements struct {
+			Nodes []struct {
+				Data     map[string]interface{}  `json:"data"`
+				Position *struct{ X, Y float64 } `json:"position"`
+				Classes  string                  `json:"classes"`
+			} `json:"nodes"`
+			Edges []struct {
+				Data    map[string]interface{} `json:"data"`
+				Classes string                 `json:"classes"`
+			} `json:"edges"`
+		} `json:"elements"`
+	}
+	require.NoError(t, json.Unmarshal(data, &doc))
+
+	gl, err := layout.ComputeLayout(g, layout.LayoutOptions{})
+	require.NoError(t, err)
+
+	require.Len(t, doc.Elements.Nodes, 3)
+	for _, node := range doc.Elements.Nodes {
+		id := node.Data["id"].(string)
+		require.NotNil(t, node.Position, id)
+		assert.Equal(t, gl.Nodes[id].X, node.Position.X, id)
+		assert.Equal(t, gl.Nodes[id].Y, node.Position.Y, id)
+	}
+
+	resource := doc.Elements.Nodes[0]
+	assert.Equal(t, "resource1", resource.Data["id"])
+	assert.Equal(t, "Database", resource.Data["label"])
+	assert.Equal(t, "#C8E6C9", resource.Data["color"])
+	assert.Equal(t, map[string]interface{}{"engine": "postgres"}, resource.Data["properties"])
+	assert.Equal(t, "resource state-waiting", resource.Classes)
+
+	workflow := doc.Elements.Nodes[2]
+	assert.Equal(t, "workflow1", workflow.Data["id"])
+	assert.Equal(t, "red", workflow.Data["border_color"])
+	assert.Equal(t, "workflow state-failed", workflow.Classes)
+
+	require.Len(t, doc.Elements.Edges, 2)
+	edge := doc.Elements.Edges[0]
+	assert.Equal(t, "e1", edge.Data["id"])
+	assert.Equal(t, "workflow1", edge.Data["source"])
+	assert.Equal(t, "spec1", edge.Data["target"])
+	assert.Equal(t, "needs spec", edge.Data["label"])
+	assert.Equal(t, "depends-on", edge.Classes)
+}
+
+func TestExportGraphD3(t *testing.T) {
+	g := createTestGraph()
+
+	data, err := ExportGraphD3(g, WebOptions{Layout: layout.LayoutOptions{Type: layout.LayoutRadial}})
+	require.NoError(t, err)
+
+	var doc struct {
+		Nodes []map[string]interface{} `json:"nodes"`
+		Links []map[string]interface{} `json:"links"`
+	}
+	require.NoError(t, json.Unmarshal(data, &doc))
+
+	require.Len(t, doc.Nodes, 3)
+	assert.Equal(t, "resource1", doc.Nodes[0]["id"])
+	assert.Contains(t, doc.Nodes[0], "x")
+	assert.Contains(t, doc.Nodes[0], "y")
+	require.Len(t, doc.Links, 2)
+	assert.Equal(t, "workflow1", doc.Links[1]["source"])
+	assert.Equal(t, "resource1", doc.Links[1]["target"])
+	assert.Equal(t, "bold", doc.Links[1]["style"])
+
+	data, err = ExportGraphD3(g, WebOptions{OmitPositions: true})
+	require.NoError(t, err)
+	var unpositioned struct {
+		Nodes []map[string]interface{} `json:"nodes"`
+	}
+	require.NoError(t, json.Unmarshal(data, &unpositioned))
+	assert.NotContains(t, unpositioned.Nodes[0], "x")
+	assert.NotContains(t, unpositioned.Nodes[0], "width")
+
+	_, err = ExportGraphD3(g, WebOptions{Layout: layout.LayoutOptions{Type: "spiral"}})
+	assert.Error(t, err)
+}
+
+func TestExporter_ExportGraph_Web(t *testing.T) {
+	exporter := NewExporter()
+	defer exporter.Close()
+
+	for _, format := range []Format{FormatCytoscape, FormatD3} {
+		data, err := exporter.ExportGraph(createTestGraph(), format)
+		require.NoError(t, err, format)
+		assert.True(t, json.Valid(data), format)
+		assert.Equal(t, "application/json", format.ContentType())
+		assert.Equal(t, "json", format.FileExtension())
+	}
+}
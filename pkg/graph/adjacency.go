@@ -0,0 +1,90 @@
+package graph
+
+// adjacency keeps outgoing and incoming edges per node ID so that
+// neighbourhood lookups cost O(degree) instead of a scan over all edges.
+type adjacency struct {
+	out   map[string]map[string]*Edge
+	in    map[string]map[string]*Edge
+	edges int
+}
+
+func newAdjacency(edges map[string]*Edge) *adjacency {
+	a := &adjacency{
+		out: make(map[string]map[string]*Edge),
+		in:  make(map[string]map[string]*Edge),
+	}
+	for _, edge := range edges {
+		a.add(edge)
+	}
+	return a
+}
+
+func (a *adjacency) add(edge *Edge) {
+	if a.out[edge.FromNodeID] == nil {
+		a.out[edge.FromNodeID] = make(map[string]*Edge)
+	}
+	if a.in[edge.ToNodeID] == nil {
+		a.in[edge.ToNodeID] = make(map[string]*Edge)
+	}
+	if _, exists := a.out[edge.FromNodeID][edge.ID]; !exists {
+		a.edges++
+	}
+	a.out[edge.FromNodeID][edge.ID] = edge
+	a.in[edge.ToNodeID][edge.ID] = edge
+}
+
+func (a *adjacency) remove(edge *Edge) {
+	if _, exists := a.out[edge.FromNodeID][edge.ID]; exists {
+		a.edges--
+	}
+	delete(a.out[edge.FromNodeID], edge.ID)
+	delete(a.in[edge.ToNodeID], edge.ID)
+	if len(a.out[edge.FromNodeID]) == 0 {
+		delete(a.out, edge.FromNodeID)
+	}
+	if len(a.in[edge.ToNodeID]) == 0 {
+		delete(a.in, edge.ToNodeID)
+	}
+}
+
+func (a *adjacency) outgoing(nodeID string) []*Edge {
+	return edgeSlice(a.out[nodeID])
+}
+
+func (a *adjacency) incoming(nodeID string) []*Edge {
+	return edgeSlice(a.in[nodeID])
+}
+
+func edgeSlice(m map[string]*Edge) []*Edge {
+	edges := make([]*Edge, 0, len(m))
+	for _, edge := range m {
+		edges = append(edges, edge)
+	}
+	return edges
+}
+
+// index returns the adjacency index, (re)building it when the graph was not
+// constructed through AddEdge or its Edges map was modified directly.
+func (g *Graph) index() *adjacency {
+	if g.adj == nil || g.adj.edges != len(g.Edges) {
+		g.adj = newAdjacency(g.Edges)
+	}
+	return g.adj
+}
+
+// RebuildIndex recomputes the adjacency index from g.Edges. Callers that
+// replace or rewire entries in the Edges map directly should call it before
+// using any lookup helpers.
+func (g *Graph) RebuildIndex() {
+	g.adj = newAdjacency(g.Edges)
+}
+
+// OutgoingEdges returns all edges originating from the given node
+func (g *Graph) OutgoingEdges(nodeID string) []*Edge {
+	return g.index().outgoing(nodeID)
+}
+
+// IncomingEdges returns all edges targeting the given node
+func (g *Graph) IncomingEdges(nodeID string) []*Edge {
+	return g.index().incoming(nodeID)
+}
@@ -0,0 +1,87 @@
+package graph
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraph_OutgoingIncomingEdges(t *testing.T) {
+	g := createTestGraph()
+
+	out := g.OutgoingEdges("workflow2")
+	assert.Len(t, out, 3)
+
+	in := g.IncomingEdges("resource1")
+	assert.Len(t, in, 2)
+
+	assert.Empty(t, g.OutgoingEdges("resource2"))
+	assert.Empty(t, g.IncomingEdges("unknown"))
+}
+
+func TestGraph_AdjacencyIndex_RemoveEdgeAndNode(t *testing.T) {
+	g := createTestGraph()
+
+	require.NoError(t, g.RemoveEdge("e3"))
+	assert.Len(t, g.OutgoingEdges("workflow2"), 2)
+	assert.Len(t, g.IncomingEdges("resource1"), 1)
+
+	require.NoError(t, g.RemoveNode("workflow1"))
+	assert.Empty(t, g.IncomingEdges("resource1"))
+	assert.Empty(t, g.IncomingEdges("spec1"))
+	assert.Len(t, g.Edges, 2)
+}
+
+func TestGraph_AdjacencyIndex_DirectMapMutation(t *testing.T) {
+	g := createTestGraph()
+	require.Len(t, g.OutgoingEdges("workflow1"), 2)
+
+	// Edges added behind the graph's back are picked up on next lookup
+	g.Edges["e6"] = &Edge{ID: "e6", FromNodeID: "workflow1", ToNodeID: "spec2", Type: EdgeTypeDependsOn}
+	assert.Len(t, g.OutgoingEdges("workflow1"), 3)
+
+	// A graph without an index (e.g. decoded from JSON) is indexed lazily
+	decoded := &Graph{Nodes: g.Nodes, Edges: g.Edges}
+	assert.Len(t, decoded.IncomingEdges("spec2"), 2)
+}
+
+func buildChainGraph(n int) *Graph {
+	g := NewGraph("bench")
+	for i := 0; i < n; i++ {
+		_ = g.AddNode(&Node{ID: fmt.Sprintf("n%d", i), Type: NodeTypeStep, Name: fmt.Sprintf("node %d", i)})
+	}
+	for i := 1; i < n; i++ {
+		_ = g.AddEdge(&Edge{
+			ID:         fmt.Sprintf("e%d", i),
+			FromNodeID: fmt.Sprintf("n%d", i),
+			ToNodeID:   fmt.Sprintf("n%d", i-1),
+			Type:       EdgeTypeDependsOn,
+		})
+	}
+	return g
+}
+
+func BenchmarkGetDependencies_10kNodes(b *testing.B) {
+	g := buildChainGraph(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = g.GetDependencies(fmt.Sprintf("n%d", i%10000))
+	}
+}
+
+func BenchmarkGetDependencies_10kNodes_LinearScan(b *testing.B) {
+	g := buildChainGraph(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		nodeID := fmt.Sprintf("n%d", i%10000)
+		deps := make([]*Node, 0)
+		for _, edge := range g.Edges {
+			if edge.Type == EdgeTypeDependsOn && edge.FromNodeID == nodeID {
+				deps = append(deps, g.Nodes[edge.ToNodeID])
+			}
+		}
+		_ = deps
+	}
+}
@@ -0,0 +1,122 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AddNodes adds a batch of nodes. The whole batch is validated first and
+// either every node is added or, if any node is invalid, none are. All
+// validation failures are reported together.
+func (g *Graph) AddNodes(nodes []*Node) error {
+	var errs []error
+	seen := make(map[string]bool, len(nodes))
+
+	for i, node := range nodes {
+		switch {
+		case node == nil:
+			errs = append(errs, fmt.Errorf("node %d: node cannot be nil", i))
+		case node.ID == "":
+			errs = append(errs, fmt.Errorf("node %d: node ID cannot be empty", i))
+		case seen[node.ID]:
+			errs = append(errs, fmt.Errorf("node with ID %s appears more than once in batch", node.ID))
+		default:
+			if _, exists := g.Nodes[node.ID]; exists {
+				errs = append(errs, fmt.Errorf("node with ID %s already exists", node.ID))
+			}
+			seen[node.ID] = true
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	now := time.Now()
+	for _, node := range nodes {
+		if node.State == "" {
+			node.State = NodeStateWaiting
+		}
+		node.CreatedAt = now
+		node.UpdatedAt = now
+		g.Nodes[node.ID] = node
+	}
+	g.UpdatedAt = now
+	for _, node := range nodes {
+		g.notifyNodeAdded(node)
+	}
+
+	return nil
+}
+
+// AddEdges adds a batch of edges. Referential and edge type checks run for
+// every edge up front, and cycle detection runs once after the batch has been
+// applied. If anything fails the graph is left exactly as it was.
+func (g *Graph) AddEdges(edges []*Edge) error {
+	var errs []error
+	seen := make(map[string]bool, len(edges))
+
+	for i, edge := range edges {
+		if edge == nil {
+			errs = append(errs, fmt.Errorf("edge %d: edge cannot be nil", i))
+			continue
+		}
+		if edge.ID == "" {
+			errs = append(errs, fmt.Errorf("edge %d: edge ID cannot be empty", i))
+			continue
+		}
+		if seen[edge.ID] {
+			errs = append(errs, fmt.Errorf("edge with ID %s appears more than once in batch", edge.ID))
+			continue
+		}
+		seen[edge.ID] = true
+
+		if _, exists := g.Edges[edge.ID]; exists {
+			errs = append(errs, fmt.Errorf("edge with ID %s already exists", edge.ID))
+			continue
+		}
+		_, fromExists := g.Nodes[edge.FromNodeID]
+		if !fromExists {
+			errs = append(errs, fmt.Errorf("edge %s: from node %s does not exist", edge.ID, edge.FromNodeID))
+		}
+		_, toExists := g.Nodes[edge.ToNodeID]
+		if !toExists {
+			errs = append(errs, fmt.Errorf("edge %s: to node %s does not exist", edge.ID, edge.ToNodeID))
+		}
+		if fromExists && toExists {
+			if err := g.validateEdge(edge); err != nil {
+				errs = append(errs, fmt.Errorf("edge %s: %w", edge.ID, err))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	idx := g.index()
+	for _, edge := range edges {
+		idx.add(edge)
+		g.Edges[edge.ID] = edge
+	}
+
+	if g.HasCycle() {
+		for _, edge := range edges {
+			idx.remove(edge)
+			delete(g.Edges, edge.ID)
+		}
+		return fmt.Errorf("adding edges would create a cycle")
+	}
+
+	now := time.Now()
+	for _, edge := range edges {
+		edge.CreatedAt = now
+	}
+	g.UpdatedAt = now
+	for _, edge := range edges {
+		g.notifyEdgeAdded(edge)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraph_AddNodes(t *testing.T) {
+	g := NewGraph("test")
+
+	err := g.AddNodes([]*Node{
+		{ID: "wf", Type: NodeTypeWorkflow, Name: "Workflow"},
+		{ID: "step", Type: NodeTypeStep, Name: "Step"},
+	})
+	require.NoError(t, err)
+
+	assert.Len(t, g.Nodes, 2)
+	assert.Equal(t, NodeStateWaiting, g.Nodes["step"].State)
+	assert.False(t, g.Nodes["wf"].CreatedAt.IsZero())
+}
+
+func TestGraph_AddNodes_AllOrNothing(t *testing.T) {
+	g := NewGraph("test")
+	require.NoError(t, g.AddNode(&Node{ID: "existing", Type: NodeTypeSpec}))
+
+	err := g.AddNodes([]*Node{
+		{ID: "a", Type: NodeTypeSpec},
+		{ID: "existing", Type: NodeTypeSpec},
+		{ID: "a", Type: NodeTypeSpec},
+		nil,
+		{ID: "", Type: NodeTypeSpec},
+	})
+	require.Error(t, err)
+
+	assert.Contains(t, err.Error(), "node with ID existing already exists")
+	assert.Contains(t, err.Error(), "appears more than once")
+	assert.Contains(t, err.Error(), "node cannot be nil")
+	assert.Contains(t, err.Error(), "node ID cannot be empty")
+	assert.Len(t, g.Nodes, 1)
+}
+
+func TestGraph_AddEdges(t *testing.T) {
+	g := NewGraph("test")
+	require.NoError(t, g.AddNodes([]*Node{
+		{ID: "wf", Type: NodeTypeWorkflow},
+		{ID: "step1", Type: NodeTypeStep},
+		{ID: "step2", Type: NodeTypeStep},
+	}))
+
+	err := g.AddEdges([]*Edge{
+		{ID: "c1", FromNodeID: "wf", ToNodeID: "step1", Type: EdgeTypeContains},
+		{ID: "c2", FromNodeID: "wf", ToNodeID: "step2", Type: EdgeTypeContains},
+		{ID: "d1", FromNodeID: "step2", ToNodeID: "step1", Type: EdgeTypeDependsOn},
+	})
+	require.NoError(t, err)
+
+	assert.Len(t, g.Edges, 3)
+	assert.Len(t, g.GetChildSteps("wf"), 2)
+}
+
+func TestGraph_AddEdges_ValidationFailure(t *testing.T) {
+	g := NewGraph("test")
+	require.NoError(t, g.AddNodes([]*Node{
+		{ID: "wf", Type: NodeTypeWorkflow},
+		{ID: "step", Type: NodeTypeStep},
+	}))
+
+	err := g.AddEdges([]*Edge{
+		{ID: "ok", FromNodeID: "wf", ToNodeID: "step", Type: EdgeTypeContains},
+		{ID: "bad-type", FromNodeID: "step", ToNodeID: "wf", Type: EdgeTypeContains},
+		{ID: "missing", FromNodeID: "wf", ToNodeID: "ghost", Type: EdgeTypeDependsOn},
+	})
+	require.Error(t, err)
+
+	assert.Contains(t, err.Error(), "contains edge can only originate from workflow nodes")
+	assert.Contains(t, err.Error(), "to node ghost does not exist")
+	assert.Empty(t, g.Edges)
+	assert.Empty(t, g.OutgoingEdges("wf"))
+}
+
+func TestGraph_AddEdges_CycleRollsBack(t *testing.T) {
+	g := NewGraph("test")
+	require.NoError(t, g.AddNodes([]*Node{
+		{ID: "a", Type: NodeTypeStep},
+		{ID: "b", Type: NodeTypeStep},
+	}))
+	require.NoError(t, g.AddEdge(&Edge{ID: "pre", FromNodeID: "a", ToNodeID: "b", Type: EdgeTypeDependsOn}))
+
+	err := g.AddEdges([]*Edge{
+		{ID: "back", FromNodeID: "b", ToNodeID: "a", Type: EdgeTypeDependsOn},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cycle")
+
+	assert.Len(t, g.Edges, 1)
+	assert.Len(t, g.OutgoingEdges("b"), 0)
+	assert.False(t, g.HasCycle())
+}
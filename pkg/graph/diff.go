@@ -0,0 +1,149 @@
+package graph
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+// FieldChange is a field of a node or edge whose value differs. Properties
+// are compared one by one, as "properties.<key>".
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old,omitempty"`
+	New   interface{} `json:"new,omitempty"`
+}
+
+// NodeChange lists the changed fields of a node in both graphs
+type NodeChange struct {
+	ID      string        `json:"id"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// EdgeChange lists the changed fields of an edge in both graphs
+type EdgeChange struct {
+	ID      string        `json:"id"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// GraphDiff is the structural difference between two graphs. Nodes and
+// edges are matched by ID and each list is sorted by ID. Runtime fields,
+// such as states and timestamps, are not compared.
+type GraphDiff struct {
+	AddedNodes   []*Node      `json:"added_nodes"`
+	RemovedNodes []*Node      `json:"removed_nodes"`
+	ChangedNodes []NodeChange `json:"changed_nodes"`
+	AddedEdges   []*Edge      `json:"added_edges"`
+	RemovedEdges []*Edge      `json:"removed_edges"`
+	ChangedEdges []EdgeChange `json:"changed_edges"`
+}
+
+// Empty reports whether both graphs have the same structure
+func (d *GraphDiff) Empty() bool {
+	return len(d.AddedNodes) == 0 && len(d.RemovedNodes) == 0 && len(d.ChangedNodes) == 0 &&
+		len(d.AddedEdges) == 0 && len(d.RemovedEdges) == 0 && len(d.ChangedEdges) == 0
+}
+
+// Diff returns the changes that turn from into to. Either graph may be nil
+// for an empty graph.
+func Diff(from, to *Graph) *GraphDiff {
+	if from == nil {
+		from = &Graph{}
+	}
+	if to == nil {
+		to = &Graph{}
+	}
+	diff := &GraphDiff{
+		AddedNodes:   []*Node{},
+		RemovedNodes: []*Node{},
+		ChangedNodes: []NodeChange{},
+		AddedEdges:   []*Edge{},
+		RemovedEdges: []*Edge{},
+		ChangedEdges: []EdgeChange{},
+	}
+
+	for _, id := range sortedIDs(from.Nodes, to.Nodes) {
+		before, after := from.Nodes[id], to.Nodes[id]
+		switch {
+		case before == nil:
+			diff.AddedNodes = append(diff.AddedNodes, after)
+		case after == nil:
+			diff.RemovedNodes = append(diff.RemovedNodes, before)
+		default:
+			var changes []FieldChange
+			changes = appendChange(changes, "type", before.Type, after.Type)
+			changes = appendChange(changes, "name", before.Name, after.Name)
+			changes = appendChange(changes, "description", before.Description, after.Description)
+			changes = appendPropertyChanges(changes, before.Properties, after.Properties)
+			if len(changes) > 0 {
+				diff.ChangedNodes = append(diff.ChangedNodes, NodeChange{ID: id, Changes: changes})
+			}
+		}
+	}
+
+	for _, id := range sortedIDs(from.Edges, to.Edges) {
+		before, after := from.Edges[id], to.Edges[id]
+		switch {
+		case before == nil:
+			diff.AddedEdges = append(diff.AddedEdges, after)
+		case after == nil:
+			diff.RemovedEdges = append(diff.RemovedEdges, before)
+		default:
+			var changes []FieldChange
+			changes = appendChange(changes, "from_node_id", before.FromNodeID, after.FromNodeID)
+			changes = appendChange(changes, "to_node_id", before.ToNodeID, after.ToNodeID)
+			changes = appendChange(changes, "type", before.Type, after.Type)
+			changes = appendChange(changes, "description", before.Description, after.Description)
+			changes = appendPropertyChanges(changes, before.Properties, after.Properties)
+			if len(changes) > 0 {
+				diff.ChangedEdges = append(diff.ChangedEdges, EdgeChange{ID: id, Changes: changes})
+			}
+		}
+	}
+	return diff
+}
+
+func appendChange[T comparable](changes []FieldChange, field string, before, after T) []FieldChange {
+	if before == after {
+		return changes
+	}
+	return append(changes, FieldChange{Field: field, Old: before, New: after})
+}
+
+// appendPropertyChanges compares properties by their JSON encoding, as
+// stored and uploaded properties decode numbers differently
+func appendPropertyChanges(changes []FieldChange, before, after map[string]interface{}) []FieldChange {
+	for _, key := range sortedIDs(before, after) {
+		oldValue, inOld := before[key]
+		newValue, inNew := after[key]
+		if inOld && inNew && jsonEqual(oldValue, newValue) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: "properties." + key, Old: oldValue, New: newValue})
+	}
+	return changes
+}
+
+func jsonEqual(a, b interface{}) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return reflect.DeepEqual(a, b)
+	}
+	return string(encodedA) == string(encodedB)
+}
+
+// sortedIDs returns the keys of both maps, sorted
+func sortedIDs[V any](a, b map[string]V) []string {
+	ids := make([]string, 0, len(a)+len(b))
+	for id := range a {
+		ids = append(ids, id)
+	}
+	for id := range b {
+		if _, exists := a[id]; !exists {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
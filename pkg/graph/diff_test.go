@@ -0,0 +1,59 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	from := createTestGraph()
+	from.Nodes["resource1"].Properties = map[string]interface{}{"size": float64(10), "tier": "prod"}
+	to := createTestGraph()
+	to.Nodes["resource1"].Properties = map[string]interface{}{"size": 20, "engine": "postgres", "tier": "prod"}
+	to.Nodes["workflow2"].Name = "Deploy API v2"
+	to.Nodes["spec1"].State = NodeStateSucceeded // States are not compared
+	require.NoError(t, to.AddNode(&Node{ID: "resource3", Type: NodeTypeResource, Name: "Cache"}))
+	require.NoError(t, to.AddEdge(&Edge{ID: "e6", FromNodeID: "workflow2", ToNodeID: "resource3", Type: EdgeTypeProvisions}))
+	to.Edges["e3"].Type = EdgeTypeBindsTo
+	delete(to.Edges, "e5")
+	delete(to.Nodes, "resource2")
+
+	diff := Diff(from, to)
+	assert.False(t, diff.Empty())
+
+	require.Len(t, diff.AddedNodes, 1)
+	assert.Equal(t, "resource3", diff.AddedNodes[0].ID)
+	require.Len(t, diff.RemovedNodes, 1)
+	assert.Equal(t, "resource2", diff.RemovedNodes[0].ID)
+	assert.Equal(t, []NodeChange{
+		{ID: "resource1", Changes: []FieldChange{
+			{Field: "properties.engine", New: "postgres"},
+			{Field: "properties.size", Old: float64(10), New: 20},
+		}},
+		{ID: "workflow2", Changes: []FieldChange{{Field: "name", Old: "Deploy API", New: "Deploy API v2"}}},
+	}, diff.ChangedNodes)
+
+	require.Len(t, diff.AddedEdges, 1)
+	assert.Equal(t, "e6", diff.AddedEdges[0].ID)
+	require.Len(t, diff.RemovedEdges, 1)
+	assert.Equal(t, "e5", diff.RemovedEdges[0].ID)
+	assert.Equal(t, []EdgeChange{
+		{ID: "e3", Changes: []FieldChange{{Field: "type", Old: EdgeTypeDependsOn, New: EdgeTypeBindsTo}}},
+	}, diff.ChangedEdges)
+}
+
+func TestDiff_Empty(t *testing.T) {
+	g := createTestGraph()
+	g.Nodes["resource1"].Properties = map[string]interface{}{"size": 10}
+	other := createTestGraph()
+	other.Nodes["resource1"].Properties = map[string]interface{}{"size": float64(10)}
+	assert.True(t, Diff(g, other).Empty(), "numbers are compared by value")
+
+	diff := Diff(nil, g)
+	assert.Len(t, diff.AddedNodes, len(g.Nodes))
+	assert.Len(t, diff.AddedEdges, len(g.Edges))
+	assert.Empty(t, Diff(g, nil).AddedNodes)
+	assert.Len(t, Diff(g, nil).RemovedNodes, len(g.Nodes))
+}
@@ -0,0 +1,53 @@
+package graph
+
+// GraphObserver is notified of the changes of the graphs it observes, after
+// they are made. State changes propagated by UpdateNodeState are notified
+// like the change that caused them, and the edges removed with a node
+// before the node.
+type GraphObserver interface {
+	OnNodeAdded(g *Graph, node *Node)
+	OnNodeRemoved(g *Graph, node *Node)
+	OnEdgeAdded(g *Graph, edge *Edge)
+	OnEdgeRemoved(g *Graph, edge *Edge)
+	OnNodeStateChange(g *Graph, node *Node, oldState, newState NodeState)
+}
+
+// Observe registers an observer to be notified of the changes of g made
+// through its methods. Changes to the Nodes and Edges maps themselves are
+// not seen.
+func (g *Graph) Observe(observer GraphObserver) {
+	g.observers = append(g.observers, observer)
+}
+
+func (g *Graph) notifyNodeAdded(node *Node) {
+	for _, observer := range g.observers {
+		observer.OnNodeAdded(g, node)
+	}
+}
+
+func (g *Graph) notifyNodeRemoved(node *Node) {
+	for _, observer := range g.observers {
+		observer.OnNodeRemoved(g, node)
+	}
+}
+
+func (g *Graph) notifyEdgeAdded(edge *Edge) {
+	for _, observer := range g.observers {
+		observer.OnEdgeAdded(g, edge)
+	}
+}
+
+func (g *Graph) notifyEdgeRemoved(edge *Edge) {
+	for _, observer := range g.observers {
+		observer.OnEdgeRemoved(g, edge)
+	}
+}
+
+// markState sets the state of a node of g and notifies the observers
+func (g *Graph) markState(node *Node, state NodeState) {
+	oldState := node.State
+	node.MarkState(state)
+	for _, observer := range g.observers {
+		observer.OnNodeStateChange(g, node, oldState, state)
+	}
+}
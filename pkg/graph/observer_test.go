@@ -0,0 +1,41 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// changeLog records the notifications of a GraphObserver as strings
+type changeLog []string
+
+func (l *changeLog) OnNodeAdded(g *Graph, node *Node)   { *l = append(*l, "+node "+node.ID) }
+func (l *changeLog) OnNodeRemoved(g *Graph, node *Node) { *l = append(*l, "-node "+node.ID) }
+func (l *changeLog) OnEdgeAdded(g *Graph, edge *Edge)   { *l = append(*l, "+edge "+edge.ID) }
+func (l *changeLog) OnEdgeRemoved(g *Graph, edge *Edge) { *l = append(*l, "-edge "+edge.ID) }
+func (l *changeLog) OnNodeStateChange(g *Graph, node *Node, oldState, newState NodeState) {
+	*l = append(*l, "state "+node.ID+" "+string(oldState)+"->"+string(newState))
+}
+
+func TestObserve_NotifiesBatchesOnceApplied(t *testing.T) {
+	g := NewGraph("app")
+	var log changeLog
+	g.Observe(&log)
+
+	require.NoError(t, g.AddNodes([]*Node{
+		{ID: "a", Type: NodeTypeWorkflow, Name: "A"},
+		{ID: "b", Type: NodeTypeWorkflow, Name: "B"},
+	}))
+	require.NoError(t, g.AddEdges([]*Edge{{ID: "ab", FromNodeID: "a", ToNodeID: "b", Type: EdgeTypeDependsOn}}))
+	// A batch that would create a cycle is rolled back without notifications
+	assert.Error(t, g.AddEdges([]*Edge{{ID: "ba", FromNodeID: "b", ToNodeID: "a", Type: EdgeTypeDependsOn}}))
+	require.NoError(t, g.UpdateNodeState("a", NodeStateRunning))
+	require.NoError(t, g.RemoveEdge("ab"))
+
+	assert.Equal(t, changeLog{
+		"+node a", "+node b", "+edge ab",
+		"state a waiting->running",
+		"-edge ab",
+	}, log)
+}
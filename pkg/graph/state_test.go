@@ -2,8 +2,10 @@ package graph
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGraph_UpdateNodeState(t *testing.T) {
@@ -344,3 +346,22 @@ func TestGraph_ComplexStatePropagation(t *testing.T) {
 	assert.Equal(t, NodeStateWaiting, step1.State)
 	assert.Equal(t, NodeStateWaiting, step3.State)
 }
+
+func TestNode_MarkState_Timing(t *testing.T) {
+	node := &Node{ID: "step", Type: NodeTypeStep}
+
+	node.MarkState(NodeStateRunning)
+	require.NotNil(t, node.StartedAt)
+	assert.Nil(t, node.CompletedAt)
+
+	started := time.Now().Add(-time.Minute)
+	node.StartedAt = &started
+	node.MarkState(NodeStateSucceeded)
+	require.NotNil(t, node.CompletedAt)
+	assert.InDelta(t, time.Minute, node.Duration, float64(time.Second))
+
+	node.MarkState(NodeStateWaiting)
+	assert.Nil(t, node.StartedAt)
+	assert.Nil(t, node.CompletedAt)
+	assert.Zero(t, node.Duration)
+}
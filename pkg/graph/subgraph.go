@@ -0,0 +1,73 @@
+package graph
+
+import (
+	"maps"
+	"sort"
+)
+
+// Closure returns the given node IDs and all nodes reachable from them over
+// outgoing edges (dependencies, contained steps, provisioned resources, ...),
+// sorted by ID. Unknown node IDs are ignored.
+func (g *Graph) Closure(nodeIDs []string) []string {
+	included := make(map[string]bool, len(nodeIDs))
+	frontier := make([]string, 0, len(nodeIDs))
+	for _, id := range nodeIDs {
+		if _, exists := g.Nodes[id]; exists && !included[id] {
+			included[id] = true
+			frontier = append(frontier, id)
+		}
+	}
+
+	for len(frontier) > 0 {
+		id := frontier[len(frontier)-1]
+		frontier = frontier[:len(frontier)-1]
+		for _, edge := range g.OutgoingEdges(id) {
+			if _, exists := g.Nodes[edge.ToNodeID]; exists && !included[edge.ToNodeID] {
+				included[edge.ToNodeID] = true
+				frontier = append(frontier, edge.ToNodeID)
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(included))
+	for id := range included {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Subgraph returns a graph with the given nodes and the edges between them.
+// Nodes and edges are copies with their own property maps, so changing their
+// state, timestamps or properties does not affect g; nested property values
+// are shared. Unknown node IDs are ignored.
+func (g *Graph) Subgraph(nodeIDs []string) *Graph {
+	sub := &Graph{
+		ID:        g.ID,
+		AppName:   g.AppName,
+		Version:   g.Version,
+		Nodes:     make(map[string]*Node, len(nodeIDs)),
+		Edges:     make(map[string]*Edge),
+		Metadata:  g.Metadata,
+		CreatedAt: g.CreatedAt,
+		UpdatedAt: g.UpdatedAt,
+	}
+
+	for _, id := range nodeIDs {
+		if node, exists := g.Nodes[id]; exists {
+			clone := *node
+			clone.Properties = maps.Clone(node.Properties)
+			sub.Nodes[id] = &clone
+		}
+	}
+
+	for id, edge := range g.Edges {
+		if sub.Nodes[edge.FromNodeID] != nil && sub.Nodes[edge.ToNodeID] != nil {
+			clone := *edge
+			clone.Properties = maps.Clone(edge.Properties)
+			sub.Edges[id] = &clone
+		}
+	}
+
+	return sub
+}
@@ -0,0 +1,42 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraph_Closure(t *testing.T) {
+	g := createTestGraph()
+
+	assert.Equal(t, []string{"resource1", "spec1", "workflow1"}, g.Closure([]string{"workflow1"}))
+	assert.Equal(t, []string{"resource1", "resource2", "spec2", "workflow2"}, g.Closure([]string{"workflow2", "spec2"}))
+	assert.Equal(t, []string{"resource1"}, g.Closure([]string{"resource1", "unknown"}))
+	assert.Empty(t, g.Closure(nil))
+}
+
+func TestGraph_Subgraph(t *testing.T) {
+	g := createTestGraph()
+
+	sub := g.Subgraph([]string{"workflow2", "resource1", "resource2", "unknown"})
+	assert.Equal(t, g.AppName, sub.AppName)
+	assert.Len(t, sub.Nodes, 3)
+	assert.ElementsMatch(t, []string{"e3", "e5"}, keys(sub.Edges))
+	assert.Len(t, sub.OutgoingEdges("workflow2"), 2)
+
+	// Nodes are copies, so the original graph is left untouched
+	sub.Nodes["resource1"].State = NodeStateFailed
+	assert.NotEqual(t, NodeStateFailed, g.Nodes["resource1"].State)
+	g.Nodes["resource1"].Properties = map[string]interface{}{"tier": "prod"}
+	sub = g.Subgraph([]string{"resource1"})
+	sub.Nodes["resource1"].Properties["tier"] = "test"
+	assert.Equal(t, "prod", g.Nodes["resource1"].Properties["tier"])
+}
+
+func keys[V any](m map[string]V) []string {
+	result := make([]string, 0, len(m))
+	for k := range m {
+		result = append(result, k)
+	}
+	return result
+}
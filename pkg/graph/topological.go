@@ -1,49 +1,45 @@
 package graph
 
-import "fmt"
-
+import (
+	"container/heap"
+	"fmt"
+)
+
+// TopologicalSort returns the nodes in dependency-aware execution order.
+// It runs in O((V+E) log V); ties between ready nodes are broken by node ID
+// so the result is deterministic across runs.
 func (g *Graph) TopologicalSort() ([]*Node, error) {
-	inDegree := make(map[string]int)
+	inDegree := make(map[string]int, len(g.Nodes))
+	successors := make(map[string][]string, len(g.Nodes))
 
 	for nodeID := range g.Nodes {
 		inDegree[nodeID] = 0
 	}
 
 	for _, edge := range g.Edges {
-		if edge.Type == EdgeTypeDependsOn {
-			inDegree[edge.FromNodeID]++
-		} else {
-			inDegree[edge.ToNodeID]++
-		}
+		before, after := executionOrder(edge)
+		successors[before] = append(successors[before], after)
+		inDegree[after]++
 	}
 
-	queue := make([]*Node, 0)
+	ready := &idHeap{}
 	for nodeID, degree := range inDegree {
 		if degree == 0 {
-			queue = append(queue, g.Nodes[nodeID])
+			*ready = append(*ready, nodeID)
 		}
 	}
+	heap.Init(ready)
 
 	result := make([]*Node, 0, len(g.Nodes))
 
-	for len(queue) > 0 {
-		current := queue[0]
-		queue = queue[1:]
-		result = append(result, current)
-
-		for _, edge := range g.Edges {
-			var nextNodeID string
-			if edge.Type == EdgeTypeDependsOn && edge.ToNodeID == current.ID {
-				nextNodeID = edge.FromNodeID
-			} else if edge.Type != EdgeTypeDependsOn && edge.FromNodeID == current.ID {
-				nextNodeID = edge.ToNodeID
-			} else {
-				continue
-			}
+	for ready.Len() > 0 {
+		currentID := heap.Pop(ready).(string)
+		result = append(result, g.Nodes[currentID])
 
+		for _, nextNodeID := range successors[currentID] {
 			inDegree[nextNodeID]--
 			if inDegree[nextNodeID] == 0 {
-				queue = append(queue, g.Nodes[nextNodeID])
+				heap.Push(ready, nextNodeID)
 			}
 		}
 	}
@@ -55,6 +51,35 @@ func (g *Graph) TopologicalSort() ([]*Node, error) {
 	return result, nil
 }
 
+// executionOrder returns the edge endpoints as (must run first, runs after).
+// A depends-on edge points from the dependent to its dependency, every other
+// edge type points in execution order.
+func executionOrder(edge *Edge) (string, string) {
+	if edge.Type == EdgeTypeDependsOn {
+		return edge.ToNodeID, edge.FromNodeID
+	}
+	return edge.FromNodeID, edge.ToNodeID
+}
+
+// idHeap is a min-heap of node IDs used to pick the next ready node
+type idHeap []string
+
+func (h idHeap) Len() int           { return len(h) }
+func (h idHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h idHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *idHeap) Push(x interface{}) {
+	*h = append(*h, x.(string))
+}
+
+func (h *idHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
 func (g *Graph) GetDependencies(nodeID string) ([]*Node, error) {
 	_, exists := g.GetNode(nodeID)
 	if !exists {
@@ -63,8 +88,8 @@ func (g *Graph) GetDependencies(nodeID string) ([]*Node, error) {
 
 	dependencies := make([]*Node, 0)
 
-	for _, edge := range g.Edges {
-		if edge.Type == EdgeTypeDependsOn && edge.FromNodeID == nodeID {
+	for _, edge := range g.OutgoingEdges(nodeID) {
+		if edge.Type == EdgeTypeDependsOn {
 			if depNode, exists := g.GetNode(edge.ToNodeID); exists {
 				dependencies = append(dependencies, depNode)
 			}
@@ -82,8 +107,8 @@ func (g *Graph) GetDependents(nodeID string) ([]*Node, error) {
 
 	dependents := make([]*Node, 0)
 
-	for _, edge := range g.Edges {
-		if edge.Type == EdgeTypeDependsOn && edge.ToNodeID == nodeID {
+	for _, edge := range g.IncomingEdges(nodeID) {
+		if edge.Type == EdgeTypeDependsOn {
 			if depNode, exists := g.GetNode(edge.FromNodeID); exists {
 				dependents = append(dependents, depNode)
 			}
@@ -183,4 +183,36 @@ func TestGraph_HasCycle(t *testing.T) {
 	require.NoError(t, g.AddEdge(cycleEdge))
 
 	assert.True(t, g.HasCycle())
-}
\ No newline at end of file
+}
+func TestGraph_TopologicalSort_Deterministic(t *testing.T) {
+	first, err := createTestGraph().TopologicalSort()
+	require.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		sorted, err := createTestGraph().TopologicalSort()
+		require.NoError(t, err)
+		for j := range sorted {
+			assert.Equal(t, first[j].ID, sorted[j].ID)
+		}
+	}
+
+	// Ready nodes are emitted in ID order
+	assert.Equal(t, "spec1", first[0].ID)
+	assert.Equal(t, "spec2", first[1].ID)
+}
+
+func BenchmarkTopologicalSort_1000Nodes(b *testing.B) {
+	g := buildChainGraph(1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = g.TopologicalSort()
+	}
+}
+
+func BenchmarkTopologicalSort_10kNodes(b *testing.B) {
+	g := buildChainGraph(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = g.TopologicalSort()
+	}
+}
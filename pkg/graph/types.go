@@ -44,6 +44,9 @@ type Node struct {
 	Properties  map[string]interface{} `json:"properties,omitempty"`
 	CreatedAt   time.Time              `json:"created_at"`
 	UpdatedAt   time.Time              `json:"updated_at"`
+	StartedAt   *time.Time             `json:"started_at,omitempty"`   // Set when the node starts running
+	CompletedAt *time.Time             `json:"completed_at,omitempty"` // Set when the node fails or succeeds
+	Duration    time.Duration          `json:"duration,omitempty"`     // CompletedAt - StartedAt
 }
 
 type Edge struct {
@@ -56,14 +59,31 @@ type Edge struct {
 	CreatedAt   time.Time         `json:"created_at"`
 }
 
+// AppMetadata describes ownership and context of the app a graph belongs to
+type AppMetadata struct {
+	Description string            `json:"description,omitempty"`
+	Owner       string            `json:"owner,omitempty"`
+	Team        string            `json:"team,omitempty"`
+	Links       map[string]string `json:"links,omitempty"`       // Link name to URL, e.g. "runbook"
+	Annotations map[string]string `json:"annotations,omitempty"` // Free-form key/value pairs
+}
+
 type Graph struct {
 	ID        string           `json:"id"`
 	AppName   string           `json:"app_name"`
 	Version   int              `json:"version"`
 	Nodes     map[string]*Node `json:"nodes"`
 	Edges     map[string]*Edge `json:"edges"`
+	Metadata  *AppMetadata     `json:"metadata,omitempty"` // Set by storage when loading; not persisted by SaveGraph
 	CreatedAt time.Time        `json:"created_at"`
 	UpdatedAt time.Time        `json:"updated_at"`
+
+	// adj indexes edges by endpoint; it is built lazily so graphs decoded
+	// from JSON or assembled by hand are indexed on first use.
+	adj *adjacency
+
+	// observers are notified of changes, see Observe
+	observers []GraphObserver
 }
 
 func NewGraph(appName string) *Graph {
@@ -98,6 +118,7 @@ func (g *Graph) AddNode(node *Node) error {
 	node.UpdatedAt = time.Now()
 	g.Nodes[node.ID] = node
 	g.UpdatedAt = time.Now()
+	g.notifyNodeAdded(node)
 
 	return nil
 }
@@ -125,8 +146,10 @@ func (g *Graph) AddEdge(edge *Edge) error {
 	}
 
 	edge.CreatedAt = time.Now()
+	g.index().add(edge)
 	g.Edges[edge.ID] = edge
 	g.UpdatedAt = time.Now()
+	g.notifyEdgeAdded(edge)
 
 	return nil
 }
@@ -185,34 +208,39 @@ func (g *Graph) GetEdge(id string) (*Edge, bool) {
 }
 
 func (g *Graph) RemoveNode(id string) error {
-	if _, exists := g.Nodes[id]; !exists {
+	node, exists := g.Nodes[id]
+	if !exists {
 		return fmt.Errorf("node %s does not exist", id)
 	}
 
-	edgesToRemove := []string{}
-	for edgeID, edge := range g.Edges {
-		if edge.FromNodeID == id || edge.ToNodeID == id {
-			edgesToRemove = append(edgesToRemove, edgeID)
-		}
-	}
+	idx := g.index()
+	edgesToRemove := append(idx.outgoing(id), idx.incoming(id)...)
 
-	for _, edgeID := range edgesToRemove {
-		delete(g.Edges, edgeID)
+	for _, edge := range edgesToRemove {
+		idx.remove(edge)
+		delete(g.Edges, edge.ID)
 	}
 
 	delete(g.Nodes, id)
 	g.UpdatedAt = time.Now()
+	for _, edge := range edgesToRemove {
+		g.notifyEdgeRemoved(edge)
+	}
+	g.notifyNodeRemoved(node)
 
 	return nil
 }
 
 func (g *Graph) RemoveEdge(id string) error {
-	if _, exists := g.Edges[id]; !exists {
+	edge, exists := g.Edges[id]
+	if !exists {
 		return fmt.Errorf("edge %s does not exist", id)
 	}
 
+	g.index().remove(edge)
 	delete(g.Edges, id)
 	g.UpdatedAt = time.Now()
+	g.notifyEdgeRemoved(edge)
 
 	return nil
 }
@@ -225,8 +253,7 @@ func (g *Graph) UpdateNodeState(nodeID string, newState NodeState) error {
 	}
 
 	oldState := node.State
-	node.State = newState
-	node.UpdatedAt = time.Now()
+	g.markState(node, newState)
 	g.UpdatedAt = time.Now()
 
 	// Propagate state upward if step failed -> workflow failed
@@ -244,15 +271,39 @@ func (g *Graph) UpdateNodeState(nodeID string, newState NodeState) error {
 	return nil
 }
 
+// MarkState sets the node state and maintains its timing fields: entering
+// running records StartedAt, entering failed or succeeded records CompletedAt
+// and Duration, and going back to waiting or pending clears them.
+func (n *Node) MarkState(state NodeState) {
+	now := time.Now()
+	n.State = state
+	n.UpdatedAt = now
+
+	switch state {
+	case NodeStateRunning:
+		n.StartedAt = &now
+		n.CompletedAt = nil
+		n.Duration = 0
+	case NodeStateFailed, NodeStateSucceeded:
+		n.CompletedAt = &now
+		if n.StartedAt != nil {
+			n.Duration = now.Sub(*n.StartedAt)
+		}
+	case NodeStateWaiting, NodeStatePending:
+		n.StartedAt = nil
+		n.CompletedAt = nil
+		n.Duration = 0
+	}
+}
+
 // propagateFailureToParent propagates step failure to parent workflow
 func (g *Graph) propagateFailureToParent(stepID string) error {
-	for _, edge := range g.Edges {
-		if edge.Type == EdgeTypeContains && edge.ToNodeID == stepID {
+	for _, edge := range g.IncomingEdges(stepID) {
+		if edge.Type == EdgeTypeContains {
 			// Found parent workflow
 			parentNode, exists := g.GetNode(edge.FromNodeID)
 			if exists && parentNode.State != NodeStateFailed {
-				parentNode.State = NodeStateFailed
-				parentNode.UpdatedAt = time.Now()
+				g.markState(parentNode, NodeStateFailed)
 			}
 			return nil
 		}
@@ -262,12 +313,11 @@ func (g *Graph) propagateFailureToParent(stepID string) error {
 
 // updateContainedSteps updates state of child steps when workflow completes
 func (g *Graph) updateContainedSteps(workflowID string, oldState, newState NodeState) {
-	for _, edge := range g.Edges {
-		if edge.Type == EdgeTypeContains && edge.FromNodeID == workflowID {
+	for _, edge := range g.OutgoingEdges(workflowID) {
+		if edge.Type == EdgeTypeContains {
 			stepNode, exists := g.GetNode(edge.ToNodeID)
 			if exists && stepNode.State == NodeStateRunning {
-				stepNode.State = newState
-				stepNode.UpdatedAt = time.Now()
+				g.markState(stepNode, newState)
 			}
 		}
 	}
@@ -298,8 +348,8 @@ func (g *Graph) GetNodesByState(state NodeState) []*Node {
 // GetChildSteps returns all step nodes contained by a workflow
 func (g *Graph) GetChildSteps(workflowID string) []*Node {
 	steps := make([]*Node, 0)
-	for _, edge := range g.Edges {
-		if edge.Type == EdgeTypeContains && edge.FromNodeID == workflowID {
+	for _, edge := range g.OutgoingEdges(workflowID) {
+		if edge.Type == EdgeTypeContains {
 			if stepNode, exists := g.GetNode(edge.ToNodeID); exists {
 				steps = append(steps, stepNode)
 			}
@@ -310,8 +360,8 @@ func (g *Graph) GetChildSteps(workflowID string) []*Node {
 
 // GetParentWorkflow returns the parent workflow of a step node
 func (g *Graph) GetParentWorkflow(stepID string) (*Node, error) {
-	for _, edge := range g.Edges {
-		if edge.Type == EdgeTypeContains && edge.ToNodeID == stepID {
+	for _, edge := range g.IncomingEdges(stepID) {
+		if edge.Type == EdgeTypeContains {
 			if workflow, exists := g.GetNode(edge.FromNodeID); exists {
 				return workflow, nil
 			}
@@ -0,0 +1,69 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Validate checks a graph assembled without AddNode and AddEdge, e.g. one
+// decoded from JSON or loaded from storage, against the rules those methods
+// enforce: node IDs and types, edge endpoints and types, and cycles. All
+// problems are reported together, nodes and edges in ID order.
+func (g *Graph) Validate() error {
+	var errs []error
+
+	for _, id := range sortedIDs(g.Nodes, nil) {
+		node := g.Nodes[id]
+		switch {
+		case node == nil:
+			errs = append(errs, fmt.Errorf("node %s: node cannot be nil", id))
+		case node.ID == "":
+			errs = append(errs, fmt.Errorf("node %s: node ID cannot be empty", id))
+		case node.ID != id:
+			errs = append(errs, fmt.Errorf("node %s: ID %s does not match its key", id, node.ID))
+		default:
+			if !validNodeType(node.Type) {
+				errs = append(errs, fmt.Errorf("node %s: invalid node type: %s", id, node.Type))
+			}
+		}
+	}
+
+	for _, id := range sortedIDs(g.Edges, nil) {
+		edge := g.Edges[id]
+		if edge == nil {
+			errs = append(errs, fmt.Errorf("edge %s: edge cannot be nil", id))
+			continue
+		}
+		if edge.ID != id {
+			errs = append(errs, fmt.Errorf("edge %s: ID %s does not match its key", id, edge.ID))
+			continue
+		}
+		from, fromExists := g.Nodes[edge.FromNodeID]
+		if !fromExists || from == nil {
+			errs = append(errs, fmt.Errorf("edge %s: from node %s does not exist", id, edge.FromNodeID))
+		}
+		to, toExists := g.Nodes[edge.ToNodeID]
+		if !toExists || to == nil {
+			errs = append(errs, fmt.Errorf("edge %s: to node %s does not exist", id, edge.ToNodeID))
+		}
+		if from != nil && to != nil {
+			if err := g.validateEdge(edge); err != nil {
+				errs = append(errs, fmt.Errorf("edge %s: %w", id, err))
+			}
+		}
+	}
+
+	// Cycles can only be detected once every edge refers to existing nodes
+	if len(errs) == 0 && g.HasCycle() {
+		errs = append(errs, fmt.Errorf("graph contains cycles"))
+	}
+	return errors.Join(errs...)
+}
+
+func validNodeType(nodeType NodeType) bool {
+	switch nodeType {
+	case NodeTypeSpec, NodeTypeWorkflow, NodeTypeStep, NodeTypeResource:
+		return true
+	}
+	return false
+}
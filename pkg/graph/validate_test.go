@@ -0,0 +1,70 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraph_Validate(t *testing.T) {
+	g := NewGraph("test")
+	require.NoError(t, g.AddNodes([]*Node{
+		{ID: "wf", Type: NodeTypeWorkflow},
+		{ID: "step", Type: NodeTypeStep},
+	}))
+	require.NoError(t, g.AddEdge(&Edge{ID: "c", FromNodeID: "wf", ToNodeID: "step", Type: EdgeTypeContains}))
+
+	assert.NoError(t, g.Validate())
+}
+
+func TestGraph_Validate_ReportsEveryProblem(t *testing.T) {
+	g := &Graph{
+		Nodes: map[string]*Node{
+			"wf":    {ID: "wf", Type: NodeTypeWorkflow},
+			"spec":  {ID: "spec", Type: NodeTypeSpec},
+			"other": {ID: "renamed", Type: NodeTypeSpec},
+			"odd":   {ID: "odd", Type: "service"},
+		},
+		Edges: map[string]*Edge{
+			"e1": {ID: "e1", FromNodeID: "wf", ToNodeID: "db", Type: EdgeTypeProvisions},
+			"e2": {ID: "e2", FromNodeID: "wf", ToNodeID: "spec", Type: EdgeTypeContains},
+			"e3": {ID: "e3", FromNodeID: "wf", ToNodeID: "spec", Type: "owns"},
+		},
+	}
+
+	err := g.Validate()
+	require.Error(t, err)
+	assert.Equal(t, []string{
+		"node odd: invalid node type: service",
+		"node other: ID renamed does not match its key",
+		"edge e1: to node db does not exist",
+		"edge e2: contains edge can only target step nodes",
+		"edge e3: invalid edge type: owns",
+	}, unjoin(err))
+}
+
+func TestGraph_Validate_Cycle(t *testing.T) {
+	g := &Graph{
+		Nodes: map[string]*Node{
+			"a": {ID: "a", Type: NodeTypeSpec},
+			"b": {ID: "b", Type: NodeTypeSpec},
+		},
+		Edges: map[string]*Edge{
+			"ab": {ID: "ab", FromNodeID: "a", ToNodeID: "b", Type: EdgeTypeDependsOn},
+			"ba": {ID: "ba", FromNodeID: "b", ToNodeID: "a", Type: EdgeTypeDependsOn},
+		},
+	}
+
+	err := g.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "graph contains cycles")
+}
+
+func unjoin(err error) []string {
+	var messages []string
+	for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+		messages = append(messages, err.Error())
+	}
+	return messages
+}
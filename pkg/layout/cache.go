@@ -0,0 +1,183 @@
+package layout
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// CacheStats reports the effectiveness of a LayoutCache
+type CacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+}
+
+// LayoutCache keeps computed layouts in an LRU cache keyed by a hash of the
+// graph's structure and the layout options, so that graphs whose topology
+// has not changed, e.g. after state changes only, are not laid out again.
+// Callers get their own copy of a cached layout and may modify it. A nil
+// cache computes every layout. It is safe for concurrent use.
+type LayoutCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+	hits    int64
+	misses  int64
+}
+
+type layoutCacheEntry struct {
+	key    string
+	layout *GraphLayout
+}
+
+// NewLayoutCache creates a cache holding up to size layouts (defaults to 128)
+func NewLayoutCache(size int) *LayoutCache {
+	if size <= 0 {
+		size = 128
+	}
+	return &LayoutCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// ComputeLayout returns the cached layout of a graph with the same structure
+// and options, or computes and caches it
+func (c *LayoutCache) ComputeLayout(g *graph.Graph, opts LayoutOptions) (*GraphLayout, error) {
+	if c == nil {
+		return ComputeLayout(g, opts)
+	}
+
+	key, err := ContentHash(g, opts)
+	if err != nil {
+		return nil, err
+	}
+	if gl, ok := c.get(key); ok {
+		return gl.clone(), nil
+	}
+
+	gl, err := ComputeLayout(g, opts)
+	if err != nil {
+		return nil, err
+	}
+	c.put(key, gl.clone())
+	return gl, nil
+}
+
+// Stats returns the hit and miss counters and the number of cached layouts
+func (c *LayoutCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{Hits: c.hits, Misses: c.misses, Entries: c.order.Len()}
+}
+
+func (c *LayoutCache) get(key string) (*GraphLayout, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	c.hits++
+	return element.Value.(*layoutCacheEntry).layout, true
+}
+
+func (c *LayoutCache) put(key string, gl *GraphLayout) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = &layoutCacheEntry{key: key, layout: gl}
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&layoutCacheEntry{key: key, layout: gl})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*layoutCacheEntry).key)
+	}
+}
+
+// ContentHash hashes everything a layout of g with opts depends on: the
+// options with defaults applied, the node IDs and types, the edges' ends and
+// types, and for timeline and swimlane layouts the node names, run times and
+// lane property values. Node states, descriptions and other properties do
+// not change the hash.
+func ContentHash(g *graph.Graph, opts LayoutOptions) (string, error) {
+	opts = withDefaults(opts)
+	encoded, err := json.Marshal(opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode layout options: %w", err)
+	}
+
+	h := sha256.New()
+	h.Write(encoded)
+	for _, id := range sortedNodeIDs(g) {
+		node := g.Nodes[id]
+		writeHashFields(h, "node", id, string(node.Type))
+		switch {
+		case opts.Type == LayoutTimeline:
+			writeHashFields(h, node.Name, hashTime(node.StartedAt), hashTime(node.CompletedAt), node.Duration.String())
+		case opts.Type == LayoutSwimlane && opts.LaneProperty != "":
+			writeHashFields(h, fmt.Sprint(node.Properties[opts.LaneProperty]))
+		}
+	}
+
+	edges := make([]string, 0, len(g.Edges))
+	for _, edge := range g.Edges {
+		edges = append(edges, edge.FromNodeID+"\x00"+edge.ToNodeID+"\x00"+string(edge.Type))
+	}
+	sort.Strings(edges)
+	for _, edge := range edges {
+		writeHashFields(h, "edge", edge)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeHashFields writes zero-terminated fields, so that adjacent fields
+// cannot run into each other
+func writeHashFields(h hash.Hash, fields ...string) {
+	for _, field := range fields {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+}
+
+func hashTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// clone copies a layout with its nodes, lanes and groups
+func (gl *GraphLayout) clone() *GraphLayout {
+	clone := *gl
+	clone.Nodes = make(map[string]*NodeLayout, len(gl.Nodes))
+	for id, node := range gl.Nodes {
+		copied := *node
+		clone.Nodes[id] = &copied
+	}
+	clone.Lanes = append([]LaneLayout(nil), gl.Lanes...)
+	clone.Groups = append([]GroupLayout(nil), gl.Groups...)
+	clone.Options.Pinned = maps.Clone(gl.Options.Pinned)
+	return &clone
+}
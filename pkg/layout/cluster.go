@@ -0,0 +1,121 @@
+package layout
+
+import (
+	"sort"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// computeClusteredLayout lays out every workflow with its contained steps
+// as a compound node: the workflow and its steps are first arranged
+// hierarchically on their own, then the resulting boxes, padded by
+// NodeSpacing/2, are arranged hierarchically together with the remaining
+// nodes. Edges into or out of a cluster count as edges of the compound
+// node. Each cluster's box is returned in gl.Groups.
+func computeClusteredLayout(g *graph.Graph, gl *GraphLayout, opts LayoutOptions) {
+	members := clusterMembers(g)
+	parents := make(map[string]string)
+	for workflow, ids := range members {
+		for _, id := range ids {
+			parents[id] = workflow
+		}
+	}
+	representative := func(id string) string {
+		if workflow, ok := parents[id]; ok {
+			return workflow
+		}
+		return id
+	}
+
+	// The graph of compound and remaining nodes
+	outer := &graph.Graph{Nodes: make(map[string]*graph.Node), Edges: make(map[string]*graph.Edge)}
+	for id, node := range g.Nodes {
+		if _, contained := parents[id]; !contained {
+			outer.Nodes[id] = node
+		}
+	}
+	for id, edge := range g.Edges {
+		from, to := representative(edge.FromNodeID), representative(edge.ToNodeID)
+		if from != to {
+			outer.Edges[id] = &graph.Edge{ID: id, FromNodeID: from, ToNodeID: to, Type: edge.Type}
+		}
+	}
+
+	inner := make(map[string]*GraphLayout, len(members))
+	innerOpts := opts
+	innerOpts.Clusters = false
+	for workflow, ids := range members {
+		sub := g.Subgraph(append([]string{workflow}, ids...))
+		il := &GraphLayout{Nodes: make(map[string]*NodeLayout, len(sub.Nodes))}
+		for id := range sub.Nodes {
+			il.Nodes[id] = &NodeLayout{ID: id, Width: opts.NodeWidth, Height: opts.NodeHeight}
+		}
+		computeHierarchicalLayout(sub, il, innerOpts)
+		il.normalize()
+		inner[workflow] = il
+	}
+
+	h := newLayeredGraph(outer, assignLevels(outer))
+	h.minimizeCrossings()
+
+	padding := opts.NodeSpacing / 2
+	widths := make([]float64, len(h.level))
+	heights := make([]float64, len(h.level))
+	for v, id := range h.ids {
+		widths[v], heights[v] = opts.NodeWidth, opts.NodeHeight
+		if il, ok := inner[id]; ok {
+			widths[v], heights[v] = il.Width+2*padding, il.Height+2*padding
+		}
+	}
+	xs, ys := h.place(widths, heights, opts)
+
+	for v, id := range h.ids {
+		il, ok := inner[id]
+		if !ok {
+			node := gl.Nodes[id]
+			node.Level = h.level[v]
+			node.X, node.Y = xs[v], ys[v]
+			continue
+		}
+
+		left, top := xs[v]-widths[v]/2, ys[v]-heights[v]/2
+		for memberID, member := range il.Nodes {
+			node := gl.Nodes[memberID]
+			node.Level = h.level[v]
+			node.X, node.Y = left+padding+member.X, top+padding+member.Y
+		}
+		gl.Groups = append(gl.Groups, GroupLayout{ID: id, X: left, Y: top, Width: widths[v], Height: heights[v]})
+	}
+	sort.Slice(gl.Groups, func(i, j int) bool { return gl.Groups[i].ID < gl.Groups[j].ID })
+}
+
+// clusterMembers maps each workflow to the steps it contains, sorted by ID.
+// Like the clustered DOT export, a step contained by several workflows
+// belongs to the one with the lowest ID.
+func clusterMembers(g *graph.Graph) map[string][]string {
+	parents := make(map[string]string)
+	for _, edge := range g.Edges {
+		parent, exists := g.Nodes[edge.FromNodeID]
+		if edge.Type != graph.EdgeTypeContains || !exists || parent.Type != graph.NodeTypeWorkflow {
+			continue
+		}
+		if _, exists := g.Nodes[edge.ToNodeID]; !exists || edge.ToNodeID == edge.FromNodeID {
+			continue
+		}
+		if assigned, ok := parents[edge.ToNodeID]; !ok || edge.FromNodeID < assigned {
+			parents[edge.ToNodeID] = edge.FromNodeID
+		}
+	}
+
+	members := make(map[string][]string)
+	for step, workflow := range parents {
+		if _, nested := parents[workflow]; nested {
+			continue // Workflows contained in workflows stay top-level nodes
+		}
+		members[workflow] = append(members[workflow], step)
+	}
+	for _, ids := range members {
+		sort.Strings(ids)
+	}
+	return members
+}
@@ -0,0 +1,195 @@
+package layout
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// Adaptive cooling parameters after Hu, "Efficient and high quality
+// force-directed graph drawing" (2005)
+const (
+	coolingFactor   = 0.9
+	coolingProgress = 5
+)
+
+// barnesHutNodes is the node count from which the repulsion is approximated
+// with a Barnes-Hut quadtree instead of summed over all pairs
+const barnesHutNodes = 256
+
+// computeForceLayout runs a Fruchterman-Reingold simulation: all nodes repel
+// each other, edges pull their endpoints together and the maximum movement
+// per iteration cools down while the energy of the system stops decreasing. Nodes start on a circle in ID order, or
+// at random positions drawn from opts.Seed, so the result only depends on the
+// graph and the options. The simulation stops once no node moves further than
+// opts.Tolerance in an iteration, or after opts.Iterations iterations.
+// Pinned nodes keep their positions throughout.
+// On graphs with barnesHutNodes or more nodes the repulsion is approximated
+// in O(n log n) per iteration with a quadtree and opts.Theta.
+func computeForceLayout(g *graph.Graph, gl *GraphLayout, opts LayoutOptions) {
+	simulateForces(g, gl, opts)
+}
+
+// simulateForces runs the simulation and returns the number of iterations
+func simulateForces(g *graph.Graph, gl *GraphLayout, opts LayoutOptions) int {
+	ids := sortedNodeIDs(g)
+	n := len(ids)
+	if n == 0 {
+		return 0
+	}
+
+	// Ideal distance between connected nodes
+	k := math.Max(opts.NodeWidth, opts.NodeHeight) + opts.NodeSpacing
+
+	x := make([]float64, n)
+	y := make([]float64, n)
+	index := make(map[string]int, n)
+	radius := k * float64(n) / (2 * math.Pi)
+	var random *rand.Rand
+	if opts.Seed != 0 {
+		random = rand.New(rand.NewSource(opts.Seed))
+	}
+	for i, id := range ids {
+		index[id] = i
+		if random != nil {
+			x[i] = radius * (2*random.Float64() - 1)
+			y[i] = radius * (2*random.Float64() - 1)
+			continue
+		}
+		angle := 2 * math.Pi * float64(i) / float64(n)
+		x[i] = radius * math.Cos(angle)
+		y[i] = radius * math.Sin(angle)
+	}
+
+	// Pinned nodes do not move; the others start around their center and
+	// stay right of and below (0, 0), as the layout is not normalized
+	pinned := pins(g, opts)
+	fixed := make([]bool, n)
+	if len(pinned) > 0 {
+		var cx, cy float64
+		for _, position := range pinned {
+			cx += position.X / float64(len(pinned))
+			cy += position.Y / float64(len(pinned))
+		}
+		for i, id := range ids {
+			position, ok := pinned[id]
+			if ok {
+				x[i], y[i], fixed[i] = position.X, position.Y, true
+				continue
+			}
+			x[i] = math.Max(x[i]+cx, opts.NodeWidth/2)
+			y[i] = math.Max(y[i]+cy, opts.NodeHeight/2)
+		}
+	}
+
+	next := successors(g)
+	var springs [][2]int
+	for _, from := range ids {
+		for _, to := range next[from] {
+			springs = append(springs, [2]int{index[from], index[to]})
+		}
+	}
+
+	dx := make([]float64, n)
+	dy := make([]float64, n)
+	var stack []int
+	step := radius/2 + k
+	energy := math.Inf(1)
+	progress := 0
+	iteration := 0
+	for iteration < opts.Iterations {
+		for i := range dx {
+			dx[i], dy[i] = 0, 0
+		}
+
+		if n >= barnesHutNodes {
+			tree := newQuadtree(x, y)
+			for i := 0; i < n; i++ {
+				dx[i], dy[i], stack = tree.repulsion(i, k, opts.Theta, stack)
+			}
+		} else {
+			repulseAll(x, y, dx, dy, k)
+		}
+
+		for _, spring := range springs {
+			i, j := spring[0], spring[1]
+			fx, fy, distance := delta(x[i]-x[j], y[i]-y[j], i, j)
+			force := distance * distance / k
+			dx[i] -= fx * force
+			dy[i] -= fy * force
+			dx[j] += fx * force
+			dy[j] += fy * force
+		}
+
+		// Adaptive cooling: the step grows after a run of iterations that
+		// lowered the energy and shrinks as soon as one did not
+		previous := energy
+		energy = 0
+		for i := 0; i < n; i++ {
+			if !fixed[i] {
+				energy += dx[i]*dx[i] + dy[i]*dy[i]
+			}
+		}
+		if energy < previous {
+			progress++
+			if progress >= coolingProgress {
+				progress = 0
+				step /= coolingFactor
+			}
+		} else {
+			progress = 0
+			step *= coolingFactor
+		}
+
+		iteration++
+		var largest float64
+		for i := 0; i < n; i++ {
+			length := math.Hypot(dx[i], dy[i])
+			if length == 0 || fixed[i] {
+				continue
+			}
+			move := math.Min(length, step)
+			nx, ny := x[i]+dx[i]/length*move, y[i]+dy[i]/length*move
+			if len(pinned) > 0 {
+				nx, ny = math.Max(nx, opts.NodeWidth/2), math.Max(ny, opts.NodeHeight/2)
+			}
+			largest = math.Max(largest, math.Hypot(nx-x[i], ny-y[i]))
+			x[i], y[i] = nx, ny
+		}
+		if largest < opts.Tolerance {
+			break
+		}
+	}
+
+	for i, id := range ids {
+		gl.Nodes[id].X = x[i]
+		gl.Nodes[id].Y = y[i]
+	}
+	return iteration
+}
+
+// repulseAll adds the repulsion between all pairs of nodes to dx and dy
+func repulseAll(x, y, dx, dy []float64, k float64) {
+	for i := range x {
+		for j := i + 1; j < len(x); j++ {
+			fx, fy, distance := delta(x[i]-x[j], y[i]-y[j], i, j)
+			force := k * k / distance
+			dx[i] += fx * force
+			dy[i] += fy * force
+			dx[j] -= fx * force
+			dy[j] -= fy * force
+		}
+	}
+}
+
+// delta returns the unit vector and distance between two nodes. Nodes at the
+// same position are pushed apart in a direction derived from their indexes.
+func delta(dx, dy float64, i, j int) (float64, float64, float64) {
+	distance := math.Hypot(dx, dy)
+	if distance < 0.01 {
+		angle := float64(i*31+j) * 0.7
+		return math.Cos(angle), math.Sin(angle), 0.01
+	}
+	return dx / distance, dy / distance, distance
+}
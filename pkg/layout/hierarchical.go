@@ -0,0 +1,305 @@
+package layout
+
+import (
+	"sort"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// orderingSweeps bounds the number of down and up sweeps that reorder the
+// levels to reduce edge crossings
+const orderingSweeps = 24
+
+// computeHierarchicalLayout places nodes in rows by their longest path from a
+// root in execution order. Nodes on cycles go one level below the deepest
+// acyclic node. Edges spanning several levels get a dummy node on every level
+// in between, then the rows are reordered Sugiyama-style to reduce edge
+// crossings: sweeps down and up the levels sort each row by the median
+// position of the neighbours in the previous row, and the order with the
+// fewest crossings is kept. Rows are centered horizontally; dummy nodes take
+// up NodeSpacing so long edges pass between the nodes. With opts.Clusters,
+// workflows and their steps are laid out as compound nodes.
+func computeHierarchicalLayout(g *graph.Graph, gl *GraphLayout, opts LayoutOptions) {
+	if opts.Clusters {
+		computeClusteredLayout(g, gl, opts)
+		return
+	}
+
+	h := newLayeredGraph(g, assignLevels(g))
+	h.minimizeCrossings()
+
+	widths := make([]float64, len(h.level))
+	heights := make([]float64, len(h.level))
+	for v := range h.ids {
+		widths[v], heights[v] = opts.NodeWidth, opts.NodeHeight
+	}
+	xs, ys := h.place(widths, heights, opts)
+	for v, id := range h.ids {
+		node := gl.Nodes[id]
+		node.Level = h.level[v]
+		node.X, node.Y = xs[v], ys[v]
+	}
+}
+
+// place returns the centers of the vertices of sized boxes: rows are
+// stacked top to bottom, LevelSpacing apart and as high as their highest
+// box, and centered horizontally with NodeSpacing between the boxes. Boxes
+// are centered vertically within their row.
+func (h *layeredGraph) place(widths, heights []float64, opts LayoutOptions) ([]float64, []float64) {
+	rowWidth := func(row []int) float64 {
+		var width float64
+		for i, v := range row {
+			if i > 0 {
+				width += opts.NodeSpacing
+			}
+			width += widths[v]
+		}
+		return width
+	}
+
+	var widest float64
+	for _, row := range h.rows {
+		widest = max(widest, rowWidth(row))
+	}
+
+	xs := make([]float64, len(h.level))
+	ys := make([]float64, len(h.level))
+	top := 0.0
+	for _, row := range h.rows {
+		var height float64
+		for _, v := range row {
+			height = max(height, heights[v])
+		}
+
+		x := (widest - rowWidth(row)) / 2
+		for i, v := range row {
+			if i > 0 {
+				x += opts.NodeSpacing
+			}
+			xs[v] = x + widths[v]/2
+			ys[v] = top + height/2
+			x += widths[v]
+		}
+		top += height + opts.LevelSpacing
+	}
+	return xs, ys
+}
+
+// layeredGraph is a graph whose vertices are assigned to rows and whose
+// edges only connect adjacent rows. Vertices are the nodes in ID order
+// followed by the dummy vertices splitting long edges.
+type layeredGraph struct {
+	ids   []string // Node IDs of the real vertices
+	rows  [][]int  // Vertices per row, in drawing order
+	level []int    // Row of each vertex
+	up    [][]int  // Neighbours in the row above
+	down  [][]int  // Neighbours in the row below
+}
+
+func newLayeredGraph(g *graph.Graph, levels map[string]int) *layeredGraph {
+	h := &layeredGraph{ids: sortedNodeIDs(g)}
+	index := make(map[string]int, len(h.ids))
+	for i, id := range h.ids {
+		index[id] = i
+		h.addVertex(levels[id])
+	}
+
+	next := successors(g)
+	for _, from := range h.ids {
+		for _, to := range next[from] {
+			top, bottom := index[from], index[to]
+			if h.level[top] == h.level[bottom] {
+				continue // Cycle within a level
+			}
+			if h.level[top] > h.level[bottom] {
+				top, bottom = bottom, top
+			}
+			for h.level[bottom]-h.level[top] > 1 {
+				dummy := h.addVertex(h.level[top] + 1)
+				h.connect(top, dummy)
+				top = dummy
+			}
+			h.connect(top, bottom)
+		}
+	}
+	return h
+}
+
+func (h *layeredGraph) addVertex(level int) int {
+	v := len(h.level)
+	h.level = append(h.level, level)
+	h.up = append(h.up, nil)
+	h.down = append(h.down, nil)
+	for len(h.rows) <= level {
+		h.rows = append(h.rows, nil)
+	}
+	h.rows[level] = append(h.rows[level], v)
+	return v
+}
+
+func (h *layeredGraph) connect(top, bottom int) {
+	h.down[top] = append(h.down[top], bottom)
+	h.up[bottom] = append(h.up[bottom], top)
+}
+
+func (h *layeredGraph) isDummy(v int) bool {
+	return v >= len(h.ids)
+}
+
+// minimizeCrossings reorders the rows with alternating down and up median
+// sweeps until there are no crossings, a sweep pair brings no improvement or
+// orderingSweeps is reached, and keeps the best order found
+func (h *layeredGraph) minimizeCrossings() {
+	best := h.crossings()
+	bestRows := h.copyRows()
+	for sweep := 0; sweep < orderingSweeps && best > 0; sweep += 2 {
+		for level := 1; level < len(h.rows); level++ {
+			h.sortRow(level, h.up)
+		}
+		for level := len(h.rows) - 2; level >= 0; level-- {
+			h.sortRow(level, h.down)
+		}
+
+		crossings := h.crossings()
+		if crossings >= best {
+			break
+		}
+		best = crossings
+		bestRows = h.copyRows()
+	}
+	h.rows = bestRows
+}
+
+// sortRow orders a row by the median position of each vertex's neighbours
+// in the adjacent row; vertices without neighbours keep their position
+func (h *layeredGraph) sortRow(level int, neighbours [][]int) {
+	position := h.positions()
+	row := h.rows[level]
+	keys := make(map[int]float64, len(row))
+	for i, v := range row {
+		keys[v] = float64(i)
+		if len(neighbours[v]) > 0 {
+			keys[v] = median(neighbours[v], position)
+		}
+	}
+	sort.SliceStable(row, func(i, j int) bool { return keys[row[i]] < keys[row[j]] })
+}
+
+// median returns the median position of the given vertices. For an even
+// count it is the mean of the two middle positions, which for two vertices
+// is their barycenter.
+func median(vertices []int, position []int) float64 {
+	positions := make([]int, len(vertices))
+	for i, v := range vertices {
+		positions[i] = position[v]
+	}
+	sort.Ints(positions)
+	mid := len(positions) / 2
+	if len(positions)%2 == 1 {
+		return float64(positions[mid])
+	}
+	return float64(positions[mid-1]+positions[mid]) / 2
+}
+
+// positions returns the index of each vertex within its row
+func (h *layeredGraph) positions() []int {
+	position := make([]int, len(h.level))
+	for _, row := range h.rows {
+		for i, v := range row {
+			position[v] = i
+		}
+	}
+	return position
+}
+
+// crossings counts the pairs of crossing edges between all adjacent rows
+func (h *layeredGraph) crossings() int {
+	position := h.positions()
+	total := 0
+	for level := 0; level+1 < len(h.rows); level++ {
+		var edges [][2]int
+		for _, v := range h.rows[level] {
+			for _, w := range h.down[v] {
+				edges = append(edges, [2]int{position[v], position[w]})
+			}
+		}
+		total += countInversions(edges, len(h.rows[level+1]))
+	}
+	return total
+}
+
+// countInversions counts the edge pairs (a, b), (c, d) with a < c and b > d,
+// i.e. the crossings between two rows, with a Fenwick tree over the
+// positions in the lower row
+func countInversions(edges [][2]int, width int) int {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i][0] != edges[j][0] {
+			return edges[i][0] < edges[j][0]
+		}
+		return edges[i][1] < edges[j][1]
+	})
+
+	tree := make([]int, width+1)
+	count, seen := 0, 0
+	for _, edge := range edges {
+		// Edges seen so far ending at or left of this edge's lower end
+		notCrossing := 0
+		for i := edge[1] + 1; i > 0; i -= i & -i {
+			notCrossing += tree[i]
+		}
+		count += seen - notCrossing
+		for i := edge[1] + 1; i <= width; i += i & -i {
+			tree[i]++
+		}
+		seen++
+	}
+	return count
+}
+
+func (h *layeredGraph) copyRows() [][]int {
+	rows := make([][]int, len(h.rows))
+	for i, row := range h.rows {
+		rows[i] = append([]int(nil), row...)
+	}
+	return rows
+}
+
+// assignLevels returns the longest path length from a root to each node
+func assignLevels(g *graph.Graph) map[string]int {
+	next := successors(g)
+	inDegree := make(map[string]int, len(g.Nodes))
+	for _, targets := range next {
+		for _, id := range targets {
+			inDegree[id]++
+		}
+	}
+
+	levels := make(map[string]int, len(g.Nodes))
+	var queue []string
+	for _, id := range sortedNodeIDs(g) {
+		if inDegree[id] == 0 {
+			queue = append(queue, id)
+		}
+	}
+
+	deepest := 0
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		deepest = max(deepest, levels[id])
+		for _, nextID := range next[id] {
+			levels[nextID] = max(levels[nextID], levels[id]+1)
+			inDegree[nextID]--
+			if inDegree[nextID] == 0 {
+				queue = append(queue, nextID)
+			}
+		}
+	}
+
+	for id, degree := range inDegree {
+		if degree > 0 {
+			levels[id] = deepest + 1
+		}
+	}
+	return levels
+}
@@ -0,0 +1,274 @@
+// Package layout computes node positions for drawing graphs outside of
+// Graphviz, e.g. in web frontends or in exports that carry coordinates.
+package layout
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+type LayoutType string
+
+const (
+	LayoutHierarchical LayoutType = "hierarchical" // Levels in execution order, top to bottom
+	LayoutForce        LayoutType = "force"        // Force-directed (Fruchterman-Reingold)
+	LayoutRadial       LayoutType = "radial"       // Rings around the root nodes
+	LayoutSwimlane     LayoutType = "swimlane"     // Horizontal lanes by node type or property, left to right
+	LayoutTimeline     LayoutType = "timeline"     // Start time and duration on the X axis, one lane per workflow
+)
+
+// LayoutTypes lists all supported layout types
+var LayoutTypes = []LayoutType{LayoutHierarchical, LayoutForce, LayoutRadial, LayoutSwimlane, LayoutTimeline}
+
+// LayoutOptions configures ComputeLayout. Zero values are replaced by the
+// values of DefaultOptions.
+type LayoutOptions struct {
+	Type         LayoutType `json:"type"`
+	NodeWidth    float64    `json:"node_width"`
+	NodeHeight   float64    `json:"node_height"`
+	NodeSpacing  float64    `json:"node_spacing"`  // Gap between nodes of a level or ring
+	LevelSpacing float64    `json:"level_spacing"` // Gap between levels or rings
+	Iterations   int        `json:"iterations"`    // Force layout only: maximum number of iterations
+	Tolerance    float64    `json:"tolerance"`     // Force layout only: stop once no node moves further per iteration
+	Seed         int64      `json:"seed"`          // Force layout only: random start positions; 0 starts on a circle
+	Theta        float64    `json:"theta"`         // Force layout only: Barnes-Hut accuracy on large graphs; lower is more exact
+	LaneProperty string     `json:"lane_property"` // Swimlane layout only: node property naming the lane, e.g. "team"; empty uses the node type
+	TimeScale    float64    `json:"time_scale"`    // Timeline layout only: pixels per second; 0 fits the run to one node width per started node
+	FocusNodeID  string     `json:"focus_node_id"` // Radial layout only: node in the center, rings by distance in both directions
+	Clusters     bool       `json:"clusters"`      // Hierarchical layout only: lay out workflows and their steps as compound nodes
+
+	// MinNodeDistance is the smallest gap left between node boxes once the
+	// layout is done; 0 only keeps them from overlapping
+	MinNodeDistance float64 `json:"min_node_distance"`
+
+	// Pinned fixes nodes at the given centers, e.g. after a user dragged
+	// them. The layout is then not moved to start at (0, 0), so that pinned
+	// nodes stay exactly where they are.
+	Pinned map[string]Position `json:"pinned,omitempty"`
+}
+
+// NodeLayout is the position and size of a node. X and Y are the center of
+// the node's box.
+type NodeLayout struct {
+	ID     string  `json:"id"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	Level  int     `json:"level"` // Level, ring, swimlane column or timeline lane; 0 for force layouts
+}
+
+// LaneLayout is a horizontal band of a swimlane or timeline layout spanning
+// the whole width of the layout
+type LaneLayout struct {
+	Name   string  `json:"name"`
+	Y      float64 `json:"y"` // Top of the lane
+	Height float64 `json:"height"`
+}
+
+// GroupLayout is the box of a workflow and the steps it contains in a
+// clustered layout. X and Y are the top left corner.
+type GroupLayout struct {
+	ID     string  `json:"id"` // ID of the workflow
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// GraphLayout holds the positions of all nodes of a graph. Coordinates start
+// at (0, 0) in the top left corner; Width and Height bound all node boxes
+// lanes and groups.
+type GraphLayout struct {
+	Type   LayoutType             `json:"type"`
+	Nodes  map[string]*NodeLayout `json:"nodes"`
+	Lanes  []LaneLayout           `json:"lanes,omitempty"`  // Swimlane and timeline layouts only, top to bottom
+	Groups []GroupLayout          `json:"groups,omitempty"` // Clustered layouts only, sorted by ID
+	Width  float64                `json:"width"`
+	Height float64                `json:"height"`
+
+	// Options are the options the layout was computed with, defaults
+	// applied; Update places new nodes with them
+	Options LayoutOptions `json:"options"`
+}
+
+// DefaultOptions returns the options used for unset LayoutOptions fields
+func DefaultOptions() LayoutOptions {
+	return LayoutOptions{
+		Type:         LayoutHierarchical,
+		NodeWidth:    160,
+		NodeHeight:   60,
+		NodeSpacing:  40,
+		LevelSpacing: 80,
+		Iterations:   300,
+		Tolerance:    0.5,
+		Theta:        0.9,
+	}
+}
+
+// ParseLayoutType returns the layout type with the given name
+func ParseLayoutType(name string) (LayoutType, error) {
+	for _, layoutType := range LayoutTypes {
+		if name == string(layoutType) {
+			return layoutType, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported layout type: %s", name)
+}
+
+// ComputeLayout positions the nodes of g. The result only depends on the
+// graph and the options, so repeated calls return the same layout. Whatever
+// the layout type, no two node boxes overlap except pinned ones.
+func ComputeLayout(g *graph.Graph, opts LayoutOptions) (*GraphLayout, error) {
+	opts = withDefaults(opts)
+	if opts.Type == LayoutRadial && opts.FocusNodeID != "" {
+		if _, exists := g.Nodes[opts.FocusNodeID]; !exists {
+			return nil, fmt.Errorf("focus node %s not found", opts.FocusNodeID)
+		}
+	}
+
+	gl := &GraphLayout{
+		Type:    opts.Type,
+		Nodes:   make(map[string]*NodeLayout, len(g.Nodes)),
+		Options: opts,
+	}
+	for id := range g.Nodes {
+		gl.Nodes[id] = &NodeLayout{ID: id, Width: opts.NodeWidth, Height: opts.NodeHeight}
+	}
+
+	switch opts.Type {
+	case LayoutHierarchical:
+		computeHierarchicalLayout(g, gl, opts)
+	case LayoutForce:
+		computeForceLayout(g, gl, opts)
+	case LayoutRadial:
+		computeRadialLayout(g, gl, opts)
+	case LayoutSwimlane:
+		computeSwimlaneLayout(g, gl, opts)
+	case LayoutTimeline:
+		computeTimelineLayout(g, gl, opts)
+	default:
+		return nil, fmt.Errorf("unsupported layout type: %s", opts.Type)
+	}
+
+	pinned := pins(g, opts)
+	if len(pinned) == 0 {
+		gl.removeOverlaps(g, nil, opts)
+		gl.normalize()
+		return gl, nil
+	}
+	if opts.Type != LayoutForce {
+		gl.normalize()
+	}
+	gl.pin(pinned, opts)
+	gl.removeOverlaps(g, pinned, opts)
+	gl.bound()
+	return gl, nil
+}
+
+func withDefaults(opts LayoutOptions) LayoutOptions {
+	defaults := DefaultOptions()
+	if opts.Type == "" {
+		opts.Type = defaults.Type
+	}
+	if opts.NodeWidth <= 0 {
+		opts.NodeWidth = defaults.NodeWidth
+	}
+	if opts.NodeHeight <= 0 {
+		opts.NodeHeight = defaults.NodeHeight
+	}
+	if opts.NodeSpacing <= 0 {
+		opts.NodeSpacing = defaults.NodeSpacing
+	}
+	if opts.LevelSpacing <= 0 {
+		opts.LevelSpacing = defaults.LevelSpacing
+	}
+	if opts.Iterations <= 0 {
+		opts.Iterations = defaults.Iterations
+	}
+	if opts.Tolerance <= 0 {
+		opts.Tolerance = defaults.Tolerance
+	}
+	if opts.Theta <= 0 {
+		opts.Theta = defaults.Theta
+	}
+	return opts
+}
+
+// normalize moves the layout so that the node boxes, lanes and groups start
+// at (0, 0) and sets Width and Height
+func (gl *GraphLayout) normalize() {
+	if len(gl.Nodes) == 0 {
+		gl.Width, gl.Height = 0, 0
+		return
+	}
+
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, node := range gl.Nodes {
+		minX = math.Min(minX, node.X-node.Width/2)
+		minY = math.Min(minY, node.Y-node.Height/2)
+		maxX = math.Max(maxX, node.X+node.Width/2)
+		maxY = math.Max(maxY, node.Y+node.Height/2)
+	}
+	for _, lane := range gl.Lanes {
+		minY = math.Min(minY, lane.Y)
+		maxY = math.Max(maxY, lane.Y+lane.Height)
+	}
+	for _, group := range gl.Groups {
+		minX = math.Min(minX, group.X)
+		minY = math.Min(minY, group.Y)
+		maxX = math.Max(maxX, group.X+group.Width)
+		maxY = math.Max(maxY, group.Y+group.Height)
+	}
+	for _, node := range gl.Nodes {
+		node.X -= minX
+		node.Y -= minY
+	}
+	for i := range gl.Lanes {
+		gl.Lanes[i].Y -= minY
+	}
+	for i := range gl.Groups {
+		gl.Groups[i].X -= minX
+		gl.Groups[i].Y -= minY
+	}
+	gl.Width = maxX - minX
+	gl.Height = maxY - minY
+}
+
+// sortedNodeIDs returns the node IDs of g in ascending order
+func sortedNodeIDs(g *graph.Graph) []string {
+	ids := make([]string, 0, len(g.Nodes))
+	for id := range g.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// successors maps each node to the nodes that run after it, sorted by ID.
+// Like graph.TopologicalSort, depends-on edges are reversed so that
+// dependencies come first.
+func successors(g *graph.Graph) map[string][]string {
+	next := make(map[string][]string, len(g.Nodes))
+	for _, edge := range g.Edges {
+		before, after := edge.FromNodeID, edge.ToNodeID
+		if edge.Type == graph.EdgeTypeDependsOn {
+			before, after = after, before
+		}
+		if _, ok := g.Nodes[before]; !ok {
+			continue
+		}
+		if _, ok := g.Nodes[after]; !ok || before == after {
+			continue
+		}
+		next[before] = append(next[before], after)
+	}
+	for id := range next {
+		sort.Strings(next[id])
+	}
+	return next
+}
@@ -0,0 +1,838 @@
+package layout
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createTestGraph builds spec <- workflow -> step1, step2 -> db, where the
+// workflow depends on the spec and contains both steps
+func createTestGraph(t *testing.T) *graph.Graph {
+	g := graph.NewGraph("layout-app")
+	require.NoError(t, g.AddNodes([]*graph.Node{
+		{ID: "spec", Type: graph.NodeTypeSpec, Name: "Spec"},
+		{ID: "workflow", Type: graph.NodeTypeWorkflow, Name: "Deploy"},
+		{ID: "step1", Type: graph.NodeTypeStep, Name: "Build"},
+		{ID: "step2", Type: graph.NodeTypeStep, Name: "Provision"},
+		{ID: "db", Type: graph.NodeTypeResource, Name: "Database"},
+	}))
+	require.NoError(t, g.AddEdges([]*graph.Edge{
+		{ID: "e1", FromNodeID: "workflow", ToNodeID: "spec", Type: graph.EdgeTypeDependsOn},
+		{ID: "e2", FromNodeID: "workflow", ToNodeID: "step1", Type: graph.EdgeTypeContains},
+		{ID: "e3", FromNodeID: "workflow", ToNodeID: "step2", Type: graph.EdgeTypeContains},
+		{ID: "e4", FromNodeID: "step2", ToNodeID: "db", Type: graph.EdgeTypeConfigures},
+	}))
+	return g
+}
+
+func TestComputeLayout_Hierarchical(t *testing.T) {
+	g := createTestGraph(t)
+
+	gl, err := ComputeLayout(g, LayoutOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, LayoutHierarchical, gl.Type)
+	require.Len(t, gl.Nodes, 5)
+
+	levels := map[string]int{"spec": 0, "workflow": 1, "step1": 2, "step2": 2, "db": 3}
+	for id, level := range levels {
+		assert.Equal(t, level, gl.Nodes[id].Level, id)
+	}
+
+	defaults := DefaultOptions()
+	assert.Equal(t, defaults.NodeHeight/2, gl.Nodes["spec"].Y)
+	assert.Less(t, gl.Nodes["workflow"].Y, gl.Nodes["step1"].Y)
+	assert.Equal(t, gl.Nodes["step1"].Y, gl.Nodes["step2"].Y)
+	assert.Less(t, gl.Nodes["step1"].X, gl.Nodes["step2"].X)
+	assert.Equal(t, gl.Nodes["spec"].X, gl.Nodes["workflow"].X, "single nodes are centered")
+	assert.Equal(t, 2*defaults.NodeWidth+defaults.NodeSpacing, gl.Width)
+	assert.Equal(t, 4*defaults.NodeHeight+3*defaults.LevelSpacing, gl.Height)
+}
+
+func TestComputeLayout_HierarchicalCycle(t *testing.T) {
+	g := graph.NewGraph("cycle")
+	require.NoError(t, g.AddNodes([]*graph.Node{
+		{ID: "a", Type: graph.NodeTypeWorkflow, Name: "A"},
+		{ID: "b", Type: graph.NodeTypeWorkflow, Name: "B"},
+		{ID: "c", Type: graph.NodeTypeWorkflow, Name: "C"},
+	}))
+	// AddEdges rejects cycles, but stored graphs may still contain them
+	for _, edge := range []*graph.Edge{
+		{ID: "e1", FromNodeID: "b", ToNodeID: "a", Type: graph.EdgeTypeDependsOn},
+		{ID: "e2", FromNodeID: "b", ToNodeID: "c", Type: graph.EdgeTypeDependsOn},
+		{ID: "e3", FromNodeID: "c", ToNodeID: "b", Type: graph.EdgeTypeDependsOn},
+	} {
+		g.Edges[edge.ID] = edge
+	}
+
+	gl, err := ComputeLayout(g, LayoutOptions{Type: LayoutHierarchical})
+	require.NoError(t, err)
+	assert.Equal(t, 0, gl.Nodes["a"].Level)
+	assert.Equal(t, 1, gl.Nodes["b"].Level)
+	assert.Equal(t, 1, gl.Nodes["c"].Level)
+}
+
+func TestComputeLayout_HierarchicalCrossings(t *testing.T) {
+	// In ID order a -> y and b -> x cross; the reordered bottom row does not
+	g := graph.NewGraph("crossing")
+	require.NoError(t, g.AddNodes([]*graph.Node{
+		{ID: "a", Type: graph.NodeTypeWorkflow, Name: "A"},
+		{ID: "b", Type: graph.NodeTypeWorkflow, Name: "B"},
+		{ID: "x", Type: graph.NodeTypeResource, Name: "X"},
+		{ID: "y", Type: graph.NodeTypeResource, Name: "Y"},
+	}))
+	require.NoError(t, g.AddEdges([]*graph.Edge{
+		{ID: "e1", FromNodeID: "a", ToNodeID: "y", Type: graph.EdgeTypeProvisions},
+		{ID: "e2", FromNodeID: "b", ToNodeID: "x", Type: graph.EdgeTypeProvisions},
+	}))
+
+	gl, err := ComputeLayout(g, LayoutOptions{})
+	require.NoError(t, err)
+	assert.Less(t, gl.Nodes["a"].X, gl.Nodes["b"].X)
+	assert.Less(t, gl.Nodes["y"].X, gl.Nodes["x"].X)
+	assert.Equal(t, gl.Nodes["a"].X, gl.Nodes["y"].X)
+}
+
+func TestComputeLayout_HierarchicalLongEdges(t *testing.T) {
+	// a -> c skips level 1, so a dummy node keeps room next to b
+	g := graph.NewGraph("long")
+	require.NoError(t, g.AddNodes([]*graph.Node{
+		{ID: "a", Type: graph.NodeTypeWorkflow, Name: "A"},
+		{ID: "b", Type: graph.NodeTypeWorkflow, Name: "B"},
+		{ID: "c", Type: graph.NodeTypeWorkflow, Name: "C"},
+	}))
+	require.NoError(t, g.AddEdges([]*graph.Edge{
+		{ID: "e1", FromNodeID: "b", ToNodeID: "a", Type: graph.EdgeTypeDependsOn},
+		{ID: "e2", FromNodeID: "c", ToNodeID: "b", Type: graph.EdgeTypeDependsOn},
+		{ID: "e3", FromNodeID: "c", ToNodeID: "a", Type: graph.EdgeTypeDependsOn},
+	}))
+
+	gl, err := ComputeLayout(g, LayoutOptions{})
+	require.NoError(t, err)
+	require.Len(t, gl.Nodes, 3)
+	assert.Equal(t, 2, gl.Nodes["c"].Level)
+
+	// a is centered over b and the dummy node, c under them
+	defaults := DefaultOptions()
+	assert.Equal(t, defaults.NodeSpacing/2, gl.Nodes["a"].X-gl.Nodes["b"].X, "b makes room for the long edge")
+	assert.Equal(t, gl.Nodes["a"].X, gl.Nodes["c"].X)
+	assertNoOverlaps(t, gl)
+}
+
+func TestLayeredGraph_MinimizeCrossings(t *testing.T) {
+	// Three rows of 20 nodes with pseudo-random edges between adjacent rows
+	g := graph.NewGraph("layers")
+	for row := 0; row < 3; row++ {
+		for i := 0; i < 20; i++ {
+			require.NoError(t, g.AddNode(&graph.Node{ID: fmt.Sprintf("r%d-%02d", row, i), Type: graph.NodeTypeStep, Name: "step"}))
+		}
+	}
+	for row := 0; row < 2; row++ {
+		for i := 0; i < 20; i++ {
+			for _, j := range []int{(i * 7) % 20, (i*13 + 5) % 20} {
+				require.NoError(t, g.AddEdge(&graph.Edge{
+					ID:         fmt.Sprintf("e%d-%02d-%02d", row, i, j),
+					FromNodeID: fmt.Sprintf("r%d-%02d", row+1, j),
+					ToNodeID:   fmt.Sprintf("r%d-%02d", row, i),
+					Type:       graph.EdgeTypeDependsOn,
+				}))
+			}
+		}
+	}
+
+	h := newLayeredGraph(g, assignLevels(g))
+	before := h.crossings()
+	h.minimizeCrossings()
+	after := h.crossings()
+	assert.Less(t, after, before/2, "crossings: %d before, %d after", before, after)
+}
+
+func TestCountInversions(t *testing.T) {
+	assert.Equal(t, 0, countInversions([][2]int{{0, 0}, {1, 1}, {1, 2}}, 3))
+	assert.Equal(t, 1, countInversions([][2]int{{0, 1}, {1, 0}}, 2))
+	assert.Equal(t, 3, countInversions([][2]int{{0, 2}, {1, 1}, {2, 0}}, 3))
+	assert.Equal(t, 0, countInversions([][2]int{{0, 1}, {1, 1}}, 2), "shared ends do not cross")
+}
+
+func TestComputeLayout_Clusters(t *testing.T) {
+	g := createTestGraph(t)
+
+	gl, err := ComputeLayout(g, LayoutOptions{Clusters: true})
+	require.NoError(t, err)
+	assertNoOverlaps(t, gl)
+
+	require.Len(t, gl.Groups, 1)
+	group := gl.Groups[0]
+	assert.Equal(t, "workflow", group.ID)
+	inside := func(id string) bool {
+		node := gl.Nodes[id]
+		return node.X-node.Width/2 >= group.X && node.X+node.Width/2 <= group.X+group.Width &&
+			node.Y-node.Height/2 >= group.Y && node.Y+node.Height/2 <= group.Y+group.Height
+	}
+	for _, id := range []string{"workflow", "step1", "step2"} {
+		assert.True(t, inside(id), "%s should be inside its workflow's group", id)
+	}
+	for _, id := range []string{"spec", "db"} {
+		assert.False(t, inside(id), "%s should be outside the group", id)
+	}
+
+	// The cluster is arranged like a node: after the spec, before the database
+	assert.Less(t, gl.Nodes["spec"].Y+gl.Nodes["spec"].Height/2, group.Y)
+	assert.Greater(t, gl.Nodes["db"].Y-gl.Nodes["db"].Height/2, group.Y+group.Height)
+	assert.Less(t, gl.Nodes["workflow"].Y, gl.Nodes["step1"].Y)
+	assert.Equal(t, gl.Nodes["workflow"].Level, gl.Nodes["step1"].Level)
+
+	assert.Zero(t, group.X)
+	assert.Equal(t, gl.Width, group.Width)
+
+	plain, err := ComputeLayout(g, LayoutOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, plain.Groups)
+}
+
+func TestComputeLayout_Radial(t *testing.T) {
+	g := createTestGraph(t)
+
+	gl, err := ComputeLayout(g, LayoutOptions{Type: LayoutRadial})
+	require.NoError(t, err)
+
+	center := gl.Nodes["spec"]
+	radius := func(id string) float64 {
+		return math.Hypot(gl.Nodes[id].X-center.X, gl.Nodes[id].Y-center.Y)
+	}
+	assert.Equal(t, 0, center.Level)
+	assert.InDelta(t, radius("step1"), radius("step2"), 1e-9)
+	assert.Less(t, radius("workflow"), radius("step1"))
+	assert.Less(t, radius("step2"), radius("db"))
+	assert.Equal(t, 3, gl.Nodes["db"].Level)
+}
+
+func TestComputeLayout_RadialFocus(t *testing.T) {
+	g := createTestGraph(t)
+	require.NoError(t, g.AddNode(&graph.Node{ID: "orphan", Type: graph.NodeTypeResource, Name: "Orphan"}))
+
+	gl, err := ComputeLayout(g, LayoutOptions{Type: LayoutRadial, FocusNodeID: "step2"})
+	require.NoError(t, err)
+	assertNoOverlaps(t, gl)
+
+	center := gl.Nodes["step2"]
+	radius := func(id string) float64 {
+		return math.Hypot(gl.Nodes[id].X-center.X, gl.Nodes[id].Y-center.Y)
+	}
+	levels := map[string]int{"step2": 0, "workflow": 1, "db": 1, "spec": 2, "step1": 2, "orphan": 3}
+	for id, level := range levels {
+		assert.Equal(t, level, gl.Nodes[id].Level, id)
+	}
+	assert.InDelta(t, radius("workflow"), radius("db"), 1e-9)
+	assert.InDelta(t, radius("spec"), radius("step1"), 1e-9)
+	assert.Less(t, radius("db"), radius("spec"))
+	assert.Less(t, radius("spec"), radius("orphan"))
+
+	_, err = ComputeLayout(g, LayoutOptions{Type: LayoutRadial, FocusNodeID: "missing"})
+	assert.Error(t, err)
+}
+
+func TestComputeLayout_Force(t *testing.T) {
+	g := createTestGraph(t)
+
+	gl, err := ComputeLayout(g, LayoutOptions{Type: LayoutForce})
+	require.NoError(t, err)
+	assertNoOverlaps(t, gl)
+
+	again, err := ComputeLayout(g, LayoutOptions{Type: LayoutForce})
+	require.NoError(t, err)
+	assert.Equal(t, gl, again, "layout should be deterministic")
+
+	// Connected nodes end up closer than the farthest pair
+	distance := func(a, b string) float64 {
+		return math.Hypot(gl.Nodes[a].X-gl.Nodes[b].X, gl.Nodes[a].Y-gl.Nodes[b].Y)
+	}
+	assert.Less(t, distance("step2", "db"), distance("spec", "db"))
+}
+
+func TestComputeLayout_ForceSeed(t *testing.T) {
+	g := createTestGraph(t)
+
+	seeded, err := ComputeLayout(g, LayoutOptions{Type: LayoutForce, Seed: 42})
+	require.NoError(t, err)
+	assertNoOverlaps(t, seeded)
+
+	again, err := ComputeLayout(g, LayoutOptions{Type: LayoutForce, Seed: 42})
+	require.NoError(t, err)
+	assert.Equal(t, seeded, again, "same seed should give the same layout")
+
+	other, err := ComputeLayout(g, LayoutOptions{Type: LayoutForce, Seed: 7})
+	require.NoError(t, err)
+	assert.NotEqual(t, seeded, other, "different seeds should give different layouts")
+
+	circle, err := ComputeLayout(g, LayoutOptions{Type: LayoutForce})
+	require.NoError(t, err)
+	assert.NotEqual(t, seeded, circle)
+}
+
+func TestComputeLayout_ForceConvergence(t *testing.T) {
+	g := createTestGraph(t)
+	layoutFor := func(opts LayoutOptions) (*GraphLayout, int) {
+		opts = withDefaults(opts)
+		gl := &GraphLayout{Nodes: make(map[string]*NodeLayout)}
+		for id := range g.Nodes {
+			gl.Nodes[id] = &NodeLayout{ID: id}
+		}
+		return gl, simulateForces(g, gl, opts)
+	}
+
+	// The simulation settles long before the iteration limit
+	converged, iterations := layoutFor(LayoutOptions{Type: LayoutForce, Iterations: 10000})
+	assert.Less(t, iterations, 1000)
+	capped, _ := layoutFor(LayoutOptions{Type: LayoutForce, Iterations: 100000})
+	assert.Equal(t, converged, capped)
+
+	// A tighter tolerance takes more iterations, the limit still applies
+	_, tight := layoutFor(LayoutOptions{Type: LayoutForce, Iterations: 10000, Tolerance: 0.001})
+	assert.Greater(t, tight, iterations)
+	_, limited := layoutFor(LayoutOptions{Type: LayoutForce, Iterations: 10})
+	assert.Equal(t, 10, limited)
+}
+
+func TestComputeLayout_Swimlane(t *testing.T) {
+	g := createTestGraph(t)
+
+	gl, err := ComputeLayout(g, LayoutOptions{Type: LayoutSwimlane})
+	require.NoError(t, err)
+	assertNoOverlaps(t, gl)
+
+	var names []string
+	for _, lane := range gl.Lanes {
+		names = append(names, lane.Name)
+	}
+	assert.Equal(t, []string{"spec", "workflow", "step", "resource"}, names)
+	assert.Zero(t, gl.Lanes[0].Y)
+	assert.Equal(t, gl.Height, gl.Lanes[3].Y+gl.Lanes[3].Height)
+
+	// Every node lies within its lane; columns follow execution order
+	lanes := map[string]int{"spec": 0, "workflow": 1, "step1": 2, "step2": 2, "db": 3}
+	for id, lane := range lanes {
+		node := gl.Nodes[id]
+		assert.Greater(t, node.Y-node.Height/2, gl.Lanes[lane].Y, id)
+		assert.Less(t, node.Y+node.Height/2, gl.Lanes[lane].Y+gl.Lanes[lane].Height, id)
+	}
+	assert.Less(t, gl.Nodes["spec"].X, gl.Nodes["workflow"].X)
+	assert.Less(t, gl.Nodes["workflow"].X, gl.Nodes["step2"].X)
+	assert.Less(t, gl.Nodes["step2"].X, gl.Nodes["db"].X)
+
+	// Steps in the same column are stacked
+	assert.Equal(t, gl.Nodes["step1"].X, gl.Nodes["step2"].X)
+	assert.Less(t, gl.Nodes["step1"].Y, gl.Nodes["step2"].Y)
+}
+
+func TestComputeLayout_SwimlaneByProperty(t *testing.T) {
+	g := createTestGraph(t)
+	g.Nodes["db"].Properties = map[string]interface{}{"team": "platform"}
+	g.Nodes["step1"].Properties = map[string]interface{}{"team": "app"}
+	g.Nodes["step2"].Properties = map[string]interface{}{"team": "platform"}
+
+	gl, err := ComputeLayout(g, LayoutOptions{Type: LayoutSwimlane, LaneProperty: "team"})
+	require.NoError(t, err)
+	assertNoOverlaps(t, gl)
+
+	require.Len(t, gl.Lanes, 3)
+	assert.Equal(t, "app", gl.Lanes[0].Name)
+	assert.Equal(t, "platform", gl.Lanes[1].Name)
+	assert.Equal(t, "other", gl.Lanes[2].Name)
+	assert.Less(t, gl.Nodes["step1"].Y, gl.Lanes[1].Y)
+	assert.Greater(t, gl.Nodes["spec"].Y, gl.Lanes[2].Y)
+	assert.Equal(t, gl.Nodes["step2"].Y, gl.Nodes["db"].Y, "different columns of one lane share a row")
+}
+
+func TestComputeLayout_Timeline(t *testing.T) {
+	g := createTestGraph(t)
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	at := func(seconds int) *time.Time {
+		ts := start.Add(time.Duration(seconds) * time.Second)
+		return &ts
+	}
+	g.Nodes["spec"].StartedAt, g.Nodes["spec"].CompletedAt = at(0), at(0)
+	g.Nodes["workflow"].StartedAt, g.Nodes["workflow"].CompletedAt = at(10), at(100)
+	g.Nodes["step1"].StartedAt, g.Nodes["step1"].Duration = at(10), 40*time.Second
+	g.Nodes["step2"].StartedAt = at(30) // Still running
+
+	gl, err := ComputeLayout(g, LayoutOptions{Type: LayoutTimeline, TimeScale: 10})
+	require.NoError(t, err)
+	assertNoOverlaps(t, gl)
+
+	require.Len(t, gl.Lanes, 2)
+	assert.Equal(t, "other", gl.Lanes[0].Name)
+	assert.Equal(t, "Deploy", gl.Lanes[1].Name)
+
+	left := func(id string) float64 { return gl.Nodes[id].X - gl.Nodes[id].Width/2 }
+	assert.InDelta(t, 0, left("spec"), 1e-9)
+	assert.InDelta(t, 100, left("workflow"), 1e-9)
+	assert.InDelta(t, 900, gl.Nodes["workflow"].Width, 1e-9)
+	assert.InDelta(t, 400, gl.Nodes["step1"].Width, 1e-9)
+	assert.InDelta(t, 300, left("step2"), 1e-9)
+	assert.InDelta(t, 700, gl.Nodes["step2"].Width, 1e-9, "running nodes end at the latest recorded time")
+	assert.InDelta(t, gl.Nodes["spec"].Height, gl.Nodes["spec"].Width, 1e-9, "instant nodes keep a minimum width")
+
+	// The database has not started and follows the end of the run
+	assert.Greater(t, left("db"), 1000.0)
+	assert.Equal(t, gl.Nodes["spec"].Y, gl.Nodes["db"].Y)
+
+	// Overlapping nodes of the workflow lane are stacked
+	ys := map[float64]bool{}
+	for _, id := range []string{"workflow", "step1", "step2"} {
+		ys[gl.Nodes[id].Y] = true
+		assert.Equal(t, 1, gl.Nodes[id].Level)
+	}
+	assert.Len(t, ys, 3)
+
+	// By default the run is scaled to one node width per started node
+	fitted, err := ComputeLayout(g, LayoutOptions{Type: LayoutTimeline})
+	require.NoError(t, err)
+	assert.InDelta(t, 4*160, fitted.Nodes["step2"].X+fitted.Nodes["step2"].Width/2, 1e-9)
+}
+
+func TestUpdate(t *testing.T) {
+	for _, layoutType := range []LayoutType{LayoutHierarchical, LayoutForce, LayoutRadial} {
+		t.Run(string(layoutType), func(t *testing.T) {
+			g := createTestGraph(t)
+			existing, err := ComputeLayout(g, LayoutOptions{Type: layoutType})
+			require.NoError(t, err)
+			before := make(map[string]NodeLayout)
+			for id, node := range existing.Nodes {
+				before[id] = *node
+			}
+
+			require.NoError(t, g.AddNode(&graph.Node{ID: "cache", Type: graph.NodeTypeResource, Name: "Cache"}))
+			require.NoError(t, g.AddEdge(&graph.Edge{ID: "e5", FromNodeID: "step1", ToNodeID: "cache", Type: graph.EdgeTypeConfigures}))
+			require.NoError(t, g.RemoveNode("db"))
+
+			gl, err := Update(existing, g, nil)
+			require.NoError(t, err)
+			assertNoOverlaps(t, gl)
+
+			// Known nodes stay put, removed ones are dropped
+			require.Len(t, gl.Nodes, 5)
+			assert.NotContains(t, gl.Nodes, "db")
+			for id, node := range gl.Nodes {
+				if id != "cache" {
+					assert.Equal(t, before[id], *node, id)
+				}
+			}
+			for id, node := range existing.Nodes {
+				assert.Equal(t, before[id], *node, "existing layout was modified")
+			}
+
+			// The new node is placed next to its neighbour within the bounds
+			cache, step := gl.Nodes["cache"], gl.Nodes["step1"]
+			assert.GreaterOrEqual(t, cache.X-cache.Width/2, 0.0)
+			assert.GreaterOrEqual(t, cache.Y-cache.Height/2, 0.0)
+			assert.LessOrEqual(t, cache.X+cache.Width/2, gl.Width)
+			assert.LessOrEqual(t, cache.Y+cache.Height/2, gl.Height)
+			assert.Less(t, math.Hypot(cache.X-step.X, cache.Y-step.Y), 2*(step.Width+gl.Options.LevelSpacing))
+			if layoutType == LayoutHierarchical {
+				assert.Equal(t, 3, cache.Level)
+				assert.Greater(t, cache.Y, step.Y)
+			}
+
+			// Changed nodes are placed again
+			moved, err := Update(gl, g, []string{"spec"})
+			require.NoError(t, err)
+			assertNoOverlaps(t, moved)
+			assert.Equal(t, *gl.Nodes["workflow"], *moved.Nodes["workflow"])
+		})
+	}
+}
+
+func TestUpdate_Recompute(t *testing.T) {
+	g := createTestGraph(t)
+	existing, err := ComputeLayout(g, LayoutOptions{Type: LayoutSwimlane, NodeWidth: 100})
+	require.NoError(t, err)
+
+	require.NoError(t, g.AddNode(&graph.Node{ID: "cache", Type: graph.NodeTypeResource, Name: "Cache"}))
+	expected, err := ComputeLayout(g, LayoutOptions{Type: LayoutSwimlane, NodeWidth: 100})
+	require.NoError(t, err)
+	gl, err := Update(existing, g, nil)
+	require.NoError(t, err)
+	assert.Equal(t, expected, gl, "swimlane layouts are recomputed with the same options")
+
+	// Nothing to keep
+	hierarchical, err := ComputeLayout(g, LayoutOptions{})
+	require.NoError(t, err)
+	gl, err = Update(&GraphLayout{Type: LayoutHierarchical}, g, nil)
+	require.NoError(t, err)
+	assert.Equal(t, hierarchical, gl)
+}
+
+func TestComputeLayout_Pinned(t *testing.T) {
+	g := createTestGraph(t)
+	pinned := map[string]Position{
+		"db":   {X: 500, Y: 100},
+		"spec": {X: 100, Y: 400},
+	}
+
+	for _, layoutType := range LayoutTypes {
+		t.Run(string(layoutType), func(t *testing.T) {
+			gl, err := ComputeLayout(g, LayoutOptions{Type: layoutType, Pinned: pinned})
+			require.NoError(t, err)
+			for id, position := range pinned {
+				assert.Equal(t, position.X, gl.Nodes[id].X, id)
+				assert.Equal(t, position.Y, gl.Nodes[id].Y, id)
+			}
+			for id, node := range gl.Nodes {
+				assert.GreaterOrEqual(t, node.X-node.Width/2, -1e-9, id)
+				assert.GreaterOrEqual(t, node.Y-node.Height/2, -1e-9, id)
+				assert.LessOrEqual(t, node.X+node.Width/2, gl.Width+1e-9, id)
+				assert.LessOrEqual(t, node.Y+node.Height/2, gl.Height+1e-9, id)
+			}
+			assertNoOverlaps(t, gl)
+
+			again, err := ComputeLayout(g, LayoutOptions{Type: layoutType, Pinned: pinned})
+			require.NoError(t, err)
+			assert.Equal(t, gl, again)
+		})
+	}
+
+	// Unpinned nodes of a hierarchical layout stay on their rows
+	free, err := ComputeLayout(g, LayoutOptions{})
+	require.NoError(t, err)
+	gl, err := ComputeLayout(g, LayoutOptions{Pinned: map[string]Position{"step1": {X: free.Nodes["step2"].X, Y: free.Nodes["step2"].Y}}})
+	require.NoError(t, err)
+	assertNoOverlaps(t, gl)
+	assert.Equal(t, free.Nodes["step2"].Y, gl.Nodes["step2"].Y)
+	assert.NotEqual(t, free.Nodes["step2"].X, gl.Nodes["step2"].X)
+
+	// Pins of unknown nodes are ignored
+	unknown, err := ComputeLayout(g, LayoutOptions{Pinned: map[string]Position{"missing": {X: -100}}})
+	require.NoError(t, err)
+	free.Options.Pinned = unknown.Options.Pinned
+	assert.Equal(t, free, unknown)
+	// Updates place new pinned nodes at their positions
+	require.NoError(t, g.AddNode(&graph.Node{ID: "cache", Type: graph.NodeTypeResource, Name: "Cache"}))
+	unknown.Options.Pinned = map[string]Position{"cache": {X: 900, Y: 30}}
+	updated, err := Update(unknown, g, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 900.0, updated.Nodes["cache"].X)
+	assert.Equal(t, 30.0, updated.Nodes["cache"].Y)
+}
+
+func TestComputeLayout_MinNodeDistance(t *testing.T) {
+	g := createTestGraph(t)
+
+	for _, opts := range []LayoutOptions{
+		{Type: LayoutHierarchical},
+		{Type: LayoutHierarchical, Clusters: true},
+		{Type: LayoutForce},
+		{Type: LayoutRadial},
+		{Type: LayoutSwimlane},
+		{Type: LayoutTimeline},
+	} {
+		opts.MinNodeDistance = 120
+		t.Run(fmt.Sprintf("%s clusters=%v", opts.Type, opts.Clusters), func(t *testing.T) {
+			gl, err := ComputeLayout(g, opts)
+			require.NoError(t, err)
+			assertNodeDistance(t, gl, opts.MinNodeDistance)
+
+			plain, err := ComputeLayout(g, LayoutOptions{Type: opts.Type, Clusters: opts.Clusters})
+			require.NoError(t, err)
+			if opts.Type != LayoutForce && opts.Type != LayoutRadial {
+				for id, node := range gl.Nodes {
+					assert.Equal(t, plain.Nodes[id].Y, node.Y, "%s keeps its row", id)
+				}
+			}
+			for _, group := range gl.Groups {
+				for _, id := range []string{"workflow", "step1", "step2"} {
+					node := gl.Nodes[id]
+					assert.LessOrEqual(t, group.X, node.X-node.Width/2, id)
+					assert.GreaterOrEqual(t, group.X+group.Width, node.X+node.Width/2, id)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoveOverlaps(t *testing.T) {
+	g := createTestGraph(t)
+	opts := withDefaults(LayoutOptions{Type: LayoutForce, MinNodeDistance: 10})
+	gl := &GraphLayout{Nodes: make(map[string]*NodeLayout)}
+	for _, id := range sortedNodeIDs(g) {
+		gl.Nodes[id] = &NodeLayout{ID: id, X: 100, Y: 50, Width: opts.NodeWidth, Height: opts.NodeHeight}
+	}
+
+	// All nodes on the same spot spread out around the pinned one
+	pinned := map[string]Position{"db": {X: 100, Y: 50}}
+	gl.removeOverlaps(g, pinned, opts)
+	assertNodeDistance(t, gl, opts.MinNodeDistance)
+	assert.Equal(t, 100.0, gl.Nodes["db"].X)
+	assert.Equal(t, 50.0, gl.Nodes["db"].Y)
+	for id, node := range gl.Nodes {
+		assert.GreaterOrEqual(t, node.X-node.Width/2, 0.0, id)
+		assert.GreaterOrEqual(t, node.Y-node.Height/2, 0.0, id)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	g := graph.NewGraph("crossing")
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		require.NoError(t, g.AddNode(&graph.Node{ID: id, Type: graph.NodeTypeStep, Name: id}))
+	}
+	for _, edge := range [][2]string{{"a", "d"}, {"b", "c"}, {"a", "b"}, {"d", "d"}, {"c", "e"}} {
+		// Added directly, as the graph rejects self loops
+		g.Edges[edge[0]+edge[1]] = &graph.Edge{ID: edge[0] + edge[1], FromNodeID: edge[0], ToNodeID: edge[1], Type: graph.EdgeTypeDependsOn}
+	}
+
+	box := func(id string, x, y float64) *NodeLayout {
+		return &NodeLayout{ID: id, X: x, Y: y, Width: 40, Height: 20}
+	}
+	gl := &GraphLayout{
+		Nodes: map[string]*NodeLayout{
+			"a": box("a", 20, 10), "b": box("b", 320, 10),
+			"c": box("c", 20, 310), "d": box("d", 320, 310),
+			"e": box("e", 50, 320), // Overlaps c
+		},
+		Width:  340,
+		Height: 330,
+	}
+
+	metrics := Evaluate(gl, g)
+	assert.Equal(t, 1, metrics.EdgeCrossings, "a-d crosses b-c, a-b only touches them")
+	assert.InDelta(t, 2*math.Hypot(300, 300)+300+math.Hypot(30, 10), metrics.EdgeLength, 1e-9)
+	assert.Equal(t, 1, metrics.Overlaps)
+	assert.InDelta(t, 340.0/330, metrics.AspectRatio, 1e-9)
+
+	// Computed layouts do not overlap
+	computed, err := ComputeLayout(createTestGraph(t), LayoutOptions{})
+	require.NoError(t, err)
+	metrics = Evaluate(computed, createTestGraph(t))
+	assert.Zero(t, metrics.Overlaps)
+	assert.Zero(t, metrics.EdgeCrossings)
+	assert.Positive(t, metrics.EdgeLength)
+
+	assert.Equal(t, Metrics{}, Evaluate(&GraphLayout{Nodes: map[string]*NodeLayout{}}, graph.NewGraph("empty")))
+}
+
+func TestLayoutCache(t *testing.T) {
+	cache := NewLayoutCache(2)
+	g := createTestGraph(t)
+
+	first, err := cache.ComputeLayout(g, LayoutOptions{})
+	require.NoError(t, err)
+	expected, err := ComputeLayout(g, LayoutOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, expected, first)
+
+	// State changes keep the structure; callers get their own copy
+	g.Nodes["db"].State = graph.NodeStateRunning
+	first.Nodes["db"].X = -1
+	second, err := cache.ComputeLayout(g, LayoutOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, expected, second)
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 1, Entries: 1}, cache.Stats())
+
+	// New edges and other options are laid out again
+	require.NoError(t, g.AddEdge(&graph.Edge{ID: "e5", FromNodeID: "step1", ToNodeID: "db", Type: graph.EdgeTypeConfigures}))
+	_, err = cache.ComputeLayout(g, LayoutOptions{})
+	require.NoError(t, err)
+	_, err = cache.ComputeLayout(g, LayoutOptions{Type: LayoutRadial})
+	require.NoError(t, err)
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 3, Entries: 2}, cache.Stats())
+
+	// Zero options and explicit defaults share an entry
+	_, err = cache.ComputeLayout(g, DefaultOptions())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), cache.Stats().Hits)
+
+	var disabled *LayoutCache
+	gl, err := disabled.ComputeLayout(g, LayoutOptions{Type: "spiral"})
+	assert.Error(t, err)
+	assert.Nil(t, gl)
+}
+
+func TestContentHash(t *testing.T) {
+	hash := func(g *graph.Graph, opts LayoutOptions) string {
+		key, err := ContentHash(g, opts)
+		require.NoError(t, err)
+		return key
+	}
+	g := createTestGraph(t)
+	base := hash(g, LayoutOptions{})
+	assert.Equal(t, base, hash(createTestGraph(t), LayoutOptions{}))
+
+	g.Nodes["db"].Description = "changed"
+	g.Nodes["db"].Properties = map[string]interface{}{"team": "platform"}
+	assert.Equal(t, base, hash(g, LayoutOptions{}))
+	assert.NotEqual(t, hash(g, LayoutOptions{Type: LayoutSwimlane}), hash(g, LayoutOptions{Type: LayoutSwimlane, LaneProperty: "team"}))
+
+	started := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	timeline := hash(g, LayoutOptions{Type: LayoutTimeline})
+	g.Nodes["db"].StartedAt = &started
+	assert.NotEqual(t, timeline, hash(g, LayoutOptions{Type: LayoutTimeline}))
+	assert.Equal(t, base, hash(g, LayoutOptions{}))
+
+	g.Nodes["db"].Type = graph.NodeTypeStep
+	assert.NotEqual(t, base, hash(g, LayoutOptions{}))
+}
+
+func TestComputeLayout_Bounds(t *testing.T) {
+	g := graph.NewGraph("large")
+	for i := 0; i < 30; i++ {
+		require.NoError(t, g.AddNode(&graph.Node{ID: fmt.Sprintf("n%02d", i), Type: graph.NodeTypeStep, Name: "step"}))
+	}
+	for i := 1; i < 30; i++ {
+		require.NoError(t, g.AddEdge(&graph.Edge{
+			ID:         fmt.Sprintf("e%02d", i),
+			FromNodeID: fmt.Sprintf("n%02d", i),
+			ToNodeID:   fmt.Sprintf("n%02d", i/3),
+			Type:       graph.EdgeTypeDependsOn,
+		}))
+	}
+
+	for _, layoutType := range LayoutTypes {
+		t.Run(string(layoutType), func(t *testing.T) {
+			gl, err := ComputeLayout(g, LayoutOptions{Type: layoutType})
+			require.NoError(t, err)
+			require.Len(t, gl.Nodes, 30)
+			for id, node := range gl.Nodes {
+				assert.GreaterOrEqual(t, node.X-node.Width/2, -1e-9, id)
+				assert.GreaterOrEqual(t, node.Y-node.Height/2, -1e-9, id)
+				assert.LessOrEqual(t, node.X+node.Width/2, gl.Width+1e-9, id)
+				assert.LessOrEqual(t, node.Y+node.Height/2, gl.Height+1e-9, id)
+			}
+			assertNoOverlaps(t, gl)
+		})
+	}
+}
+
+func TestComputeLayout_Errors(t *testing.T) {
+	_, err := ComputeLayout(graph.NewGraph("empty"), LayoutOptions{Type: "spiral"})
+	assert.Error(t, err)
+
+	gl, err := ComputeLayout(graph.NewGraph("empty"), LayoutOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, gl.Nodes)
+	assert.Zero(t, gl.Width)
+
+	layoutType, err := ParseLayoutType("radial")
+	require.NoError(t, err)
+	assert.Equal(t, LayoutRadial, layoutType)
+	_, err = ParseLayoutType("spiral")
+	assert.Error(t, err)
+}
+
+func assertNoOverlaps(t *testing.T, gl *GraphLayout) {
+	t.Helper()
+	assertNodeDistance(t, gl, 0)
+}
+
+// assertNodeDistance checks that all node boxes are at least distance apart
+func assertNodeDistance(t *testing.T, gl *GraphLayout, distance float64) {
+	t.Helper()
+	for _, a := range gl.Nodes {
+		for _, b := range gl.Nodes {
+			if a.ID >= b.ID {
+				continue
+			}
+			overlapX := math.Abs(a.X-b.X) < (a.Width+b.Width)/2+distance-1e-6
+			overlapY := math.Abs(a.Y-b.Y) < (a.Height+b.Height)/2+distance-1e-6
+			assert.False(t, overlapX && overlapY, "nodes %s and %s are closer than %v", a.ID, b.ID, distance)
+		}
+	}
+}
+
+// buildTreeGraph builds n nodes where every node depends on the node at a
+// third of its index, as a stand-in for large generated graphs
+func buildTreeGraph(tb testing.TB, n int) *graph.Graph {
+	g := graph.NewGraph("tree")
+	nodes := make([]*graph.Node, n)
+	for i := range nodes {
+		nodes[i] = &graph.Node{ID: fmt.Sprintf("n%05d", i), Type: graph.NodeTypeStep, Name: "step"}
+	}
+	edges := make([]*graph.Edge, 0, n)
+	for i := 1; i < n; i++ {
+		edges = append(edges, &graph.Edge{
+			ID:         fmt.Sprintf("e%05d", i),
+			FromNodeID: fmt.Sprintf("n%05d", i),
+			ToNodeID:   fmt.Sprintf("n%05d", i/3),
+			Type:       graph.EdgeTypeDependsOn,
+		})
+	}
+	require.NoError(tb, g.AddNodes(nodes))
+	require.NoError(tb, g.AddEdges(edges))
+	return g
+}
+
+func TestQuadtree_Repulsion(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	n := 500
+	x := make([]float64, n)
+	y := make([]float64, n)
+	for i := range x {
+		x[i] = 1000 * random.Float64()
+		y[i] = 1000 * random.Float64()
+	}
+	// Coincident nodes share a leaf
+	x[1], y[1] = x[0], y[0]
+
+	k := 100.0
+	exactX := make([]float64, n)
+	exactY := make([]float64, n)
+	repulseAll(x, y, exactX, exactY, k)
+
+	tree := newQuadtree(x, y)
+	var stack []int
+	var relativeError float64
+	for i := range x {
+		var fx, fy float64
+		fx, fy, stack = tree.repulsion(i, k, 1e-9, stack)
+		assert.InDelta(t, exactX[i], fx, 1e-6*math.Abs(exactX[i])+1e-6)
+		assert.InDelta(t, exactY[i], fy, 1e-6*math.Abs(exactY[i])+1e-6)
+
+		fx, fy, stack = tree.repulsion(i, k, 0.9, stack)
+		relativeError += math.Hypot(fx-exactX[i], fy-exactY[i]) / math.Hypot(exactX[i], exactY[i])
+	}
+	assert.Less(t, relativeError/float64(n), 0.05, "mean relative error with theta 0.9")
+}
+
+func TestComputeLayout_ForceBarnesHut(t *testing.T) {
+	g := buildTreeGraph(t, 500)
+
+	gl, err := ComputeLayout(g, LayoutOptions{Type: LayoutForce})
+	require.NoError(t, err)
+	require.Len(t, gl.Nodes, 500)
+	for id, node := range gl.Nodes {
+		require.False(t, math.IsNaN(node.X) || math.IsNaN(node.Y), id)
+	}
+	assertNoOverlaps(t, gl)
+
+	again, err := ComputeLayout(g, LayoutOptions{Type: LayoutForce})
+	require.NoError(t, err)
+	assert.Equal(t, gl, again, "layout should be deterministic")
+
+	// Children stay closer to their parent than to the far end of the tree
+	distance := func(a, b string) float64 {
+		return math.Hypot(gl.Nodes[a].X-gl.Nodes[b].X, gl.Nodes[a].Y-gl.Nodes[b].Y)
+	}
+	assert.Less(t, distance("n00450", "n00150"), distance("n00450", "n00001"))
+}
+
+func benchmarkForceLayout(b *testing.B, n int) {
+	g := buildTreeGraph(b, n)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = ComputeLayout(g, LayoutOptions{Type: LayoutForce})
+	}
+}
+
+func BenchmarkComputeLayout_Force1kNodes(b *testing.B) {
+	benchmarkForceLayout(b, 1000)
+}
+
+func BenchmarkComputeLayout_Force10kNodes(b *testing.B) {
+	benchmarkForceLayout(b, 10000)
+}
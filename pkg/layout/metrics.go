@@ -0,0 +1,102 @@
+package layout
+
+import (
+	"math"
+	"sort"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// Metrics rates how readable a layout is, to compare layout types on a
+// graph. Lower crossings, edge length and overlaps are better; an aspect
+// ratio close to that of the viewport fits it best.
+type Metrics struct {
+	EdgeCrossings int     `json:"edge_crossings"` // Pairs of edges crossing each other, drawn as straight lines between node centers
+	EdgeLength    float64 `json:"edge_length"`    // Total length of all edges between node centers
+	Overlaps      int     `json:"overlaps"`       // Pairs of overlapping node boxes
+	AspectRatio   float64 `json:"aspect_ratio"`   // Width divided by height; 0 for empty layouts
+}
+
+// segment is an edge drawn between the centers of its nodes
+type segment struct {
+	from, to       string
+	x1, y1, x2, y2 float64
+}
+
+// Evaluate computes the metrics of gl, a layout of g. Edges to nodes the
+// layout does not contain and self loops are left out.
+func Evaluate(gl *GraphLayout, g *graph.Graph) Metrics {
+	var metrics Metrics
+	if gl.Height > 0 {
+		metrics.AspectRatio = gl.Width / gl.Height
+	}
+
+	edgeIDs := make([]string, 0, len(g.Edges))
+	for id := range g.Edges {
+		edgeIDs = append(edgeIDs, id)
+	}
+	sort.Strings(edgeIDs)
+
+	segments := make([]segment, 0, len(edgeIDs))
+	for _, id := range edgeIDs {
+		edge := g.Edges[id]
+		from, fromExists := gl.Nodes[edge.FromNodeID]
+		to, toExists := gl.Nodes[edge.ToNodeID]
+		if !fromExists || !toExists || from == to {
+			continue
+		}
+		segments = append(segments, segment{from: from.ID, to: to.ID, x1: from.X, y1: from.Y, x2: to.X, y2: to.Y})
+		metrics.EdgeLength += math.Hypot(to.X-from.X, to.Y-from.Y)
+	}
+
+	for i, a := range segments {
+		for _, b := range segments[i+1:] {
+			if a.from == b.from || a.from == b.to || a.to == b.from || a.to == b.to {
+				continue // Edges meeting at a node do not cross
+			}
+			if a.crosses(b) {
+				metrics.EdgeCrossings++
+			}
+		}
+	}
+
+	nodes := make([]*NodeLayout, 0, len(gl.Nodes))
+	for _, node := range gl.Nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].X-nodes[i].Width/2 < nodes[j].X-nodes[j].Width/2 })
+	for i, a := range nodes {
+		for _, b := range nodes[i+1:] {
+			if b.X-b.Width/2 >= a.X+a.Width/2 {
+				break
+			}
+			if math.Abs(a.Y-b.Y) < (a.Height+b.Height)/2 {
+				metrics.Overlaps++
+			}
+		}
+	}
+	return metrics
+}
+
+// crosses reports whether s and other intersect in a single point inside
+// both segments; touching or collinear segments do not cross
+func (s segment) crosses(other segment) bool {
+	d1 := orientation(other.x1, other.y1, other.x2, other.y2, s.x1, s.y1)
+	d2 := orientation(other.x1, other.y1, other.x2, other.y2, s.x2, s.y2)
+	d3 := orientation(s.x1, s.y1, s.x2, s.y2, other.x1, other.y1)
+	d4 := orientation(s.x1, s.y1, s.x2, s.y2, other.x2, other.y2)
+	return d1*d2 < 0 && d3*d4 < 0
+}
+
+// orientation is the sign of the cross product of (x2-x1, y2-y1) and
+// (x-x1, y-y1): positive if (x, y) is left of the line, negative if right
+func orientation(x1, y1, x2, y2, x, y float64) float64 {
+	cross := (x2-x1)*(y-y1) - (y2-y1)*(x-x1)
+	switch {
+	case cross > 0:
+		return 1
+	case cross < 0:
+		return -1
+	}
+	return 0
+}
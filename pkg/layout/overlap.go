@@ -0,0 +1,155 @@
+package layout
+
+import (
+	"math"
+	"sort"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// overlapIterations bounds the push-apart sweeps of removeOverlaps before
+// the remaining overlapping nodes are moved to the right of the layout
+const overlapIterations = 100
+
+// overlapEpsilon keeps boxes that only touch after a push from counting as
+// overlapping due to rounding
+const overlapEpsilon = 1e-9
+
+// removeOverlaps pushes apart node boxes that are less than MinNodeDistance
+// apart, so that no two nodes overlap whatever the layout produced. Each
+// sweep moves both nodes of an overlapping pair half the overlap apart along
+// the axis with the smaller overlap; layouts arranged in rows or lanes only
+// move nodes along X, so they stay on their level or lane. Pinned nodes
+// never move and pinned layouts are not normalized afterwards, so there
+// nodes are not pushed past 0. Nodes still overlapping after
+// overlapIterations sweeps go to the right of the layout. Group boxes grow
+// to cover their moved members.
+func (gl *GraphLayout) removeOverlaps(g *graph.Graph, pinned map[string]Position, opts LayoutOptions) {
+	if len(gl.Nodes) < 2 {
+		return
+	}
+	distance := opts.MinNodeDistance
+	horizontal := opts.Type != LayoutForce && opts.Type != LayoutRadial
+
+	nodes := make([]*NodeLayout, 0, len(gl.Nodes))
+	for _, node := range gl.Nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+
+	// move shifts node by delta along X or Y and returns the part of delta
+	// it could not take
+	move := func(node *NodeLayout, delta float64, alongX bool) float64 {
+		if _, fixed := pinned[node.ID]; fixed {
+			return delta
+		}
+		position, half := &node.Y, node.Height/2
+		if alongX {
+			position, half = &node.X, node.Width/2
+		}
+		target := *position + delta
+		if len(pinned) > 0 && target < half {
+			target = math.Min(half, *position)
+		}
+		rest := *position + delta - target
+		*position = target
+		return rest
+	}
+
+	for iteration := 0; iteration < overlapIterations; iteration++ {
+		// Sweep the nodes from left to right, comparing each node only with
+		// the nodes starting before it ends
+		sort.SliceStable(nodes, func(i, j int) bool {
+			return nodes[i].X-nodes[i].Width/2 < nodes[j].X-nodes[j].Width/2
+		})
+		moved := false
+		for i, a := range nodes {
+			for _, b := range nodes[i+1:] {
+				if b.X-b.Width/2 >= a.X+a.Width/2+distance {
+					break
+				}
+				overlapX := (a.Width+b.Width)/2 + distance - math.Abs(b.X-a.X)
+				overlapY := (a.Height+b.Height)/2 + distance - math.Abs(b.Y-a.Y)
+				if overlapX <= overlapEpsilon || overlapY <= overlapEpsilon {
+					continue
+				}
+				_, aPinned := pinned[a.ID]
+				_, bPinned := pinned[b.ID]
+				if aPinned && bPinned {
+					continue
+				}
+
+				alongX := horizontal || overlapX <= overlapY
+				overlap, direction := overlapY, 1.0
+				if alongX {
+					overlap = overlapX
+				}
+				if (alongX && b.X < a.X) || (!alongX && b.Y < a.Y) {
+					direction = -1
+				}
+
+				// The pinned or blocked node's share goes to the other node
+				share := overlap / 2
+				if aPinned || bPinned {
+					share = 0
+				}
+				if bPinned {
+					share = overlap
+				}
+				rest := move(a, -direction*share, alongX)
+				rest = move(b, direction*(overlap-share)-rest, alongX)
+				move(a, -rest, alongX)
+				moved = true
+			}
+		}
+		if !moved {
+			gl.growGroups(g, opts)
+			return
+		}
+	}
+
+	// Move what still overlaps to the right of the placed nodes, keeping
+	// its level or lane
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	placed := &GraphLayout{Nodes: make(map[string]*NodeLayout, len(gl.Nodes))}
+	for _, node := range nodes {
+		if _, fixed := pinned[node.ID]; fixed {
+			placed.Nodes[node.ID] = node
+		}
+	}
+	for _, node := range nodes {
+		if _, fixed := pinned[node.ID]; fixed {
+			continue
+		}
+		if !placed.fits(node, node.X, node.Y, distance-overlapEpsilon) {
+			placed.bound()
+			node.X = placed.Width + distance + node.Width/2
+		}
+		placed.Nodes[node.ID] = node
+	}
+	gl.growGroups(g, opts)
+}
+
+// growGroups extends the group boxes of a clustered layout to cover their
+// members, padded by NodeSpacing/2 like computeClusteredLayout does
+func (gl *GraphLayout) growGroups(g *graph.Graph, opts LayoutOptions) {
+	if len(gl.Groups) == 0 {
+		return
+	}
+	padding := opts.NodeSpacing / 2
+	members := clusterMembers(g)
+	for i := range gl.Groups {
+		group := &gl.Groups[i]
+		left, top := group.X, group.Y
+		right, bottom := group.X+group.Width, group.Y+group.Height
+		for _, id := range append([]string{group.ID}, members[group.ID]...) {
+			node := gl.Nodes[id]
+			left = math.Min(left, node.X-node.Width/2-padding)
+			top = math.Min(top, node.Y-node.Height/2-padding)
+			right = math.Max(right, node.X+node.Width/2+padding)
+			bottom = math.Max(bottom, node.Y+node.Height/2+padding)
+		}
+		group.X, group.Y = left, top
+		group.Width, group.Height = right-left, bottom-top
+	}
+}
@@ -0,0 +1,68 @@
+package layout
+
+import (
+	"sort"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// Position is the center of a node in layout coordinates
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// pins returns the pinned positions of nodes that exist in g
+func pins(g *graph.Graph, opts LayoutOptions) map[string]Position {
+	pinned := make(map[string]Position, len(opts.Pinned))
+	for id, position := range opts.Pinned {
+		if _, exists := g.Nodes[id]; exists {
+			pinned[id] = position
+		}
+	}
+	return pinned
+}
+
+// pin moves the pinned nodes to their positions and the nodes they now
+// overlap to the closest free spot: along their row in hierarchical layouts,
+// around their position otherwise. Force layouts already keep pinned nodes
+// fixed, so only the pinned nodes are moved and removeOverlaps separates
+// the rest.
+func (gl *GraphLayout) pin(pinned map[string]Position, opts LayoutOptions) {
+	placed := &GraphLayout{Nodes: make(map[string]*NodeLayout, len(gl.Nodes)), Options: opts}
+	var free []*NodeLayout
+	for id, node := range gl.Nodes {
+		if position, ok := pinned[id]; ok {
+			node.X, node.Y = position.X, position.Y
+			placed.Nodes[id] = node
+			continue
+		}
+		free = append(free, node)
+	}
+	if opts.Type == LayoutForce {
+		return
+	}
+
+	// Keep nodes that still fit, from top left to bottom right
+	sort.Slice(free, func(i, j int) bool {
+		a, b := free[i], free[j]
+		if a.Y != b.Y {
+			return a.Y < b.Y
+		}
+		if a.X != b.X {
+			return a.X < b.X
+		}
+		return a.ID < b.ID
+	})
+	for _, node := range free {
+		if !placed.fits(node, node.X, node.Y, 0) {
+			if opts.Type == LayoutHierarchical {
+				node.X, node.Y = placed.freeInRow(node, node.X, node.Y, opts)
+			} else {
+				placed.bound()
+				node.X, node.Y = placed.freeAround(node, node.X, node.Y, opts)
+			}
+		}
+		placed.Nodes[node.ID] = node
+	}
+}
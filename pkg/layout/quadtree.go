@@ -0,0 +1,136 @@
+package layout
+
+import "math"
+
+// quadtreeMinSize stops subdividing cells so that nodes at (almost) the same
+// position end up in one leaf instead of recursing forever
+const quadtreeMinSize = 0.01
+
+// quadtree is a Barnes-Hut tree over node positions. Each cell stores the
+// total mass and center of mass of the nodes below it, so that the repulsion
+// of a distant cell can be approximated by a single force.
+type quadtree struct {
+	cells []quadCell
+	x, y  []float64
+}
+
+type quadCell struct {
+	minX, minY, size float64 // Square covered by the cell
+	massX, massY     float64 // Sum of the positions of the nodes in the cell
+	mass             float64 // Number of nodes in the cell
+	bodies           []int   // Nodes of a leaf; several if they coincide
+	children         [4]int  // Child cell per quadrant, or 0
+}
+
+// newQuadtree builds the tree over the given positions
+func newQuadtree(x, y []float64) *quadtree {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for i := range x {
+		minX, maxX = math.Min(minX, x[i]), math.Max(maxX, x[i])
+		minY, maxY = math.Min(minY, y[i]), math.Max(maxY, y[i])
+	}
+	size := math.Max(math.Max(maxX-minX, maxY-minY), quadtreeMinSize)
+
+	t := &quadtree{cells: make([]quadCell, 1, 2*len(x)), x: x, y: y}
+	t.cells[0] = quadCell{minX: minX, minY: minY, size: size}
+	for i := range x {
+		t.insert(0, i)
+	}
+	return t
+}
+
+func (t *quadtree) insert(cell, i int) {
+	for {
+		c := &t.cells[cell]
+		c.mass++
+		c.massX += t.x[i]
+		c.massY += t.y[i]
+
+		if c.mass == 1 || c.size/2 < quadtreeMinSize {
+			// Coincident nodes share a leaf
+			c.bodies = append(c.bodies, i)
+			return
+		}
+		if len(c.bodies) > 0 {
+			// Push the single node of the leaf down a level
+			body := c.bodies[0]
+			c.bodies = nil
+			index := t.child(cell, body)
+			child := &t.cells[index]
+			child.mass, child.massX, child.massY = 1, t.x[body], t.y[body]
+			child.bodies = []int{body}
+		}
+		cell = t.child(cell, i)
+	}
+}
+
+// child returns the child of cell in the quadrant of node i, creating it if
+// necessary. Newly created cells start out empty.
+func (t *quadtree) child(cell, i int) int {
+	c := t.cells[cell]
+	half := c.size / 2
+	quadrant := 0
+	minX, minY := c.minX, c.minY
+	if t.x[i] >= c.minX+half {
+		quadrant |= 1
+		minX += half
+	}
+	if t.y[i] >= c.minY+half {
+		quadrant |= 2
+		minY += half
+	}
+	if c.children[quadrant] == 0 {
+		t.cells = append(t.cells, quadCell{minX: minX, minY: minY, size: half})
+		t.cells[cell].children[quadrant] = len(t.cells) - 1
+	}
+	return t.cells[cell].children[quadrant]
+}
+
+// repulsion returns the repulsive force on node i. Cells that appear smaller
+// than theta from the node, i.e. whose size divided by their distance is
+// below theta, act as a single body at their center of mass; cells holding
+// the node itself are always opened.
+func (t *quadtree) repulsion(i int, k, theta float64, stack []int) (float64, float64, []int) {
+	var fx, fy float64
+	stack = append(stack[:0], 0)
+	for len(stack) > 0 {
+		cell := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		c := &t.cells[cell]
+		if len(c.bodies) > 0 {
+			for _, j := range c.bodies {
+				if j == i {
+					continue
+				}
+				// Same direction as in repulseAll for coincident nodes
+				ux, uy, distance := delta(t.x[i]-t.x[j], t.y[i]-t.y[j], i, j)
+				if j < i {
+					ux, uy, distance = delta(t.x[j]-t.x[i], t.y[j]-t.y[i], j, i)
+					ux, uy = -ux, -uy
+				}
+				fx += ux * k * k / distance
+				fy += uy * k * k / distance
+			}
+			continue
+		}
+
+		ux, uy, distance := delta(t.x[i]-c.massX/c.mass, t.y[i]-c.massY/c.mass, i, len(t.x)+cell)
+		if c.size/distance < theta && !c.contains(t.x[i], t.y[i]) {
+			force := c.mass * k * k / distance
+			fx += ux * force
+			fy += uy * force
+			continue
+		}
+		for _, child := range c.children {
+			if child != 0 {
+				stack = append(stack, child)
+			}
+		}
+	}
+	return fx, fy, stack
+}
+
+func (c *quadCell) contains(x, y float64) bool {
+	return x >= c.minX && x <= c.minX+c.size && y >= c.minY && y <= c.minY+c.size
+}
@@ -0,0 +1,106 @@
+package layout
+
+import (
+	"math"
+	"sort"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// computeRadialLayout places the roots (nodes without predecessors in
+// execution order) in the center and every other node on a ring by its
+// breadth-first distance from the roots. A single root sits at the center;
+// several roots share the first ring. With opts.FocusNodeID, the focus node
+// sits at the center instead and rings follow the distance from it in both
+// directions. Nodes unreachable from a root or the focus node (on cycles or
+// in other components) go on an extra outer ring.
+func computeRadialLayout(g *graph.Graph, gl *GraphLayout, opts LayoutOptions) {
+	ids := sortedNodeIDs(g)
+	if len(ids) == 0 {
+		return
+	}
+
+	next := successors(g)
+	distance := make(map[string]int, len(ids))
+	var queue []string
+	if opts.FocusNodeID != "" {
+		// Distances in both directions from the focus node
+		undirected := make(map[string][]string, len(ids))
+		for _, from := range ids {
+			for _, to := range next[from] {
+				undirected[from] = append(undirected[from], to)
+				undirected[to] = append(undirected[to], from)
+			}
+		}
+		for id := range undirected {
+			sort.Strings(undirected[id])
+		}
+		next = undirected
+		queue = append(queue, opts.FocusNodeID)
+		distance[opts.FocusNodeID] = 0
+	} else {
+		hasPredecessor := make(map[string]bool, len(ids))
+		for _, targets := range next {
+			for _, id := range targets {
+				hasPredecessor[id] = true
+			}
+		}
+		for _, id := range ids {
+			if !hasPredecessor[id] {
+				distance[id] = 0
+				queue = append(queue, id)
+			}
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, nextID := range next[id] {
+			if _, seen := distance[nextID]; !seen {
+				distance[nextID] = distance[id] + 1
+				queue = append(queue, nextID)
+			}
+		}
+	}
+
+	var rings [][]string
+	var unreached []string
+	for _, id := range ids {
+		d, ok := distance[id]
+		if !ok {
+			unreached = append(unreached, id)
+			continue
+		}
+		for len(rings) <= d {
+			rings = append(rings, nil)
+		}
+		rings[d] = append(rings[d], id)
+	}
+	if len(unreached) > 0 {
+		rings = append(rings, unreached)
+	}
+
+	// With several roots the center stays empty and ring 0 gets a radius
+	rootRing := len(rings[0]) > 1
+
+	spacing := math.Max(opts.NodeWidth, opts.NodeHeight) + opts.LevelSpacing
+	previous := -spacing
+	for level, ring := range rings {
+		radius := 0.0
+		if level > 0 || rootRing {
+			// At least one spacing outside the previous ring and large
+			// enough for the ring's nodes to fit next to each other
+			circumference := float64(len(ring)) * (opts.NodeWidth + opts.NodeSpacing)
+			radius = math.Max(previous+spacing, circumference/(2*math.Pi))
+		}
+		previous = radius
+
+		for i, id := range ring {
+			angle := 2*math.Pi*float64(i)/float64(len(ring)) - math.Pi/2
+			node := gl.Nodes[id]
+			node.Level = level
+			node.X = radius * math.Cos(angle)
+			node.Y = radius * math.Sin(angle)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package layout
+
+import (
+	"sort"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// timelineLane collects the nodes of one timeline lane
+type timelineLane struct {
+	name  string
+	start time.Time // Earliest start of a node in the lane; zero if none started
+	ids   []string
+}
+
+// computeTimelineLayout places nodes on an X axis by their start time and
+// duration, with one lane per workflow holding the workflow and its
+// contained steps; nodes outside any workflow go in a leading "other" lane.
+// Lanes are sorted by their earliest start. A node's box starts at its
+// StartedAt and is Duration long (at least NodeHeight, so instant nodes stay
+// visible); nodes still running end at the latest time recorded in the
+// graph. Nodes that have not started follow the end of the run in execution
+// order. Overlapping nodes of a lane are stacked.
+func computeTimelineLayout(g *graph.Graph, gl *GraphLayout, opts LayoutOptions) {
+	ids := sortedNodeIDs(g)
+	if len(ids) == 0 {
+		return
+	}
+
+	var first, last time.Time
+	started := 0
+	for _, id := range ids {
+		node := g.Nodes[id]
+		if node.StartedAt == nil {
+			continue
+		}
+		started++
+		if first.IsZero() || node.StartedAt.Before(first) {
+			first = *node.StartedAt
+		}
+		last = latest(last, *node.StartedAt)
+		if end := nodeEnd(node); end != nil {
+			last = latest(last, *end)
+		}
+	}
+
+	// Pixels per second; by default the run spans one node width per
+	// started node
+	scale := opts.TimeScale
+	if scale <= 0 {
+		scale = 1
+		if span := last.Sub(first).Seconds(); span > 0 {
+			scale = float64(started) * opts.NodeWidth / span
+		}
+	}
+	runEnd := last.Sub(first).Seconds() * scale
+
+	levels := assignLevels(g)
+	rowHeight := opts.NodeHeight + opts.NodeSpacing
+	top := 0.0
+	for laneIndex, lane := range timelineLanes(g, ids) {
+		// Not started nodes follow the run in execution order
+		waiting := runEnd + opts.NodeSpacing
+		sort.SliceStable(lane.ids, func(i, j int) bool {
+			a, b := g.Nodes[lane.ids[i]], g.Nodes[lane.ids[j]]
+			if (a.StartedAt == nil) != (b.StartedAt == nil) {
+				return b.StartedAt == nil
+			}
+			if a.StartedAt == nil {
+				return levels[a.ID] < levels[b.ID]
+			}
+			return a.StartedAt.Before(*b.StartedAt)
+		})
+
+		var rowEnds []float64
+		for _, id := range lane.ids {
+			node := g.Nodes[id]
+			box := gl.Nodes[id]
+			var left float64
+			if node.StartedAt == nil {
+				left = waiting
+				box.Width = opts.NodeHeight
+				waiting += box.Width + opts.NodeSpacing
+			} else {
+				left = node.StartedAt.Sub(first).Seconds() * scale
+				end := last
+				if finished := nodeEnd(node); finished != nil {
+					end = *finished
+				}
+				box.Width = max(end.Sub(*node.StartedAt).Seconds()*scale, opts.NodeHeight)
+			}
+
+			// First row where the node fits after the previous one
+			row := 0
+			for row < len(rowEnds) && rowEnds[row]+opts.NodeSpacing > left {
+				row++
+			}
+			if row == len(rowEnds) {
+				rowEnds = append(rowEnds, 0)
+			}
+			rowEnds[row] = left + box.Width
+
+			box.Level = laneIndex
+			box.X = left + box.Width/2
+			box.Y = top + opts.LevelSpacing/2 + opts.NodeHeight/2 + float64(row)*rowHeight
+		}
+
+		height := float64(len(rowEnds))*rowHeight - opts.NodeSpacing + opts.LevelSpacing
+		gl.Lanes = append(gl.Lanes, LaneLayout{Name: lane.name, Y: top, Height: height})
+		top += height
+	}
+}
+
+// timelineLanes groups the nodes into a lane per workflow and a leading
+// "other" lane, sorted by the earliest start in each lane
+func timelineLanes(g *graph.Graph, ids []string) []*timelineLane {
+	parents := make(map[string]string)
+	for _, edge := range g.Edges {
+		parent, exists := g.Nodes[edge.FromNodeID]
+		if edge.Type != graph.EdgeTypeContains || !exists || parent.Type != graph.NodeTypeWorkflow {
+			continue
+		}
+		if assigned, ok := parents[edge.ToNodeID]; !ok || edge.FromNodeID < assigned {
+			parents[edge.ToNodeID] = edge.FromNodeID
+		}
+	}
+
+	other := &timelineLane{name: "other"}
+	byWorkflow := make(map[string]*timelineLane)
+	var lanes []*timelineLane
+	for _, id := range ids {
+		node := g.Nodes[id]
+		workflow, contained := parents[id]
+		if node.Type == graph.NodeTypeWorkflow {
+			workflow, contained = id, true
+		}
+
+		lane := other
+		if contained {
+			lane = byWorkflow[workflow]
+			if lane == nil {
+				name := g.Nodes[workflow].Name
+				if name == "" {
+					name = workflow
+				}
+				lane = &timelineLane{name: name}
+				byWorkflow[workflow] = lane
+				lanes = append(lanes, lane)
+			}
+		}
+		lane.ids = append(lane.ids, id)
+		if node.StartedAt != nil && (lane.start.IsZero() || node.StartedAt.Before(lane.start)) {
+			lane.start = *node.StartedAt
+		}
+	}
+
+	// Lanes without started nodes go last
+	sort.SliceStable(lanes, func(i, j int) bool {
+		a, b := lanes[i].start, lanes[j].start
+		if a.IsZero() != b.IsZero() {
+			return b.IsZero()
+		}
+		return a.Before(b)
+	})
+	if len(other.ids) > 0 {
+		lanes = append([]*timelineLane{other}, lanes...)
+	}
+	return lanes
+}
+
+// nodeEnd returns when a started node finished: CompletedAt, or StartedAt
+// plus Duration; nil while it is running
+func nodeEnd(node *graph.Node) *time.Time {
+	if node.CompletedAt != nil {
+		return node.CompletedAt
+	}
+	if node.StartedAt != nil && node.Duration > 0 {
+		end := node.StartedAt.Add(node.Duration)
+		return &end
+	}
+	return nil
+}
+
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,206 @@
+package layout
+
+import (
+	"math"
+	"sort"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+)
+
+// updateSearchSteps bounds how far Update looks for a free spot around a
+// node's preferred position, in node sizes
+const updateSearchSteps = 64
+
+// Update returns a layout of g that keeps the nodes of existing in place and
+// only positions the nodes in changedNodeIDs and the nodes existing does not
+// know yet, e.g. after edges were added, so that live views do not jump
+// around on every change. Nodes no longer in g are dropped. Placed nodes go
+// next to their already placed neighbours without overlapping other nodes:
+// in hierarchical layouts on the row of their level, in other layouts as
+// close as possible around their neighbours' center. Coordinates of kept
+// nodes do not change, so new nodes never go above or left of (0, 0).
+// Pinned nodes go to their positions in existing.Options.
+//
+// Swimlane, timeline and clustered layouts, whose lanes and groups depend on
+// all nodes, and layouts keeping none of their nodes are recomputed with
+// existing.Options. Existing is not modified.
+func Update(existing *GraphLayout, g *graph.Graph, changedNodeIDs []string) (*GraphLayout, error) {
+	opts := withDefaults(existing.Options)
+	if existing.Type != "" {
+		opts.Type = existing.Type
+	}
+	if opts.Type == LayoutSwimlane || opts.Type == LayoutTimeline || opts.Clusters {
+		return ComputeLayout(g, opts)
+	}
+
+	changed := make(map[string]bool, len(changedNodeIDs))
+	for _, id := range changedNodeIDs {
+		changed[id] = true
+	}
+
+	gl := &GraphLayout{
+		Type:    opts.Type,
+		Nodes:   make(map[string]*NodeLayout, len(g.Nodes)),
+		Options: opts,
+	}
+	var pending []string
+	for _, id := range sortedNodeIDs(g) {
+		node, exists := existing.Nodes[id]
+		if !exists || changed[id] {
+			pending = append(pending, id)
+			continue
+		}
+		kept := *node
+		gl.Nodes[id] = &kept
+	}
+	if len(gl.Nodes) == 0 {
+		return ComputeLayout(g, opts)
+	}
+
+	// Place nodes in execution order, so that predecessors placed in this
+	// update can anchor their successors
+	levels := assignLevels(g)
+	sort.SliceStable(pending, func(i, j int) bool { return levels[pending[i]] < levels[pending[j]] })
+
+	neighbours := make(map[string][]string, len(g.Nodes))
+	for from, targets := range successors(g) {
+		for _, to := range targets {
+			neighbours[from] = append(neighbours[from], to)
+			neighbours[to] = append(neighbours[to], from)
+		}
+	}
+
+	// Rows of the hierarchical layout by level, from the kept nodes
+	rows := make(map[int]float64)
+	for _, node := range gl.Nodes {
+		rows[node.Level] = node.Y
+	}
+	gl.bound()
+
+	for _, id := range pending {
+		node := &NodeLayout{ID: id, Width: opts.NodeWidth, Height: opts.NodeHeight}
+		x, y, anchored := gl.anchor(neighbours[id])
+
+		if position, ok := opts.Pinned[id]; ok {
+			node.X, node.Y = position.X, position.Y
+			node.Level = levels[id]
+		} else if opts.Type == LayoutHierarchical {
+			node.Level = levels[id]
+			row, known := rows[node.Level]
+			if !known {
+				row = float64(node.Level)*(opts.NodeHeight+opts.LevelSpacing) + opts.NodeHeight/2
+			}
+			if !anchored {
+				x = gl.rowEnd(row) + opts.NodeSpacing + opts.NodeWidth/2
+			}
+			node.X, node.Y = gl.freeInRow(node, x, row, opts)
+		} else {
+			if !anchored {
+				x, y = gl.Width+opts.NodeSpacing+opts.NodeWidth/2, opts.NodeHeight/2
+			}
+			node.X, node.Y = gl.freeAround(node, x, y, opts)
+		}
+		gl.Nodes[id] = node
+		gl.bound()
+	}
+	return gl, nil
+}
+
+// anchor returns the center of the already placed nodes among ids
+func (gl *GraphLayout) anchor(ids []string) (float64, float64, bool) {
+	var x, y float64
+	count := 0
+	for _, id := range ids {
+		if node, placed := gl.Nodes[id]; placed {
+			x += node.X
+			y += node.Y
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, 0, false
+	}
+	return x / float64(count), y / float64(count), true
+}
+
+// rowEnd returns the right edge of the rightmost node centered at y, or
+// minus the spacing if the row is empty
+func (gl *GraphLayout) rowEnd(y float64) float64 {
+	end := -gl.Options.NodeSpacing
+	for _, node := range gl.Nodes {
+		if node.Y == y {
+			end = math.Max(end, node.X+node.Width/2)
+		}
+	}
+	return end
+}
+
+// freeInRow returns the position closest to x on the row at y where node
+// does not overlap any placed node
+func (gl *GraphLayout) freeInRow(node *NodeLayout, x, y float64, opts LayoutOptions) (float64, float64) {
+	step := opts.NodeWidth + opts.NodeSpacing
+	for i := 0; i <= updateSearchSteps; i++ {
+		for _, candidate := range []float64{x + float64(i)*step/2, x - float64(i)*step/2} {
+			if candidate >= node.Width/2 && gl.fits(node, candidate, y, updateSpacing(opts)) {
+				return candidate, y
+			}
+		}
+	}
+	return gl.rowEnd(y) + opts.NodeSpacing + node.Width/2, y
+}
+
+// freeAround returns the position closest to (x, y) where node does not
+// overlap any placed node, searching rings of growing radius
+func (gl *GraphLayout) freeAround(node *NodeLayout, x, y float64, opts LayoutOptions) (float64, float64) {
+	step := math.Max(opts.NodeWidth, opts.NodeHeight) + opts.NodeSpacing
+	for ring := 0; ring <= updateSearchSteps; ring++ {
+		radius := float64(ring) * step / 2
+		candidates := 1
+		if ring > 0 {
+			candidates = 8 * ring
+		}
+		for i := 0; i < candidates; i++ {
+			angle := 2*math.Pi*float64(i)/float64(candidates) - math.Pi/2
+			cx, cy := x+radius*math.Cos(angle), y+radius*math.Sin(angle)
+			if cx >= node.Width/2 && cy >= node.Height/2 && gl.fits(node, cx, cy, updateSpacing(opts)) {
+				return cx, cy
+			}
+		}
+	}
+	return gl.Width + opts.NodeSpacing + node.Width/2, node.Height / 2
+}
+
+// updateSpacing is the gap Update keeps around placed nodes: NodeSpacing, or
+// MinNodeDistance if that is larger
+func updateSpacing(opts LayoutOptions) float64 {
+	return max(opts.NodeSpacing, opts.MinNodeDistance)
+}
+
+// fits reports whether node centered at (x, y) keeps at least spacing from
+// every placed node
+func (gl *GraphLayout) fits(node *NodeLayout, x, y, spacing float64) bool {
+	for _, other := range gl.Nodes {
+		if math.Abs(x-other.X) < (node.Width+other.Width)/2+spacing &&
+			math.Abs(y-other.Y) < (node.Height+other.Height)/2+spacing {
+			return false
+		}
+	}
+	return true
+}
+
+// bound sets Width and Height to the right and bottom edges of the nodes,
+// lanes and groups without moving them
+func (gl *GraphLayout) bound() {
+	gl.Width, gl.Height = 0, 0
+	for _, node := range gl.Nodes {
+		gl.Width = math.Max(gl.Width, node.X+node.Width/2)
+		gl.Height = math.Max(gl.Height, node.Y+node.Height/2)
+	}
+	for _, lane := range gl.Lanes {
+		gl.Height = math.Max(gl.Height, lane.Y+lane.Height)
+	}
+	for _, group := range gl.Groups {
+		gl.Width = math.Max(gl.Width, group.X+group.Width)
+		gl.Height = math.Max(gl.Height, group.Y+group.Height)
+	}
+}
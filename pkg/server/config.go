@@ -0,0 +1,467 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/api"
+	"github.com/philipsahli/innominatus-graph/pkg/execution"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix prefixes the environment variables overriding config keys, e.g.
+// IDP_DATABASE_HOST for database.host
+const EnvPrefix = "IDP"
+
+// Config is read from the config file, the environment and the flags,
+// each overriding the one before, by LoadConfig
+type Config struct {
+	Server    ServerSection    `mapstructure:"server"`
+	Database  DatabaseSection  `mapstructure:"database"`
+	Auth      AuthSection      `mapstructure:"auth"`
+	Telemetry TelemetrySection `mapstructure:"telemetry"`
+	Log       LogSection       `mapstructure:"log"`
+}
+
+type ServerSection struct {
+	Port               int  `mapstructure:"port"`
+	SimulateExecutions bool `mapstructure:"simulate_executions"`
+	GraphCache         struct {
+		Size int           `mapstructure:"size"` // 0 disables the cache
+		TTL  time.Duration `mapstructure:"ttl"`
+	} `mapstructure:"graph_cache"`
+	Exports struct {
+		Timeout  time.Duration `mapstructure:"timeout"`
+		MaxBytes int64         `mapstructure:"max_bytes"`
+		Workers  int           `mapstructure:"workers"`
+	} `mapstructure:"exports"`
+	TLS       TLSSection       `mapstructure:"tls"`
+	RateLimit RateLimitSection `mapstructure:"rate_limit"`
+	// RunQueue lets replicas sharing a database execute each run once
+	RunQueue struct {
+		Enabled      bool          `mapstructure:"enabled"`
+		PollInterval time.Duration `mapstructure:"poll_interval"`
+		Concurrency  int           `mapstructure:"concurrency"`
+	} `mapstructure:"run_queue"`
+	// Events polls the state history for the state changes of every replica
+	// sharing the database, for the event streams and subscriptions of this
+	// one; a poll interval of 0 delivers only this replica's changes
+	Events struct {
+		PollInterval time.Duration `mapstructure:"poll_interval"`
+	} `mapstructure:"events"`
+}
+
+type TLSSection struct {
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// ClientCAFile requires client certificates signed by its CAs (mTLS)
+	ClientCAFile string `mapstructure:"client_ca_file"`
+	// RedirectPort serves redirects from HTTP to HTTPS; 0 disables them
+	RedirectPort int `mapstructure:"redirect_port"`
+}
+
+// RateLimitSection limits the requests per client; a rate of 0 does not
+// limit
+type RateLimitSection struct {
+	Requests  RateLimit `mapstructure:"requests"`
+	Expensive RateLimit `mapstructure:"expensive"`
+	// Clients replace the limits of single clients, by identity name or IP;
+	// unset limits are those of all clients
+	Clients []struct {
+		Client    string    `mapstructure:"client"`
+		Requests  RateLimit `mapstructure:"requests"`
+		Expensive RateLimit `mapstructure:"expensive"`
+	} `mapstructure:"clients"`
+}
+
+type RateLimit struct {
+	Rate  float64 `mapstructure:"rate"` // Requests per second
+	Burst int     `mapstructure:"burst"`
+}
+
+// limits converts the section for api.RESTHandler.SetRateLimits
+func (s RateLimitSection) limits() api.RateLimits {
+	limits := api.RateLimits{
+		Requests:  api.RateLimit(s.Requests),
+		Expensive: api.RateLimit(s.Expensive),
+		Clients:   make(map[string]api.ClientRateLimits, len(s.Clients)),
+	}
+	for _, client := range s.Clients {
+		limits.Clients[client.Client] = api.ClientRateLimits{
+			Requests:  api.RateLimit(client.Requests),
+			Expensive: api.RateLimit(client.Expensive),
+		}
+	}
+	return limits
+}
+
+type DatabaseSection struct {
+	Type     string `mapstructure:"type"`
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	User     string `mapstructure:"user"`
+	Password string `mapstructure:"password"`
+	// PasswordFile is read for the password, e.g. a mounted secret
+	PasswordFile    string        `mapstructure:"password_file"`
+	Name            string        `mapstructure:"name"`
+	SSLMode         string        `mapstructure:"ssl_mode"`
+	MaxOpenConns    int           `mapstructure:"max_open_conns"`
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+}
+
+type AuthSection struct {
+	APIKeys []string `mapstructure:"api_keys"` // name=key
+	OIDC    struct {
+		Issuer   string `mapstructure:"issuer"`
+		ClientID string `mapstructure:"client_id"`
+	} `mapstructure:"oidc"`
+	AnonymousReads bool   `mapstructure:"anonymous_reads"`
+	RBACPolicy     string `mapstructure:"rbac_policy"`
+}
+
+type TelemetrySection struct {
+	// OTLPEndpoint is the OpenTelemetry collector runs are sent to as traces
+	OTLPEndpoint string            `mapstructure:"otlp_endpoint"`
+	OTLPHeaders  map[string]string `mapstructure:"otlp_headers"`
+	ServiceName  string            `mapstructure:"service_name"`
+}
+
+type LogSection struct {
+	Level  string `mapstructure:"level"`
+	Format string `mapstructure:"format"` // json or text
+}
+
+// AddFlags adds the flags overriding the config keys to flags, with the
+// defaults of the keys
+func AddFlags(flags *pflag.FlagSet) {
+	flags.Int("port", 8080, "server port")
+	flags.String("db-type", "postgres", "database type: postgres, mysql or sqlite")
+	flags.String("db-host", "localhost", "database host")
+	flags.Int("db-port", 0, "database port (default: 5432 for postgres, 3306 for mysql)")
+	flags.String("db-user", "postgres", "database user")
+	flags.String("db-password", "", "database password")
+	flags.String("db-password-file", "", "file holding the database password, e.g. a mounted secret")
+	flags.String("db-name", "idp_orchestrator", "database name or SQLite file")
+	flags.String("db-ssl-mode", "disable", "database SSL mode")
+	flags.Int("db-max-open-conns", 25, "maximum open database connections")
+	flags.Int("db-max-idle-conns", 5, "maximum idle database connections")
+	flags.Duration("db-conn-max-lifetime", 30*time.Minute, "maximum lifetime of a database connection")
+	flags.Int("graph-cache-size", 128, "number of graphs to cache (0 disables the cache)")
+	flags.Duration("graph-cache-ttl", time.Minute, "maximum age of cached graphs")
+	flags.Bool("simulate-executions", false, "execute graphs with the mock workflow runner")
+	flags.Bool("run-queue", false, "queue runs in the database for the replicas sharing it to claim")
+	flags.Duration("run-queue-poll-interval", time.Second, "how often the run queue is checked")
+	flags.Int("run-queue-concurrency", 4, "number of queued runs executed at the same time")
+	flags.Duration("events-poll-interval", 0, "how often the state changes of all replicas are read for the event streams (0 streams only this replica's)")
+	flags.Duration("export-timeout", 2*time.Minute, "maximum duration of an export job")
+	flags.Int64("export-max-bytes", 64<<20, "maximum output size of an export job")
+	flags.Int("export-workers", 2, "number of export jobs run at the same time")
+	flags.String("tls-cert", "", "serve HTTPS with this certificate file")
+	flags.String("tls-key", "", "private key file of the TLS certificate")
+	flags.String("tls-client-ca", "", "require client certificates signed by the CAs in this file (mTLS)")
+	flags.Int("tls-redirect-port", 0, "redirect HTTP requests on this port to HTTPS (0 disables)")
+	flags.Float64("rate-limit", 0, "requests per second and client (0 disables the limit)")
+	flags.Int("rate-limit-burst", 0, "requests a client may send at once (default: the rate)")
+	flags.Float64("rate-limit-expensive", 0, "exports and executions per second and client (0 disables the limit)")
+	flags.Int("rate-limit-expensive-burst", 0, "exports and executions a client may start at once (default: the rate)")
+	flags.StringSlice("api-key", nil, "accept an API key as name=key (repeatable, also read from API_KEYS)")
+	flags.String("oidc-issuer", "", "accept ID tokens of this OpenID Connect issuer")
+	flags.String("oidc-client-id", "", "client ID the ID tokens must be issued for")
+	flags.Bool("auth-anonymous-reads", false, "serve REST reads without credentials when authentication is enabled")
+	flags.String("rbac-policy", "", "YAML file with the role bindings to enforce")
+	flags.String("log-level", "info", "minimum level logged: debug, info, warn or error")
+	flags.String("log-format", "json", "log format: json or text")
+	flags.String("otlp-endpoint", "", "OpenTelemetry collector to send runs to as traces")
+	flags.String("service-name", execution.DefaultTraceServiceName, "service name of exported traces")
+}
+
+// BindFlags lets the flags added by AddFlags and the environment override
+// the config keys read by v
+func BindFlags(v *viper.Viper, flags *pflag.FlagSet) error {
+	for flag, key := range flagKeys {
+		if err := v.BindPFlag(key, flags.Lookup(flag)); err != nil {
+			return err
+		}
+	}
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	return nil
+}
+
+// flagKeys maps the flags to the config keys they override
+var flagKeys = map[string]string{
+	"port":                       "server.port",
+	"simulate-executions":        "server.simulate_executions",
+	"graph-cache-size":           "server.graph_cache.size",
+	"graph-cache-ttl":            "server.graph_cache.ttl",
+	"export-timeout":             "server.exports.timeout",
+	"export-max-bytes":           "server.exports.max_bytes",
+	"export-workers":             "server.exports.workers",
+	"tls-cert":                   "server.tls.cert_file",
+	"tls-key":                    "server.tls.key_file",
+	"tls-client-ca":              "server.tls.client_ca_file",
+	"tls-redirect-port":          "server.tls.redirect_port",
+	"run-queue":                  "server.run_queue.enabled",
+	"run-queue-poll-interval":    "server.run_queue.poll_interval",
+	"run-queue-concurrency":      "server.run_queue.concurrency",
+	"events-poll-interval":       "server.events.poll_interval",
+	"rate-limit":                 "server.rate_limit.requests.rate",
+	"rate-limit-burst":           "server.rate_limit.requests.burst",
+	"rate-limit-expensive":       "server.rate_limit.expensive.rate",
+	"rate-limit-expensive-burst": "server.rate_limit.expensive.burst",
+	"db-type":                    "database.type",
+	"db-host":                    "database.host",
+	"db-port":                    "database.port",
+	"db-user":                    "database.user",
+	"db-password":                "database.password",
+	"db-password-file":           "database.password_file",
+	"db-name":                    "database.name",
+	"db-ssl-mode":                "database.ssl_mode",
+	"db-max-open-conns":          "database.max_open_conns",
+	"db-max-idle-conns":          "database.max_idle_conns",
+	"db-conn-max-lifetime":       "database.conn_max_lifetime",
+	"api-key":                    "auth.api_keys",
+	"oidc-issuer":                "auth.oidc.issuer",
+	"oidc-client-id":             "auth.oidc.client_id",
+	"auth-anonymous-reads":       "auth.anonymous_reads",
+	"rbac-policy":                "auth.rbac_policy",
+	"otlp-endpoint":              "telemetry.otlp_endpoint",
+	"service-name":               "telemetry.service_name",
+	"log-level":                  "log.level",
+	"log-format":                 "log.format",
+}
+
+// LoadConfig reads the config file at path, if any, and the environment on
+// top of the flag defaults bound to v with BindFlags. The password file is
+// read, but nothing is connected to.
+func LoadConfig(v *viper.Viper, path string) (*Config, error) {
+	if path != "" {
+		v.SetConfigFile(path)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+	}
+
+	var cfg Config
+	if err := v.UnmarshalExact(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	// Variables of earlier releases
+	if cfg.Database.Password == "" && cfg.Database.PasswordFile == "" {
+		cfg.Database.Password = os.Getenv("POSTGRES_PASSWORD")
+	}
+	if env := os.Getenv("API_KEYS"); env != "" {
+		cfg.Auth.APIKeys = append(cfg.Auth.APIKeys, strings.Split(env, ",")...)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Database.PasswordFile != "" {
+		data, err := os.ReadFile(cfg.Database.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read database password: %w", err)
+		}
+		cfg.Database.Password = strings.TrimRight(string(data), "\r\n")
+	}
+	return &cfg, nil
+}
+
+// validate reports every invalid setting, each prefixed with its key
+func (cfg *Config) validate() error {
+	var errs []error
+	invalid := func(key, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if cfg.Server.Port < 1 || cfg.Server.Port > 65535 {
+		invalid("server.port", "must be between 1 and 65535, got %d", cfg.Server.Port)
+	}
+	if cfg.Server.GraphCache.Size < 0 {
+		invalid("server.graph_cache.size", "must not be negative")
+	}
+	if cfg.Server.GraphCache.TTL < 0 {
+		invalid("server.graph_cache.ttl", "must not be negative")
+	}
+	if cfg.Server.Exports.Timeout < 0 {
+		invalid("server.exports.timeout", "must not be negative")
+	}
+	if cfg.Server.Exports.MaxBytes < 0 {
+		invalid("server.exports.max_bytes", "must not be negative")
+	}
+	if cfg.Server.Exports.Workers < 0 {
+		invalid("server.exports.workers", "must not be negative")
+	}
+	if cfg.Server.RunQueue.PollInterval < 0 {
+		invalid("server.run_queue.poll_interval", "must not be negative")
+	}
+	if cfg.Server.RunQueue.Concurrency < 0 {
+		invalid("server.run_queue.concurrency", "must not be negative")
+	}
+	if cfg.Server.Events.PollInterval < 0 {
+		invalid("server.events.poll_interval", "must not be negative")
+	}
+	tls := cfg.Server.TLS
+	if (tls.CertFile == "") != (tls.KeyFile == "") {
+		invalid("server.tls", "cert_file and key_file must be set together")
+	}
+	if tls.CertFile == "" {
+		if tls.ClientCAFile != "" {
+			invalid("server.tls.client_ca_file", "requires server.tls.cert_file")
+		}
+		if tls.RedirectPort != 0 {
+			invalid("server.tls.redirect_port", "requires server.tls.cert_file")
+		}
+	}
+	if tls.RedirectPort < 0 || tls.RedirectPort > 65535 {
+		invalid("server.tls.redirect_port", "must be between 1 and 65535, got %d", tls.RedirectPort)
+	} else if tls.RedirectPort != 0 && tls.RedirectPort == cfg.Server.Port {
+		invalid("server.tls.redirect_port", "must differ from server.port")
+	}
+
+	checkRateLimit := func(key string, limit RateLimit) {
+		if limit.Rate < 0 {
+			invalid(key+".rate", "must not be negative")
+		}
+		if limit.Burst < 0 {
+			invalid(key+".burst", "must not be negative")
+		}
+	}
+	checkRateLimit("server.rate_limit.requests", cfg.Server.RateLimit.Requests)
+	checkRateLimit("server.rate_limit.expensive", cfg.Server.RateLimit.Expensive)
+	clients := make(map[string]bool)
+	for i, client := range cfg.Server.RateLimit.Clients {
+		key := fmt.Sprintf("server.rate_limit.clients[%d]", i)
+		if client.Client == "" {
+			invalid(key+".client", "is required")
+		} else if clients[client.Client] {
+			invalid(key+".client", "duplicate client %q", client.Client)
+		}
+		clients[client.Client] = true
+		checkRateLimit(key+".requests", client.Requests)
+		checkRateLimit(key+".expensive", client.Expensive)
+	}
+
+	db := cfg.Database
+	switch storage.DatabaseType(db.Type) {
+	case storage.DatabaseTypePostgres, storage.DatabaseTypeMySQL:
+		if db.Host == "" {
+			invalid("database.host", "is required for %s", db.Type)
+		}
+		if db.Port < 0 || db.Port > 65535 {
+			invalid("database.port", "must be between 1 and 65535, or 0 for the default of %s, got %d", db.Type, db.Port)
+		}
+	case storage.DatabaseTypeSQLite:
+	default:
+		invalid("database.type", "must be postgres, mysql or sqlite, got %q", db.Type)
+	}
+	if db.Name == "" {
+		invalid("database.name", "is required")
+	}
+	if db.Password != "" && db.PasswordFile != "" {
+		invalid("database.password_file", "must not be set together with database.password")
+	}
+	if storage.DatabaseType(db.Type) == storage.DatabaseTypePostgres {
+		switch db.SSLMode {
+		case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+		default:
+			invalid("database.ssl_mode", "unsupported mode %q", db.SSLMode)
+		}
+	}
+	if db.MaxOpenConns < 0 {
+		invalid("database.max_open_conns", "must not be negative")
+	}
+	if db.MaxIdleConns < 0 {
+		invalid("database.max_idle_conns", "must not be negative")
+	}
+	if db.ConnMaxLifetime < 0 {
+		invalid("database.conn_max_lifetime", "must not be negative")
+	}
+
+	if _, err := parseAPIKeys(cfg.Auth.APIKeys); err != nil {
+		invalid("auth.api_keys", "%v", err)
+	}
+	oidc := cfg.Auth.OIDC
+	if oidc.Issuer != "" {
+		if err := checkURL(oidc.Issuer); err != nil {
+			invalid("auth.oidc.issuer", "%v", err)
+		}
+		if oidc.ClientID == "" {
+			invalid("auth.oidc.client_id", "is required with auth.oidc.issuer")
+		}
+	} else if oidc.ClientID != "" {
+		invalid("auth.oidc.issuer", "is required with auth.oidc.client_id")
+	}
+
+	if cfg.Telemetry.OTLPEndpoint != "" {
+		if err := checkURL(cfg.Telemetry.OTLPEndpoint); err != nil {
+			invalid("telemetry.otlp_endpoint", "%v", err)
+		}
+	} else if len(cfg.Telemetry.OTLPHeaders) > 0 {
+		invalid("telemetry.otlp_headers", "require telemetry.otlp_endpoint")
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Log.Level)); err != nil {
+		invalid("log.level", "must be debug, info, warn or error, got %q", cfg.Log.Level)
+	}
+	if cfg.Log.Format != "json" && cfg.Log.Format != "text" {
+		invalid("log.format", "must be json or text, got %q", cfg.Log.Format)
+	}
+
+	return errors.Join(errs...)
+}
+
+// newLogger creates the logger of the validated log settings. Records
+// logged with a request's context carry its request and trace IDs.
+func newLogger(settings LogSection) *slog.Logger {
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(settings.Level))
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler = slog.NewJSONHandler(os.Stderr, opts)
+	if settings.Format == "text" {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	return slog.New(api.NewLogHandler(handler))
+}
+
+// parseAPIKeys parses name=key entries into a map of name to key
+func parseAPIKeys(entries []string) (map[string]string, error) {
+	keys := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		name, key, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || name == "" || key == "" {
+			return nil, fmt.Errorf("invalid API key entry for %q: expected name=key", name)
+		}
+		if _, exists := keys[name]; exists {
+			return nil, fmt.Errorf("duplicate API key name %q", name)
+		}
+		keys[name] = key
+	}
+	return keys, nil
+}
+
+// checkURL accepts absolute http and https URLs
+func checkURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("must be an http or https URL, got %q", raw)
+	}
+	return nil
+}
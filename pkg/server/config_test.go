@@ -0,0 +1,163 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadTestConfig loads the config file with contents file, if not empty,
+// and the flags of args
+func loadTestConfig(t *testing.T, file string, args ...string) (*Config, error) {
+	t.Helper()
+	flags := pflag.NewFlagSet("server", pflag.ContinueOnError)
+	AddFlags(flags)
+	v := viper.New()
+	require.NoError(t, BindFlags(v, flags))
+	require.NoError(t, flags.Parse(args))
+
+	var path string
+	if file != "" {
+		path = filepath.Join(t.TempDir(), "server.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(file), 0o600))
+	}
+	return LoadConfig(v, path)
+}
+
+func TestLoadConfig(t *testing.T) {
+	config, err := loadTestConfig(t, "")
+	require.NoError(t, err)
+	assert.Equal(t, 8080, config.Server.Port)
+	assert.Equal(t, "postgres", config.Database.Type)
+	assert.Equal(t, 0, config.Database.Port)
+	assert.Equal(t, 2*time.Minute, config.Server.Exports.Timeout)
+	assert.Empty(t, config.Server.TLS)
+
+	file := `
+server:
+  port: 8443
+  tls:
+    cert_file: /etc/graph/tls.crt
+    key_file: /etc/graph/tls.key
+    redirect_port: 8080
+  rate_limit:
+    requests:
+      rate: 5
+    clients:
+      - client: ci
+        requests:
+          rate: 50
+database:
+  type: sqlite
+  name: graph.db
+`
+	config, err = loadTestConfig(t, file, "--log-level", "debug")
+	require.NoError(t, err)
+	assert.Equal(t, 8443, config.Server.Port)
+	assert.Equal(t, TLSSection{CertFile: "/etc/graph/tls.crt", KeyFile: "/etc/graph/tls.key", RedirectPort: 8080}, config.Server.TLS)
+	assert.Equal(t, 50.0, config.Server.RateLimit.limits().Clients["ci"].Requests.Rate)
+	assert.Equal(t, "debug", config.Log.Level)
+
+	t.Setenv("IDP_SERVER_PORT", "9090")
+	config, err = loadTestConfig(t, file)
+	require.NoError(t, err)
+	assert.Equal(t, 9090, config.Server.Port, "the environment overrides the file")
+	config, err = loadTestConfig(t, file, "--port", "9091")
+	require.NoError(t, err)
+	assert.Equal(t, 9091, config.Server.Port, "flags override the environment")
+}
+
+func TestLoadConfig_Files(t *testing.T) {
+	_, err := loadTestConfig(t, "server: [")
+	assert.ErrorContains(t, err, "failed to read config file")
+
+	_, err = loadTestConfig(t, "server:\n  prot: 8080\n")
+	assert.ErrorContains(t, err, "invalid config")
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("s3cret\n"), 0o600))
+	config, err := loadTestConfig(t, "", "--db-password-file", passwordFile)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", config.Database.Password)
+
+	_, err = loadTestConfig(t, "", "--db-password-file", filepath.Join(t.TempDir(), "missing"))
+	assert.ErrorContains(t, err, "failed to read database password")
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr []string // Empty if valid
+	}{
+		{name: "defaults"},
+		{name: "TLS", args: []string{"--tls-cert", "tls.crt", "--tls-key", "tls.key", "--tls-client-ca", "ca.crt", "--tls-redirect-port", "80"}},
+		{name: "cert without key", args: []string{"--tls-cert", "tls.crt"}, wantErr: []string{"server.tls: cert_file and key_file must be set together"}},
+		{name: "key without cert", args: []string{"--tls-key", "tls.key"}, wantErr: []string{"server.tls: cert_file and key_file must be set together"}},
+		{
+			name:    "client CA without cert",
+			args:    []string{"--tls-client-ca", "ca.crt"},
+			wantErr: []string{"server.tls.client_ca_file: requires server.tls.cert_file"},
+		},
+		{
+			name:    "redirect without cert",
+			args:    []string{"--tls-redirect-port", "80"},
+			wantErr: []string{"server.tls.redirect_port: requires server.tls.cert_file"},
+		},
+		{
+			name:    "redirect to itself",
+			args:    []string{"--tls-cert", "tls.crt", "--tls-key", "tls.key", "--tls-redirect-port", "8080"},
+			wantErr: []string{"server.tls.redirect_port: must differ from server.port"},
+		},
+		{
+			name:    "invalid redirect port",
+			args:    []string{"--tls-cert", "tls.crt", "--tls-key", "tls.key", "--tls-redirect-port", "65536"},
+			wantErr: []string{"server.tls.redirect_port: must be between 1 and 65535, got 65536"},
+		},
+		{name: "port 0", args: []string{"--port", "0"}, wantErr: []string{"server.port: must be between 1 and 65535, got 0"}},
+		{name: "port too large", args: []string{"--port", "65536"}, wantErr: []string{"server.port: must be between 1 and 65535, got 65536"}},
+		{
+			name:    "negative database port",
+			args:    []string{"--db-port", "-1"},
+			wantErr: []string{"database.port: must be between 1 and 65535, or 0 for the default of postgres, got -1"},
+		},
+		{name: "sqlite ignores the port", args: []string{"--db-type", "sqlite", "--db-port", "-1"}},
+		{name: "unknown database", args: []string{"--db-type", "oracle"}, wantErr: []string{`database.type: must be postgres, mysql or sqlite, got "oracle"`}},
+		{name: "negative events poll interval", args: []string{"--events-poll-interval", "-1s"}, wantErr: []string{"server.events.poll_interval: must not be negative"}},
+		{name: "negative rate limit", args: []string{"--rate-limit", "-1"}, wantErr: []string{"server.rate_limit.requests.rate: must not be negative"}},
+		{name: "invalid API key", args: []string{"--api-key", "ci"}, wantErr: []string{`auth.api_keys: invalid API key entry for "ci"`}},
+		{
+			name:    "OIDC issuer without client",
+			args:    []string{"--oidc-issuer", "https://login.example.com"},
+			wantErr: []string{"auth.oidc.client_id: is required with auth.oidc.issuer"},
+		},
+		{
+			name: "every error",
+			args: []string{"--port", "0", "--tls-cert", "tls.crt", "--log-format", "xml"},
+			wantErr: []string{
+				"server.port: must be between 1 and 65535, got 0",
+				"server.tls: cert_file and key_file must be set together",
+				`log.format: must be json or text, got "xml"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadTestConfig(t, "", tt.args...)
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			for _, want := range tt.wantErr {
+				assert.Contains(t, err.Error(), want)
+			}
+		})
+	}
+}
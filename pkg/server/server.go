@@ -0,0 +1,373 @@
+// Package server runs the HTTP server of the REST and GraphQL APIs on a
+// database, as configured by Config. Both the server command and "ctl
+// serve" run it.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/events"
+	"github.com/philipsahli/innominatus-graph/pkg/execution"
+	"github.com/philipsahli/innominatus-graph/pkg/storage"
+	"github.com/philipsahli/innominatus-graph/pkg/tracing"
+
+	"github.com/philipsahli/innominatus-graph/pkg/api"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// Server serves the APIs as configured
+type Server struct {
+	config     *Config
+	authorizer *api.Authorizer
+	tlsConfig  *tls.Config
+}
+
+// New reads the files of config: the RBAC policy and the TLS certificates.
+// Nothing is connected to until Run.
+func New(config *Config) (*Server, error) {
+	s := &Server{config: config}
+	var err error
+	if config.Auth.RBACPolicy != "" {
+		if s.authorizer, err = loadAuthorizer(config.Auth.RBACPolicy); err != nil {
+			return nil, err
+		}
+	}
+	if s.tlsConfig, err = newTLSConfig(config.Server.TLS); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// newWorker creates the worker executing queued runs, publishing their
+// events to publisher and sending them to the trace collector
+func newWorker(repository storage.RepositoryInterface, runner execution.WorkflowRunner, publisher events.Publisher, traces *execution.TraceExporter, pollInterval time.Duration, concurrency int, logger *slog.Logger) *execution.Worker {
+	return execution.NewWorker(repository, runner, execution.WorkerOptions{
+		PollInterval: pollInterval,
+		Concurrency:  concurrency,
+		Observers: func(run *storage.GraphRunModel) []execution.ExecutionObserver {
+			return []execution.ExecutionObserver{events.TenantExecutionObserver(publisher, run.TenantID)}
+		},
+		OnFinish: func(plan *execution.ExecutionPlan) {
+			if traces == nil {
+				return
+			}
+			if err := traces.ExportPlan(context.Background(), plan); err != nil {
+				logger.Warn("failed to export trace", "run_id", plan.RunID, "error", err)
+			}
+		},
+	})
+}
+
+// newAuthenticator returns the authenticator configured by the auth
+// settings, or nil to serve requests without authentication
+func newAuthenticator(ctx context.Context, auth AuthSection) (api.Authenticator, error) {
+	var authenticators []api.Authenticator
+	if len(auth.APIKeys) > 0 {
+		keys, err := parseAPIKeys(auth.APIKeys)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, api.NewAPIKeyAuthenticator(keys))
+	}
+	if auth.OIDC.Issuer != "" {
+		oidcAuthenticator, err := api.NewOIDCAuthenticator(ctx, auth.OIDC.Issuer, auth.OIDC.ClientID)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, oidcAuthenticator)
+	}
+
+	if len(authenticators) == 0 {
+		return nil, nil
+	}
+	return api.ChainAuthenticators(authenticators...), nil
+}
+
+// loadAuthorizer reads the role bindings of an RBAC policy file:
+//
+//	bindings:
+//	  - subject: group:payments
+//	    role: operator
+//	    app: checkout
+func loadAuthorizer(path string) (*api.Authorizer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read RBAC policy: %w", err)
+	}
+	var policy struct {
+		Bindings []api.RoleBinding `yaml:"bindings"`
+	}
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse RBAC policy: %w", err)
+	}
+	return api.NewAuthorizer(policy.Bindings)
+}
+
+// Run migrates the database and serves the APIs until ctx is done, then
+// shuts down gracefully, finishing the claimed runs. It sets the default
+// logger to the one of the log settings.
+func (s *Server) Run(ctx context.Context) error {
+	config := s.config
+	logger := newLogger(config.Log)
+	slog.SetDefault(logger)
+
+	cfg := storage.Config{
+		Type:            storage.DatabaseType(config.Database.Type),
+		Host:            config.Database.Host,
+		Port:            config.Database.Port,
+		User:            config.Database.User,
+		Password:        config.Database.Password,
+		DBName:          config.Database.Name,
+		SSLMode:         config.Database.SSLMode,
+		MaxOpenConns:    config.Database.MaxOpenConns,
+		MaxIdleConns:    config.Database.MaxIdleConns,
+		ConnMaxLifetime: config.Database.ConnMaxLifetime,
+	}
+
+	db, err := storage.NewConnection(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	var traces *execution.TraceExporter
+	var tracer *tracing.Tracer
+	if config.Telemetry.OTLPEndpoint != "" {
+		traces = execution.NewTraceExporter(config.Telemetry.OTLPEndpoint)
+		traces.Headers = config.Telemetry.OTLPHeaders
+		traces.ServiceName = config.Telemetry.ServiceName
+		tracer = tracing.NewTracer(traces, tracing.TracerOptions{
+			OnError: func(err error) { logger.Warn("failed to export spans", "error", err) },
+		})
+		defer tracer.Close()
+		if err := storage.TraceQueries(db, tracer); err != nil {
+			return fmt.Errorf("failed to trace database queries: %w", err)
+		}
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+	defer sqlDB.Close()
+
+	if err := storage.AutoMigrate(db); err != nil {
+		return fmt.Errorf("failed to run database migrations: %w", err)
+	}
+
+	store := storage.NewRepository(db)
+	var repository storage.RepositoryInterface = store
+	if config.Server.GraphCache.Size > 0 {
+		repository = storage.NewCachedRepository(repository, storage.CacheOptions{
+			Size: config.Server.GraphCache.Size,
+			TTL:  config.Server.GraphCache.TTL,
+		})
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(api.RequestIDMiddleware())
+	if tracer != nil {
+		r.Use(api.TracingMiddleware(tracer))
+	}
+	r.Use(api.LoggingMiddleware(logger))
+	r.Use(gin.Recovery())
+
+	// Executions and state updates publish their events to one dispatcher
+	// that the event streams and subscriptions of both APIs subscribe to.
+	// Deferred first, it is closed after the worker has stopped.
+	dispatcher := events.NewDispatcher(events.DispatcherOptions{})
+	defer dispatcher.Close()
+	restHandler := api.NewRESTHandler(repository)
+	defer restHandler.Close()
+	restHandler.SetEventDispatcher(dispatcher)
+	restHandler.SetExportJobLimits(api.ExportJobLimits{
+		Timeout:  config.Server.Exports.Timeout,
+		MaxBytes: config.Server.Exports.MaxBytes,
+		Workers:  config.Server.Exports.Workers,
+	})
+	restHandler.SetRateLimits(config.Server.RateLimit.limits())
+	resolver := api.NewResolver(repository)
+	resolver.SetEventDispatcher(dispatcher)
+	// The worker publishes the events of queued runs to runs: the
+	// dispatcher, less the state changes if the poller publishes those of
+	// every replica from the state history
+	var runs events.Publisher = dispatcher
+	if interval := config.Server.Events.PollInterval; interval > 0 {
+		poller := events.NewStatePoller(store, dispatcher, events.StatePollerOptions{Interval: interval, Logger: logger})
+		restHandler.SetStateChangesPolled()
+		resolver.SetStateChangesPolled()
+		runs = events.PublishOfType(dispatcher, events.TypeRunStarted, events.TypeRunCompleted)
+		pollerCtx, stopPoller := context.WithCancel(context.Background())
+		defer stopPoller()
+		go poller.Run(pollerCtx)
+	}
+	var runner execution.WorkflowRunner
+	if config.Server.SimulateExecutions {
+		runner = execution.NewMockWorkflowRunner()
+		restHandler.SetWorkflowRunner(runner)
+		resolver.SetWorkflowRunner(runner)
+	}
+	if traces != nil {
+		restHandler.SetTraceExporter(traces)
+		resolver.SetTraceExporter(traces)
+	}
+	var worker *execution.Worker
+	if config.Server.RunQueue.Enabled {
+		// Replicas without a runner only queue runs for the others
+		if runner != nil {
+			worker = newWorker(repository, runner, runs, traces, config.Server.RunQueue.PollInterval, config.Server.RunQueue.Concurrency, logger)
+		}
+		restHandler.SetRunQueue(worker)
+		resolver.SetRunQueue(worker)
+	}
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	defer stopWorker()
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		if worker != nil {
+			logger.Info("claiming queued runs", "worker", worker.ID())
+			worker.Run(workerCtx)
+		}
+	}()
+
+	authenticator, err := newAuthenticator(ctx, config.Auth)
+	if err != nil {
+		return err
+	}
+	graphqlMiddleware := []gin.HandlerFunc{api.TenantMiddleware(), api.ActorMiddleware()}
+	if authenticator != nil {
+		restHandler.SetAuthenticator(authenticator, config.Auth.AnonymousReads)
+		graphqlMiddleware = append(graphqlMiddleware, api.AuthMiddleware(authenticator), api.RequireIdentity())
+	}
+	if s.authorizer != nil {
+		restHandler.SetAuthorizer(s.authorizer)
+		resolver.SetAuthorizer(s.authorizer)
+	}
+	graphqlMiddleware = append(graphqlMiddleware, restHandler.RateLimitMiddleware())
+
+	restHandler.SetupRoutes(r)
+
+	srv := handler.NewDefaultServer(api.NewExecutableSchema(api.Config{Resolvers: resolver}))
+	playgroundHandler := playground.Handler("GraphQL playground", "/graphql")
+
+	graphqlHandlers := append(graphqlMiddleware, gin.WrapH(srv))
+	r.POST("/graphql", graphqlHandlers...)
+	// Subscriptions connect with a websocket upgrade of GET /graphql; plain
+	// GET requests get the playground
+	playgroundUnlessWebsocket := func(c *gin.Context) {
+		if !c.IsWebsocket() {
+			playgroundHandler.ServeHTTP(c.Writer, c.Request)
+			c.Abort()
+		}
+	}
+	r.GET("/graphql", append([]gin.HandlerFunc{playgroundUnlessWebsocket}, graphqlHandlers...)...)
+
+	r.GET("/", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "IDP Orchestrator API",
+			"version": "1.0.0",
+			"endpoints": gin.H{
+				"health":   "/health",
+				"graphql":  "/graphql",
+				"rest_api": "/api/v1",
+				"openapi":  "/openapi.json",
+				"ui":       "/ui",
+			},
+		})
+	})
+
+	r.GET("/health", func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+		defer cancel()
+
+		database := storage.HealthCheck(ctx, db)
+		status, code := "healthy", http.StatusOK
+		if !database.Healthy {
+			status, code = "unhealthy", http.StatusServiceUnavailable
+		}
+
+		c.JSON(code, gin.H{
+			"status":   status,
+			"version":  "1.0.0",
+			"time":     time.Now().UTC().Format(time.RFC3339),
+			"database": database,
+		})
+	})
+
+	server := &http.Server{
+		Addr:      fmt.Sprintf(":%d", config.Server.Port),
+		Handler:   r,
+		TLSConfig: s.tlsConfig,
+	}
+	servers := []*http.Server{server}
+	// A server that fails to listen stops Run
+	failed := make(chan error, 2)
+
+	scheme := "http"
+	if s.tlsConfig != nil {
+		scheme = "https"
+		if port := config.Server.TLS.RedirectPort; port != 0 {
+			redirect := &http.Server{
+				Addr:              fmt.Sprintf(":%d", port),
+				Handler:           redirectToHTTPS(config.Server.Port),
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			servers = append(servers, redirect)
+			go func() {
+				logger.Info("redirecting HTTP to HTTPS", "port", port)
+				if err := redirect.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					failed <- fmt.Errorf("failed to start redirect server: %w", err)
+				}
+			}()
+		}
+	}
+
+	go func() {
+		base := fmt.Sprintf("%s://localhost:%d", scheme, config.Server.Port)
+		logger.Info("starting server", "port", config.Server.Port, "graphql", base+"/graphql", "rest_api", base+"/api/v1")
+		var err error
+		if s.tlsConfig != nil {
+			// The certificate is loaded into TLSConfig already
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			failed <- fmt.Errorf("failed to start server: %w", err)
+		}
+	}()
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+	case runErr = <-failed:
+	}
+
+	logger.Info("shutting down server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, server := range servers {
+		if err := server.Shutdown(shutdownCtx); err != nil && runErr == nil {
+			runErr = fmt.Errorf("server forced to shutdown: %w", err)
+		}
+	}
+	// Finish the claimed runs, so that they do not stay running
+	stopWorker()
+	<-workerDone
+
+	logger.Info("server exited")
+	return runErr
+}
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCertificate is a certificate for localhost written to PEM files
+type testCertificate struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// newTestCertificate writes the certificate name and its key to dir,
+// signed by issuer or, if nil, a self-signed CA
+func newTestCertificate(t *testing.T, dir, name string, issuer *testCertificate) *testCertificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	parent, signer := template, key
+	if issuer == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		parent, signer = issuer.cert, issuer.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	c := &testCertificate{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".crt"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+	require.NoError(t, os.WriteFile(c.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(c.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return c
+}
+
+// pool returns a pool trusting c
+func (c *testCertificate) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.cert)
+	return pool
+}
+
+// tlsCertificate returns c for a tls.Config
+func (c *testCertificate) tlsCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	require.NoError(t, err)
+	return certificate
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCertificate(t, dir, "ca", nil)
+	server := newTestCertificate(t, dir, "server", ca)
+	notPEM := filepath.Join(dir, "not-pem.crt")
+	require.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0o600))
+
+	config, err := newTLSConfig(TLSSection{})
+	assert.NoError(t, err)
+	assert.Nil(t, config, "HTTP without a certificate")
+
+	config, err = newTLSConfig(TLSSection{CertFile: server.certFile, KeyFile: server.keyFile})
+	require.NoError(t, err)
+	assert.Len(t, config.Certificates, 1)
+	assert.Equal(t, uint16(tls.VersionTLS12), config.MinVersion)
+	assert.Equal(t, tls.NoClientCert, config.ClientAuth)
+
+	config, err = newTLSConfig(TLSSection{CertFile: server.certFile, KeyFile: server.keyFile, ClientCAFile: ca.certFile})
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+	assert.True(t, config.ClientCAs.Equal(ca.pool()))
+
+	tests := []struct {
+		name     string
+		settings TLSSection
+		wantErr  string
+	}{
+		{name: "missing key", settings: TLSSection{CertFile: server.certFile, KeyFile: filepath.Join(dir, "missing.key")}, wantErr: "failed to load TLS certificate"},
+		{name: "key of another certificate", settings: TLSSection{CertFile: server.certFile, KeyFile: ca.keyFile}, wantErr: "failed to load TLS certificate"},
+		{
+			name:     "missing client CA",
+			settings: TLSSection{CertFile: server.certFile, KeyFile: server.keyFile, ClientCAFile: filepath.Join(dir, "missing.crt")},
+			wantErr:  "failed to read client CA",
+		},
+		{
+			name:     "client CA without certificates",
+			settings: TLSSection{CertFile: server.certFile, KeyFile: server.keyFile, ClientCAFile: notPEM},
+			wantErr:  "no certificates found in client CA " + notPEM,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTLSConfig(tt.settings)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestNewTLSConfig_ClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCertificate(t, dir, "ca", nil)
+	serverCert := newTestCertificate(t, dir, "server", ca)
+	client := newTestCertificate(t, dir, "client", ca)
+	stranger := newTestCertificate(t, dir, "stranger", newTestCertificate(t, dir, "other-ca", nil))
+
+	config, err := newTLSConfig(TLSSection{CertFile: serverCert.certFile, KeyFile: serverCert.keyFile, ClientCAFile: ca.certFile})
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	get := func(certificates ...tls.Certificate) error {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      ca.pool(),
+			Certificates: certificates,
+		}}}
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	assert.NoError(t, get(client.tlsCertificate(t)))
+	assert.Error(t, get(), "no client certificate")
+	assert.Error(t, get(stranger.tlsCertificate(t)), "client certificate of another CA")
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		name      string
+		httpsPort int
+		url       string
+		location  string
+	}{
+		{name: "default port", httpsPort: 443, url: "http://graph.example.com/api/v1/apps?limit=5", location: "https://graph.example.com/api/v1/apps?limit=5"},
+		{name: "other port", httpsPort: 8443, url: "http://graph.example.com:8080/graphql", location: "https://graph.example.com:8443/graphql"},
+		{name: "IPv6", httpsPort: 8443, url: "http://[::1]:8080/health", location: "https://[::1]:8443/health"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			redirectToHTTPS(tt.httpsPort).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.url, nil))
+			assert.Equal(t, http.StatusPermanentRedirect, rec.Code)
+			assert.Equal(t, tt.location, rec.Header().Get("Location"))
+		})
+	}
+}
+
+// freePort returns a port nothing listens on
+func freePort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestServer_RunTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCertificate(t, dir, "ca", nil)
+	serverCert := newTestCertificate(t, dir, "server", ca)
+	port, redirectPort := freePort(t), freePort(t)
+	config, err := loadTestConfig(t, "",
+		"--port", strconv.Itoa(port),
+		"--tls-cert", serverCert.certFile,
+		"--tls-key", serverCert.keyFile,
+		"--tls-redirect-port", strconv.Itoa(redirectPort),
+		"--db-type", "sqlite",
+		"--db-name", filepath.Join(dir, "graph.db"),
+		"--log-level", "error",
+	)
+	require.NoError(t, err)
+	s, err := New(config)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	defer func() {
+		cancel()
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(10 * time.Second):
+			t.Error("server did not shut down")
+		}
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: ca.pool()}},
+		// Report redirects rather than following them
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		Timeout:       2 * time.Second,
+	}
+	healthURL := "https://localhost:" + strconv.Itoa(port) + "/health"
+	var resp *http.Response
+	require.Eventually(t, func() bool {
+		resp, err = client.Get(healthURL)
+		return err == nil
+	}, 10*time.Second, 50*time.Millisecond)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, uint16(tls.VersionTLS13), resp.TLS.Version)
+	assert.Equal(t, "server", resp.TLS.PeerCertificates[0].Subject.CommonName)
+
+	resp, err = client.Get("http://localhost:" + strconv.Itoa(port) + "/health")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "plain HTTP on the HTTPS port")
+
+	resp, err = client.Get("http://localhost:" + strconv.Itoa(redirectPort) + "/api/v1/apps")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusPermanentRedirect, resp.StatusCode)
+	assert.Equal(t, "https://localhost:"+strconv.Itoa(port)+"/api/v1/apps", resp.Header.Get("Location"))
+}
+
+func TestNew_InvalidTLS(t *testing.T) {
+	dir := t.TempDir()
+	serverCert := newTestCertificate(t, dir, "server", nil)
+	config, err := loadTestConfig(t, "", "--tls-cert", serverCert.certFile, "--tls-key", filepath.Join(dir, "missing.key"))
+	require.NoError(t, err, "files are read by New")
+
+	_, err = New(config)
+	assert.ErrorContains(t, err, "failed to load TLS certificate")
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SystemActor is recorded for mutations made without an actor in the context
+const SystemActor = "system"
+
+// AuditAction identifies the kind of mutation an audit entry records
+type AuditAction string
+
+const (
+	AuditActionSaveGraph       AuditAction = "save_graph"
+	AuditActionUpdateNodeState AuditAction = "update_node_state"
+	AuditActionCreateGraphRun  AuditAction = "create_graph_run"
+	AuditActionUpdateGraphRun  AuditAction = "update_graph_run"
+	AuditActionRestoreSnapshot AuditAction = "restore_snapshot"
+	AuditActionSetAppMetadata  AuditAction = "set_app_metadata"
+)
+
+// AuditLogModel records who changed what and when. App names are stored
+// instead of IDs so entries outlive deleted apps.
+type AuditLogModel struct {
+	ID        uuid.UUID `gorm:"type:char(36);primary_key" json:"id"`
+	TenantID  uuid.UUID `gorm:"type:char(36);not null;default:'00000000-0000-0000-0000-000000000000';index" json:"tenant_id"`
+	Actor     string    `gorm:"type:varchar(255);not null;index" json:"actor"`
+	Action    string    `gorm:"type:varchar(50);not null;index" json:"action"`
+	AppName   string    `gorm:"type:varchar(255);not null;index" json:"app_name"`
+	Target    string    `gorm:"type:varchar(255)" json:"target,omitempty"` // node or run ID
+	Details   string    `gorm:"type:text" json:"details"`                  // JSON string (text for SQLite and MySQL compatibility)
+	CreatedAt time.Time `gorm:"not null;index" json:"created_at"`
+}
+
+func (AuditLogModel) TableName() string {
+	return "graph_audit_log"
+}
+
+func (a *AuditLogModel) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// AuditFilter narrows the result of GetAuditLog. Zero values match all
+// entries; Limit <= 0 returns all matching entries.
+type AuditFilter struct {
+	AppName string
+	Actor   string
+	Action  AuditAction
+	From    time.Time
+	To      time.Time
+	Limit   int
+}
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx that attributes repository mutations to actor
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor stored in ctx, or SystemActor
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return SystemActor
+}
+
+// GetAuditLog returns the audit entries of the repository's tenant matching
+// filter, newest first
+func (r *Repository) GetAuditLog(filter AuditFilter) ([]AuditLogModel, error) {
+	query := r.db.Scopes(r.tenantScope)
+	if filter.AppName != "" {
+		query = query.Where("app_name = ?", filter.AppName)
+	}
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", string(filter.Action))
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	var entries []AuditLogModel
+	if err := query.Order("created_at DESC").Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("failed to load audit log: %w", err)
+	}
+	return entries, nil
+}
+
+// audit records a mutation made through the repository within db, which is
+// usually the mutation's transaction
+func (r *Repository) audit(db *gorm.DB, action AuditAction, appName, target string, details map[string]interface{}) error {
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit details: %w", err)
+	}
+
+	entry := &AuditLogModel{
+		TenantID:  r.tenantID,
+		Actor:     r.actor,
+		Action:    string(action),
+		AppName:   appName,
+		Target:    target,
+		Details:   string(detailsJSON),
+		CreatedAt: time.Now(),
+	}
+	if err := db.Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
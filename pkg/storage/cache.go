@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"io"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/google/uuid"
+)
+
+// CacheOptions configures a CachedRepository
+type CacheOptions struct {
+	// Size is the maximum number of cached graphs (defaults to 128)
+	Size int
+	// TTL expires cached graphs after the given age. Zero keeps them until
+	// they are evicted or invalidated.
+	TTL time.Duration
+}
+
+// CacheStats reports the effectiveness of a CachedRepository
+type CacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+}
+
+// CachedRepository caches LoadGraph results of the wrapped repository in an
+// LRU cache. Graphs are invalidated by mutations made through the cached
+// repository or any repository returned by its ForTenant; writes made to the
+// database by other processes are only picked up once the TTL expires.
+// Callers get their own copy of a cached graph and may modify it.
+type CachedRepository struct {
+	RepositoryInterface
+	tenantID uuid.UUID
+	cache    *graphCache
+}
+
+// NewCachedRepository wraps repository with a graph cache
+func NewCachedRepository(repository RepositoryInterface, opts CacheOptions) *CachedRepository {
+	if opts.Size <= 0 {
+		opts.Size = 128
+	}
+
+	tenantID := DefaultTenantID
+	if scoped, ok := repository.(interface{ TenantID() uuid.UUID }); ok {
+		tenantID = scoped.TenantID()
+	}
+
+	return &CachedRepository{
+		RepositoryInterface: repository,
+		tenantID:            tenantID,
+		cache: &graphCache{
+			size:    opts.Size,
+			ttl:     opts.TTL,
+			order:   list.New(),
+			entries: make(map[graphCacheKey]*list.Element),
+		},
+	}
+}
+
+// ForTenant returns a cached repository for the tenant in ctx that shares
+// the cache with c
+func (c *CachedRepository) ForTenant(ctx context.Context) RepositoryInterface {
+	return &CachedRepository{
+		RepositoryInterface: c.RepositoryInterface.ForTenant(ctx),
+		tenantID:            TenantFromContext(ctx),
+		cache:               c.cache,
+	}
+}
+
+// Stats returns the hit and miss counters and the number of cached graphs
+func (c *CachedRepository) Stats() CacheStats {
+	return c.cache.stats()
+}
+
+func (c *CachedRepository) LoadGraph(appName string) (*graph.Graph, error) {
+	key := graphCacheKey{tenantID: c.tenantID, appName: appName}
+	if g, ok := c.cache.get(key); ok {
+		return cloneGraph(g), nil
+	}
+
+	g, err := c.RepositoryInterface.LoadGraph(appName)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.put(key, cloneGraph(g))
+	return g, nil
+}
+
+func (c *CachedRepository) SaveGraph(appName string, g *graph.Graph) error {
+	defer c.invalidate(appName)
+	return c.RepositoryInterface.SaveGraph(appName, g)
+}
+
+func (c *CachedRepository) DeleteGraph(appName string) error {
+	defer c.invalidate(appName)
+	return c.RepositoryInterface.DeleteGraph(appName)
+}
+
+func (c *CachedRepository) DeleteApp(appName string, opts DeleteOptions) error {
+	defer c.invalidate(appName)
+	return c.RepositoryInterface.DeleteApp(appName, opts)
+}
+
+func (c *CachedRepository) RestoreApp(appName string) error {
+	defer c.invalidate(appName)
+	return c.RepositoryInterface.RestoreApp(appName)
+}
+
+func (c *CachedRepository) RestoreNode(appName, nodeID string) error {
+	defer c.invalidate(appName)
+	return c.RepositoryInterface.RestoreNode(appName, nodeID)
+}
+
+func (c *CachedRepository) RestoreAppSnapshot(r io.Reader) (string, error) {
+	appName, err := c.RepositoryInterface.RestoreAppSnapshot(r)
+	if err == nil {
+		c.invalidate(appName)
+	}
+	return appName, err
+}
+
+func (c *CachedRepository) SetAppMetadata(appName string, metadata graph.AppMetadata) error {
+	defer c.invalidate(appName)
+	return c.RepositoryInterface.SetAppMetadata(appName, metadata)
+}
+
+func (c *CachedRepository) SetAppAnnotation(appName, key, value string) error {
+	defer c.invalidate(appName)
+	return c.RepositoryInterface.SetAppAnnotation(appName, key, value)
+}
+
+func (c *CachedRepository) UpdateNodeState(appName string, nodeID string, state graph.NodeState) error {
+	defer c.invalidate(appName)
+	return c.RepositoryInterface.UpdateNodeState(appName, nodeID, state)
+}
+
+func (c *CachedRepository) UpdateNodeStates(appName string, states map[string]graph.NodeState) (map[string]error, error) {
+	defer c.invalidate(appName)
+	return c.RepositoryInterface.UpdateNodeStates(appName, states)
+}
+
+func (c *CachedRepository) invalidate(appName string) {
+	c.cache.remove(graphCacheKey{tenantID: c.tenantID, appName: appName})
+}
+
+type graphCacheKey struct {
+	tenantID uuid.UUID
+	appName  string
+}
+
+type graphCacheEntry struct {
+	key      graphCacheKey
+	graph    *graph.Graph
+	storedAt time.Time
+}
+
+// graphCache is a size-bounded LRU cache of graphs
+type graphCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List // front is most recently used
+	entries map[graphCacheKey]*list.Element
+	hits    int64
+	misses  int64
+}
+
+func (c *graphCache) get(key graphCacheKey) (*graph.Graph, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	entry := element.Value.(*graphCacheEntry)
+	if c.ttl > 0 && time.Since(entry.storedAt) > c.ttl {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		c.misses++
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	c.hits++
+	return entry.graph, true
+}
+
+func (c *graphCache) put(key graphCacheKey, g *graph.Graph) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &graphCacheEntry{key: key, graph: g, storedAt: time.Now()}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*graphCacheEntry).key)
+	}
+}
+
+func (c *graphCache) remove(key graphCacheKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+func (c *graphCache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{Hits: c.hits, Misses: c.misses, Entries: c.order.Len()}
+}
+
+// cloneGraph copies a graph with its nodes and edges so that cached graphs
+// are not affected by changes callers make to the graphs they receive
+func cloneGraph(g *graph.Graph) *graph.Graph {
+	clone := &graph.Graph{
+		ID:        g.ID,
+		AppName:   g.AppName,
+		Version:   g.Version,
+		Nodes:     make(map[string]*graph.Node, len(g.Nodes)),
+		Edges:     make(map[string]*graph.Edge, len(g.Edges)),
+		Metadata:  cloneAppMetadata(g.Metadata),
+		CreatedAt: g.CreatedAt,
+		UpdatedAt: g.UpdatedAt,
+	}
+	for id, node := range g.Nodes {
+		copied := *node
+		copied.Properties = maps.Clone(node.Properties)
+		clone.Nodes[id] = &copied
+	}
+	for id, edge := range g.Edges {
+		copied := *edge
+		copied.Properties = maps.Clone(edge.Properties)
+		clone.Edges[id] = &copied
+	}
+	return clone
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedRepository_LoadGraph(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	cached := NewCachedRepository(repo, CacheOptions{})
+
+	require.NoError(t, cached.SaveGraph("app", createTestGraph("app")))
+
+	first, err := cached.LoadGraph("app")
+	require.NoError(t, err)
+	first.Nodes["app-spec"].Name = "modified by caller"
+
+	second, err := cached.LoadGraph("app")
+	require.NoError(t, err)
+	assert.Equal(t, "Spec", second.Nodes["app-spec"].Name)
+	assert.Len(t, second.Edges, 3)
+
+	stats := cached.Stats()
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, int64(1), stats.Misses)
+	assert.Equal(t, 1, stats.Entries)
+
+	_, err = cached.LoadGraph("missing")
+	assert.Error(t, err)
+	assert.Equal(t, 1, cached.Stats().Entries)
+}
+
+func TestCachedRepository_Invalidation(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	cached := NewCachedRepository(repo, CacheOptions{})
+
+	require.NoError(t, cached.SaveGraph("app", createTestGraph("app")))
+	_, err := cached.LoadGraph("app")
+	require.NoError(t, err)
+
+	require.NoError(t, cached.UpdateNodeState("app", "app-spec", graph.NodeStateRunning))
+	loaded, err := cached.LoadGraph("app")
+	require.NoError(t, err)
+	assert.Equal(t, graph.NodeStateRunning, loaded.Nodes["app-spec"].State)
+
+	_, err = cached.UpdateNodeStates("app", map[string]graph.NodeState{"app-spec": graph.NodeStateSucceeded})
+	require.NoError(t, err)
+	loaded, err = cached.LoadGraph("app")
+	require.NoError(t, err)
+	assert.Equal(t, graph.NodeStateSucceeded, loaded.Nodes["app-spec"].State)
+
+	require.NoError(t, loaded.RemoveNode("app-db"))
+	require.NoError(t, cached.SaveGraph("app", loaded))
+	loaded, err = cached.LoadGraph("app")
+	require.NoError(t, err)
+	assert.Len(t, loaded.Nodes, 3)
+
+	require.NoError(t, cached.DeleteApp("app", DeleteOptions{Soft: true}))
+	_, err = cached.LoadGraph("app")
+	assert.Error(t, err)
+
+	assert.Equal(t, int64(0), cached.Stats().Hits)
+}
+
+func TestCachedRepository_Eviction(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	cached := NewCachedRepository(repo, CacheOptions{Size: 2})
+
+	for _, app := range []string{"a", "b", "c"} {
+		require.NoError(t, cached.SaveGraph(app, createTestGraph(app)))
+		_, err := cached.LoadGraph(app)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, cached.Stats().Entries)
+
+	_, err := cached.LoadGraph("a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), cached.Stats().Hits, "least recently used graph should be evicted")
+
+	_, err = cached.LoadGraph("a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), cached.Stats().Hits)
+}
+
+func TestCachedRepository_TTL(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	cached := NewCachedRepository(repo, CacheOptions{TTL: time.Millisecond})
+
+	require.NoError(t, cached.SaveGraph("app", createTestGraph("app")))
+	_, err := cached.LoadGraph("app")
+	require.NoError(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+	_, err = cached.LoadGraph("app")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), cached.Stats().Hits)
+}
+
+func TestCachedRepository_ForTenant(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	cached := NewCachedRepository(repo, CacheOptions{})
+
+	tenant, err := repo.CreateTenant("acme")
+	require.NoError(t, err)
+	acme := cached.ForTenant(WithTenant(context.Background(), tenant.ID))
+
+	require.NoError(t, cached.SaveGraph("app", createTestGraph("app")))
+	require.NoError(t, acme.SaveGraph("app", createTestGraph("acme")))
+
+	defaultGraph, err := cached.LoadGraph("app")
+	require.NoError(t, err)
+	acmeGraph, err := acme.LoadGraph("app")
+	require.NoError(t, err)
+
+	assert.Contains(t, defaultGraph.Nodes, "app-spec")
+	assert.Contains(t, acmeGraph.Nodes, "acme-spec")
+	assert.Equal(t, 2, cached.Stats().Entries)
+}
@@ -1,12 +1,18 @@
 package storage
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
 
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
 type DatabaseType string
@@ -14,22 +20,66 @@ type DatabaseType string
 const (
 	DatabaseTypePostgres DatabaseType = "postgres"
 	DatabaseTypeSQLite   DatabaseType = "sqlite"
+	DatabaseTypeMySQL    DatabaseType = "mysql"
 )
 
+// DefaultPort returns the port servers of dbType listen on by default, used
+// when Config.Port is not set, or 0 for SQLite
+func DefaultPort(dbType DatabaseType) int {
+	switch dbType {
+	case DatabaseTypePostgres:
+		return 5432
+	case DatabaseTypeMySQL:
+		return 3306
+	}
+	return 0
+}
+
 type Config struct {
-	Type     DatabaseType // "postgres" or "sqlite"
-	Host     string       // PostgreSQL only
-	Port     int          // PostgreSQL only
-	User     string       // PostgreSQL only
-	Password string       // PostgreSQL only
+	Type     DatabaseType // "postgres", "mysql" or "sqlite"
+	Host     string       // PostgreSQL and MySQL only
+	Port     int          // PostgreSQL and MySQL only (0 for DefaultPort)
+	User     string       // PostgreSQL and MySQL only
+	Password string       // PostgreSQL and MySQL only
 	DBName   string       // Database name or SQLite file path
 	SSLMode  string       // PostgreSQL only
+
+	// Connection pool settings; zero values keep the database/sql defaults
+	MaxOpenConns    int           // Maximum number of open connections
+	MaxIdleConns    int           // Maximum number of idle connections
+	ConnMaxLifetime time.Duration // Maximum time a connection may be reused
+}
+
+// ServerPort returns the port to connect to: Port, or the default port of
+// Type when it is not set
+func (c Config) ServerPort() int {
+	if c.Port == 0 {
+		return DefaultPort(c.Type)
+	}
+	return c.Port
+}
+
+// HealthStatus reports database readiness and connection pool usage
+type HealthStatus struct {
+	Healthy         bool          `json:"healthy"`
+	Error           string        `json:"error,omitempty"`
+	Latency         time.Duration `json:"latency"`
+	OpenConnections int           `json:"open_connections"`
+	InUse           int           `json:"in_use"`
+	Idle            int           `json:"idle"`
 }
 
 // NewConnection creates a database connection based on the configuration type
+// that logs slow and failed queries to slog.Default()
 func NewConnection(config Config) (*gorm.DB, error) {
+	return NewConnectionWithOptions(config, DefaultOptions())
+}
+
+// NewConnectionWithOptions creates a database connection whose queries are
+// logged according to opts
+func NewConnectionWithOptions(config Config, opts Options) (*gorm.DB, error) {
 	gormConfig := &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+		Logger: newGormLogger(opts),
 	}
 
 	var db *gorm.DB
@@ -37,24 +87,88 @@ func NewConnection(config Config) (*gorm.DB, error) {
 
 	switch config.Type {
 	case DatabaseTypeSQLite:
-		db, err = gorm.Open(sqlite.Open(config.DBName), gormConfig)
+		db, err = gorm.Open(sqlite.Open(sqliteDSN(config.DBName)), gormConfig)
 		if err != nil {
 			return nil, fmt.Errorf("failed to connect to SQLite: %w", err)
 		}
 	case DatabaseTypePostgres:
 		dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s",
-			config.Host, config.User, config.Password, config.DBName, config.Port, config.SSLMode)
+			config.Host, config.User, config.Password, config.DBName, config.ServerPort(), config.SSLMode)
 		db, err = gorm.Open(postgres.Open(dsn), gormConfig)
 		if err != nil {
 			return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
 		}
+	case DatabaseTypeMySQL:
+		db, err = gorm.Open(mysql.Open(mysqlDSN(config)), gormConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to MySQL: %w", err)
+		}
 	default:
 		return nil, fmt.Errorf("unsupported database type: %s", config.Type)
 	}
 
+	if err := configurePool(db, config); err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
 
+func configurePool(db *gorm.DB, config Config) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+
+	if config.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(config.MaxOpenConns)
+	}
+	if config.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(config.MaxIdleConns)
+	}
+	if config.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(config.ConnMaxLifetime)
+	}
+
+	return nil
+}
+
+// Ping verifies that the database is reachable
+func Ping(ctx context.Context, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return fmt.Errorf("database ping failed: %w", err)
+	}
+	return nil
+}
+
+// HealthCheck pings the database and reports the result together with the
+// current connection pool statistics
+func HealthCheck(ctx context.Context, db *gorm.DB) HealthStatus {
+	start := time.Now()
+	err := Ping(ctx, db)
+
+	status := HealthStatus{
+		Healthy: err == nil,
+		Latency: time.Since(start),
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	if sqlDB, dbErr := db.DB(); dbErr == nil {
+		stats := sqlDB.Stats()
+		status.OpenConnections = stats.OpenConnections
+		status.InUse = stats.InUse
+		status.Idle = stats.Idle
+	}
+
+	return status
+}
+
 // NewPostgresConnection creates a PostgreSQL connection (convenience function)
 func NewPostgresConnection(host, user, password, dbname, sslmode string, port int) (*gorm.DB, error) {
 	return NewConnection(Config{
@@ -68,6 +182,18 @@ func NewPostgresConnection(host, user, password, dbname, sslmode string, port in
 	})
 }
 
+// NewMySQLConnection creates a MySQL or MariaDB connection (convenience function)
+func NewMySQLConnection(host, user, password, dbname string, port int) (*gorm.DB, error) {
+	return NewConnection(Config{
+		Type:     DatabaseTypeMySQL,
+		Host:     host,
+		Port:     port,
+		User:     user,
+		Password: password,
+		DBName:   dbname,
+	})
+}
+
 // NewSQLiteConnection creates a SQLite connection (convenience function)
 func NewSQLiteConnection(filepath string) (*gorm.DB, error) {
 	return NewConnection(Config{
@@ -76,6 +202,67 @@ func NewSQLiteConnection(filepath string) (*gorm.DB, error) {
 	})
 }
 
+// sqliteDSN adds the options letting connections of one process, like the
+// run queue workers, write the same file at once: writers wait for each
+// other instead of failing with "database is locked", and transactions take
+// the write lock when they begin, as upgrading a read lock later fails at
+// once when another connection writes
+func sqliteDSN(path string) string {
+	options := "_busy_timeout=5000&_txlock=immediate"
+	if strings.Contains(path, "?") {
+		return path + "&" + options
+	}
+	return path + "?" + options
+}
+
+// mysqlDSN builds a go-sql-driver DSN. Times are parsed into time.Time and
+// stored in UTC, and utf8mb4 is used so node names and properties can hold
+// any unicode text.
+func mysqlDSN(config Config) string {
+	cfg := mysqldriver.NewConfig()
+	cfg.User = config.User
+	cfg.Passwd = config.Password
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(config.Host, strconv.Itoa(config.ServerPort()))
+	cfg.DBName = config.DBName
+	cfg.ParseTime = true
+	cfg.Params = map[string]string{"charset": "utf8mb4"}
+
+	return cfg.FormatDSN()
+}
+
+// schemaModels are the models AutoMigrate creates and updates tables for
+var schemaModels = []interface{}{&SchemaMigrationModel{}, &TenantModel{}, &App{}, &NodeModel{}, &EdgeModel{}, &GraphRunModel{}, &NodeStateChangeModel{}, &AuditLogModel{}}
+
+// AutoMigrate migrates db to LatestSchemaVersion, like Migrate
 func AutoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(&App{}, &NodeModel{}, &EdgeModel{}, &GraphRunModel{})
+	_, err := Migrate(db)
+	return err
+}
+
+// SchemaProblems lists the tables and columns AutoMigrate would add to db,
+// e.g. "table graph_runs is missing". None are returned for databases
+// migrated by this version.
+func SchemaProblems(db *gorm.DB) ([]string, error) {
+	migrator := db.Migrator()
+	var problems []string
+	for _, model := range schemaModels {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, fmt.Errorf("failed to parse model %T: %w", model, err)
+		}
+		if !migrator.HasTable(model) {
+			problems = append(problems, fmt.Sprintf("table %s is missing", stmt.Schema.Table))
+			continue
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" || field.IgnoreMigration {
+				continue
+			}
+			if !migrator.HasColumn(model, field.DBName) {
+				problems = append(problems, fmt.Sprintf("column %s.%s is missing", stmt.Schema.Table, field.DBName))
+			}
+		}
+	}
+	return problems, nil
 }
\ No newline at end of file
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestMySQLDSN(t *testing.T) {
+	dsn := mysqlDSN(Config{
+		Type:     DatabaseTypeMySQL,
+		Host:     "db.internal",
+		User:     "graph",
+		Password: "p@ss:word",
+		DBName:   "idp",
+	})
+	assert.Equal(t, "graph:p@ss:word@tcp(db.internal:3306)/idp?parseTime=true&charset=utf8mb4", dsn)
+
+	dsn = mysqlDSN(Config{Type: DatabaseTypeMySQL, Host: "::1", Port: 3307, User: "graph", DBName: "idp"})
+	assert.Contains(t, dsn, "tcp([::1]:3307)")
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	assert.Equal(t, "graph.db?_busy_timeout=5000&_txlock=immediate", sqliteDSN("graph.db"))
+	assert.Equal(t, "file:graph.db?mode=ro&_busy_timeout=5000&_txlock=immediate", sqliteDSN("file:graph.db?mode=ro"))
+}
+
+func TestConfig_ServerPort(t *testing.T) {
+	tests := []struct {
+		config Config
+		want   int
+	}{
+		{Config{Type: DatabaseTypePostgres}, 5432},
+		{Config{Type: DatabaseTypeMySQL}, 3306},
+		{Config{Type: DatabaseTypeSQLite}, 0},
+		{Config{Type: DatabaseTypePostgres, Port: 6432}, 6432},
+		{Config{Type: DatabaseTypeMySQL, Port: 3307}, 3307},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.config.ServerPort(), "%s port %d", tt.config.Type, tt.config.Port)
+	}
+}
+
+// TestMySQL_Migrations runs the migrations and a save/load round trip against
+// the MySQL or MariaDB server in GRAPH_TEST_MYSQL_DSN, e.g.
+// "root:root@tcp(127.0.0.1:3306)/graph?parseTime=true"
+func TestMySQL_Migrations(t *testing.T) {
+	dsn := os.Getenv("GRAPH_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("GRAPH_TEST_MYSQL_DSN not set")
+	}
+
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, AutoMigrate(db))
+	require.NoError(t, AutoMigrate(db), "migrations are idempotent")
+
+	repo := NewRepository(db)
+	t.Cleanup(func() {
+		_ = repo.DeleteApp("mysql-app", DeleteOptions{})
+	})
+
+	require.NoError(t, repo.SaveGraph("mysql-app", createTestGraph("mysql-app")))
+	loaded, err := repo.LoadGraph("mysql-app")
+	require.NoError(t, err)
+	assert.Len(t, loaded.Nodes, 4)
+	assert.Len(t, loaded.Edges, 3)
+
+	run, err := repo.CreateGraphRun("mysql-app", 1)
+	require.NoError(t, err)
+	require.NoError(t, repo.SetGraphRunExecutionPlan(run.ID, `{"status":"completed"}`))
+}
+
+func TestNewConnection_PoolAndHealthCheck(t *testing.T) {
+	db, err := NewConnection(Config{
+		Type:            DatabaseTypeSQLite,
+		DBName:          filepath.Join(t.TempDir(), "graph.db"),
+		MaxOpenConns:    3,
+		MaxIdleConns:    2,
+		ConnMaxLifetime: time.Minute,
+	})
+	require.NoError(t, err)
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	assert.Equal(t, 3, sqlDB.Stats().MaxOpenConnections)
+
+	require.NoError(t, Ping(context.Background(), db))
+	status := HealthCheck(context.Background(), db)
+	assert.True(t, status.Healthy)
+	assert.Empty(t, status.Error)
+	assert.GreaterOrEqual(t, status.OpenConnections, 1)
+
+	require.NoError(t, sqlDB.Close())
+	status = HealthCheck(context.Background(), db)
+	assert.False(t, status.Healthy)
+	assert.NotEmpty(t, status.Error)
+}
+
+func TestSchemaProblems(t *testing.T) {
+	db, err := NewSQLiteConnection(filepath.Join(t.TempDir(), "graph.db"))
+	require.NoError(t, err)
+
+	problems, err := SchemaProblems(db)
+	require.NoError(t, err)
+	assert.Contains(t, problems, "table graph_apps is missing")
+	assert.Len(t, problems, len(schemaModels))
+
+	require.NoError(t, AutoMigrate(db))
+	problems, err = SchemaProblems(db)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+
+	require.NoError(t, db.Migrator().DropColumn(&GraphRunModel{}, "claimed_by"))
+	problems, err = SchemaProblems(db)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"column graph_runs.claimed_by is missing"}, problems)
+}
+
+// legacyGraphTables are graph_nodes and graph_edges as created before node
+// and edge IDs were unique per app
+var legacyGraphTables = []string{
+	"CREATE TABLE `graph_nodes` (`id` text,`tenant_id` char(36) NOT NULL DEFAULT \"00000000-0000-0000-0000-000000000000\",`app_id` char(36) NOT NULL,`type` varchar(50) NOT NULL,`name` text NOT NULL,`description` text,`state` varchar(50) NOT NULL DEFAULT \"waiting\",`properties` text,`created_at` datetime,`updated_at` datetime,`started_at` datetime,`completed_at` datetime,`duration_ms` integer NOT NULL DEFAULT 0,`deleted_at` datetime,PRIMARY KEY (`id`),CONSTRAINT `fk_graph_apps_nodes` FOREIGN KEY (`app_id`) REFERENCES `graph_apps`(`id`) ON DELETE CASCADE)",
+	"CREATE INDEX `idx_graph_nodes_app_id` ON `graph_nodes`(`app_id`)",
+	"CREATE INDEX `idx_graph_nodes_state` ON `graph_nodes`(`state`)",
+	"CREATE TABLE `graph_edges` (`id` text,`tenant_id` char(36) NOT NULL DEFAULT \"00000000-0000-0000-0000-000000000000\",`app_id` char(36) NOT NULL,`from_node_id` text NOT NULL,`to_node_id` text NOT NULL,`type` varchar(50) NOT NULL,`description` text,`properties` text,`created_at` datetime,`deleted_at` datetime,PRIMARY KEY (`id`),CONSTRAINT `fk_graph_edges_to_node` FOREIGN KEY (`to_node_id`) REFERENCES `graph_nodes`(`id`) ON DELETE CASCADE,CONSTRAINT `fk_graph_apps_edges` FOREIGN KEY (`app_id`) REFERENCES `graph_apps`(`id`) ON DELETE CASCADE,CONSTRAINT `fk_graph_edges_from_node` FOREIGN KEY (`from_node_id`) REFERENCES `graph_nodes`(`id`) ON DELETE CASCADE)",
+	"CREATE INDEX `idx_graph_edges_app_id` ON `graph_edges`(`app_id`)",
+}
+
+func TestAutoMigrate_KeysLegacyNodesAndEdgesByApp(t *testing.T) {
+	repo, db := newTestRepository(t)
+	require.NoError(t, db.Migrator().DropTable(&EdgeModel{}, &NodeModel{}, &SchemaMigrationModel{}))
+	for _, statement := range legacyGraphTables {
+		require.NoError(t, db.Exec(statement).Error)
+	}
+	require.NoError(t, repo.SaveGraph("shop", createTestGraph("x")))
+	require.NoError(t, repo.UpdateNodeState("shop", "x-db", "failed"))
+
+	require.NoError(t, AutoMigrate(db))
+	require.NoError(t, AutoMigrate(db), "migrations are idempotent")
+
+	legacy, err := hasLegacyKey(db, &EdgeModel{})
+	require.NoError(t, err)
+	assert.False(t, legacy)
+	assert.False(t, db.Migrator().HasTable("graph_nodes_legacy"))
+	assert.True(t, db.Migrator().HasIndex(&NodeModel{}, "idx_graph_nodes_state"))
+
+	loaded, err := repo.LoadGraph("shop")
+	require.NoError(t, err)
+	assert.Len(t, loaded.Nodes, 4)
+	assert.Len(t, loaded.Edges, 3)
+	assert.Equal(t, "failed", string(loaded.Nodes["x-db"].State))
+	require.NoError(t, repo.SaveGraph("blog", createTestGraph("x")), "the IDs are free for other apps")
+}
+
+func TestMigrate_RecordsVersions(t *testing.T) {
+	db, err := NewSQLiteConnection(filepath.Join(t.TempDir(), "graph.db"))
+	require.NoError(t, err)
+
+	version, err := SchemaVersion(db)
+	require.NoError(t, err)
+	assert.Zero(t, version)
+
+	applied, err := Migrate(db)
+	require.NoError(t, err)
+	require.Len(t, applied, len(migrations))
+	assert.Equal(t, 1, applied[0].Version)
+	version, err = SchemaVersion(db)
+	require.NoError(t, err)
+	assert.Equal(t, LatestSchemaVersion(), version)
+
+	applied, err = Migrate(db)
+	require.NoError(t, err)
+	assert.Empty(t, applied, "migrated databases are left alone")
+
+	// Databases migrated before the last migration only get the rest
+	require.NoError(t, db.Where("version = ?", LatestSchemaVersion()).Delete(&SchemaMigrationModel{}).Error)
+	applied, err = Migrate(db)
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	assert.Equal(t, LatestSchemaVersion(), applied[0].Version)
+
+	var recorded []SchemaMigrationModel
+	require.NoError(t, db.Order("version").Find(&recorded).Error)
+	require.Len(t, recorded, len(migrations))
+	for i, migration := range migrations {
+		assert.Equal(t, migration.Version, recorded[i].Version)
+		assert.Equal(t, migration.Name, recorded[i].Name)
+	}
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// encryptedPrefix marks property values written by AESGCMCodec. The key ID
+// and the base64 encoded nonce and ciphertext follow, separated by colons.
+const encryptedPrefix = "enc:v1:"
+
+// PropertyCodec transforms node properties before they are persisted and
+// after they are loaded
+type PropertyCodec interface {
+	Encode(properties map[string]interface{}) (map[string]interface{}, error)
+	Decode(properties map[string]interface{}) (map[string]interface{}, error)
+}
+
+// KeyProvider supplies AES keys (16, 24 or 32 bytes) to AESGCMCodec. New
+// values are encrypted with the current key; older values are decrypted with
+// the key they were written with, which allows key rotation.
+type KeyProvider interface {
+	CurrentKey() (keyID string, key []byte, err error)
+	Key(keyID string) ([]byte, error)
+}
+
+// StaticKeyProvider serves a single key
+type StaticKeyProvider struct {
+	keyID string
+	key   []byte
+}
+
+// NewStaticKeyProvider creates a key provider for one key
+func NewStaticKeyProvider(keyID string, key []byte) *StaticKeyProvider {
+	return &StaticKeyProvider{keyID: keyID, key: key}
+}
+
+func (p *StaticKeyProvider) CurrentKey() (string, []byte, error) {
+	return p.keyID, p.key, nil
+}
+
+func (p *StaticKeyProvider) Key(keyID string) ([]byte, error) {
+	if keyID != p.keyID {
+		return nil, fmt.Errorf("unknown encryption key %s", keyID)
+	}
+	return p.key, nil
+}
+
+// AESGCMCodec encrypts the values of selected property keys with AES-GCM.
+// Values of any JSON type are supported and restored with their type.
+type AESGCMCodec struct {
+	keys      KeyProvider
+	encrypted map[string]bool
+}
+
+// NewAESGCMCodec creates a codec that encrypts the given property keys
+func NewAESGCMCodec(keys KeyProvider, propertyKeys ...string) *AESGCMCodec {
+	encrypted := make(map[string]bool, len(propertyKeys))
+	for _, key := range propertyKeys {
+		encrypted[key] = true
+	}
+	return &AESGCMCodec{keys: keys, encrypted: encrypted}
+}
+
+// Encode returns a copy of properties with the selected keys encrypted
+func (c *AESGCMCodec) Encode(properties map[string]interface{}) (map[string]interface{}, error) {
+	if properties == nil {
+		return nil, nil
+	}
+
+	encoded := make(map[string]interface{}, len(properties))
+	for key, value := range properties {
+		if !c.encrypted[key] {
+			encoded[key] = value
+			continue
+		}
+		sealed, err := c.seal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt property %s: %w", key, err)
+		}
+		encoded[key] = sealed
+	}
+	return encoded, nil
+}
+
+// Decode returns a copy of properties with all encrypted values decrypted,
+// including values of keys that are no longer configured for encryption
+func (c *AESGCMCodec) Decode(properties map[string]interface{}) (map[string]interface{}, error) {
+	if properties == nil {
+		return nil, nil
+	}
+
+	decoded := make(map[string]interface{}, len(properties))
+	for key, value := range properties {
+		sealed, ok := value.(string)
+		if !ok || !strings.HasPrefix(sealed, encryptedPrefix) {
+			decoded[key] = value
+			continue
+		}
+		opened, err := c.open(sealed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt property %s: %w", key, err)
+		}
+		decoded[key] = opened
+	}
+	return decoded, nil
+}
+
+func (c *AESGCMCodec) seal(value interface{}) (string, error) {
+	keyID, key, err := c.keys.CurrentKey()
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(keyID, ":") {
+		return "", fmt.Errorf("key ID %q must not contain ':'", keyID)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, []byte(keyID))
+
+	return encryptedPrefix + keyID + ":" + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+func (c *AESGCMCodec) open(sealed string) (interface{}, error) {
+	keyID, payload, found := strings.Cut(strings.TrimPrefix(sealed, encryptedPrefix), ":")
+	if !found {
+		return nil, fmt.Errorf("malformed encrypted value")
+	}
+	key, err := c.keys.Key(keyID)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("malformed encrypted value")
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(keyID))
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(plaintext, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
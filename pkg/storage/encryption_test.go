@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rotatingKeyProvider encrypts with the newest key and decrypts with any
+type rotatingKeyProvider struct {
+	current string
+	keys    map[string][]byte
+}
+
+func (p *rotatingKeyProvider) CurrentKey() (string, []byte, error) {
+	return p.current, p.keys[p.current], nil
+}
+
+func (p *rotatingKeyProvider) Key(keyID string) ([]byte, error) {
+	return NewStaticKeyProvider(keyID, p.keys[keyID]).Key(keyID)
+}
+
+func TestAESGCMCodec_RoundTrip(t *testing.T) {
+	codec := NewAESGCMCodec(NewStaticKeyProvider("k1", bytes.Repeat([]byte{1}, 32)), "password", "config")
+
+	properties := map[string]interface{}{
+		"password": "s3cret",
+		"config":   map[string]interface{}{"port": float64(5432)},
+		"region":   "eu-west-1",
+	}
+
+	encoded, err := codec.Encode(properties)
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", encoded["region"])
+	assert.True(t, strings.HasPrefix(encoded["password"].(string), "enc:v1:k1:"))
+	assert.NotContains(t, encoded["password"], "s3cret")
+
+	decoded, err := codec.Decode(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, properties, decoded)
+
+	tampered := map[string]interface{}{"password": encoded["password"].(string)[:len(encoded["password"].(string))-4] + "AAAA"}
+	_, err = codec.Decode(tampered)
+	assert.Error(t, err)
+}
+
+func TestAESGCMCodec_KeyRotation(t *testing.T) {
+	keys := &rotatingKeyProvider{
+		current: "old",
+		keys: map[string][]byte{
+			"old": bytes.Repeat([]byte{1}, 32),
+			"new": bytes.Repeat([]byte{2}, 32),
+		},
+	}
+	codec := NewAESGCMCodec(keys, "token")
+
+	oldValue, err := codec.Encode(map[string]interface{}{"token": "abc"})
+	require.NoError(t, err)
+
+	keys.current = "new"
+	newValue, err := codec.Encode(map[string]interface{}{"token": "abc"})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(newValue["token"].(string), "enc:v1:new:"))
+
+	for _, encoded := range []map[string]interface{}{oldValue, newValue} {
+		decoded, err := codec.Decode(encoded)
+		require.NoError(t, err)
+		assert.Equal(t, "abc", decoded["token"])
+	}
+
+	delete(keys.keys, "old")
+	_, err = codec.Decode(oldValue)
+	assert.Error(t, err, "values of removed keys cannot be decrypted")
+}
+
+func TestRepository_EncryptedProperties(t *testing.T) {
+	db, err := NewSQLiteConnection(filepath.Join(t.TempDir(), "graph.db"))
+	require.NoError(t, err)
+	require.NoError(t, AutoMigrate(db))
+
+	opts := DefaultOptions()
+	opts.PropertyCodec = NewAESGCMCodec(NewStaticKeyProvider("k1", bytes.Repeat([]byte{7}, 32)), "connection_string")
+	repo := NewRepositoryWithOptions(db, opts)
+
+	g := createTestGraph("app")
+	g.Nodes["app-db"].Properties = map[string]interface{}{
+		"connection_string": "postgres://admin:hunter2@db/app",
+		"engine":            "postgres",
+	}
+	require.NoError(t, repo.SaveGraph("app", g))
+
+	var stored NodeModel
+	require.NoError(t, db.Where("id = ?", "app-db").First(&stored).Error)
+	assert.NotContains(t, stored.Properties, "hunter2")
+	assert.Contains(t, stored.Properties, `"engine":"postgres"`)
+
+	loaded, err := repo.LoadGraph("app")
+	require.NoError(t, err)
+	assert.Equal(t, g.Nodes["app-db"].Properties, loaded.Nodes["app-db"].Properties)
+
+	require.NoError(t, repo.SaveGraph("app", loaded))
+	var resaved NodeModel
+	require.NoError(t, db.Where("id = ?", "app-db").First(&resaved).Error)
+	assert.Equal(t, stored.Properties, resaved.Properties, "unchanged encrypted nodes are not rewritten")
+
+	loaded.Nodes["app-db"].Properties["engine"] = "mysql"
+	loaded.Nodes["app-db"].State = graph.NodeStateRunning
+	require.NoError(t, repo.SaveGraph("app", loaded))
+	reloaded, err := repo.LoadGraph("app")
+	require.NoError(t, err)
+	assert.Equal(t, "mysql", reloaded.Nodes["app-db"].Properties["engine"])
+	assert.Equal(t, "postgres://admin:hunter2@db/app", reloaded.Nodes["app-db"].Properties["connection_string"])
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RecordNodeStateChange appends a state transition to the node's history
+// without touching the stored node state. Execution engines use it to log
+// transitions that happen during a run.
+func (r *Repository) RecordNodeStateChange(appName, nodeID string, oldState, newState graph.NodeState, runID *uuid.UUID) error {
+	app, err := r.findApp(r.db, appName)
+	if err != nil {
+		return err
+	}
+	return recordStateChange(r.db, app.ID, nodeID, oldState, newState, runID, time.Now())
+}
+
+// GetNodeStateHistory returns all recorded state transitions of a node,
+// oldest first
+func (r *Repository) GetNodeStateHistory(appName, nodeID string) ([]NodeStateChangeModel, error) {
+	app, err := r.findApp(r.db, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []NodeStateChangeModel
+	err = r.db.Where("app_id = ? AND node_id = ?", app.ID, nodeID).
+		Order("changed_at ASC").
+		Find(&changes).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load node state history: %w", err)
+	}
+
+	return changes, nil
+}
+
+// GetAppStateTimeline returns the state transitions of all nodes of an app
+// within [from, to), oldest first. Zero times leave the range open.
+func (r *Repository) GetAppStateTimeline(appName string, from, to time.Time) ([]NodeStateChangeModel, error) {
+	app, err := r.findApp(r.db, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	query := r.db.Where("app_id = ?", app.ID)
+	if !from.IsZero() {
+		query = query.Where("changed_at >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("changed_at < ?", to)
+	}
+
+	var changes []NodeStateChangeModel
+	if err := query.Order("changed_at ASC").Find(&changes).Error; err != nil {
+		return nil, fmt.Errorf("failed to load state timeline: %w", err)
+	}
+
+	return changes, nil
+}
+
+// GetStateChangesAfter returns up to limit state transitions of the apps of
+// every tenant recorded after the transition (changedAt, id), ordered by
+// changed_at and id, with their apps loaded; with uuid.Nil the transitions
+// at changedAt are included. Like ClaimGraphRun it ignores the tenant the
+// repository is scoped to, so that one reader follows the changes recorded
+// by all replicas sharing the database, e.g. an events.StatePoller.
+func (r *Repository) GetStateChangesAfter(changedAt time.Time, id uuid.UUID, limit int) ([]NodeStateChangeModel, error) {
+	var changes []NodeStateChangeModel
+	err := r.db.Preload("App", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}).
+		Where("changed_at > ? OR (changed_at = ? AND id > ?)", changedAt, changedAt, id).
+		Order("changed_at ASC, id ASC").
+		Limit(limit).
+		Find(&changes).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state changes: %w", err)
+	}
+	return changes, nil
+}
+
+// MeanTimeToRecovery returns the average time between a node entering the
+// failed state and its next successful state in the given history. It
+// returns zero when the history contains no recovered failure.
+func MeanTimeToRecovery(changes []NodeStateChangeModel) time.Duration {
+	var total time.Duration
+	var recoveries int
+	var failedAt *time.Time
+
+	for i := range changes {
+		switch graph.NodeState(changes[i].NewState) {
+		case graph.NodeStateFailed:
+			if failedAt == nil {
+				failedAt = &changes[i].ChangedAt
+			}
+		case graph.NodeStateSucceeded:
+			if failedAt != nil {
+				total += changes[i].ChangedAt.Sub(*failedAt)
+				recoveries++
+				failedAt = nil
+			}
+		}
+	}
+
+	if recoveries == 0 {
+		return 0
+	}
+	return total / time.Duration(recoveries)
+}
+
+func recordStateChange(db *gorm.DB, appID uuid.UUID, nodeID string, oldState, newState graph.NodeState, runID *uuid.UUID, at time.Time) error {
+	change := &NodeStateChangeModel{
+		AppID:     appID,
+		NodeID:    nodeID,
+		OldState:  string(oldState),
+		NewState:  string(newState),
+		RunID:     runID,
+		ChangedAt: at,
+	}
+	if err := db.Omit("App").Create(change).Error; err != nil {
+		return fmt.Errorf("failed to record state change: %w", err)
+	}
+	return nil
+}
@@ -1,16 +1,120 @@
 package storage
 
 import (
+	"context"
+	"io"
+	"time"
+
 	"github.com/philipsahli/innominatus-graph/pkg/graph"
 
 	"github.com/google/uuid"
 )
 
-type RepositoryInterface interface {
+// DeleteOptions controls how DeleteApp removes an app
+type DeleteOptions struct {
+	// Soft marks the app as deleted instead of removing its rows
+	Soft bool
+}
+
+// AppFilter narrows the result of ListApps
+type AppFilter struct {
+	// NameContains matches apps whose name contains the given substring
+	NameContains string
+	// Owner and Team match apps with exactly the given owner or team
+	Owner string
+	Team  string
+}
+
+// RunSort is a column ListGraphRuns orders runs by
+type RunSort string
+
+const (
+	RunSortStartedAt   RunSort = "started_at"
+	RunSortCompletedAt RunSort = "completed_at"
+	RunSortStatus      RunSort = "status"
+	RunSortVersion     RunSort = "version"
+)
+
+// RunFilter narrows, orders and pages the result of ListGraphRuns. Zero
+// values match all runs, newest first.
+type RunFilter struct {
+	// Statuses matches runs with one of the given statuses
+	Statuses []string
+	// StartedFrom and StartedTo match runs started at or after StartedFrom
+	// and before StartedTo
+	StartedFrom time.Time
+	StartedTo   time.Time
+	// SortBy defaults to RunSortStartedAt; Ascending reverses the default
+	// descending order
+	SortBy    RunSort
+	Ascending bool
+	// Limit <= 0 returns all matching runs after Offset
+	Limit  int
+	Offset int
+}
+
+// GraphStore persists the graphs of apps. It is the minimum a storage
+// backend has to implement to serve graphs.
+type GraphStore interface {
 	SaveGraph(appName string, g *graph.Graph) error
 	LoadGraph(appName string) (*graph.Graph, error)
+	LoadSubgraph(appName string, nodeIDs []string, withClosure bool) (*graph.Graph, error)
+	LoadGraphSummary(appName string) (*GraphSummary, error)
+	GetNodesByState(appName string, state graph.NodeState) ([]*graph.Node, error)
+	GetNodesByType(appName string, nodeType graph.NodeType) ([]*graph.Node, error)
+	DeleteGraph(appName string) error
+	ListApps(filter AppFilter, limit, offset int) ([]AppSummary, error)
+}
+
+// RunStore persists graph runs and their execution plans
+type RunStore interface {
 	CreateGraphRun(appName string, version int) (*GraphRunModel, error)
 	UpdateGraphRun(runID uuid.UUID, status string, errorMessage *string) error
+	FailGraphRun(runID uuid.UUID, errorMessage string, failedNodeIDs []string) error
+	SetRunStartedAt(runID uuid.UUID, startedAt time.Time) error
+	GetGraphRun(runID uuid.UUID) (*GraphRunModel, error)
 	GetGraphRuns(appName string) ([]GraphRunModel, error)
+	SetGraphRunExecutionPlan(runID uuid.UUID, planJSON string) error
+}
+
+// StateStore persists node states and their history
+type StateStore interface {
 	UpdateNodeState(appName string, nodeID string, state graph.NodeState) error
+	UpdateNodeStates(appName string, states map[string]graph.NodeState) (map[string]error, error)
+	RecordNodeStateChange(appName, nodeID string, oldState, newState graph.NodeState, runID *uuid.UUID) error
+	GetNodeStateHistory(appName, nodeID string) ([]NodeStateChangeModel, error)
+}
+
+// TenantScoper is implemented by stores that partition data by tenant
+type TenantScoper interface {
+	ForTenant(ctx context.Context) RepositoryInterface
+}
+
+// RepositoryInterface is the full feature set of the SQL Repository. Code
+// that only needs part of it should depend on GraphStore, RunStore or
+// StateStore so that alternative backends can be plugged in.
+type RepositoryInterface interface {
+	GraphStore
+	RunStore
+	StateStore
+	TenantScoper
+	RunQueue
+	RunCanceller
+
+	DeleteApp(appName string, opts DeleteOptions) error
+	RestoreApp(appName string) error
+	RestoreNode(appName, nodeID string) error
+	PurgeDeleted(olderThan time.Duration) (int64, error)
+	DumpApp(appName string, w io.Writer) error
+	RestoreAppSnapshot(r io.Reader) (string, error)
+	GetAppMetadata(appName string) (*graph.AppMetadata, error)
+	SetAppMetadata(appName string, metadata graph.AppMetadata) error
+	SetAppAnnotation(appName, key, value string) error
+	GetRunNodeExecutions(runID uuid.UUID) ([]NodeExecutionRecord, error)
+	GetRecentRunsWithNodes(appName string, limit int) ([]RunWithNodes, error)
+	ListGraphRuns(appName string, filter RunFilter) ([]GraphRunModel, int64, error)
+	PruneGraphRuns(appName string, olderThan time.Duration, keepLast int) (int64, error)
+	CreateTenant(name string) (*TenantModel, error)
+	ListTenants() ([]TenantModel, error)
+	GetAuditLog(filter AuditFilter) ([]AuditLogModel, error)
 }
@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// slowQueryThreshold is the duration after which a query is logged as slow
+const slowQueryThreshold = 200 * time.Millisecond
+
+// Options configures connections and repositories
+type Options struct {
+	// Logger receives all storage logs. Defaults to slog.Default().
+	Logger *slog.Logger
+	// LogLevel is the minimum level that is logged. SQL statements are logged
+	// at debug, slow queries at warn and failed queries at error.
+	// DefaultOptions uses slog.LevelWarn.
+	LogLevel slog.Level
+	// PropertyCodec, if set, encodes node properties before they are stored
+	// and decodes them on load, e.g. an AESGCMCodec encrypting credentials.
+	// Only used by repositories.
+	PropertyCodec PropertyCodec
+}
+
+// DefaultOptions returns the options used by NewConnection and NewRepository
+func DefaultOptions() Options {
+	return Options{
+		Logger:   slog.Default(),
+		LogLevel: slog.LevelWarn,
+	}
+}
+
+// logger returns the configured logger filtered to LogLevel
+func (o Options) logger() *slog.Logger {
+	base := o.Logger
+	if base == nil {
+		base = slog.Default()
+	}
+	return slog.New(&levelHandler{level: o.LogLevel, handler: base.Handler()})
+}
+
+// levelHandler drops records below level before they reach handler
+type levelHandler struct {
+	level   slog.Level
+	handler slog.Handler
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && h.handler.Enabled(ctx, level)
+}
+
+func (h *levelHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.handler.Handle(ctx, record)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{level: h.level, handler: h.handler.WithAttrs(attrs)}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{level: h.level, handler: h.handler.WithGroup(name)}
+}
+
+// gormLogger adapts an slog.Logger to GORM's logger interface
+type gormLogger struct {
+	logger *slog.Logger
+	level  slog.Level
+}
+
+func newGormLogger(opts Options) *gormLogger {
+	return &gormLogger{logger: opts.logger(), level: opts.LogLevel}
+}
+
+// LogMode maps GORM log levels onto slog levels
+func (l *gormLogger) LogMode(level logger.LogLevel) logger.Interface {
+	clone := *l
+	switch level {
+	case logger.Silent:
+		clone.level = slog.LevelError + 1
+	case logger.Error:
+		clone.level = slog.LevelError
+	case logger.Warn:
+		clone.level = slog.LevelWarn
+	case logger.Info:
+		clone.level = slog.LevelDebug
+	}
+	return &clone
+}
+
+func (l *gormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	l.log(ctx, slog.LevelInfo, fmt.Sprintf(msg, args...))
+}
+
+func (l *gormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	l.log(ctx, slog.LevelWarn, fmt.Sprintf(msg, args...))
+}
+
+func (l *gormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	l.log(ctx, slog.LevelError, fmt.Sprintf(msg, args...))
+}
+
+// Trace logs a finished SQL statement. Missing records are not errors for
+// the repository, so they are logged like any other statement.
+func (l *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+
+	level := slog.LevelDebug
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		level = slog.LevelError
+	case elapsed > slowQueryThreshold:
+		level = slog.LevelWarn
+	}
+	if level < l.level {
+		return
+	}
+
+	sql, rows := fc()
+	attrs := []any{
+		slog.String("sql", sql),
+		slog.Int64("rows", rows),
+		slog.Duration("elapsed", elapsed),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+
+	msg := "query"
+	if level == slog.LevelWarn {
+		msg = "slow query"
+	} else if level == slog.LevelError {
+		msg = "query failed"
+	}
+	l.logger.Log(ctx, level, msg, attrs...)
+}
+
+func (l *gormLogger) log(ctx context.Context, level slog.Level, msg string) {
+	if level < l.level {
+		return
+	}
+	l.logger.Log(ctx, level, msg)
+}
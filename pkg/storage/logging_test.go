@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"bytes"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptions_LogLevel(t *testing.T) {
+	var buf bytes.Buffer
+	opts := Options{
+		Logger:   slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		LogLevel: slog.LevelWarn,
+	}
+
+	db, err := NewConnectionWithOptions(Config{Type: DatabaseTypeSQLite, DBName: filepath.Join(t.TempDir(), "graph.db")}, opts)
+	require.NoError(t, err)
+	require.NoError(t, AutoMigrate(db))
+
+	repo := NewRepositoryWithOptions(db, opts)
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+	assert.Empty(t, buf.String(), "queries and debug messages are below the configured level")
+
+	_, err = repo.GetGraphRuns("missing")
+	require.Error(t, err)
+	assert.Empty(t, buf.String(), "missing records are not logged as errors")
+
+	require.Error(t, db.Exec("SELECT * FROM no_such_table").Error)
+	assert.Contains(t, buf.String(), `"msg":"query failed"`)
+	assert.Contains(t, buf.String(), "no_such_table")
+
+	buf.Reset()
+	opts.LogLevel = slog.LevelDebug
+	repo = NewRepositoryWithOptions(db, opts)
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+	assert.Contains(t, buf.String(), `"msg":"graph saved"`)
+	assert.Contains(t, buf.String(), `"nodes_written":0`)
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"gorm.io/gorm"
+)
+
+// GetAppMetadata returns the description, ownership, links and annotations
+// of an app
+func (r *Repository) GetAppMetadata(appName string) (*graph.AppMetadata, error) {
+	app, err := r.findApp(r.db, appName)
+	if err != nil {
+		return nil, err
+	}
+	return appMetadata(app)
+}
+
+// SetAppMetadata replaces the description, ownership, links and annotations
+// of an app
+func (r *Repository) SetAppMetadata(appName string, metadata graph.AppMetadata) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		app, err := r.findApp(tx, appName)
+		if err != nil {
+			return err
+		}
+		if err := saveAppMetadata(tx, app, &metadata); err != nil {
+			return err
+		}
+		return r.audit(tx, AuditActionSetAppMetadata, appName, "", map[string]interface{}{
+			"owner": metadata.Owner,
+			"team":  metadata.Team,
+		})
+	})
+}
+
+// SetAppAnnotation sets a single annotation of an app, keeping the others.
+// An empty value removes the annotation.
+func (r *Repository) SetAppAnnotation(appName, key, value string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		app, err := r.findApp(tx, appName)
+		if err != nil {
+			return err
+		}
+		metadata, err := appMetadata(app)
+		if err != nil {
+			return err
+		}
+
+		if metadata.Annotations == nil {
+			metadata.Annotations = make(map[string]string)
+		}
+		if value == "" {
+			delete(metadata.Annotations, key)
+		} else {
+			metadata.Annotations[key] = value
+		}
+
+		if err := saveAppMetadata(tx, app, metadata); err != nil {
+			return err
+		}
+		return r.audit(tx, AuditActionSetAppMetadata, appName, "", map[string]interface{}{
+			"annotation": key,
+			"value":      value,
+		})
+	})
+}
+
+// appMetadata decodes the metadata columns of an app
+func appMetadata(app *App) (*graph.AppMetadata, error) {
+	metadata := &graph.AppMetadata{
+		Description: app.Description,
+		Owner:       app.Owner,
+		Team:        app.Team,
+	}
+	if app.Links != "" {
+		if err := json.Unmarshal([]byte(app.Links), &metadata.Links); err != nil {
+			return nil, fmt.Errorf("failed to decode links of app %s: %w", app.Name, err)
+		}
+	}
+	if app.Annotations != "" {
+		if err := json.Unmarshal([]byte(app.Annotations), &metadata.Annotations); err != nil {
+			return nil, fmt.Errorf("failed to decode annotations of app %s: %w", app.Name, err)
+		}
+	}
+	return metadata, nil
+}
+
+// saveAppMetadata writes metadata to the metadata columns of app
+func saveAppMetadata(db *gorm.DB, app *App, metadata *graph.AppMetadata) error {
+	links, err := encodeStringMap(metadata.Links)
+	if err != nil {
+		return fmt.Errorf("failed to encode links: %w", err)
+	}
+	annotations, err := encodeStringMap(metadata.Annotations)
+	if err != nil {
+		return fmt.Errorf("failed to encode annotations: %w", err)
+	}
+
+	err = db.Model(app).Select("description", "owner", "team", "links", "annotations").Updates(App{
+		Description: metadata.Description,
+		Owner:       metadata.Owner,
+		Team:        metadata.Team,
+		Links:       links,
+		Annotations: annotations,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update app metadata: %w", err)
+	}
+	return nil
+}
+
+// encodeStringMap encodes a map as JSON, storing empty maps as ""
+func encodeStringMap(values map[string]string) (string, error) {
+	if len(values) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// cloneAppMetadata deep copies metadata, which may be nil
+func cloneAppMetadata(metadata *graph.AppMetadata) *graph.AppMetadata {
+	if metadata == nil {
+		return nil
+	}
+	clone := *metadata
+	clone.Links = maps.Clone(metadata.Links)
+	clone.Annotations = maps.Clone(metadata.Annotations)
+	return &clone
+}
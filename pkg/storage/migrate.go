@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Migration is a versioned change of the schema. Versions follow the files
+// of the migrations directory, which migrate PostgreSQL databases managed
+// by hand; databases migrated by AutoMigrate record the versions they are
+// at in the schema_migrations table.
+type Migration struct {
+	Version int
+	Name    string
+	// up makes the changes AutoMigrate cannot make from the models, like
+	// changing keys, before it runs. It is nil for migrations that only add
+	// tables, columns and indexes. It must leave migrated databases alone,
+	// as databases migrated before versions were recorded run it again.
+	up func(db *gorm.DB) error
+}
+
+var migrations = []Migration{
+	{Version: 1, Name: "create tables"},
+	{Version: 2, Name: "add node timing"},
+	{Version: 3, Name: "add tenants"},
+	{Version: 4, Name: "add soft delete"},
+	{Version: 5, Name: "add app metadata"},
+	{Version: 6, Name: "add run queue"},
+	{Version: 7, Name: "key nodes by app", up: keyNodesAndEdgesByApp},
+}
+
+// SchemaMigrationModel records a migration applied to the database
+type SchemaMigrationModel struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false" json:"version"`
+	Name      string    `gorm:"not null" json:"name"`
+	AppliedAt time.Time `gorm:"not null" json:"applied_at"`
+}
+
+func (SchemaMigrationModel) TableName() string {
+	return "schema_migrations"
+}
+
+// LatestSchemaVersion is the version AutoMigrate migrates databases to
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// SchemaVersion returns the version of the newest migration applied to db,
+// or 0 for databases migrated before versions were recorded and for empty
+// ones
+func SchemaVersion(db *gorm.DB) (int, error) {
+	if !db.Migrator().HasTable(&SchemaMigrationModel{}) {
+		return 0, nil
+	}
+	var version int
+	err := db.Model(&SchemaMigrationModel{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// Migrate applies the migrations db is missing in order, brings the tables
+// in line with the models and records the applied migrations, which it
+// returns. Migrating a migrated database changes nothing.
+func Migrate(db *gorm.DB) ([]Migration, error) {
+	if err := db.AutoMigrate(&SchemaMigrationModel{}); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, migration := range migrations {
+		if migration.Version <= version {
+			continue
+		}
+		if migration.up != nil {
+			if err := migration.up(db); err != nil {
+				return nil, fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+			}
+		}
+		pending = append(pending, migration)
+	}
+
+	if err := db.AutoMigrate(schemaModels...); err != nil {
+		return nil, err
+	}
+	if err := ensureDefaultTenant(db); err != nil {
+		return nil, err
+	}
+
+	if len(pending) > 0 {
+		now := time.Now()
+		applied := make([]SchemaMigrationModel, len(pending))
+		for i, migration := range pending {
+			applied[i] = SchemaMigrationModel{Version: migration.Version, Name: migration.Name, AppliedAt: now}
+		}
+		// Replicas starting together may both migrate; the first records
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&applied).Error; err != nil {
+			return nil, fmt.Errorf("failed to record migrations: %w", err)
+		}
+	}
+	return pending, nil
+}
+
+// keyNodesAndEdgesByApp changes the primary keys of graph_nodes and
+// graph_edges of databases created before node and edge IDs were unique per
+// app from (id) to (app_id, id), so that apps of any tenant can use the
+// same IDs. GORM's AutoMigrate does not change primary keys, so this runs
+// before it, which then adds the edge constraints referencing (app_id, id).
+// Databases already keyed by app, and empty ones, are left alone.
+func keyNodesAndEdgesByApp(db *gorm.DB) error {
+	legacy, err := hasLegacyKey(db, &NodeModel{})
+	if err != nil || !legacy {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "sqlite" {
+			return rebuildSQLiteTables(tx, &NodeModel{}, &EdgeModel{})
+		}
+
+		migrator := tx.Migrator()
+		for _, constraint := range []string{"FromNode", "ToNode"} {
+			if migrator.HasConstraint(&EdgeModel{}, constraint) {
+				if err := migrator.DropConstraint(&EdgeModel{}, constraint); err != nil {
+					return fmt.Errorf("failed to drop edge constraint %s: %w", constraint, err)
+				}
+			}
+		}
+		for _, table := range []string{"graph_nodes", "graph_edges"} {
+			var statement string
+			if tx.Dialector.Name() == "mysql" {
+				statement = "ALTER TABLE " + table + " DROP PRIMARY KEY, ADD PRIMARY KEY (app_id, id)"
+			} else {
+				statement = "ALTER TABLE " + table + " DROP CONSTRAINT " + table + "_pkey, ADD PRIMARY KEY (app_id, id)"
+			}
+			if err := tx.Exec(statement).Error; err != nil {
+				return fmt.Errorf("failed to key %s by app: %w", table, err)
+			}
+		}
+		return nil
+	})
+}
+
+// hasLegacyKey reports whether the table of model exists with a primary key
+// that does not include app_id
+func hasLegacyKey(db *gorm.DB, model interface{}) (bool, error) {
+	migrator := db.Migrator()
+	if !migrator.HasTable(model) {
+		return false, nil
+	}
+	columns, err := migrator.ColumnTypes(model)
+	if err != nil {
+		return false, fmt.Errorf("failed to read columns: %w", err)
+	}
+	for _, column := range columns {
+		if column.Name() == "app_id" {
+			primaryKey, _ := column.PrimaryKey()
+			return !primaryKey, nil
+		}
+	}
+	return false, nil
+}
+
+// rebuildSQLiteTables recreates the tables of models with their current
+// definition and copies their rows over, as SQLite cannot change the
+// primary key of a table
+func rebuildSQLiteTables(tx *gorm.DB, models ...interface{}) error {
+	tables := make([]string, len(models))
+	for i, model := range models {
+		stmt := &gorm.Statement{DB: tx}
+		if err := stmt.Parse(model); err != nil {
+			return fmt.Errorf("failed to parse model %T: %w", model, err)
+		}
+		tables[i] = stmt.Schema.Table
+
+		// Index names are global in SQLite, so the indexes of the renamed
+		// tables go before the new tables create theirs
+		var indexes []string
+		err := tx.Raw("SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", tables[i]).
+			Scan(&indexes).Error
+		if err != nil {
+			return fmt.Errorf("failed to list indexes of %s: %w", tables[i], err)
+		}
+		for _, index := range indexes {
+			if err := tx.Exec("DROP INDEX " + quoteSQLite(index)).Error; err != nil {
+				return fmt.Errorf("failed to drop index %s: %w", index, err)
+			}
+		}
+		if err := tx.Migrator().RenameTable(tables[i], tables[i]+"_legacy"); err != nil {
+			return fmt.Errorf("failed to rename %s: %w", tables[i], err)
+		}
+	}
+
+	if err := tx.AutoMigrate(models...); err != nil {
+		return fmt.Errorf("failed to create tables: %w", err)
+	}
+
+	for i, model := range models {
+		legacy := tables[i] + "_legacy"
+		legacyColumns, err := tx.Migrator().ColumnTypes(legacy)
+		if err != nil {
+			return fmt.Errorf("failed to read columns of %s: %w", legacy, err)
+		}
+		var columns string
+		for _, column := range legacyColumns {
+			if !tx.Migrator().HasColumn(model, column.Name()) {
+				continue
+			}
+			if columns != "" {
+				columns += ", "
+			}
+			columns += quoteSQLite(column.Name())
+		}
+		copyRows := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", quoteSQLite(tables[i]), columns, columns, quoteSQLite(legacy))
+		if err := tx.Exec(copyRows).Error; err != nil {
+			return fmt.Errorf("failed to copy rows of %s: %w", tables[i], err)
+		}
+	}
+	// Edges go first, their foreign keys reference the legacy nodes
+	for i := len(tables) - 1; i >= 0; i-- {
+		if err := tx.Migrator().DropTable(tables[i] + "_legacy"); err != nil {
+			return fmt.Errorf("failed to drop %s_legacy: %w", tables[i], err)
+		}
+	}
+	return nil
+}
+
+func quoteSQLite(identifier string) string {
+	return "`" + identifier + "`"
+}
@@ -1,67 +1,160 @@
 package storage
 
 import (
+	"encoding/json"
+	"fmt"
 	"time"
 
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// TenantModel is an organization or team owning a set of apps
+type TenantModel struct {
+	ID        uuid.UUID `gorm:"type:char(36);primary_key" json:"id"`
+	Name      string    `gorm:"uniqueIndex;not null" json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 type App struct {
-	ID          uuid.UUID `gorm:"type:char(36);primary_key" json:"id"`
-	Name        string    `gorm:"unique;not null" json:"name"`
-	Description string    `json:"description,omitempty"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          uuid.UUID      `gorm:"type:char(36);primary_key" json:"id"`
+	TenantID    uuid.UUID      `gorm:"type:char(36);not null;default:'00000000-0000-0000-0000-000000000000';uniqueIndex:idx_graph_apps_tenant_name" json:"tenant_id"`
+	Name        string         `gorm:"not null;uniqueIndex:idx_graph_apps_tenant_name" json:"name"`
+	Description string         `json:"description,omitempty"`
+	Owner       string         `gorm:"type:varchar(255);index" json:"owner,omitempty"`
+	Team        string         `gorm:"type:varchar(255);index" json:"team,omitempty"`
+	Links       string         `gorm:"type:text" json:"links,omitempty"`       // JSON string (text for SQLite and MySQL compatibility)
+	Annotations string         `gorm:"type:text" json:"annotations,omitempty"` // JSON string (text for SQLite and MySQL compatibility)
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+
+	Nodes     []NodeModel     `gorm:"foreignKey:AppID;constraint:OnDelete:CASCADE" json:"nodes,omitempty"`
+	Edges     []EdgeModel     `gorm:"foreignKey:AppID;constraint:OnDelete:CASCADE" json:"edges,omitempty"`
+	GraphRuns []GraphRunModel `gorm:"foreignKey:AppID;constraint:OnDelete:CASCADE" json:"graph_runs,omitempty"`
+}
 
-	Nodes      []NodeModel      `gorm:"foreignKey:AppID;constraint:OnDelete:CASCADE" json:"nodes,omitempty"`
-	Edges      []EdgeModel      `gorm:"foreignKey:AppID;constraint:OnDelete:CASCADE" json:"edges,omitempty"`
-	GraphRuns  []GraphRunModel  `gorm:"foreignKey:AppID;constraint:OnDelete:CASCADE" json:"graph_runs,omitempty"`
+// AppSummary is the catalog view of an app returned by ListApps
+type AppSummary struct {
+	ID            uuid.UUID `json:"id"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description,omitempty"`
+	Owner         string    `json:"owner,omitempty"`
+	Team          string    `json:"team,omitempty"`
+	NodeCount     int64     `json:"node_count"`
+	EdgeCount     int64     `json:"edge_count"`
+	LastRunStatus string    `json:"last_run_status,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
+// GraphSummary holds node and edge counts of an app's graph together with
+// the state of every node, without node properties or edges
+type GraphSummary struct {
+	AppName      string                     `json:"app_name"`
+	NodeCount    int64                      `json:"node_count"`
+	EdgeCount    int64                      `json:"edge_count"`
+	NodesByState map[string]int64           `json:"nodes_by_state"`
+	NodesByType  map[string]int64           `json:"nodes_by_type"`
+	NodeStates   map[string]graph.NodeState `json:"node_states"`
+}
+
+// NodeModel is a node of an app. Node IDs are unique per app, so the key is
+// (app_id, id).
 type NodeModel struct {
-	ID          string    `gorm:"primaryKey" json:"id"`
-	AppID       uuid.UUID `gorm:"type:char(36);not null;index" json:"app_id"`
-	Type        string    `gorm:"type:varchar(50);not null;index" json:"type"`
-	Name        string    `gorm:"not null" json:"name"`
-	Description string    `json:"description,omitempty"`
-	State       string    `gorm:"type:varchar(50);not null;default:'waiting';index" json:"state"`
-	Properties  string    `gorm:"type:text;default:'{}'" json:"properties"` // JSON string (text for SQLite compatibility)
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	AppID       uuid.UUID      `gorm:"type:char(36);primaryKey;not null;index" json:"app_id"`
+	ID          string         `gorm:"primaryKey" json:"id"`
+	TenantID    uuid.UUID      `gorm:"type:char(36);not null;default:'00000000-0000-0000-0000-000000000000';index" json:"tenant_id"`
+	Type        string         `gorm:"type:varchar(50);not null;index" json:"type"`
+	Name        string         `gorm:"not null" json:"name"`
+	Description string         `json:"description,omitempty"`
+	State       string         `gorm:"type:varchar(50);not null;default:'waiting';index" json:"state"`
+	Properties  string         `gorm:"type:text" json:"properties"` // JSON string (text for SQLite and MySQL compatibility)
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	StartedAt   *time.Time     `json:"started_at,omitempty"`
+	CompletedAt *time.Time     `json:"completed_at,omitempty"`
+	DurationMs  int64          `gorm:"not null;default:0" json:"duration_ms"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 
 	App App `gorm:"foreignKey:AppID;constraint:OnDelete:CASCADE" json:"-"`
 }
 
+// EdgeModel is an edge of an app, keyed by (app_id, id) like NodeModel and
+// referencing its nodes by (app_id, from_node_id) and (app_id, to_node_id)
 type EdgeModel struct {
-	ID          string    `gorm:"primaryKey" json:"id"`
-	AppID       uuid.UUID `gorm:"type:char(36);not null;index" json:"app_id"`
-	FromNodeID  string    `gorm:"not null;index" json:"from_node_id"`
-	ToNodeID    string    `gorm:"not null;index" json:"to_node_id"`
-	Type        string    `gorm:"type:varchar(50);not null;index" json:"type"`
-	Description string    `json:"description,omitempty"`
-	Properties  string    `gorm:"type:text;default:'{}'" json:"properties"` // JSON string (text for SQLite compatibility)
-	CreatedAt   time.Time `json:"created_at"`
-
-	App      App         `gorm:"foreignKey:AppID;constraint:OnDelete:CASCADE" json:"-"`
-	FromNode NodeModel   `gorm:"foreignKey:FromNodeID;constraint:OnDelete:CASCADE" json:"-"`
-	ToNode   NodeModel   `gorm:"foreignKey:ToNodeID;constraint:OnDelete:CASCADE" json:"-"`
+	AppID       uuid.UUID      `gorm:"type:char(36);primaryKey;not null;index" json:"app_id"`
+	ID          string         `gorm:"primaryKey" json:"id"`
+	TenantID    uuid.UUID      `gorm:"type:char(36);not null;default:'00000000-0000-0000-0000-000000000000';index" json:"tenant_id"`
+	FromNodeID  string         `gorm:"not null;index" json:"from_node_id"`
+	ToNodeID    string         `gorm:"not null;index" json:"to_node_id"`
+	Type        string         `gorm:"type:varchar(50);not null;index" json:"type"`
+	Description string         `json:"description,omitempty"`
+	Properties  string         `gorm:"type:text" json:"properties"` // JSON string (text for SQLite and MySQL compatibility)
+	CreatedAt   time.Time      `json:"created_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+
+	App      App       `gorm:"foreignKey:AppID;constraint:OnDelete:CASCADE" json:"-"`
+	FromNode NodeModel `gorm:"foreignKey:AppID,FromNodeID;references:AppID,ID;constraint:OnDelete:CASCADE" json:"-"`
+	ToNode   NodeModel `gorm:"foreignKey:AppID,ToNodeID;references:AppID,ID;constraint:OnDelete:CASCADE" json:"-"`
 }
 
 type GraphRunModel struct {
 	ID            uuid.UUID  `gorm:"type:char(36);primary_key" json:"id"`
+	TenantID      uuid.UUID  `gorm:"type:char(36);not null;default:'00000000-0000-0000-0000-000000000000';index" json:"tenant_id"`
 	AppID         uuid.UUID  `gorm:"type:char(36);not null;index" json:"app_id"`
 	Version       int        `gorm:"not null" json:"version"`
 	Status        string     `gorm:"type:varchar(50);not null;default:'pending';index" json:"status"`
 	StartedAt     time.Time  `json:"started_at"`
 	CompletedAt   *time.Time `json:"completed_at,omitempty"`
 	ErrorMessage  string     `json:"error_message,omitempty"`
-	ExecutionPlan string     `gorm:"type:text" json:"execution_plan,omitempty"` // JSON string (text for SQLite compatibility)
-	Metadata      string     `gorm:"type:text;default:'{}'" json:"metadata"`    // JSON string (text for SQLite compatibility)
+	ExecutionPlan string     `gorm:"type:text" json:"execution_plan,omitempty"` // JSON string (text for SQLite and MySQL compatibility)
+	Metadata      string     `gorm:"type:text" json:"metadata"`                 // JSON string (text for SQLite and MySQL compatibility)
+	// ClaimedBy is the worker of the replica executing a queued run
+	ClaimedBy string     `gorm:"type:varchar(255)" json:"claimed_by,omitempty"`
+	ClaimedAt *time.Time `json:"claimed_at,omitempty"`
+
+	App App `gorm:"foreignKey:AppID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// RunMetadata is the structured content of GraphRunModel.Metadata
+type RunMetadata struct {
+	// FailedNodeIDs lists the nodes that failed in a run recorded with FailGraphRun
+	FailedNodeIDs []string `json:"failed_node_ids,omitempty"`
+}
+
+// ParseMetadata decodes the run's metadata
+func (gr *GraphRunModel) ParseMetadata() (RunMetadata, error) {
+	var metadata RunMetadata
+	if gr.Metadata == "" {
+		return metadata, nil
+	}
+	if err := json.Unmarshal([]byte(gr.Metadata), &metadata); err != nil {
+		return metadata, fmt.Errorf("failed to decode metadata of graph run %s: %w", gr.ID, err)
+	}
+	return metadata, nil
+}
+
+// NodeStateChangeModel records a single node state transition. RunID is set
+// when the transition happened during a graph run.
+type NodeStateChangeModel struct {
+	ID        uuid.UUID  `gorm:"type:char(36);primary_key" json:"id"`
+	AppID     uuid.UUID  `gorm:"type:char(36);not null;index:idx_state_changes_node" json:"app_id"`
+	NodeID    string     `gorm:"not null;index:idx_state_changes_node" json:"node_id"`
+	OldState  string     `gorm:"type:varchar(50)" json:"old_state"`
+	NewState  string     `gorm:"type:varchar(50);not null" json:"new_state"`
+	RunID     *uuid.UUID `gorm:"type:char(36);index" json:"run_id,omitempty"`
+	ChangedAt time.Time  `gorm:"not null;index" json:"changed_at"`
 
 	App App `gorm:"foreignKey:AppID;constraint:OnDelete:CASCADE" json:"-"`
 }
 
+func (TenantModel) TableName() string {
+	return "graph_tenants"
+}
+
 func (App) TableName() string {
 	return "graph_apps"
 }
@@ -78,6 +171,10 @@ func (GraphRunModel) TableName() string {
 	return "graph_runs"
 }
 
+func (NodeStateChangeModel) TableName() string {
+	return "node_state_changes"
+}
+
 func (a *App) BeforeCreate(tx *gorm.DB) error {
 	if a.ID == uuid.Nil {
 		a.ID = uuid.New()
@@ -90,4 +187,11 @@ func (gr *GraphRunModel) BeforeCreate(tx *gorm.DB) error {
 		gr.ID = uuid.New()
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+func (sc *NodeStateChangeModel) BeforeCreate(tx *gorm.DB) error {
+	if sc.ID == uuid.Nil {
+		sc.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RunStatusQueued marks runs waiting in the run queue for a replica to
+// claim and execute them
+const RunStatusQueued = "queued"
+
+// ErrRunNotCancellable is returned by CancelGraphRun for runs that have
+// finished
+var ErrRunNotCancellable = errors.New("run is not cancellable")
+
+// RunQueue hands runs to exactly one of several server replicas sharing a
+// database, so that a run is never executed twice while every replica
+// serves reads
+type RunQueue interface {
+	// QueueGraphRun records a run of the app waiting to be claimed
+	QueueGraphRun(appName string, version int) (*GraphRunModel, error)
+	// ClaimGraphRun marks the oldest queued run of any tenant as running on
+	// worker and returns it with its app, or nil if no run is queued
+	ClaimGraphRun(worker string) (*GraphRunModel, error)
+}
+
+// RunCanceller cancels runs before they finish. Engines executing a run
+// with a store implementing it check before each node whether the run was
+// cancelled, so cancelling a run on one replica stops it on the replica
+// executing it.
+type RunCanceller interface {
+	// CancelGraphRun marks a queued or running run as failed with the
+	// error message "cancelled", followed by reason if given, or returns
+	// ErrRunNotCancellable if it has finished
+	CancelGraphRun(runID uuid.UUID, reason string) error
+	// GetGraphRunStatus returns the status of a run without loading it
+	GetGraphRunStatus(runID uuid.UUID) (string, error)
+}
+
+// QueueGraphRun records a run like CreateGraphRun, but with the status
+// RunStatusQueued
+func (r *Repository) QueueGraphRun(appName string, version int) (*GraphRunModel, error) {
+	return r.createGraphRun(appName, version, RunStatusQueued)
+}
+
+// ClaimGraphRun claims the oldest queued run of any tenant for worker. The
+// run is selected with SELECT ... FOR UPDATE SKIP LOCKED, so that replicas
+// claiming at the same time get different runs instead of waiting for each
+// other; SQLite, which has no row locks, relies on the status check of the
+// update alone. Losing a race returns nil like an empty queue.
+func (r *Repository) ClaimGraphRun(worker string) (*GraphRunModel, error) {
+	var claimed *GraphRunModel
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Select("id").Where("status = ?", RunStatusQueued).Order("started_at").Limit(1)
+		if tx.Dialector.Name() != "sqlite" {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+		var candidates []GraphRunModel
+		if err := query.Find(&candidates).Error; err != nil {
+			return fmt.Errorf("failed to find queued graph run: %w", err)
+		}
+		if len(candidates) == 0 {
+			return nil
+		}
+
+		now := time.Now()
+		result := tx.Model(&GraphRunModel{}).
+			Where("id = ? AND status = ?", candidates[0].ID, RunStatusQueued).
+			Updates(map[string]interface{}{"status": "running", "claimed_by": worker, "claimed_at": now})
+		if result.Error != nil {
+			return fmt.Errorf("failed to claim graph run: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		var run GraphRunModel
+		err := tx.Preload("App", func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped()
+		}).Where("id = ?", candidates[0].ID).First(&run).Error
+		if err != nil {
+			return fmt.Errorf("failed to load graph run: %w", err)
+		}
+		claimed = &run
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// CancelGraphRun marks a queued or running run as failed. The status is
+// checked by the update itself, so a run finishing at the same time is
+// either cancelled or reported as not cancellable, never both.
+func (r *Repository) CancelGraphRun(runID uuid.UUID, reason string) error {
+	errorMessage := "cancelled"
+	if reason != "" {
+		errorMessage += ": " + reason
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var run GraphRunModel
+		err := tx.Scopes(r.tenantScope).Preload("App", func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped()
+		}).Where("id = ?", runID).First(&run).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("graph run %s not found", runID)
+			}
+			return fmt.Errorf("failed to load graph run: %w", err)
+		}
+
+		result := tx.Model(&GraphRunModel{}).
+			Where("id = ? AND status IN ?", runID, []string{RunStatusQueued, "running"}).
+			Updates(map[string]interface{}{"status": "failed", "completed_at": time.Now(), "error_message": errorMessage})
+		if result.Error != nil {
+			return fmt.Errorf("failed to cancel graph run: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrRunNotCancellable
+		}
+
+		return r.audit(tx, AuditActionUpdateGraphRun, run.App.Name, runID.String(), map[string]interface{}{
+			"old_status":    run.Status,
+			"status":        "failed",
+			"error_message": errorMessage,
+		})
+	})
+}
+
+// GetGraphRunStatus returns the status of a run of the repository's tenant
+func (r *Repository) GetGraphRunStatus(runID uuid.UUID) (string, error) {
+	var statuses []string
+	err := r.db.Model(&GraphRunModel{}).Scopes(r.tenantScope).Where("id = ?", runID).Pluck("status", &statuses).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to load graph run status: %w", err)
+	}
+	if len(statuses) == 0 {
+		return "", fmt.Errorf("graph run %s not found", runID)
+	}
+	return statuses[0], nil
+}
@@ -2,30 +2,56 @@ package storage
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/philipsahli/innominatus-graph/pkg/graph"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository struct {
-	db *gorm.DB
+	db       *gorm.DB
+	logger   *slog.Logger
+	tenantID uuid.UUID
+	actor    string
+	codec    PropertyCodec
 }
 
 func NewRepository(db *gorm.DB) *Repository {
-	return &Repository{db: db}
+	return NewRepositoryWithOptions(db, DefaultOptions())
 }
 
+// NewRepositoryWithOptions creates a repository that logs through opts.Logger.
+// Like NewRepository it is scoped to DefaultTenantID; use ForTenant to scope
+// it to another tenant.
+func NewRepositoryWithOptions(db *gorm.DB, opts Options) *Repository {
+	return &Repository{
+		db:       db,
+		logger:   opts.logger(),
+		tenantID: DefaultTenantID,
+		actor:    SystemActor,
+		codec:    opts.PropertyCodec,
+	}
+}
+
+// SaveGraph stores g under appName, creating the app on first save. Only the
+// nodes and edges that differ from the stored graph are written.
 func (r *Repository) SaveGraph(appName string, g *graph.Graph) error {
 	return r.db.Transaction(func(tx *gorm.DB) error {
 		var app App
-		err := tx.Where("name = ?", appName).First(&app).Error
+		err := tx.Scopes(r.tenantScope).Where("name = ?", appName).First(&app).Error
 		if err != nil {
 			if err == gorm.ErrRecordNotFound {
-				app = App{Name: appName}
+				if err := tx.Unscoped().Scopes(r.tenantScope).Where("name = ?", appName).First(&App{}).Error; err == nil {
+					return fmt.Errorf("app %s is soft-deleted", appName)
+				}
+				app = App{Name: appName, TenantID: r.tenantID}
 				if err := tx.Create(&app).Error; err != nil {
 					return fmt.Errorf("failed to create app: %w", err)
 				}
@@ -34,45 +60,162 @@ func (r *Repository) SaveGraph(appName string, g *graph.Graph) error {
 			}
 		}
 
-		if err := tx.Where("app_id = ?", app.ID).Delete(&EdgeModel{}).Error; err != nil {
-			return fmt.Errorf("failed to delete existing edges: %w", err)
+		if err := r.syncGraph(tx, appName, app.ID, g); err != nil {
+			return err
 		}
-		if err := tx.Where("app_id = ?", app.ID).Delete(&NodeModel{}).Error; err != nil {
-			return fmt.Errorf("failed to delete existing nodes: %w", err)
+
+		return r.audit(tx, AuditActionSaveGraph, appName, "", map[string]interface{}{
+			"nodes": len(g.Nodes),
+			"edges": len(g.Edges),
+		})
+	})
+}
+
+// syncGraph brings the stored nodes and edges of an app in line with g. Rows
+// that did not change are left untouched, changed rows are updated, new rows
+// inserted and rows missing from g soft-deleted. Soft-deleted rows that are
+// part of g again are restored.
+func (r *Repository) syncGraph(tx *gorm.DB, appName string, appID uuid.UUID, g *graph.Graph) error {
+	var existingNodes []NodeModel
+	if err := tx.Unscoped().Where("app_id = ?", appID).Find(&existingNodes).Error; err != nil {
+		return fmt.Errorf("failed to load existing nodes: %w", err)
+	}
+	var existingEdges []EdgeModel
+	if err := tx.Unscoped().Where("app_id = ?", appID).Find(&existingEdges).Error; err != nil {
+		return fmt.Errorf("failed to load existing edges: %w", err)
+	}
+
+	storedNodes := make(map[string]*NodeModel, len(existingNodes))
+	for i := range existingNodes {
+		// Compare plaintext properties, encrypted values differ on every save
+		if err := r.openProperties(&existingNodes[i]); err != nil {
+			return err
 		}
+		storedNodes[existingNodes[i].ID] = &existingNodes[i]
+	}
+	storedEdges := make(map[string]*EdgeModel, len(existingEdges))
+	for i := range existingEdges {
+		storedEdges[existingEdges[i].ID] = &existingEdges[i]
+	}
 
-		for _, node := range g.Nodes {
-			nodeModel, err := r.nodeToModel(node, app.ID)
-			if err != nil {
-				return fmt.Errorf("failed to convert node to model: %w", err)
-			}
-			if err := tx.Create(&nodeModel).Error; err != nil {
+	removedEdges := make([]string, 0)
+	for id, stored := range storedEdges {
+		if _, exists := g.Edges[id]; !exists && !stored.DeletedAt.Valid {
+			removedEdges = append(removedEdges, id)
+		}
+	}
+	if len(removedEdges) > 0 {
+		if err := tx.Where("app_id = ? AND id IN ?", appID, removedEdges).Delete(&EdgeModel{}).Error; err != nil {
+			return fmt.Errorf("failed to delete removed edges: %w", err)
+		}
+	}
+
+	removedNodes := make([]string, 0)
+	for id, stored := range storedNodes {
+		if _, exists := g.Nodes[id]; !exists && !stored.DeletedAt.Valid {
+			removedNodes = append(removedNodes, id)
+		}
+	}
+	if len(removedNodes) > 0 {
+		if err := tx.Where("app_id = ? AND id IN ?", appID, removedNodes).Delete(&NodeModel{}).Error; err != nil {
+			return fmt.Errorf("failed to delete removed nodes: %w", err)
+		}
+	}
+
+	var writtenNodes, writtenEdges int
+	for _, node := range g.Nodes {
+		nodeModel, err := r.nodeToModel(node, appID)
+		if err != nil {
+			return fmt.Errorf("failed to convert node to model: %w", err)
+		}
+
+		stored, exists := storedNodes[node.ID]
+		if exists && !stored.DeletedAt.Valid && nodeModelEqual(stored, nodeModel) {
+			continue
+		}
+		if err := r.sealProperties(node, nodeModel); err != nil {
+			return err
+		}
+		if !exists {
+			if err := tx.Omit(clause.Associations).Create(nodeModel).Error; err != nil {
 				return fmt.Errorf("failed to save node %s: %w", node.ID, err)
 			}
+			writtenNodes++
+			continue
 		}
+		nodeModel.CreatedAt = stored.CreatedAt
+		if err := tx.Unscoped().Omit(clause.Associations).Save(nodeModel).Error; err != nil {
+			return fmt.Errorf("failed to update node %s: %w", node.ID, err)
+		}
+		writtenNodes++
+	}
 
-		for _, edge := range g.Edges {
-			edgeModel, err := r.edgeToModel(edge, app.ID)
-			if err != nil {
-				return fmt.Errorf("failed to convert edge to model: %w", err)
-			}
-			if err := tx.Create(&edgeModel).Error; err != nil {
+	for _, edge := range g.Edges {
+		edgeModel, err := r.edgeToModel(edge, appID)
+		if err != nil {
+			return fmt.Errorf("failed to convert edge to model: %w", err)
+		}
+
+		stored, exists := storedEdges[edge.ID]
+		if !exists {
+			if err := tx.Omit(clause.Associations).Create(edgeModel).Error; err != nil {
 				return fmt.Errorf("failed to save edge %s: %w", edge.ID, err)
 			}
+			writtenEdges++
+			continue
+		}
+		if !stored.DeletedAt.Valid && edgeModelEqual(stored, edgeModel) {
+			continue
+		}
+		edgeModel.CreatedAt = stored.CreatedAt
+		if err := tx.Unscoped().Omit(clause.Associations).Save(edgeModel).Error; err != nil {
+			return fmt.Errorf("failed to update edge %s: %w", edge.ID, err)
 		}
+		writtenEdges++
+	}
 
-		return nil
-	})
+	r.logger.Debug("graph saved",
+		slog.String("app", appName),
+		slog.Int("nodes_written", writtenNodes),
+		slog.Int("nodes_removed", len(removedNodes)),
+		slog.Int("edges_written", writtenEdges),
+		slog.Int("edges_removed", len(removedEdges)))
+
+	return nil
+}
+
+func nodeModelEqual(a, b *NodeModel) bool {
+	return a.Type == b.Type &&
+		a.Name == b.Name &&
+		a.Description == b.Description &&
+		a.State == b.State &&
+		a.Properties == b.Properties &&
+		timesEqual(a.StartedAt, b.StartedAt) &&
+		timesEqual(a.CompletedAt, b.CompletedAt) &&
+		a.DurationMs == b.DurationMs
+}
+
+// timesEqual compares optional timestamps at millisecond precision, since
+// databases round stored times differently
+func timesEqual(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Truncate(time.Millisecond).Equal(b.Truncate(time.Millisecond))
+}
+
+func edgeModelEqual(a, b *EdgeModel) bool {
+	return a.FromNodeID == b.FromNodeID &&
+		a.ToNodeID == b.ToNodeID &&
+		a.Type == b.Type &&
+		a.Description == b.Description &&
+		a.Properties == b.Properties
 }
 
 func (r *Repository) LoadGraph(appName string) (*graph.Graph, error) {
-	var app App
-	err := r.db.Where("name = ?", appName).First(&app).Error
+	app, err := r.findApp(r.db, appName)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("app %s not found", appName)
-		}
-		return nil, fmt.Errorf("failed to find app: %w", err)
+		return nil, err
 	}
 
 	var nodeModels []NodeModel
@@ -85,9 +228,20 @@ func (r *Repository) LoadGraph(appName string) (*graph.Graph, error) {
 		return nil, fmt.Errorf("failed to load edges: %w", err)
 	}
 
+	return r.buildGraph(appName, app, nodeModels, edgeModels)
+}
+
+// buildGraph assembles a graph from stored node and edge rows
+func (r *Repository) buildGraph(appName string, app *App, nodeModels []NodeModel, edgeModels []EdgeModel) (*graph.Graph, error) {
 	g := graph.NewGraph(appName)
 	g.ID = fmt.Sprintf("%s-graph", app.ID)
 
+	metadata, err := appMetadata(app)
+	if err != nil {
+		return nil, err
+	}
+	g.Metadata = metadata
+
 	for _, nodeModel := range nodeModels {
 		node, err := r.modelToNode(&nodeModel)
 		if err != nil {
@@ -111,47 +265,487 @@ func (r *Repository) LoadGraph(appName string) (*graph.Graph, error) {
 	return g, nil
 }
 
-func (r *Repository) CreateGraphRun(appName string, version int) (*GraphRunModel, error) {
-	var app App
-	err := r.db.Where("name = ?", appName).First(&app).Error
+// LoadSubgraph loads the given nodes of an app and the edges between them.
+// With withClosure, all nodes reachable from nodeIDs over outgoing edges
+// (dependencies, contained steps, provisioned resources, ...) are included
+// as well. Unknown node IDs are ignored.
+func (r *Repository) LoadSubgraph(appName string, nodeIDs []string, withClosure bool) (*graph.Graph, error) {
+	app, err := r.findApp(r.db, appName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find app: %w", err)
+		return nil, err
+	}
+
+	included := make(map[string]bool, len(nodeIDs))
+	for _, id := range nodeIDs {
+		included[id] = true
+	}
+
+	if withClosure {
+		frontier := nodeIDs
+		for len(frontier) > 0 {
+			var targets []string
+			err := r.db.Model(&EdgeModel{}).
+				Where("app_id = ? AND from_node_id IN ?", app.ID, frontier).
+				Distinct().
+				Pluck("to_node_id", &targets).Error
+			if err != nil {
+				return nil, fmt.Errorf("failed to load edges: %w", err)
+			}
+
+			frontier = frontier[:0:0]
+			for _, id := range targets {
+				if !included[id] {
+					included[id] = true
+					frontier = append(frontier, id)
+				}
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(included))
+	for id := range included {
+		ids = append(ids, id)
+	}
+
+	var nodeModels []NodeModel
+	if len(ids) > 0 {
+		if err := r.db.Where("app_id = ? AND id IN ?", app.ID, ids).Find(&nodeModels).Error; err != nil {
+			return nil, fmt.Errorf("failed to load nodes: %w", err)
+		}
+	}
+
+	var edgeModels []EdgeModel
+	if len(ids) > 0 {
+		err := r.db.Where("app_id = ? AND from_node_id IN ? AND to_node_id IN ?", app.ID, ids, ids).
+			Find(&edgeModels).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to load edges: %w", err)
+		}
+	}
+
+	return r.buildGraph(appName, app, nodeModels, edgeModels)
+}
+
+// LoadGraphSummary returns node and edge counts and node states of an app.
+// Only node IDs, types and states are read; properties and edges are not
+// loaded.
+func (r *Repository) LoadGraphSummary(appName string) (*GraphSummary, error) {
+	app, err := r.findApp(r.db, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []NodeModel
+	if err := r.db.Select("id", "type", "state").Where("app_id = ?", app.ID).Find(&nodes).Error; err != nil {
+		return nil, fmt.Errorf("failed to load node states: %w", err)
+	}
+
+	summary := &GraphSummary{
+		AppName:      appName,
+		NodeCount:    int64(len(nodes)),
+		NodesByState: make(map[string]int64),
+		NodesByType:  make(map[string]int64),
+		NodeStates:   make(map[string]graph.NodeState, len(nodes)),
+	}
+	for _, node := range nodes {
+		summary.NodesByState[node.State]++
+		summary.NodesByType[node.Type]++
+		summary.NodeStates[node.ID] = graph.NodeState(node.State)
+	}
+
+	if err := r.db.Model(&EdgeModel{}).Where("app_id = ?", app.ID).Count(&summary.EdgeCount).Error; err != nil {
+		return nil, fmt.Errorf("failed to count edges: %w", err)
+	}
+
+	return summary, nil
+}
+
+// GetNodesByState returns the nodes of an app in the given state, ordered by
+// ID, without loading the rest of the graph
+func (r *Repository) GetNodesByState(appName string, state graph.NodeState) ([]*graph.Node, error) {
+	return r.findNodes(appName, "state = ?", string(state))
+}
+
+// GetNodesByType returns the nodes of an app of the given type, ordered by
+// ID, without loading the rest of the graph
+func (r *Repository) GetNodesByType(appName string, nodeType graph.NodeType) ([]*graph.Node, error) {
+	return r.findNodes(appName, "type = ?", string(nodeType))
+}
+
+// findNodes loads the nodes of an app matching condition
+func (r *Repository) findNodes(appName string, condition string, args ...interface{}) ([]*graph.Node, error) {
+	app, err := r.findApp(r.db, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodeModels []NodeModel
+	err = r.db.Where("app_id = ?", app.ID).
+		Where(condition, args...).
+		Order("id").
+		Find(&nodeModels).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load nodes: %w", err)
+	}
+
+	nodes := make([]*graph.Node, 0, len(nodeModels))
+	for i := range nodeModels {
+		node, err := r.modelToNode(&nodeModels[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert node model: %w", err)
+		}
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+// DeleteGraph soft-deletes all nodes and edges of an app while keeping the
+// app record and its run history. Deleted nodes can be brought back with
+// RestoreNode or by saving them again.
+func (r *Repository) DeleteGraph(appName string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		app, err := r.findApp(tx, appName)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("app_id = ?", app.ID).Delete(&EdgeModel{}).Error; err != nil {
+			return fmt.Errorf("failed to delete edges: %w", err)
+		}
+		if err := tx.Where("app_id = ?", app.ID).Delete(&NodeModel{}).Error; err != nil {
+			return fmt.Errorf("failed to delete nodes: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// DeleteApp removes an app. A soft delete only marks the app as deleted and
+// keeps its graph and runs; a hard delete removes the app together with all
+// nodes, edges, graph runs and state history.
+func (r *Repository) DeleteApp(appName string, opts DeleteOptions) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		app, err := r.findApp(tx, appName)
+		if err != nil {
+			return err
+		}
+
+		if opts.Soft {
+			if err := tx.Delete(app).Error; err != nil {
+				return fmt.Errorf("failed to soft delete app: %w", err)
+			}
+			return nil
+		}
+
+		return purgeApp(tx, app)
+	})
+}
+
+// purgeApp permanently removes an app with all nodes, edges, graph runs and
+// state history
+func purgeApp(tx *gorm.DB, app *App) error {
+	if err := tx.Unscoped().Where("app_id = ?", app.ID).Delete(&EdgeModel{}).Error; err != nil {
+		return fmt.Errorf("failed to delete edges: %w", err)
+	}
+	if err := tx.Unscoped().Where("app_id = ?", app.ID).Delete(&NodeModel{}).Error; err != nil {
+		return fmt.Errorf("failed to delete nodes: %w", err)
+	}
+	if err := tx.Where("app_id = ?", app.ID).Delete(&GraphRunModel{}).Error; err != nil {
+		return fmt.Errorf("failed to delete graph runs: %w", err)
+	}
+	if err := tx.Where("app_id = ?", app.ID).Delete(&NodeStateChangeModel{}).Error; err != nil {
+		return fmt.Errorf("failed to delete state history: %w", err)
+	}
+	if err := tx.Unscoped().Delete(app).Error; err != nil {
+		return fmt.Errorf("failed to delete app: %w", err)
+	}
+	return nil
+}
+
+// ListApps returns app summaries ordered by name. A limit <= 0 returns all
+// matching apps.
+func (r *Repository) ListApps(filter AppFilter, limit, offset int) ([]AppSummary, error) {
+	query := r.db.Model(&App{}).Scopes(r.tenantScope).Order("name")
+	if filter.NameContains != "" {
+		// The escape character is bound since MySQL reads a backslash in a
+		// string literal as an escape
+		query = query.Where("name LIKE ? ESCAPE ?", "%"+escapeLike(filter.NameContains)+"%", `\`)
+	}
+	if filter.Owner != "" {
+		query = query.Where("owner = ?", filter.Owner)
+	}
+	if filter.Team != "" {
+		query = query.Where("team = ?", filter.Team)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	var apps []App
+	if err := query.Find(&apps).Error; err != nil {
+		return nil, fmt.Errorf("failed to list apps: %w", err)
+	}
+
+	summaries := make([]AppSummary, 0, len(apps))
+	if len(apps) == 0 {
+		return summaries, nil
+	}
+
+	appIDs := make([]uuid.UUID, len(apps))
+	for i, app := range apps {
+		appIDs[i] = app.ID
+	}
+
+	nodeCounts, err := r.countByApp(&NodeModel{}, appIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count nodes: %w", err)
+	}
+	edgeCounts, err := r.countByApp(&EdgeModel{}, appIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count edges: %w", err)
+	}
+
+	lastStatus, err := r.lastRunStatusByApp(appIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load graph runs: %w", err)
+	}
+
+	for _, app := range apps {
+		summaries = append(summaries, AppSummary{
+			ID:            app.ID,
+			Name:          app.Name,
+			Description:   app.Description,
+			Owner:         app.Owner,
+			Team:          app.Team,
+			NodeCount:     nodeCounts[app.ID],
+			EdgeCount:     edgeCounts[app.ID],
+			LastRunStatus: lastStatus[app.ID],
+			CreatedAt:     app.CreatedAt,
+			UpdatedAt:     app.UpdatedAt,
+		})
+	}
+
+	return summaries, nil
+}
+
+// countByApp counts the rows of model per app ID
+// lastRunStatusByApp returns the status of the latest run of each of the
+// apps that has runs
+func (r *Repository) lastRunStatusByApp(appIDs []uuid.UUID) (map[uuid.UUID]string, error) {
+	latest := r.db.Model(&GraphRunModel{}).
+		Select("app_id, MAX(started_at) AS started_at").
+		Where("app_id IN ?", appIDs).
+		Group("app_id")
+	var runs []GraphRunModel
+	err := r.db.Model(&GraphRunModel{}).
+		Select("graph_runs.app_id, graph_runs.status").
+		Joins("JOIN (?) AS latest ON latest.app_id = graph_runs.app_id AND latest.started_at = graph_runs.started_at", latest).
+		Find(&runs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make(map[uuid.UUID]string, len(runs))
+	for _, run := range runs {
+		statuses[run.AppID] = run.Status
+	}
+	return statuses, nil
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern with a backslash
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (r *Repository) countByApp(model interface{}, appIDs []uuid.UUID) (map[uuid.UUID]int64, error) {
+	var rows []struct {
+		AppID uuid.UUID
+		Count int64
+	}
+	err := r.db.Model(model).
+		Select("app_id, COUNT(*) AS count").
+		Where("app_id IN ?", appIDs).
+		Group("app_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
 	}
 
-	graphRun := &GraphRunModel{
-		AppID:   app.ID,
-		Version: version,
-		Status:  "pending",
+	counts := make(map[uuid.UUID]int64, len(rows))
+	for _, row := range rows {
+		counts[row.AppID] = row.Count
 	}
+	return counts, nil
+}
+
+func (r *Repository) CreateGraphRun(appName string, version int) (*GraphRunModel, error) {
+	return r.createGraphRun(appName, version, "pending")
+}
+
+func (r *Repository) createGraphRun(appName string, version int, status string) (*GraphRunModel, error) {
+	var graphRun *GraphRunModel
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		app, err := r.findApp(tx, appName)
+		if err != nil {
+			return err
+		}
 
-	if err := r.db.Create(graphRun).Error; err != nil {
-		return nil, fmt.Errorf("failed to create graph run: %w", err)
+		graphRun = &GraphRunModel{
+			TenantID:  r.tenantID,
+			AppID:     app.ID,
+			Version:   version,
+			Status:    status,
+			StartedAt: time.Now(),
+			Metadata:  "{}",
+		}
+
+		if err := tx.Create(graphRun).Error; err != nil {
+			return fmt.Errorf("failed to create graph run: %w", err)
+		}
+
+		return r.audit(tx, AuditActionCreateGraphRun, appName, graphRun.ID.String(), map[string]interface{}{
+			"version": version,
+		})
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return graphRun, nil
 }
 
 func (r *Repository) UpdateGraphRun(runID uuid.UUID, status string, errorMessage *string) error {
-	updates := map[string]interface{}{
-		"status": status,
-	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var run GraphRunModel
+		err := tx.Scopes(r.tenantScope).Preload("App", func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped()
+		}).Where("id = ?", runID).First(&run).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("graph run %s not found", runID)
+			}
+			return fmt.Errorf("failed to load graph run: %w", err)
+		}
+
+		updates := map[string]interface{}{
+			"status": status,
+		}
+
+		if status == "completed" || status == "failed" {
+			updates["completed_at"] = time.Now()
+		}
+
+		if errorMessage != nil {
+			updates["error_message"] = *errorMessage
+		}
+
+		if err := tx.Model(&GraphRunModel{}).Where("id = ?", runID).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update graph run: %w", err)
+		}
+
+		details := map[string]interface{}{"old_status": run.Status, "status": status}
+		if errorMessage != nil {
+			details["error_message"] = *errorMessage
+		}
+		return r.audit(tx, AuditActionUpdateGraphRun, run.App.Name, runID.String(), details)
+	})
+}
+
+// FailGraphRun marks a run as failed and records the IDs of the nodes that
+// failed in the run's metadata, keeping other metadata keys
+func (r *Repository) FailGraphRun(runID uuid.UUID, errorMessage string, failedNodeIDs []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var run GraphRunModel
+		err := tx.Scopes(r.tenantScope).Preload("App", func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped()
+		}).Where("id = ?", runID).First(&run).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("graph run %s not found", runID)
+			}
+			return fmt.Errorf("failed to load graph run: %w", err)
+		}
+
+		metadata := map[string]interface{}{}
+		if run.Metadata != "" {
+			if err := json.Unmarshal([]byte(run.Metadata), &metadata); err != nil {
+				return fmt.Errorf("failed to decode metadata of graph run %s: %w", runID, err)
+			}
+		}
+		if failedNodeIDs == nil {
+			failedNodeIDs = []string{}
+		}
+		metadata["failed_node_ids"] = failedNodeIDs
+		metadataJSON, err := json.Marshal(metadata)
+		if err != nil {
+			return fmt.Errorf("failed to encode metadata: %w", err)
+		}
+
+		err = tx.Model(&GraphRunModel{}).Where("id = ?", runID).Updates(map[string]interface{}{
+			"status":        "failed",
+			"completed_at":  time.Now(),
+			"error_message": errorMessage,
+			"metadata":      string(metadataJSON),
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to update graph run: %w", err)
+		}
+
+		return r.audit(tx, AuditActionUpdateGraphRun, run.App.Name, runID.String(), map[string]interface{}{
+			"old_status":      run.Status,
+			"status":          "failed",
+			"error_message":   errorMessage,
+			"failed_node_ids": failedNodeIDs,
+		})
+	})
+}
 
-	if status == "completed" || status == "failed" {
-		updates["completed_at"] = "NOW()"
+// SetRunStartedAt records when a run actually started executing, which can
+// be later than its creation for queued runs
+func (r *Repository) SetRunStartedAt(runID uuid.UUID, startedAt time.Time) error {
+	result := r.db.Model(&GraphRunModel{}).Scopes(r.tenantScope).Where("id = ?", runID).Update("started_at", startedAt)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update graph run start time: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("graph run %s not found", runID)
 	}
+	return nil
+}
 
-	if errorMessage != nil {
-		updates["error_message"] = *errorMessage
+// GetGraphRun returns a single run including its stored execution plan and
+// its app
+func (r *Repository) GetGraphRun(runID uuid.UUID) (*GraphRunModel, error) {
+	var run GraphRunModel
+	if err := r.db.Scopes(r.tenantScope).Preload("App").Where("id = ?", runID).First(&run).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("graph run %s not found", runID)
+		}
+		return nil, fmt.Errorf("failed to load graph run: %w", err)
 	}
+	return &run, nil
+}
 
-	return r.db.Model(&GraphRunModel{}).Where("id = ?", runID).Updates(updates).Error
+// SetGraphRunExecutionPlan stores the JSON encoded execution plan of a run
+func (r *Repository) SetGraphRunExecutionPlan(runID uuid.UUID, planJSON string) error {
+	result := r.db.Model(&GraphRunModel{}).Scopes(r.tenantScope).Where("id = ?", runID).Update("execution_plan", planJSON)
+	if result.Error != nil {
+		return fmt.Errorf("failed to store execution plan: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("graph run %s not found", runID)
+	}
+	return nil
 }
 
 func (r *Repository) GetGraphRuns(appName string) ([]GraphRunModel, error) {
-	var app App
-	err := r.db.Where("name = ?", appName).First(&app).Error
+	app, err := r.findApp(r.db, appName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find app: %w", err)
+		return nil, err
 	}
 
 	var runs []GraphRunModel
@@ -163,6 +757,59 @@ func (r *Repository) GetGraphRuns(appName string) ([]GraphRunModel, error) {
 	return runs, nil
 }
 
+// ListGraphRuns returns the runs of an app matching filter together with
+// the number of matching runs before Limit and Offset are applied
+func (r *Repository) ListGraphRuns(appName string, filter RunFilter) ([]GraphRunModel, int64, error) {
+	app, err := r.findApp(r.db, appName)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sortBy := filter.SortBy
+	switch sortBy {
+	case "":
+		sortBy = RunSortStartedAt
+	case RunSortStartedAt, RunSortCompletedAt, RunSortStatus, RunSortVersion:
+	default:
+		return nil, 0, fmt.Errorf("invalid run sort: %s", sortBy)
+	}
+
+	query := r.db.Model(&GraphRunModel{}).Where("app_id = ?", app.ID)
+	if len(filter.Statuses) > 0 {
+		query = query.Where("status IN ?", filter.Statuses)
+	}
+	if !filter.StartedFrom.IsZero() {
+		query = query.Where("started_at >= ?", filter.StartedFrom)
+	}
+	if !filter.StartedTo.IsZero() {
+		query = query.Where("started_at < ?", filter.StartedTo)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count graph runs: %w", err)
+	}
+
+	direction := "DESC"
+	if filter.Ascending {
+		direction = "ASC"
+	}
+	// Break ties by ID so that pages do not overlap
+	query = query.Order(string(sortBy) + " " + direction).Order("id " + direction)
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query = query.Offset(filter.Offset)
+	}
+
+	runs := []GraphRunModel{}
+	if err := query.Find(&runs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load graph runs: %w", err)
+	}
+	return runs, total, nil
+}
+
 func (r *Repository) nodeToModel(node *graph.Node, appID uuid.UUID) (*NodeModel, error) {
 	propertiesJSON, err := json.Marshal(node.Properties)
 	if err != nil {
@@ -171,6 +818,7 @@ func (r *Repository) nodeToModel(node *graph.Node, appID uuid.UUID) (*NodeModel,
 
 	return &NodeModel{
 		ID:          node.ID,
+		TenantID:    r.tenantID,
 		AppID:       appID,
 		Type:        string(node.Type),
 		Name:        node.Name,
@@ -179,6 +827,9 @@ func (r *Repository) nodeToModel(node *graph.Node, appID uuid.UUID) (*NodeModel,
 		Properties:  string(propertiesJSON),
 		CreatedAt:   node.CreatedAt,
 		UpdatedAt:   node.UpdatedAt,
+		StartedAt:   node.StartedAt,
+		CompletedAt: node.CompletedAt,
+		DurationMs:  node.Duration.Milliseconds(),
 	}, nil
 }
 
@@ -189,6 +840,13 @@ func (r *Repository) modelToNode(model *NodeModel) (*graph.Node, error) {
 			return nil, fmt.Errorf("failed to unmarshal node properties: %w", err)
 		}
 	}
+	if r.codec != nil {
+		decoded, err := r.codec.Decode(properties)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode properties of node %s: %w", model.ID, err)
+		}
+		properties = decoded
+	}
 
 	return &graph.Node{
 		ID:          model.ID,
@@ -199,9 +857,52 @@ func (r *Repository) modelToNode(model *NodeModel) (*graph.Node, error) {
 		Properties:  properties,
 		CreatedAt:   model.CreatedAt,
 		UpdatedAt:   model.UpdatedAt,
+		StartedAt:   model.StartedAt,
+		CompletedAt: model.CompletedAt,
+		Duration:    time.Duration(model.DurationMs) * time.Millisecond,
 	}, nil
 }
 
+// sealProperties replaces the plaintext properties of model with the
+// properties of node encoded by the repository's codec
+func (r *Repository) sealProperties(node *graph.Node, model *NodeModel) error {
+	if r.codec == nil {
+		return nil
+	}
+	encoded, err := r.codec.Encode(node.Properties)
+	if err != nil {
+		return fmt.Errorf("failed to encode properties of node %s: %w", node.ID, err)
+	}
+	propertiesJSON, err := json.Marshal(encoded)
+	if err != nil {
+		return fmt.Errorf("failed to marshal node properties: %w", err)
+	}
+	model.Properties = string(propertiesJSON)
+	return nil
+}
+
+// openProperties replaces the stored properties of model with their decoded
+// plaintext JSON
+func (r *Repository) openProperties(model *NodeModel) error {
+	if r.codec == nil || model.Properties == "" {
+		return nil
+	}
+	var properties map[string]interface{}
+	if err := json.Unmarshal([]byte(model.Properties), &properties); err != nil {
+		return fmt.Errorf("failed to unmarshal node properties: %w", err)
+	}
+	decoded, err := r.codec.Decode(properties)
+	if err != nil {
+		return fmt.Errorf("failed to decode properties of node %s: %w", model.ID, err)
+	}
+	propertiesJSON, err := json.Marshal(decoded)
+	if err != nil {
+		return fmt.Errorf("failed to marshal node properties: %w", err)
+	}
+	model.Properties = string(propertiesJSON)
+	return nil
+}
+
 func (r *Repository) edgeToModel(edge *graph.Edge, appID uuid.UUID) (*EdgeModel, error) {
 	propertiesJSON, err := json.Marshal(edge.Properties)
 	if err != nil {
@@ -210,6 +911,7 @@ func (r *Repository) edgeToModel(edge *graph.Edge, appID uuid.UUID) (*EdgeModel,
 
 	return &EdgeModel{
 		ID:          edge.ID,
+		TenantID:    r.tenantID,
 		AppID:       appID,
 		FromNodeID:  edge.FromNodeID,
 		ToNodeID:    edge.ToNodeID,
@@ -240,28 +942,209 @@ func (r *Repository) modelToEdge(model *EdgeModel) (*graph.Edge, error) {
 }
 
 func (r *Repository) UpdateNodeState(appName string, nodeID string, state graph.NodeState) error {
-	var app App
-	err := r.db.Where("name = ?", appName).First(&app).Error
-	if err != nil {
-		return fmt.Errorf("failed to find app: %w", err)
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		app, err := r.findApp(tx, appName)
+		if err != nil {
+			return err
+		}
+
+		var node NodeModel
+		err = tx.Select("id", "state", "started_at").Where("app_id = ? AND id = ?", app.ID, nodeID).First(&node).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("node %s not found in app %s", nodeID, appName)
+			}
+			return fmt.Errorf("failed to find node: %w", err)
+		}
+
+		now := time.Now()
+		updates := map[string]interface{}{
+			"state":      string(state),
+			"updated_at": now,
+		}
+		if node.State != string(state) {
+			for column, value := range timingUpdates(state, now) {
+				updates[column] = value
+			}
+			if durationMs, ok := terminalDuration(&node, state, now); ok {
+				updates["duration_ms"] = durationMs
+			}
+		}
+
+		result := tx.Model(&NodeModel{}).
+			Where("app_id = ? AND id = ?", app.ID, nodeID).
+			Updates(updates)
+
+		if result.Error != nil {
+			return fmt.Errorf("failed to update node state: %w", result.Error)
+		}
+
+		if err := r.audit(tx, AuditActionUpdateNodeState, appName, nodeID, map[string]interface{}{
+			"old_state": node.State,
+			"new_state": string(state),
+		}); err != nil {
+			return err
+		}
+
+		if node.State == string(state) {
+			return nil
+		}
+
+		return recordStateChange(tx, app.ID, nodeID, graph.NodeState(node.State), state, nil, now)
+	})
+}
+
+// UpdateNodeStates applies several node state updates in one transaction.
+// Nodes are grouped by target state so the number of statements depends on
+// the number of distinct states, not nodes. Nodes that do not exist are
+// reported in the returned map and do not abort the batch; the error return
+// is reserved for failures of the whole transaction.
+func (r *Repository) UpdateNodeStates(appName string, states map[string]graph.NodeState) (map[string]error, error) {
+	nodeErrors := make(map[string]error)
+	if len(states) == 0 {
+		return nodeErrors, nil
 	}
 
-	updates := map[string]interface{}{
-		"state":      string(state),
-		"updated_at": time.Now(),
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		app, err := r.findApp(tx, appName)
+		if err != nil {
+			return err
+		}
+
+		nodeIDs := make([]string, 0, len(states))
+		for nodeID := range states {
+			nodeIDs = append(nodeIDs, nodeID)
+		}
+
+		var nodes []NodeModel
+		if err := tx.Select("id", "state", "started_at").Where("app_id = ? AND id IN ?", app.ID, nodeIDs).Find(&nodes).Error; err != nil {
+			return fmt.Errorf("failed to load nodes: %w", err)
+		}
+		current := make(map[string]*NodeModel, len(nodes))
+		for i := range nodes {
+			current[nodes[i].ID] = &nodes[i]
+		}
+
+		now := time.Now()
+		byState := make(map[graph.NodeState][]string)
+		durations := make(map[string]int64)
+		changes := make([]NodeStateChangeModel, 0, len(states))
+		for nodeID, state := range states {
+			node, exists := current[nodeID]
+			if !exists {
+				nodeErrors[nodeID] = fmt.Errorf("node %s not found in app %s", nodeID, appName)
+				continue
+			}
+			if node.State == string(state) {
+				continue
+			}
+			byState[state] = append(byState[state], nodeID)
+			if durationMs, ok := terminalDuration(node, state, now); ok {
+				durations[nodeID] = durationMs
+			}
+			changes = append(changes, NodeStateChangeModel{
+				AppID:     app.ID,
+				NodeID:    nodeID,
+				OldState:  node.State,
+				NewState:  string(state),
+				ChangedAt: now,
+			})
+		}
+
+		for state, ids := range byState {
+			updates := timingUpdates(state, now)
+			updates["state"] = string(state)
+			updates["updated_at"] = now
+			err := tx.Model(&NodeModel{}).
+				Where("app_id = ? AND id IN ?", app.ID, ids).
+				Updates(updates).Error
+			if err != nil {
+				return fmt.Errorf("failed to update node states: %w", err)
+			}
+		}
+
+		for nodeID, durationMs := range durations {
+			err := tx.Model(&NodeModel{}).
+				Where("app_id = ? AND id = ?", app.ID, nodeID).
+				Update("duration_ms", durationMs).Error
+			if err != nil {
+				return fmt.Errorf("failed to update duration of node %s: %w", nodeID, err)
+			}
+		}
+
+		if len(changes) > 0 {
+			if err := tx.Omit("App").CreateInBatches(changes, 100).Error; err != nil {
+				return fmt.Errorf("failed to record state changes: %w", err)
+			}
+		}
+
+		for _, change := range changes {
+			if err := r.audit(tx, AuditActionUpdateNodeState, appName, change.NodeID, map[string]interface{}{
+				"old_state": change.OldState,
+				"new_state": change.NewState,
+			}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	result := r.db.Model(&NodeModel{}).
-		Where("app_id = ? AND id = ?", app.ID, nodeID).
-		Updates(updates)
+	return nodeErrors, nil
+}
 
-	if result.Error != nil {
-		return fmt.Errorf("failed to update node state: %w", result.Error)
+// timingUpdates returns the timing columns to set when a node enters state,
+// mirroring graph.Node.MarkState. The duration of terminal states depends on
+// the node's start time and is handled by terminalDuration.
+func timingUpdates(state graph.NodeState, now time.Time) map[string]interface{} {
+	switch state {
+	case graph.NodeStateRunning:
+		return map[string]interface{}{"started_at": now, "completed_at": nil, "duration_ms": 0}
+	case graph.NodeStateFailed, graph.NodeStateSucceeded:
+		return map[string]interface{}{"completed_at": now}
+	default:
+		return map[string]interface{}{"started_at": nil, "completed_at": nil, "duration_ms": 0}
 	}
+}
 
-	if result.RowsAffected == 0 {
-		return fmt.Errorf("node %s not found in app %s", nodeID, appName)
+// terminalDuration returns the run time of a node entering a terminal state
+func terminalDuration(node *NodeModel, state graph.NodeState, now time.Time) (int64, bool) {
+	if state != graph.NodeStateFailed && state != graph.NodeStateSucceeded {
+		return 0, false
+	}
+	if node.StartedAt == nil {
+		return 0, false
 	}
+	return now.Sub(*node.StartedAt).Milliseconds(), true
+}
 
-	return nil
+// ErrAppNotFound matches, with errors.Is, the errors of methods given the
+// name of an app that does not exist
+var ErrAppNotFound = errors.New("app not found")
+
+type appNotFoundError struct {
+	appName string
+}
+
+func (e *appNotFoundError) Error() string {
+	return fmt.Sprintf("app %s not found", e.appName)
+}
+
+func (e *appNotFoundError) Is(target error) bool {
+	return target == ErrAppNotFound
+}
+
+// findApp looks up a non-deleted app of the repository's tenant by name
+func (r *Repository) findApp(db *gorm.DB, appName string) (*App, error) {
+	var app App
+	if err := db.Scopes(r.tenantScope).Where("name = ?", appName).First(&app).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, &appNotFoundError{appName: appName}
+		}
+		return nil, fmt.Errorf("failed to find app: %w", err)
+	}
+	return &app, nil
 }
@@ -0,0 +1,1017 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestRepository(t *testing.T) (*Repository, *gorm.DB) {
+	db, err := NewSQLiteConnection(filepath.Join(t.TempDir(), "graph.db"))
+	require.NoError(t, err)
+	require.NoError(t, AutoMigrate(db))
+
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	return NewRepository(db), db
+}
+
+func createTestGraph(appName string) *graph.Graph {
+	g := graph.NewGraph(appName)
+
+	nodes := []*graph.Node{
+		{ID: appName + "-spec", Type: graph.NodeTypeSpec, Name: "Spec"},
+		{ID: appName + "-workflow", Type: graph.NodeTypeWorkflow, Name: "Deploy"},
+		{ID: appName + "-step", Type: graph.NodeTypeStep, Name: "Provision"},
+		{ID: appName + "-db", Type: graph.NodeTypeResource, Name: "Database"},
+	}
+	for _, node := range nodes {
+		require.NoError(nil, g.AddNode(node))
+	}
+
+	edges := []*graph.Edge{
+		{ID: appName + "-e1", FromNodeID: appName + "-workflow", ToNodeID: appName + "-spec", Type: graph.EdgeTypeDependsOn},
+		{ID: appName + "-e2", FromNodeID: appName + "-workflow", ToNodeID: appName + "-step", Type: graph.EdgeTypeContains},
+		{ID: appName + "-e3", FromNodeID: appName + "-step", ToNodeID: appName + "-db", Type: graph.EdgeTypeConfigures},
+	}
+	for _, edge := range edges {
+		require.NoError(nil, g.AddEdge(edge))
+	}
+
+	return g
+}
+
+func TestRepository_SaveAndLoadGraph(t *testing.T) {
+	repo, _ := newTestRepository(t)
+
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+
+	loaded, err := repo.LoadGraph("app")
+	require.NoError(t, err)
+	assert.Len(t, loaded.Nodes, 4)
+	assert.Len(t, loaded.Edges, 3)
+
+	_, err = repo.LoadGraph("missing")
+	assert.ErrorIs(t, err, ErrAppNotFound)
+	assert.EqualError(t, err, "app missing not found")
+}
+
+func TestRepository_DeleteGraph(t *testing.T) {
+	repo, db := newTestRepository(t)
+
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+	_, err := repo.CreateGraphRun("app", 1)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.DeleteGraph("app"))
+
+	loaded, err := repo.LoadGraph("app")
+	require.NoError(t, err)
+	assert.Empty(t, loaded.Nodes)
+	assert.Empty(t, loaded.Edges)
+
+	var runs int64
+	db.Model(&GraphRunModel{}).Count(&runs)
+	assert.Equal(t, int64(1), runs)
+
+	assert.Error(t, repo.DeleteGraph("missing"))
+}
+
+func TestRepository_DeleteApp(t *testing.T) {
+	repo, db := newTestRepository(t)
+
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+	require.NoError(t, repo.SaveGraph("other", createTestGraph("other")))
+	_, err := repo.CreateGraphRun("app", 1)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.DeleteApp("app", DeleteOptions{}))
+
+	_, err = repo.LoadGraph("app")
+	assert.Error(t, err)
+
+	var nodes, runs, apps int64
+	db.Model(&NodeModel{}).Count(&nodes)
+	db.Model(&GraphRunModel{}).Count(&runs)
+	db.Unscoped().Model(&App{}).Count(&apps)
+	assert.Equal(t, int64(4), nodes)
+	assert.Equal(t, int64(0), runs)
+	assert.Equal(t, int64(1), apps)
+
+	// The name can be reused after a hard delete
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+}
+
+func TestRepository_DeleteApp_Soft(t *testing.T) {
+	repo, db := newTestRepository(t)
+
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+	require.NoError(t, repo.DeleteApp("app", DeleteOptions{Soft: true}))
+
+	_, err := repo.LoadGraph("app")
+	assert.Error(t, err)
+
+	var nodes int64
+	db.Model(&NodeModel{}).Count(&nodes)
+	assert.Equal(t, int64(4), nodes)
+
+	err = repo.SaveGraph("app", createTestGraph("app"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "soft-deleted")
+}
+
+func TestRepository_ListApps(t *testing.T) {
+	repo, db := newTestRepository(t)
+
+	require.NoError(t, repo.SaveGraph("billing", createTestGraph("billing")))
+	require.NoError(t, repo.SaveGraph("checkout", createTestGraph("checkout")))
+	require.NoError(t, repo.SaveGraph("search", createTestGraph("search")))
+	run, err := repo.CreateGraphRun("checkout", 1)
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateGraphRun(run.ID, "failed", nil))
+	require.NoError(t, db.Model(&GraphRunModel{}).Where("id = ?", run.ID).Update("started_at", time.Now().Add(-time.Hour)).Error)
+	run, err = repo.CreateGraphRun("checkout", 1)
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateGraphRun(run.ID, "running", nil))
+
+	apps, err := repo.ListApps(AppFilter{}, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, apps, 3)
+	assert.Equal(t, "billing", apps[0].Name)
+	assert.Equal(t, int64(4), apps[0].NodeCount)
+	assert.Equal(t, int64(3), apps[0].EdgeCount)
+	assert.Empty(t, apps[0].LastRunStatus)
+	assert.Equal(t, "running", apps[1].LastRunStatus)
+
+	page, err := repo.ListApps(AppFilter{}, 1, 1)
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, "checkout", page[0].Name)
+
+	filtered, err := repo.ListApps(AppFilter{NameContains: "ar"}, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, filtered, 1)
+	assert.Equal(t, "search", filtered[0].Name)
+
+	// Wildcards in the filter match themselves
+	require.NoError(t, repo.SaveGraph("data_lake", createTestGraph("data_lake")))
+	require.NoError(t, repo.SaveGraph("dataxlake", createTestGraph("dataxlake")))
+	filtered, err = repo.ListApps(AppFilter{NameContains: "a_l"}, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, filtered, 1)
+	assert.Equal(t, "data_lake", filtered[0].Name)
+	filtered, err = repo.ListApps(AppFilter{NameContains: "%"}, 0, 0)
+	require.NoError(t, err)
+	assert.Empty(t, filtered)
+}
+
+func TestRepository_SaveGraph_Incremental(t *testing.T) {
+	repo, db := newTestRepository(t)
+
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+
+	var before NodeModel
+	require.NoError(t, db.Where("id = ?", "app-spec").First(&before).Error)
+
+	g, err := repo.LoadGraph("app")
+	require.NoError(t, err)
+	g.Nodes["app-workflow"].Description = "changed"
+	require.NoError(t, g.RemoveNode("app-db"))
+	require.NoError(t, g.AddNode(&graph.Node{ID: "app-cache", Type: graph.NodeTypeResource, Name: "Cache"}))
+	require.NoError(t, g.AddEdge(&graph.Edge{ID: "app-e4", FromNodeID: "app-step", ToNodeID: "app-cache", Type: graph.EdgeTypeConfigures}))
+
+	require.NoError(t, repo.SaveGraph("app", g))
+
+	var after NodeModel
+	require.NoError(t, db.Where("id = ?", "app-spec").First(&after).Error)
+	assert.True(t, before.UpdatedAt.Equal(after.UpdatedAt), "unchanged node should not be rewritten")
+
+	loaded, err := repo.LoadGraph("app")
+	require.NoError(t, err)
+	assert.Len(t, loaded.Nodes, 4)
+	assert.Len(t, loaded.Edges, 3)
+	assert.Equal(t, "changed", loaded.Nodes["app-workflow"].Description)
+	_, exists := loaded.Nodes["app-db"]
+	assert.False(t, exists)
+	_, exists = loaded.Edges["app-e3"]
+	assert.False(t, exists)
+	_, exists = loaded.Edges["app-e4"]
+	assert.True(t, exists)
+}
+
+func TestRepository_NodeStateHistory(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+
+	require.NoError(t, repo.UpdateNodeState("app", "app-step", graph.NodeStateRunning))
+	require.NoError(t, repo.UpdateNodeState("app", "app-step", graph.NodeStateRunning))
+	require.NoError(t, repo.UpdateNodeState("app", "app-step", graph.NodeStateFailed))
+
+	run, err := repo.CreateGraphRun("app", 1)
+	require.NoError(t, err)
+	require.NoError(t, repo.RecordNodeStateChange("app", "app-step", graph.NodeStateFailed, graph.NodeStateSucceeded, &run.ID))
+
+	history, err := repo.GetNodeStateHistory("app", "app-step")
+	require.NoError(t, err)
+	require.Len(t, history, 3, "repeated states are not recorded")
+
+	assert.Equal(t, "waiting", history[0].OldState)
+	assert.Equal(t, "running", history[0].NewState)
+	assert.Nil(t, history[0].RunID)
+	assert.Equal(t, "failed", history[1].NewState)
+	assert.Equal(t, run.ID, *history[2].RunID)
+
+	assert.Greater(t, MeanTimeToRecovery(history), time.Duration(0))
+
+	timeline, err := repo.GetAppStateTimeline("app", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, timeline, 3)
+
+	assert.Error(t, repo.UpdateNodeState("app", "missing", graph.NodeStateFailed))
+}
+
+func TestMeanTimeToRecovery(t *testing.T) {
+	start := time.Now()
+	changes := []NodeStateChangeModel{
+		{NewState: "running", ChangedAt: start},
+		{NewState: "failed", ChangedAt: start.Add(time.Minute)},
+		{NewState: "running", ChangedAt: start.Add(2 * time.Minute)},
+		{NewState: "succeeded", ChangedAt: start.Add(3 * time.Minute)},
+		{NewState: "failed", ChangedAt: start.Add(10 * time.Minute)},
+		{NewState: "succeeded", ChangedAt: start.Add(20 * time.Minute)},
+	}
+
+	assert.Equal(t, 6*time.Minute, MeanTimeToRecovery(changes))
+	assert.Equal(t, time.Duration(0), MeanTimeToRecovery(changes[:2]))
+}
+
+func TestRepository_UpdateNodeStates(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+
+	nodeErrors, err := repo.UpdateNodeStates("app", map[string]graph.NodeState{
+		"app-spec":     graph.NodeStateSucceeded,
+		"app-workflow": graph.NodeStateRunning,
+		"app-step":     graph.NodeStateRunning,
+		"ghost":        graph.NodeStateFailed,
+	})
+	require.NoError(t, err)
+	require.Len(t, nodeErrors, 1)
+	assert.Contains(t, nodeErrors["ghost"].Error(), "not found")
+
+	g, err := repo.LoadGraph("app")
+	require.NoError(t, err)
+	assert.Equal(t, graph.NodeStateSucceeded, g.Nodes["app-spec"].State)
+	assert.Equal(t, graph.NodeStateRunning, g.Nodes["app-workflow"].State)
+	assert.Equal(t, graph.NodeStateRunning, g.Nodes["app-step"].State)
+	assert.Equal(t, graph.NodeStateWaiting, g.Nodes["app-db"].State)
+
+	history, err := repo.GetNodeStateHistory("app", "app-step")
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
+
+	_, err = repo.UpdateNodeStates("missing", map[string]graph.NodeState{"x": graph.NodeStateFailed})
+	assert.Error(t, err)
+}
+
+func TestRepository_NodeTimingRoundTrip(t *testing.T) {
+	repo, _ := newTestRepository(t)
+
+	g := createTestGraph("app")
+	require.NoError(t, g.UpdateNodeState("app-step", graph.NodeStateRunning))
+	started := time.Now().Add(-90 * time.Second)
+	g.Nodes["app-step"].StartedAt = &started
+	require.NoError(t, g.UpdateNodeState("app-step", graph.NodeStateSucceeded))
+	require.NoError(t, repo.SaveGraph("app", g))
+
+	loaded, err := repo.LoadGraph("app")
+	require.NoError(t, err)
+	step := loaded.Nodes["app-step"]
+	require.NotNil(t, step.StartedAt)
+	require.NotNil(t, step.CompletedAt)
+	assert.InDelta(t, 90*time.Second, step.Duration, float64(time.Second))
+	assert.Nil(t, loaded.Nodes["app-spec"].StartedAt)
+
+	require.NoError(t, repo.UpdateNodeState("app", "app-db", graph.NodeStateRunning))
+	require.NoError(t, repo.UpdateNodeState("app", "app-db", graph.NodeStateSucceeded))
+	_, err = repo.UpdateNodeStates("app", map[string]graph.NodeState{"app-spec": graph.NodeStateRunning})
+	require.NoError(t, err)
+
+	loaded, err = repo.LoadGraph("app")
+	require.NoError(t, err)
+	assert.NotNil(t, loaded.Nodes["app-db"].StartedAt)
+	assert.NotNil(t, loaded.Nodes["app-db"].CompletedAt)
+	assert.NotNil(t, loaded.Nodes["app-spec"].StartedAt)
+	assert.Nil(t, loaded.Nodes["app-spec"].CompletedAt)
+}
+
+func TestRepository_GraphRunExecutionPlan(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+
+	run, err := repo.CreateGraphRun("app", 1)
+	require.NoError(t, err)
+	require.NoError(t, repo.SetGraphRunExecutionPlan(run.ID, `{"status":"completed"}`))
+
+	loaded, err := repo.GetGraphRun(run.ID)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"status":"completed"}`, loaded.ExecutionPlan)
+	assert.Equal(t, "app", loaded.App.Name)
+
+	_, err = repo.GetGraphRun(uuid.New())
+	assert.Error(t, err)
+	assert.Error(t, repo.SetGraphRunExecutionPlan(uuid.New(), "{}"))
+}
+
+func TestRepository_PruneGraphRuns(t *testing.T) {
+	repo, db := newTestRepository(t)
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+
+	runs := make([]*GraphRunModel, 0)
+	for i := 0; i < 4; i++ {
+		run, err := repo.CreateGraphRun("app", 1)
+		require.NoError(t, err)
+		completed := time.Now().Add(-time.Duration(4-i) * 24 * time.Hour)
+		started := completed.Add(-time.Minute)
+		require.NoError(t, db.Model(run).Updates(map[string]interface{}{
+			"status":       "completed",
+			"started_at":   started,
+			"completed_at": completed,
+		}).Error)
+		require.NoError(t, repo.RecordNodeStateChange("app", "app-step", graph.NodeStateWaiting, graph.NodeStateRunning, &run.ID))
+		runs = append(runs, run)
+	}
+
+	active, err := repo.CreateGraphRun("app", 1)
+	require.NoError(t, err)
+	require.NoError(t, db.Model(active).Update("started_at", time.Now().Add(-10*24*time.Hour)).Error)
+
+	pruned, err := repo.PruneGraphRuns("app", 36*time.Hour, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), pruned, "runs older than the cutoff beyond the two newest are pruned")
+
+	remaining, err := repo.GetGraphRuns("app")
+	require.NoError(t, err)
+	require.Len(t, remaining, 3)
+	ids := []uuid.UUID{remaining[0].ID, remaining[1].ID, remaining[2].ID}
+	assert.ElementsMatch(t, []uuid.UUID{runs[2].ID, runs[3].ID, active.ID}, ids)
+
+	history, err := repo.GetNodeStateHistory("app", "app-step")
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+
+	pruned, err = repo.PruneGraphRuns("", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), pruned, "unfinished runs are never pruned")
+
+	_, err = repo.PruneGraphRuns("missing", time.Hour, 0)
+	assert.Error(t, err)
+}
+
+func TestRepository_ListGraphRuns(t *testing.T) {
+	repo, db := newTestRepository(t)
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+
+	now := time.Now()
+	statuses := []string{"completed", "failed", "completed", "running", "failed"}
+	runs := make([]*GraphRunModel, 0, len(statuses))
+	for i, status := range statuses {
+		run, err := repo.CreateGraphRun("app", i+1)
+		require.NoError(t, err)
+		require.NoError(t, db.Model(run).Updates(map[string]interface{}{
+			"status":     status,
+			"started_at": now.Add(-time.Duration(len(statuses)-i) * time.Hour),
+		}).Error)
+		runs = append(runs, run)
+	}
+
+	all, total, err := repo.ListGraphRuns("app", RunFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), total)
+	require.Len(t, all, 5)
+	assert.Equal(t, runs[4].ID, all[0].ID, "newest first by default")
+
+	page, total, err := repo.ListGraphRuns("app", RunFilter{Limit: 2, Offset: 2})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), total, "total counts the runs before paging")
+	require.Len(t, page, 2)
+	assert.Equal(t, []uuid.UUID{runs[2].ID, runs[1].ID}, []uuid.UUID{page[0].ID, page[1].ID})
+
+	failed, total, err := repo.ListGraphRuns("app", RunFilter{Statuses: []string{"failed", "running"}, SortBy: RunSortVersion, Ascending: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	require.Len(t, failed, 3)
+	assert.Equal(t, []int{2, 4, 5}, []int{failed[0].Version, failed[1].Version, failed[2].Version})
+
+	window, total, err := repo.ListGraphRuns("app", RunFilter{
+		StartedFrom: now.Add(-4 * time.Hour),
+		StartedTo:   now.Add(-2 * time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total, "the end of the range is exclusive")
+	require.Len(t, window, 2)
+	assert.Equal(t, runs[2].ID, window[0].ID)
+
+	_, _, err = repo.ListGraphRuns("app", RunFilter{SortBy: "error_message; DROP TABLE graph_runs"})
+	assert.Error(t, err, "sort columns are restricted")
+
+	_, _, err = repo.ListGraphRuns("missing", RunFilter{})
+	assert.Error(t, err)
+}
+
+func TestJanitor_PrunesOnStart(t *testing.T) {
+	repo, db := newTestRepository(t)
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+
+	run, err := repo.CreateGraphRun("app", 1)
+	require.NoError(t, err)
+	require.NoError(t, db.Model(run).Updates(map[string]interface{}{
+		"started_at":   time.Now().Add(-2 * time.Hour),
+		"completed_at": time.Now().Add(-time.Hour),
+	}).Error)
+
+	janitor := NewJanitor(repo, RetentionPolicy{MaxAge: time.Minute})
+	janitor.Start(context.Background())
+	defer janitor.Stop()
+
+	assert.Eventually(t, func() bool {
+		runs, err := repo.GetGraphRuns("app")
+		return err == nil && len(runs) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRepository_TenantIsolation(t *testing.T) {
+	repo, db := newTestRepository(t)
+
+	tenants, err := repo.ListTenants()
+	require.NoError(t, err)
+	require.Len(t, tenants, 1)
+	assert.Equal(t, DefaultTenantName, tenants[0].Name)
+
+	teamA, err := repo.CreateTenant("team-a")
+	require.NoError(t, err)
+	teamB, err := repo.CreateTenant("team-b")
+	require.NoError(t, err)
+	_, err = repo.CreateTenant("team-a")
+	assert.Error(t, err, "tenant names are unique")
+
+	repoA := repo.ForTenant(WithTenant(context.Background(), teamA.ID))
+	repoB := repo.ForTenant(WithTenant(context.Background(), teamB.ID))
+
+	require.NoError(t, repoA.SaveGraph("shop", createTestGraph("a")))
+	require.NoError(t, repoB.SaveGraph("shop", createTestGraph("b")), "app names are unique per tenant")
+
+	loadedA, err := repoA.LoadGraph("shop")
+	require.NoError(t, err)
+	assert.Contains(t, loadedA.Nodes, "a-spec")
+	assert.NotContains(t, loadedA.Nodes, "b-spec")
+
+	_, err = repo.LoadGraph("shop")
+	assert.Error(t, err, "the default tenant does not see other tenants' apps")
+
+	apps, err := repoB.ListApps(AppFilter{}, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, apps, 1)
+	assert.Equal(t, int64(4), apps[0].NodeCount)
+
+	run, err := repoA.CreateGraphRun("shop", 1)
+	require.NoError(t, err)
+	assert.Equal(t, teamA.ID, run.TenantID)
+	_, err = repoB.GetGraphRun(run.ID)
+	assert.Error(t, err, "runs of other tenants are not visible")
+	assert.Error(t, repoB.SetGraphRunExecutionPlan(run.ID, "{}"))
+
+	var node NodeModel
+	require.NoError(t, db.Where("id = ?", "b-spec").First(&node).Error)
+	assert.Equal(t, teamB.ID, node.TenantID)
+
+	require.NoError(t, repoB.DeleteApp("shop", DeleteOptions{}))
+	_, err = repoA.LoadGraph("shop")
+	assert.NoError(t, err, "deleting an app only affects its own tenant")
+
+	assert.Equal(t, DefaultTenantID, TenantFromContext(context.Background()))
+}
+
+func TestRepository_SameNodeIDsInTenantsAndApps(t *testing.T) {
+	repo, db := newTestRepository(t)
+	teamA, err := repo.CreateTenant("team-a")
+	require.NoError(t, err)
+	teamB, err := repo.CreateTenant("team-b")
+	require.NoError(t, err)
+	repoA := repo.ForTenant(WithTenant(context.Background(), teamA.ID))
+	repoB := repo.ForTenant(WithTenant(context.Background(), teamB.ID))
+
+	// Node and edge IDs are unique per app, not per database
+	require.NoError(t, repoA.SaveGraph("shop", createTestGraph("x")))
+	require.NoError(t, repoB.SaveGraph("shop", createTestGraph("x")), "same IDs in another tenant")
+	require.NoError(t, repoA.SaveGraph("blog", createTestGraph("x")), "same IDs in another app")
+
+	require.NoError(t, repoB.UpdateNodeState("shop", "x-db", graph.NodeStateFailed))
+	loaded, err := repoA.LoadGraph("shop")
+	require.NoError(t, err)
+	assert.Equal(t, graph.NodeStateWaiting, loaded.Nodes["x-db"].State, "state changes stay in their app")
+	assert.Len(t, loaded.Edges, 3)
+
+	// Removing a node from one app keeps it in the others
+	g := createTestGraph("x")
+	require.NoError(t, g.RemoveNode("x-db"))
+	require.NoError(t, repoA.SaveGraph("blog", g))
+	loaded, err = repoA.LoadGraph("shop")
+	require.NoError(t, err)
+	assert.Contains(t, loaded.Nodes, "x-db")
+	assert.Contains(t, loaded.Edges, "x-e3")
+	require.NoError(t, repoA.RestoreNode("blog", "x-db"))
+
+	var nodes, edges int64
+	require.NoError(t, db.Model(&NodeModel{}).Where("id = ?", "x-db").Count(&nodes).Error)
+	require.NoError(t, db.Model(&EdgeModel{}).Where("id = ?", "x-e3").Count(&edges).Error)
+	assert.Equal(t, int64(3), nodes)
+	assert.Equal(t, int64(3), edges)
+}
+
+func TestRepository_AuditLog(t *testing.T) {
+	repo, _ := newTestRepository(t)
+
+	ctx := WithActor(context.Background(), "alice")
+	alice := repo.ForTenant(ctx)
+
+	require.NoError(t, alice.SaveGraph("app", createTestGraph("app")))
+	require.NoError(t, alice.UpdateNodeState("app", "app-step", graph.NodeStateRunning))
+	run, err := repo.CreateGraphRun("app", 1)
+	require.NoError(t, err)
+	require.NoError(t, alice.UpdateGraphRun(run.ID, "running", nil))
+	assert.Error(t, alice.UpdateGraphRun(uuid.New(), "running", nil))
+
+	entries, err := repo.GetAuditLog(AuditFilter{AppName: "app"})
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+
+	actions := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		actions = append(actions, entry.Action)
+	}
+	assert.ElementsMatch(t, []string{"save_graph", "update_node_state", "create_graph_run", "update_graph_run"}, actions)
+
+	byAlice, err := repo.GetAuditLog(AuditFilter{Actor: "alice"})
+	require.NoError(t, err)
+	assert.Len(t, byAlice, 3)
+
+	created, err := repo.GetAuditLog(AuditFilter{Action: AuditActionCreateGraphRun})
+	require.NoError(t, err)
+	require.Len(t, created, 1)
+	assert.Equal(t, SystemActor, created[0].Actor)
+	assert.Equal(t, run.ID.String(), created[0].Target)
+
+	stateChanges, err := repo.GetAuditLog(AuditFilter{Action: AuditActionUpdateNodeState})
+	require.NoError(t, err)
+	require.Len(t, stateChanges, 1)
+	assert.Equal(t, "app-step", stateChanges[0].Target)
+	assert.JSONEq(t, `{"old_state":"waiting","new_state":"running"}`, stateChanges[0].Details)
+
+	limited, err := repo.GetAuditLog(AuditFilter{Limit: 2})
+	require.NoError(t, err)
+	assert.Len(t, limited, 2)
+
+	team, err := repo.CreateTenant("team")
+	require.NoError(t, err)
+	other, err := repo.ForTenant(WithTenant(ctx, team.ID)).GetAuditLog(AuditFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, other, "audit entries are scoped to the tenant")
+}
+
+func TestRepository_GetNodesByStateAndType(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	g := createTestGraph("app")
+	g.Nodes["app-step"].State = graph.NodeStateFailed
+	g.Nodes["app-db"].State = graph.NodeStateFailed
+	require.NoError(t, repo.SaveGraph("app", g))
+	require.NoError(t, repo.SaveGraph("other", createTestGraph("other")))
+
+	failed, err := repo.GetNodesByState("app", graph.NodeStateFailed)
+	require.NoError(t, err)
+	require.Len(t, failed, 2)
+	assert.Equal(t, "app-db", failed[0].ID)
+	assert.Equal(t, "app-step", failed[1].ID)
+
+	workflows, err := repo.GetNodesByType("app", graph.NodeTypeWorkflow)
+	require.NoError(t, err)
+	require.Len(t, workflows, 1)
+	assert.Equal(t, "Deploy", workflows[0].Name)
+
+	running, err := repo.GetNodesByState("app", graph.NodeStateRunning)
+	require.NoError(t, err)
+	assert.Empty(t, running)
+
+	_, err = repo.GetNodesByType("missing", graph.NodeTypeSpec)
+	assert.Error(t, err)
+}
+
+func TestRepository_LoadSubgraph(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+
+	sub, err := repo.LoadSubgraph("app", []string{"app-workflow", "app-step", "unknown"}, false)
+	require.NoError(t, err)
+	assert.Len(t, sub.Nodes, 2)
+	require.Len(t, sub.Edges, 1)
+	assert.Contains(t, sub.Edges, "app-e2")
+
+	closure, err := repo.LoadSubgraph("app", []string{"app-workflow"}, true)
+	require.NoError(t, err)
+	assert.Len(t, closure.Nodes, 4, "spec, step and db are reachable from the workflow")
+	assert.Len(t, closure.Edges, 3)
+
+	leaf, err := repo.LoadSubgraph("app", []string{"app-db"}, true)
+	require.NoError(t, err)
+	assert.Len(t, leaf.Nodes, 1)
+	assert.Empty(t, leaf.Edges)
+
+	empty, err := repo.LoadSubgraph("app", nil, true)
+	require.NoError(t, err)
+	assert.Empty(t, empty.Nodes)
+}
+
+func TestRepository_LoadGraphSummary(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	g := createTestGraph("app")
+	g.Nodes["app-step"].State = graph.NodeStateFailed
+	require.NoError(t, repo.SaveGraph("app", g))
+
+	summary, err := repo.LoadGraphSummary("app")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), summary.NodeCount)
+	assert.Equal(t, int64(3), summary.EdgeCount)
+	assert.Equal(t, int64(3), summary.NodesByState["waiting"])
+	assert.Equal(t, int64(1), summary.NodesByState["failed"])
+	assert.Equal(t, int64(1), summary.NodesByType["workflow"])
+	assert.Equal(t, graph.NodeStateFailed, summary.NodeStates["app-step"])
+
+	_, err = repo.LoadGraphSummary("missing")
+	assert.Error(t, err)
+}
+
+func TestRepository_SaveGraph_SoftDeletesRemovedNodes(t *testing.T) {
+	repo, db := newTestRepository(t)
+
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+
+	g, err := repo.LoadGraph("app")
+	require.NoError(t, err)
+	require.NoError(t, g.RemoveNode("app-db"))
+	require.NoError(t, repo.SaveGraph("app", g))
+
+	var deleted NodeModel
+	require.NoError(t, db.Unscoped().Where("id = ?", "app-db").First(&deleted).Error)
+	assert.True(t, deleted.DeletedAt.Valid)
+
+	require.NoError(t, repo.RestoreNode("app", "app-db"))
+
+	loaded, err := repo.LoadGraph("app")
+	require.NoError(t, err)
+	assert.Len(t, loaded.Nodes, 4)
+	assert.Len(t, loaded.Edges, 3)
+	_, exists := loaded.Edges["app-e3"]
+	assert.True(t, exists, "edge to the restored node should be restored")
+
+	assert.Error(t, repo.RestoreNode("app", "app-db"))
+	assert.Error(t, repo.RestoreNode("missing", "app-db"))
+}
+
+func TestRepository_SaveGraph_RevivesDeletedNodes(t *testing.T) {
+	repo, _ := newTestRepository(t)
+
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+	require.NoError(t, repo.DeleteGraph("app"))
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+
+	loaded, err := repo.LoadGraph("app")
+	require.NoError(t, err)
+	assert.Len(t, loaded.Nodes, 4)
+	assert.Len(t, loaded.Edges, 3)
+}
+
+func TestRepository_RestoreApp(t *testing.T) {
+	repo, _ := newTestRepository(t)
+
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+	require.NoError(t, repo.DeleteApp("app", DeleteOptions{Soft: true}))
+	require.NoError(t, repo.RestoreApp("app"))
+
+	loaded, err := repo.LoadGraph("app")
+	require.NoError(t, err)
+	assert.Len(t, loaded.Nodes, 4)
+
+	assert.Error(t, repo.RestoreApp("app"))
+	assert.Error(t, repo.RestoreApp("missing"))
+}
+
+func TestRepository_PurgeDeleted(t *testing.T) {
+	repo, db := newTestRepository(t)
+
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+	require.NoError(t, repo.SaveGraph("other", createTestGraph("other")))
+	_, err := repo.CreateGraphRun("other", 1)
+	require.NoError(t, err)
+
+	g, err := repo.LoadGraph("app")
+	require.NoError(t, err)
+	require.NoError(t, g.RemoveNode("app-db"))
+	require.NoError(t, repo.SaveGraph("app", g))
+	require.NoError(t, repo.DeleteApp("other", DeleteOptions{Soft: true}))
+
+	purged, err := repo.PurgeDeleted(time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), purged)
+
+	purged, err = repo.PurgeDeleted(-time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), purged) // app "other", node app-db and edge app-e3
+
+	var nodes, runs, apps int64
+	db.Unscoped().Model(&NodeModel{}).Count(&nodes)
+	db.Unscoped().Model(&GraphRunModel{}).Count(&runs)
+	db.Unscoped().Model(&App{}).Count(&apps)
+	assert.Equal(t, int64(3), nodes)
+	assert.Equal(t, int64(0), runs)
+	assert.Equal(t, int64(1), apps)
+}
+
+func TestRepository_DumpAndRestoreApp(t *testing.T) {
+	source, _ := newTestRepository(t)
+
+	require.NoError(t, source.SaveGraph("app", createTestGraph("app")))
+	run, err := source.CreateGraphRun("app", 1)
+	require.NoError(t, err)
+	require.NoError(t, source.UpdateNodeState("app", "app-spec", graph.NodeStateRunning))
+	require.NoError(t, source.RecordNodeStateChange("app", "app-db", graph.NodeStateWaiting, graph.NodeStateRunning, &run.ID))
+	require.NoError(t, source.SetAppMetadata("app", graph.AppMetadata{Owner: "alice", Annotations: map[string]string{"tier": "1"}}))
+
+	var buf bytes.Buffer
+	require.NoError(t, source.DumpApp("app", &buf))
+	assert.Error(t, source.DumpApp("missing", &bytes.Buffer{}))
+
+	target, _ := newTestRepository(t)
+	appName, err := target.RestoreAppSnapshot(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, "app", appName)
+
+	loaded, err := target.LoadGraph("app")
+	require.NoError(t, err)
+	assert.Len(t, loaded.Nodes, 4)
+	assert.Len(t, loaded.Edges, 3)
+	assert.Equal(t, graph.NodeStateRunning, loaded.Nodes["app-spec"].State)
+	assert.Equal(t, "alice", loaded.Metadata.Owner)
+	assert.Equal(t, "1", loaded.Metadata.Annotations["tier"])
+
+	runs, err := target.GetGraphRuns("app")
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, run.ID, runs[0].ID)
+
+	history, err := target.GetNodeStateHistory("app", "app-db")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, run.ID, *history[0].RunID)
+
+	_, err = target.RestoreAppSnapshot(bytes.NewReader(buf.Bytes()))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already exists")
+
+	_, err = target.RestoreAppSnapshot(bytes.NewReader([]byte(`{"version": 99}`)))
+	assert.Error(t, err)
+}
+
+func TestRepository_GraphRunUpdates(t *testing.T) {
+	repo, _ := newTestRepository(t)
+
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+	run, err := repo.CreateGraphRun("app", 1)
+	require.NoError(t, err)
+
+	startedAt := time.Now().Add(time.Minute).Truncate(time.Second)
+	require.NoError(t, repo.SetRunStartedAt(run.ID, startedAt))
+	require.NoError(t, repo.UpdateGraphRun(run.ID, "completed", nil))
+
+	stored, err := repo.GetGraphRun(run.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "completed", stored.Status)
+	assert.True(t, startedAt.Equal(stored.StartedAt))
+	require.NotNil(t, stored.CompletedAt)
+	assert.WithinDuration(t, time.Now(), *stored.CompletedAt, time.Minute)
+
+	failed, err := repo.CreateGraphRun("app", 2)
+	require.NoError(t, err)
+	require.NoError(t, repo.FailGraphRun(failed.ID, "nodes failed", []string{"app-step", "app-db"}))
+
+	stored, err = repo.GetGraphRun(failed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "failed", stored.Status)
+	assert.Equal(t, "nodes failed", stored.ErrorMessage)
+	assert.NotNil(t, stored.CompletedAt)
+
+	metadata, err := stored.ParseMetadata()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app-step", "app-db"}, metadata.FailedNodeIDs)
+
+	assert.Error(t, repo.SetRunStartedAt(uuid.New(), time.Now()))
+	assert.Error(t, repo.FailGraphRun(uuid.New(), "nodes failed", nil))
+}
+
+func TestRepository_ClaimGraphRun(t *testing.T) {
+	repo, _ := newTestRepository(t)
+
+	tenant, err := repo.CreateTenant("team-a")
+	require.NoError(t, err)
+	tenantRepo := repo.ForTenant(WithTenant(context.Background(), tenant.ID))
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+	require.NoError(t, tenantRepo.SaveGraph("shop", createTestGraph("shop")))
+
+	_, err = repo.CreateGraphRun("app", 1)
+	require.NoError(t, err)
+	first, err := tenantRepo.QueueGraphRun("shop", 1)
+	require.NoError(t, err)
+	assert.Equal(t, RunStatusQueued, first.Status)
+	time.Sleep(10 * time.Millisecond)
+	second, err := repo.QueueGraphRun("app", 1)
+	require.NoError(t, err)
+
+	claimed, err := repo.ClaimGraphRun("replica-1")
+	require.NoError(t, err)
+	require.NotNil(t, claimed)
+	assert.Equal(t, first.ID, claimed.ID, "oldest queued run of any tenant first")
+	assert.Equal(t, "shop", claimed.App.Name)
+	assert.Equal(t, tenant.ID, claimed.TenantID)
+	assert.Equal(t, "running", claimed.Status)
+	assert.Equal(t, "replica-1", claimed.ClaimedBy)
+	require.NotNil(t, claimed.ClaimedAt)
+
+	claimed, err = repo.ClaimGraphRun("replica-2")
+	require.NoError(t, err)
+	require.NotNil(t, claimed)
+	assert.Equal(t, second.ID, claimed.ID)
+
+	claimed, err = repo.ClaimGraphRun("replica-1")
+	require.NoError(t, err)
+	assert.Nil(t, claimed, "pending runs are not queued")
+}
+
+func TestRepository_CancelGraphRun(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+
+	queued, err := repo.QueueGraphRun("app", 1)
+	require.NoError(t, err)
+	require.NoError(t, repo.CancelGraphRun(queued.ID, "deployed by mistake"))
+	run, err := repo.GetGraphRun(queued.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "failed", run.Status)
+	assert.Equal(t, "cancelled: deployed by mistake", run.ErrorMessage)
+	assert.NotNil(t, run.CompletedAt)
+	claimed, err := repo.ClaimGraphRun("replica-1")
+	require.NoError(t, err)
+	assert.Nil(t, claimed, "cancelled runs are not claimed")
+
+	running, err := repo.CreateGraphRun("app", 1)
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateGraphRun(running.ID, "running", nil))
+	require.NoError(t, repo.CancelGraphRun(running.ID, ""))
+	status, err := repo.GetGraphRunStatus(running.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "failed", status)
+	run, err = repo.GetGraphRun(running.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "cancelled", run.ErrorMessage)
+
+	// Finished runs keep their outcome
+	completed, err := repo.CreateGraphRun("app", 1)
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateGraphRun(completed.ID, "completed", nil))
+	assert.ErrorIs(t, repo.CancelGraphRun(completed.ID, ""), ErrRunNotCancellable)
+	assert.ErrorIs(t, repo.CancelGraphRun(running.ID, ""), ErrRunNotCancellable)
+	status, err = repo.GetGraphRunStatus(completed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "completed", status)
+
+	missing := uuid.New()
+	assert.ErrorContains(t, repo.CancelGraphRun(missing, ""), "not found")
+	_, err = repo.GetGraphRunStatus(missing)
+	assert.ErrorContains(t, err, "not found")
+
+	// Runs of other tenants are not found
+	tenant, err := repo.CreateTenant("team-a")
+	require.NoError(t, err)
+	tenantRepo := repo.ForTenant(WithTenant(context.Background(), tenant.ID))
+	other, err := repo.QueueGraphRun("app", 1)
+	require.NoError(t, err)
+	assert.ErrorContains(t, tenantRepo.CancelGraphRun(other.ID, ""), "not found")
+}
+
+func TestRepository_RunNodeExecutions(t *testing.T) {
+	repo, _ := newTestRepository(t)
+
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+	first, err := repo.CreateGraphRun("app", 1)
+	require.NoError(t, err)
+	second, err := repo.CreateGraphRun("app", 2)
+	require.NoError(t, err)
+	require.NoError(t, repo.SetRunStartedAt(second.ID, time.Now().Add(time.Second)))
+
+	record := func(runID uuid.UUID, nodeID string, oldState, newState graph.NodeState) {
+		require.NoError(t, repo.RecordNodeStateChange("app", nodeID, oldState, newState, &runID))
+		time.Sleep(2 * time.Millisecond)
+	}
+	record(first.ID, "app-spec", graph.NodeStateWaiting, graph.NodeStateRunning)
+	record(first.ID, "app-spec", graph.NodeStateRunning, graph.NodeStateSucceeded)
+	record(first.ID, "app-workflow", graph.NodeStateWaiting, graph.NodeStateRunning)
+	record(first.ID, "app-workflow", graph.NodeStateRunning, graph.NodeStateFailed)
+
+	executions, err := repo.GetRunNodeExecutions(first.ID)
+	require.NoError(t, err)
+	require.Len(t, executions, 2)
+	assert.Equal(t, "app-spec", executions[0].NodeID)
+	assert.Equal(t, string(graph.NodeStateSucceeded), executions[0].State)
+	assert.Equal(t, 2, executions[0].Transitions)
+	require.NotNil(t, executions[0].StartedAt)
+	require.NotNil(t, executions[0].CompletedAt)
+	assert.Positive(t, executions[0].DurationMs)
+	assert.Equal(t, string(graph.NodeStateFailed), executions[1].State)
+
+	executions, err = repo.GetRunNodeExecutions(second.ID)
+	require.NoError(t, err)
+	assert.Empty(t, executions)
+
+	_, err = repo.GetRunNodeExecutions(uuid.New())
+	assert.Error(t, err)
+
+	runs, err := repo.GetRecentRunsWithNodes("app", 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	assert.Equal(t, second.ID, runs[0].ID)
+	assert.Empty(t, runs[0].Nodes)
+	assert.Equal(t, first.ID, runs[1].ID)
+	assert.Equal(t, "pending", runs[1].Status)
+	assert.Len(t, runs[1].Nodes, 2)
+
+	runs, err = repo.GetRecentRunsWithNodes("app", 1)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, second.ID, runs[0].ID)
+
+	_, err = repo.GetRecentRunsWithNodes("missing", 1)
+	assert.Error(t, err)
+}
+
+func TestRepository_AppMetadata(t *testing.T) {
+	repo, _ := newTestRepository(t)
+
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+	require.NoError(t, repo.SaveGraph("other", createTestGraph("other")))
+
+	metadata, err := repo.GetAppMetadata("app")
+	require.NoError(t, err)
+	assert.Empty(t, metadata.Owner)
+	assert.Nil(t, metadata.Annotations)
+
+	require.NoError(t, repo.SetAppMetadata("app", graph.AppMetadata{
+		Description: "Checkout service",
+		Owner:       "alice",
+		Team:        "payments",
+		Links:       map[string]string{"runbook": "https://wiki.example.com/checkout"},
+		Annotations: map[string]string{"tier": "1"},
+	}))
+	require.NoError(t, repo.SetAppAnnotation("app", "pci", "true"))
+	require.NoError(t, repo.SetAppAnnotation("app", "tier", ""))
+
+	loaded, err := repo.LoadGraph("app")
+	require.NoError(t, err)
+	require.NotNil(t, loaded.Metadata)
+	assert.Equal(t, "alice", loaded.Metadata.Owner)
+	assert.Equal(t, "payments", loaded.Metadata.Team)
+	assert.Equal(t, "https://wiki.example.com/checkout", loaded.Metadata.Links["runbook"])
+	assert.Equal(t, map[string]string{"pci": "true"}, loaded.Metadata.Annotations)
+
+	apps, err := repo.ListApps(AppFilter{Team: "payments"}, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, apps, 1)
+	assert.Equal(t, "app", apps[0].Name)
+	assert.Equal(t, "alice", apps[0].Owner)
+	assert.Equal(t, "Checkout service", apps[0].Description)
+
+	assert.Error(t, repo.SetAppMetadata("missing", graph.AppMetadata{}))
+	assert.Error(t, repo.SetAppAnnotation("missing", "key", "value"))
+	_, err = repo.GetAppMetadata("missing")
+	assert.Error(t, err)
+}
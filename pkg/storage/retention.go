@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RetentionPolicy describes which graph runs the Janitor prunes
+type RetentionPolicy struct {
+	// MaxAge is the age after which finished runs become eligible for pruning
+	MaxAge time.Duration
+	// KeepLast is the number of most recent finished runs kept per app
+	// regardless of their age
+	KeepLast int
+	// Interval is how often the janitor prunes (defaults to one hour)
+	Interval time.Duration
+	// PurgeDeletedAfter, if set, makes the janitor permanently remove apps,
+	// nodes and edges that were soft-deleted longer ago
+	PurgeDeletedAfter time.Duration
+}
+
+// PruneGraphRuns deletes finished graph runs that started more than olderThan
+// ago, always keeping the keepLast most recent finished runs of each app.
+// State history recorded for the pruned runs is deleted with them, as is
+// run-less state history older than the cutoff. An empty appName prunes all
+// apps of the repository's tenant. It returns the number of deleted runs.
+func (r *Repository) PruneGraphRuns(appName string, olderThan time.Duration, keepLast int) (int64, error) {
+	var apps []App
+	query := r.db.Unscoped().Scopes(r.tenantScope)
+	if appName != "" {
+		query = query.Where("name = ?", appName)
+	}
+	if err := query.Find(&apps).Error; err != nil {
+		return 0, fmt.Errorf("failed to load apps: %w", err)
+	}
+	if appName != "" && len(apps) == 0 {
+		return 0, &appNotFoundError{appName: appName}
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	var pruned int64
+	for _, app := range apps {
+		deleted, err := pruneAppRuns(r.db, app.ID, cutoff, keepLast)
+		if err != nil {
+			return pruned, fmt.Errorf("failed to prune runs of app %s: %w", app.Name, err)
+		}
+		pruned += deleted
+	}
+
+	return pruned, nil
+}
+
+func pruneAppRuns(db *gorm.DB, appID uuid.UUID, cutoff time.Time, keepLast int) (int64, error) {
+	var deleted int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if keepLast < 0 {
+			keepLast = 0
+		}
+
+		var runs []GraphRunModel
+		err := tx.Select("id", "started_at").
+			Where("app_id = ? AND completed_at IS NOT NULL", appID).
+			Order("started_at DESC").
+			Find(&runs).Error
+		if err != nil {
+			return fmt.Errorf("failed to select runs: %w", err)
+		}
+
+		runIDs := make([]uuid.UUID, 0)
+		for i := keepLast; i < len(runs); i++ {
+			if runs[i].StartedAt.Before(cutoff) {
+				runIDs = append(runIDs, runs[i].ID)
+			}
+		}
+
+		if len(runIDs) > 0 {
+			err = tx.Where("run_id IN ?", runIDs).Delete(&NodeStateChangeModel{}).Error
+			if err != nil {
+				return fmt.Errorf("failed to delete run state history: %w", err)
+			}
+
+			result := tx.Where("id IN ?", runIDs).Delete(&GraphRunModel{})
+			if result.Error != nil {
+				return fmt.Errorf("failed to delete runs: %w", result.Error)
+			}
+			deleted = result.RowsAffected
+		}
+
+		err = tx.Where("app_id = ? AND run_id IS NULL AND changed_at < ?", appID, cutoff).
+			Delete(&NodeStateChangeModel{}).Error
+		if err != nil {
+			return fmt.Errorf("failed to delete state history: %w", err)
+		}
+
+		return nil
+	})
+	return deleted, err
+}
+
+// Janitor periodically prunes graph runs according to a RetentionPolicy
+type Janitor struct {
+	repository RepositoryInterface
+	policy     RetentionPolicy
+	logger     *slog.Logger
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	mu     sync.Mutex
+}
+
+// NewJanitor creates a janitor for the given repository. It logs through the
+// repository's logger and does nothing until Start is called.
+func NewJanitor(repository RepositoryInterface, policy RetentionPolicy) *Janitor {
+	if policy.Interval <= 0 {
+		policy.Interval = time.Hour
+	}
+	logger := slog.Default()
+	if repo, ok := repository.(*Repository); ok {
+		logger = repo.logger
+	}
+	return &Janitor{
+		repository: repository,
+		policy:     policy,
+		logger:     logger,
+	}
+}
+
+// Start prunes once immediately and then on every interval until ctx is
+// cancelled or Stop is called. Calling Start on a running janitor is a no-op.
+func (j *Janitor) Start(ctx context.Context) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.cancel != nil {
+		return
+	}
+
+	ctx, j.cancel = context.WithCancel(ctx)
+	j.done = make(chan struct{})
+
+	go func() {
+		defer close(j.done)
+
+		ticker := time.NewTicker(j.policy.Interval)
+		defer ticker.Stop()
+
+		for {
+			j.prune()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the janitor and waits for a running prune to finish
+func (j *Janitor) Stop() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.cancel == nil {
+		return
+	}
+
+	j.cancel()
+	<-j.done
+	j.cancel = nil
+}
+
+// prune applies the policy to the apps of every tenant
+func (j *Janitor) prune() {
+	tenants, err := j.repository.ListTenants()
+	if err != nil {
+		j.logger.Error("failed to list tenants", slog.Any("error", err))
+		return
+	}
+
+	for _, tenant := range tenants {
+		repository := j.repository.ForTenant(WithTenant(context.Background(), tenant.ID))
+		pruned, err := repository.PruneGraphRuns("", j.policy.MaxAge, j.policy.KeepLast)
+		if err != nil {
+			j.logger.Error("failed to prune graph runs", slog.String("tenant", tenant.Name), slog.Any("error", err))
+			continue
+		}
+		if pruned > 0 {
+			j.logger.Info("pruned graph runs", slog.String("tenant", tenant.Name), slog.Int64("runs", pruned))
+		}
+
+		if j.policy.PurgeDeletedAfter <= 0 {
+			continue
+		}
+		purged, err := repository.PurgeDeleted(j.policy.PurgeDeletedAfter)
+		if err != nil {
+			j.logger.Error("failed to purge deleted rows", slog.String("tenant", tenant.Name), slog.Any("error", err))
+			continue
+		}
+		if purged > 0 {
+			j.logger.Info("purged deleted rows", slog.String("tenant", tenant.Name), slog.Int64("rows", purged))
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"github.com/google/uuid"
+)
+
+// NodeExecutionRecord summarizes what happened to a node during a run. It is
+// derived from the node state changes recorded with the run's ID.
+type NodeExecutionRecord struct {
+	NodeID      string     `json:"node_id"`
+	State       string     `json:"state"`                  // last state recorded during the run
+	StartedAt   *time.Time `json:"started_at,omitempty"`   // first transition to running
+	CompletedAt *time.Time `json:"completed_at,omitempty"` // last transition to succeeded or failed
+	DurationMs  int64      `json:"duration_ms"`
+	Transitions int        `json:"transitions"`
+}
+
+// RunWithNodes is a graph run together with the executions of its nodes
+type RunWithNodes struct {
+	GraphRunModel
+	Nodes []NodeExecutionRecord `json:"nodes"`
+}
+
+// runNodeRow is one row of a graph run joined with one of its state changes.
+// The change columns are NULL for runs without recorded state changes.
+type runNodeRow struct {
+	GraphRunModel `gorm:"embedded"`
+	NodeID        *string    `gorm:"column:change_node_id"`
+	NewState      *string    `gorm:"column:change_new_state"`
+	ChangedAt     *time.Time `gorm:"column:change_changed_at"`
+}
+
+// runNodeColumns selects the run columns (without the execution plan) and
+// the state change columns of a runs/changes join
+const runNodeColumns = "runs.id, runs.tenant_id, runs.app_id, runs.version, runs.status, " +
+	"runs.started_at, runs.completed_at, runs.error_message, runs.metadata, " +
+	"changes.node_id AS change_node_id, changes.new_state AS change_new_state, " +
+	"changes.changed_at AS change_changed_at"
+
+// GetRunNodeExecutions returns the executions of all nodes that changed
+// state during a run, in the order they were first touched
+func (r *Repository) GetRunNodeExecutions(runID uuid.UUID) ([]NodeExecutionRecord, error) {
+	var rows []runNodeRow
+	err := r.db.Table("graph_runs AS runs").
+		Select(runNodeColumns).
+		Joins("LEFT JOIN node_state_changes AS changes ON changes.run_id = runs.id").
+		Where("runs.id = ? AND runs.tenant_id = ?", runID, r.tenantID).
+		Order("changes.changed_at ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load node executions: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("graph run %s not found", runID)
+	}
+
+	return summarizeNodeExecutions(rows), nil
+}
+
+// GetRecentRunsWithNodes returns the limit newest runs of an app, newest
+// first, each with the executions of its nodes. Execution plans are not
+// loaded; use GetGraphRun for a single run's plan.
+func (r *Repository) GetRecentRunsWithNodes(appName string, limit int) ([]RunWithNodes, error) {
+	app, err := r.findApp(r.db, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	recent := r.db.Model(&GraphRunModel{}).Where("app_id = ?", app.ID).Order("started_at DESC")
+	if limit > 0 {
+		recent = recent.Limit(limit)
+	}
+
+	var rows []runNodeRow
+	err = r.db.Table("(?) AS runs", recent).
+		Select(runNodeColumns).
+		Joins("LEFT JOIN node_state_changes AS changes ON changes.run_id = runs.id").
+		Order("runs.started_at DESC, runs.id, changes.changed_at ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load graph runs: %w", err)
+	}
+
+	var runs []RunWithNodes
+	for start := 0; start < len(rows); {
+		end := start + 1
+		for end < len(rows) && rows[end].ID == rows[start].ID {
+			end++
+		}
+		runs = append(runs, RunWithNodes{
+			GraphRunModel: rows[start].GraphRunModel,
+			Nodes:         summarizeNodeExecutions(rows[start:end]),
+		})
+		start = end
+	}
+
+	return runs, nil
+}
+
+// summarizeNodeExecutions folds the state changes of one run, ordered by
+// time, into one record per node
+func summarizeNodeExecutions(rows []runNodeRow) []NodeExecutionRecord {
+	records := []NodeExecutionRecord{}
+	index := make(map[string]int)
+
+	for _, row := range rows {
+		if row.NodeID == nil || row.NewState == nil || row.ChangedAt == nil {
+			continue
+		}
+
+		i, ok := index[*row.NodeID]
+		if !ok {
+			i = len(records)
+			index[*row.NodeID] = i
+			records = append(records, NodeExecutionRecord{NodeID: *row.NodeID})
+		}
+		record := &records[i]
+
+		changedAt := *row.ChangedAt
+		record.State = *row.NewState
+		record.Transitions++
+		switch graph.NodeState(*row.NewState) {
+		case graph.NodeStateRunning:
+			if record.StartedAt == nil {
+				record.StartedAt = &changedAt
+			}
+		case graph.NodeStateSucceeded, graph.NodeStateFailed:
+			record.CompletedAt = &changedAt
+			if record.StartedAt != nil {
+				record.DurationMs = changedAt.Sub(*record.StartedAt).Milliseconds()
+			}
+		}
+	}
+
+	return records
+}
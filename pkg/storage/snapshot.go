@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/philipsahli/innominatus-graph/pkg/graph"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SnapshotVersion is the format version written by DumpApp
+const SnapshotVersion = 1
+
+// AppSnapshot is the portable representation of an app written by DumpApp
+// and read by RestoreAppSnapshot. The graph uses the same JSON encoding as
+// the REST API. Node properties are stored decrypted, so snapshots of apps
+// with encrypted properties must be protected like the keys themselves.
+type AppSnapshot struct {
+	Version     int                    `json:"version"`
+	AppName     string                 `json:"app_name"`
+	Description string                 `json:"description,omitempty"`
+	CreatedAt   time.Time              `json:"created_at"`
+	DumpedAt    time.Time              `json:"dumped_at"`
+	Graph       *graph.Graph           `json:"graph"`
+	Runs        []GraphRunModel        `json:"runs"`
+	History     []NodeStateChangeModel `json:"history"`
+}
+
+// DumpApp writes a snapshot of an app with its graph, runs and node state
+// history to w
+func (r *Repository) DumpApp(appName string, w io.Writer) error {
+	app, err := r.findApp(r.db, appName)
+	if err != nil {
+		return err
+	}
+
+	g, err := r.LoadGraph(appName)
+	if err != nil {
+		return err
+	}
+
+	var runs []GraphRunModel
+	if err := r.db.Where("app_id = ?", app.ID).Order("started_at ASC").Find(&runs).Error; err != nil {
+		return fmt.Errorf("failed to load graph runs: %w", err)
+	}
+
+	var history []NodeStateChangeModel
+	if err := r.db.Where("app_id = ?", app.ID).Order("changed_at ASC").Find(&history).Error; err != nil {
+		return fmt.Errorf("failed to load node state history: %w", err)
+	}
+
+	snapshot := AppSnapshot{
+		Version:     SnapshotVersion,
+		AppName:     app.Name,
+		Description: app.Description,
+		CreatedAt:   app.CreatedAt,
+		DumpedAt:    time.Now().UTC(),
+		Graph:       g,
+		Runs:        runs,
+		History:     history,
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(&snapshot); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// RestoreAppSnapshot reads a snapshot written by DumpApp and recreates the
+// app in the repository's tenant, keeping node, edge and run IDs. The app
+// must not exist yet, not even soft-deleted. It returns the restored app's
+// name.
+func (r *Repository) RestoreAppSnapshot(rd io.Reader) (string, error) {
+	var snapshot AppSnapshot
+	if err := json.NewDecoder(rd).Decode(&snapshot); err != nil {
+		return "", fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	if snapshot.Version != SnapshotVersion {
+		return "", fmt.Errorf("unsupported snapshot version %d", snapshot.Version)
+	}
+	if snapshot.AppName == "" || snapshot.Graph == nil {
+		return "", fmt.Errorf("snapshot is missing the app name or graph")
+	}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Scopes(r.tenantScope).Where("name = ?", snapshot.AppName).First(&App{}).Error
+		if err == nil {
+			return fmt.Errorf("app %s already exists", snapshot.AppName)
+		}
+		if err != gorm.ErrRecordNotFound {
+			return fmt.Errorf("failed to find app: %w", err)
+		}
+
+		app := App{
+			Name:        snapshot.AppName,
+			TenantID:    r.tenantID,
+			Description: snapshot.Description,
+			CreatedAt:   snapshot.CreatedAt,
+		}
+		if err := tx.Create(&app).Error; err != nil {
+			return fmt.Errorf("failed to create app: %w", err)
+		}
+		if snapshot.Graph.Metadata != nil {
+			if err := saveAppMetadata(tx, &app, snapshot.Graph.Metadata); err != nil {
+				return err
+			}
+		}
+
+		if err := r.syncGraph(tx, snapshot.AppName, app.ID, snapshot.Graph); err != nil {
+			return err
+		}
+
+		for i := range snapshot.Runs {
+			run := &snapshot.Runs[i]
+			run.TenantID = r.tenantID
+			run.AppID = app.ID
+			if err := tx.Omit(clause.Associations).Create(run).Error; err != nil {
+				return fmt.Errorf("failed to restore graph run %s: %w", run.ID, err)
+			}
+		}
+
+		for i := range snapshot.History {
+			change := &snapshot.History[i]
+			change.AppID = app.ID
+			if err := tx.Omit(clause.Associations).Create(change).Error; err != nil {
+				return fmt.Errorf("failed to restore node state history: %w", err)
+			}
+		}
+
+		return r.audit(tx, AuditActionRestoreSnapshot, snapshot.AppName, "", map[string]interface{}{
+			"nodes":     len(snapshot.Graph.Nodes),
+			"edges":     len(snapshot.Graph.Edges),
+			"runs":      len(snapshot.Runs),
+			"dumped_at": snapshot.DumpedAt,
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return snapshot.AppName, nil
+}
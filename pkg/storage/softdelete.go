@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RestoreApp restores an app removed with a soft DeleteApp, together with
+// its graph and runs
+func (r *Repository) RestoreApp(appName string) error {
+	var app App
+	err := r.db.Unscoped().Scopes(r.tenantScope).
+		Where("name = ? AND deleted_at IS NOT NULL", appName).
+		First(&app).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fmt.Errorf("deleted app %s not found", appName)
+		}
+		return fmt.Errorf("failed to find app: %w", err)
+	}
+
+	if err := r.db.Unscoped().Model(&app).Update("deleted_at", nil).Error; err != nil {
+		return fmt.Errorf("failed to restore app: %w", err)
+	}
+	return nil
+}
+
+// RestoreNode restores a node removed from an app by SaveGraph or
+// DeleteGraph, together with its deleted edges to nodes that exist
+func (r *Repository) RestoreNode(appName, nodeID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		app, err := r.findApp(tx, appName)
+		if err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Model(&NodeModel{}).
+			Where("app_id = ? AND id = ? AND deleted_at IS NOT NULL", app.ID, nodeID).
+			Update("deleted_at", nil)
+		if result.Error != nil {
+			return fmt.Errorf("failed to restore node: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("deleted node %s not found in app %s", nodeID, appName)
+		}
+
+		liveNodes := tx.Model(&NodeModel{}).Select("id").Where("app_id = ?", app.ID)
+		err = tx.Unscoped().Model(&EdgeModel{}).
+			Where("app_id = ? AND deleted_at IS NOT NULL", app.ID).
+			Where("from_node_id = ? OR to_node_id = ?", nodeID, nodeID).
+			Where("from_node_id IN (?) AND to_node_id IN (?)", liveNodes, liveNodes).
+			Update("deleted_at", nil).Error
+		if err != nil {
+			return fmt.Errorf("failed to restore edges: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// PurgeDeleted permanently removes apps, nodes and edges of the repository's
+// tenant that were soft-deleted more than olderThan ago. Purged apps lose
+// their graph, runs and state history. It returns the number of purged apps,
+// nodes and edges.
+func (r *Repository) PurgeDeleted(olderThan time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-olderThan)
+	var purged int64
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var apps []App
+		err := tx.Unscoped().Scopes(r.tenantScope).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Find(&apps).Error
+		if err != nil {
+			return fmt.Errorf("failed to find deleted apps: %w", err)
+		}
+		for i := range apps {
+			if err := purgeApp(tx, &apps[i]); err != nil {
+				return err
+			}
+		}
+		purged += int64(len(apps))
+
+		result := tx.Unscoped().Scopes(r.tenantScope).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Delete(&EdgeModel{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to purge edges: %w", result.Error)
+		}
+		purged += result.RowsAffected
+
+		result = tx.Unscoped().Scopes(r.tenantScope).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Delete(&NodeModel{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to purge nodes: %w", result.Error)
+		}
+		purged += result.RowsAffected
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DefaultTenantID owns all apps created without a tenant in the context,
+// including apps stored before tenants were introduced
+var DefaultTenantID = uuid.Nil
+
+// DefaultTenantName is the name of the tenant identified by DefaultTenantID
+const DefaultTenantName = "default"
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx that scopes repositories to tenantID
+func WithTenant(ctx context.Context, tenantID uuid.UUID) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant stored in ctx, or DefaultTenantID
+func TenantFromContext(ctx context.Context) uuid.UUID {
+	if tenantID, ok := ctx.Value(tenantKey{}).(uuid.UUID); ok {
+		return tenantID
+	}
+	return DefaultTenantID
+}
+
+// ForTenant returns a repository that only sees and creates apps, nodes,
+// edges and runs of the tenant in ctx, and attributes its mutations to the
+// actor in ctx in the audit log. The returned repository shares the database
+// connection with r; its queries carry the values of ctx, such as the
+// current trace span, but outlive its cancellation, as runs and exports
+// continue after the request that started them.
+func (r *Repository) ForTenant(ctx context.Context) RepositoryInterface {
+	scoped := *r
+	scoped.db = r.db.WithContext(context.WithoutCancel(ctx))
+	scoped.tenantID = TenantFromContext(ctx)
+	scoped.actor = ActorFromContext(ctx)
+	return &scoped
+}
+
+// TenantID returns the tenant the repository is scoped to
+func (r *Repository) TenantID() uuid.UUID {
+	return r.tenantID
+}
+
+// CreateTenant registers a new tenant
+func (r *Repository) CreateTenant(name string) (*TenantModel, error) {
+	tenant := &TenantModel{ID: uuid.New(), Name: name}
+	if err := r.db.Create(tenant).Error; err != nil {
+		return nil, fmt.Errorf("failed to create tenant %s: %w", name, err)
+	}
+	return tenant, nil
+}
+
+// ListTenants returns all tenants ordered by name
+func (r *Repository) ListTenants() ([]TenantModel, error) {
+	var tenants []TenantModel
+	if err := r.db.Order("name").Find(&tenants).Error; err != nil {
+		return nil, fmt.Errorf("failed to list tenants: %w", err)
+	}
+	return tenants, nil
+}
+
+// tenantScope restricts a query to rows of the repository's tenant
+func (r *Repository) tenantScope(db *gorm.DB) *gorm.DB {
+	return db.Where("tenant_id = ?", r.tenantID)
+}
+
+// ensureDefaultTenant creates the default tenant row if it does not exist
+func ensureDefaultTenant(db *gorm.DB) error {
+	tenant := TenantModel{ID: DefaultTenantID, Name: DefaultTenantName}
+	return db.Where("id = ?", DefaultTenantID).FirstOrCreate(&tenant).Error
+}
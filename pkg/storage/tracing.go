@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/philipsahli/innominatus-graph/pkg/tracing"
+
+	"gorm.io/gorm"
+)
+
+const tracingSpanKey = "tracing:span"
+
+// TraceQueries records a client span for every statement run with a context
+// holding a trace span, such as those of repositories returned by ForTenant
+// for traced requests. Statements outside of a trace are not recorded.
+func TraceQueries(db *gorm.DB, tracer *tracing.Tracer) error {
+	before := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			ctx := tx.Statement.Context
+			if ctx == nil {
+				return
+			}
+			if _, ok := tracing.SpanContextFromContext(ctx); !ok {
+				return
+			}
+			_, span := tracer.Start(ctx, operation, tracing.SpanKindClient)
+			tx.InstanceSet(tracingSpanKey, span)
+		}
+	}
+	after := func(tx *gorm.DB) {
+		value, ok := tx.InstanceGet(tracingSpanKey)
+		if !ok {
+			return
+		}
+		span := value.(*tracing.Span)
+		if table := tx.Statement.Table; table != "" {
+			span.Name += " " + table
+			span.SetAttribute("db.collection.name", table)
+		}
+		span.SetAttribute("db.system", tx.Dialector.Name())
+		span.SetAttribute("db.query.text", tx.Statement.SQL.String())
+		span.SetIntAttribute("db.response.returned_rows", tx.Statement.RowsAffected)
+		if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			span.SetError(tx.Error)
+		}
+		span.Finish()
+	}
+
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("gorm:create").Register("tracing:create:before", before("INSERT")),
+		callbacks.Create().After("gorm:create").Register("tracing:create:after", after),
+		callbacks.Query().Before("gorm:query").Register("tracing:query:before", before("SELECT")),
+		callbacks.Query().After("gorm:query").Register("tracing:query:after", after),
+		callbacks.Update().Before("gorm:update").Register("tracing:update:before", before("UPDATE")),
+		callbacks.Update().After("gorm:update").Register("tracing:update:after", after),
+		callbacks.Delete().Before("gorm:delete").Register("tracing:delete:before", before("DELETE")),
+		callbacks.Delete().After("gorm:delete").Register("tracing:delete:after", after),
+		callbacks.Row().Before("gorm:row").Register("tracing:row:before", before("QUERY")),
+		callbacks.Row().After("gorm:row").Register("tracing:row:after", after),
+		callbacks.Raw().Before("gorm:raw").Register("tracing:raw:before", before("EXEC")),
+		callbacks.Raw().After("gorm:raw").Register("tracing:raw:after", after),
+	)
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/philipsahli/innominatus-graph/pkg/tracing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []tracing.Span
+}
+
+func (e *recordingExporter) ExportSpans(ctx context.Context, spans []tracing.Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func TestTraceQueries(t *testing.T) {
+	repo, db := newTestRepository(t)
+	exporter := &recordingExporter{}
+	tracer := tracing.NewTracer(exporter, tracing.TracerOptions{})
+	require.NoError(t, TraceQueries(db, tracer))
+
+	// Queries outside of a trace are not recorded
+	require.NoError(t, repo.SaveGraph("app", createTestGraph("app")))
+
+	ctx, request := tracer.Start(context.Background(), "request", tracing.SpanKindServer)
+	_, err := repo.ForTenant(ctx).LoadGraph("app")
+	require.NoError(t, err)
+	_, err = repo.ForTenant(ctx).LoadGraph("missing")
+	require.Error(t, err)
+	request.Finish()
+	tracer.Close()
+
+	require.NotEmpty(t, exporter.spans)
+	var names []string
+	for _, span := range exporter.spans {
+		if span.SpanID == request.SpanID {
+			continue
+		}
+		names = append(names, span.Name)
+		assert.Equal(t, request.TraceID, span.TraceID)
+		assert.Equal(t, request.SpanID, span.Parent)
+		assert.Equal(t, tracing.SpanKindClient, span.Kind)
+		assert.Empty(t, span.Error, "missing records are not errors")
+	}
+	assert.Contains(t, names, "SELECT graph_apps")
+	assert.Contains(t, names, "SELECT graph_nodes")
+}
@@ -0,0 +1,293 @@
+// Package tracing records spans of API requests and database queries and
+// propagates them with W3C trace context headers. It is deliberately small:
+// spans are handed to an Exporter in batches, such as the OTLP exporter of
+// the execution package, which also exports runs as traces.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader carries the trace context of a request
+const TraceparentHeader = "traceparent"
+
+// SpanKind tells what a span represents, with the values of OTLP
+type SpanKind int
+
+// Kinds of spans
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// SpanContext identifies a span within a trace
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+}
+
+// IsValid reports whether trace and span ID are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceIDString returns the trace ID as 32 hex digits
+func (sc SpanContext) TraceIDString() string {
+	return hex.EncodeToString(sc.TraceID[:])
+}
+
+// SpanIDString returns the span ID as 16 hex digits
+func (sc SpanContext) SpanIDString() string {
+	return hex.EncodeToString(sc.SpanID[:])
+}
+
+// Traceparent formats the span context as a sampled traceparent header
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", sc.TraceIDString(), sc.SpanIDString())
+}
+
+// ParseTraceparent parses a traceparent header of version 00
+func ParseTraceparent(header string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", header)
+	}
+
+	var sc SpanContext
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, fmt.Errorf("invalid trace ID: %w", err)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, fmt.Errorf("invalid span ID: %w", err)
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", header)
+	}
+	return sc, nil
+}
+
+// Attribute is a string or int64 value describing a span
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Span is an operation of a trace. Its methods are not safe for concurrent
+// use; End hands it to the tracer that started it.
+type Span struct {
+	SpanContext
+	Parent     [8]byte // Zero for root spans
+	Name       string
+	Kind       SpanKind
+	Start      time.Time
+	End        time.Time
+	Attributes []Attribute
+	// Links point to related spans of other traces, e.g. the run a request
+	// started
+	Links []SpanContext
+	// Error marks the span as failed
+	Error string
+
+	tracer *Tracer
+}
+
+// SetAttribute adds a string attribute
+func (s *Span) SetAttribute(key, value string) {
+	s.Attributes = append(s.Attributes, Attribute{Key: key, Value: value})
+}
+
+// SetIntAttribute adds an integer attribute
+func (s *Span) SetIntAttribute(key string, value int64) {
+	s.Attributes = append(s.Attributes, Attribute{Key: key, Value: value})
+}
+
+// AddLink links the span to another span
+func (s *Span) AddLink(sc SpanContext) {
+	s.Links = append(s.Links, sc)
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(err error) {
+	if err != nil {
+		s.Error = err.Error()
+	}
+}
+
+// Finish ends the span and queues it for export
+func (s *Span) Finish() {
+	s.End = time.Now()
+	if s.tracer != nil {
+		s.tracer.enqueue(*s)
+	}
+}
+
+type contextKey struct{}
+
+// spanValue is the span context stored in a context.Context; span is nil
+// for remote parents
+type spanValue struct {
+	sc   SpanContext
+	span *Span
+}
+
+// ContextWithRemoteParent returns ctx with a parent from a traceparent
+// header, so that spans started from ctx join the caller's trace
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, contextKey{}, spanValue{sc: sc})
+}
+
+// SpanContextFromContext returns the context of the current span in ctx
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	value, ok := ctx.Value(contextKey{}).(spanValue)
+	return value.sc, ok
+}
+
+// SpanFromContext returns the span started with ctx's parent, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	value, _ := ctx.Value(contextKey{}).(spanValue)
+	return value.span
+}
+
+// Exporter sends finished spans, e.g. to an OpenTelemetry collector
+type Exporter interface {
+	ExportSpans(ctx context.Context, spans []Span) error
+}
+
+// TracerOptions configures a Tracer
+type TracerOptions struct {
+	// BatchSize is the number of spans sent at once. Default: 256
+	BatchSize int
+	// Interval is the longest time spans wait for export. Default: 5s
+	Interval time.Duration
+	// QueueSize is the number of spans waiting for export; further spans are
+	// dropped. Default: 4096
+	QueueSize int
+	// OnError is called with export errors. Default: ignore them
+	OnError func(error)
+}
+
+// Tracer starts spans and exports the finished ones in the background in
+// batches
+type Tracer struct {
+	exporter Exporter
+	opts     TracerOptions
+	queue    chan Span
+	done     chan struct{}
+
+	closeOnce sync.Once
+	mu        sync.Mutex
+	closed    bool
+	dropped   int64
+}
+
+// NewTracer starts a tracer exporting to exporter; Close it to flush the
+// remaining spans
+func NewTracer(exporter Exporter, opts TracerOptions) *Tracer {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 256
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Second
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 4096
+	}
+	t := &Tracer{
+		exporter: exporter,
+		opts:     opts,
+		queue:    make(chan Span, opts.QueueSize),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// Start starts a span, as a child of the current span in ctx if there is
+// one, and returns a context holding it
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	span := &Span{Name: name, Kind: kind, Start: time.Now(), tracer: t}
+	if parent, ok := SpanContextFromContext(ctx); ok {
+		span.TraceID = parent.TraceID
+		span.Parent = parent.SpanID
+	} else {
+		_, _ = rand.Read(span.TraceID[:])
+	}
+	_, _ = rand.Read(span.SpanID[:])
+	return context.WithValue(ctx, contextKey{}, spanValue{sc: span.SpanContext, span: span}), span
+}
+
+// Dropped returns the number of spans dropped because the queue was full
+func (t *Tracer) Dropped() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dropped
+}
+
+// Close exports the queued spans and stops the tracer. Spans finished
+// afterwards are dropped.
+func (t *Tracer) Close() {
+	t.closeOnce.Do(func() {
+		t.mu.Lock()
+		t.closed = true
+		close(t.queue)
+		t.mu.Unlock()
+		<-t.done
+	})
+}
+
+func (t *Tracer) enqueue(span Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		t.dropped++
+		return
+	}
+	select {
+	case t.queue <- span:
+	default:
+		t.dropped++
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.opts.Interval)
+	defer ticker.Stop()
+
+	var batch []Span
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := t.exporter.ExportSpans(ctx, batch)
+		cancel()
+		if err != nil && t.opts.OnError != nil {
+			t.opts.OnError(err)
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case span, ok := <-t.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= t.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
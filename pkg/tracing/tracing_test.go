@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingExporter struct {
+	mu      sync.Mutex
+	batches [][]Span
+	err     error
+}
+
+func (e *recordingExporter) ExportSpans(ctx context.Context, spans []Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.batches = append(e.batches, spans)
+	return e.err
+}
+
+func (e *recordingExporter) spans() []Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var spans []Span
+	for _, batch := range e.batches {
+		spans = append(spans, batch...)
+	}
+	return spans
+}
+
+func TestParseTraceparent(t *testing.T) {
+	sc, err := ParseTraceparent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	require.NoError(t, err)
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", sc.TraceIDString())
+	assert.Equal(t, "b7ad6b7169203331", sc.SpanIDString())
+	assert.Equal(t, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", sc.Traceparent())
+
+	for _, header := range []string{
+		"",
+		"01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b71692033-01",
+		"00-0af7651916cd43dd8448eb211c80319z-b7ad6b7169203331-01",
+		"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+	} {
+		_, err := ParseTraceparent(header)
+		assert.Error(t, err, header)
+	}
+}
+
+func TestTracer_Start(t *testing.T) {
+	exporter := &recordingExporter{}
+	tracer := NewTracer(exporter, TracerOptions{})
+
+	ctx, root := tracer.Start(context.Background(), "request", SpanKindServer)
+	assert.True(t, root.IsValid())
+	assert.Equal(t, [8]byte{}, root.Parent)
+	assert.Same(t, root, SpanFromContext(ctx))
+
+	_, child := tracer.Start(ctx, "query", SpanKindClient)
+	assert.Equal(t, root.TraceID, child.TraceID)
+	assert.Equal(t, root.SpanID, child.Parent)
+	assert.NotEqual(t, root.SpanID, child.SpanID)
+
+	remote, err := ParseTraceparent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	require.NoError(t, err)
+	remoteCtx := ContextWithRemoteParent(context.Background(), remote)
+	assert.Nil(t, SpanFromContext(remoteCtx))
+	_, joined := tracer.Start(remoteCtx, "request", SpanKindServer)
+	assert.Equal(t, remote.TraceID, joined.TraceID)
+	assert.Equal(t, remote.SpanID, joined.Parent)
+
+	child.SetError(errors.New("boom"))
+	child.Finish()
+	root.SetIntAttribute("http.response.status_code", 200)
+	root.Finish()
+	tracer.Close()
+
+	spans := exporter.spans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "query", spans[0].Name)
+	assert.Equal(t, "boom", spans[0].Error)
+	assert.False(t, spans[1].End.Before(spans[1].Start))
+	assert.Equal(t, []Attribute{{Key: "http.response.status_code", Value: int64(200)}}, spans[1].Attributes)
+}
+
+func TestTracer_Batching(t *testing.T) {
+	exporter := &recordingExporter{err: errors.New("collector down")}
+	var errs []error
+	var mu sync.Mutex
+	tracer := NewTracer(exporter, TracerOptions{
+		BatchSize: 2,
+		Interval:  time.Hour,
+		OnError: func(err error) {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		},
+	})
+
+	for i := 0; i < 5; i++ {
+		_, span := tracer.Start(context.Background(), "span", SpanKindInternal)
+		span.Finish()
+	}
+	tracer.Close()
+	tracer.Close()
+
+	_, late := tracer.Start(context.Background(), "late", SpanKindInternal)
+	late.Finish()
+
+	assert.Len(t, exporter.spans(), 5)
+	exporter.mu.Lock()
+	assert.Len(t, exporter.batches, 3, "two full batches and the rest on close")
+	exporter.mu.Unlock()
+	assert.Len(t, errs, 3)
+	assert.Equal(t, int64(1), tracer.Dropped(), "spans finished after Close are dropped")
+}